@@ -1,21 +1,42 @@
+// Package cacher caches the responses of the Darknodes. The cacher can be used
+// without the rest of the Lightnode by constructing it with NewWithOptions and
+// a dispatcher, such as one from the dispatcher package.
 package cacher
 
 import (
+	"context"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
 	"github.com/renproject/kv"
 	"github.com/renproject/lightnode/compat/v1"
 	"github.com/renproject/lightnode/db"
 	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/metrics"
 	"github.com/renproject/pack"
 	"github.com/renproject/phi"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/sha3"
 )
 
+// revalidateTimeout bounds the time spent refreshing a cached response in the
+// background.
+const revalidateTimeout = 30 * time.Second
+
+// Flush is a message which clears the in-memory cache of the cacher. Responses
+// in the shared cache are not removed, as they belong to every replica, but
+// they are not read until the TTL has passed, so that the cacher does not fill
+// up again with the responses which were flushed.
+type Flush struct{}
+
 // ID is a key for a cached response.
 type ID [32]byte
 
@@ -31,25 +52,89 @@ func (id ID) String() string {
 // `Dispatcher` has a response ready, the `Cacher` will store this response in
 // its cache with a key derived from the request, and then pass the response
 // along to be given to the client.
+//
+// Cached responses which are older than the revalidation age are still served,
+// but are also refreshed from the Darknodes in the background, so that
+// popular requests are refreshed before they expire rather than missing the
+// cache.
+//
+// Responses to some methods can have their own TTL, such as a short TTL for
+// queryBlockState and a long TTL for queryTx responses of txs which are done.
+// Revalidation of these responses is scaled with their TTL.
 type Cacher struct {
-	logger     logrus.FieldLogger
-	dispatcher phi.Sender
-	db         db.DB
-	ttlCache   kv.Table
+	logger          logrus.FieldLogger
+	dispatcher      phi.Sender
+	db              db.DB
+	ttlCache        kv.Table
+	ttl             time.Duration
+	methodTTLs      map[string]time.Duration
+	shared          SharedCache
+	revalidateAfter time.Duration
+
+	revalidatingMu *sync.Mutex
+	revalidating   map[string]bool
+
+	// generation is part of the keys of the in-memory cache, so that
+	// flushing the cache only needs to change the generation. Flushed
+	// responses expire with their TTL. flushedAt is the unix time in
+	// nanoseconds of the last flush.
+	generation uint64
+	flushedAt  int64
 }
 
-// New constructs a new `Cacher` as a `phi.Task` which can be `Run()`.
-func New(dispatcher phi.Sender, logger logrus.FieldLogger, ttl kv.Table, opts phi.Options, db db.DB) phi.Task {
+// cacheEntry is a response in the in-memory cache, along with the time it was
+// received from the Darknodes. The TTL of the response and whether it is final
+// are worked out when it is cached, so that cache hits do not need to decode
+// the response.
+type cacheEntry struct {
+	Response jsonrpc.Response `json:"response"`
+	Fetched  time.Time        `json:"fetched"`
+	TTL      time.Duration    `json:"ttl"`
+	Final    bool             `json:"final"`
+}
+
+// newEntry returns a cache entry for the response to a request with the
+// method, fetched now.
+func (cacher *Cacher) newEntry(method string, response jsonrpc.Response) cacheEntry {
+	done, final := queryTxStatus(method, response)
+	return cacheEntry{
+		Response: response,
+		Fetched:  time.Now(),
+		TTL:      cacher.methodTTL(method, done),
+		Final:    final,
+	}
+}
+
+// expired returns whether the entry is older than its own TTL. Entries
+// without a TTL of their own expire with the in-memory cache.
+func (entry cacheEntry) expired() bool {
+	return entry.TTL != 0 && time.Since(entry.Fetched) >= entry.TTL
+}
+
+// New constructs a new `Cacher` as a `phi.Task` which can be `Run()`. The
+// database and shared cache are optional and can be nil if responses should
+// only be cached in memory. Responses are refreshed in the background once they are older
+// than revalidateAfter, which should be less than the TTL of the cache; zero
+// disables revalidation.
+func New(dispatcher phi.Sender, logger logrus.FieldLogger, ttl kv.Table, opts phi.Options, db db.DB, shared SharedCache, revalidateAfter time.Duration) phi.Task {
 	return phi.New(&Cacher{
-		logger:     logger,
-		dispatcher: dispatcher,
-		db:         db,
-		ttlCache:   ttl,
+		logger:          logger,
+		dispatcher:      dispatcher,
+		db:              db,
+		ttlCache:        ttl,
+		shared:          shared,
+		revalidateAfter: revalidateAfter,
+		revalidatingMu:  new(sync.Mutex),
+		revalidating:    map[string]bool{},
 	}, opts)
 }
 
 // Handle implements the `phi.Handler` interface.
 func (cacher *Cacher) Handle(_ phi.Task, message phi.Message) {
+	if _, ok := message.(Flush); ok {
+		cacher.flush()
+		return
+	}
 	msg, ok := message.(http.RequestWithResponder)
 	if !ok {
 		cacher.logger.Panicf("[cacher] unexpected message type %T", message)
@@ -75,44 +160,208 @@ func (cacher *Cacher) Handle(_ phi.Task, message phi.Message) {
 	// The cacher will only be called when the darknode itself is queried
 	default:
 		darknodeID := msg.Query.Get("id")
-		response, cached := cacher.get(reqID, darknodeID)
+		entry, cached := cacher.get(reqID, darknodeID, msg.Method)
 		if cached {
-			msg.Responder <- response
+			metrics.ObserveCache(msg.Method, metrics.CacheHit)
+			msg.Responder <- entry.Response
+			if cacher.revalidateAfter > 0 && time.Since(entry.Fetched) >= cacher.revalidateAge(entry.TTL) && !entry.Final {
+				cacher.revalidate(reqID, msg)
+			}
+			return
+		}
+		if msg.Method == jsonrpc.MethodQueryTx && cacher.db != nil {
+			// The persisted response is read in the background, so that
+			// the handler does not wait on the database.
+			go cacher.handleQueryTx(reqID, darknodeID, msg)
 			return
 		}
+		metrics.ObserveCache(msg.Method, metrics.CacheMiss)
+	}
+	cacher.send(reqID, msg)
+}
+
+// handleQueryTx responds to the queryTx request with the persisted response if
+// the tx is final, and otherwise sends the request to the Darknodes.
+func (cacher *Cacher) handleQueryTx(reqID ID, darknodeID string, msg http.RequestWithResponder) {
+	if response, ok := cacher.finalQueryTx(msg); ok {
+		metrics.ObserveCache(msg.Method, metrics.CacheFinal)
+		cacher.insert(reqID, darknodeID, msg.Method, response)
+		msg.Responder <- response
+		return
+	}
+	metrics.ObserveCache(msg.Method, metrics.CacheMiss)
+	cacher.send(reqID, msg)
+}
+
+// send dispatches the request, and responds with an error if the dispatcher
+// does not accept it.
+func (cacher *Cacher) send(reqID ID, msg http.RequestWithResponder) {
+	if !cacher.dispatch(reqID, msg) {
+		cacher.logger.Errorf("[cacher] cannot send %v request to dispatcher", msg.Method)
+		msg.RespondWithErr(jsonrpc.ErrorCodeInternal, fmt.Errorf("dispatcher unavailable"))
 	}
-	cacher.dispatch(reqID, msg)
 }
 
-func (cacher *Cacher) insert(reqID ID, darknodeID string, response jsonrpc.Response) {
+// insert caches the response, and returns the entry it was cached as.
+func (cacher *Cacher) insert(reqID ID, darknodeID, method string, response jsonrpc.Response) cacheEntry {
 	id := reqID.String() + darknodeID
-	if err := cacher.ttlCache.Insert(id, response); err != nil {
+	entry := cacher.newEntry(method, response)
+	if err := cacher.ttlCache.Insert(cacher.localKey(id), entry); err != nil {
 		cacher.logger.Errorf("[cacher] cannot insert response into TTL cache: %v", err)
-		return
+		return entry
 	}
+
+	if cacher.shared == nil {
+		return entry
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		cacher.logger.Errorf("[cacher] cannot marshal response for shared cache: %v", err)
+		return entry
+	}
+	if err := cacher.shared.Set(id, data, entry.TTL); err != nil {
+		cacher.logger.Warnf("[cacher] cannot insert response into shared cache: %v", err)
+	}
+	return entry
 }
 
-func (cacher *Cacher) get(reqID ID, darknodeID string) (jsonrpc.Response, bool) {
+// get returns the cached entry for the request.
+func (cacher *Cacher) get(reqID ID, darknodeID, method string) (cacheEntry, bool) {
 	id := reqID.String() + darknodeID
 
+	// Responses stay in the in-memory cache for its TTL, so responses with a
+	// shorter TTL of their own are checked for expiry.
+	var entry cacheEntry
+	if err := cacher.ttlCache.Get(cacher.localKey(id), &entry); err == nil && !entry.expired() {
+		return entry, true
+	}
+
+	// Fall back to the shared cache, which may hold a response cached by
+	// another replica.
+	if cacher.shared == nil || cacher.recentlyFlushed() {
+		return cacheEntry{}, false
+	}
+	data, ok, err := cacher.shared.Get(id)
+	if err != nil {
+		cacher.logger.Warnf("[cacher] cannot read from shared cache: %v", err)
+		return cacheEntry{}, false
+	}
+	if !ok {
+		return cacheEntry{}, false
+	}
 	var response jsonrpc.Response
-	if err := cacher.ttlCache.Get(id, &response); err == nil {
-		return response, true
+	if err := json.Unmarshal(data, &response); err != nil {
+		cacher.logger.Warnf("[cacher] cannot unmarshal response from shared cache: %v", err)
+		return cacheEntry{}, false
 	}
 
-	return jsonrpc.Response{}, false
+	// Populate the in-memory cache so subsequent requests do not need to hit
+	// the shared cache. The shared cache does not record when the response
+	// was fetched, so it is treated as fresh.
+	entry = cacher.newEntry(method, response)
+	if err := cacher.ttlCache.Insert(cacher.localKey(id), entry); err != nil {
+		cacher.logger.Errorf("[cacher] cannot insert response into TTL cache: %v", err)
+	}
+	return entry, true
+}
+
+// flush clears the in-memory cache.
+func (cacher *Cacher) flush() {
+	atomic.StoreInt64(&cacher.flushedAt, time.Now().UnixNano())
+	generation := atomic.AddUint64(&cacher.generation, 1)
+	cacher.logger.Infof("[cacher] flushed cache, now at generation %v", generation)
+}
+
+// recentlyFlushed returns whether the cache was flushed within the TTL, in
+// which case the shared cache may still hold the flushed responses.
+func (cacher *Cacher) recentlyFlushed() bool {
+	flushedAt := atomic.LoadInt64(&cacher.flushedAt)
+	return flushedAt != 0 && time.Since(time.Unix(0, flushedAt)) < cacher.ttl
+}
+
+// localKey returns the key of the response in the in-memory cache.
+func (cacher *Cacher) localKey(id string) string {
+	return fmt.Sprintf("%v_%v", atomic.LoadUint64(&cacher.generation), id)
+}
+
+// methodTTL returns the TTL of the response to a request with the method, or
+// zero if it has the default TTL. Done is whether the response is for a tx
+// which is done.
+func (cacher *Cacher) methodTTL(method string, done bool) time.Duration {
+	if ttl, ok := cacher.methodTTLs[FinalQueryTx]; ok && method == jsonrpc.MethodQueryTx && done {
+		return ttl
+	}
+	return cacher.methodTTLs[method]
 }
 
-func (cacher *Cacher) dispatch(id [32]byte, msg http.RequestWithResponder) {
+// revalidateAge returns the age after which a response with the TTL is
+// refreshed. Responses with their own TTL are refreshed at the same fraction of
+// their TTL as other responses.
+func (cacher *Cacher) revalidateAge(ttl time.Duration) time.Duration {
+	if ttl == 0 || cacher.ttl == 0 {
+		return cacher.revalidateAfter
+	}
+	return time.Duration(float64(cacher.revalidateAfter) * float64(ttl) / float64(cacher.ttl))
+}
+
+// revalidate refreshes the cached response to the request in the background,
+// unless it is already being refreshed. The request context is not used, as
+// the client has already been responded to.
+func (cacher *Cacher) revalidate(reqID ID, msg http.RequestWithResponder) {
+	id := reqID.String() + msg.Query.Get("id")
+	cacher.revalidatingMu.Lock()
+	if cacher.revalidating[id] {
+		cacher.revalidatingMu.Unlock()
+		return
+	}
+	cacher.revalidating[id] = true
+	cacher.revalidatingMu.Unlock()
+
+	done := func() {
+		cacher.revalidatingMu.Lock()
+		delete(cacher.revalidating, id)
+		cacher.revalidatingMu.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
 	responder := make(chan jsonrpc.Response, 1)
-	cacher.dispatcher.Send(http.RequestWithResponder{
-		Context:   msg.Context,
+	ok := cacher.dispatch(reqID, http.RequestWithResponder{
+		Context:   ctx,
 		ID:        msg.ID,
 		Method:    msg.Method,
 		Params:    msg.Params,
 		Responder: responder,
 		Query:     msg.Query,
 	})
+	if !ok {
+		cancel()
+		done()
+		return
+	}
+	go func() {
+		defer cancel()
+		defer done()
+		select {
+		case <-responder:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// dispatch sends the request to the Darknodes and caches the response before
+// passing it on. It returns false if the dispatcher did not accept the request.
+func (cacher *Cacher) dispatch(id [32]byte, msg http.RequestWithResponder) bool {
+	responder := make(chan jsonrpc.Response, 1)
+	if !cacher.dispatcher.Send(http.RequestWithResponder{
+		Context:   msg.Context,
+		ID:        msg.ID,
+		Method:    msg.Method,
+		Params:    msg.Params,
+		Responder: responder,
+		Query:     msg.Query,
+	}) {
+		return false
+	}
 
 	go func() {
 		response := <-responder
@@ -120,16 +369,10 @@ func (cacher *Cacher) dispatch(id [32]byte, msg http.RequestWithResponder) {
 		// don't cache if we don't have output
 		skipCache := func() bool {
 			if msg.Method == jsonrpc.MethodQueryTx && response.Error == nil {
-				raw, err := json.Marshal(response.Result)
 				// no need to handle errors here as it will be handled by the resolver
+				tx, err := http.DecodeQueryTxResult(response.Result)
 				if err != nil {
-					cacher.logger.Warnf("failed to marshal queryTx response: %v", err)
-					return true
-				}
-				var tx jsonrpc.ResponseQueryTx
-				err = json.Unmarshal(raw, &tx)
-				if err != nil {
-					cacher.logger.Warnf("failed to unmarshal queryTx response: %v", err)
+					cacher.logger.Warnf("failed to decode queryTx response: %v", err)
 					return true
 				}
 
@@ -156,8 +399,71 @@ func (cacher *Cacher) dispatch(id [32]byte, msg http.RequestWithResponder) {
 			return false
 		}
 		if !skipCache() {
-			cacher.insert(id, msg.Query.Get("id"), response)
+			entry := cacher.insert(id, msg.Query.Get("id"), msg.Method, response)
+			if cacher.db != nil && entry.Final {
+				cacher.persistFinal(response)
+			}
 		}
 		msg.Responder <- response
 	}()
+	return true
+}
+
+// queryTxStatus returns whether the response is to a queryTx request for a tx
+// which is done, and whether it is also final, ie. done and signed. Final
+// responses never change, so they are not refreshed and are persisted
+// indefinitely.
+func queryTxStatus(method string, response jsonrpc.Response) (done, final bool) {
+	if method != jsonrpc.MethodQueryTx || response.Error != nil || response.Result == nil {
+		return false, false
+	}
+	resp, err := http.DecodeQueryTxResult(response.Result)
+	if err != nil || resp.TxStatus != tx.StatusDone {
+		return false, false
+	}
+	sig, ok := resp.Tx.Output.Get("sig").(pack.Bytes65)
+	return true, ok && sig != pack.Bytes65{}
+}
+
+// persistFinal stores the result of a final queryTx response in the database.
+func (cacher *Cacher) persistFinal(response jsonrpc.Response) {
+	resp, err := http.DecodeQueryTxResult(response.Result)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		cacher.logger.Errorf("[cacher] cannot marshal final queryTx result: %v", err)
+		return
+	}
+	if err := cacher.db.InsertFinalQueryTx(resp.Tx.Hash, data); err != nil {
+		cacher.logger.Warnf("[cacher] cannot persist final queryTx result for tx=%v: %v", resp.Tx.Hash, err)
+	}
+}
+
+// finalQueryTx returns the persisted response to the queryTx request, if the
+// tx it queries is final.
+func (cacher *Cacher) finalQueryTx(msg http.RequestWithResponder) (jsonrpc.Response, bool) {
+	var params jsonrpc.ParamsQueryTx
+	switch p := msg.Params.(type) {
+	case *jsonrpc.ParamsQueryTx:
+		params = *p
+	case jsonrpc.ParamsQueryTx:
+		params = p
+	case json.RawMessage:
+		if err := json.Unmarshal(p, &params); err != nil {
+			return jsonrpc.Response{}, false
+		}
+	default:
+		return jsonrpc.Response{}, false
+	}
+
+	data, err := cacher.db.FinalQueryTx(params.TxHash)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			cacher.logger.Warnf("[cacher] cannot read final queryTx result for tx=%v: %v", params.TxHash, err)
+		}
+		return jsonrpc.Response{}, false
+	}
+	return jsonrpc.NewResponse(msg.ID, json.RawMessage(data), nil), true
 }
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"time"
@@ -15,6 +17,8 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/renproject/lightnode/cacher"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/kv"
 	"github.com/renproject/lightnode/db"
@@ -25,17 +29,17 @@ import (
 )
 
 var _ = Describe("Cacher", func() {
-	init := func(ctx context.Context, interval time.Duration) (phi.Sender, <-chan phi.Message) {
+	init := func(ctx context.Context, interval time.Duration, shared SharedCache, revalidateAfter time.Duration) (phi.Sender, <-chan phi.Message) {
 		inspector, messages := testutils.NewInspector(10)
 		ttl := kv.NewTTLCache(ctx, kv.NewMemDB(kv.JSONCodec), "cacher", interval)
 
 		sqlDB, err := sql.Open("sqlite3", "./test.db")
 		Expect(err).NotTo(HaveOccurred())
 
-		database := db.New(sqlDB, 100)
+		database := db.New(sqlDB, 100, 1)
 		Expect(database.Init()).Should(Succeed())
 
-		cacher := New(inspector, logrus.New(), ttl, phi.Options{Cap: 10}, database)
+		cacher := New(inspector, logrus.New(), ttl, phi.Options{Cap: 10}, database, shared, revalidateAfter)
 		go inspector.Run(ctx)
 		go cacher.Run(ctx)
 
@@ -50,7 +54,7 @@ var _ = Describe("Cacher", func() {
 		It("should pass the request through", func() {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
-			cacher, messages := init(ctx, time.Minute)
+			cacher, messages := init(ctx, time.Minute, nil, 0)
 			defer cleanup()
 
 			for method := range jsonrpc.RPCs {
@@ -82,7 +86,7 @@ var _ = Describe("Cacher", func() {
 		It("should strip revert messages", func() {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
-			cacher, messages := init(ctx, time.Minute)
+			cacher, messages := init(ctx, time.Minute, nil, 0)
 			defer cleanup()
 
 			method := jsonrpc.MethodQueryTx
@@ -129,7 +133,7 @@ var _ = Describe("Cacher", func() {
 		It("should return the cached response", func() {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
-			cacher, messages := init(ctx, time.Minute)
+			cacher, messages := init(ctx, time.Minute, nil, 0)
 			defer cleanup()
 
 			for method := range jsonrpc.RPCs {
@@ -169,5 +173,245 @@ var _ = Describe("Cacher", func() {
 				Expect(respBytes).To(Equal(newRespBytes))
 			}
 		})
+
+		It("should query the darknodes again once the cache is flushed", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cacher, messages := init(ctx, time.Minute, nil, 0)
+			defer cleanup()
+
+			method := jsonrpc.MethodQueryBlockState
+			id, params := testutils.ValidRequest(method)
+			request := http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			var message phi.Message
+			Eventually(messages).Should(Receive(&message))
+			message.(http.RequestWithResponder).Responder <- testutils.ErrorResponse(request.ID)
+			Eventually(request.Responder).Should(Receive())
+
+			// The response is cached.
+			request = http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			Eventually(request.Responder).Should(Receive())
+			Consistently(messages).ShouldNot(Receive())
+
+			// Once flushed, the request is sent to the darknodes again.
+			w := httptest.NewRecorder()
+			NewFlushHandler(cacher).ServeHTTP(w, httptest.NewRequest(nethttp.MethodPost, "/cache", nil))
+			Expect(w.Code).To(Equal(nethttp.StatusAccepted))
+			request = http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			Eventually(messages).Should(Receive())
+		})
+	})
+	Context("when a tx is done and signed", func() {
+		It("should persist the response and serve it without querying the darknodes", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cacher, messages := init(ctx, time.Minute, nil, 0)
+			defer cleanup()
+
+			queryTx := testutils.MockQueryTxResponse()
+			params := jsonrpc.ParamsQueryTx{TxHash: queryTx.Tx.Hash}
+			request := http.NewRequestWithResponder(ctx, 1, jsonrpc.MethodQueryTx, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			var message phi.Message
+			Eventually(messages).Should(Receive(&message))
+			message.(http.RequestWithResponder).Responder <- jsonrpc.NewResponse(request.ID, queryTx, nil)
+			Eventually(request.Responder).Should(Receive())
+
+			// A new cacher does not have the response in memory, but reads
+			// it from the database.
+			otherCacher, otherMessages := init(ctx, time.Minute, nil, 0)
+			request = http.NewRequestWithResponder(ctx, 2, jsonrpc.MethodQueryTx, params, url.Values{})
+			Expect(otherCacher.Send(request)).Should(BeTrue())
+			var response jsonrpc.Response
+			Eventually(request.Responder).Should(Receive(&response))
+			Expect(response.Error).To(BeNil())
+			Expect(response.ID).To(Equal(2))
+			result, err := http.DecodeQueryTxResult(response.Result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Tx.Hash).To(Equal(queryTx.Tx.Hash))
+			Expect(result.TxStatus).To(Equal(queryTx.TxStatus))
+			Consistently(otherMessages).ShouldNot(Receive())
+		})
+	})
+
+	Context("when constructed without a database", func() {
+		It("should cache final responses in memory", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			inspector, messages := testutils.NewInspector(10)
+			go inspector.Run(ctx)
+			cacher := NewWithOptions(ctx, inspector, DefaultOptions().WithTTL(time.Minute).WithCap(10))
+			go cacher.Run(ctx)
+
+			queryTx := testutils.MockQueryTxResponse()
+			params := jsonrpc.ParamsQueryTx{TxHash: queryTx.Tx.Hash}
+			request := http.NewRequestWithResponder(ctx, 1, jsonrpc.MethodQueryTx, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			var message phi.Message
+			Eventually(messages).Should(Receive(&message))
+			message.(http.RequestWithResponder).Responder <- jsonrpc.NewResponse(request.ID, queryTx, nil)
+			Eventually(request.Responder).Should(Receive())
+
+			request = http.NewRequestWithResponder(ctx, 1, jsonrpc.MethodQueryTx, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			Eventually(request.Responder).Should(Receive())
+			Consistently(messages).ShouldNot(Receive())
+		})
+	})
+
+	Context("when a cached response is older than the revalidation age", func() {
+		It("should serve it while refreshing it in the background", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cacher, messages := init(ctx, time.Minute, nil, 100*time.Millisecond)
+			defer cleanup()
+
+			method := jsonrpc.MethodQueryBlockState
+			id, params := testutils.ValidRequest(method)
+			send := func() string {
+				request := http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+				Expect(cacher.Send(request)).Should(BeTrue())
+				var response jsonrpc.Response
+				Eventually(request.Responder).Should(Receive(&response))
+				data, err := json.Marshal(response)
+				Expect(err).NotTo(HaveOccurred())
+				return string(data)
+			}
+			respond := func(response jsonrpc.Response) string {
+				var message phi.Message
+				Eventually(messages).Should(Receive(&message))
+				req, ok := message.(http.RequestWithResponder)
+				Expect(ok).To(BeTrue())
+				req.Responder <- response
+				data, err := json.Marshal(response)
+				Expect(err).NotTo(HaveOccurred())
+				return string(data)
+			}
+
+			firstResponse := make(chan string, 1)
+			go func() {
+				defer GinkgoRecover()
+				firstResponse <- respond(testutils.ErrorResponse(id))
+			}()
+			Expect(send()).To(MatchJSON(<-firstResponse))
+			first := send()
+
+			// A fresh response is served without revalidating.
+			Consistently(messages).ShouldNot(Receive())
+
+			// A stale response is served, and is refreshed once even if it
+			// is requested again while being refreshed.
+			time.Sleep(200 * time.Millisecond)
+			Expect(send()).To(MatchJSON(first))
+			Expect(send()).To(MatchJSON(first))
+			second := respond(jsonrpc.NewResponse(id, map[string]interface{}{"refreshed": true}, nil))
+			Consistently(messages).ShouldNot(Receive())
+
+			Eventually(send).Should(MatchJSON(second))
+		})
+	})
+
+	Context("when using a shared cache", func() {
+		It("should return responses cached by another cacher", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mr, err := miniredis.Run()
+			Expect(err).NotTo(HaveOccurred())
+			defer mr.Close()
+			client := redis.NewClient(&redis.Options{
+				Addr: mr.Addr(),
+			})
+			shared := NewRedisCache(client, time.Minute)
+
+			first, firstMessages := init(ctx, time.Minute, shared, 0)
+			second, secondMessages := init(ctx, time.Minute, shared, 0)
+			defer cleanup()
+
+			method := jsonrpc.MethodQueryBlockState
+			id, params := testutils.ValidRequest(method)
+
+			// Respond to the first request through the first cacher.
+			request := http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+			Expect(first.Send(request)).Should(BeTrue())
+			var message phi.Message
+			Eventually(firstMessages).Should(Receive(&message))
+			req, ok := message.(http.RequestWithResponder)
+			Expect(ok).To(BeTrue())
+			resp := testutils.ErrorResponse(request.ID)
+			req.Responder <- resp
+			Eventually(request.Responder).Should(Receive())
+
+			// The second cacher should respond without dispatching.
+			newReq := http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+			Expect(second.Send(newReq)).Should(BeTrue())
+			var newResp jsonrpc.Response
+			Eventually(newReq.Responder).Should(Receive(&newResp))
+			Consistently(secondMessages).ShouldNot(Receive())
+
+			respBytes, err := json.Marshal(resp)
+			Expect(err).ToNot(HaveOccurred())
+			newRespBytes, err := json.Marshal(newResp)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newRespBytes).To(MatchJSON(respBytes))
+		})
+	})
+
+	Context("when methods have their own TTL", func() {
+		It("should expire their responses after the TTL in memory and in the shared cache", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			mr, err := miniredis.Run()
+			Expect(err).NotTo(HaveOccurred())
+			defer mr.Close()
+			client := redis.NewClient(&redis.Options{
+				Addr: mr.Addr(),
+			})
+
+			method := jsonrpc.MethodQueryBlockState
+			inspector, messages := testutils.NewInspector(10)
+			cacher := NewWithOptions(ctx, inspector, DefaultOptions().
+				WithTTL(time.Minute).
+				WithRevalidateAfter(0).
+				WithMethodTTLs(map[string]time.Duration{method: 100 * time.Millisecond}).
+				WithShared(NewRedisCache(client, time.Minute)))
+			go inspector.Run(ctx)
+			go cacher.Run(ctx)
+
+			id, params := testutils.ValidRequest(method)
+			respond := func() {
+				request := http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+				Expect(cacher.Send(request)).Should(BeTrue())
+				var message phi.Message
+				Eventually(messages).Should(Receive(&message))
+				req, ok := message.(http.RequestWithResponder)
+				Expect(ok).To(BeTrue())
+				req.Responder <- testutils.ErrorResponse(request.ID)
+				Eventually(request.Responder).Should(Receive())
+			}
+			respond()
+
+			// The response should be stored in Redis with the TTL of the
+			// method rather than the default TTL.
+			keys := mr.Keys()
+			Expect(keys).To(HaveLen(1))
+			Expect(mr.TTL(keys[0])).To(Equal(100 * time.Millisecond))
+
+			// The response should be served from the cache before it expires.
+			request := http.NewRequestWithResponder(ctx, id, method, params, url.Values{})
+			Expect(cacher.Send(request)).Should(BeTrue())
+			Eventually(request.Responder).Should(Receive())
+			Consistently(messages, 50*time.Millisecond).ShouldNot(Receive())
+
+			// Once it has expired, the request should be dispatched again.
+			time.Sleep(100 * time.Millisecond)
+			mr.FastForward(time.Second)
+			respond()
+		})
 	})
 })
@@ -0,0 +1,33 @@
+package cacher
+
+import (
+	"net/http"
+
+	"github.com/renproject/phi"
+)
+
+// FlushHandler serves the cache endpoint of the admin API. POST requests flush
+// the in-memory cache of the cacher, so that responses are fetched from the
+// Darknodes again.
+type FlushHandler struct {
+	cacher phi.Sender
+}
+
+// NewFlushHandler returns a FlushHandler for the cacher.
+func NewFlushHandler(cacher phi.Sender) FlushHandler {
+	return FlushHandler{cacher: cacher}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler FlushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !handler.cacher.Send(Flush{}) {
+		http.Error(w, "cacher is busy", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
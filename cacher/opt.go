@@ -0,0 +1,126 @@
+package cacher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/renproject/kv"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/phi"
+	"github.com/sirupsen/logrus"
+)
+
+// Enumerate default options.
+var (
+	DefaultTTL             = 3 * time.Second
+	DefaultRevalidateAfter = 2 * time.Second
+	DefaultCap             = 128
+)
+
+// FinalQueryTx is the key of the TTL of responses to queryTx requests for txs
+// which are done, as opposed to the TTL of other queryTx responses.
+const FinalQueryTx = "ren_queryTx/done"
+
+// Options to configure the precise behaviour of the cacher. Only the logger is
+// required; the database and shared cache are optional.
+type Options struct {
+	Logger          logrus.FieldLogger
+	TTL             time.Duration
+	RevalidateAfter time.Duration
+	Cap             int
+
+	// MethodTTLs overrides the TTL of the responses to requests with the given
+	// methods. TTLs longer than the TTL of the in-memory cache only apply to
+	// the shared cache, so that the in-memory cache stays small.
+	MethodTTLs map[string]time.Duration
+
+	// DB persists the responses for final txs, so that they are served after
+	// they expire from the in-memory cache. If it is nil, responses are only
+	// cached in memory.
+	DB db.DB
+
+	// Shared is a cache shared with other cachers, such as other Lightnode
+	// replicas. It can be nil.
+	Shared SharedCache
+}
+
+// DefaultOptions returns new options with default configurations that should
+// work for the majority of use cases.
+func DefaultOptions() Options {
+	return Options{
+		Logger:          logrus.New(),
+		TTL:             DefaultTTL,
+		RevalidateAfter: DefaultRevalidateAfter,
+		Cap:             DefaultCap,
+	}
+}
+
+// WithLogger returns new options with the given logger.
+func (opts Options) WithLogger(logger logrus.FieldLogger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithTTL returns new options with the given time for which responses are
+// cached.
+func (opts Options) WithTTL(ttl time.Duration) Options {
+	opts.TTL = ttl
+	return opts
+}
+
+// WithMethodTTLs returns new options with the given TTLs of the responses to
+// requests with each method. Use FinalQueryTx as the method to set the TTL of
+// queryTx responses for txs which are done.
+func (opts Options) WithMethodTTLs(methodTTLs map[string]time.Duration) Options {
+	opts.MethodTTLs = methodTTLs
+	return opts
+}
+
+// WithRevalidateAfter returns new options with the given age after which
+// cached responses are refreshed in the background. Zero disables
+// revalidation.
+func (opts Options) WithRevalidateAfter(revalidateAfter time.Duration) Options {
+	opts.RevalidateAfter = revalidateAfter
+	return opts
+}
+
+// WithCap returns new options with the given capacity of the message queue of
+// the cacher.
+func (opts Options) WithCap(cap int) Options {
+	opts.Cap = cap
+	return opts
+}
+
+// WithDB returns new options with the given database.
+func (opts Options) WithDB(db db.DB) Options {
+	opts.DB = db
+	return opts
+}
+
+// WithShared returns new options with the given shared cache.
+func (opts Options) WithShared(shared SharedCache) Options {
+	opts.Shared = shared
+	return opts
+}
+
+// NewWithOptions constructs a new `Cacher` with its own in-memory cache, for
+// use outside of the Lightnode. Requests sent to the cacher must be
+// `http.RequestWithResponder`s, and are forwarded to the dispatcher when their
+// response is not cached. The in-memory cache is cleared of expired responses
+// until the context is done.
+func NewWithOptions(ctx context.Context, dispatcher phi.Sender, options Options) phi.Task {
+	ttl := kv.NewTTLCache(ctx, kv.NewMemDB(kv.JSONCodec), "cacher", options.TTL)
+	return phi.New(&Cacher{
+		logger:          options.Logger,
+		dispatcher:      dispatcher,
+		db:              options.DB,
+		ttlCache:        ttl,
+		ttl:             options.TTL,
+		methodTTLs:      options.MethodTTLs,
+		shared:          options.Shared,
+		revalidateAfter: options.RevalidateAfter,
+		revalidatingMu:  new(sync.Mutex),
+		revalidating:    map[string]bool{},
+	}, phi.Options{Cap: options.Cap})
+}
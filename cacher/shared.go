@@ -0,0 +1,59 @@
+package cacher
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// SharedCache is an optional second cache tier which is shared between
+// Lightnode replicas. Responses missing from the in-memory cache of one replica
+// can be served from responses cached by another.
+type SharedCache interface {
+	// Get returns the value stored for the key, and false if no such value
+	// exists.
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores the value for the key until the TTL has passed. A TTL of zero
+	// uses the default TTL of the cache.
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// RedisCache is a SharedCache backed by Redis.
+type RedisCache struct {
+	client redis.Cmdable
+	ttl    time.Duration
+}
+
+// NewRedisCache returns a new RedisCache whose entries expire after the given
+// default TTL. This should be the same as the TTL of the in-memory cache.
+func NewRedisCache(client redis.Cmdable, ttl time.Duration) RedisCache {
+	return RedisCache{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// Get implements the SharedCache interface.
+func (cache RedisCache) Get(key string) ([]byte, bool, error) {
+	value, err := cache.client.Get(cache.key(key)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set implements the SharedCache interface.
+func (cache RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = cache.ttl
+	}
+	return cache.client.Set(cache.key(key), value, ttl).Err()
+}
+
+func (cache RedisCache) key(key string) string {
+	return "cacher_" + key
+}
@@ -0,0 +1,293 @@
+package lightnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/darknode/tx"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/health"
+	"github.com/renproject/lightnode/pause"
+	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/api/address"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// EVMChainIDs are the EIP-155 chain IDs of the EVM chains supported by default
+// on each network. Host chains added through configuration declare their own
+// chain ID. Chains on other networks are run locally, so they are not checked.
+var EVMChainIDs = map[multichain.Network]map[multichain.Chain]uint64{
+	multichain.NetworkMainnet: {
+		multichain.Arbitrum:          42161,
+		multichain.Avalanche:         43114,
+		multichain.BinanceSmartChain: 56,
+		multichain.Ethereum:          1,
+		multichain.Fantom:            250,
+		multichain.Polygon:           137,
+	},
+	multichain.NetworkTestnet: {
+		multichain.Arbitrum:          421611,
+		multichain.Avalanche:         43113,
+		multichain.BinanceSmartChain: 97,
+		multichain.Ethereum:          42,
+		multichain.Fantom:            4002,
+		multichain.Goerli:            5,
+		multichain.Polygon:           80001,
+	},
+}
+
+// A ChainIDClient returns the chain ID of the chain its RPC is for.
+type ChainIDClient interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+// ErrChainIDUnchecked is the error of RPCs whose chain ID has not been checked
+// yet, such as RPCs which were unreachable when the Lightnode started.
+var ErrChainIDUnchecked = errors.New("chain id has not been checked")
+
+// ChainIDGuard checks that the RPC of each EVM chain is for the expected chain,
+// so that an RPC for the wrong network cannot cause burns on that network to
+// be detected or txs to be verified against it. The guard fails closed: RPCs
+// are not used by the watchers, the verifier or the resolver until their chain
+// ID has been checked, or while it is wrong, and are reported as unhealthy.
+type ChainIDGuard struct {
+	logger logrus.FieldLogger
+
+	mu         *sync.RWMutex
+	expected   map[multichain.Chain]uint64
+	clients    map[multichain.Chain]ChainIDClient
+	mismatches map[multichain.Chain]error
+}
+
+// NewChainIDGuard returns a ChainIDGuard which checks the chain ID of each
+// client against the expected chain ID of its chain. Clients for chains
+// without an expected chain ID are ignored.
+func NewChainIDGuard(logger logrus.FieldLogger, expected map[multichain.Chain]uint64, clients map[multichain.Chain]ChainIDClient) *ChainIDGuard {
+	expectedIDs := map[multichain.Chain]uint64{}
+	checked := map[multichain.Chain]ChainIDClient{}
+	mismatches := map[multichain.Chain]error{}
+	for chain, client := range clients {
+		if chainID, ok := expected[chain]; ok {
+			expectedIDs[chain] = chainID
+			checked[chain] = client
+			mismatches[chain] = ErrChainIDUnchecked
+		}
+	}
+	return &ChainIDGuard{
+		logger:     logger,
+		expected:   expectedIDs,
+		clients:    checked,
+		mu:         new(sync.RWMutex),
+		mismatches: mismatches,
+	}
+}
+
+// Add a chain to be checked, replacing any client the chain already had.
+func (guard *ChainIDGuard) Add(chain multichain.Chain, expected uint64, client ChainIDClient) {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	guard.expected[chain] = expected
+	guard.clients[chain] = client
+	guard.mismatches[chain] = ErrChainIDUnchecked
+}
+
+// Check the chain ID of every RPC. RPCs which cannot be reached keep their
+// previous status, as reachability is checked by the health probes of the
+// chains, so RPCs which have never been reached remain unused.
+func (guard *ChainIDGuard) Check(ctx context.Context) {
+	// Chains can be added while the RPCs are checked, so the clients are
+	// copied first.
+	guard.mu.RLock()
+	clients := make(map[multichain.Chain]ChainIDClient, len(guard.clients))
+	expectedIDs := make(map[multichain.Chain]uint64, len(guard.expected))
+	for chain, client := range guard.clients {
+		clients[chain] = client
+		expectedIDs[chain] = guard.expected[chain]
+	}
+	guard.mu.RUnlock()
+
+	for chain, client := range clients {
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			guard.logger.Warnf("[chainid] cannot get chain id of %v rpc: %v", chain, err)
+			continue
+		}
+
+		var mismatch error
+		if expected := expectedIDs[chain]; !chainID.IsUint64() || chainID.Uint64() != expected {
+			mismatch = fmt.Errorf("rpc is for chain id %v, expected %v", chainID, expected)
+		}
+
+		guard.mu.Lock()
+		previous := guard.mismatches[chain]
+		if mismatch != nil {
+			guard.mismatches[chain] = mismatch
+		} else {
+			delete(guard.mismatches, chain)
+		}
+		guard.mu.Unlock()
+
+		switch {
+		case mismatch != nil && previous != mismatch:
+			guard.logger.Errorf("[chainid] not using %v rpc: %v", chain, mismatch)
+		case mismatch == nil && previous == ErrChainIDUnchecked:
+			guard.logger.Infof("[chainid] %v rpc is for the expected chain", chain)
+		case mismatch == nil && previous != nil:
+			guard.logger.Infof("[chainid] %v rpc is for the expected chain again", chain)
+		}
+	}
+}
+
+// Run checks the chain ID of every RPC at the given interval until the context
+// is done.
+func (guard *ChainIDGuard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			guard.Check(ctx)
+		}
+	}
+}
+
+// Err returns the mismatch of the RPC of the chain, or ErrChainIDUnchecked if
+// it has not been checked yet. It returns nil if the RPC is for the expected
+// chain, or if the chain is not guarded.
+func (guard *ChainIDGuard) Err(chain multichain.Chain) error {
+	guard.mu.RLock()
+	defer guard.mu.RUnlock()
+	return guard.mismatches[chain]
+}
+
+// Probe returns a health probe which fails while the RPC of the chain is for
+// the wrong chain.
+func (guard *ChainIDGuard) Probe(chain multichain.Chain) health.Probe {
+	return func(context.Context) error {
+		return guard.Err(chain)
+	}
+}
+
+// BlockHeightFetcher wraps the block height fetcher of a watcher, so that the
+// watcher does not look for burns while the RPC of the chain is for the wrong
+// chain.
+func (guard *ChainIDGuard) BlockHeightFetcher(chain multichain.Chain, fetcher watcher.BlockHeightFetcher) watcher.BlockHeightFetcher {
+	return guardedBlockHeightFetcher{guard: guard, chain: chain, fetcher: fetcher}
+}
+
+// Verifier wraps a tx verifier, so that txs are not verified against the RPC
+// of a chain while it is for the wrong chain.
+func (guard *ChainIDGuard) Verifier(verifier resolver.Verifier) resolver.Verifier {
+	return guardedVerifier{guard: guard, verifier: verifier}
+}
+
+// ChainReader wraps the chain reader used by the resolver to convert v0 txs, so
+// that it does not read from the RPC of a chain while it is for the wrong
+// chain.
+func (guard *ChainIDGuard) ChainReader(reader v0.ChainReader) v0.ChainReader {
+	return guardedChainReader{guard: guard, reader: reader}
+}
+
+// Bindings wraps bindings, so that token addresses are not read from the RPC
+// of a chain while it is for the wrong chain.
+func (guard *ChainIDGuard) Bindings(bindings binding.Bindings) binding.Bindings {
+	return guardedBindings{Bindings: bindings, guard: guard}
+}
+
+// PauseSource wraps the source of paused assets, which reads the governance
+// contract on the chain, so that assets are not unpaused by an RPC for the
+// wrong chain.
+func (guard *ChainIDGuard) PauseSource(chain multichain.Chain, source pause.Source) pause.Source {
+	return guardedPauseSource{guard: guard, chain: chain, source: source}
+}
+
+// check returns an error if the RPC of any of the chains should not be used.
+func (guard *ChainIDGuard) check(chains ...multichain.Chain) error {
+	for _, chain := range chains {
+		if err := guard.Err(chain); err != nil {
+			return fmt.Errorf("not using %v rpc: %v", chain, err)
+		}
+	}
+	return nil
+}
+
+type guardedVerifier struct {
+	guard    *ChainIDGuard
+	verifier resolver.Verifier
+}
+
+func (verifier guardedVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	if err := verifier.guard.check(transaction.Selector.Source(), transaction.Selector.Destination()); err != nil {
+		return err
+	}
+	return verifier.verifier.VerifyTx(ctx, transaction)
+}
+
+type guardedChainReader struct {
+	guard  *ChainIDGuard
+	reader v0.ChainReader
+}
+
+func (reader guardedChainReader) UTXOAmount(ctx context.Context, chain multichain.Chain, outpoint multichain.UTXOutpoint) (pack.U256, error) {
+	if err := reader.guard.check(chain); err != nil {
+		return pack.U256{}, err
+	}
+	return reader.reader.UTXOAmount(ctx, chain, outpoint)
+}
+
+func (reader guardedChainReader) EthereumBurn(ctx context.Context, asset multichain.Asset, ref *big.Int) (v0.Burn, error) {
+	if err := reader.guard.check(multichain.Ethereum); err != nil {
+		return v0.Burn{}, err
+	}
+	return reader.reader.EthereumBurn(ctx, asset, ref)
+}
+
+type guardedBindings struct {
+	binding.Bindings
+	guard *ChainIDGuard
+}
+
+func (bindings guardedBindings) TokenAddressFromAsset(chain multichain.Chain, asset multichain.Asset) (address.RawAddress, error) {
+	if err := bindings.guard.check(chain); err != nil {
+		return nil, err
+	}
+	return bindings.Bindings.TokenAddressFromAsset(chain, asset)
+}
+
+type guardedPauseSource struct {
+	guard  *ChainIDGuard
+	chain  multichain.Chain
+	source pause.Source
+}
+
+func (source guardedPauseSource) Paused(ctx context.Context, asset multichain.Asset) (bool, string, error) {
+	if err := source.guard.check(source.chain); err != nil {
+		return false, "", err
+	}
+	return source.source.Paused(ctx, asset)
+}
+
+type guardedBlockHeightFetcher struct {
+	guard   *ChainIDGuard
+	chain   multichain.Chain
+	fetcher watcher.BlockHeightFetcher
+}
+
+func (fetcher guardedBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	if err := fetcher.guard.check(fetcher.chain); err != nil {
+		return 0, err
+	}
+	return fetcher.fetcher.FetchBlockHeight(ctx)
+}
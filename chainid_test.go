@@ -0,0 +1,110 @@
+package lightnode_test
+
+import (
+	"context"
+	"math/big"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode"
+
+	"github.com/renproject/darknode/tx"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+type mockBlockHeightFetcher struct{}
+
+type mockVerifier struct{}
+
+func (mockVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	return nil
+}
+
+type mockChainReader struct{}
+
+func (mockChainReader) UTXOAmount(ctx context.Context, chain multichain.Chain, outpoint multichain.UTXOutpoint) (pack.U256, error) {
+	return pack.U256{}, nil
+}
+
+func (mockChainReader) EthereumBurn(ctx context.Context, asset multichain.Asset, ref *big.Int) (v0.Burn, error) {
+	return v0.Burn{}, nil
+}
+
+func (mockBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	return 100, nil
+}
+
+var _ = Describe("Chain ID guard", func() {
+	It("should stop using rpcs for the wrong chain until they are fixed", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		client := &mockHostChainClient{chainID: big.NewInt(1)}
+		guard := NewChainIDGuard(logrus.New(), EVMChainIDs[multichain.NetworkTestnet], map[multichain.Chain]ChainIDClient{
+			multichain.Ethereum: client,
+		})
+		fetcher := guard.BlockHeightFetcher(multichain.Ethereum, mockBlockHeightFetcher{})
+		probe := guard.Probe(multichain.Ethereum)
+
+		// Rpcs are not used until they have been checked.
+		Expect(guard.Err(multichain.Ethereum)).To(Equal(ErrChainIDUnchecked))
+		_, err := fetcher.FetchBlockHeight(ctx)
+		Expect(err).To(HaveOccurred())
+
+		// The rpc is for mainnet.
+		guard.Check(ctx)
+		Expect(guard.Err(multichain.Ethereum)).To(HaveOccurred())
+		Expect(probe(ctx)).To(HaveOccurred())
+		_, err = fetcher.FetchBlockHeight(ctx)
+		Expect(err).To(HaveOccurred())
+
+		// Unreachable rpcs keep their status.
+		client.chainID = nil
+		guard.Check(ctx)
+		Expect(guard.Err(multichain.Ethereum)).To(HaveOccurred())
+
+		client.chainID = big.NewInt(42)
+		guard.Check(ctx)
+		Expect(guard.Err(multichain.Ethereum)).NotTo(HaveOccurred())
+		Expect(probe(ctx)).To(Succeed())
+		height, err := fetcher.FetchBlockHeight(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(height).To(Equal(uint64(100)))
+	})
+
+	It("should not verify txs against rpcs for the wrong chain", func() {
+		ctx := context.Background()
+		client := &mockHostChainClient{chainID: big.NewInt(1)}
+		guard := NewChainIDGuard(logrus.New(), EVMChainIDs[multichain.NetworkTestnet], map[multichain.Chain]ChainIDClient{
+			multichain.Ethereum: client,
+		})
+		verifier := guard.Verifier(mockVerifier{})
+		reader := guard.ChainReader(mockChainReader{})
+		transaction := tx.Tx{Selector: tx.Selector("BTC/toEthereum")}
+
+		guard.Check(ctx)
+		Expect(verifier.VerifyTx(ctx, transaction)).NotTo(Succeed())
+		_, err := reader.EthereumBurn(ctx, multichain.BTC, big.NewInt(1))
+		Expect(err).To(HaveOccurred())
+
+		// Chains which are not guarded are still used.
+		Expect(verifier.VerifyTx(ctx, tx.Tx{Selector: tx.Selector("BTC/toSolana")})).To(Succeed())
+
+		client.chainID = big.NewInt(42)
+		guard.Check(ctx)
+		Expect(verifier.VerifyTx(ctx, transaction)).To(Succeed())
+		_, err = reader.EthereumBurn(ctx, multichain.BTC, big.NewInt(1))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should ignore chains without an expected chain id", func() {
+		guard := NewChainIDGuard(logrus.New(), EVMChainIDs[multichain.NetworkLocalnet], map[multichain.Chain]ChainIDClient{
+			multichain.Ethereum: mockHostChainClient{chainID: big.NewInt(1)},
+		})
+		guard.Check(context.Background())
+		Expect(guard.Err(multichain.Ethereum)).NotTo(HaveOccurred())
+	})
+})
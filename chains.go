@@ -0,0 +1,52 @@
+package lightnode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/watcher"
+)
+
+// ChainUpdater serves ren_updateChains. It adds EVM host chains, or pauses and
+// resumes the watchers of chains, without restarting the Lightnode.
+type ChainUpdater struct {
+	logger   logging.Logger
+	registry *watcher.Registry
+	add      func(context.Context, HostChain) error
+}
+
+// NewChainUpdater returns a ChainUpdater for the chains in the registry, which
+// adds host chains using the given function.
+func NewChainUpdater(logger logging.Logger, registry *watcher.Registry, add func(context.Context, HostChain) error) ChainUpdater {
+	return ChainUpdater{logger: logger, registry: registry, add: add}
+}
+
+// UpdateChains implements the resolver.ChainUpdater interface. The update is
+// applied in order, stopping at the first error, and changes made before the
+// error are kept.
+func (updater ChainUpdater) UpdateChains(ctx context.Context, params resolver.ParamsUpdateChains) ([]watcher.ChainStatus, error) {
+	for _, data := range params.Add {
+		hostChain := HostChain{}
+		if err := json.Unmarshal(data, &hostChain); err != nil {
+			return nil, fmt.Errorf("invalid host chain: %v", err)
+		}
+		if err := updater.add(ctx, hostChain); err != nil {
+			return nil, fmt.Errorf("cannot add %v: %v", hostChain.Chain, err)
+		}
+		updater.logger.Infof("[lightnode] watching host chain %v", hostChain.Chain)
+	}
+	for _, chain := range params.Pause {
+		if err := updater.registry.Pause(chain); err != nil {
+			return nil, fmt.Errorf("cannot pause %v: %v", chain, err)
+		}
+	}
+	for _, chain := range params.Resume {
+		if err := updater.registry.Resume(chain); err != nil {
+			return nil, fmt.Errorf("cannot resume %v: %v", chain, err)
+		}
+	}
+	return updater.registry.Statuses(), nil
+}
@@ -0,0 +1,205 @@
+// Package clock abstracts the passing of time, so that components which poll,
+// prune or rate limit can be tested by advancing a mock clock rather than by
+// waiting for the wall clock.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time, and creates the timers and tickers which components
+// wait on.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel which receives the time once the duration has
+	// passed, like `time.After`.
+	After(d time.Duration) <-chan time.Time
+
+	// NewTicker returns a Ticker which ticks with the given period, like
+	// `time.NewTicker`.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers the time at intervals until it is stopped.
+type Ticker interface {
+	// C returns the channel on which ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker. No more ticks are delivered once it returns.
+	Stop()
+}
+
+// New returns the wall clock.
+func New() Clock {
+	return wallClock{}
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (wallClock) NewTicker(d time.Duration) Ticker {
+	return wallTicker{ticker: time.NewTicker(d)}
+}
+
+type wallTicker struct {
+	ticker *time.Ticker
+}
+
+func (t wallTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t wallTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// Mock is a Clock which only moves when it is advanced. Ticks are delivered
+// synchronously by Add, so that once Add returns, the goroutines waiting on
+// the ticks have received them, and the work they did for the previous tick
+// has finished.
+type Mock struct {
+	mu      *sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a timer, or a ticker if it has a period.
+type waiter struct {
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+	stop   chan struct{}
+}
+
+// NewMock returns a Mock which starts at the given time.
+func NewMock(now time.Time) *Mock {
+	mu := new(sync.Mutex)
+	return &Mock{mu: mu, cond: sync.NewCond(mu), now: now}
+}
+
+// Now implements the Clock interface.
+func (mock *Mock) Now() time.Time {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	return mock.now
+}
+
+// After implements the Clock interface. The time is delivered even if nobody
+// receives it, as it is for `time.After`.
+func (mock *Mock) After(d time.Duration) <-chan time.Time {
+	w := &waiter{c: make(chan time.Time, 1)}
+	mock.add(w, d)
+	return w.c
+}
+
+// NewTicker implements the Clock interface.
+func (mock *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &waiter{period: d, c: make(chan time.Time), stop: make(chan struct{})}
+	mock.add(w, d)
+	return &mockTicker{mock: mock, waiter: w}
+}
+
+func (mock *Mock) add(w *waiter, d time.Duration) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	w.at = mock.now.Add(d)
+	mock.waiters = append(mock.waiters, w)
+	mock.cond.Broadcast()
+}
+
+// BlockUntil waits until there are at least n timers and tickers waiting on
+// the clock, so that a goroutine which has just been started has created its
+// ticker before the clock is advanced.
+func (mock *Mock) BlockUntil(n int) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	for len(mock.waiters) < n {
+		mock.cond.Wait()
+	}
+}
+
+// Add advances the clock by the duration, and fires the timers and tickers
+// which are due, in the order they are due. Tickers tick at most once per
+// call, like tickers which drop the ticks of slow receivers. Add blocks until
+// every tick has been received, or its ticker has been stopped.
+func (mock *Mock) Add(d time.Duration) {
+	mock.mu.Lock()
+	mock.now = mock.now.Add(d)
+	now := mock.now
+	due := []*waiter{}
+	waiting := mock.waiters[:0]
+	for _, w := range mock.waiters {
+		if w.at.After(now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		due = append(due, w)
+		if w.period > 0 {
+			waiting = append(waiting, w)
+		}
+	}
+	mock.waiters = waiting
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+	for _, w := range due {
+		for w.period > 0 && !w.at.After(now) {
+			w.at = w.at.Add(w.period)
+		}
+	}
+	mock.mu.Unlock()
+
+	for _, w := range due {
+		if w.period == 0 {
+			w.c <- now
+			continue
+		}
+		select {
+		case w.c <- now:
+		case <-w.stop:
+		}
+	}
+}
+
+func (mock *Mock) remove(w *waiter) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	for i := range mock.waiters {
+		if mock.waiters[i] == w {
+			mock.waiters = append(mock.waiters[:i], mock.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type mockTicker struct {
+	mock   *Mock
+	waiter *waiter
+	once   sync.Once
+}
+
+func (t *mockTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *mockTicker) Stop() {
+	t.once.Do(func() {
+		t.mock.remove(t.waiter)
+		close(t.waiter.stop)
+	})
+}
@@ -0,0 +1,78 @@
+package clock_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/clock"
+)
+
+var _ = Describe("Mock clock", func() {
+	start := time.Unix(1600000000, 0)
+
+	It("should only move when it is advanced", func() {
+		clock := NewMock(start)
+		Expect(clock.Now()).To(Equal(start))
+		clock.Add(time.Minute)
+		Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+	})
+
+	It("should fire timers once they are due", func() {
+		clock := NewMock(start)
+		after := clock.After(time.Second)
+		clock.Add(999 * time.Millisecond)
+		Expect(after).NotTo(Receive())
+		clock.Add(time.Millisecond)
+		Expect(after).To(Receive(Equal(start.Add(time.Second))))
+	})
+
+	It("should deliver ticks before Add returns", func() {
+		// The ticks are received before Add returns, but are only passed on
+		// to the test afterwards.
+		clock := NewMock(start)
+		ticks := make(chan time.Time, 10)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ticker := clock.NewTicker(time.Second)
+			defer ticker.Stop()
+			for i := 0; i < 3; i++ {
+				ticks <- <-ticker.C()
+			}
+		}()
+
+		clock.BlockUntil(1)
+		clock.Add(500 * time.Millisecond)
+		Expect(ticks).To(BeEmpty())
+		clock.Add(500 * time.Millisecond)
+		Eventually(ticks).Should(Receive(Equal(start.Add(time.Second))))
+
+		// Ticks which were missed are dropped.
+		clock.Add(5 * time.Second)
+		Eventually(ticks).Should(Receive(Equal(start.Add(6 * time.Second))))
+		clock.Add(time.Second)
+		Eventually(ticks).Should(Receive(Equal(start.Add(7 * time.Second))))
+		<-done
+
+		// Stopped tickers do not block the clock.
+		clock.Add(time.Hour)
+	})
+})
+
+var _ = Describe("Monotonic clock", func() {
+	It("should only be moved forward by times which have passed", func() {
+		clock := NewMonotonic()
+		before := clock.Now()
+		Expect(clock.Skew()).To(BeNumerically("~", 0, time.Second))
+
+		// Times before the clock do not change it.
+		Expect(clock.Observe(before.Add(-time.Hour))).To(BeZero())
+		Expect(clock.Now()).To(BeTemporally("~", before, time.Second))
+
+		correction := clock.Observe(before.Add(time.Hour))
+		Expect(correction).To(BeNumerically("~", time.Hour, time.Second))
+		Expect(clock.Now()).To(BeTemporally(">=", before.Add(time.Hour)))
+		Expect(clock.Skew()).To(BeNumerically("~", -time.Hour, time.Second))
+	})
+})
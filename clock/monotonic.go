@@ -0,0 +1,110 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxSkew is how far the host clock can drift from a Monotonic clock
+// before a warning is logged.
+const DefaultMaxSkew = 30 * time.Second
+
+// Monotonic is a Clock which is read from the wall clock once, and then
+// advanced with the monotonic clock, so that the host clock jumping forwards
+// or backwards does not make txs look older or newer than they are. The times
+// it returns never go backwards. It is the source of the times stored in the
+// database, and of the times they are compared against.
+type Monotonic struct {
+	mu     *sync.Mutex
+	start  time.Time
+	offset time.Duration
+	last   time.Time
+}
+
+// NewMonotonic returns a Monotonic clock which starts at the current time.
+func NewMonotonic() *Monotonic {
+	return &Monotonic{mu: new(sync.Mutex), start: time.Now()}
+}
+
+// Now implements the Clock interface.
+func (clock *Monotonic) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now()
+}
+
+// After implements the Clock interface. Durations are measured with the
+// monotonic clock, so corrections do not affect them.
+func (clock *Monotonic) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewTicker implements the Clock interface.
+func (clock *Monotonic) NewTicker(d time.Duration) Ticker {
+	return wallTicker{ticker: time.NewTicker(d)}
+}
+
+// Unix returns the current time as a unix timestamp in seconds, which is how
+// times are stored in the database.
+func (clock *Monotonic) Unix() int64 {
+	return clock.Now().Unix()
+}
+
+// Skew returns how far the host clock is ahead of the clock, or behind it if
+// the skew is negative.
+func (clock *Monotonic) Skew() time.Duration {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return time.Now().Round(0).Sub(clock.now())
+}
+
+// Observe corrects the clock using a time which is known to have passed, such
+// as a time reported by the Darknodes. If the clock is behind the time, it is
+// moved forward to it, and the correction is returned. Otherwise, the clock is
+// not changed and the correction is zero.
+func (clock *Monotonic) Observe(past time.Time) time.Duration {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	correction := past.Round(0).Sub(clock.now())
+	if correction <= 0 {
+		return 0
+	}
+	clock.offset += correction
+	return correction
+}
+
+// now must be called with the mutex held.
+func (clock *Monotonic) now() time.Time {
+	// Subtracting times with monotonic readings uses the monotonic clock.
+	now := clock.start.Round(0).Add(time.Since(clock.start) + clock.offset)
+	if now.Before(clock.last) {
+		return clock.last
+	}
+	clock.last = now
+	return now
+}
+
+// RunSkewCheck compares the host clock to the Monotonic clock with the given
+// interval, until the context is cancelled, and warns when they have drifted
+// apart by more than the threshold. Timestamps from before the drift, such as
+// those of txs stored by a previous run, may be wrong by the skew.
+func RunSkewCheck(ctx context.Context, clock *Monotonic, logger logrus.FieldLogger, interval, threshold time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		skew := clock.Skew()
+		if skew > threshold || skew < -threshold {
+			logger.Warnf("[clock] host clock has drifted by %v, using monotonic time", skew.Round(time.Second))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
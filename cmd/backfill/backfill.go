@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/renproject/darknode/tx"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+)
+
+// backfill writes the v0 hash mappings for historical txs which were
+// submitted as v0 txs, so that they can be queried by v0 clients. It connects
+// using the same environment variables as the Lightnode and skips txs which
+// are already mapped, so it is safe to run more than once. The mappings are
+// written without an expiry, so that historical txs remain queryable by v0
+// clients once they have been backfilled.
+func main() {
+	pageSize := flag.Int("page-size", 100, "number of txs to read from the database at a time")
+	flag.Parse()
+
+	driver, dbURL := os.Getenv("DATABASE_DRIVER"), os.Getenv("DATABASE_URL")
+	sqlDB, err := sql.Open(driver, dbURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %v db: %v\n", driver, err)
+		os.Exit(1)
+	}
+	defer sqlDB.Close()
+	database := db.New(sqlDB, 0, 1)
+
+	client, err := initRedis()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to redis: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	store := v0.NewCompatStore(database, client, 0)
+
+	start := time.Now()
+	scanned, written, failed := 0, 0, 0
+	for offset := 0; ; offset += *pageSize {
+		txs, err := database.Txs(offset, *pageSize, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read txs at offset %v: %v\n", offset, err)
+			os.Exit(1)
+		}
+		if len(txs) == 0 {
+			break
+		}
+
+		v0txs := make([]tx.Tx, 0, len(txs))
+		for _, transaction := range txs {
+			if transaction.Version != tx.Version0 || !transaction.Selector.IsCrossChain() {
+				continue
+			}
+			v0txs = append(v0txs, transaction)
+		}
+		scanned += len(v0txs)
+
+		// The mappings of each page are written at once.
+		n, errs, err := store.BackfillTxsMappings(v0txs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to backfill txs at offset %v: %v\n", offset, err)
+			os.Exit(1)
+		}
+		for hash, err := range errs {
+			fmt.Fprintf(os.Stderr, "cannot backfill tx %v: %v\n", hash, err)
+		}
+		written += n
+		failed += len(errs)
+	}
+
+	fmt.Printf("backfilled %v of %v v0 txs in %v\n", written, scanned, time.Since(start).Truncate(time.Second))
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "failed to backfill %v txs\n", failed)
+		os.Exit(1)
+	}
+}
+
+func initRedis() (*redis.Client, error) {
+	redisURL, err := url.Parse(os.Getenv("REDIS_URL"))
+	if err != nil {
+		return nil, err
+	}
+	redisPassword, _ := redisURL.User.Password()
+	client := redis.NewClient(&redis.Options{
+		Addr:       redisURL.Host,
+		Password:   redisPassword,
+		DB:         0, // Use default DB.
+		MaxRetries: 5,
+	})
+	return client, client.Ping().Err()
+}
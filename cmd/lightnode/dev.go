@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/jsonrpc/jsonrpcresolver"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/testutils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DevDarknodes is the number of mock darknodes started by the dev runner.
+	DevDarknodes = 3
+
+	// DevDarknodePort is the port of the first mock darknode. Darknodes serve
+	// JSON-RPC on the port after their address, so the mock darknodes use
+	// every other port after this one.
+	DevDarknodePort = 18514
+
+	// DevEnvFile is the env file read by the dev runner, if it exists.
+	DevEnvFile = ".env"
+
+	// DevPollInterval is how often the dev runner checks for changes.
+	DevPollInterval = time.Second
+
+	// DevStopTimeout is how long the Lightnode is given to shut down before it
+	// is killed.
+	DevStopTimeout = 10 * time.Second
+)
+
+// devWhitelist is the whitelist served by the mock darknodes.
+var devWhitelist = []tx.Selector{"BTC/toEthereum", "BCH/toEthereum", "ZEC/toEthereum"}
+
+// runDev builds and runs the Lightnode from the source in the working
+// directory against mock darknodes, with a throwaway SQLite database and the
+// in-process Redis. The Lightnode is rebuilt and restarted whenever a Go
+// source file or the env file changes.
+func runDev() {
+	logger := logrus.New()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "lightnode-dev")
+	if err != nil {
+		logger.Fatalf("[dev] cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	addrs, err := startDevDarknodes(ctx, DevDarknodes, DevDarknodePort)
+	if err != nil {
+		logger.Fatalf("[dev] cannot start mock darknodes: %v", err)
+	}
+	logger.Infof("[dev] started %v mock darknodes from port %v", len(addrs), DevDarknodePort)
+
+	// The database lives for as long as the dev runner, so that it survives
+	// restarts of the Lightnode.
+	overrides := []string{
+		"DATABASE_DRIVER=sqlite3",
+		"DATABASE_URL=" + filepath.Join(dir, "lightnode.db"),
+		"REDIS_URL=",
+		"IN_PROCESS_REDIS=true",
+		"ADDRESSES=" + strings.Join(addrs, ","),
+		"SKIP_DARKNODE_VERSION_CHECK=true",
+	}
+	binary := filepath.Join(dir, "lightnode")
+
+	var child *devChild
+	defer func() { child.stop(logger) }()
+
+	last := ""
+	ticker := time.NewTicker(DevPollInterval)
+	defer ticker.Stop()
+	for {
+		fingerprint, err := devFingerprint(".", DevEnvFile)
+		if err != nil {
+			logger.Errorf("[dev] cannot check for changes: %v", err)
+		} else if fingerprint != last {
+			if last != "" {
+				logger.Info("[dev] change detected, rebuilding")
+			}
+			last = fingerprint
+
+			// Keep the running Lightnode if the new code does not build.
+			if err := buildDev(ctx, binary); err != nil {
+				logger.Errorf("[dev] build failed: %v", err)
+			} else {
+				env, err := devEnv(DevEnvFile, overrides)
+				if err != nil {
+					logger.Errorf("[dev] cannot read %v: %v", DevEnvFile, err)
+				} else {
+					child.stop(logger)
+					if child, err = startDevChild(binary, env); err != nil {
+						logger.Errorf("[dev] cannot start lightnode: %v", err)
+					} else {
+						logger.Infof("[dev] started lightnode with pid %v", child.cmd.Process.Pid)
+					}
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// buildDev builds the Lightnode from the source in the working directory.
+func buildDev(ctx context.Context, binary string) error {
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", binary, "./cmd/lightnode")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// devChild is a Lightnode started by the dev runner.
+type devChild struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+// startDevChild starts the Lightnode with the given environment.
+func startDevChild(binary string, env []string) (*devChild, error) {
+	cmd := exec.Command(binary)
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	child := &devChild{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(child.exited)
+	}()
+	return child, nil
+}
+
+// stop asks the Lightnode to shut down, and kills it if it has not stopped
+// after the DevStopTimeout.
+func (child *devChild) stop(logger logrus.FieldLogger) {
+	if child == nil {
+		return
+	}
+	if err := child.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		// The Lightnode has already exited.
+		return
+	}
+	select {
+	case <-child.exited:
+	case <-time.After(DevStopTimeout):
+		logger.Warnf("[dev] lightnode did not stop after %v, killing it", DevStopTimeout)
+		child.cmd.Process.Kill()
+		<-child.exited
+	}
+}
+
+// devEnv returns the environment of the Lightnode: the environment of the dev
+// runner, then the variables in the env file, then the overrides. Later
+// values of a variable take precedence.
+func devEnv(envFile string, overrides []string) ([]string, error) {
+	env := os.Environ()
+	vars, err := readEnvFile(envFile)
+	if err != nil {
+		return nil, err
+	}
+	env = append(env, vars...)
+	return append(env, overrides...), nil
+}
+
+// readEnvFile reads KEY=VALUE lines from the env file, skipping blank lines
+// and comments. A missing file has no variables.
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vars := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		vars = append(vars, strings.TrimSpace(parts[0])+"="+strings.Trim(strings.TrimSpace(parts[1]), `"'`))
+	}
+	return vars, scanner.Err()
+}
+
+// devFingerprint summarises the Go source files under the root, and the env
+// file, so that any change to them changes the fingerprint. Hidden
+// directories and tests are skipped.
+func devFingerprint(root, envFile string) (string, error) {
+	var builder strings.Builder
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := info.Name()
+		if name != "go.mod" && name != "go.sum" &&
+			(!strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go")) {
+			return nil
+		}
+		fmt.Fprintf(&builder, "%v:%v:%v;", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(envFile); err == nil {
+		fmt.Fprintf(&builder, "%v:%v:%v;", envFile, info.Size(), info.ModTime().UnixNano())
+	}
+	return builder.String(), nil
+}
+
+// devDarknode serves the config, peers and block state that the Lightnode
+// needs to start, and responds successfully to every other request.
+type devDarknode struct {
+	jsonrpc.Resolver
+	peers []string
+}
+
+func (darknode devDarknode) QueryPeers(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryPeers, req *http.Request) jsonrpc.Response {
+	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryPeers{Peers: darknode.peers}, nil)
+}
+
+func (darknode devDarknode) QueryConfig(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryConfig, req *http.Request) jsonrpc.Response {
+	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryConfig{Whitelist: devWhitelist}, nil)
+}
+
+func (darknode devDarknode) QueryBlockState(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlockState, req *http.Request) jsonrpc.Response {
+	return jsonrpc.NewResponse(id, testutils.MockQueryBlockStateResponse(), nil)
+}
+
+// startDevDarknodes starts the mock darknodes, which run until the context is
+// cancelled, and returns their signed addresses.
+func startDevDarknodes(ctx context.Context, n, port int) ([]string, error) {
+	addrs := make([]string, n)
+	for i := range addrs {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		addr := wire.NewUnsignedAddress(wire.TCP, fmt.Sprintf("127.0.0.1:%v", port+2*i), uint64(time.Now().Unix()))
+		if err := addr.Sign((*id.PrivKey)(key)); err != nil {
+			return nil, err
+		}
+		addrs[i] = addr.String()
+	}
+	for i := range addrs {
+		darknode := devDarknode{Resolver: jsonrpcresolver.OkResponder(), peers: addrs}
+		server := jsonrpc.NewServer(jsonrpc.DefaultOptions(), darknode, jsonrpc.NewValidator())
+		go server.Listen(ctx, fmt.Sprintf("127.0.0.1:%v", port+2*i+1))
+	}
+	return addrs, nil
+}
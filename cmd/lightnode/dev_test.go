@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/lightnode/http"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Dev runner", func() {
+	It("should serve the config from the mock darknodes", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addrStrs, err := startDevDarknodes(ctx, 2, 28514)
+		Expect(err).NotTo(HaveOccurred())
+		addrs := make([]wire.Address, len(addrStrs))
+		for i, addrStr := range addrStrs {
+			addrs[i], err = wire.DecodeString(addrStr)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		conf, err := getConfigFromBootstrap(ctx, http.NewClient(time.Minute), logrus.New(), addrs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conf.Whitelist).To(Equal(devWhitelist))
+	})
+
+	It("should notice changes to the source and env file", func() {
+		dir, err := ioutil.TempDir("", "lightnode-dev-test")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		envFile := filepath.Join(dir, ".env")
+
+		before, err := devFingerprint(dir, envFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Tests do not change the Lightnode.
+		Expect(ioutil.WriteFile(filepath.Join(dir, "main_test.go"), []byte("package main"), 0644)).To(Succeed())
+		after, err := devFingerprint(dir, envFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).To(Equal(before))
+
+		Expect(ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644)).To(Succeed())
+		after, err = devFingerprint(dir, envFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).NotTo(Equal(before))
+
+		before = after
+		Expect(ioutil.WriteFile(envFile, []byte("# comment\nexport NETWORK=\"localnet\"\n\nLOG_LEVEL=debug\n"), 0644)).To(Succeed())
+		after, err = devFingerprint(dir, envFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).NotTo(Equal(before))
+
+		vars, err := readEnvFile(envFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vars).To(Equal([]string{"NETWORK=localnet", "LOG_LEVEL=debug"}))
+	})
+})
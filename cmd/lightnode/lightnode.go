@@ -5,12 +5,15 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -26,7 +29,15 @@ import (
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
 	"github.com/renproject/lightnode"
+	"github.com/renproject/lightnode/config"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/finality"
+	"github.com/renproject/lightnode/hooks"
 	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/memredis"
+	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/upgrade"
+	"github.com/renproject/lightnode/watcher"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
 	"github.com/renproject/surge"
@@ -38,9 +49,26 @@ func main() {
 	// Seed random number generator.
 	rand.Seed(time.Now().UnixNano())
 
+	// In development, run the Lightnode against mock darknodes and restart it
+	// whenever the code changes.
+	dev := flag.Bool("dev", false, "Run against mock darknodes and restart on code or config changes")
+	flag.Parse()
+	if *dev {
+		runDev()
+		return
+	}
+
 	// Parse Lightnode options from environment variables.
 	options := parseOptions()
 
+	// The config is fetched from the bootstrap nodes through the outbound
+	// proxies.
+	proxies, err := http.NewProxies(options.ProxyOverrides)
+	if err != nil {
+		panic(fmt.Sprintf("invalid proxy overrides: %v", err))
+	}
+	darknodeClient := http.NewClient(time.Minute).WithTransport(proxies.Transport())
+
 	// Initialise logger and attach Sentry hook.
 	logger := initLogger(os.Getenv("HEROKU_APP_NAME"), options.Network)
 
@@ -52,16 +80,57 @@ func main() {
 	}
 	defer sqlDB.Close()
 
-	// Initialise Redis client.
-	client := initRedis()
-	defer client.Close()
+	// Stop the Lightnode on SIGINT or SIGTERM. Cancelling the context stops
+	// the background tasks and any chain calls they are waiting on.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-	ctx := context.Background()
+	// Initialise Redis client. An in-process server which saves its contents
+	// to the database can be used instead, but only if it is asked for, as its
+	// contents are not shared with other replicas.
+	var client *redis.Client
+	switch {
+	case os.Getenv("REDIS_URL") != "":
+		client = initRedis()
+		defer client.Close()
+	case !parseBool("IN_PROCESS_REDIS"):
+		logger.Fatalf("no redis url given, set REDIS_URL or IN_PROCESS_REDIS")
+	default:
+		server, err := memredis.Start(logger, sqlDB)
+		if err != nil {
+			logger.Fatalf("failed to start in-process redis: %v", err)
+		}
+		defer server.Close()
+		logger.Warn("using in-process redis")
 
-	// Fetch and apply the first successfully exposed config from bootstrap nodes
-	conf, err := getConfigFromBootstrap(ctx, logger, options.BootstrapAddrs)
-	if err != nil {
-		logger.Fatalf("failed to fetch config from any bootstrap node")
+		saved := make(chan struct{})
+		go func() {
+			server.Run(ctx, memredis.DefaultSaveInterval)
+			close(saved)
+		}()
+		defer func() {
+			cancel()
+			<-saved
+		}()
+		client = server.Client()
+	}
+
+	// Fetch and apply the first successfully exposed config from bootstrap
+	// nodes. Compat-only Lightnodes fetch it from their upstream Lightnode,
+	// which serves the same config and block state as the Darknodes.
+	var conf jsonrpc.ResponseQueryConfig
+	stateURL := options.UpstreamURL
+	if options.CompatOnly() {
+		conf, err = fetchConfig(ctx, darknodeClient, options.UpstreamURL, logger)
+		if err != nil {
+			logger.Fatalf("failed to fetch config from upstream lightnode")
+		}
+	} else {
+		conf, err = getConfigFromBootstrap(ctx, darknodeClient, logger, options.BootstrapAddrs)
+		if err != nil {
+			logger.Fatalf("failed to fetch config from any bootstrap node")
+		}
+		stateURL = addrToUrl(options.BootstrapAddrs[0], logger)
 	}
 
 	options.Whitelist = conf.Whitelist
@@ -74,7 +143,11 @@ func main() {
 	}
 
 	for chain, chainOpt := range options.Chains {
-		chainOpt.Confirmations = conf.Confirmations[chain]
+		// Host chains which are not yet known to RenVM keep their configured
+		// confirmations.
+		if confirmations, ok := conf.Confirmations[chain]; ok || chainOpt.Confirmations == 0 {
+			chainOpt.Confirmations = confirmations
+		}
 		if conf.MaxConfirmations[chain] != 0 {
 			chainOpt.MaxConfirmations = conf.MaxConfirmations[chain]
 		} else {
@@ -84,7 +157,7 @@ func main() {
 	}
 
 	// Fetch block state from first bootstrap node and use the public key
-	state, err := fetchBlockState(context.Background(), addrToUrl(options.BootstrapAddrs[0], logger), logger, time.Minute)
+	state, err := fetchBlockState(context.Background(), darknodeClient, stateURL, logger)
 	if err != nil {
 		logger.Fatalf("failed to fetch block state from bootstrap node")
 	}
@@ -94,14 +167,28 @@ func main() {
 	}
 	options = options.WithDistPubKey(&pub)
 
+	// Refuse to start if the darknodes run a version whose wire format this
+	// lightnode may not understand. Darknodes which do not report their
+	// version are assumed to be compatible.
+	if !options.CompatOnly() && !parseBool("SKIP_DARKNODE_VERSION_CHECK") {
+		darknodeVersion, err := fetchDarknodeVersion(ctx, darknodeClient, addrToUrl(options.BootstrapAddrs[0], logger), logger)
+		if err != nil {
+			logger.Warnf("[config] cannot check darknode version: %v", err)
+		} else if err := upgrade.CheckDarknodeVersion(darknodeVersion, resolver.NewWireVersions().Darknode); err != nil {
+			logger.Fatalf("incompatible darknodes: %v (set SKIP_DARKNODE_VERSION_CHECK to start anyway)", err)
+		}
+	}
+
 	// Run Lightnode.
 	node := lightnode.New(options, ctx, logger, sqlDB, client)
-	node.Run(ctx)
+	if err := node.Run(ctx); err != nil {
+		logger.Fatalf("cannot run lightnode: %v", err)
+	}
 }
 
-func getConfigFromBootstrap(ctx context.Context, logger logrus.FieldLogger, addrs []wire.Address) (jsonrpc.ResponseQueryConfig, error) {
+func getConfigFromBootstrap(ctx context.Context, client http.Client, logger logrus.FieldLogger, addrs []wire.Address) (jsonrpc.ResponseQueryConfig, error) {
 	for i, addr := range addrs {
-		conf, err := fetchConfig(ctx, addrToUrl(addr, logger), logger, time.Minute)
+		conf, err := fetchConfig(ctx, client, addrToUrl(addr, logger), logger)
 		if i == len(addrs)-1 && err != nil {
 			return conf, err
 		}
@@ -127,15 +214,13 @@ func addrToUrl(addr wire.Address, logger logrus.FieldLogger) string {
 	return fmt.Sprintf("http://%s:%v", addrParts[0], port+1)
 }
 
-func fetchConfig(ctx context.Context, url string, logger logrus.FieldLogger, timeout time.Duration) (jsonrpc.ResponseQueryConfig, error) {
+func fetchConfig(ctx context.Context, client http.Client, url string, logger logrus.FieldLogger) (jsonrpc.ResponseQueryConfig, error) {
 	var resp jsonrpc.ResponseQueryConfig
 	params, err := json.Marshal(jsonrpc.ParamsQueryConfig{})
 	if err != nil {
 		logger.Errorf("[config] cannot marshal query config params: %v", err)
 		return resp, err
 	}
-	client := http.NewClient(timeout)
-
 	request := jsonrpc.Request{
 		Version: "2.0",
 		ID:      rand.Int31(),
@@ -163,15 +248,13 @@ func fetchConfig(ctx context.Context, url string, logger logrus.FieldLogger, tim
 	return resp, nil
 }
 
-func fetchBlockState(ctx context.Context, url string, logger logrus.FieldLogger, timeout time.Duration) (jsonrpc.ResponseQueryBlockState, error) {
+func fetchBlockState(ctx context.Context, client http.Client, url string, logger logrus.FieldLogger) (jsonrpc.ResponseQueryBlockState, error) {
 	var resp jsonrpc.ResponseQueryBlockState
 	params, err := json.Marshal(jsonrpc.ParamsQueryBlockState{})
 	if err != nil {
 		logger.Errorf("[config] cannot marshal query block state params: %v", err)
 		return resp, err
 	}
-	client := http.NewClient(timeout)
-
 	request := jsonrpc.Request{
 		Version: "2.0",
 		ID:      rand.Int31(),
@@ -199,6 +282,42 @@ func fetchBlockState(ctx context.Context, url string, logger logrus.FieldLogger,
 	return resp, nil
 }
 
+// fetchDarknodeVersion returns the version reported by the darknode in its
+// queryStat response.
+func fetchDarknodeVersion(ctx context.Context, client http.Client, url string, logger logrus.FieldLogger) (string, error) {
+	params, err := json.Marshal(jsonrpc.ParamsQueryStat{})
+	if err != nil {
+		return "", err
+	}
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  jsonrpc.MethodQueryStat,
+		Params:  params,
+	}
+
+	response, err := client.SendRequest(ctx, url, request, nil)
+	if err != nil {
+		return "", err
+	}
+	if response.Error != nil {
+		return "", fmt.Errorf("queryStat: %v", response.Error.Message)
+	}
+
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return "", err
+	}
+	var stat struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &stat); err != nil {
+		logger.Warnf("[config] cannot unmarshal queryStat result from %v: %v", url, err)
+		return "", err
+	}
+	return stat.Version, nil
+}
+
 func parsePubkey(response jsonrpc.ResponseQueryBlockState) (id.PubKey, error) {
 	systemContract := response.State.Get("System")
 	if systemContract == nil {
@@ -267,6 +386,18 @@ func parseOptions() lightnode.Options {
 	if os.Getenv("PORT") != "" {
 		options = options.WithPort(os.Getenv("PORT"))
 	}
+	if os.Getenv("GRPC_PORT") != "" {
+		options = options.WithGRPCPort(os.Getenv("GRPC_PORT"))
+	}
+	if os.Getenv("LISTENERS") != "" {
+		options = options.WithListeners(parseListeners("LISTENERS"))
+	}
+	if os.Getenv("ADMIN_TOKEN") != "" || os.Getenv("ADMIN_CLIENT_CA_FILE") != "" {
+		options = options.WithAdminAuth(os.Getenv("ADMIN_TOKEN"), os.Getenv("ADMIN_CLIENT_CA_FILE"))
+	}
+	if os.Getenv("TLS_CERT_FILE") != "" {
+		options = options.WithTLSCertificate(os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"))
+	}
 	if os.Getenv("CAP") != "" {
 		options = options.WithCap(parseInt("CAP"))
 	}
@@ -274,26 +405,177 @@ func parseOptions() lightnode.Options {
 		options = options.WithMaxBatchSize(parseInt("MAX_BATCH_SIZE"))
 	}
 	if os.Getenv("MAX_PAGE_SIZE") != "" {
-		options = options.WithMaxBatchSize(parseInt("MAX_PAGE_SIZE"))
+		options = options.WithMaxPageSize(parseInt("MAX_PAGE_SIZE"))
+	}
+	if os.Getenv("STREAM_THRESHOLD") != "" {
+		options = options.WithStreamThreshold(parseInt("STREAM_THRESHOLD"))
 	}
 	if os.Getenv("MAX_GATEWAY_COUNT") != "" {
 		options = options.WithMaxGatewayCount(parseInt("MAX_GATEWAY_COUNT"))
 	}
+	if os.Getenv("DB_BATCH_SIZE") != "" {
+		options = options.WithDBBatchSize(parseInt("DB_BATCH_SIZE"))
+	}
+	if os.Getenv("WRITE_QUEUE_SIZE") != "" {
+		options = options.WithWriteBehind(parseInt("WRITE_QUEUE_SIZE"), os.Getenv("WRITE_JOURNAL"))
+	}
+	if os.Getenv("TXCHECKER_CONCURRENCY") != "" || os.Getenv("DISPATCH_CONCURRENCY") != "" {
+		txChecker, dispatch := lightnode.DefaultTxCheckerConcurrency, lightnode.DefaultDispatchConcurrency
+		if os.Getenv("TXCHECKER_CONCURRENCY") != "" {
+			txChecker = parseInt("TXCHECKER_CONCURRENCY")
+		}
+		if os.Getenv("DISPATCH_CONCURRENCY") != "" {
+			dispatch = parseInt("DISPATCH_CONCURRENCY")
+		}
+		options = options.WithConcurrency(txChecker, dispatch)
+	}
+	if os.Getenv("STRICT_DISPATCH") != "" {
+		options = options.WithStrictDispatch(parseBool("STRICT_DISPATCH"))
+	}
+	if os.Getenv("DISPATCH_RETRIES") != "" {
+		backoff := lightnode.DefaultDispatchBackoff
+		if os.Getenv("DISPATCH_BACKOFF_BASE") != "" {
+			backoff.Base = parseTime("DISPATCH_BACKOFF_BASE")
+		}
+		if os.Getenv("DISPATCH_BACKOFF_MAX") != "" {
+			backoff.Max = parseTime("DISPATCH_BACKOFF_MAX")
+		}
+		options = options.WithDispatchRetries(parseInt("DISPATCH_RETRIES"), backoff)
+	}
+	if os.Getenv("BREAKER_THRESHOLD") != "" {
+		cooldown := lightnode.DefaultBreakerCooldown
+		if os.Getenv("BREAKER_COOLDOWN") != "" {
+			cooldown = parseTime("BREAKER_COOLDOWN")
+		}
+		options = options.WithCircuitBreakers(parseInt("BREAKER_THRESHOLD"), cooldown)
+	}
+	if os.Getenv("MAX_IN_FLIGHT_PER_DARKNODE") != "" || os.Getenv("REQUESTS_PER_DARKNODE_RATE") != "" {
+		maxInFlight, perMinute := lightnode.DefaultMaxInFlightPerDarknode, lightnode.DefaultRequestsPerDarknodeRate
+		if os.Getenv("MAX_IN_FLIGHT_PER_DARKNODE") != "" {
+			maxInFlight = parseInt("MAX_IN_FLIGHT_PER_DARKNODE")
+		}
+		if os.Getenv("REQUESTS_PER_DARKNODE_RATE") != "" {
+			perMinute = parseInt("REQUESTS_PER_DARKNODE_RATE")
+		}
+		options = options.WithDarknodeBudgets(maxInFlight, perMinute)
+	}
+	if os.Getenv("VERIFICATION_TIMEOUT") != "" || os.Getenv("VERIFICATION_CONCURRENCY") != "" {
+		timeout, concurrency := lightnode.DefaultVerificationTimeout, lightnode.DefaultVerificationConcurrency
+		if os.Getenv("VERIFICATION_TIMEOUT") != "" {
+			timeout = parseTime("VERIFICATION_TIMEOUT")
+		}
+		if os.Getenv("VERIFICATION_CONCURRENCY") != "" {
+			concurrency = parseInt("VERIFICATION_CONCURRENCY")
+		}
+		options = options.WithVerificationBudget(timeout, concurrency)
+	}
+	if os.Getenv("VERIFICATION_CACHE_SIZE") != "" {
+		ttl, rejectionTTL := lightnode.DefaultVerificationCacheTTL, lightnode.DefaultVerificationRejectionTTL
+		if os.Getenv("VERIFICATION_CACHE_TTL") != "" {
+			ttl = parseTime("VERIFICATION_CACHE_TTL")
+		}
+		if os.Getenv("VERIFICATION_REJECTION_TTL") != "" {
+			rejectionTTL = parseTime("VERIFICATION_REJECTION_TTL")
+		}
+		options = options.WithVerificationCache(parseInt("VERIFICATION_CACHE_SIZE"), ttl, rejectionTTL)
+	}
+	if os.Getenv("MAX_PENDING_TXS") != "" {
+		interval := lightnode.DefaultPendingCountInterval
+		if os.Getenv("PENDING_COUNT_INTERVAL") != "" {
+			interval = parseTime("PENDING_COUNT_INTERVAL")
+		}
+		options = options.WithMaxPendingTxs(parseInt("MAX_PENDING_TXS"), interval)
+	}
+	if os.Getenv("PROXY_OVERRIDES") != "" {
+		options = options.WithProxyOverrides(parseProxyOverrides("PROXY_OVERRIDES"))
+	}
+	if os.Getenv("HOOKS") != "" {
+		chainDownAfter := lightnode.DefaultHookChainDownAfter
+		if os.Getenv("HOOK_CHAIN_DOWN_AFTER") != "" {
+			chainDownAfter = parseTime("HOOK_CHAIN_DOWN_AFTER")
+		}
+		options = options.WithHooks(parseHooks("HOOKS"), chainDownAfter)
+	}
+	if os.Getenv("SLOW_DB_THRESHOLD") != "" || os.Getenv("SLOW_DARKNODE_THRESHOLD") != "" {
+		var dbThreshold, darknodeThreshold time.Duration
+		if os.Getenv("SLOW_DB_THRESHOLD") != "" {
+			dbThreshold = parseTime("SLOW_DB_THRESHOLD")
+		}
+		if os.Getenv("SLOW_DARKNODE_THRESHOLD") != "" {
+			darknodeThreshold = parseTime("SLOW_DARKNODE_THRESHOLD")
+		}
+		sampling := 1
+		if os.Getenv("SLOW_LOG_SAMPLING") != "" {
+			sampling = parseInt("SLOW_LOG_SAMPLING")
+		}
+		options = options.WithSlowLog(dbThreshold, darknodeThreshold, sampling)
+	}
+	if os.Getenv("RECOVERY_DOWNTIME") != "" {
+		minAge, batchSize, batchInterval := lightnode.DefaultRecoveryMinAge, lightnode.DefaultRecoveryBatchSize, lightnode.DefaultRecoveryBatchInterval
+		if os.Getenv("RECOVERY_MIN_AGE") != "" {
+			minAge = parseTime("RECOVERY_MIN_AGE")
+		}
+		if os.Getenv("RECOVERY_BATCH_SIZE") != "" {
+			batchSize = parseInt("RECOVERY_BATCH_SIZE")
+		}
+		if os.Getenv("RECOVERY_BATCH_INTERVAL") != "" {
+			batchInterval = parseTime("RECOVERY_BATCH_INTERVAL")
+		}
+		options = options.WithRecovery(parseTime("RECOVERY_DOWNTIME"), minAge, batchSize, batchInterval)
+	}
+	if os.Getenv("HEALTH_TIMEOUT") != "" {
+		options = options.WithHealthTimeout(parseTime("HEALTH_TIMEOUT"))
+	}
 	if os.Getenv("SERVER_TIMEOUT") != "" {
 		options = options.WithServerTimeout(parseTime("SERVER_TIMEOUT"))
 	}
+	serverOptions := options.HTTPServer
+	if os.Getenv("HTTP2") != "" {
+		serverOptions.HTTP2 = parseBool("HTTP2")
+	}
+	if os.Getenv("HTTP2_MAX_CONCURRENT_STREAMS") != "" {
+		serverOptions.MaxConcurrentStreams = uint32(parseInt("HTTP2_MAX_CONCURRENT_STREAMS"))
+	}
+	if os.Getenv("HTTP_READ_HEADER_TIMEOUT") != "" {
+		serverOptions.ReadHeaderTimeout = parseTime("HTTP_READ_HEADER_TIMEOUT")
+	}
+	if os.Getenv("HTTP_READ_TIMEOUT") != "" {
+		serverOptions.ReadTimeout = parseTime("HTTP_READ_TIMEOUT")
+	}
+	if os.Getenv("HTTP_WRITE_TIMEOUT") != "" {
+		serverOptions.WriteTimeout = parseTime("HTTP_WRITE_TIMEOUT")
+	}
+	if os.Getenv("HTTP_IDLE_TIMEOUT") != "" {
+		serverOptions.IdleTimeout = parseTime("HTTP_IDLE_TIMEOUT")
+	}
+	if os.Getenv("HTTP_SHUTDOWN_TIMEOUT") != "" {
+		serverOptions.ShutdownTimeout = parseTime("HTTP_SHUTDOWN_TIMEOUT")
+	}
+	options = options.WithHTTPServer(serverOptions)
 	if os.Getenv("CLIENT_TIMEOUT") != "" {
 		options = options.WithClientTimeout(parseTime("CLIENT_TIMEOUT"))
 	}
 	if os.Getenv("TTL") != "" {
 		options = options.WithTTL(parseTime("TTL"))
 	}
+	if os.Getenv("CACHE_REVALIDATE_AFTER") != "" {
+		options = options.WithCacheRevalidateAfter(parseTime("CACHE_REVALIDATE_AFTER"))
+	}
+	if os.Getenv("CACHE_TTLS") != "" {
+		options = options.WithCacheTTLs(parseCacheTTLs("CACHE_TTLS"))
+	}
+	if os.Getenv("SHARED_CACHE") != "" {
+		options = options.WithSharedCache(parseBool("SHARED_CACHE"))
+	}
 	if os.Getenv("UPDATER_POLL_RATE") != "" {
 		options = options.WithUpdaterPollRate(parseTime("UPDATER_POLL_RATE"))
 	}
 	if os.Getenv("CONFIRMER_POLL_RATE") != "" {
 		options = options.WithConfirmerPollRate(parseTime("CONFIRMER_POLL_RATE"))
 	}
+	if os.Getenv("CONFIRMER_PENDING_WINDOW") != "" {
+		options = options.WithConfirmerPendingWindow(parseTime("CONFIRMER_PENDING_WINDOW"))
+	}
 	if os.Getenv("WATCHER_POLL_RATE") != "" {
 		options = options.WithWatcherPollRate(parseTime("WATCHER_POLL_RATE"))
 	}
@@ -301,11 +583,89 @@ func parseOptions() lightnode.Options {
 		options = options.WithWatcherMaxBlockAdvance(uint64(parseInt("WATCHER_MAX_BLOCK_ADVANCE")))
 	}
 	if os.Getenv("WATCHER_CONFIDENCE_INTERVAL") != "" {
-		options = options.WithWatcherMaxBlockAdvance(uint64(parseInt("WATCHER_CONFIDENCE_INTERVAL")))
+		options = options.WithWatcherConfidenceInterval(uint64(parseInt("WATCHER_CONFIDENCE_INTERVAL")))
 	}
 	if os.Getenv("EXPIRY") != "" {
 		options = options.WithTransactionExpiry(parseTime("EXPIRY"))
 	}
+	if os.Getenv("ARCHIVE_RETENTION") != "" {
+		options = options.WithArchiveRetention(parseTime("ARCHIVE_RETENTION"))
+	}
+	if os.Getenv("GATEWAY_GRACE_PERIOD") != "" {
+		options = options.WithGatewayGracePeriod(parseTime("GATEWAY_GRACE_PERIOD"))
+	}
+	options = options.WithPrunePolicy(db.PrunePolicy{
+		Done:        parseTime("PRUNE_DONE_EXPIRY"),
+		Unconfirmed: parseTime("PRUNE_UNCONFIRMED_EXPIRY"),
+		Gateways:    parseTime("PRUNE_GATEWAY_EXPIRY"),
+		BurnEvents:  parseTime("PRUNE_BURN_EVENT_EXPIRY"),
+		Clients:     parseTime("PRUNE_CLIENT_EXPIRY"),
+	})
+	if os.Getenv("PRUNE_DRY_RUN") != "" {
+		options = options.WithPruneDryRun(parseBool("PRUNE_DRY_RUN"))
+	}
+	if os.Getenv("TOKEN_CACHE_TTL") != "" {
+		options = options.WithTokenCacheTTL(parseTime("TOKEN_CACHE_TTL"))
+	}
+	if os.Getenv("BLOCK_CACHE_SIZE") != "" {
+		options = options.WithBlockCacheSize(parseInt("BLOCK_CACHE_SIZE"))
+	}
+	if os.Getenv("MAX_BURN_AGE") != "" {
+		options = options.WithMaxBurnAge(parseTime("MAX_BURN_AGE"))
+	}
+	if os.Getenv("MAX_BURN_BLOCKS") != "" {
+		options = options.WithMaxBurnBlocks(parseBlockCounts("MAX_BURN_BLOCKS"))
+	}
+	if os.Getenv("BURN_RECOVERY_URL") != "" {
+		options = options.WithBurnRecoveryURL(os.Getenv("BURN_RECOVERY_URL"))
+	}
+	if os.Getenv("PAUSE_CONTRACT") != "" {
+		chain := multichain.Ethereum
+		if os.Getenv("PAUSE_CHAIN") != "" {
+			chain = multichain.Chain(os.Getenv("PAUSE_CHAIN"))
+		}
+		options = options.WithPauseContract(chain, os.Getenv("PAUSE_CONTRACT"))
+	}
+	if os.Getenv("PAUSE_POLL_RATE") != "" {
+		options = options.WithPausePollRate(parseTime("PAUSE_POLL_RATE"))
+	}
+	if os.Getenv("SUBSCRIPTION_POLL_RATE") != "" {
+		options = options.WithSubscriptionPollRate(parseTime("SUBSCRIPTION_POLL_RATE"))
+	}
+	if os.Getenv("SUBSCRIPTION_ORIGINS") != "" {
+		options = options.WithSubscriptionOrigins(parseList("SUBSCRIPTION_ORIGINS"))
+	}
+	if os.Getenv("SUBSCRIPTION_MAX_CONNS") != "" || os.Getenv("SUBSCRIPTION_MAX_CONNS_PER_IP") != "" {
+		maxConns, maxConnsPerIP := options.SubscriptionMaxConns, options.SubscriptionMaxConnsPerIP
+		if os.Getenv("SUBSCRIPTION_MAX_CONNS") != "" {
+			maxConns = parseInt("SUBSCRIPTION_MAX_CONNS")
+		}
+		if os.Getenv("SUBSCRIPTION_MAX_CONNS_PER_IP") != "" {
+			maxConnsPerIP = parseInt("SUBSCRIPTION_MAX_CONNS_PER_IP")
+		}
+		options = options.WithSubscriptionConnLimits(maxConns, maxConnsPerIP)
+	}
+	if os.Getenv("EPOCH_POLL_RATE") != "" {
+		options = options.WithEpochPollRate(parseTime("EPOCH_POLL_RATE"))
+	}
+	if os.Getenv("CHAIN_ID_CHECK_INTERVAL") != "" {
+		options = options.WithChainIDCheckInterval(parseTime("CHAIN_ID_CHECK_INTERVAL"))
+	}
+	if os.Getenv("MAX_CLOCK_SKEW") != "" {
+		options = options.WithMaxClockSkew(parseTime("MAX_CLOCK_SKEW"))
+	}
+	if os.Getenv("WARMUP_TIMEOUT") != "" {
+		options = options.WithWarmupTimeout(parseTime("WARMUP_TIMEOUT"))
+	}
+	if os.Getenv("COMPAT_GC_GRACE_PERIOD") != "" {
+		options = options.WithCompatGCGracePeriod(parseTime("COMPAT_GC_GRACE_PERIOD"))
+	}
+	if os.Getenv("COMPAT_BACKEND") != "" {
+		options = options.WithCompatBackend(os.Getenv("COMPAT_BACKEND"))
+	}
+	if os.Getenv("UPSTREAM_URL") != "" {
+		options = options.WithUpstream(os.Getenv("UPSTREAM_URL"))
+	}
 	if os.Getenv("ADDRESSES") != "" {
 		options = options.WithBootstrapAddrs(parseAddresses("ADDRESSES"))
 	}
@@ -319,6 +679,37 @@ func parseOptions() lightnode.Options {
 	if os.Getenv("LIMITER_GLOBAL_RATE") != "" {
 		options = options.WithLimiterGlobalRates(parseRates("LIMITER_GLOBAL_RATE"))
 	}
+	if os.Getenv("LIMITER_ALLOWLIST") != "" || os.Getenv("LIMITER_DENYLIST") != "" {
+		options = options.WithLimiterIPLists(parseIPList("LIMITER_ALLOWLIST"), parseIPList("LIMITER_DENYLIST"))
+	}
+	if os.Getenv("TRUSTED_PROXIES") != "" {
+		options = options.WithTrustedProxies(parseIPList("TRUSTED_PROXIES"))
+	}
+	if os.Getenv("SIGNING_KEY") != "" {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(os.Getenv("SIGNING_KEY"), "0x"))
+		if err != nil {
+			// Do not print the key, as it is a secret.
+			panic("invalid SIGNING_KEY")
+		}
+		options = options.WithSigningKey((*id.PrivKey)(key))
+	}
+	if os.Getenv("SHARED_RATE_LIMITS") != "" {
+		factor := lightnode.DefaultLimiterDegradedFactor
+		if os.Getenv("LIMITER_DEGRADED_FACTOR") != "" {
+			factor = parseFloat("LIMITER_DEGRADED_FACTOR")
+		}
+		options = options.WithSharedRateLimits(parseBool("SHARED_RATE_LIMITS"), factor)
+	}
+	if os.Getenv("ADMISSION_CAPACITY") != "" {
+		shares := options.AdmissionShares
+		if os.Getenv("ADMISSION_SHARES") != "" {
+			shares = parseShares("ADMISSION_SHARES")
+		}
+		options = options.WithAdmission(parseInt("ADMISSION_CAPACITY"), shares)
+	}
+	if os.Getenv("API_KEYS") != "" {
+		options = options.WithAPIKeys(parseAPIKeys("API_KEYS"))
+	}
 
 	chains := map[multichain.Chain]binding.ChainOptions{}
 	if os.Getenv("RPC_ARBITRUM") != "" {
@@ -408,6 +799,19 @@ func parseOptions() lightnode.Options {
 		}
 	}
 	options = options.WithChains(chains)
+	if os.Getenv("FINALITY_TAGS") != "" {
+		options = options.WithFinalityTags(parseFinalityTags("FINALITY_TAGS"))
+	}
+	if os.Getenv("EVM_CHAINS") != "" {
+		options = options.WithEVMChains(parseEVMChains("EVM_CHAINS"))
+	}
+	if os.Getenv("HOST_CHAINS") != "" {
+		hostChains, err := lightnode.LoadHostChains(os.Getenv("HOST_CHAINS"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid host chains: %v", err))
+		}
+		options = options.WithHostChains(hostChains...)
+	}
 
 	return options
 }
@@ -426,20 +830,51 @@ func parseNetwork(name string) multichain.Network {
 	return multichain.NetworkLocalnet
 }
 
+// parseInt, parseBool and parseTime parse the environment variable with the
+// given name, or panic if it is invalid so that misconfigurations are not
+// silently replaced with zero. Unset variables are zero.
 func parseInt(name string) int {
-	value, err := strconv.Atoi(os.Getenv(name))
+	if os.Getenv(name) == "" {
+		return 0
+	}
+	value, err := config.ParseCount(os.Getenv(name))
+	if err != nil {
+		panic(fmt.Sprintf("%v: %v", name, err))
+	}
+	return value
+}
+
+func parseBool(name string) bool {
+	if os.Getenv(name) == "" {
+		return false
+	}
+	value, err := config.ParseBool(os.Getenv(name))
 	if err != nil {
+		panic(fmt.Sprintf("%v: %v", name, err))
+	}
+	return value
+}
+
+func parseFloat(name string) float64 {
+	if os.Getenv(name) == "" {
 		return 0
 	}
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		panic(fmt.Sprintf("%v: %v", name, err))
+	}
 	return value
 }
 
 func parseTime(name string) time.Duration {
-	duration, err := strconv.Atoi(os.Getenv(name))
+	if os.Getenv(name) == "" {
+		return 0
+	}
+	duration, err := config.ParseDuration(os.Getenv(name))
 	if err != nil {
-		return 0 * time.Second
+		panic(fmt.Sprintf("%v: %v", name, err))
 	}
-	return time.Duration(duration) * time.Second
+	return duration
 }
 
 func parseAddresses(name string) []wire.Address {
@@ -455,6 +890,19 @@ func parseAddresses(name string) []wire.Address {
 	return addrs
 }
 
+func parseListeners(name string) []http.Listener {
+	listenerStrings := strings.Split(os.Getenv(name), ",")
+	listeners := make([]http.Listener, len(listenerStrings))
+	for i := range listeners {
+		listener, err := http.ParseListener(strings.TrimSpace(listenerStrings[i]))
+		if err != nil {
+			panic(fmt.Sprintf("invalid listener %v: %v", listenerStrings[i], err))
+		}
+		listeners[i] = listener
+	}
+	return listeners
+}
+
 func parseRates(name string) map[string]rate.Limit {
 	rateStrings := strings.Split(os.Getenv(name), ",")
 	rates := make(map[string]rate.Limit)
@@ -463,7 +911,7 @@ func parseRates(name string) map[string]rate.Limit {
 		if len(methodRate) != 2 {
 			panic(fmt.Sprintf("invalid rate pair %v", rateStrings[i]))
 		}
-		parsedRate, err := strconv.Atoi(methodRate[1])
+		parsedRate, err := config.ParseCount(methodRate[1])
 		if err != nil {
 			panic(fmt.Sprintf("invalid rate pair %v: %v", rateStrings[i], err))
 		}
@@ -472,6 +920,118 @@ func parseRates(name string) map[string]rate.Limit {
 	return rates
 }
 
+// parseIPList parses a comma separated list of IPs and CIDR ranges. The entries
+// are validated with the rest of the options.
+func parseIPList(name string) []string {
+	return parseList(name)
+}
+
+// parseList parses a comma separated list, trimming the whitespace around each
+// entry.
+func parseList(name string) []string {
+	if os.Getenv(name) == "" {
+		return nil
+	}
+	entries := strings.Split(os.Getenv(name), ",")
+	for i := range entries {
+		entries[i] = strings.TrimSpace(entries[i])
+	}
+	return entries
+}
+
+func parseCacheTTLs(name string) map[string]time.Duration {
+	ttlStrings := strings.Split(os.Getenv(name), ",")
+	ttls := make(map[string]time.Duration)
+	for i := range ttlStrings {
+		methodTTL := strings.SplitN(strings.TrimSpace(ttlStrings[i]), "=", 2)
+		if len(methodTTL) != 2 {
+			panic(fmt.Sprintf("invalid cache ttl %v", ttlStrings[i]))
+		}
+		ttl, err := config.ParseDuration(methodTTL[1])
+		if err != nil {
+			panic(fmt.Sprintf("invalid cache ttl %v: %v", ttlStrings[i], err))
+		}
+		ttls[methodTTL[0]] = ttl
+	}
+	return ttls
+}
+
+func parseShares(name string) map[string]float64 {
+	shareStrings := strings.Split(os.Getenv(name), ",")
+	shares := make(map[string]float64)
+	for i := range shareStrings {
+		tierShare := strings.SplitN(strings.TrimSpace(shareStrings[i]), "=", 2)
+		if len(tierShare) != 2 {
+			panic(fmt.Sprintf("invalid share %v", shareStrings[i]))
+		}
+		share, err := strconv.ParseFloat(tierShare[1], 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid share %v: %v", shareStrings[i], err))
+		}
+		shares[tierShare[0]] = share
+	}
+	return shares
+}
+
+func parseAPIKeys(name string) map[string]string {
+	keyStrings := strings.Split(os.Getenv(name), ",")
+	keys := make(map[string]string)
+	for i := range keyStrings {
+		keyTier := strings.SplitN(strings.TrimSpace(keyStrings[i]), "=", 2)
+		if len(keyTier) != 2 {
+			// Do not print the key, as it is a secret.
+			panic(fmt.Sprintf("invalid api key at position %v", i))
+		}
+		keys[keyTier[0]] = keyTier[1]
+	}
+	return keys
+}
+
+func parseFinalityTags(name string) map[multichain.Chain]string {
+	tagStrings := strings.Split(os.Getenv(name), ",")
+	tags := make(map[multichain.Chain]string)
+	for i := range tagStrings {
+		chainTag := strings.Split(tagStrings[i], ":")
+		if len(chainTag) != 2 {
+			panic(fmt.Sprintf("invalid finality tag pair %v", tagStrings[i]))
+		}
+		if !finality.ValidTag(chainTag[1]) {
+			panic(fmt.Sprintf("invalid finality tag %v for %v", chainTag[1], chainTag[0]))
+		}
+		tags[multichain.Chain(chainTag[0])] = chainTag[1]
+	}
+	return tags
+}
+
+func parseProxyOverrides(name string) map[string]string {
+	overrideStrings := strings.Split(os.Getenv(name), ",")
+	overrides := make(map[string]string)
+	for i := range overrideStrings {
+		hostProxy := strings.SplitN(strings.TrimSpace(overrideStrings[i]), "=", 2)
+		if len(hostProxy) != 2 {
+			panic(fmt.Sprintf("invalid proxy override %v", overrideStrings[i]))
+		}
+		overrides[hostProxy[0]] = hostProxy[1]
+	}
+	return overrides
+}
+
+func parseHooks(name string) []hooks.Hook {
+	hookStrings := strings.Split(os.Getenv(name), ",")
+	hookList := make([]hooks.Hook, len(hookStrings))
+	for i := range hookStrings {
+		conditionTarget := strings.SplitN(strings.TrimSpace(hookStrings[i]), "=", 2)
+		if len(conditionTarget) != 2 {
+			panic(fmt.Sprintf("invalid hook %v", hookStrings[i]))
+		}
+		hookList[i] = hooks.Hook{Condition: conditionTarget[0], Target: conditionTarget[1]}
+		if err := hookList[i].Validate(); err != nil {
+			panic(fmt.Sprintf("invalid hook %v: %v", hookStrings[i], err))
+		}
+	}
+	return hookList
+}
+
 func parsePubKey(name string) *id.PubKey {
 	pubKeyString := os.Getenv(name)
 	keyBytes, err := hex.DecodeString(pubKeyString)
@@ -493,3 +1053,58 @@ func parseWhitelist(name string) []tx.Selector {
 	}
 	return whitelist
 }
+
+func parseBlockCounts(name string) map[multichain.Chain]uint64 {
+	countStrings := strings.Split(os.Getenv(name), ",")
+	counts := make(map[multichain.Chain]uint64)
+	for i := range countStrings {
+		chainCount := strings.Split(countStrings[i], ":")
+		if len(chainCount) != 2 {
+			panic(fmt.Sprintf("invalid block count pair %v", countStrings[i]))
+		}
+		count, err := config.ParseCount(chainCount[1])
+		if err != nil {
+			panic(fmt.Sprintf("invalid block count pair %v: %v", countStrings[i], err))
+		}
+		counts[multichain.Chain(chainCount[0])] = uint64(count)
+	}
+	return counts
+}
+
+// parseEVMChains parses the watcher configs of EVM chains, given as
+// "chain:confidenceInterval:blockTime:maxLogRange" and separated by commas.
+// Fields which are left empty default to the global watcher options.
+func parseEVMChains(name string) map[multichain.Chain]watcher.ChainConfig {
+	configStrings := strings.Split(os.Getenv(name), ",")
+	configs := make(map[multichain.Chain]watcher.ChainConfig)
+	for i := range configStrings {
+		fields := strings.Split(configStrings[i], ":")
+		if len(fields) != 4 || fields[0] == "" {
+			panic(fmt.Sprintf("invalid evm chain config %v", configStrings[i]))
+		}
+		var chainConfig watcher.ChainConfig
+		if fields[1] != "" {
+			confidenceInterval, err := config.ParseCount(fields[1])
+			if err != nil {
+				panic(fmt.Sprintf("invalid evm chain config %v: %v", configStrings[i], err))
+			}
+			chainConfig.ConfidenceInterval = uint64(confidenceInterval)
+		}
+		if fields[2] != "" {
+			blockTime, err := config.ParseDuration(fields[2])
+			if err != nil {
+				panic(fmt.Sprintf("invalid evm chain config %v: %v", configStrings[i], err))
+			}
+			chainConfig.BlockTime = blockTime
+		}
+		if fields[3] != "" {
+			maxLogRange, err := config.ParseCount(fields[3])
+			if err != nil {
+				panic(fmt.Sprintf("invalid evm chain config %v: %v", configStrings[i], err))
+			}
+			chainConfig.MaxLogRange = uint64(maxLogRange)
+		}
+		configs[multichain.Chain(fields[0])] = chainConfig
+	}
+	return configs
+}
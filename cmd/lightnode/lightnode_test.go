@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/lightnode/http"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,7 +18,7 @@ var _ = Describe("Lightnode cmd test", func() {
 	// 	defer cancel()
 
 	// 	logger := logrus.New()
-	// 	conf, err := fetchConfig(ctx, "http://lightnode-devnet.herokuapp.com/", logger, time.Minute)
+	// 	conf, err := fetchConfig(ctx, http.NewClient(time.Minute), "http://lightnode-devnet.herokuapp.com/", logger)
 	// 	Expect(err).ShouldNot(HaveOccurred())
 	// 	ethConfs := conf.Confirmations[multichain.Ethereum]
 	// 	Expect(ethConfs).NotTo(BeZero())
@@ -27,7 +29,7 @@ var _ = Describe("Lightnode cmd test", func() {
 		defer cancel()
 
 		logger := logrus.New()
-		conf, err := getConfigFromBootstrap(ctx, logger, []wire.Address{})
+		conf, err := getConfigFromBootstrap(ctx, http.NewClient(time.Minute), logger, []wire.Address{})
 		Expect(conf).To(BeZero())
 		Expect(err).Should(HaveOccurred())
 	})
@@ -38,7 +40,7 @@ var _ = Describe("Lightnode cmd test", func() {
 
 		logger := logrus.New()
 		addrs := make([]wire.Address, 3)
-		conf, err := getConfigFromBootstrap(ctx, logger, addrs)
+		conf, err := getConfigFromBootstrap(ctx, http.NewClient(time.Minute), logger, addrs)
 		Expect(conf).To(BeZero())
 		Expect(err).Should(HaveOccurred())
 	})
@@ -56,7 +58,7 @@ var _ = Describe("Lightnode cmd test", func() {
 	// 		Nonce:     0,
 	// 		Signature: [65]byte{},
 	// 	}
-	// 	conf, err := getConfigFromBootstrap(ctx, logger, addrs)
+	// 	conf, err := getConfigFromBootstrap(ctx, http.NewClient(time.Minute), logger, addrs)
 	// 	Expect(conf).NotTo(BeZero())
 	// 	Expect(err).ShouldNot(HaveOccurred())
 	// })
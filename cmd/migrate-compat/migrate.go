@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+)
+
+// migrate-compat copies the compat mappings stored in Redis into the database,
+// so that v0 hash lookups no longer depend on Redis. It connects using the same
+// environment variables as the Lightnode and skips mappings which are already
+// in the database, so it is safe to run more than once. It should be run while
+// the Lightnode uses the "migrating" compat backend, so that mappings written
+// during the migration are stored in both.
+func main() {
+	batchSize := flag.Int64("batch-size", 1000, "number of redis keys to scan at a time")
+	flag.Parse()
+
+	driver, dbURL := os.Getenv("DATABASE_DRIVER"), os.Getenv("DATABASE_URL")
+	sqlDB, err := sql.Open(driver, dbURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %v db: %v\n", driver, err)
+		os.Exit(1)
+	}
+	defer sqlDB.Close()
+	database := db.New(sqlDB, 0, 1)
+	if err := database.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize db: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := initRedis()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to redis: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	start := time.Now()
+	counts, err := v0.MigrateRedisMappings(client, database, *batchSize)
+	fmt.Printf("migrated %v of %v mappings (%v already in the db) in %v\n", counts.Migrated, counts.Scanned, counts.Existing, time.Since(start).Truncate(time.Second))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate mappings: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func initRedis() (*redis.Client, error) {
+	redisURL, err := url.Parse(os.Getenv("REDIS_URL"))
+	if err != nil {
+		return nil, err
+	}
+	redisPassword, _ := redisURL.User.Password()
+	client := redis.NewClient(&redis.Options{
+		Addr:       redisURL.Host,
+		Password:   redisPassword,
+		DB:         0, // Use default DB.
+		MaxRetries: 5,
+	})
+	return client, client.Ping().Err()
+}
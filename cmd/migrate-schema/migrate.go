@@ -0,0 +1,46 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/renproject/lightnode/db"
+)
+
+// migrate-schema applies the migrations of the Lightnode database, or rolls
+// them back to an older schema version before the Lightnode is downgraded. It
+// connects using the same environment variables as the Lightnode, which
+// applies the migrations itself at startup, so it is only needed to migrate
+// ahead of a deployment or to roll back.
+func main() {
+	rollback := flag.Int("rollback", 0, "schema version to roll back to, instead of migrating to the latest version")
+	flag.Parse()
+
+	driver, dbURL := os.Getenv("DATABASE_DRIVER"), os.Getenv("DATABASE_URL")
+	sqlDB, err := sql.Open(driver, dbURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %v db: %v\n", driver, err)
+		os.Exit(1)
+	}
+	defer sqlDB.Close()
+	database := db.New(sqlDB, 0, 1)
+
+	if *rollback > 0 {
+		if err := database.RollbackSchema(*rollback); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to roll back db: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("rolled back to schema version %v\n", *rollback)
+		return
+	}
+	if err := database.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate db: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("migrated to schema version %v\n", db.SchemaVersion)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+)
+
+// restore moves archived transactions back into the txs table of the
+// Lightnode database. It connects using the same environment variables as the
+// Lightnode and takes the hashes of the transactions to restore as arguments.
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s <tx hash>...\n", os.Args[0])
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	driver, dbURL := os.Getenv("DATABASE_DRIVER"), os.Getenv("DATABASE_URL")
+	sqlDB, err := sql.Open(driver, dbURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to %v db: %v\n", driver, err)
+		os.Exit(1)
+	}
+	defer sqlDB.Close()
+	database := db.New(sqlDB, 0, 1)
+
+	failed := false
+	for _, arg := range flag.Args() {
+		hash, err := decodeHash(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid tx hash %v: %v\n", arg, err)
+			failed = true
+			continue
+		}
+		if err := database.RestoreTx(hash); err != nil {
+			if err == sql.ErrNoRows {
+				err = fmt.Errorf("not found in archive")
+			}
+			fmt.Fprintf(os.Stderr, "cannot restore tx %v: %v\n", arg, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("restored tx %v\n", arg)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func decodeHash(s string) (id.Hash, error) {
+	hashBytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		hashBytes, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return id.Hash{}, fmt.Errorf("not base64")
+		}
+	}
+	if len(hashBytes) != len(id.Hash{}) {
+		return id.Hash{}, fmt.Errorf("expected %v bytes, got %v", len(id.Hash{}), len(hashBytes))
+	}
+	hash := id.Hash{}
+	copy(hash[:], hashBytes)
+	return hash, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/health"
+	lhttp "github.com/renproject/lightnode/http"
+)
+
+// errSkipped is returned by checks which have not been configured.
+var errSkipped = fmt.Errorf("skipped")
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// smoketest runs a sequence of read-only checks against a deployed Lightnode
+// and exits with a non-zero status if any of them fail, so that it can be used
+// to gate a deployment. The submit check sends a tx which is expected to be
+// rejected by the validator, so no tx is ever created.
+func main() {
+	baseURL := flag.String("url", os.Getenv("LIGHTNODE_URL"), "url of the Lightnode, defaults to LIGHTNODE_URL")
+	adminURL := flag.String("admin-url", os.Getenv("LIGHTNODE_ADMIN_URL"), "url of the admin listener of the Lightnode if it has one, defaults to LIGHTNODE_ADMIN_URL")
+	adminToken := flag.String("admin-token", os.Getenv("LIGHTNODE_ADMIN_TOKEN"), "admin token of the Lightnode, defaults to LIGHTNODE_ADMIN_TOKEN, the health check is skipped if empty")
+	v0Hash := flag.String("v0-tx", "", "hash of a known v0 tx to query, the check is skipped if empty")
+	v1Hash := flag.String("v1-tx", "", "hash of a known v1 tx to query, the check is skipped if empty")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of each check")
+	flag.Parse()
+
+	if *baseURL == "" {
+		fmt.Fprintln(os.Stderr, "missing lightnode url")
+		os.Exit(1)
+	}
+	url := strings.TrimSuffix(*baseURL, "/")
+	admin := url
+	if *adminURL != "" {
+		admin = strings.TrimSuffix(*adminURL, "/")
+	}
+	client := lhttp.NewClient(*timeout)
+
+	checks := []check{
+		{"ready", func(ctx context.Context) error {
+			return checkReport(ctx, client, admin+"/ready", "")
+		}},
+		{"health", func(ctx context.Context) error {
+			if *adminToken == "" {
+				return errSkipped
+			}
+			return checkReport(ctx, client, admin+"/health", *adminToken)
+		}},
+		{jsonrpc.MethodQueryConfig, func(ctx context.Context) error {
+			return expectResult(ctx, client, url, jsonrpc.MethodQueryConfig, jsonrpc.ParamsQueryConfig{})
+		}},
+		{jsonrpc.MethodQueryBlockState, func(ctx context.Context) error {
+			return expectResult(ctx, client, url, jsonrpc.MethodQueryBlockState, jsonrpc.ParamsQueryBlockState{})
+		}},
+		{"ren_queryTx (v0)", func(ctx context.Context) error {
+			return checkQueryTx(ctx, client, url, *v0Hash)
+		}},
+		{"ren_queryTx (v1)", func(ctx context.Context) error {
+			return checkQueryTx(ctx, client, url, *v1Hash)
+		}},
+		{"ren_submitTx (dry run)", func(ctx context.Context) error {
+			return checkSubmit(ctx, client, url)
+		}},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		start := time.Now()
+		err := c.run(ctx)
+		cancel()
+
+		switch err {
+		case nil:
+			fmt.Printf("ok      %-24v %v\n", c.name, time.Since(start).Round(time.Millisecond))
+		case errSkipped:
+			fmt.Printf("skipped %-24v\n", c.name)
+		default:
+			failed++
+			fmt.Printf("FAIL    %-24v %v\n", c.name, err)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%v of %v checks failed against %v\n", failed, len(checks), url)
+		os.Exit(1)
+	}
+	fmt.Printf("all checks passed against %v\n", url)
+}
+
+// checkReport checks that the readiness or health check at the url reports
+// every dependency as ok, and lists the ones which are not. The token is only
+// sent if it is not empty, as readiness checks are not authenticated.
+func checkReport(ctx context.Context, client lhttp.Client, url, token string) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Readiness checks respond with 503 Service Unavailable, and a report,
+	// if a dependency is not ok.
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusServiceUnavailable {
+		return fmt.Errorf("unexpected status %v", response.Status)
+	}
+	var report health.Report
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		return fmt.Errorf("invalid report: %v", err)
+	}
+	if report.Status == health.StatusOK {
+		return nil
+	}
+	failed := []string{}
+	for name, dependency := range report.Dependencies {
+		if dependency.Status != health.StatusOK {
+			failed = append(failed, fmt.Sprintf("%v: %v", name, dependency.Error))
+		}
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("%v, %v", report.Status, strings.Join(failed, ", "))
+}
+
+// checkQueryTx checks that the tx with the given hash can be queried. The hash
+// is passed through as is, so that both v0 and v1 encodings can be used.
+func checkQueryTx(ctx context.Context, client lhttp.Client, url, hash string) error {
+	if hash == "" {
+		return errSkipped
+	}
+	return expectResult(ctx, client, url, jsonrpc.MethodQueryTx, map[string]string{"txHash": hash})
+}
+
+// checkSubmit submits a tx which is missing all of its fields, and checks that
+// it is rejected by the validator rather than failing elsewhere.
+func checkSubmit(ctx context.Context, client lhttp.Client, url string) error {
+	response, err := send(ctx, client, url, jsonrpc.MethodSubmitTx, map[string]interface{}{"tx": map[string]interface{}{}})
+	if err != nil {
+		return err
+	}
+	if response.Error == nil {
+		return fmt.Errorf("invalid tx was accepted")
+	}
+	if response.Error.Code != jsonrpc.ErrorCodeInvalidParams {
+		return fmt.Errorf("expected invalid params error, got code=%v: %v", response.Error.Code, response.Error.Message)
+	}
+	return nil
+}
+
+// expectResult sends the request and checks that it returns a result.
+func expectResult(ctx context.Context, client lhttp.Client, url, method string, params interface{}) error {
+	response, err := send(ctx, client, url, method, params)
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return fmt.Errorf("code=%v: %v", response.Error.Code, response.Error.Message)
+	}
+	if response.Result == nil {
+		return fmt.Errorf("empty result")
+	}
+	return nil
+}
+
+func send(ctx context.Context, client lhttp.Client, url, method string, params interface{}) (jsonrpc.Response, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return jsonrpc.Response{}, fmt.Errorf("cannot marshal params: %v", err)
+	}
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  method,
+		Params:  data,
+	}
+	return client.SendRequest(ctx, url, request, nil)
+}
@@ -0,0 +1,97 @@
+package v0
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// ChainReader reads the chain state needed to convert v0 txs into v1 txs.
+type ChainReader interface {
+	// UTXOAmount returns the value of the given output on the chain.
+	UTXOAmount(ctx context.Context, chain multichain.Chain, outpoint multichain.UTXOutpoint) (pack.U256, error)
+
+	// EthereumBurn returns the details of the burn with the given reference
+	// from the Ethereum gateway of the asset.
+	EthereumBurn(ctx context.Context, asset multichain.Asset, ref *big.Int) (Burn, error)
+}
+
+// Burn describes a burn on a host chain.
+type Burn struct {
+	Txid    pack.Bytes
+	Amount  *big.Int
+	To      []byte
+	Payload pack.Bytes
+}
+
+type bindingChainReader struct {
+	bindings *binding.Binding
+}
+
+// NewChainReader returns a ChainReader which uses the chain clients of the
+// given bindings.
+func NewChainReader(bindings *binding.Binding) ChainReader {
+	return bindingChainReader{bindings: bindings}
+}
+
+func (reader bindingChainReader) UTXOAmount(ctx context.Context, chain multichain.Chain, outpoint multichain.UTXOutpoint) (pack.U256, error) {
+	client := reader.bindings.UTXOClient(chain)
+	output, _, err := client.Output(ctx, outpoint)
+	if err != nil {
+		return pack.U256{}, err
+	}
+	return output.Value, nil
+}
+
+func (reader bindingChainReader) EthereumBurn(ctx context.Context, asset multichain.Asset, ref *big.Int) (Burn, error) {
+	client := reader.bindings.EthereumClient(multichain.Ethereum)
+	options := reader.bindings.ChainOption(multichain.Ethereum)
+	gatewayBinding := reader.bindings.EthereumGateway(multichain.Ethereum, asset)
+
+	details, err := gatewayBinding.GetBurn(&bind.CallOpts{Context: ctx}, ref)
+	if err != nil {
+		return Burn{}, fmt.Errorf("getting burn with ref=%v: %v", ref, err)
+	}
+
+	latestBlockHeader, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return Burn{}, fmt.Errorf("getting latest block header: %v", err)
+	}
+	confirmations := new(big.Int).Sub(latestBlockHeader.Number, details.Blocknumber).Uint64()
+	if pack.U64(confirmations) > options.MaxConfirmations {
+		return Burn{}, fmt.Errorf("burn too old: confirmations=%v exceeds max=%v", confirmations, options.MaxConfirmations)
+	}
+	blockNumber := details.Blocknumber.Uint64()
+
+	iter, err := gatewayBinding.FilterLogBurn(&bind.FilterOpts{
+		Start:   blockNumber,
+		End:     &blockNumber,
+		Context: ctx,
+	}, []*big.Int{ref}, nil)
+	if err != nil {
+		return Burn{}, fmt.Errorf("filtering burn logs for block #%v (ref=%v): %v", blockNumber, ref, err)
+	}
+	if iter == nil {
+		return Burn{}, fmt.Errorf("no burn logs for block #%v (ref=%v): %v", blockNumber, ref, err)
+	}
+	var txid pack.Bytes
+	for iter.Next() {
+		txid = iter.Event.Raw.TxHash.Bytes()
+		break
+	}
+	if iter.Error() != nil {
+		return Burn{}, fmt.Errorf("getting burn log details for block #%v (ref=%v): %v", blockNumber, ref, err)
+	}
+
+	return Burn{
+		Txid:    txid,
+		Amount:  details.Amount,
+		To:      details.To,
+		Payload: details.Payload,
+	}, nil
+}
@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/jbenet/go-base58"
@@ -19,6 +18,7 @@ import (
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
+	lerrors "github.com/renproject/lightnode/errors"
 	"github.com/renproject/multichain"
 	"github.com/renproject/multichain/chain/bitcoin"
 	"github.com/renproject/multichain/chain/bitcoincash"
@@ -208,22 +208,13 @@ func TxFromV1Tx(t tx.Tx, hasOut bool, bindings binding.Bindings) (Tx, error) {
 		Value: B32(nhash),
 	})
 
-	utxo := ExtBtcCompatUTXO{}
-
 	btcTxHash := t.Input.Get("txid").(pack.Bytes)
-	btcTxHashReversed := make([]byte, len(btcTxHash))
-	copy(btcTxHashReversed, btcTxHash)
-	txl := len(btcTxHashReversed)
-	for i := 0; i < txl/2; i++ {
-		btcTxHashReversed[i], btcTxHashReversed[txl-1-i] = btcTxHashReversed[txl-1-i], btcTxHashReversed[i]
-	}
-	if err := utxo.TxHash.UnmarshalBinary(btcTxHashReversed); err != nil {
+	btcTxIndex := t.Input.Get("txindex").(pack.U32)
+	utxo, err := utxoFromV1Outpoint(btcTxHash, btcTxIndex)
+	if err != nil {
 		return tx, nil
 	}
 
-	btcTxIndex := t.Input.Get("txindex").(pack.U32)
-	utxo.VOut = U32{Int: big.NewInt(int64(btcTxIndex))}
-
 	// utxo field `In` on has txHash and vout
 	tx.In.Set(Arg{
 		Name:  "utxo",
@@ -375,6 +366,21 @@ func TxFromV1Tx(t tx.Tx, hasOut bool, bindings binding.Bindings) (Tx, error) {
 	return tx, nil
 }
 
+// utxoFromV1Outpoint returns the v0 utxo for the outpoint of a v1 tx. The v1
+// txid is reversed, whereas v0 uses the byte order displayed by explorers.
+func utxoFromV1Outpoint(txid pack.Bytes, txindex pack.U32) (ExtBtcCompatUTXO, error) {
+	utxo := ExtBtcCompatUTXO{}
+	txidReversed := make([]byte, len(txid))
+	for i := range txid {
+		txidReversed[i] = txid[len(txid)-1-i]
+	}
+	if err := utxo.TxHash.UnmarshalBinary(txidReversed); err != nil {
+		return ExtBtcCompatUTXO{}, err
+	}
+	utxo.VOut = U32{Int: big.NewInt(int64(txindex))}
+	return utxo, nil
+}
+
 // V1QueryTxFromQueryTx casts a v0 ParamsQueryTx to a v1 ParamsQueryTx
 // by encoding the txhash in the appropriate manner
 func V1QueryTxFromQueryTx(queryTx ParamsQueryTx) jsonrpc.ParamsQueryTx {
@@ -435,7 +441,7 @@ func MintTxHash(sel tx.Selector, ghash pack.Bytes32, txid pack.Bytes, txindex pa
 // Will attempt to check if we have already constructed the parameters previously,
 // otherwise will construct a v1 tx using v0 parameters, and persist a mapping
 // so that a v0 queryTX can find them
-func V1TxParamsFromTx(ctx context.Context, params ParamsSubmitTx, bindings *binding.Binding, pubkey *id.PubKey, store CompatStore, network multichain.Network) (jsonrpc.ParamsSubmitTx, error) {
+func V1TxParamsFromTx(ctx context.Context, params ParamsSubmitTx, chains ChainReader, pubkey *id.PubKey, store CompatStore, network multichain.Network) (jsonrpc.ParamsSubmitTx, error) {
 	// We first do some validation to the v0 params to prevent people spamming
 	// invalid v0 transactions
 	if err := ValidateV0Tx(params.Tx); err != nil {
@@ -450,62 +456,72 @@ func V1TxParamsFromTx(ctx context.Context, params ParamsSubmitTx, bindings *bind
 			Tx: v1Tx,
 		}, err
 	}
-	if err != nil && err != ErrNotFound {
+	if err != nil && !lerrors.Is(err, lerrors.ErrNotFound) {
 		// If there are errors with persistence, we won't be able to handle the tx
 		// at a later state, so return an error early on
 		return jsonrpc.ParamsSubmitTx{}, err
 	}
 
+	txHash, v1Tx, err := ConvertV0Tx(ctx, params.Tx, chains, pubkey, network)
+	if err != nil {
+		return jsonrpc.ParamsSubmitTx{}, err
+	}
+	copy(params.Tx.Hash[:], txHash[:])
+	v1Params := jsonrpc.ParamsSubmitTx{Tx: v1Tx}
+
+	// Store the v0/v1 mapping in the CompatStore
+	if err := store.PersistTxMappings(params.Tx, v1Params.Tx); err != nil {
+		return jsonrpc.ParamsSubmitTx{}, err
+	}
+
+	return v1Params, nil
+}
+
+// ConvertV0Tx converts a v0 tx into the v1 tx which is submitted on its
+// behalf, and returns it along with the hash of the v0 tx. Unlike
+// V1TxParamsFromTx, the mapping between them is not persisted.
+func ConvertV0Tx(ctx context.Context, v0tx Tx, chains ChainReader, pubkey *id.PubKey, network multichain.Network) (B32, tx.Tx, error) {
 	var txHash B32
+	var v1Tx tx.Tx
+	var err error
 
 	submitVersion := tx.Version0
 	// Convert the v0 tx to v1 transaction
-	if IsShiftIn(params.Tx.To) {
-		v1Tx, txHash, err = V1TxFromV0Mint(ctx, params.Tx, bindings, pubkey)
+	if IsShiftIn(v0tx.To) {
+		v1Tx, txHash, err = V1TxFromV0Mint(ctx, v0tx, chains, pubkey)
 		if err != nil {
-			return jsonrpc.ParamsSubmitTx{}, err
+			return B32{}, tx.Tx{}, err
 		}
 	} else {
-		v1Tx, err = V1TxFromV0Burn(ctx, params.Tx, bindings, network)
+		v1Tx, err = V1TxFromV0Burn(ctx, v0tx, chains, network)
 		if err != nil {
-			return jsonrpc.ParamsSubmitTx{}, err
+			return B32{}, tx.Tx{}, err
 		}
 
 		submitVersion = tx.Version1
 
 		// Calculate tx hash for v0 tx
-		txHash, err = V0TxHashFromTx(params.Tx)
+		txHash, err = V0TxHashFromTx(v0tx)
 		if err != nil {
-			return jsonrpc.ParamsSubmitTx{}, err
+			return B32{}, tx.Tx{}, err
 		}
 	}
 
-	copy(params.Tx.Hash[:], txHash[:])
-
 	// calculate the new tx format hash
 	h, err := tx.NewTxHash(submitVersion, v1Tx.Selector, v1Tx.Input)
 	if err != nil {
-		return jsonrpc.ParamsSubmitTx{}, err
+		return B32{}, tx.Tx{}, err
 	}
 
 	// We change the version version0 to indicate this tx is converted from a
 	// v0 transaction, so that when resolver tries to resolve this tx, it knows
 	// to return an v0 format response to the user.
-	v1Params := jsonrpc.ParamsSubmitTx{
-		Tx: tx.Tx{
-			Version:  tx.Version0,
-			Hash:     h,
-			Input:    v1Tx.Input,
-			Selector: v1Tx.Selector,
-		},
-	}
-
-	// Store the v0/v1 mapping in the CompatStore
-	if err := store.PersistTxMappings(params.Tx, v1Params.Tx); err != nil {
-		return jsonrpc.ParamsSubmitTx{}, err
-	}
-
-	return v1Params, nil
+	return txHash, tx.Tx{
+		Version:  tx.Version0,
+		Hash:     h,
+		Input:    v1Tx.Input,
+		Selector: v1Tx.Selector,
+	}, nil
 }
 
 func AddressEncodeDecoder(chain multichain.Chain, network multichain.Network) multichain.AddressEncodeDecoder {
@@ -573,7 +589,7 @@ func NetParams(chain multichain.Chain, net multichain.Network) *chaincfg.Params
 	}
 }
 
-func V1TxFromV0Mint(ctx context.Context, v0tx Tx, bindings *binding.Binding, pubkey *id.PubKey) (tx.Tx, B32, error) {
+func V1TxFromV0Mint(ctx context.Context, v0tx Tx, chains ChainReader, pubkey *id.PubKey) (tx.Tx, B32, error) {
 	selector := tx.Selector(fmt.Sprintf("%s/toEthereum", v0tx.To[0:3]))
 	utxo := v0tx.In.Get("utxo").Value.(ExtBtcCompatUTXO)
 	vout := utxo.VOut.Int.Uint64()
@@ -591,15 +607,13 @@ func V1TxFromV0Mint(ctx context.Context, v0tx Tx, bindings *binding.Binding, pub
 
 	txindex := pack.NewU32(uint32(vout))
 
-	client := bindings.UTXOClient(selector.Asset().OriginChain())
-	output, _, err := client.Output(ctx, multichain.UTXOutpoint{
+	amount, err := chains.UTXOAmount(ctx, selector.Asset().OriginChain(), multichain.UTXOutpoint{
 		Hash:  txid,
 		Index: pack.NewU32(uint32(vout)),
 	})
 	if err != nil {
 		return tx.Tx{}, B32{}, err
 	}
-	amount := output.Value
 
 	token := v0tx.In.Get("token").Value.(ExtEthCompatAddress)
 	payload := pack.NewBytes(v0tx.In.Get("p").Value.(ExtEthCompatPayload).Value[:])
@@ -651,50 +665,17 @@ func V1TxFromV0Mint(ctx context.Context, v0tx Tx, bindings *binding.Binding, pub
 	return v1Tx, v0hash, err
 }
 
-func V1TxFromV0Burn(ctx context.Context, v0tx Tx, bindings *binding.Binding, network multichain.Network) (tx.Tx, error) {
+func V1TxFromV0Burn(ctx context.Context, v0tx Tx, chains ChainReader, network multichain.Network) (tx.Tx, error) {
 	selector := tx.Selector(fmt.Sprintf("%s/fromEthereum", v0tx.To[0:3]))
 	ref := v0tx.In.Get("ref").Value.(U64)
 	var nonce pack.Bytes32
 	copy(nonce[:], pack.NewU256FromInt(ref.Int).Bytes())
 
-	client := bindings.EthereumClient(multichain.Ethereum)
-	options := bindings.ChainOption(multichain.Ethereum)
-	gatewayBinding := bindings.EthereumGateway(multichain.Ethereum, selector.Asset())
-
-	details, err := gatewayBinding.GetBurn(&bind.CallOpts{}, ref.Int)
-	if err != nil {
-		return tx.Tx{}, fmt.Errorf("getting burn with ref=%v: %v", ref, err)
-	}
-
-	latestBlockHeader, err := client.HeaderByNumber(ctx, nil)
-	if err != nil {
-		return tx.Tx{}, fmt.Errorf("getting latest block header: %v", err)
-	}
-	confirmations := new(big.Int).Sub(latestBlockHeader.Number, details.Blocknumber).Uint64()
-	if pack.U64(confirmations) > options.MaxConfirmations {
-		return tx.Tx{}, fmt.Errorf("burn too old: confirmations=%v exceeds max=%v", confirmations, options.MaxConfirmations)
-	}
-	blockNumber := details.Blocknumber.Uint64()
-
-	iter, err := gatewayBinding.FilterLogBurn(&bind.FilterOpts{
-		Start:   blockNumber,
-		End:     &blockNumber,
-		Context: ctx,
-	}, []*big.Int{ref.Int}, nil)
+	details, err := chains.EthereumBurn(ctx, selector.Asset(), ref.Int)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("filtering burn logs for block #%v (ref=%v): %v", blockNumber, ref, err)
-	}
-	if iter == nil {
-		return tx.Tx{}, fmt.Errorf("no burn logs for block #%v (ref=%v): %v", blockNumber, ref, err)
-	}
-	var txid pack.Bytes
-	for iter.Next() {
-		txid = iter.Event.Raw.TxHash.Bytes()
-		break
-	}
-	if iter.Error() != nil {
-		return tx.Tx{}, fmt.Errorf("getting burn log details for block #%v (ref=%v): %v", blockNumber, ref, err)
+		return tx.Tx{}, err
 	}
+	txid := details.Txid
 
 	amount := pack.NewU256FromInt(details.Amount)
 	payload := details.Payload
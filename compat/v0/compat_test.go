@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math/big"
+	"math/rand"
 	"os"
 	"time"
 
@@ -16,8 +19,8 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/go-redis/redis/v7"
-	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
 	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
 	"github.com/renproject/lightnode/db"
@@ -25,10 +28,11 @@ import (
 	"github.com/renproject/lightnode/testutils"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
 )
 
 var _ = Describe("Compat V0", func() {
-	init := func(params v0.ParamsSubmitTx, hasCache bool) (v0.Store, redis.Cmdable, *binding.Binding, *id.PubKey) {
+	init := func(params v0.ParamsSubmitTx, hasCache bool) (v0.Store, redis.Cmdable, v0.ChainReader, *id.PubKey) {
 		mr, err := miniredis.Run()
 		if err != nil {
 			panic(err)
@@ -38,32 +42,7 @@ var _ = Describe("Compat V0", func() {
 			Addr: mr.Addr(),
 		})
 
-		bindingsOpts := binding.DefaultOptions().
-			WithNetwork(multichain.NetworkLocalnet)
-
-		bindingsOpts.WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-			RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
-			Confirmations: pack.U64(0),
-		})
-
-		bindingsOpts.WithChainOptions(multichain.BitcoinCash, binding.ChainOptions{
-			RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoincashd"),
-			Confirmations: pack.U64(0),
-		})
-
-		bindingsOpts.WithChainOptions(multichain.Zcash, binding.ChainOptions{
-			RPC:           pack.String("https://multichain-staging.renproject.io/testnet/zcashd"),
-			Confirmations: pack.U64(0),
-		})
-
-		bindingsOpts.WithChainOptions(multichain.Ethereum, binding.ChainOptions{
-			RPC:              pack.String("https://multichain-staging.renproject.io/testnet/kovan"),
-			Confirmations:    pack.U64(0),
-			Protocol:         pack.String("0x5045E727D9D9AcDe1F6DCae52B078EC30dC95455"),
-			MaxConfirmations: pack.MaxU64,
-		})
-
-		bindings := binding.New(bindingsOpts)
+		chains := testutils.NewMockChainReader()
 
 		pubkeyB, err := base64.URLEncoding.DecodeString("AnbyLhl6mDMSj-K6-F_KCOCsI5Qc3wW-I3-b9-HpNdhl")
 		Expect(err).ShouldNot(HaveOccurred())
@@ -72,31 +51,17 @@ var _ = Describe("Compat V0", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 
 		sqlDB, err := sql.Open("sqlite3", "./test.db")
-		database := db.New(sqlDB, 0)
+		database := db.New(sqlDB, 0, 1)
 		store := v0.NewCompatStore(database, client, time.Hour)
 
-		return store, client, bindings, (*id.PubKey)(pubkey)
+		return store, client, chains, (*id.PubKey)(pubkey)
 	}
 
 	initVerifier := func() resolver.Verifier {
 		hostChains := map[multichain.Chain]bool{
 			multichain.Ethereum: true,
 		}
-		bindingsOpts := binding.DefaultOptions().
-			WithNetwork(multichain.NetworkLocalnet).
-			WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-				RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
-				Confirmations: pack.U64(0),
-			}).
-			WithChainOptions(multichain.Ethereum, binding.ChainOptions{
-				RPC:              pack.String("https://multichain-staging.renproject.io/testnet/kovan"),
-				Confirmations:    pack.U64(0),
-				Protocol:         pack.String("0x5045E727D9D9AcDe1F6DCae52B078EC30dC95455"),
-				MaxConfirmations: pack.MaxU64,
-			})
-
-		bindings := binding.New(bindingsOpts)
-		verifier := resolver.NewVerifier(hostChains, bindings)
+		verifier := resolver.NewVerifier(hostChains, testutils.NewMockChainReader().Bindings())
 		return verifier
 	}
 
@@ -123,11 +88,11 @@ var _ = Describe("Compat V0", func() {
 
 	It("should convert a v0 BTC Burn ParamsSubmitTx into an v1 ParamsSubmitTx", func() {
 		params := testutils.MockBurnParamSubmitTxV0BTC()
-		store, _, bindings, pubkey := init(params, false)
+		store, _, chains, pubkey := init(params, false)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		v1, err := v0.V1TxParamsFromTx(ctx, params, bindings, pubkey, store, multichain.NetworkTestnet)
+		v1, err := v0.V1TxParamsFromTx(ctx, params, chains, pubkey, store, multichain.NetworkTestnet)
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(v1.Tx.Version).Should(Equal(tx.Version0))
 		v1.Tx.Version = tx.Version1
@@ -149,11 +114,11 @@ var _ = Describe("Compat V0", func() {
 
 	It("should convert a v0 BTC ParamsSubmitTx into a v1 ParamsSubmitTx", func() {
 		params := testutils.MockParamSubmitTxV0BTC()
-		store, client, bindings, pubkey := init(params, true)
+		store, client, chains, pubkey := init(params, true)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		v1, err := v0.V1TxParamsFromTx(ctx, params, bindings, pubkey, store, multichain.NetworkTestnet)
+		v1, err := v0.V1TxParamsFromTx(ctx, params, chains, pubkey, store, multichain.NetworkTestnet)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		// should have a key for the utxo
@@ -189,11 +154,11 @@ var _ = Describe("Compat V0", func() {
 
 	It("should convert a v0 ZEC ParamsSubmitTx into a v1 ParamsSubmitTx", func() {
 		params := testutils.MockParamSubmitTxV0ZEC()
-		store, client, bindings, pubkey := init(params, true)
+		store, client, chains, pubkey := init(params, true)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		v1, err := v0.V1TxParamsFromTx(ctx, params, bindings, pubkey, store, multichain.NetworkTestnet)
+		v1, err := v0.V1TxParamsFromTx(ctx, params, chains, pubkey, store, multichain.NetworkTestnet)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		// should have a key for the utxo
@@ -227,11 +192,11 @@ var _ = Describe("Compat V0", func() {
 
 	It("should convert a v0 BCH ParamsSubmitTx into a v1 ParamsSubmitTx", func() {
 		params := testutils.MockParamSubmitTxV0BCH()
-		store, client, bindings, pubkey := init(params, true)
+		store, client, chains, pubkey := init(params, true)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		v1, err := v0.V1TxParamsFromTx(ctx, params, bindings, pubkey, store, multichain.NetworkTestnet)
+		v1, err := v0.V1TxParamsFromTx(ctx, params, chains, pubkey, store, multichain.NetworkTestnet)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		// should have a key for the utxo
@@ -261,4 +226,312 @@ var _ = Describe("Compat V0", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 		Expect(hash).To(Equal(v1Hash.String()))
 	})
+	It("should backfill the mappings of v0 txs", func() {
+		for _, params := range []v0.ParamsSubmitTx{testutils.MockParamSubmitTxV0BTC(), testutils.MockBurnParamSubmitTxV0BTC()} {
+			store, client, chains, pubkey := init(params, true)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			v1, err := v0.V1TxParamsFromTx(ctx, params, chains, pubkey, store, multichain.NetworkTestnet)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			mappings := map[string]string{}
+			keys, err := client.Keys("*").Result()
+			Expect(err).ShouldNot(HaveOccurred())
+			for _, key := range keys {
+				if key == v0.MappingIndexKey {
+					continue
+				}
+				mappings[key], err = client.Get(key).Result()
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			Expect(mappings).Should(HaveLen(2))
+
+			// Recompute the mappings as if they had never been written.
+			Expect(client.FlushAll().Err()).Should(Succeed())
+			written, err := store.BackfillTxMappings(v1.Tx)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(written).Should(BeTrue())
+			for key, value := range mappings {
+				Expect(client.Get(key).Result()).Should(Equal(value))
+			}
+
+			written, err = store.BackfillTxMappings(v1.Tx)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(written).Should(BeFalse())
+
+			// The bulk variant writes the same mappings, and reports txs
+			// whose mappings cannot be computed.
+			Expect(client.FlushAll().Err()).Should(Succeed())
+			invalid := v1.Tx
+			invalid.Hash = id.Hash{1}
+			invalid.Input = pack.Typed{}
+			n, failed, err := store.BackfillTxsMappings([]tx.Tx{v1.Tx, invalid})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(n).Should(Equal(1))
+			Expect(failed).Should(HaveLen(1))
+			Expect(failed).Should(HaveKey(invalid.Hash))
+			for key, value := range mappings {
+				Expect(client.Get(key).Result()).Should(Equal(value))
+			}
+
+			n, failed, err = store.BackfillTxsMappings([]tx.Tx{v1.Tx})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(n).Should(Equal(0))
+			Expect(failed).Should(BeEmpty())
+		}
+	})
+
+	It("should garbage collect mappings for txs which are not in the db", func() {
+		mr, err := miniredis.Run()
+		Expect(err).ShouldNot(HaveOccurred())
+		client := redis.NewClient(&redis.Options{
+			Addr: mr.Addr(),
+		})
+
+		sqlDB, err := sql.Open("sqlite3", "./test.db")
+		Expect(err).ShouldNot(HaveOccurred())
+		database := db.New(sqlDB, 0, 1)
+		Expect(database.Init()).Should(Succeed())
+		store := v0.NewCompatStore(database, client, time.Hour)
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		persisted := txutil.RandomGoodTx(r)
+		Expect(database.InsertTx(persisted)).Should(Succeed())
+		orphaned := txutil.RandomGoodTx(r)
+
+		Expect(v0.SetMapping(client, "persisted", persisted.Hash.String(), persisted.Hash, time.Hour)).Should(Succeed())
+		Expect(v0.SetMapping(client, "orphaned", orphaned.Hash.String(), orphaned.Hash, time.Hour)).Should(Succeed())
+		Expect(mr.TTL("orphaned")).Should(Equal(time.Hour))
+
+		// Nothing should be removed within the grace period.
+		removed, err := store.GC(time.Hour)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(removed).Should(Equal(0))
+
+		removed, err = store.GC(-time.Second)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(removed).Should(Equal(1))
+		Expect(mr.Exists("persisted")).Should(BeTrue())
+		Expect(mr.Exists("orphaned")).Should(BeFalse())
+		Expect(mr.Exists(v0.MappingIndexKey)).Should(BeFalse())
+	})
+
+	It("should count divergences while migrating mappings from redis to sql", func() {
+		mr, err := miniredis.Run()
+		Expect(err).ShouldNot(HaveOccurred())
+		defer mr.Close()
+		client := redis.NewClient(&redis.Options{
+			Addr: mr.Addr(),
+		})
+
+		sqlDB, err := sql.Open("sqlite3", "./mappings.db")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.Remove("./mappings.db")
+		database := db.New(sqlDB, 0, 1)
+		Expect(database.Init()).Should(Succeed())
+
+		migration := v0.NewMigratingMappings(logrus.New(), v0.NewRedisMappings(client, time.Hour), v0.NewSQLMappings(database, time.Hour))
+
+		// Mappings written before the migration are read from redis, and
+		// written to sql when they are read.
+		v1Hash := id.Hash{1}
+		Expect(v0.SetMapping(client, "old", v1Hash.String(), v1Hash, time.Hour)).Should(Succeed())
+		value, err := migration.Get("old")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal(v1Hash.String()))
+		value, err = database.CompatMapping("old")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal(v1Hash.String()))
+		value, err = migration.Get("old")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal(v1Hash.String()))
+
+		// Mappings written during the migration are written to both.
+		Expect(migration.Set("new", "value", id.Hash{})).Should(Succeed())
+		Expect(mr.Exists("new")).Should(BeTrue())
+		value, err = database.CompatMapping("new")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal("value"))
+		value, err = migration.Get("new")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal("value"))
+
+		// Mappings which differ are read from sql.
+		Expect(database.InsertCompatMapping("new", "other", id.Hash{}, time.Hour)).Should(Succeed())
+		value, err = migration.Get("new")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal("other"))
+
+		_, err = migration.Get("unknown")
+		Expect(err).Should(Equal(v0.ErrNotFound))
+
+		// Bulk reads are compared key by key, and leave out unknown keys.
+		values, err := migration.GetAll([]string{"old", "new", "unknown"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(values).Should(Equal(map[string]string{"old": v1Hash.String(), "new": "other"}))
+
+		Expect(migration.Counts()).Should(Equal(v0.MigrationCounts{Reads: 8, Missing: 1, Repaired: 1, Mismatched: 2}))
+	})
+
+	It("should migrate mappings from redis to sql", func() {
+		mr, err := miniredis.Run()
+		Expect(err).ShouldNot(HaveOccurred())
+		defer mr.Close()
+		client := redis.NewClient(&redis.Options{
+			Addr: mr.Addr(),
+		})
+
+		sqlDB, err := sql.Open("sqlite3", "./mappings.db")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.Remove("./mappings.db")
+		database := db.New(sqlDB, 0, 1)
+		Expect(database.Init()).Should(Succeed())
+
+		v1Hash := id.Hash{1}
+		Expect(v0.SetMapping(client, "expiring", v1Hash.String(), v1Hash, time.Hour)).Should(Succeed())
+		Expect(v0.SetMapping(client, "persistent", v1Hash.String(), v1Hash, 0)).Should(Succeed())
+		Expect(database.InsertCompatMapping("existing", "newer", v1Hash, time.Hour)).Should(Succeed())
+		Expect(v0.SetMapping(client, "existing", v1Hash.String(), v1Hash, time.Hour)).Should(Succeed())
+		Expect(client.Set("other", "not a hash", 0).Err()).Should(Succeed())
+
+		counts, err := v0.MigrateRedisMappings(client, database, 2)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(counts).Should(Equal(v0.MigrateCounts{Scanned: 3, Migrated: 2, Existing: 1}))
+
+		store := v0.NewSQLCompatStore(database, time.Hour)
+		for _, key := range []string{"expiring", "persistent"} {
+			value, err := database.CompatMapping(key)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).Should(Equal(v1Hash.String()))
+		}
+		value, err := database.CompatMapping("existing")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(value).Should(Equal("newer"))
+		_, err = database.CompatMapping("other")
+		Expect(err).Should(Equal(sql.ErrNoRows))
+
+		// Running the migration again does not change anything.
+		counts, err = v0.MigrateRedisMappings(client, database, 2)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(counts).Should(Equal(v0.MigrateCounts{Scanned: 3, Existing: 3}))
+
+		// The store no longer needs redis.
+		_, err = store.GC(time.Hour)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should not return expired mappings from sql", func() {
+		sqlDB, err := sql.Open("sqlite3", "./mappings.db")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.Remove("./mappings.db")
+		database := db.New(sqlDB, 0, 1)
+		Expect(database.Init()).Should(Succeed())
+
+		mappings := v0.NewSQLMappings(database, time.Nanosecond)
+		Expect(mappings.Set("expired", "value", id.Hash{})).Should(Succeed())
+		_, err = mappings.Get("expired")
+		Expect(err).Should(Equal(v0.ErrNotFound))
+
+		pruned, err := database.PruneCompatMappings()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(pruned).Should(Equal(int64(1)))
+	})
+
+	It("should marshal the byte fields of txs as hex", func() {
+		data := `{"hash":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","to":"BTC0Btc2Eth","in":[{"name":"phash","type":"b32","value":"AQIDBAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},{"name":"amount","type":"u256","value":"100"},{"name":"utxo","type":"ext_btcCompatUTXO","value":{"txHash":"AQIDAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","vOut":"0"}}]}`
+		var transaction v0.Tx
+		Expect(json.Unmarshal([]byte(data), &transaction)).Should(Succeed())
+
+		encoded, err := json.Marshal(v0.HexTx(transaction))
+		Expect(err).ShouldNot(HaveOccurred())
+		var decoded struct {
+			Hash string `json:"hash"`
+			In   []struct {
+				Name  string          `json:"name"`
+				Value json.RawMessage `json:"value"`
+			} `json:"in"`
+		}
+		Expect(json.Unmarshal(encoded, &decoded)).Should(Succeed())
+		Expect(decoded.Hash).Should(Equal("0000000000000000000000000000000000000000000000000000000000000000"))
+		Expect(string(decoded.In[0].Value)).Should(Equal(`"0102030400000000000000000000000000000000000000000000000000000000"`))
+		Expect(string(decoded.In[1].Value)).Should(Equal(`"100"`))
+
+		var utxo map[string]interface{}
+		Expect(json.Unmarshal(decoded.In[2].Value, &utxo)).Should(Succeed())
+		Expect(utxo["txHash"]).Should(Equal("0102030000000000000000000000000000000000000000000000000000000000"))
+		Expect(utxo["vOut"]).Should(Equal("0"))
+	})
+
+	It("should convert seeded v0 mints and burns of every legacy asset", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		for _, asset := range testutils.LegacyAssets {
+			chains := testutils.NewMockChainReader()
+			mint := testutils.MockParamSubmitTxV0Mint(chains, asset, testutils.V0MockSeed)
+			burn := testutils.MockParamSubmitTxV0Burn(chains, asset, testutils.V0MockSeed)
+			Expect(v0.IsShiftIn(mint.Tx.To)).Should(BeTrue())
+			Expect(v0.IsShiftIn(burn.Tx.To)).Should(BeFalse())
+			store, _, _, pubkey := init(mint, true)
+
+			v1Mint, err := v0.V1TxParamsFromTx(ctx, mint, chains, pubkey, store, multichain.NetworkTestnet)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(v1Mint.Tx.Selector).Should(Equal(tx.Selector(fmt.Sprintf("%v/toEthereum", asset))))
+			Expect(v1Mint.Tx.Input.Get("amount")).ShouldNot(BeNil())
+
+			v1Burn, err := v0.V1TxParamsFromTx(ctx, burn, chains, pubkey, store, multichain.NetworkTestnet)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(v1Burn.Tx.Selector).Should(Equal(tx.Selector(fmt.Sprintf("%v/fromEthereum", asset))))
+
+			// The burn is converted using the chain state of the reader, so it
+			// can be verified against the same state.
+			v1Burn.Tx.Version = tx.Version1
+			verifier := resolver.NewVerifier(map[multichain.Chain]bool{multichain.Ethereum: true}, chains.Bindings())
+			Expect(verifier.VerifyTx(ctx, v1Burn.Tx)).Should(Succeed())
+		}
+	})
+
+	It("should generate deterministic hashes for every legacy asset", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, _, _, pubkey := init(testutils.MockParamSubmitTxV0BTC(), false)
+
+		convert := func(seed int64, asset multichain.Asset, mint bool) (v0.B32, id.Hash) {
+			chains := testutils.NewMockChainReader()
+			params := testutils.MockParamSubmitTxV0Burn(chains, asset, seed)
+			if mint {
+				params = testutils.MockParamSubmitTxV0Mint(chains, asset, seed)
+			}
+			Expect(v0.ValidateV0Tx(params.Tx)).Should(Succeed())
+			v0Hash, v1Tx, err := v0.ConvertV0Tx(ctx, params.Tx, chains, pubkey, multichain.NetworkTestnet)
+			Expect(err).ShouldNot(HaveOccurred())
+			return v0Hash, v1Tx.Hash
+		}
+
+		for _, asset := range testutils.LegacyAssets {
+			for _, mint := range []bool{true, false} {
+				v0Hash, v1Hash := convert(testutils.V0MockSeed, asset, mint)
+				sameV0Hash, sameV1Hash := convert(testutils.V0MockSeed, asset, mint)
+				Expect(sameV0Hash).Should(Equal(v0Hash))
+				Expect(sameV1Hash).Should(Equal(v1Hash))
+
+				altV0Hash, altV1Hash := convert(testutils.V0MockSeedAlt, asset, mint)
+				Expect(altV0Hash).ShouldNot(Equal(v0Hash))
+				Expect(altV1Hash).ShouldNot(Equal(v1Hash))
+			}
+		}
+	})
+
+	It("should generate the same payloads as the fixed v0 mocks", func() {
+		for asset, fixed := range map[multichain.Asset]v0.ParamsSubmitTx{
+			multichain.BTC: testutils.MockParamSubmitTxV0BTC(),
+			multichain.ZEC: testutils.MockParamSubmitTxV0ZEC(),
+			multichain.BCH: testutils.MockParamSubmitTxV0BCH(),
+		} {
+			mint := testutils.MockParamSubmitTxV0Mint(testutils.NewMockChainReader(), asset, testutils.V0MockSeed)
+			Expect(mint.Tx.In.Get("p")).Should(Equal(fixed.Tx.In.Get("p")))
+			Expect(mint.Tx.In.Get("token")).Should(Equal(fixed.Tx.In.Get("token")))
+		}
+	})
 })
@@ -0,0 +1,112 @@
+package v0
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// HexTx is a Tx which marshals its hash, and the bytes values of its args, as
+// hex rather than base64.
+type HexTx Tx
+
+// MarshalJSON implements the json.Marshaler interface for the HexTx type.
+func (tx HexTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Hash    string  `json:"hash"`
+		To      Address `json:"to"`
+		In      hexArgs `json:"in"`
+		Autogen hexArgs `json:"autogen,omitempty"`
+		Out     hexArgs `json:"out,omitempty"`
+	}{
+		Hash:    hex.EncodeToString(tx.Hash[:]),
+		To:      tx.To,
+		In:      hexArgs(tx.In),
+		Autogen: hexArgs(tx.Autogen),
+		Out:     hexArgs(tx.Out),
+	})
+}
+
+// hexArgs marshals args like Args, with their bytes values encoded as hex.
+type hexArgs Args
+
+func (args hexArgs) MarshalJSON() ([]byte, error) {
+	type hexArg struct {
+		Name  string      `json:"name"`
+		Type  Type        `json:"type"`
+		Value interface{} `json:"value"`
+	}
+	encoded := make([]hexArg, len(args))
+	for i, arg := range args {
+		encoded[i] = hexArg{Name: arg.Name, Type: arg.Type, Value: hexValue(arg.Value)}
+	}
+	return json.Marshal(encoded)
+}
+
+// hexUTXO marshals a UTXO like ExtBtcCompatUTXO, with its bytes fields encoded
+// as hex.
+type hexUTXO struct {
+	TxHash       string `json:"txHash"`
+	VOut         U32    `json:"vOut"`
+	ScriptPubKey string `json:"scriptPubKey,omitempty"`
+	Amount       U256   `json:"amount,omitempty"`
+	GHash        string `json:"ghash,omitempty"`
+}
+
+func newHexUTXO(utxo ExtBtcCompatUTXO) hexUTXO {
+	return hexUTXO{
+		TxHash:       hex.EncodeToString(utxo.TxHash[:]),
+		VOut:         utxo.VOut,
+		ScriptPubKey: hex.EncodeToString(utxo.ScriptPubKey),
+		Amount:       utxo.Amount,
+		GHash:        hex.EncodeToString(utxo.GHash[:]),
+	}
+}
+
+// hexValue returns the value in a form which marshals its bytes as hex. Values
+// without bytes are returned as they are.
+func hexValue(value Value) interface{} {
+	switch value := value.(type) {
+	case B:
+		return hex.EncodeToString(value)
+	case B32:
+		return hex.EncodeToString(value[:])
+	case ExtBtcCompatUTXO:
+		return newHexUTXO(value)
+	case ExtBtcCompatUTXOs:
+		utxos := make([]hexUTXO, len(value))
+		for i, utxo := range value {
+			utxos[i] = newHexUTXO(utxo)
+		}
+		return utxos
+	case ExtEthCompatTx:
+		return struct {
+			TxHash string `json:"txHash"`
+		}{hex.EncodeToString(value.TxHash[:])}
+	case ExtEthCompatPayload:
+		return struct {
+			ABI   string `json:"abi"`
+			Value string `json:"value"`
+			Fn    string `json:"fn"`
+		}{hex.EncodeToString(value.ABI), hex.EncodeToString(value.Value), hex.EncodeToString(value.Fn)}
+	case List:
+		// Lists and records marshal as args, like their MarshalJSON methods.
+		args := make(hexArgs, len(value))
+		for i, elem := range value {
+			args[i] = Arg{Name: fmt.Sprintf("%d", i), Type: elem.Type(), Value: elem}
+		}
+		return args
+	case Record:
+		args := make(hexArgs, 0, len(value))
+		for name, field := range value {
+			args = append(args, Arg{Name: name, Type: field.Type(), Value: field})
+		}
+		sort.Slice(args, func(i, j int) bool {
+			return args[i].Name < args[j].Name
+		})
+		return args
+	default:
+		return value
+	}
+}
@@ -0,0 +1,308 @@
+package v0
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+	"github.com/sirupsen/logrus"
+)
+
+// Backends of the compat mappings.
+const (
+	BackendRedis = "redis"
+	BackendSQL   = "sql"
+
+	// BackendMigrating writes mappings to both Redis and SQL, and reads them
+	// from SQL with a fallback to Redis, while compat mappings are migrated
+	// from Redis to SQL.
+	BackendMigrating = "migrating"
+)
+
+// Mappings persists compat mappings, which map the keys of compat lookups,
+// such as v0 tx hashes, to the hashes of v1 txs.
+type Mappings interface {
+	// Set maps the key to the value. The value refers to the v1 tx with the
+	// given hash.
+	Set(key, value string, v1Hash id.Hash) error
+
+	// SetAll persists the mappings, in as few round trips as the backend
+	// allows.
+	SetAll(mappings []Mapping) error
+
+	// Get returns the value mapped to the key, or ErrNotFound.
+	Get(key string) (string, error)
+
+	// GetAll returns the values mapped to the keys, in as few round trips as
+	// the backend allows. Keys which are not mapped are left out.
+	GetAll(keys []string) (map[string]string, error)
+}
+
+// RedisMappings stores compat mappings in Redis, and records them in the
+// mapping index so that they can be garbage collected.
+type RedisMappings struct {
+	client redis.Cmdable
+	expiry time.Duration
+}
+
+// NewRedisMappings returns RedisMappings whose mappings expire after the given
+// duration.
+func NewRedisMappings(client redis.Cmdable, expiry time.Duration) RedisMappings {
+	return RedisMappings{client: client, expiry: expiry}
+}
+
+// Set implements the Mappings interface.
+func (mappings RedisMappings) Set(key, value string, v1Hash id.Hash) error {
+	return SetMapping(mappings.client, key, value, v1Hash, mappings.expiry)
+}
+
+// SetAll implements the Mappings interface. The mappings are written in a
+// single MULTI/EXEC transaction.
+func (mappings RedisMappings) SetAll(all []Mapping) error {
+	return SetMappings(mappings.client, all, mappings.expiry)
+}
+
+// Get implements the Mappings interface.
+func (mappings RedisMappings) Get(key string) (string, error) {
+	value, err := mappings.client.Get(key).Result()
+	if err == redis.Nil {
+		err = ErrNotFound
+	}
+	return value, err
+}
+
+// GetAll implements the Mappings interface. The keys are read with a single
+// MGET.
+func (mappings RedisMappings) GetAll(keys []string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	results, err := mappings.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if value, ok := result.(string); ok {
+			values[keys[i]] = value
+		}
+	}
+	return values, nil
+}
+
+// SQLMappings stores compat mappings in the database.
+type SQLMappings struct {
+	db     db.DB
+	expiry time.Duration
+}
+
+// NewSQLMappings returns SQLMappings whose mappings expire after the given
+// duration.
+func NewSQLMappings(db db.DB, expiry time.Duration) SQLMappings {
+	return SQLMappings{db: db, expiry: expiry}
+}
+
+// Set implements the Mappings interface.
+func (mappings SQLMappings) Set(key, value string, v1Hash id.Hash) error {
+	return mappings.db.InsertCompatMapping(key, value, v1Hash, mappings.expiry)
+}
+
+// SetAll implements the Mappings interface.
+func (mappings SQLMappings) SetAll(all []Mapping) error {
+	for _, mapping := range all {
+		if err := mappings.Set(mapping.Key, mapping.Value, mapping.V1Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get implements the Mappings interface.
+func (mappings SQLMappings) Get(key string) (string, error) {
+	value, err := mappings.db.CompatMapping(key)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	return value, err
+}
+
+// GetAll implements the Mappings interface.
+func (mappings SQLMappings) GetAll(keys []string) (map[string]string, error) {
+	return mappings.db.CompatMappings(keys)
+}
+
+// MigrationCounts are the counters of a migration between compat mapping
+// backends. The migration can be cut over once mappings are no longer missing
+// from, or different in, the new backend. The counters are kept in memory, so
+// each replica only counts the reads and writes it served itself.
+type MigrationCounts struct {
+	Reads       uint64 `json:"reads"`
+	Missing     uint64 `json:"missing"`
+	Repaired    uint64 `json:"repaired"`
+	Mismatched  uint64 `json:"mismatched"`
+	WriteErrors uint64 `json:"writeErrors"`
+}
+
+// MigratingMappings writes compat mappings to both the old and the new
+// backend, and reads them from the new backend with a fallback to the old.
+// Mappings which are only found in the old backend are written to the new one
+// when they are read, so that they are only looked up twice once. Every read is
+// compared against the old backend, and divergences are counted so that
+// operators can tell when the new backend can be used on its own. It
+// implements `http.Handler` to expose the counters as JSON.
+type MigratingMappings struct {
+	logger logrus.FieldLogger
+	from   Mappings
+	to     Mappings
+
+	mu     *sync.Mutex
+	counts MigrationCounts
+}
+
+// NewMigratingMappings returns MigratingMappings which migrate from the first
+// backend to the second.
+func NewMigratingMappings(logger logrus.FieldLogger, from, to Mappings) *MigratingMappings {
+	return &MigratingMappings{
+		logger: logger,
+		from:   from,
+		to:     to,
+		mu:     new(sync.Mutex),
+	}
+}
+
+// Set implements the Mappings interface. The old backend remains the source of
+// truth until the cutover, so only its errors are returned.
+func (mappings *MigratingMappings) Set(key, value string, v1Hash id.Hash) error {
+	if err := mappings.from.Set(key, value, v1Hash); err != nil {
+		return err
+	}
+	if err := mappings.to.Set(key, value, v1Hash); err != nil {
+		mappings.count(func(counts *MigrationCounts) { counts.WriteErrors++ })
+		mappings.logger.Warnf("[compat] cannot write mapping for %v to new backend: %v", key, err)
+	}
+	return nil
+}
+
+// SetAll implements the Mappings interface, like Set.
+func (mappings *MigratingMappings) SetAll(all []Mapping) error {
+	if err := mappings.from.SetAll(all); err != nil {
+		return err
+	}
+	if err := mappings.to.SetAll(all); err != nil {
+		mappings.count(func(counts *MigrationCounts) { counts.WriteErrors++ })
+		mappings.logger.Warnf("[compat] cannot write %v mappings to new backend: %v", len(all), err)
+	}
+	return nil
+}
+
+// Get implements the Mappings interface.
+func (mappings *MigratingMappings) Get(key string) (string, error) {
+	value, err := mappings.to.Get(key)
+	if err != nil && err != ErrNotFound {
+		mappings.logger.Warnf("[compat] cannot read mapping for %v from new backend: %v", key, err)
+	}
+	oldValue, oldErr := mappings.from.Get(key)
+	return mappings.compare(key, value, err, oldValue, oldErr)
+}
+
+// GetAll implements the Mappings interface. Each key is compared and repaired
+// as it is by Get.
+func (mappings *MigratingMappings) GetAll(keys []string) (map[string]string, error) {
+	values, newErr := mappings.to.GetAll(keys)
+	if newErr != nil {
+		mappings.logger.Warnf("[compat] cannot read %v mappings from new backend: %v", len(keys), newErr)
+	}
+	oldValues, err := mappings.from.GetAll(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(oldValues))
+	for _, key := range keys {
+		value, ok := values[key]
+		valueErr := newErr
+		if !ok && newErr == nil {
+			valueErr = ErrNotFound
+		}
+		oldValue, ok := oldValues[key]
+		var oldErr error
+		if !ok {
+			oldErr = ErrNotFound
+		}
+		if value, err := mappings.compare(key, value, valueErr, oldValue, oldErr); err == nil {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// compare counts whether the value read from the new backend is missing or
+// differs from the value read from the old backend, repairs the new backend
+// if the value is missing, and returns the value which should be used.
+func (mappings *MigratingMappings) compare(key, value string, err error, oldValue string, oldErr error) (string, error) {
+	mappings.count(func(counts *MigrationCounts) {
+		counts.Reads++
+		switch {
+		case oldErr != nil:
+		case err != nil:
+			counts.Missing++
+		case value != oldValue:
+			counts.Mismatched++
+		}
+	})
+	if err != nil {
+		if err == ErrNotFound && oldErr == nil {
+			mappings.repair(key, oldValue)
+		}
+		return oldValue, oldErr
+	}
+	if oldErr == nil && value != oldValue {
+		mappings.logger.Warnf("[compat] mapping for %v is %v in new backend but %v in old backend", key, value, oldValue)
+	}
+	return value, nil
+}
+
+// repair writes a mapping which was only found in the old backend to the new
+// backend. Values which are not v1 tx hashes are left for the migration, as the
+// new backend needs the hash of the v1 tx.
+func (mappings *MigratingMappings) repair(key, value string) {
+	v1Hash, ok := decodeMappedHash(value)
+	if !ok {
+		return
+	}
+	if err := mappings.to.Set(key, value, v1Hash); err != nil {
+		mappings.count(func(counts *MigrationCounts) { counts.WriteErrors++ })
+		mappings.logger.Warnf("[compat] cannot repair mapping for %v in new backend: %v", key, err)
+		return
+	}
+	mappings.count(func(counts *MigrationCounts) { counts.Repaired++ })
+}
+
+// Counts returns the counters of the migration.
+func (mappings *MigratingMappings) Counts() MigrationCounts {
+	mappings.mu.Lock()
+	defer mappings.mu.Unlock()
+	return mappings.counts
+}
+
+func (mappings *MigratingMappings) count(f func(*MigrationCounts)) {
+	mappings.mu.Lock()
+	defer mappings.mu.Unlock()
+	f(&mappings.counts)
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (mappings *MigratingMappings) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mappings.Counts())
+}
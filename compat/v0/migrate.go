@@ -0,0 +1,131 @@
+package v0
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+)
+
+// migrateSkipPrefixes are the prefixes of keys which are stored in Redis
+// alongside the compat mappings, but are not mappings themselves.
+var migrateSkipPrefixes = []string{"cacher_", "lightnode:"}
+
+// MigrateCounts are the counters of a migration of compat mappings from Redis
+// to the database.
+type MigrateCounts struct {
+	Scanned  int
+	Migrated int
+	Existing int
+}
+
+// MigrateRedisMappings copies the compat mappings stored in Redis into the
+// database, keeping the remaining expiry of each mapping. Mappings are found by
+// scanning Redis, as the mapping index only tracks recent mappings, and are
+// told apart from other keys by their values being v1 tx hashes. Mappings
+// which are already in the database were written more recently, so they are
+// left as they are, which makes the migration safe to run more than once.
+func MigrateRedisMappings(client redis.Cmdable, database db.DB, batchSize int64) (MigrateCounts, error) {
+	counts := MigrateCounts{}
+
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(cursor, "", batchSize).Result()
+		if err != nil {
+			return counts, err
+		}
+
+		// The values and expiries of a batch of keys are read in a single
+		// round trip.
+		pipe := client.Pipeline()
+		gets := map[string]*redis.StringCmd{}
+		ttls := map[string]*redis.DurationCmd{}
+		for _, key := range keys {
+			if skipMigration(key) {
+				continue
+			}
+			gets[key] = pipe.Get(key)
+			ttls[key] = pipe.TTL(key)
+		}
+		if len(gets) > 0 {
+			// Errors are checked for each command, as reading keys which
+			// are not strings fails.
+			pipe.Exec()
+		}
+
+		for key, get := range gets {
+			value, err := get.Result()
+			if err != nil {
+				// Keys of other types, and keys which have expired since
+				// the scan, are not mappings.
+				if err == redis.Nil || strings.HasPrefix(err.Error(), "WRONGTYPE") {
+					continue
+				}
+				return counts, err
+			}
+			v1Hash, ok := decodeMappedHash(value)
+			if !ok {
+				continue
+			}
+			counts.Scanned++
+
+			if _, err := database.CompatMapping(key); err == nil {
+				counts.Existing++
+				continue
+			} else if err != sql.ErrNoRows {
+				return counts, err
+			}
+
+			ttl, err := ttls[key].Result()
+			if err != nil {
+				return counts, err
+			}
+			switch {
+			case ttl == -2:
+				// The mapping expired after it was read.
+				continue
+			case ttl < 0:
+				// The mapping does not expire.
+				ttl = 0
+			}
+			if err := database.InsertCompatMapping(key, value, v1Hash, ttl); err != nil {
+				return counts, err
+			}
+			counts.Migrated++
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return counts, nil
+		}
+	}
+}
+
+// decodeMappedHash decodes the value of a compat mapping, which is a v1 tx
+// hash. It returns false if the value is not a hash.
+func decodeMappedHash(value string) (id.Hash, bool) {
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.StdEncoding} {
+		decoded, err := encoding.DecodeString(value)
+		if err == nil && len(decoded) == len(id.Hash{}) {
+			hash := id.Hash{}
+			copy(hash[:], decoded)
+			return hash, true
+		}
+	}
+	return id.Hash{}, false
+}
+
+func skipMigration(key string) bool {
+	if key == MappingIndexKey {
+		return true
+	}
+	for _, prefix := range migrateSkipPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
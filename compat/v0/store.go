@@ -1,20 +1,65 @@
 package v0
 
 import (
+	"context"
 	"database/sql"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v7"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
 	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
 )
 
-// ErrNotFound wraps redis errors to hide implementation details
-var ErrNotFound = errors.New("compatstore: not found")
+// ErrNotFound wraps redis errors to hide implementation details. It is of kind
+// `errors.ErrNotFound`.
+var ErrNotFound = lerrors.Wrap(lerrors.ErrNotFound, errors.New("compatstore: not found"))
+
+// MappingIndexKey is the key of the sorted set which records when each compat
+// mapping was written. Members are of the form "<v1 hash> <mapping key>".
+const MappingIndexKey = "compat_mappings"
+
+// Mapping maps the key of a compat lookup, such as a v0 tx hash, to a value
+// which refers to the v1 tx with the given hash.
+type Mapping struct {
+	Key    string
+	Value  string
+	V1Hash id.Hash
+}
+
+// SetMapping persists a compat mapping with the given expiry and records it in
+// the mapping index, so that it can be garbage collected if the v1 tx it
+// refers to never makes it into the database.
+func SetMapping(client redis.Cmdable, key, value string, v1Hash id.Hash, expiry time.Duration) error {
+	return SetMappings(client, []Mapping{{Key: key, Value: value, V1Hash: v1Hash}}, expiry)
+}
+
+// SetMappings persists compat mappings like SetMapping, in a single MULTI/EXEC
+// transaction, so that a tx is never left with only some of its mappings and
+// writing them only takes one round trip.
+func SetMappings(client redis.Cmdable, mappings []Mapping, expiry time.Duration) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	now := float64(time.Now().Unix())
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		for _, mapping := range mappings {
+			pipe.Set(mapping.Key, mapping.Value, expiry)
+			member := fmt.Sprintf("%v %v", mapping.V1Hash.String(), mapping.Key)
+			pipe.ZAdd(MappingIndexKey, &redis.Z{Score: now, Member: member})
+		}
+		return nil
+	})
+	return err
+}
 
 // CompatStore aims to abstract compat persistence mappings
 type CompatStore interface {
@@ -30,49 +75,158 @@ type CompatStore interface {
 }
 
 type Store struct {
-	db     db.DB         // db which stores all v1 transactions
-	client redis.Cmdable // client interacting the mapping between v0 and v1 txs
-	expiry time.Duration // expiry of the mapping entry, should be same as the db prune time.
+	db       db.DB         // db which stores all v1 transactions
+	client   redis.Cmdable // client used to garbage collect mappings stored in redis
+	mappings Mappings      // backend storing the mapping between v0 and v1 txs
+	expiry   time.Duration // expiry of the mapping entry, should be same as the db prune time.
 }
 
+// NewCompatStore returns a Store whose mappings are stored in Redis.
 func NewCompatStore(db db.DB, client redis.Cmdable, expiry time.Duration) Store {
 	return Store{
-		db:     db,
-		client: client,
-		expiry: expiry,
+		db:       db,
+		client:   client,
+		mappings: NewRedisMappings(client, expiry),
+		expiry:   expiry,
 	}
 }
 
+// NewSQLCompatStore returns a Store whose mappings are stored in the database,
+// so that they do not depend on Redis at all.
+func NewSQLCompatStore(db db.DB, expiry time.Duration) Store {
+	return Store{
+		db:       db,
+		mappings: NewSQLMappings(db, expiry),
+		expiry:   expiry,
+	}
+}
+
+// WithMappings returns the store with its mappings stored in the given
+// backend, such as while migrating them to the database.
+func (store Store) WithMappings(mappings Mappings) Store {
+	store.mappings = mappings
+	return store
+}
+
 func (store Store) PersistTxMappings(v0tx Tx, v1tx tx.Tx) error {
 	// persist v0 hash for later query-lookup
-	err := store.client.Set(v0tx.Hash.String(), v1tx.Hash.String(), store.expiry).Err()
-	if err != nil {
-		return err
-	}
+	v0HashMapping := Mapping{Key: v0tx.Hash.String(), Value: v1tx.Hash.String(), V1Hash: v1tx.Hash}
 
 	// We assume both v0 and v1 txs are valid.
+	var key string
 	if IsShiftIn(v0tx.To) {
 		// For mints, we also maps the utxo+vout to v1 hash for future lookup
 		// as we don't have the v0 hash at submission
 		utxo := v0tx.In.Get("utxo").Value.(ExtBtcCompatUTXO)
-		utxoKey := utxoLookupString(utxo)
-		return store.client.Set(utxoKey, v1tx.Hash.String(), store.expiry).Err()
+		key = utxoLookupString(utxo)
 	} else {
 		// For burns, we also maps the ref to v1 hash for future look up
 		// as we don't have the v0 hash at submission
 		selector := tx.Selector(fmt.Sprintf("%s/fromEthereum", v0tx.To[0:3]))
 		ref := v0tx.In.Get("ref").Value.(U64)
-		refKey := refLookupString(selector, ref)
-		return store.client.Set(refKey, v1tx.Hash.String(), store.expiry).Err()
+		key = refLookupString(selector, ref)
 	}
+	return store.mappings.SetAll([]Mapping{v0HashMapping, {Key: key, Value: v1tx.Hash.String(), V1Hash: v1tx.Hash}})
 }
 
-func (store Store) GetV1HashFromHash(v0hash B32) (id.Hash, error) {
-	hashS, err := store.client.Get(v0hash.String()).Result()
+// BackfillTxMappings persists the mappings for a v1 tx which was submitted as
+// a v0 tx, recomputing the v0 hash from the v1 tx. This restores v0 queries
+// for txs whose mappings were never written or have since expired. The
+// mappings are written with the expiry of the store, so backfills should use a
+// store without one. It returns false if the v0 hash is already mapped.
+func (store Store) BackfillTxMappings(v1tx tx.Tx) (bool, error) {
+	v0hash, mappings, err := v0Mappings(v1tx)
+	if err != nil {
+		return false, err
+	}
+	if _, err := store.GetV1HashFromHash(v0hash); !lerrors.Is(err, lerrors.ErrNotFound) {
+		return false, err
+	}
+	if err := store.mappings.SetAll(mappings); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BackfillTxsMappings is the bulk variant of BackfillTxMappings, which looks up
+// and writes the mappings of all of the txs at once. It returns the number of
+// txs whose mappings were written, and the errors of the txs whose mappings
+// could not be computed, which are skipped.
+func (store Store) BackfillTxsMappings(v1txs []tx.Tx) (int, map[id.Hash]error, error) {
+	failed := map[id.Hash]error{}
+	v0hashes := make([]string, 0, len(v1txs))
+	txsMappings := make([][]Mapping, 0, len(v1txs))
+	for _, v1tx := range v1txs {
+		v0hash, txMappings, err := v0Mappings(v1tx)
+		if err != nil {
+			failed[v1tx.Hash] = err
+			continue
+		}
+		v0hashes = append(v0hashes, v0hash.String())
+		txsMappings = append(txsMappings, txMappings)
+	}
+
+	mapped, err := store.mappings.GetAll(v0hashes)
 	if err != nil {
-		if err == redis.Nil {
-			err = ErrNotFound
+		return 0, failed, err
+	}
+	mappings := make([]Mapping, 0, 2*len(txsMappings))
+	written := 0
+	for i, v0hash := range v0hashes {
+		if _, ok := mapped[v0hash]; ok {
+			continue
+		}
+		mappings = append(mappings, txsMappings[i]...)
+		written++
+	}
+	if err := store.mappings.SetAll(mappings); err != nil {
+		return 0, failed, err
+	}
+	return written, failed, nil
+}
+
+// v0Mappings recomputes the v0 hash of a v1 tx which was submitted as a v0 tx,
+// and returns it with the mappings which make the tx queryable by v0 clients.
+func v0Mappings(v1tx tx.Tx) (B32, []Mapping, error) {
+	var v0hash B32
+	var key string
+	if v1tx.Selector.IsBurn() || v1tx.Selector.IsRelease() {
+		nonce, ok := v1tx.Input.Get("nonce").(pack.Bytes32)
+		if !ok {
+			return B32{}, nil, fmt.Errorf("missing nonce")
 		}
+		ref := pack.NewU256(nonce)
+		v0hash = BurnTxHash(v1tx.Selector, ref)
+		key = refLookupString(v1tx.Selector, U64{Int: ref.Int()})
+	} else {
+		ghash, ok := v1tx.Input.Get("ghash").(pack.Bytes32)
+		if !ok {
+			return B32{}, nil, fmt.Errorf("missing ghash")
+		}
+		txid, ok := v1tx.Input.Get("txid").(pack.Bytes)
+		if !ok {
+			return B32{}, nil, fmt.Errorf("missing txid")
+		}
+		txindex, ok := v1tx.Input.Get("txindex").(pack.U32)
+		if !ok {
+			return B32{}, nil, fmt.Errorf("missing txindex")
+		}
+		utxo, err := utxoFromV1Outpoint(txid, txindex)
+		if err != nil {
+			return B32{}, nil, fmt.Errorf("invalid outpoint: %v", err)
+		}
+		v0hash = MintTxHash(v1tx.Selector, ghash, txid, txindex)
+		key = utxoLookupString(utxo)
+	}
+	return v0hash, []Mapping{
+		{Key: v0hash.String(), Value: v1tx.Hash.String(), V1Hash: v1tx.Hash},
+		{Key: key, Value: v1tx.Hash.String(), V1Hash: v1tx.Hash},
+	}, nil
+}
+
+func (store Store) GetV1HashFromHash(v0hash B32) (id.Hash, error) {
+	hashS, err := store.mappings.Get(v0hash.String())
+	if err != nil {
 		return id.Hash{}, err
 	}
 
@@ -105,28 +259,92 @@ func (store Store) GetV1TxFromTx(transaction Tx) (tx.Tx, error) {
 }
 
 func (store Store) getV1TxHashFromUTXO(utxo ExtBtcCompatUTXO) (id.Hash, error) {
-	hashS, err := store.client.Get(utxoLookupString(utxo)).Result()
+	hashS, err := store.mappings.Get(utxoLookupString(utxo))
 	if err != nil {
-		if err == redis.Nil {
-			err = ErrNotFound
-		}
 		return id.Hash{}, err
 	}
 	return store.decodeHashString(hashS)
 }
 
 func (store Store) getV1TxHashFromRef(selector tx.Selector, ref U64) (id.Hash, error) {
-	key := refLookupString(selector, ref)
-	hashS, err := store.client.Get(key).Result()
+	hashS, err := store.mappings.Get(refLookupString(selector, ref))
 	if err != nil {
-		if err == redis.Nil {
-			err = ErrNotFound
-		}
 		return id.Hash{}, err
 	}
 	return store.decodeHashString(hashS)
 }
 
+// GC removes mappings in Redis which were written more than `grace` ago and
+// whose v1 tx does not exist in the database, as well as expired mappings in
+// the database. It returns the number of mappings removed.
+func (store Store) GC(grace time.Duration) (int, error) {
+	pruned, err := store.db.PruneCompatMappings()
+	if err != nil {
+		return 0, err
+	}
+	if store.client == nil {
+		return int(pruned), nil
+	}
+	removed, err := store.gcRedis(grace)
+	return int(pruned) + removed, err
+}
+
+func (store Store) gcRedis(grace time.Duration) (int, error) {
+	max := strconv.FormatInt(time.Now().Add(-grace).Unix(), 10)
+	members, err := store.client.ZRangeByScore(MappingIndexKey, &redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		parts := strings.SplitN(member, " ", 2)
+		if len(parts) == 2 {
+			hash, err := store.decodeHashString(parts[0])
+			if err == nil {
+				_, err = store.db.TxStatus(hash)
+				if err == sql.ErrNoRows {
+					if err := store.client.Del(parts[1]).Err(); err != nil {
+						return removed, err
+					}
+					removed++
+				} else if err != nil {
+					return removed, err
+				}
+			}
+		}
+
+		// Mappings for txs that exist in the database are left to expire with
+		// their TTL, so we can stop tracking them either way.
+		if err := store.client.ZRem(MappingIndexKey, member).Err(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// RunGC periodically garbage collects orphaned mappings until the context is
+// canceled.
+func (store Store) RunGC(ctx context.Context, logger logrus.FieldLogger, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := store.GC(grace)
+		if err != nil {
+			logger.Errorf("[compat] failed to garbage collect mappings: %v", err)
+		} else if removed > 0 {
+			logger.Infof("[compat] removed %v orphaned mappings", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (store Store) decodeHashString(s string) (id.Hash, error) {
 	hash := id.Hash{}
 	hashBytes, err1 := base64.RawURLEncoding.DecodeString(s)
@@ -0,0 +1,79 @@
+package v0
+
+import (
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/api/address"
+	"github.com/sirupsen/logrus"
+)
+
+// TokenCache wraps bindings with a read-through cache for token address
+// lookups. Converting v1 txs into v0 txs needs the token address of the
+// asset, which would otherwise require a call to the host chain on every
+// query. All other bindings are passed through as they are.
+type TokenCache struct {
+	binding.Bindings
+
+	ttl     time.Duration
+	mu      *sync.RWMutex
+	entries map[tokenKey]tokenEntry
+}
+
+type tokenKey struct {
+	chain multichain.Chain
+	asset multichain.Asset
+}
+
+type tokenEntry struct {
+	addr    address.RawAddress
+	expires time.Time
+}
+
+// NewTokenCache returns bindings which cache token addresses for the given
+// duration.
+func NewTokenCache(bindings binding.Bindings, ttl time.Duration) *TokenCache {
+	return &TokenCache{
+		Bindings: bindings,
+		ttl:      ttl,
+		mu:       new(sync.RWMutex),
+		entries:  map[tokenKey]tokenEntry{},
+	}
+}
+
+// TokenAddressFromAsset returns the cached token address of the asset on the
+// given chain, fetching it from the underlying bindings if it is missing or
+// has expired. Errors are not cached.
+func (cache *TokenCache) TokenAddressFromAsset(chain multichain.Chain, asset multichain.Asset) (address.RawAddress, error) {
+	key := tokenKey{chain: chain, asset: asset}
+
+	cache.mu.RLock()
+	entry, ok := cache.entries[key]
+	cache.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addr, nil
+	}
+
+	addr, err := cache.Bindings.TokenAddressFromAsset(chain, asset)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	cache.entries[key] = tokenEntry{addr: addr, expires: time.Now().Add(cache.ttl)}
+	cache.mu.Unlock()
+	return addr, nil
+}
+
+// Warm fetches the token addresses of the given assets on the chain, so that
+// the first queries for them do not have to wait on the host chain. Assets
+// which fail to resolve are logged and left to be fetched on demand.
+func (cache *TokenCache) Warm(logger logrus.FieldLogger, chain multichain.Chain, assets []multichain.Asset) {
+	for _, asset := range assets {
+		if _, err := cache.TokenAddressFromAsset(chain, asset); err != nil {
+			logger.Warnf("[compat] cannot pre-fetch %v token address on %v: %v", asset, chain, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package v0_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/renproject/darknode/binding"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/api/address"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Token cache", func() {
+	init := func(ttl time.Duration) (*v0.TokenCache, *int) {
+		calls := new(int)
+		bindings := &binding.Callbacks{
+			HandleTokenAddressFromAsset: func(chain multichain.Chain, asset multichain.Asset) (address.RawAddress, error) {
+				*calls++
+				if asset == multichain.LUNA {
+					return nil, errors.New("no token")
+				}
+				return address.RawAddress(asset), nil
+			},
+		}
+		return v0.NewTokenCache(bindings, ttl), calls
+	}
+
+	It("should only fetch token addresses once until they expire", func() {
+		cache, calls := init(time.Hour)
+		for i := 0; i < 3; i++ {
+			addr, err := cache.TokenAddressFromAsset(multichain.Ethereum, multichain.BTC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr).To(Equal(address.RawAddress(multichain.BTC)))
+		}
+		Expect(*calls).To(Equal(1))
+
+		expired, calls := init(0)
+		for i := 0; i < 3; i++ {
+			_, err := expired.TokenAddressFromAsset(multichain.Ethereum, multichain.BTC)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(*calls).To(Equal(3))
+	})
+
+	It("should pre-fetch token addresses without caching errors", func() {
+		cache, calls := init(time.Hour)
+		cache.Warm(logrus.New(), multichain.Ethereum, []multichain.Asset{multichain.BTC, multichain.ZEC, multichain.LUNA})
+		Expect(*calls).To(Equal(3))
+
+		_, err := cache.TokenAddressFromAsset(multichain.Ethereum, multichain.ZEC)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cache.TokenAddressFromAsset(multichain.Ethereum, multichain.LUNA)
+		Expect(err).To(HaveOccurred())
+		Expect(*calls).To(Equal(4))
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -31,7 +32,7 @@ var _ = Describe("Compat V0", func() {
 		client := redis.NewClient(&redis.Options{
 			Addr: mr.Addr(),
 		})
-		return v1.NewCompatStore(client)
+		return v1.NewCompatStore(client, time.Hour)
 	}
 
 	It("should convert a QueryBlockState response into a QueryState response", func() {
@@ -3,11 +3,13 @@ package v1
 import (
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v7"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
+	v0 "github.com/renproject/lightnode/compat/v0"
 	"github.com/renproject/pack"
 )
 
@@ -17,15 +19,24 @@ type GpubkeyCompatStore interface {
 }
 
 type Store struct {
-	client redis.Cmdable
+	mappings v0.Mappings
 }
 
-func NewCompatStore(client redis.Cmdable) *Store {
+// NewCompatStore returns a Store whose mappings are stored in Redis and expire
+// after the given duration, which should be the same as the db prune time.
+func NewCompatStore(client redis.Cmdable, expiry time.Duration) *Store {
 	return &Store{
-		client: client,
+		mappings: v0.NewRedisMappings(client, expiry),
 	}
 }
 
+// WithMappings stores the mappings of the store in the given backend, such as
+// while migrating them to the database.
+func (store *Store) WithMappings(mappings v0.Mappings) *Store {
+	store.mappings = mappings
+	return store
+}
+
 func (store *Store) RemoveGpubkey(transaction tx.Tx) (tx.Tx, error) {
 	var input engine.LockMintBurnReleaseInput
 	if err := pack.Decode(&input, transaction.Input); err != nil {
@@ -40,12 +51,12 @@ func (store *Store) RemoveGpubkey(transaction tx.Tx) (tx.Tx, error) {
 	if err != nil {
 		return tx.Tx{}, err
 	}
-	err = store.client.Set(transaction.Hash.String(), newTx.Hash.String(), 0).Err()
+	err = store.mappings.Set(transaction.Hash.String(), newTx.Hash.String(), newTx.Hash)
 	return newTx, err
 }
 
 func (store *Store) UpdatedHash(hash id.Hash) (id.Hash, error) {
-	hashStr, err := store.client.Get(hash.String()).Result()
+	hashStr, err := store.mappings.Get(hash.String())
 	if err != nil {
 		return id.Hash{}, err
 	}
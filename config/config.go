@@ -0,0 +1,95 @@
+// Package config parses the values used to configure the Lightnode, so that
+// every option accepts the same formats and reports invalid values in the same
+// way, rather than silently falling back to zero.
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Size suffixes which can be used by sizes. Decimal and binary units are both
+// supported, so that "10MB" is 10,000,000 bytes and "10MiB" is 10,485,760.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier uint64
+}{
+	// Longer suffixes are checked first, as "B" is a suffix of all of them.
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseDuration parses a non-negative duration such as "30s" or "1h30m". For
+// backwards compatibility, a plain integer is a number of seconds.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("invalid duration %q: must not be negative", value)
+		}
+		if seconds > math.MaxInt64/int64(time.Second) {
+			return 0, fmt.Errorf("invalid duration %q: too large", value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: expected a duration such as \"30s\" or a number of seconds", value)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q: must not be negative", value)
+	}
+	return duration, nil
+}
+
+// ParseSize parses a non-negative number of bytes such as "512", "64KiB" or
+// "10MB".
+func ParseSize(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	number, multiplier := value, uint64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(value), strings.ToUpper(unit.suffix)) {
+			number, multiplier = strings.TrimSpace(value[:len(value)-len(unit.suffix)]), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: expected a number of bytes such as \"512\" or \"10MB\"", value)
+	}
+	if size > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("invalid size %q: too large", value)
+	}
+	return size * multiplier, nil
+}
+
+// ParseCount parses a non-negative number of items, such as a number of
+// blocks or requests.
+func ParseCount(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q: expected a whole number", value)
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("invalid count %q: must not be negative", value)
+	}
+	return count, nil
+}
+
+// ParseBool parses a boolean such as "true", "false", "1" or "0".
+func ParseBool(value string) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean %q: expected true or false", value)
+	}
+	return b, nil
+}
@@ -0,0 +1,87 @@
+package config_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/config"
+)
+
+var _ = Describe("Config", func() {
+	Context("when parsing durations", func() {
+		It("should accept durations and numbers of seconds", func() {
+			for value, expected := range map[string]time.Duration{
+				"30s":    30 * time.Second,
+				"1h30m":  90 * time.Minute,
+				"500ms":  500 * time.Millisecond,
+				"15":     15 * time.Second,
+				" 0 ":    0,
+				"0s":     0,
+				"720h0m": 30 * 24 * time.Hour,
+			} {
+				duration, err := ParseDuration(value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(duration).To(Equal(expected))
+			}
+		})
+
+		It("should reject invalid or negative durations", func() {
+			for _, value := range []string{"", "soon", "30 seconds", "-1", "-5s", "1.5"} {
+				_, err := ParseDuration(value)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("invalid duration"))
+			}
+		})
+	})
+
+	Context("when parsing sizes", func() {
+		It("should accept numbers of bytes with units", func() {
+			for value, expected := range map[string]uint64{
+				"512":    512,
+				"512B":   512,
+				"64KiB":  64 << 10,
+				"10MB":   10 * 1000 * 1000,
+				"10 mib": 10 << 20,
+				"1GB":    1000 * 1000 * 1000,
+			} {
+				size, err := ParseSize(value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(size).To(Equal(expected))
+			}
+		})
+
+		It("should reject invalid sizes", func() {
+			for _, value := range []string{"", "MB", "-1MB", "1.5MB", "10TB", "18446744073709551615KB"} {
+				_, err := ParseSize(value)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("invalid size"))
+			}
+		})
+	})
+
+	Context("when parsing counts", func() {
+		It("should only accept whole numbers", func() {
+			count, err := ParseCount("100")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(100))
+
+			for _, value := range []string{"", "ten", "-1", "1.5", "10MB"} {
+				_, err := ParseCount(value)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("invalid count"))
+			}
+		})
+	})
+
+	Context("when parsing booleans", func() {
+		It("should reject values which are not booleans", func() {
+			b, err := ParseBool("true")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b).To(BeTrue())
+
+			_, err = ParseBool("yes")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -6,20 +6,26 @@ import (
 	"fmt"
 	"math/rand"
 	"net/url"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
 	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
 	"github.com/renproject/lightnode/http"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
 	"github.com/renproject/phi"
 )
 
+// releaseBatchSize is the number of burns whose releases are looked up each
+// time the confirmer polls.
+const releaseBatchSize = 100
+
 // Confirmer handles requests that have been validated. It checks if requests
 // have reached sufficient confirmations and stores those that have not to be
 // checked later.
@@ -27,7 +33,11 @@ type Confirmer struct {
 	options    Options
 	dispatcher phi.Sender
 	database   db.DB
-	bindings   binding.Bindings
+
+	// The bindings are shared by copies of the confirmer, so that they can be
+	// replaced while it is running.
+	mu       *sync.RWMutex
+	bindings *binding.Bindings
 }
 
 // New returns a new Confirmer.
@@ -36,36 +46,56 @@ func New(options Options, dispatcher phi.Sender, db db.DB, bindings binding.Bind
 		options:    options,
 		dispatcher: dispatcher,
 		database:   db,
-		bindings:   bindings,
+		mu:         new(sync.RWMutex),
+		bindings:   &bindings,
 	}
 }
 
+// SetBindings replaces the bindings with which confirmations are checked, such
+// as when a host chain is added while the Lightnode is running.
+func (confirmer Confirmer) SetBindings(bindings binding.Bindings) {
+	confirmer.mu.Lock()
+	defer confirmer.mu.Unlock()
+
+	*confirmer.bindings = bindings
+}
+
+func (confirmer Confirmer) currentBindings() binding.Bindings {
+	confirmer.mu.RLock()
+	defer confirmer.mu.RUnlock()
+
+	return *confirmer.bindings
+}
+
 // Run starts running the confirmer in the background which periodically checks
 // confirmations for pending transactions and prunes old transactions.
 func (confirmer *Confirmer) Run(ctx context.Context) {
 	phi.ParBegin(func() {
-		ticker := time.NewTicker(confirmer.options.PollInterval)
+		ticker := confirmer.options.Clock.NewTicker(confirmer.options.PollInterval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				confirmer.checkPendingTxs(ctx)
+				confirmer.recordReleases(ctx)
 			}
 		}
 	}, func() {
-		ticker := time.NewTicker(time.Hour)
+		ticker := confirmer.options.Clock.NewTicker(time.Hour)
 		defer ticker.Stop()
 
 		confirmer.prune()
+		confirmer.invalidateGateways(ctx)
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				confirmer.prune()
+				confirmer.invalidateGateways(ctx)
 			}
 		}
 	})
@@ -80,21 +110,29 @@ func (confirmer *Confirmer) checkPendingTxs(parent context.Context) {
 		<-ctx.Done()
 	}()
 
-	txs, err := confirmer.database.PendingTxs(72 * time.Hour)
+	txs, err := confirmer.database.PendingTxs(confirmer.options.PendingWindow)
 	if err != nil {
 		confirmer.options.Logger.Errorf("[confirmer] failed to read pending txs from database: %v", err)
 		return
 	}
 
 	phi.ParForAll(txs, func(i int) {
+		// Skip the remaining txs once the confirmer is stopped or has run out
+		// of time, rather than making calls which are bound to fail.
+		if ctx.Err() != nil {
+			return
+		}
+
 		tx := txs[i]
+		callCtx, callCancel := context.WithTimeout(ctx, confirmer.options.CallTimeout)
 		var confirmed bool
 		switch {
 		case tx.Selector.IsLock():
-			confirmed = confirmer.lockTxConfirmed(ctx, tx)
+			confirmed = confirmer.lockTxConfirmed(callCtx, tx)
 		case tx.Selector.IsBurn():
-			confirmed = confirmer.burnTxConfirmed(ctx, tx)
+			confirmed = confirmer.burnTxConfirmed(callCtx, tx)
 		}
+		callCancel()
 
 		if confirmed {
 			confirmer.options.Logger.Infof("tx=%v has reached sufficient confirmations", tx.Hash.String())
@@ -122,9 +160,7 @@ func (confirmer *Confirmer) confirm(ctx context.Context, transaction tx.Tx) {
 		case <-ctx.Done():
 			return
 		case response := <-req.Responder:
-			if response.Error == nil ||
-				strings.Contains(response.Error.Message, "status=done") ||
-				strings.Contains(response.Error.Message, "status = done") {
+			if response.Error == nil || lerrors.AlreadyDone(response.Error) {
 				confirmer.options.Logger.Infof("✅ successfully submitted tx=%v to darknodes", transaction.Hash.String())
 			} else {
 				confirmer.options.Logger.Errorf("[confirmer] getting error back when submitting tx=%v: [%v] %v", transaction.Hash.String(), response.Error.Code, response.Error.Message)
@@ -134,10 +170,93 @@ func (confirmer *Confirmer) confirm(ctx context.Context, transaction tx.Tx) {
 			if err := confirmer.database.UpdateStatus(transaction.Hash, db.TxStatusConfirmed); err != nil {
 				confirmer.options.Logger.Errorf("[confirmer] cannot update transaction status: %v", err)
 			}
+			confirmer.recordDeposit(transaction)
 		}
 	}()
 }
 
+// recordReleases queries the Darknodes for burns which have been submitted but
+// whose release has not been recorded, and records the txid of the release of
+// each burn which is done, so that the burn can be looked up by it.
+func (confirmer *Confirmer) recordReleases(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, confirmer.options.PollInterval)
+	defer cancel()
+
+	burns, err := confirmer.database.UnreleasedBurns(confirmer.options.PendingWindow, releaseBatchSize)
+	if err != nil {
+		confirmer.options.Logger.Errorf("[confirmer] failed to read unreleased burns from database: %v", err)
+		return
+	}
+
+	phi.ParForAll(burns, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		callCtx, callCancel := context.WithTimeout(ctx, confirmer.options.CallTimeout)
+		defer callCancel()
+		txid, err := confirmer.releaseTxid(callCtx, burns[i].Hash)
+		if err != nil {
+			confirmer.options.Logger.Warnf("[confirmer] cannot query release of tx=%v: %v", burns[i].Hash.String(), err)
+			return
+		}
+		if len(txid) == 0 {
+			return
+		}
+		if err := confirmer.database.InsertDestTxid(burns[i].Hash, txid); err != nil {
+			confirmer.options.Logger.Errorf("[confirmer] cannot record release of tx=%v: %v", burns[i].Hash.String(), err)
+		}
+	})
+}
+
+// releaseTxid returns the txid of the release of the burn with the given hash,
+// or nil if the burn is not done.
+func (confirmer *Confirmer) releaseTxid(ctx context.Context, hash id.Hash) (pack.Bytes, error) {
+	req := http.NewRequestWithResponder(ctx, rand.Int63(), jsonrpc.MethodQueryTx, jsonrpc.ParamsQueryTx{TxHash: hash}, url.Values{})
+	if ok := confirmer.dispatcher.Send(req); !ok {
+		return nil, fmt.Errorf("too much back pressure")
+	}
+
+	var response jsonrpc.Response
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case response = <-req.Responder:
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+	}
+
+	resp, err := http.DecodeQueryTxResult(response.Result)
+	if err != nil {
+		return nil, err
+	}
+	if resp.TxStatus != tx.StatusDone {
+		return nil, nil
+	}
+	txid, _ := resp.Tx.Output.Get("txid").(pack.Bytes)
+	return txid, nil
+}
+
+// recordDeposit adds a confirmed lock transaction to the usage of the gateway
+// it was deposited to.
+func (confirmer *Confirmer) recordDeposit(transaction tx.Tx) {
+	if !transaction.Selector.IsLock() {
+		return
+	}
+	ghash, ok := transaction.Input.Get("ghash").(pack.Bytes32)
+	if !ok {
+		return
+	}
+	amount, ok := transaction.Input.Get("amount").(pack.U256)
+	if !ok {
+		return
+	}
+	if err := confirmer.database.InsertGatewayDeposit(transaction.Hash, ghash, amount); err != nil {
+		confirmer.options.Logger.Errorf("[confirmer] cannot record deposit for tx=%v: %v", transaction.Hash.String(), err)
+	}
+}
+
 // lockTxConfirmed checks if a given lock transaction has received sufficient
 // confirmations.
 func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.Tx) bool {
@@ -149,12 +268,12 @@ func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.
 			confirmer.options.Logger.Errorf("[confirmer] failed to decode input for tx=%v: %v", transaction.Hash.String(), err)
 			return false
 		}
-		_, err := confirmer.bindings.UTXOLockInfo(ctx, lockChain, transaction.Selector.Asset(), multichain.UTXOutpoint{
+		_, err := confirmer.currentBindings().UTXOLockInfo(ctx, lockChain, transaction.Selector.Asset(), multichain.UTXOutpoint{
 			Hash:  input.Txid,
 			Index: input.Txindex,
 		})
-		if err != nil {
-			if !strings.Contains(err.Error(), "insufficient confirmations") {
+		if err = lerrors.FromChain(err); err != nil {
+			if !lerrors.Is(err, lerrors.ErrInsufficientConfirmations) {
 				confirmer.options.Logger.Errorf("[confirmer] cannot get output for utxo tx=%v (%v): %v", input.Txid.String(), transaction.Selector.String(), err)
 			} else {
 				confirmer.options.Logger.Warnf("[confirmer] cannot get output for utxo tx=%v (%v): %v", input.Txid.String(), transaction.Selector.String(), err)
@@ -163,11 +282,12 @@ func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.
 			// If the UTXO has already been spent, that means the transaction
 			// has already been processed by RenVM and it can be marked as
 			// complete.
-			if strings.Contains(err.Error(), "result is nil") {
+			if lerrors.Is(err, lerrors.ErrNotFound) {
 				if err := confirmer.database.UpdateStatus(transaction.Hash, db.TxStatusConfirmed); err != nil {
 					confirmer.options.Logger.Errorf("[confirmer] updating status for tx=%v: %v", transaction.Hash.String(), err)
 					return false
 				}
+				confirmer.recordDeposit(transaction)
 			}
 
 			return false
@@ -178,9 +298,12 @@ func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.
 			confirmer.options.Logger.Errorf("[confirmer] failed to decode input for tx=%v: %v", transaction.Hash.String(), err)
 			return false
 		}
-		_, err := confirmer.bindings.AccountLockInfo(ctx, lockChain, transaction.Selector.Asset(), input.Txid)
-		if err != nil {
-			if !strings.Contains(err.Error(), "insufficient confirmations") {
+		if !confirmer.finalized(ctx, lockChain, transaction, input.Txid) {
+			return false
+		}
+		_, err := confirmer.currentBindings().AccountLockInfo(ctx, lockChain, transaction.Selector.Asset(), input.Txid)
+		if err = lerrors.FromChain(err); err != nil {
+			if !lerrors.Is(err, lerrors.ErrInsufficientConfirmations) {
 				confirmer.options.Logger.Errorf("[confirmer] cannot get output for account tx=%v (%v): %v", input.Txid.String(), transaction.Selector.String(), err)
 			} else {
 				confirmer.options.Logger.Warnf("[confirmer] cannot get output for account tx=%v (%v): %v", input.Txid.String(), transaction.Selector.String(), err)
@@ -203,9 +326,15 @@ func (confirmer *Confirmer) burnTxConfirmed(ctx context.Context, transaction tx.
 		return false
 	}
 
-	_, _, _, err := confirmer.bindings.AccountBurnInfo(ctx, burnChain, transaction.Selector.Asset(), nonce)
-	if err != nil {
-		if !strings.Contains(err.Error(), "insufficient confirmations") {
+	if txid, ok := transaction.Input.Get("txid").(pack.Bytes); ok {
+		if !confirmer.finalized(ctx, burnChain, transaction, txid) {
+			return false
+		}
+	}
+
+	_, _, _, err := confirmer.currentBindings().AccountBurnInfo(ctx, burnChain, transaction.Selector.Asset(), nonce)
+	if err = lerrors.FromChain(err); err != nil {
+		if !lerrors.Is(err, lerrors.ErrInsufficientConfirmations) {
 			confirmer.options.Logger.Errorf("[confirmer] cannot get burn info for tx=%v (%v): %v", transaction.Hash.String(), transaction.Selector.String(), err)
 		} else {
 			confirmer.options.Logger.Warnf("[confirmer] cannot get burn info for tx=%v (%v): %v", transaction.Hash.String(), transaction.Selector.String(), err)
@@ -215,11 +344,136 @@ func (confirmer *Confirmer) burnTxConfirmed(ctx context.Context, transaction tx.
 	return true
 }
 
-// prune removes any expired transactions from the database.
+// finalized returns false if the chain supports finality tags and the given
+// host chain transaction has not yet been finalised. Chains without a
+// finality checker rely on the confirmations enforced by the bindings.
+func (confirmer *Confirmer) finalized(ctx context.Context, chain multichain.Chain, transaction tx.Tx, txid pack.Bytes) bool {
+	checker, ok := confirmer.options.FinalityCheckers[chain]
+	if !ok {
+		return true
+	}
+	finalized, err := checker.TxFinalized(ctx, txid)
+	if err != nil {
+		confirmer.options.Logger.Warnf("[confirmer] cannot check finality for tx=%v (%v): %v", transaction.Hash.String(), transaction.Selector.String(), err)
+		return false
+	}
+	return finalized
+}
+
+// prune archives any expired transactions and purges transactions which have
+// been archived for longer than the retention period.
 func (confirmer *Confirmer) prune() {
-	if err := confirmer.database.Prune(confirmer.options.Expiry); err != nil {
+	report, err := confirmer.Prune(confirmer.options.PruneDryRun)
+	if err != nil {
 		confirmer.options.Logger.Errorf("[confirmer] cannot prune database: %v", err)
+		return
+	}
+	if report.DryRun {
+		confirmer.options.Logger.Infof("[confirmer] prune dry run: would prune done=%v unconfirmed=%v gateways=%v burnEvents=%v clients=%v", report.Done, report.Unconfirmed, report.Gateways, report.BurnEvents, report.Clients)
+		return
+	}
+	if err := confirmer.database.PurgeArchive(confirmer.options.Retention); err != nil {
+		confirmer.options.Logger.Errorf("[confirmer] cannot purge archive: %v", err)
+	}
+}
+
+// invalidateGateways records the shard public keys currently used by RenVM,
+// and invalidates the gateways of shards which have not been used for longer
+// than the grace period, so that users are not told to deposit to addresses
+// which RenVM can no longer sign for.
+func (confirmer *Confirmer) invalidateGateways(parent context.Context) {
+	if confirmer.options.GatewayGracePeriod <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(parent, confirmer.options.CallTimeout)
+	defer cancel()
+	pubKeys, err := confirmer.shardPubKeys(ctx)
+	if err != nil {
+		confirmer.options.Logger.Errorf("[confirmer] cannot get shard public keys: %v", err)
+		return
+	}
+	if err := confirmer.database.RecordShardPubKeys(pubKeys); err != nil {
+		confirmer.options.Logger.Errorf("[confirmer] cannot record shard public keys: %v", err)
+		return
+	}
+	invalidated, err := confirmer.database.InvalidateGateways(confirmer.options.GatewayGracePeriod)
+	if err != nil {
+		confirmer.options.Logger.Errorf("[confirmer] cannot invalidate gateways: %v", err)
+		return
+	}
+	if invalidated > 0 {
+		confirmer.options.Logger.Infof("[confirmer] invalidated %v gateways of retired shards", invalidated)
+	}
+}
+
+// shardPubKeys returns the public keys of the primary and secondary shards in
+// the block state of the Darknodes. Secondary shards are still able to sign
+// while RenVM moves funds to the primary shard.
+func (confirmer *Confirmer) shardPubKeys(ctx context.Context) ([]pack.Bytes, error) {
+	req := http.NewRequestWithResponder(ctx, rand.Int63(), jsonrpc.MethodQueryBlockState, jsonrpc.ParamsQueryBlockState{}, url.Values{})
+	if ok := confirmer.dispatcher.Send(req); !ok {
+		return nil, fmt.Errorf("too much back pressure")
+	}
+
+	var response jsonrpc.Response
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case response = <-req.Responder:
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+	}
+
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, err
+	}
+	var resp jsonrpc.ResponseQueryBlockState
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+	var system engine.SystemState
+	if err := pack.Decode(&system, resp.State.Get("System")); err != nil {
+		return nil, fmt.Errorf("decoding system state: %v", err)
+	}
+
+	pubKeys := []pack.Bytes{}
+	for _, shard := range system.Shards.Primary {
+		pubKeys = append(pubKeys, shard.PubKey)
+	}
+	for _, shard := range system.Shards.Secondary {
+		pubKeys = append(pubKeys, shard.PubKey)
+	}
+	if len(pubKeys) == 0 {
+		// Never treat every gateway as retired because of an empty state.
+		return nil, fmt.Errorf("no shards in system state")
+	}
+	return pubKeys, nil
+}
+
+// Prune prunes the database using the prune policy of the confirmer, and
+// returns the number of rows pruned from each category. If dryRun is true,
+// nothing is pruned.
+func (confirmer *Confirmer) Prune(dryRun bool) (db.PruneReport, error) {
+	policy := confirmer.options.PrunePolicy
+	if policy.Done == 0 {
+		policy.Done = confirmer.options.Expiry
+	}
+	if policy.Unconfirmed == 0 {
+		policy.Unconfirmed = confirmer.options.Expiry
+	}
+	// Burns older than the expiry are not submitted by the watchers, so
+	// their events no longer need to be remembered.
+	if policy.BurnEvents == 0 {
+		policy.BurnEvents = confirmer.options.Expiry
+	}
+	// Client metadata is only summarised for recent txs.
+	if policy.Clients == 0 {
+		policy.Clients = confirmer.options.Expiry
 	}
+	return confirmer.database.PruneWithPolicy(policy, dryRun)
 }
 
 // submitTxRequest converts a transaction to a `jsonrpc.Request`.
@@ -3,6 +3,7 @@ package confirmer_test
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"math/rand"
 	"time"
 
@@ -12,16 +13,21 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/renproject/lightnode/confirmer"
 
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
 	"github.com/renproject/darknode/tx/txutil"
 	"github.com/renproject/id"
+	"github.com/renproject/lightnode/clock"
 	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/http"
 	"github.com/renproject/lightnode/testutils"
+	"github.com/renproject/pack"
 	"github.com/sirupsen/logrus"
 )
 
 var _ = Describe("Confirmer", func() {
 	cleanUp := func(db *sql.DB) {
-		dropTxs := "DROP TABLE IF EXISTS txs;"
+		dropTxs := "DROP TABLE IF EXISTS txs; DROP TABLE IF EXISTS dest_txids;"
 		_, err := db.Exec(dropTxs)
 		Expect(err).NotTo(HaveOccurred())
 	}
@@ -42,18 +48,20 @@ var _ = Describe("Confirmer", func() {
 			sqlDB.SetMaxOpenConns(1)
 			defer cleanUp(sqlDB)
 
-			database := db.New(sqlDB, 0)
+			database := db.New(sqlDB, 0, 1)
 			Expect(database.Init()).To(Succeed())
 
 			maxAttempts := 2
 			bindings := testutils.MockBindings(logger, maxAttempts)
 
 			pollInterval := 2 * time.Second
+			mockClock := clock.NewMock(time.Now())
 			confirmer := New(
 				DefaultOptions().
 					WithLogger(logger).
 					WithPollInterval(pollInterval).
-					WithExpiry(7*24*time.Hour),
+					WithExpiry(7*24*time.Hour).
+					WithClock(mockClock),
 				dispatcher,
 				database,
 				bindings,
@@ -73,14 +81,23 @@ var _ = Describe("Confirmer", func() {
 				Expect(status).To(Equal(db.TxStatusConfirming))
 			}
 
-			// Sleep and ensure the transaction statuses have updated.
-			time.Sleep(time.Duration(maxAttempts+1) * pollInterval)
-
-			for i := range hashes {
-				status, err := database.TxStatus(hashes[i])
-				Expect(err).ToNot(HaveOccurred())
-				Expect(status).To(Equal(db.TxStatusConfirmed))
+			// Poll until the transactions have sufficient confirmations, and
+			// ensure their statuses have updated.
+			mockClock.BlockUntil(2)
+			for i := 0; i <= maxAttempts; i++ {
+				mockClock.Add(pollInterval)
 			}
+			Eventually(func() int {
+				confirmed := 0
+				for i := range hashes {
+					status, err := database.TxStatus(hashes[i])
+					Expect(err).ToNot(HaveOccurred())
+					if status == db.TxStatusConfirmed {
+						confirmed++
+					}
+				}
+				return confirmed
+			}, 5*time.Second).Should(Equal(len(hashes)))
 		})
 
 		It("should handle backpressure", func() {
@@ -99,18 +116,20 @@ var _ = Describe("Confirmer", func() {
 
 			defer cleanUp(sqlDB)
 
-			database := db.New(sqlDB, 0)
+			database := db.New(sqlDB, 0, 1)
 			Expect(database.Init()).To(Succeed())
 
 			maxAttempts := 2
 			bindings := testutils.MockBindings(logger, maxAttempts)
 
 			pollInterval := 2 * time.Second
+			mockClock := clock.NewMock(time.Now())
 			confirmer := New(
 				DefaultOptions().
 					WithLogger(logger).
 					WithPollInterval(pollInterval).
-					WithExpiry(7*24*time.Hour),
+					WithExpiry(7*24*time.Hour).
+					WithClock(mockClock),
 				dispatcher,
 				database,
 				bindings,
@@ -130,8 +149,13 @@ var _ = Describe("Confirmer", func() {
 				Expect(status).To(Equal(db.TxStatusConfirming))
 			}
 
-			// Sleep and ensure the transaction statuses have updated.
-			time.Sleep(time.Duration(maxAttempts+1) * pollInterval)
+			// Poll until the transactions have sufficient confirmations, and
+			// ensure their statuses have not updated. The last tick is only
+			// received once the previous poll has finished.
+			mockClock.BlockUntil(2)
+			for i := 0; i <= maxAttempts+1; i++ {
+				mockClock.Add(pollInterval)
+			}
 
 			for i := range hashes {
 				status, err := database.TxStatus(hashes[i])
@@ -139,5 +163,133 @@ var _ = Describe("Confirmer", func() {
 				Expect(status).To(Equal(db.TxStatusConfirming))
 			}
 		})
+
+		It("should leave txs outside the pending window", func() {
+			// Initialise confirmer.
+			logger := logrus.New()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			dispatcher := testutils.NewMockDispatcher(false)
+			go dispatcher.Run(ctx)
+
+			sqlDB, err := sql.Open("sqlite3", "./test.db")
+			Expect(err).ToNot(HaveOccurred())
+			sqlDB.SetMaxOpenConns(1)
+			defer cleanUp(sqlDB)
+
+			database := db.New(sqlDB, 0, 1)
+			Expect(database.Init()).To(Succeed())
+
+			maxAttempts := 2
+			bindings := testutils.MockBindings(logger, maxAttempts)
+
+			pollInterval := 2 * time.Second
+			mockClock := clock.NewMock(time.Now())
+			confirmer := New(
+				DefaultOptions().
+					WithLogger(logger).
+					WithPollInterval(pollInterval).
+					WithExpiry(7*24*time.Hour).
+					WithPendingWindow(time.Hour).
+					WithClock(mockClock),
+				dispatcher,
+				database,
+				bindings,
+			)
+
+			// Insert a recent and an old transaction into the database.
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			recent := txutil.RandomGoodTx(r)
+			old := txutil.RandomGoodTx(r)
+			Expect(database.InsertTx(recent)).To(Succeed())
+			Expect(database.InsertTx(old)).To(Succeed())
+			Expect(testutils.UpdateTxCreatedTime(sqlDB, "txs", old.Hash, time.Now().Add(-2*time.Hour).Unix())).To(Succeed())
+			go confirmer.Run(ctx)
+
+			// Poll and ensure only the recent transaction has been confirmed.
+			mockClock.BlockUntil(2)
+			for i := 0; i <= maxAttempts; i++ {
+				mockClock.Add(pollInterval)
+			}
+
+			Eventually(func() db.TxStatus {
+				status, err := database.TxStatus(recent.Hash)
+				Expect(err).ToNot(HaveOccurred())
+				return status
+			}, 5*time.Second).Should(Equal(db.TxStatusConfirmed))
+			status, err := database.TxStatus(old.Hash)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status).To(Equal(db.TxStatusConfirming))
+		})
+	})
+
+	Context("when burns have been released", func() {
+		It("should record the txids of their releases", func() {
+			// Initialise confirmer.
+			logger := logrus.New()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			sqlDB, err := sql.Open("sqlite3", "./test.db")
+			Expect(err).ToNot(HaveOccurred())
+			sqlDB.SetMaxOpenConns(1)
+			defer cleanUp(sqlDB)
+
+			database := db.New(sqlDB, 0, 1)
+			Expect(database.Init()).To(Succeed())
+
+			// Insert a burn which has been submitted to the Darknodes.
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			burn := txutil.RandomGoodTx(r)
+			burn.Selector = "BTC/fromEthereum"
+			Expect(database.InsertTx(burn)).To(Succeed())
+			Expect(database.UpdateStatus(burn.Hash, db.TxStatusConfirmed)).To(Succeed())
+
+			// Respond to queries of the burn with its release.
+			releaseTxid := pack.Bytes{1, 2, 3}
+			sender := testutils.NewMockSender()
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case message := <-sender.Messages:
+						msg := message.(http.RequestWithResponder)
+						params, ok := msg.Params.(jsonrpc.ParamsQueryTx)
+						if !ok || params.TxHash != burn.Hash {
+							msg.RespondWithErr(jsonrpc.ErrorCodeInvalidParams, fmt.Errorf("unexpected request"))
+							continue
+						}
+						released := burn
+						released.Output = pack.NewTyped("txid", releaseTxid)
+						msg.Responder <- jsonrpc.NewResponse(msg.ID, jsonrpc.ResponseQueryTx{Tx: released, TxStatus: tx.StatusDone}, nil)
+					}
+				}
+			}()
+
+			pollInterval := 2 * time.Second
+			mockClock := clock.NewMock(time.Now())
+			confirmer := New(
+				DefaultOptions().
+					WithLogger(logger).
+					WithPollInterval(pollInterval).
+					WithClock(mockClock),
+				sender,
+				database,
+				testutils.MockBindings(logger, 0),
+			)
+			go confirmer.Run(ctx)
+
+			mockClock.BlockUntil(2)
+			mockClock.Add(pollInterval)
+			Eventually(func() []tx.Tx {
+				txs, err := database.TxsByDestTxid(releaseTxid)
+				Expect(err).ToNot(HaveOccurred())
+				return txs
+			}, 5*time.Second).Should(HaveLen(1))
+		})
 	})
 })
@@ -0,0 +1,45 @@
+package confirmer
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PruneHandler serves the prune endpoint of the admin API. A GET request
+// reports the rows which would be pruned by the prune policy, and a POST
+// request prunes them immediately.
+type PruneHandler struct {
+	confirmer *Confirmer
+}
+
+// NewPruneHandler returns a PruneHandler for the given confirmer.
+func NewPruneHandler(confirmer *Confirmer) PruneHandler {
+	return PruneHandler{confirmer: confirmer}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler PruneHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var dryRun bool
+	switch r.Method {
+	case http.MethodGet:
+		dryRun = true
+	case http.MethodPost:
+		dryRun = false
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := handler.confirmer.Prune(dryRun)
+	if err != nil {
+		handler.confirmer.options.Logger.Errorf("[confirmer] cannot prune database: %v", err)
+		http.Error(w, "cannot prune database", http.StatusInternalServerError)
+		return
+	}
+	if !dryRun {
+		handler.confirmer.options.Logger.Infof("[confirmer] pruned done=%v unconfirmed=%v gateways=%v", report.Done, report.Unconfirmed, report.Gateways)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
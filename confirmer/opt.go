@@ -3,6 +3,10 @@ package confirmer
 import (
 	"time"
 
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/finality"
+	"github.com/renproject/multichain"
 	"github.com/sirupsen/logrus"
 )
 
@@ -10,6 +14,16 @@ import (
 var (
 	DefaultPollInterval = 30 * time.Second
 	DefaultExpiry       = 30 * 24 * time.Hour
+	DefaultRetention    = 30 * 24 * time.Hour
+	DefaultCallTimeout  = 10 * time.Second
+
+	// DefaultPendingWindow covers the confirmation times of all supported
+	// chains, with room for their RPCs to be down for a while.
+	DefaultPendingWindow = 72 * time.Hour
+
+	// DefaultGatewayGracePeriod gives users who were shown a gateway shortly
+	// before its shard was retired time to deposit to it.
+	DefaultGatewayGracePeriod = 14 * 24 * time.Hour
 )
 
 // Options to configure the precise behaviour of the confirmer.
@@ -17,6 +31,34 @@ type Options struct {
 	Logger       logrus.FieldLogger
 	PollInterval time.Duration
 	Expiry       time.Duration
+	Retention    time.Duration
+
+	// PrunePolicy overrides the expiry of individual categories of rows. Tx
+	// categories without their own expiry use Expiry. If PruneDryRun is set,
+	// the rows which would be pruned are only logged.
+	PrunePolicy db.PrunePolicy
+	PruneDryRun bool
+
+	// GatewayGracePeriod is how long gateways remain valid after the shard
+	// public key they were derived from stops being used by RenVM. Gateways
+	// are never invalidated if it is zero.
+	GatewayGracePeriod time.Duration
+
+	// CallTimeout bounds the chain calls made to check a single tx, so that a
+	// slow node cannot hold up the rest of the pending txs.
+	CallTimeout time.Duration
+
+	// PendingWindow is how long after their submission the confirmations of
+	// txs are checked, so that txs which will never be confirmed, such as
+	// those whose deposit was replaced, are not checked forever.
+	PendingWindow time.Duration
+
+	// FinalityCheckers are used instead of confirmation counts for chains
+	// which support finality tags.
+	FinalityCheckers map[multichain.Chain]finality.Checker
+
+	// Clock schedules the checks of pending txs and the pruning of old ones.
+	Clock clock.Clock
 }
 
 // DefaultOptions returns new options with default configurations that should
@@ -26,6 +68,16 @@ func DefaultOptions() Options {
 		Logger:       logrus.New(),
 		PollInterval: DefaultPollInterval,
 		Expiry:       DefaultExpiry,
+		Retention:    DefaultRetention,
+		CallTimeout:  DefaultCallTimeout,
+
+		PendingWindow: DefaultPendingWindow,
+
+		GatewayGracePeriod: DefaultGatewayGracePeriod,
+
+		FinalityCheckers: map[multichain.Chain]finality.Checker{},
+
+		Clock: clock.New(),
 	}
 }
 
@@ -46,3 +98,57 @@ func (opts Options) WithExpiry(expiry time.Duration) Options {
 	opts.Expiry = expiry
 	return opts
 }
+
+// WithRetention returns new options with the given retention period for
+// archived transactions.
+func (opts Options) WithRetention(retention time.Duration) Options {
+	opts.Retention = retention
+	return opts
+}
+
+// WithPrunePolicy returns new options with the given prune policy.
+func (opts Options) WithPrunePolicy(policy db.PrunePolicy) Options {
+	opts.PrunePolicy = policy
+	return opts
+}
+
+// WithPruneDryRun returns new options which only report the rows which would
+// be pruned, rather than pruning them.
+func (opts Options) WithPruneDryRun(dryRun bool) Options {
+	opts.PruneDryRun = dryRun
+	return opts
+}
+
+// WithGatewayGracePeriod returns new options which invalidate gateways once
+// their shard has been retired for longer than the grace period.
+func (opts Options) WithGatewayGracePeriod(grace time.Duration) Options {
+	opts.GatewayGracePeriod = grace
+	return opts
+}
+
+// WithCallTimeout returns new options with the given timeout for the chain
+// calls made to check a tx.
+func (opts Options) WithCallTimeout(timeout time.Duration) Options {
+	opts.CallTimeout = timeout
+	return opts
+}
+
+// WithPendingWindow returns new options which check the confirmations of txs
+// submitted within the given window.
+func (opts Options) WithPendingWindow(window time.Duration) Options {
+	opts.PendingWindow = window
+	return opts
+}
+
+// WithFinalityCheckers returns new options with the given finality checkers.
+func (opts Options) WithFinalityCheckers(checkers map[multichain.Chain]finality.Checker) Options {
+	opts.FinalityCheckers = checkers
+	return opts
+}
+
+// WithClock returns new options with the given clock, such as a mock clock
+// which tests advance instead of waiting for the poll interval.
+func (opts Options) WithClock(clock clock.Clock) Options {
+	opts.Clock = clock
+	return opts
+}
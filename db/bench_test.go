@@ -0,0 +1,74 @@
+package db_test
+
+import (
+	"database/sql"
+	"math/rand"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/renproject/darknode/tx/txutil"
+	. "github.com/renproject/lightnode/db"
+)
+
+// initBenchDB returns a database holding a single tx, which is looked up by
+// the benchmarks of the queryTx path.
+func initBenchDB(b *testing.B) (DB, func()) {
+	source := "./bench.db"
+	os.Remove(source)
+	sqlDB, err := sql.Open(Sqlite, source)
+	if err != nil {
+		b.Fatal(err)
+	}
+	database := New(sqlDB, 100, 1)
+	if err := database.Init(); err != nil {
+		b.Fatal(err)
+	}
+	return database, func() {
+		sqlDB.Close()
+		os.Remove(source)
+	}
+}
+
+// BenchmarkTxStatus measures the status lookup which every queryTx starts
+// with. The lookups of the queryTx path are covered here and the decoding of
+// darknode results in the http package, but not the encoding of responses,
+// which is done by the JSON-RPC server.
+func BenchmarkTxStatus(b *testing.B) {
+	database, cleanUp := initBenchDB(b)
+	defer cleanUp()
+
+	transaction := txutil.RandomGoodTx(rand.New(rand.NewSource(1)))
+	if err := database.InsertTx(transaction); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := database.TxStatus(transaction.Hash); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTx measures the lookup of txs which the darknodes do not know about
+// yet.
+func BenchmarkTx(b *testing.B) {
+	database, cleanUp := initBenchDB(b)
+	defer cleanUp()
+
+	transaction := txutil.RandomGoodTx(rand.New(rand.NewSource(1)))
+	if err := database.InsertTx(transaction); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := database.Tx(transaction.Hash); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+// InsertBlocks implements the DB interface.
+func (db database) InsertBlocks(blocks map[uint64][]byte) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, 0, len(blocks))
+	now := db.clock.Unix()
+	for height, block := range blocks {
+		rows = append(rows, []interface{}{int64(height), string(block), now})
+	}
+	return db.insertBatches("blocks", "height, block, created_time", "height", rows)
+}
+
+// Blocks implements the DB interface.
+func (db database) Blocks(from, n uint64) ([][]byte, error) {
+	rows, err := db.db.Query(`SELECT block FROM blocks WHERE height >= $1 AND height < $2 ORDER BY height ASC;`, int64(from), int64(from+n))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := make([][]byte, 0, n)
+	for rows.Next() {
+		var block string
+		if err := rows.Scan(&block); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, []byte(block))
+	}
+	return blocks, rows.Err()
+}
+
+// PruneBlocks implements the DB interface.
+func (db database) PruneBlocks(keep int) error {
+	_, err := db.db.Exec(`DELETE FROM blocks WHERE height NOT IN (SELECT height FROM blocks ORDER BY created_time DESC, height DESC LIMIT $1);`, keep)
+	return err
+}
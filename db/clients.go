@@ -0,0 +1,65 @@
+package db
+
+import (
+	"time"
+
+	"github.com/renproject/id"
+)
+
+// ClientMetadata identifies the client which submitted a transaction.
+type ClientMetadata struct {
+	UserAgent    string `json:"userAgent,omitempty"`
+	RenJSVersion string `json:"renJSVersion,omitempty"`
+	Integrator   string `json:"integrator,omitempty"`
+}
+
+// IsEmpty returns whether none of the metadata is known.
+func (metadata ClientMetadata) IsEmpty() bool {
+	return metadata == ClientMetadata{}
+}
+
+// ClientSummary is the number of transactions submitted by an integrator
+// using a version of RenJS.
+type ClientSummary struct {
+	Integrator   string `json:"integrator"`
+	RenJSVersion string `json:"renJSVersion"`
+	Count        int    `json:"count"`
+	LastSeen     int64  `json:"lastSeen"`
+}
+
+// InsertClientMetadata implements the DB interface.
+func (db database) InsertClientMetadata(txHash id.Hash, metadata ClientMetadata) error {
+	_, err := db.db.Exec(`INSERT INTO tx_clients (hash, created_time, user_agent, renjs_version, integrator) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (hash) DO NOTHING;`,
+		txHash.String(), db.clock.Unix(), metadata.UserAgent, metadata.RenJSVersion, metadata.Integrator)
+	return err
+}
+
+// ClientMetadata implements the DB interface.
+func (db database) ClientMetadata(txHash id.Hash) (ClientMetadata, error) {
+	var metadata ClientMetadata
+	err := db.db.QueryRow(`SELECT user_agent, renjs_version, integrator FROM tx_clients WHERE hash = $1;`, txHash.String()).
+		Scan(&metadata.UserAgent, &metadata.RenJSVersion, &metadata.Integrator)
+	return metadata, err
+}
+
+// ClientSummaries implements the DB interface.
+func (db database) ClientSummaries(since time.Duration) ([]ClientSummary, error) {
+	rows, err := db.db.Query(`SELECT integrator, renjs_version, COUNT(*), MAX(created_time) FROM tx_clients
+		WHERE $1 - created_time < $2
+		GROUP BY integrator, renjs_version
+		ORDER BY COUNT(*) DESC, integrator, renjs_version;`, db.clock.Unix(), int64(since.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []ClientSummary{}
+	for rows.Next() {
+		var summary ClientSummary
+		if err := rows.Scan(&summary.Integrator, &summary.RenJSVersion, &summary.Count, &summary.LastSeen); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/renproject/id"
+)
+
+// InsertCompatMapping implements the DB interface.
+func (db database) InsertCompatMapping(key, value string, v1Hash id.Hash, expiry time.Duration) error {
+	defer db.observe("InsertCompatMapping", time.Now(), key)
+
+	now := db.clock.Now()
+	var expiryTime interface{}
+	if expiry > 0 {
+		expiryTime = now.Add(expiry).Unix()
+	}
+	script := fmt.Sprintf(`INSERT INTO compat_mappings (mapping_key, value, v1_hash, created_time, expiry_time) VALUES ($1, $2, $3, $4, $5) %s;`,
+		onConflict("mapping_key", "value", "v1_hash", "created_time", "expiry_time"))
+	_, err := db.db.Exec(script, key, value, v1Hash.String(), now.Unix(), expiryTime)
+	return err
+}
+
+// CompatMapping implements the DB interface.
+func (db database) CompatMapping(key string) (string, error) {
+	defer db.observe("CompatMapping", time.Now(), key)
+
+	var value string
+	err := db.db.QueryRow(`SELECT value FROM compat_mappings WHERE mapping_key = $1 AND (expiry_time IS NULL OR expiry_time > $2);`,
+		key, db.clock.Unix()).Scan(&value)
+	return value, err
+}
+
+// compatMappingsBatch is the number of keys looked up by each query of
+// CompatMappings, which keeps queries under the 999 parameters SQLite allows.
+const compatMappingsBatch = 500
+
+// CompatMappings implements the DB interface.
+func (db database) CompatMappings(keys []string) (map[string]string, error) {
+	defer db.observe("CompatMappings", time.Now(), len(keys))
+
+	values := make(map[string]string, len(keys))
+	for start := 0; start < len(keys); start += compatMappingsBatch {
+		end := start + compatMappingsBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := db.compatMappings(keys[start:end], values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// compatMappings adds the values mapped to the keys to the map.
+func (db database) compatMappings(keys []string, values map[string]string) error {
+	args := make([]interface{}, 0, len(keys)+1)
+	placeholders := make([]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	args = append(args, db.clock.Unix())
+	rows, err := db.db.Query(fmt.Sprintf(`SELECT mapping_key, value FROM compat_mappings WHERE mapping_key IN (%s) AND (expiry_time IS NULL OR expiry_time > $%d);`,
+		strings.Join(placeholders, ", "), len(args)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		values[key] = value
+	}
+	return rows.Err()
+}
+
+// PruneCompatMappings implements the DB interface.
+func (db database) PruneCompatMappings() (int64, error) {
+	defer db.observe("PruneCompatMappings", time.Now())
+
+	result, err := db.db.Exec(`DELETE FROM compat_mappings WHERE expiry_time IS NOT NULL AND expiry_time <= $1;`, db.clock.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
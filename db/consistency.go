@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A DecodeError is returned when the columns of a stored row are missing or
+// cannot be decoded, as opposed to when the row cannot be read.
+type DecodeError struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (err DecodeError) Error() string {
+	return err.Err.Error()
+}
+
+// IsDecodeError returns whether the error is a DecodeError.
+func IsDecodeError(err error) bool {
+	_, ok := err.(DecodeError)
+	return ok
+}
+
+// RepairGateways implements the DB interface.
+func (db database) RepairGateways() (int, error) {
+	rows, err := db.db.Query("SELECT gateway_address FROM gateways;")
+	if err != nil {
+		return 0, err
+	}
+	addresses := []string{}
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		addresses = append(addresses, address)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// A gateway which cannot be decoded was only partially written. Such a
+	// row blocks the gateway from being re-submitted, since the resolver
+	// considers the address to be taken, so it is removed instead. Any other
+	// error, such as a lost connection, says nothing about the row, so the
+	// check stops rather than removing gateways which may be complete.
+	removed := 0
+	for _, address := range addresses {
+		_, err := db.Gateway(address)
+		if err == nil || err == sql.ErrNoRows {
+			continue
+		}
+		if !IsDecodeError(err) {
+			return removed, err
+		}
+		if _, err := db.db.Exec("DELETE FROM gateways WHERE gateway_address = $1;", address); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunConsistencyCheck repairs partially written gateways on startup and then
+// periodically with the given interval, until the context is cancelled.
+func RunConsistencyCheck(ctx context.Context, database DB, logger logrus.FieldLogger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := database.RepairGateways()
+		if err != nil {
+			logger.Errorf("[db] failed to check gateway consistency: %v", err)
+		} else if removed > 0 {
+			logger.Warnf("[db] removed %v partially written gateways", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,3 +1,7 @@
+// Package db persists txs, gateways and the other state of the Lightnode in a
+// SQL database (Postgres or SQLite). The database can be used without the rest
+// of the Lightnode by passing a `*sql.DB` to New and calling Init to create
+// the tables.
 package db
 
 import (
@@ -5,11 +9,15 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/slowlog"
 	"github.com/renproject/pack"
 )
 
@@ -22,14 +30,74 @@ const (
 	TxStatusSubmitted
 )
 
+// String returns the name of the status, which is how it is reported to
+// clients.
+func (status TxStatus) String() string {
+	switch status {
+	case TxStatusConfirming:
+		return "confirming"
+	case TxStatusConfirmed:
+		return "confirmed"
+	case TxStatusSubmitted:
+		return "submitted"
+	default:
+		return "unknown"
+	}
+}
+
 type GatewayStatus uint8
 
 const (
 	GatewayStatusNil GatewayStatus = iota
 	GatewayStatusEmpty
 	GatewayStatusUsed
+	// GatewayStatusInvalid marks gateways derived from a shard public key which
+	// has been retired, so RenVM can no longer sign for deposits to them.
+	GatewayStatusInvalid
 )
 
+// String returns the name of the status, which is how it is reported to
+// clients.
+func (status GatewayStatus) String() string {
+	switch status {
+	case GatewayStatusEmpty:
+		return "empty"
+	case GatewayStatusUsed:
+		return "used"
+	case GatewayStatusInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// PrunePolicy is the expiry of each category of rows which can be pruned. A
+// zero expiry disables pruning of the category. Txs are categorised by status,
+// as the database does not record whether a tx failed.
+type PrunePolicy struct {
+	// Done is the expiry of txs which have been confirmed or submitted.
+	Done time.Duration
+	// Unconfirmed is the expiry of txs which are still waiting for
+	// confirmations.
+	Unconfirmed time.Duration
+	// Gateways is the expiry of gateways.
+	Gateways time.Duration
+	// BurnEvents is the expiry of the burn events processed by the watchers.
+	BurnEvents time.Duration
+	// Clients is the expiry of the client metadata of submitted txs.
+	Clients time.Duration
+}
+
+// PruneReport is the number of rows pruned from each category.
+type PruneReport struct {
+	DryRun      bool  `json:"dryRun"`
+	Done        int64 `json:"done"`
+	Unconfirmed int64 `json:"unconfirmed"`
+	Gateways    int64 `json:"gateways"`
+	BurnEvents  int64 `json:"burnEvents"`
+	Clients     int64 `json:"clients"`
+}
+
 type Scannable interface {
 	Scan(dest ...interface{}) error
 }
@@ -41,9 +109,21 @@ type DB interface {
 	// is created.
 	Init() error
 
+	// RollbackSchema reverts the migrations applied after the given schema
+	// version, newest first, so that the database can be used by the Lightnode
+	// with that version. It cannot roll back further than the baseline
+	// version.
+	RollbackSchema(version int) error
+
 	// InsertTx inserts the transaction into the database.
 	InsertTx(tx tx.Tx) error
 
+	// InsertTxs inserts the transactions into the database using multi-row
+	// inserts of at most BatchSize rows. Each batch is written in its own SQL
+	// transaction, so batches before one which fails stay written, and
+	// transactions which already exist are skipped.
+	InsertTxs(txs []tx.Tx) error
+
 	// Tx gets the details of the transaction with the given hash. It returns an
 	// `sql.ErrNoRows` if the transaction cannot be found.
 	Tx(hash id.Hash) (tx.Tx, error)
@@ -51,13 +131,146 @@ type DB interface {
 	// Txs returns transactions with the given pagination options.
 	Txs(offset, limit int, latest bool) ([]tx.Tx, error)
 
-	// Txs returns transactions with the given pagination options.
-	TxsByTxid(id pack.Bytes) ([]tx.Tx, error)
+	// TxPageSize returns the number of transactions in the page with the
+	// given offset and limit, without reading them.
+	TxPageSize(offset, limit int) (int, error)
+
+	// TxsAfter calls visit with up to limit txs after the cursor, along with
+	// the cursor of each tx, in the order they were created, or the reverse
+	// if latest is set. Rows are converted as they are read, so that pages
+	// are never held in memory twice. The zero cursor starts from the first
+	// tx. Iteration stops at the first error returned by visit.
+	TxsAfter(cursor TxCursor, limit int, latest bool, visit func(tx.Tx, TxCursor) error) error
+
+	// TxCount returns the number of transactions in the database. Large
+	// tables on Postgres are counted using the query planner's estimate
+	// instead of a full scan, in which case the count is approximate.
+	TxCount() (count int, approximate bool, err error)
+
+	// TxsByTxid returns the transactions of the deposit or burn with the
+	// given txid. If the selector is not empty, only transactions with that
+	// selector are returned, and if the status is not TxStatusNil, only
+	// transactions with that status are returned.
+	TxsByTxid(txid pack.Bytes, selector string, status TxStatus) ([]tx.Tx, error)
+
+	// InsertDestTxid records the txid of the host chain transaction which
+	// completed the transaction with the given hash (i.e. the mint or
+	// release). Existing records are not overwritten.
+	InsertDestTxid(hash id.Hash, txid pack.Bytes) error
+
+	// TxsByDestTxid returns the transactions which were completed by the host
+	// chain transaction with the given txid.
+	TxsByDestTxid(txid pack.Bytes) ([]tx.Tx, error)
+
+	// UnreleasedBurns returns up to limit burns which were submitted to the
+	// Darknodes within the given window, but whose release txid has not been
+	// recorded, oldest first.
+	UnreleasedBurns(window time.Duration, limit int) ([]tx.Tx, error)
+
+	// BurnsByNonce returns the burns with the given nonce, which is the ref
+	// of the burn on its host chain. Refs are only unique per gateway, so if
+	// the selector is not empty, only burns with that selector are returned.
+	BurnsByNonce(nonce pack.Bytes32, selector string) ([]tx.Tx, error)
+
+	// TxsByRecipient returns transactions to the given address with the given
+	// pagination options, most recent first. If the selector is not empty,
+	// only transactions with that selector are returned.
+	TxsByRecipient(to, selector string, offset, limit int) ([]tx.Tx, error)
+
+	// InsertClientMetadata records the client which submitted the transaction
+	// with the given hash. Existing records are not overwritten.
+	InsertClientMetadata(hash id.Hash, metadata ClientMetadata) error
+
+	// ClientMetadata returns the client which submitted the transaction with
+	// the given hash. It returns an `sql.ErrNoRows` if it was not recorded.
+	ClientMetadata(hash id.Hash) (ClientMetadata, error)
+
+	// ClientSummaries returns the number of transactions submitted by each
+	// integrator and RenJS version within the given period.
+	ClientSummaries(since time.Duration) ([]ClientSummary, error)
+
+	// InsertBlocks caches the encoded RenVM blocks, keyed by height. Blocks
+	// which are already cached are not overwritten, as they are final.
+	InsertBlocks(blocks map[uint64][]byte) error
+
+	// Blocks returns the cached blocks with heights in [from, from+n), in
+	// ascending order of height. Blocks which are not cached are skipped.
+	Blocks(from, n uint64) ([][]byte, error)
+
+	// PruneBlocks removes all but the given number of the most recently
+	// cached blocks.
+	PruneBlocks(keep int) error
+
+	// InsertSubmission starts a submission whose payload is uploaded in
+	// chunks.
+	InsertSubmission(submission Submission) error
+
+	// Submission returns the submission with the given id, along with the
+	// number of payload bytes received so far. It returns `sql.ErrNoRows` if
+	// the submission does not exist or is older than the expiry.
+	Submission(id string, expiry time.Duration) (Submission, error)
+
+	// InsertSubmissionChunk stores a chunk of the payload of a submission at
+	// the given offset. Chunks which have already been stored are skipped.
+	InsertSubmissionChunk(id string, offset uint64, data []byte) error
+
+	// SubmissionPayload returns the chunks of the payload of a submission
+	// joined in order of their offsets.
+	SubmissionPayload(id string) ([]byte, error)
+
+	// DeleteSubmission removes a submission and its chunks.
+	DeleteSubmission(id string) error
+
+	// PruneSubmissions removes submissions, and their chunks, which are older
+	// than the expiry.
+	PruneSubmissions(expiry time.Duration) error
+
+	// InsertBurnEvent records that the burn event with the given digest has
+	// been processed. Recording an event again only updates the time it was
+	// recorded, which is used to prune it.
+	InsertBurnEvent(digest id.Hash, event BurnEvent) error
+
+	// BurnEventProcessed returns whether the burn event with the given digest
+	// has been processed.
+	BurnEventProcessed(digest id.Hash) (bool, error)
+
+	// InsertHookEvent records an event sent to the hook with the target, and
+	// returns its sequence number, which is one more than that of the
+	// previous event sent to the target.
+	InsertHookEvent(target, id string, data []byte) (uint64, error)
+
+	// HookEvents returns up to limit events sent to the hook with the target
+	// after the given sequence number, in order.
+	HookEvents(target string, since uint64, limit int) ([]HookEvent, error)
+
+	// PruneHookEvents deletes events older than the expiry, except for the
+	// latest event of each target, and returns the number of events deleted.
+	PruneHookEvents(expiry time.Duration) (int64, error)
+
+	// InsertFinalQueryTx persists the queryTx result of a tx which is done and
+	// signed, as it can no longer change. Results which are already persisted
+	// are not overwritten.
+	InsertFinalQueryTx(hash id.Hash, result []byte) error
+
+	// FinalQueryTx returns the persisted queryTx result of the tx with the
+	// given hash. It returns `sql.ErrNoRows` if the tx is not final.
+	FinalQueryTx(hash id.Hash) ([]byte, error)
 
 	// PendingTxs returns all pending transactions in the database which are not
 	// expired.
 	PendingTxs(expiry time.Duration) ([]tx.Tx, error)
 
+	// PendingTxCount returns the number of transactions which are confirming
+	// or confirmed, but have not yet been submitted to the Darknodes.
+	PendingTxCount() (int, error)
+
+	// UnfinishedBurns returns up to limit burns after the cursor which were
+	// created before the given time and have been submitted to the Darknodes,
+	// but whose final queryTx result has not been persisted, oldest first.
+	// It also returns the cursor of the last burn, from which the next page
+	// starts. The zero cursor starts from the oldest burn.
+	UnfinishedBurns(before time.Time, cursor TxCursor, limit int) ([]tx.Tx, TxCursor, error)
+
 	// TxStatus returns the current status of the transaction with the given
 	// hash.
 	TxStatus(hash id.Hash) (TxStatus, error)
@@ -66,36 +279,175 @@ type DB interface {
 	// cannot be updated to a previous status.
 	UpdateStatus(hash id.Hash, status TxStatus) error
 
-	// Prune deletes transactions which have expired.
+	// Prune moves transactions which have expired into the archive, from
+	// where they can still be restored until they are purged.
 	Prune(expiry time.Duration) error
 
+	// PruneWithPolicy prunes each category of rows using its own expiry, and
+	// returns the number of rows pruned from each. Transactions are archived
+	// as in Prune, whereas gateways, burn events and client metadata are
+	// deleted. If dryRun is true, nothing is
+	// pruned and the report contains the rows which would have been.
+	PruneWithPolicy(policy PrunePolicy, dryRun bool) (PruneReport, error)
+
+	// PurgeArchive permanently deletes transactions which have been archived
+	// for longer than the given retention period.
+	PurgeArchive(retention time.Duration) error
+
+	// RestoreTx moves an archived transaction back into the txs table. It
+	// returns `sql.ErrNoRows` if the transaction is not in the archive.
+	RestoreTx(hash id.Hash) error
+
 	// InsertGateway inserts the gateway into the database.
 	InsertGateway(address string, tx tx.Tx) error
 
+	// InsertGateways inserts the gateways, keyed by gateway address, into the
+	// database in the same manner as InsertTxs.
+	InsertGateways(gateways map[string]tx.Tx) error
+
 	// Gateway gets the details of the gateway with the given gateway address. It returns an
-	// `sql.ErrNoRows` if the gateway cannot be found.
+	// `sql.ErrNoRows` if the gateway cannot be found, and a `DecodeError` if it
+	// was not stored completely.
 	Gateway(address string) (tx.Tx, error)
 
-	// Gateways returns gateways with the given pagination options.
-	Gateways(offset, limit int) ([]tx.Tx, error)
+	// RepairGateways removes gateways which were only partially written and
+	// returns the number of gateways removed, allowing them to be submitted
+	// again.
+	RepairGateways() (int, error)
+
+	// Gateways returns a page of gateways, most recent first. If the status is
+	// not GatewayStatusNil, only gateways with the status are returned.
+	Gateways(offset, limit int, status GatewayStatus) ([]GatewayInfo, error)
 
 	// GatewayCount returns the number of gateways persisted
 	GatewayCount() (int, error)
 
+	// InsertGatewayDeposit records a deposit of the given amount to the
+	// gateway with the given ghash, and marks the gateway as used. Recording
+	// the deposit of a tx more than once has no effect.
+	InsertGatewayDeposit(txHash id.Hash, ghash pack.Bytes32, amount pack.U256) error
+
+	// GatewayUsage returns the number of deposits made to the gateway with the
+	// given ghash and their cumulative amount.
+	GatewayUsage(ghash pack.Bytes32) (GatewayUsage, error)
+
+	// GatewayStatus returns the status of the gateway with the given gateway
+	// address. It returns an `sql.ErrNoRows` if the gateway cannot be found.
+	GatewayStatus(address string) (GatewayStatus, error)
+
+	// RenewGateway extends the life of the gateway with the given gateway
+	// address until the given expiry, unless it already expires later, and
+	// returns its expiry as a unix timestamp. The expiry is capped at the
+	// given lifetime after the gateway was created, so that gateways cannot be
+	// renewed forever. Renewed gateways are not pruned before their expiry,
+	// even if the gateway prune expiry has passed. It returns an
+	// `sql.ErrNoRows` if the gateway cannot be found.
+	RenewGateway(address string, expiry time.Time, maxLifetime time.Duration) (int64, error)
+
+	// GatewayExpiry returns the expiry of the gateway with the given gateway
+	// address as a unix timestamp, or zero if it has never been renewed. It
+	// returns an `sql.ErrNoRows` if the gateway cannot be found.
+	GatewayExpiry(address string) (int64, error)
+
+	// RecordShardPubKeys records that the given shard public keys are
+	// currently valid.
+	RecordShardPubKeys(pubKeys []pack.Bytes) error
+
+	// InvalidateGateways marks gateways derived from shard public keys which
+	// have not been recorded as valid for longer than the grace period as
+	// invalid, and returns the number of gateways marked. Gateways of shard
+	// public keys which were never recorded are left alone.
+	InvalidateGateways(grace time.Duration) (int64, error)
+
+	// InsertCompatMapping maps the key of a compat lookup, such as a v0 tx
+	// hash, to its value until the expiry has passed. A zero expiry never
+	// expires. Existing mappings of the key are replaced.
+	InsertCompatMapping(key, value string, v1Hash id.Hash, expiry time.Duration) error
+
+	// CompatMapping returns the value mapped to the key. It returns
+	// `sql.ErrNoRows` if the key is not mapped or its mapping has expired.
+	CompatMapping(key string) (string, error)
+
+	// CompatMappings returns the values mapped to the keys, querying many keys
+	// at once. Keys which are not mapped, or whose mappings have expired, are
+	// left out.
+	CompatMappings(keys []string) (map[string]string, error)
+
+	// PruneCompatMappings deletes expired compat mappings, and returns the
+	// number of mappings deleted.
+	PruneCompatMappings() (int64, error)
+
+	// InsertV0Payload records the original params of a legacy v0 submission
+	// which was converted into the transaction with the given hash, and
+	// returns the digest which addresses the payload. Recording the same
+	// payload more than once has no effect.
+	InsertV0Payload(hash id.Hash, payload []byte) (id.Hash, error)
+
+	// V0Payload returns the v0 payload with the given digest. It returns an
+	// `sql.ErrNoRows` if the payload was not recorded.
+	V0Payload(digest id.Hash) (V0Payload, error)
+
+	// V0PayloadsByTx returns the v0 payloads which were converted into the
+	// transaction with the given hash.
+	V0PayloadsByTx(hash id.Hash) ([]V0Payload, error)
+
 	// GatewayCount returns the number of gateways persisted
 	MaxGatewayCount() int
+
+	// BatchSize returns the maximum number of rows written by a single batched
+	// insert.
+	BatchSize() int
+
+	// Clock returns the clock of the created times stored in the database.
+	Clock() *clock.Monotonic
+
+	// WithSlowLog returns the database with its slow queries recorded in the
+	// given log.
+	WithSlowLog(log *slowlog.Log) DB
 }
 
 type database struct {
 	db              *sql.DB
 	maxGatewayCount int
+	batchSize       int
+	dialect         dialect
+	stmts           *statements
+	clock           *clock.Monotonic
+	slowLog         *slowlog.Log
+}
+
+// New creates a new DB instance, using the dialect of the driver of the given
+// database: Postgres for lib/pq, and SQLite otherwise. The batch size limits
+// the number of rows written in a single statement by the batched insert
+// functions; a batch size of 1 effectively disables batching.
+func New(db *sql.DB, maxGatewayCount, batchSize int) DB {
+	if _, ok := db.Driver().(*pq.Driver); ok {
+		return NewPostgres(db, maxGatewayCount, batchSize)
+	}
+	return NewSQLite(db, maxGatewayCount, batchSize)
 }
 
-// New creates a new DB instance.
-func New(db *sql.DB, maxGatewayCount int) DB {
+// NewPostgres creates a new DB instance for a Postgres database.
+func NewPostgres(db *sql.DB, maxGatewayCount, batchSize int) DB {
+	return newDatabase(db, postgres{}, maxGatewayCount, batchSize)
+}
+
+// NewSQLite creates a new DB instance for a SQLite database.
+func NewSQLite(db *sql.DB, maxGatewayCount, batchSize int) DB {
+	return newDatabase(db, sqlite{}, maxGatewayCount, batchSize)
+}
+
+func newDatabase(db *sql.DB, dialect dialect, maxGatewayCount, batchSize int) database {
+	if batchSize < 1 {
+		batchSize = 1
+	}
 	return database{
 		db:              db,
 		maxGatewayCount: maxGatewayCount,
+		batchSize:       batchSize,
+		dialect:         dialect,
+		stmts:           newStatements(db),
+		clock:           clock.NewMonotonic(),
 	}
 }
 
@@ -103,45 +455,89 @@ func (db database) MaxGatewayCount() int {
 	return db.maxGatewayCount
 }
 
+func (db database) BatchSize() int {
+	return db.batchSize
+}
+
+func (db database) Clock() *clock.Monotonic {
+	return db.clock
+}
+
+func (db database) WithSlowLog(log *slowlog.Log) DB {
+	db.slowLog = log
+	return db
+}
+
 // A gateway is a partial Tx that does not have deposits
 // We store it in order to be able to re-create the parameters needed to finish a mint
 func (db database) InsertGateway(address string, tx tx.Tx) error {
+	defer db.observe("InsertGateway", time.Now(), address)
+
+	row, err := db.gatewayToRow(address, tx)
+	if err != nil {
+		return err
+	}
+
+	script := `INSERT INTO gateways
+(gateway_address, status, created_time, selector, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
+	_, err = db.db.Exec(script, row...)
+	return err
+}
+
+// InsertGateways implements the DB interface.
+func (db database) InsertGateways(gateways map[string]tx.Tx) error {
+	defer db.observe("InsertGateways", time.Now())
+
+	rows := make([][]interface{}, 0, len(gateways))
+	for address, tx := range gateways {
+		row, err := db.gatewayToRow(address, tx)
+		if err != nil {
+			return fmt.Errorf("gateway %v: %v", address, err)
+		}
+		rows = append(rows, row)
+	}
+	return db.insertBatches("gateways", gatewayColumns, "gateway_address", rows)
+}
+
+const gatewayColumns = "gateway_address, status, created_time, selector, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version"
+
+// gatewayToRow returns the column values used to persist the gateway, in the
+// order given by gatewayColumns.
+func (db database) gatewayToRow(address string, tx tx.Tx) ([]interface{}, error) {
 	payload, ok := tx.Input.Get("payload").(pack.Bytes)
 	if !ok {
-		return fmt.Errorf("unexpected type for payload: expected pack.Bytes, got %v", tx.Input.Get("payload").Type())
+		return nil, fmt.Errorf("unexpected type for payload: expected pack.Bytes, got %v", tx.Input.Get("payload").Type())
 	}
 	phash, ok := tx.Input.Get("phash").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for phash: expected pack.Bytes32, got %v", tx.Input.Get("phash").Type())
+		return nil, fmt.Errorf("unexpected type for phash: expected pack.Bytes32, got %v", tx.Input.Get("phash").Type())
 	}
 	to, ok := tx.Input.Get("to").(pack.String)
 	if !ok {
-		return fmt.Errorf("unexpected type for to: expected pack.String, got %v", tx.Input.Get("to").Type())
+		return nil, fmt.Errorf("unexpected type for to: expected pack.String, got %v", tx.Input.Get("to").Type())
 	}
 	nonce, ok := tx.Input.Get("nonce").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for nonce: expected pack.Bytes32, got %v", tx.Input.Get("nonce").Type())
+		return nil, fmt.Errorf("unexpected type for nonce: expected pack.Bytes32, got %v", tx.Input.Get("nonce").Type())
 	}
 	nhash, ok := tx.Input.Get("nhash").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for nhash: expected pack.Bytes32, got %v", tx.Input.Get("nhash").Type())
+		return nil, fmt.Errorf("unexpected type for nhash: expected pack.Bytes32, got %v", tx.Input.Get("nhash").Type())
 	}
 	gpubkey, ok := tx.Input.Get("gpubkey").(pack.Bytes)
 	if !ok {
-		return fmt.Errorf("unexpected type for gpubkey: expected pack.Bytes, got %v", tx.Input.Get("gpubkey").Type())
+		return nil, fmt.Errorf("unexpected type for gpubkey: expected pack.Bytes, got %v", tx.Input.Get("gpubkey").Type())
 	}
 	ghash, ok := tx.Input.Get("ghash").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for ghash: expected pack.Bytes32, got %v", tx.Input.Get("ghash").Type())
+		return nil, fmt.Errorf("unexpected type for ghash: expected pack.Bytes32, got %v", tx.Input.Get("ghash").Type())
 	}
 
-	script := `INSERT INTO gateways
-(gateway_address, status, created_time, selector, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
-	_, err := db.db.Exec(script,
+	return []interface{}{
 		address,
 		GatewayStatusEmpty,
-		time.Now().Unix(),
+		db.clock.Unix(),
 		tx.Selector.String(),
 		payload.String(),
 		phash.String(),
@@ -151,13 +547,13 @@ VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
 		gpubkey.String(),
 		ghash.String(),
 		tx.Version.String(),
-	)
-
-	return err
+	}, nil
 }
 
 // Returns the gateway information for a given address
 func (db database) Gateway(address string) (tx.Tx, error) {
+	defer db.observe("Gateway", time.Now(), address)
+
 	script := "SELECT gateway_address, selector, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM gateways WHERE gateway_address = $1"
 	row := db.db.QueryRow(script, address)
 	err := row.Err()
@@ -180,62 +576,89 @@ func (db database) GatewayCount() (int, error) {
 	return count, err
 }
 
-// Returns a page of stored gateway information
-func (db database) Gateways(offset, limit int) ([]tx.Tx, error) {
-	gateways := make([]tx.Tx, 0, limit)
+// Gateways implements the DB interface.
+func (db database) Gateways(offset, limit int, status GatewayStatus) ([]GatewayInfo, error) {
+	defer db.observe("Gateways", time.Now(), offset, limit, status)
 
-	rows, err := db.db.Query(`SELECT gateway_address, selector, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM gateways ORDER BY created_time DESC LIMIT $1 OFFSET $2;`, limit, offset)
+	gateways := make([]GatewayInfo, 0, limit)
+	where := ""
+	args := []interface{}{}
+	if status != GatewayStatusNil {
+		args = append(args, status)
+		where = fmt.Sprintf("WHERE status = $%d", len(args))
+	}
+	args = append(args, limit, offset)
+	queryString := fmt.Sprintf(`SELECT gateway_address, selector, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version, status, created_time, expiry_time FROM gateways
+		%s ORDER BY created_time DESC, gateway_address LIMIT $%d OFFSET $%d;`, where, len(args)-1, len(args))
+
+	rows, err := db.db.Query(queryString, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Loop through rows and convert them to transactions.
 	for rows.Next() {
-		tx, err := rowToGateway(rows)
+		gateway, err := rowToGatewayInfo(rows)
 		if err != nil {
 			return nil, err
 		}
-		gateways = append(gateways, tx)
+		gateways = append(gateways, gateway)
 	}
 	return gateways, rows.Err()
 }
 
 func rowToGateway(row Scannable) (tx.Tx, error) {
-	var gatewayAddress, selector, payloadStr, phashStr, toStr, nonceStr, nhashStr, gpubkeyStr, ghashStr, version string
-	if err := row.Scan(&gatewayAddress, &selector, &payloadStr, &phashStr, &toStr, &nonceStr, &nhashStr, &gpubkeyStr, &ghashStr, &version); err != nil {
-		return tx.Tx{}, err
+	_, gateway, err := scanGateway(row)
+	return gateway, err
+}
+
+// scanGateway scans the columns of a gateway into its address and tx, and any
+// columns which follow them into extra.
+//
+// Columns which are missing or cannot be decoded are returned as a
+// DecodeError, whereas errors reading the row are returned as they are.
+func scanGateway(row Scannable, extra ...interface{}) (string, tx.Tx, error) {
+	var gatewayAddress string
+	var selector, payloadStr, phashStr, toStr, nonceStr, nhashStr, gpubkeyStr, ghashStr, version sql.NullString
+	dest := append([]interface{}{&gatewayAddress, &selector, &payloadStr, &phashStr, &toStr, &nonceStr, &nhashStr, &gpubkeyStr, &ghashStr, &version}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return "", tx.Tx{}, err
+	}
+	for _, column := range []sql.NullString{selector, payloadStr, phashStr, toStr, nonceStr, nhashStr, gpubkeyStr, ghashStr} {
+		if !column.Valid {
+			return "", tx.Tx{}, DecodeError{fmt.Errorf("gateway %v is missing columns", gatewayAddress)}
+		}
 	}
 
-	payload, err := decodeBytes(payloadStr)
+	payload, err := decodeBytes(payloadStr.String)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("decoding payload %v: %v", payloadStr, err)
+		return "", tx.Tx{}, DecodeError{fmt.Errorf("decoding payload %v: %v", payloadStr.String, err)}
 	}
-	phash, err := decodeBytes32(phashStr)
+	phash, err := decodeBytes32(phashStr.String)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("decoding phash %v: %v", phashStr, err)
+		return "", tx.Tx{}, DecodeError{fmt.Errorf("decoding phash %v: %v", phashStr.String, err)}
 	}
-	nonce, err := decodeBytes32(nonceStr)
+	nonce, err := decodeBytes32(nonceStr.String)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("decoding nonce %v: %v", nonceStr, err)
+		return "", tx.Tx{}, DecodeError{fmt.Errorf("decoding nonce %v: %v", nonceStr.String, err)}
 	}
-	nhash, err := decodeBytes32(nhashStr)
+	nhash, err := decodeBytes32(nhashStr.String)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("decoding nhash %v: %v", nhashStr, err)
+		return "", tx.Tx{}, DecodeError{fmt.Errorf("decoding nhash %v: %v", nhashStr.String, err)}
 	}
-	gpubkey, err := decodeBytes(gpubkeyStr)
+	gpubkey, err := decodeBytes(gpubkeyStr.String)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("decoding gpubkey %v: %v", gpubkeyStr, err)
+		return "", tx.Tx{}, DecodeError{fmt.Errorf("decoding gpubkey %v: %v", gpubkeyStr.String, err)}
 	}
-	ghash, err := decodeBytes32(ghashStr)
+	ghash, err := decodeBytes32(ghashStr.String)
 	if err != nil {
-		return tx.Tx{}, fmt.Errorf("decoding ghash %v: %v", ghashStr, err)
+		return "", tx.Tx{}, DecodeError{fmt.Errorf("decoding ghash %v: %v", ghashStr.String, err)}
 	}
 	input, err := pack.Encode(
 		engine.LockMintBurnReleaseInput{
 			Payload: payload,
 			Phash:   phash,
-			To:      pack.String(toStr),
+			To:      pack.String(toStr.String),
 			Nonce:   nonce,
 			Nhash:   nhash,
 			Gpubkey: gpubkey,
@@ -243,20 +666,72 @@ func rowToGateway(row Scannable) (tx.Tx, error) {
 		},
 	)
 	if err != nil {
-		return tx.Tx{}, err
+		return "", tx.Tx{}, DecodeError{err}
 	}
 
-	return tx.Tx{
-		Selector: tx.Selector(selector),
+	return gatewayAddress, tx.Tx{
+		Selector: tx.Selector(selector.String),
 		Input:    pack.Typed(input.(pack.Struct)),
-	}, err
+	}, nil
 }
 
 // Init creates the tables for storing transactions if they do not already
-// exist. The tables will only be created the first time this function is called
-// and any future calls will not return an error.
+// exist, brings them up to the baseline schema of the dialect of the database,
+// and then applies the migrations which have not been applied yet. The tables
+// will only be created the first time this function is called and any future
+// calls will not return an error, unless the schema has since been migrated by
+// a Lightnode which is not compatible with this one.
 func (db database) Init() error {
-	script := `CREATE TABLE IF NOT EXISTS txs (
+	if err := db.checkSchemaVersion(); err != nil {
+		return err
+	}
+	for i, statement := range db.dialect.baseline() {
+		if _, err := db.db.Exec(statement); err != nil {
+			return fmt.Errorf("applying %v baseline %v: %v", db.dialect.name(), i, err)
+		}
+	}
+	for _, column := range addedColumns {
+		if err := db.addColumn(column.table, column.name, column.definition); err != nil {
+			return fmt.Errorf("adding column %v to %v: %v", column.name, column.table, err)
+		}
+	}
+	if err := db.migrate(); err != nil {
+		return err
+	}
+	return db.recordSchemaVersion()
+}
+
+// addedColumns are columns which were added to existing tables before
+// migrations were recorded. They are in the schema of new tables, but tables
+// created before them are not changed by `CREATE TABLE IF NOT EXISTS`, so they
+// are added by Init. New columns are added by migrations instead.
+var addedColumns = []struct {
+	table      string
+	name       string
+	definition string
+}{
+	{"gateways", "expiry_time", "BIGINT"},
+}
+
+// addColumn adds the column to the table, unless it already exists.
+func (db database) addColumn(table, column, definition string) error {
+	var count int
+	if err := db.db.QueryRow(db.dialect.columnExists(), table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := db.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	return err
+}
+
+// schema creates the tables shared by all dialects. All statements must be
+// safe to run more than once, as the schema is applied every time the database
+// is initialised. New tables can be added here, but changes to existing tables
+// must be made by migrations, as this does not change tables which already
+// exist.
+const schema = `CREATE TABLE IF NOT EXISTS txs (
 		hash               VARCHAR NOT NULL PRIMARY KEY,
 		status             SMALLINT,
 		created_time       BIGINT,
@@ -273,6 +748,26 @@ func (db database) Init() error {
 		ghash              VARCHAR,
 		version            VARCHAR
 	);
+CREATE INDEX IF NOT EXISTS txs_to_address ON txs (to_address, created_time);
+CREATE INDEX IF NOT EXISTS txs_created_time ON txs (created_time, hash);
+CREATE TABLE IF NOT EXISTS txs_archive (
+		hash               VARCHAR NOT NULL PRIMARY KEY,
+		status             SMALLINT,
+		created_time       BIGINT,
+		selector           VARCHAR(255),
+		txid               VARCHAR,
+		txindex            BIGINT,
+		amount             VARCHAR(100),
+		payload            VARCHAR,
+		phash              VARCHAR,
+		to_address         VARCHAR,
+		nonce              VARCHAR,
+		nhash              VARCHAR,
+		gpubkey            VARCHAR,
+		ghash              VARCHAR,
+		version            VARCHAR,
+		archived_time      BIGINT
+	);
 CREATE TABLE IF NOT EXISTS gateways (
 		gateway_address    VARCHAR NOT NULL PRIMARY KEY,
 		status             SMALLINT,
@@ -285,61 +780,176 @@ CREATE TABLE IF NOT EXISTS gateways (
 		nhash              VARCHAR,
 		gpubkey            VARCHAR,
 		ghash              VARCHAR,
-		version            VARCHAR
+		version            VARCHAR,
+		expiry_time        BIGINT
+);
+CREATE TABLE IF NOT EXISTS gateway_deposits (
+		hash               VARCHAR NOT NULL PRIMARY KEY,
+		ghash              VARCHAR NOT NULL,
+		amount             VARCHAR(100),
+		created_time       BIGINT
+);
+CREATE INDEX IF NOT EXISTS gateway_deposits_ghash ON gateway_deposits (ghash);
+CREATE INDEX IF NOT EXISTS gateways_ghash ON gateways (ghash);
+CREATE TABLE IF NOT EXISTS shard_pubkeys (
+		gpubkey            VARCHAR NOT NULL PRIMARY KEY,
+		last_seen          BIGINT
+);
+CREATE TABLE IF NOT EXISTS compat_mappings (
+		mapping_key        VARCHAR NOT NULL PRIMARY KEY,
+		value              VARCHAR NOT NULL,
+		v1_hash            VARCHAR,
+		created_time       BIGINT,
+		expiry_time        BIGINT
+);
+CREATE INDEX IF NOT EXISTS compat_mappings_v1_hash ON compat_mappings (v1_hash);
+CREATE TABLE IF NOT EXISTS v0_payloads (
+		digest             VARCHAR NOT NULL PRIMARY KEY,
+		hash               VARCHAR NOT NULL,
+		payload            VARCHAR NOT NULL,
+		created_time       BIGINT
+);
+CREATE INDEX IF NOT EXISTS v0_payloads_hash ON v0_payloads (hash);
+CREATE TABLE IF NOT EXISTS dest_txids (
+		hash               VARCHAR NOT NULL PRIMARY KEY,
+		dest_txid          VARCHAR NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dest_txids_dest_txid ON dest_txids (dest_txid);
+CREATE TABLE IF NOT EXISTS tx_clients (
+		hash               VARCHAR NOT NULL PRIMARY KEY,
+		created_time       BIGINT,
+		user_agent         VARCHAR,
+		renjs_version      VARCHAR,
+		integrator         VARCHAR
+);
+CREATE INDEX IF NOT EXISTS tx_clients_created_time ON tx_clients (created_time);
+CREATE TABLE IF NOT EXISTS blocks (
+		height             BIGINT NOT NULL PRIMARY KEY,
+		block              VARCHAR NOT NULL,
+		created_time       BIGINT
+);
+CREATE TABLE IF NOT EXISTS submissions (
+		id                 VARCHAR NOT NULL PRIMARY KEY,
+		tx                 VARCHAR NOT NULL,
+		payload_size       BIGINT,
+		created_time       BIGINT
+);
+CREATE TABLE IF NOT EXISTS submission_chunks (
+		id                 VARCHAR NOT NULL,
+		chunk_offset       BIGINT NOT NULL,
+		size               BIGINT,
+		data               VARCHAR,
+		PRIMARY KEY (id, chunk_offset)
+);
+CREATE TABLE IF NOT EXISTS final_txs (
+		hash               VARCHAR NOT NULL PRIMARY KEY,
+		result             VARCHAR NOT NULL,
+		created_time       BIGINT
+);
+CREATE TABLE IF NOT EXISTS burn_events (
+		digest             VARCHAR NOT NULL PRIMARY KEY,
+		selector           VARCHAR,
+		block_number       BIGINT,
+		log_index          BIGINT,
+		created_time       BIGINT
+);
+CREATE TABLE IF NOT EXISTS hook_events (
+		target             VARCHAR NOT NULL,
+		sequence           BIGINT NOT NULL,
+		id                 VARCHAR NOT NULL,
+		data               VARCHAR NOT NULL,
+		created_time       BIGINT,
+		PRIMARY KEY (target, sequence)
+);
+CREATE TABLE IF NOT EXISTS hook_event_sequences (
+		target             VARCHAR NOT NULL PRIMARY KEY,
+		sequence           BIGINT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS lightnode_meta (
+		name               VARCHAR NOT NULL PRIMARY KEY,
+		value              VARCHAR NOT NULL
 );
 `
-	_, err := db.db.Exec(script)
-	return err
-}
 
 // InsertTx implements the DB interface.
 func (db database) InsertTx(tx tx.Tx) error {
+	defer db.observe("InsertTx", time.Now(), tx.Hash)
+
+	row, err := db.txToRow(tx)
+	if err != nil {
+		return err
+	}
+
+	script := `INSERT INTO txs (hash, status, created_time, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);`
+	_, err = db.db.Exec(script, row...)
+	return err
+}
+
+// InsertTxs implements the DB interface.
+func (db database) InsertTxs(txs []tx.Tx) error {
+	defer db.observe("InsertTxs", time.Now())
+
+	rows := make([][]interface{}, 0, len(txs))
+	for _, tx := range txs {
+		row, err := db.txToRow(tx)
+		if err != nil {
+			return fmt.Errorf("tx %v: %v", tx.Hash, err)
+		}
+		rows = append(rows, row)
+	}
+	return db.insertBatches("txs", txColumns, "hash", rows)
+}
+
+const txColumns = "hash, status, created_time, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version"
+
+// txToRow returns the column values used to persist the transaction, in the
+// order given by txColumns.
+func (db database) txToRow(tx tx.Tx) ([]interface{}, error) {
 	txid, ok := tx.Input.Get("txid").(pack.Bytes)
 	if !ok {
-		return fmt.Errorf("unexpected type for txid: expected pack.Bytes, got %v", tx.Input.Get("txid").Type())
+		return nil, fmt.Errorf("unexpected type for txid: expected pack.Bytes, got %v", tx.Input.Get("txid").Type())
 	}
 	txindex, ok := tx.Input.Get("txindex").(pack.U32)
 	if !ok {
-		return fmt.Errorf("unexpected type for txindex: expected pack.U32, got %v", tx.Input.Get("txindex").Type())
+		return nil, fmt.Errorf("unexpected type for txindex: expected pack.U32, got %v", tx.Input.Get("txindex").Type())
 	}
 	amount, ok := tx.Input.Get("amount").(pack.U256)
 	if !ok {
-		return fmt.Errorf("unexpected type for amount: expected pack.U256, got %v", tx.Input.Get("amount").Type())
+		return nil, fmt.Errorf("unexpected type for amount: expected pack.U256, got %v", tx.Input.Get("amount").Type())
 	}
 	payload, ok := tx.Input.Get("payload").(pack.Bytes)
 	if !ok {
-		return fmt.Errorf("unexpected type for payload: expected pack.Bytes, got %v", tx.Input.Get("payload").Type())
+		return nil, fmt.Errorf("unexpected type for payload: expected pack.Bytes, got %v", tx.Input.Get("payload").Type())
 	}
 	phash, ok := tx.Input.Get("phash").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for phash: expected pack.Bytes32, got %v", tx.Input.Get("phash").Type())
+		return nil, fmt.Errorf("unexpected type for phash: expected pack.Bytes32, got %v", tx.Input.Get("phash").Type())
 	}
 	to, ok := tx.Input.Get("to").(pack.String)
 	if !ok {
-		return fmt.Errorf("unexpected type for to: expected pack.String, got %v", tx.Input.Get("to").Type())
+		return nil, fmt.Errorf("unexpected type for to: expected pack.String, got %v", tx.Input.Get("to").Type())
 	}
 	nonce, ok := tx.Input.Get("nonce").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for nonce: expected pack.Bytes32, got %v", tx.Input.Get("nonce").Type())
+		return nil, fmt.Errorf("unexpected type for nonce: expected pack.Bytes32, got %v", tx.Input.Get("nonce").Type())
 	}
 	nhash, ok := tx.Input.Get("nhash").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for nhash: expected pack.Bytes32, got %v", tx.Input.Get("nhash").Type())
+		return nil, fmt.Errorf("unexpected type for nhash: expected pack.Bytes32, got %v", tx.Input.Get("nhash").Type())
 	}
 	gpubkey, ok := tx.Input.Get("gpubkey").(pack.Bytes)
 	if !ok {
-		return fmt.Errorf("unexpected type for gpubkey: expected pack.Bytes, got %v", tx.Input.Get("gpubkey").Type())
+		return nil, fmt.Errorf("unexpected type for gpubkey: expected pack.Bytes, got %v", tx.Input.Get("gpubkey").Type())
 	}
 	ghash, ok := tx.Input.Get("ghash").(pack.Bytes32)
 	if !ok {
-		return fmt.Errorf("unexpected type for ghash: expected pack.Bytes32, got %v", tx.Input.Get("ghash").Type())
+		return nil, fmt.Errorf("unexpected type for ghash: expected pack.Bytes32, got %v", tx.Input.Get("ghash").Type())
 	}
 
-	script := `INSERT INTO txs (hash, status, created_time, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);`
-	_, err := db.db.Exec(script,
+	return []interface{}{
 		tx.Hash.String(),
 		TxStatusConfirming,
-		time.Now().Unix(),
+		db.clock.Unix(),
 		tx.Selector.String(),
 		txid.String(),
 		txindex.String(),
@@ -352,19 +962,70 @@ func (db database) InsertTx(tx tx.Tx) error {
 		gpubkey.String(),
 		ghash.String(),
 		tx.Version.String(),
-	)
+	}, nil
+}
 
-	return err
+// insertBatches writes the rows into the given table using multi-row inserts
+// of at most db.batchSize rows, or fewer if the rows would need more
+// parameters than the dialect allows in a single statement. Each batch is
+// executed inside its own SQL transaction, and rows conflicting with an
+// existing primary key are skipped so that producers can safely retry a batch.
+func (db database) insertBatches(table, columns, key string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	batchSize := db.batchSize
+	if maxRows := db.dialect.maxParams() / len(rows[0]); batchSize > maxRows {
+		batchSize = maxRows
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := db.insertBatch(table, columns, onConflict(key), rows[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db database) insertBatch(table, columns, conflict string, rows [][]interface{}) error {
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(rows[0]))
+	for _, row := range rows {
+		placeholders := make([]string, len(row))
+		for i := range row {
+			placeholders[i] = db.dialect.placeholder(len(args) + i + 1)
+		}
+		values = append(values, fmt.Sprintf("(%s)", strings.Join(placeholders, ", ")))
+		args = append(args, row...)
+	}
+	script := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s;", table, columns, strings.Join(values, ", "), conflict)
+
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := sqlTx.Exec(script, args...); err != nil {
+		sqlTx.Rollback()
+		return fmt.Errorf("inserting batch of %v rows into %v: %v", len(rows), table, err)
+	}
+	return sqlTx.Commit()
 }
 
 // Tx implements the DB interface.
 func (db database) Tx(txHash id.Hash) (tx.Tx, error) {
-	script := "SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs WHERE hash = $1"
-	row := db.db.QueryRow(script, txHash.String())
-	err := row.Err()
+	defer db.observe("Tx", time.Now(), txHash)
+
+	stmt, err := db.stmts.get("SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs WHERE hash = $1")
 	if err != nil {
 		return tx.Tx{}, err
 	}
+	row := stmt.QueryRow(txHash.String())
+	if err := row.Err(); err != nil {
+		return tx.Tx{}, err
+	}
 	return rowToTx(row)
 }
 
@@ -396,10 +1057,102 @@ func (db database) Txs(offset, limit int, latest bool) ([]tx.Tx, error) {
 	return txs, rows.Err()
 }
 
-// TxsById implements the DB interface.
-func (db database) TxsByTxid(txid pack.Bytes) ([]tx.Tx, error) {
+// TxPageSize implements the DB interface.
+func (db database) TxPageSize(offset, limit int) (int, error) {
+	defer db.observe("TxPageSize", time.Now(), offset, limit)
+
+	var size int
+	err := db.db.QueryRow(`SELECT COUNT(*) FROM (SELECT hash FROM txs ORDER BY created_time LIMIT $1 OFFSET $2) AS page;`, limit, offset).Scan(&size)
+	return size, err
+}
+
+// TxCursor is the position of a tx in the order txs were created. Unlike
+// offsets, cursors do not get slower as they move through the table, and do
+// not skip or repeat txs which are inserted while paging.
+type TxCursor struct {
+	CreatedTime int64
+	Hash        string
+}
+
+// TxsAfter implements the DB interface.
+func (db database) TxsAfter(cursor TxCursor, limit int, latest bool, visit func(tx.Tx, TxCursor) error) error {
+	defer db.observe("TxsAfter", time.Now(), cursor, limit, latest)
+
+	order, after := "ASC", ">"
+	if latest {
+		order, after = "DESC", "<"
+	}
+	// Placeholders are numbered in order of appearance, as SQLite binds them
+	// by the order in which they first appear.
+	where := ""
+	args := []interface{}{}
+	if cursor != (TxCursor{}) {
+		where = fmt.Sprintf("WHERE created_time %[1]s $1 OR (created_time = $1 AND hash %[1]s $2)", after)
+		args = append(args, cursor.CreatedTime, cursor.Hash)
+	}
+	args = append(args, limit)
+	queryString := fmt.Sprintf(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version, created_time FROM txs
+		%[1]s ORDER BY created_time %[2]s, hash %[2]s LIMIT $%[3]d;`, where, order, len(args))
+
+	rows, err := db.db.Query(queryString, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var createdTime sql.NullInt64
+		transaction, err := scanTx(rows, &createdTime)
+		if err != nil {
+			return err
+		}
+		if err := visit(transaction, TxCursor{CreatedTime: createdTime.Int64, Hash: transaction.Hash.String()}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exactTxCountLimit is the estimated number of transactions above which the
+// estimate is returned instead of counting every row.
+const exactTxCountLimit = 100000
+
+// TxCount implements the DB interface.
+func (db database) TxCount() (int, bool, error) {
+	if query := db.dialect.estimateRows("txs"); query != "" {
+		var estimate float64
+		err := db.db.QueryRow(query).Scan(&estimate)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, false, err
+		}
+		if estimate >= exactTxCountLimit {
+			return int(estimate), true, nil
+		}
+	}
+
+	var count int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM txs;`).Scan(&count); err != nil {
+		return 0, false, err
+	}
+	return count, false, nil
+}
+
+// TxsByTxid implements the DB interface.
+func (db database) TxsByTxid(txid pack.Bytes, selector string, status TxStatus) ([]tx.Tx, error) {
+	defer db.observe("TxsByTxid", time.Now(), txid, selector, status)
+
 	txs := make([]tx.Tx, 0)
-	rows, err := db.db.Query(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs WHERE txid = $1;`, txid.String())
+	where := "txid = $1"
+	args := []interface{}{txid.String()}
+	if selector != "" {
+		args = append(args, selector)
+		where += fmt.Sprintf(" AND selector = $%d", len(args))
+	}
+	if status != TxStatusNil {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	rows, err := db.db.Query(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs WHERE `+where+`;`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -416,13 +1169,126 @@ func (db database) TxsByTxid(txid pack.Bytes) ([]tx.Tx, error) {
 	return txs, rows.Err()
 }
 
+// InsertDestTxid implements the DB interface.
+func (db database) InsertDestTxid(txHash id.Hash, txid pack.Bytes) error {
+	_, err := db.db.Exec(`INSERT INTO dest_txids (hash, dest_txid) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING;`, txHash.String(), txid.String())
+	return err
+}
+
+// TxsByDestTxid implements the DB interface.
+func (db database) TxsByDestTxid(txid pack.Bytes) ([]tx.Tx, error) {
+	txs := make([]tx.Tx, 0)
+	rows, err := db.db.Query(`SELECT txs.hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs
+		INNER JOIN dest_txids ON txs.hash = dest_txids.hash WHERE dest_txids.dest_txid = $1;`, txid.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tx, err := rowToTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
+
+// UnreleasedBurns implements the DB interface.
+func (db database) UnreleasedBurns(window time.Duration, limit int) ([]tx.Tx, error) {
+	defer db.observe("UnreleasedBurns", time.Now(), window, limit)
+
+	rows, err := db.db.Query(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs
+		WHERE status = $1 AND selector LIKE $2 AND $3 - created_time < $4
+		AND NOT EXISTS (SELECT 1 FROM dest_txids WHERE dest_txids.hash = txs.hash)
+		ORDER BY created_time, hash LIMIT $5;`, TxStatusConfirmed, "%/from%", db.clock.Unix(), int(window.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := make([]tx.Tx, 0)
+	for rows.Next() {
+		transaction, err := rowToTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, transaction)
+	}
+	return txs, rows.Err()
+}
+
+// BurnsByNonce implements the DB interface. Mints of deposits to gateways
+// share their nonce, so burns are told apart by their selector, which
+// burns from the source chain.
+func (db database) BurnsByNonce(nonce pack.Bytes32, selector string) ([]tx.Tx, error) {
+	defer db.observe("BurnsByNonce", time.Now(), nonce, selector)
+
+	where := "nonce = $1 AND selector LIKE $2"
+	args := []interface{}{nonce.String(), "%/from%"}
+	if selector != "" {
+		where += " AND selector = $3"
+		args = append(args, selector)
+	}
+	rows, err := db.db.Query(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs
+		WHERE `+where+` ORDER BY created_time, hash;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := make([]tx.Tx, 0)
+	for rows.Next() {
+		transaction, err := rowToTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, transaction)
+	}
+	return txs, rows.Err()
+}
+
+// TxsByRecipient implements the DB interface.
+func (db database) TxsByRecipient(to, selector string, offset, limit int) ([]tx.Tx, error) {
+	defer db.observe("TxsByRecipient", time.Now(), to, selector, offset, limit)
+
+	where := "WHERE to_address = $1"
+	args := []interface{}{to}
+	if selector != "" {
+		args = append(args, selector)
+		where += fmt.Sprintf(" AND selector = $%d", len(args))
+	}
+	args = append(args, limit, offset)
+	queryString := fmt.Sprintf(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs
+		%s ORDER BY created_time DESC, hash LIMIT $%d OFFSET $%d;`, where, len(args)-1, len(args))
+
+	rows, err := db.db.Query(queryString, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := make([]tx.Tx, 0, limit)
+	for rows.Next() {
+		transaction, err := rowToTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, transaction)
+	}
+	return txs, rows.Err()
+}
+
 // PendingTxs implements the DB interface.
 func (db database) PendingTxs(expiry time.Duration) ([]tx.Tx, error) {
+	defer db.observe("PendingTxs", time.Now(), expiry)
+
 	txs := make([]tx.Tx, 0, 128)
 
 	// Get pending transactions from the database.
 	rows, err := db.db.Query(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version FROM txs
-		WHERE status = $1 AND $2 - created_time < $3;`, TxStatusConfirming, time.Now().Unix(), int64(expiry.Seconds()))
+		WHERE status = $1 AND $2 - created_time < $3;`, TxStatusConfirming, db.clock.Unix(), int64(expiry.Seconds()))
 	if err != nil {
 		return nil, err
 	}
@@ -438,18 +1304,66 @@ func (db database) PendingTxs(expiry time.Duration) ([]tx.Tx, error) {
 	return txs, rows.Err()
 }
 
+// PendingTxCount implements the DB interface.
+func (db database) PendingTxCount() (int, error) {
+	defer db.observe("PendingTxCount", time.Now())
+
+	var count int
+	err := db.db.QueryRow("SELECT COUNT(*) FROM txs WHERE status = $1 OR status = $2;", TxStatusConfirming, TxStatusConfirmed).Scan(&count)
+	return count, err
+}
+
+// UnfinishedBurns implements the DB interface.
+func (db database) UnfinishedBurns(before time.Time, cursor TxCursor, limit int) ([]tx.Tx, TxCursor, error) {
+	defer db.observe("UnfinishedBurns", time.Now(), before, cursor, limit)
+
+	where := "status = $1 AND selector LIKE $2 AND created_time < $3"
+	args := []interface{}{TxStatusConfirmed, "%/from%", before.Unix()}
+	if cursor != (TxCursor{}) {
+		args = append(args, cursor.CreatedTime, cursor.Hash)
+		where += fmt.Sprintf(" AND (created_time > $%[1]d OR (created_time = $%[1]d AND hash > $%[2]d))", len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	rows, err := db.db.Query(`SELECT hash, selector, txid, txindex, amount, payload, phash, to_address, nonce, nhash, gpubkey, ghash, version, created_time FROM txs
+		WHERE `+where+` AND NOT EXISTS (SELECT 1 FROM final_txs WHERE final_txs.hash = txs.hash)
+		ORDER BY created_time, hash LIMIT `+fmt.Sprintf("$%d", len(args))+`;`, args...)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer rows.Close()
+
+	txs := []tx.Tx{}
+	for rows.Next() {
+		var createdTime sql.NullInt64
+		transaction, err := scanTx(rows, &createdTime)
+		if err != nil {
+			return nil, cursor, err
+		}
+		txs = append(txs, transaction)
+		cursor = TxCursor{CreatedTime: createdTime.Int64, Hash: transaction.Hash.String()}
+	}
+	return txs, cursor, rows.Err()
+}
+
 // TxStatus implements the DB interface.
 func (db database) TxStatus(txHash id.Hash) (TxStatus, error) {
-	var status int
-	err := db.db.QueryRow(`SELECT status FROM txs WHERE hash = $1;`, txHash.String()).Scan(&status)
+	defer db.observe("TxStatus", time.Now(), txHash)
+
+	stmt, err := db.stmts.get(`SELECT status FROM txs WHERE hash = $1;`)
 	if err != nil {
 		return TxStatusNil, err
 	}
-	return TxStatus(status), err
+	var status int
+	if err := stmt.QueryRow(txHash.String()).Scan(&status); err != nil {
+		return TxStatusNil, err
+	}
+	return TxStatus(status), nil
 }
 
 // UpdateStatus implements the DB interface.
 func (db database) UpdateStatus(txHash id.Hash, status TxStatus) error {
+	defer db.observe("UpdateStatus", time.Now(), txHash, status)
+
 	r, err := db.db.Exec("UPDATE txs SET status = $1 WHERE hash = $2 AND status < $1;", status, txHash.String())
 	updated, err := r.RowsAffected()
 	if err != nil {
@@ -461,16 +1375,140 @@ func (db database) UpdateStatus(txHash id.Hash, status TxStatus) error {
 	return err
 }
 
-// Prune deletes txs which have expired based on the given expiry.
+// Prune archives txs which have expired based on the given expiry. Archived
+// txs are kept until they are purged, so that an overly aggressive expiry does
+// not immediately destroy the tx history.
 func (db database) Prune(expiry time.Duration) error {
-	_, err := db.db.Exec("DELETE FROM txs WHERE $1 - created_time > $2;", time.Now().Unix(), int(expiry.Seconds()))
+	_, err := db.PruneWithPolicy(PrunePolicy{Done: expiry, Unconfirmed: expiry}, false)
 	return err
 }
 
+// PruneWithPolicy implements the DB interface. All categories are pruned in a
+// single SQL transaction.
+func (db database) PruneWithPolicy(policy PrunePolicy, dryRun bool) (PruneReport, error) {
+	report := PruneReport{DryRun: dryRun}
+	now := db.clock.Unix()
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return report, err
+	}
+
+	categories := []struct {
+		name    string
+		expiry  time.Duration
+		table   string
+		where   string
+		args    []interface{}
+		archive bool
+		count   *int64
+	}{
+		{"done txs", policy.Done, "txs", "status >= $3", []interface{}{TxStatusConfirmed}, true, &report.Done},
+		{"unconfirmed txs", policy.Unconfirmed, "txs", "status < $3", []interface{}{TxStatusConfirmed}, true, &report.Unconfirmed},
+		// Gateways which have been renewed are kept until their own expiry,
+		// even if it is later than the expiry of the category.
+		{"gateways", policy.Gateways, "gateways", "(expiry_time IS NULL OR expiry_time < $1)", nil, false, &report.Gateways},
+		{"burn events", policy.BurnEvents, "burn_events", "", nil, false, &report.BurnEvents},
+		{"clients", policy.Clients, "tx_clients", "", nil, false, &report.Clients},
+	}
+	for _, category := range categories {
+		if category.expiry == 0 {
+			continue
+		}
+		where := "$1 - created_time > $2"
+		if category.where != "" {
+			where += " AND " + category.where
+		}
+		args := append([]interface{}{now, int(category.expiry.Seconds())}, category.args...)
+
+		if dryRun {
+			if err := sqlTx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s;", category.table, where), args...).Scan(category.count); err != nil {
+				sqlTx.Rollback()
+				return report, fmt.Errorf("counting %v: %v", category.name, err)
+			}
+			continue
+		}
+
+		if category.archive {
+			archive := fmt.Sprintf(`INSERT INTO txs_archive (%s, archived_time)
+SELECT %s, CAST($1 AS BIGINT) FROM txs WHERE %s
+ON CONFLICT (hash) DO NOTHING;`, txColumns, txColumns, where)
+			if _, err := sqlTx.Exec(archive, args...); err != nil {
+				sqlTx.Rollback()
+				return report, fmt.Errorf("archiving %v: %v", category.name, err)
+			}
+		}
+		r, err := sqlTx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s;", category.table, where), args...)
+		if err != nil {
+			sqlTx.Rollback()
+			return report, fmt.Errorf("deleting %v: %v", category.name, err)
+		}
+		if *category.count, err = r.RowsAffected(); err != nil {
+			sqlTx.Rollback()
+			return report, err
+		}
+	}
+	if dryRun {
+		return report, sqlTx.Rollback()
+	}
+
+	// Destination txids are only looked up through their txs, so they are
+	// removed once their txs have been archived.
+	if _, err := sqlTx.Exec("DELETE FROM dest_txids WHERE NOT EXISTS (SELECT 1 FROM txs WHERE txs.hash = dest_txids.hash);"); err != nil {
+		sqlTx.Rollback()
+		return report, fmt.Errorf("deleting destination txids: %v", err)
+	}
+	return report, sqlTx.Commit()
+}
+
+// PurgeArchive implements the DB interface.
+func (db database) PurgeArchive(retention time.Duration) error {
+	_, err := db.db.Exec("DELETE FROM txs_archive WHERE $1 - archived_time > $2;", db.clock.Unix(), int(retention.Seconds()))
+	return err
+}
+
+// RestoreTx implements the DB interface. The created time of the restored tx
+// is reset so that it is not archived again by the next prune.
+func (db database) RestoreTx(txHash id.Hash) error {
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	columns := strings.Replace(txColumns, "created_time", "CAST($1 AS BIGINT)", 1)
+	restore := fmt.Sprintf(`INSERT INTO txs (%s)
+SELECT %s FROM txs_archive WHERE hash = $2
+ON CONFLICT (hash) DO NOTHING;`, txColumns, columns)
+	if _, err := sqlTx.Exec(restore, db.clock.Unix(), txHash.String()); err != nil {
+		sqlTx.Rollback()
+		return fmt.Errorf("restoring tx: %v", err)
+	}
+	r, err := sqlTx.Exec("DELETE FROM txs_archive WHERE hash = $1;", txHash.String())
+	if err != nil {
+		sqlTx.Rollback()
+		return fmt.Errorf("removing tx from archive: %v", err)
+	}
+	deleted, err := r.RowsAffected()
+	if err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if deleted == 0 {
+		sqlTx.Rollback()
+		return sql.ErrNoRows
+	}
+	return sqlTx.Commit()
+}
+
 func rowToTx(row Scannable) (tx.Tx, error) {
+	return scanTx(row)
+}
+
+// scanTx scans the columns of a tx into the tx, and any columns which follow
+// them into extra.
+func scanTx(row Scannable, extra ...interface{}) (tx.Tx, error) {
 	var hash, selector, txidStr, amountStr, payloadStr, phashStr, toStr, nonceStr, nhashStr, gpubkeyStr, ghashStr, version string
 	var txindex int
-	if err := row.Scan(&hash, &selector, &txidStr, &txindex, &amountStr, &payloadStr, &phashStr, &toStr, &nonceStr, &nhashStr, &gpubkeyStr, &ghashStr, &version); err != nil {
+	dest := append([]interface{}{&hash, &selector, &txidStr, &txindex, &amountStr, &payloadStr, &phashStr, &toStr, &nonceStr, &nhashStr, &gpubkeyStr, &ghashStr, &version}, extra...)
+	if err := row.Scan(dest...); err != nil {
 		return tx.Tx{}, err
 	}
 
@@ -2,6 +2,7 @@ package db_test
 
 import (
 	"database/sql"
+	"fmt"
 	"math/rand"
 	"os"
 	"testing/quick"
@@ -17,6 +18,7 @@ import (
 	. "github.com/renproject/lightnode/testutils"
 	"github.com/renproject/pack"
 
+	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/darknode/tx/txutil"
 )
@@ -56,7 +58,7 @@ var _ = Describe("Lightnode db", func() {
 	}
 
 	cleanUp := func(db *sql.DB) {
-		dropTxs := "DROP TABLE IF EXISTS txs; DROP TABLE IF EXISTS gateways;"
+		dropTxs := "DROP TABLE IF EXISTS txs; DROP TABLE IF EXISTS txs_archive; DROP TABLE IF EXISTS gateways; DROP TABLE IF EXISTS dest_txids; DROP TABLE IF EXISTS tx_clients; DROP TABLE IF EXISTS blocks; DROP TABLE IF EXISTS submissions; DROP TABLE IF EXISTS submission_chunks; DROP TABLE IF EXISTS burn_events; DROP TABLE IF EXISTS hook_events; DROP TABLE IF EXISTS hook_event_sequences; DROP TABLE IF EXISTS final_txs; DROP TABLE IF EXISTS gateway_deposits; DROP TABLE IF EXISTS v0_payloads; DROP TABLE IF EXISTS compat_mappings; DROP TABLE IF EXISTS shard_pubkeys; DROP TABLE IF EXISTS lightnode_meta; DROP TABLE IF EXISTS schema_migrations;"
 		_, err := db.Exec(dropTxs)
 		Expect(err).NotTo(HaveOccurred())
 	}
@@ -81,7 +83,7 @@ var _ = Describe("Lightnode db", func() {
 				It("should create tables if they do not exist", func() {
 					sqlDB := init(dbname)
 					defer destroy(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					// Tables should not exist before creation.
 					Expect(CheckTableExistence(dbname, "txs", sqlDB)).Should(HaveOccurred())
@@ -98,13 +100,70 @@ var _ = Describe("Lightnode db", func() {
 					Expect(CheckTableExistence(dbname, "txs", sqlDB)).NotTo(HaveOccurred())
 					Expect(CheckTableExistence(dbname, "gateways", sqlDB)).NotTo(HaveOccurred())
 				})
+
+				It("should refuse schemas migrated by an incompatible lightnode", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).To(Succeed())
+
+					var version string
+					Expect(sqlDB.QueryRow("SELECT value FROM lightnode_meta WHERE name = 'schema_version';").Scan(&version)).To(Succeed())
+					Expect(version).To(Equal(fmt.Sprint(SchemaVersion)))
+
+					// A newer lightnode which remains compatible should not
+					// stop this one from starting.
+					_, err := sqlDB.Exec("UPDATE lightnode_meta SET value = $1 WHERE name = 'schema_version';", fmt.Sprint(SchemaVersion+1))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(db.Init()).To(Succeed())
+					Expect(sqlDB.QueryRow("SELECT value FROM lightnode_meta WHERE name = 'schema_version';").Scan(&version)).To(Succeed())
+					Expect(version).To(Equal(fmt.Sprint(SchemaVersion + 1)))
+
+					_, err = sqlDB.Exec("UPDATE lightnode_meta SET value = $1 WHERE name = 'min_schema_version';", fmt.Sprint(SchemaVersion+1))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(db.Init()).NotTo(Succeed())
+
+					// Versions which cannot be read should not be mistaken
+					// for an uninitialised database.
+					_, err = sqlDB.Exec("UPDATE lightnode_meta SET value = 'corrupt' WHERE name = 'min_schema_version';")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(db.Init()).NotTo(Succeed())
+				})
+
+				It("should apply migrations once and roll them back", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).To(Succeed())
+					Expect(db.Init()).To(Succeed())
+
+					var latest, count int
+					Expect(sqlDB.QueryRow("SELECT MAX(version), COUNT(*) FROM schema_migrations;").Scan(&latest, &count)).To(Succeed())
+					Expect(latest).To(Equal(SchemaVersion))
+					Expect(count).To(Equal(SchemaVersion - 5))
+
+					// Migrations are only safe to apply once, so applying them
+					// again after rolling back checks that they were reverted.
+					Expect(db.RollbackSchema(5)).To(Succeed())
+					Expect(sqlDB.QueryRow("SELECT COUNT(*) FROM schema_migrations;").Scan(&count)).To(Succeed())
+					Expect(count).To(BeZero())
+					var version string
+					Expect(sqlDB.QueryRow("SELECT value FROM lightnode_meta WHERE name = 'schema_version';").Scan(&version)).To(Succeed())
+					Expect(version).To(Equal("5"))
+					Expect(db.Init()).To(Succeed())
+					Expect(sqlDB.QueryRow("SELECT MAX(version) FROM schema_migrations;").Scan(&latest)).To(Succeed())
+					Expect(latest).To(Equal(SchemaVersion))
+
+					// The baseline cannot be rolled back.
+					Expect(db.RollbackSchema(4)).NotTo(Succeed())
+				})
 			})
 
 			Context("when interacting with db", func() {
 				It("should be able to read and write tx", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -125,7 +184,7 @@ var _ = Describe("Lightnode db", func() {
 				It("should be able to read and write gateways", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -147,10 +206,219 @@ var _ = Describe("Lightnode db", func() {
 					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
 				})
 
+				It("should remove partially written gateways", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					transaction := txutil.RandomGoodTx(r)
+					Expect(db.InsertGateway("complete", transaction)).Should(Succeed())
+					_, err := sqlDB.Exec("INSERT INTO gateways (gateway_address, status) VALUES ($1, $2);", "partial", GatewayStatusEmpty)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = db.Gateway("partial")
+					Expect(IsDecodeError(err)).Should(BeTrue())
+
+					removed, err := db.RepairGateways()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(removed).Should(Equal(1))
+
+					_, err = db.Gateway("partial")
+					Expect(err).Should(Equal(sql.ErrNoRows))
+					_, err = db.Gateway("complete")
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("should track the deposits made to gateways", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					transaction := txutil.RandomGoodTx(r)
+					Expect(db.InsertGateway("gateway", transaction)).Should(Succeed())
+					ghash := transaction.Input.Get("ghash").(pack.Bytes32)
+
+					usage, err := db.GatewayUsage(ghash)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(usage.DepositCount).Should(BeZero())
+					Expect(usage.DepositTotal).Should(Equal(pack.NewU256FromU64(0)))
+
+					// Recording the same deposit twice should only count it
+					// once.
+					Expect(db.InsertGatewayDeposit(id.Hash{1}, ghash, pack.NewU256FromU64(100))).Should(Succeed())
+					Expect(db.InsertGatewayDeposit(id.Hash{1}, ghash, pack.NewU256FromU64(100))).Should(Succeed())
+					Expect(db.InsertGatewayDeposit(id.Hash{2}, ghash, pack.NewU256FromU64(50))).Should(Succeed())
+					Expect(db.InsertGatewayDeposit(id.Hash{3}, pack.Bytes32{}, pack.NewU256FromU64(10))).Should(Succeed())
+
+					usage, err = db.GatewayUsage(ghash)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(usage.DepositCount).Should(Equal(2))
+					Expect(usage.DepositTotal).Should(Equal(pack.NewU256FromU64(150)))
+					Expect(usage.LastDeposit).ShouldNot(BeZero())
+
+					var status GatewayStatus
+					Expect(sqlDB.QueryRow("SELECT status FROM gateways WHERE gateway_address = $1;", "gateway").Scan(&status)).Should(Succeed())
+					Expect(status).Should(Equal(GatewayStatusUsed))
+				})
+
+				It("should invalidate gateways of retired shards", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					retired := txutil.RandomGoodTx(r)
+					active := txutil.RandomGoodTx(r)
+					unknown := txutil.RandomGoodTx(r)
+					Expect(db.InsertGateway("retired", retired)).Should(Succeed())
+					Expect(db.InsertGateway("active", active)).Should(Succeed())
+					Expect(db.InsertGateway("unknown", unknown)).Should(Succeed())
+
+					retiredPubKey := retired.Input.Get("gpubkey").(pack.Bytes)
+					activePubKey := active.Input.Get("gpubkey").(pack.Bytes)
+					Expect(db.RecordShardPubKeys([]pack.Bytes{retiredPubKey, activePubKey})).Should(Succeed())
+					_, err := sqlDB.Exec("UPDATE shard_pubkeys SET last_seen = $1 WHERE gpubkey = $2;", time.Now().Add(-2*time.Hour).Unix(), retiredPubKey.String())
+					Expect(err).NotTo(HaveOccurred())
+
+					invalidated, err := db.InvalidateGateways(time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(invalidated).Should(Equal(int64(1)))
+					invalidated, err = db.InvalidateGateways(time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(invalidated).Should(BeZero())
+
+					for address, expected := range map[string]GatewayStatus{
+						"retired": GatewayStatusInvalid,
+						"active":  GatewayStatusEmpty,
+						"unknown": GatewayStatusEmpty,
+					} {
+						status, err := db.GatewayStatus(address)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(status).Should(Equal(expected))
+					}
+
+					// Deposits to an invalidated gateway should not mark it as
+					// used again.
+					Expect(db.InsertGatewayDeposit(id.Hash{1}, retired.Input.Get("ghash").(pack.Bytes32), pack.NewU256FromU64(100))).Should(Succeed())
+					status, err := db.GatewayStatus("retired")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(status).Should(Equal(GatewayStatusInvalid))
+				})
+
+				It("should be able to store v0 payloads by their digest", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 10)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					// Payloads which only differ in formatting are stored
+					// separately, as they are what the client submitted.
+					payload := []byte(`{"tx":{"to":"BTC0Btc2Eth"}}`)
+					other := []byte(`{ "tx": { "to": "BTC0Btc2Eth" } }`)
+					digest, err := db.InsertV0Payload(id.Hash{1}, payload)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(digest).Should(Equal(V0PayloadDigest(payload)))
+					_, err = db.InsertV0Payload(id.Hash{1}, payload)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = db.InsertV0Payload(id.Hash{1}, other)
+					Expect(err).NotTo(HaveOccurred())
+
+					stored, err := db.V0Payload(digest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stored.TxHash).Should(Equal(id.Hash{1}))
+					Expect(stored.Payload).Should(Equal(payload))
+
+					payloads, err := db.V0PayloadsByTx(id.Hash{1})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(payloads).Should(HaveLen(2))
+
+					_, err = db.V0Payload(id.Hash{2})
+					Expect(err).Should(Equal(sql.ErrNoRows))
+				})
+
+				It("should be able to batch write txs and gateways", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 3)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					test := func() bool {
+						Expect(db.Init()).Should(Succeed())
+						defer cleanUp(sqlDB)
+
+						txs := make([]tx.Tx, 10)
+						gateways := map[string]tx.Tx{}
+						for i := range txs {
+							transaction := txutil.RandomGoodTx(r)
+							transaction.Output = nil
+							txs[i] = transaction
+							gateways[transaction.Hash.String()] = transaction
+						}
+						Expect(db.InsertTxs(txs)).Should(Succeed())
+						Expect(db.InsertGateways(gateways)).Should(Succeed())
+
+						// Inserting the same rows again should not fail or
+						// create duplicate entries.
+						Expect(db.InsertTx(txs[0])).ShouldNot(Succeed())
+						Expect(db.InsertTxs(txs[:5])).Should(Succeed())
+						Expect(db.InsertGateways(gateways)).Should(Succeed())
+
+						numTxs, err := NumOfDataEntries(sqlDB, "txs")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numTxs).Should(Equal(len(txs)))
+						numGateways, err := NumOfDataEntries(sqlDB, "gateways")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numGateways).Should(Equal(len(gateways)))
+
+						for _, transaction := range txs {
+							newTransaction, err := db.Tx(transaction.Hash)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(transaction).Should(Equal(newTransaction))
+						}
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
+				})
+
+				It("should split batches which need more parameters than the dialect allows", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					var db DB
+					if dbname == Postgres {
+						db = NewPostgres(sqlDB, 100, 5000)
+					} else {
+						db = NewSQLite(sqlDB, 100, 5000)
+					}
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					// 5000 txs with 15 columns each need more parameters
+					// than either dialect allows in a single statement.
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					txs := make([]tx.Tx, 5000)
+					for i := range txs {
+						txs[i] = txutil.RandomGoodTx(r)
+					}
+					Expect(db.InsertTxs(txs)).Should(Succeed())
+
+					numTxs, err := NumOfDataEntries(sqlDB, "txs")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(numTxs).Should(Equal(len(txs)))
+				})
+
 				It("should be able to write tx and query by txid", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -161,7 +429,7 @@ var _ = Describe("Lightnode db", func() {
 						txid, ok := transaction.Input.Get("txid").(pack.Bytes)
 						Expect(ok).To(Equal(true))
 						Expect(db.InsertTx(transaction)).Should(Succeed())
-						newTransaction, err := db.TxsByTxid(txid)
+						newTransaction, err := db.TxsByTxid(txid, "", TxStatusNil)
 						Expect(err).NotTo(HaveOccurred())
 						Expect(transaction).Should(Equal(newTransaction[0]))
 						return true
@@ -169,13 +437,448 @@ var _ = Describe("Lightnode db", func() {
 
 					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
 				})
+
+				It("should filter txs by txid by selector and status", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					test := func() bool {
+						Expect(db.Init()).Should(Succeed())
+						defer cleanUp(sqlDB)
+						transaction := txutil.RandomGoodTx(r)
+						transaction.Output = nil
+						txid, ok := transaction.Input.Get("txid").(pack.Bytes)
+						Expect(ok).To(Equal(true))
+						Expect(db.InsertTx(transaction)).Should(Succeed())
+
+						txs, err := db.TxsByTxid(txid, transaction.Selector.String(), TxStatusConfirming)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txs).To(Equal([]tx.Tx{transaction}))
+
+						txs, err = db.TxsByTxid(txid, "UNKNOWN/toEthereum", TxStatusNil)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txs).To(BeEmpty())
+
+						Expect(db.UpdateStatus(transaction.Hash, TxStatusSubmitted)).Should(Succeed())
+						txs, err = db.TxsByTxid(txid, "", TxStatusConfirming)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txs).To(BeEmpty())
+						txs, err = db.TxsByTxid(txid, "", TxStatusSubmitted)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txs).To(HaveLen(1))
+						return true
+					}
+
+					Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+				})
+
+				It("should be able to query txs by the txid which completed them", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					test := func() bool {
+						Expect(db.Init()).Should(Succeed())
+						defer cleanUp(sqlDB)
+						transaction := txutil.RandomGoodTx(r)
+						transaction.Output = nil
+						Expect(db.InsertTx(transaction)).Should(Succeed())
+
+						destTxid := pack.Bytes(transaction.Hash[:])
+						Expect(db.InsertDestTxid(transaction.Hash, destTxid)).Should(Succeed())
+						// Recording the txid again does not overwrite it.
+						Expect(db.InsertDestTxid(transaction.Hash, pack.Bytes{1})).Should(Succeed())
+
+						txs, err := db.TxsByDestTxid(destTxid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txs).Should(Equal([]tx.Tx{transaction}))
+
+						txs, err = db.TxsByDestTxid(pack.Bytes{1})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(txs).Should(BeEmpty())
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
+				})
+
+				It("should only return burns whose release has not been recorded", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					burn := txutil.RandomGoodTx(r)
+					burn.Selector = "BTC/fromEthereum"
+					burn.Output = nil
+					mint := txutil.RandomGoodTx(r)
+					mint.Selector = "BTC/toEthereum"
+					for _, transaction := range []tx.Tx{burn, mint} {
+						Expect(db.InsertTx(transaction)).Should(Succeed())
+						Expect(db.UpdateStatus(transaction.Hash, TxStatusConfirmed)).Should(Succeed())
+					}
+
+					burns, err := db.UnreleasedBurns(time.Hour, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(burns).Should(Equal([]tx.Tx{burn}))
+
+					Expect(db.InsertDestTxid(burn.Hash, pack.Bytes{1})).Should(Succeed())
+					burns, err = db.UnreleasedBurns(time.Hour, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(burns).Should(BeEmpty())
+
+					// The destination txid is pruned along with its tx.
+					Expect(UpdateTxCreatedTime(sqlDB, "txs", burn.Hash, time.Now().Unix()-24*3600)).Should(Succeed())
+					_, err = db.PruneWithPolicy(PrunePolicy{Done: time.Hour}, false)
+					Expect(err).NotTo(HaveOccurred())
+					var count int
+					Expect(sqlDB.QueryRow("SELECT COUNT(*) FROM dest_txids;").Scan(&count)).Should(Succeed())
+					Expect(count).Should(Equal(0))
+				})
+
+				It("should be able to query burns by nonce", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					newTx := func(selector tx.Selector, txid byte, nonce pack.Bytes32) tx.Tx {
+						input, err := pack.Encode(engine.LockMintBurnReleaseInput{
+							Txid:  pack.Bytes{txid},
+							To:    "recipient",
+							Nonce: nonce,
+						})
+						Expect(err).NotTo(HaveOccurred())
+						transaction, err := tx.NewTx(selector, pack.Typed(input.(pack.Struct)))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(db.InsertTx(transaction)).Should(Succeed())
+						return transaction
+					}
+					hashes := func(txs []tx.Tx) []id.Hash {
+						hashes := make([]id.Hash, len(txs))
+						for i := range txs {
+							hashes[i] = txs[i].Hash
+						}
+						return hashes
+					}
+
+					nonce := pack.Bytes32{31: 7}
+					newTx("BTC/toEthereum", 1, nonce)
+					btcBurn := newTx("BTC/fromEthereum", 2, nonce)
+					zecBurn := newTx("ZEC/fromEthereum", 3, nonce)
+					newTx("BTC/fromEthereum", 4, pack.Bytes32{31: 8})
+
+					txs, err := db.BurnsByNonce(nonce, "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hashes(txs)).Should(ConsistOf(btcBurn.Hash, zecBurn.Hash))
+
+					txs, err = db.BurnsByNonce(nonce, "ZEC/fromEthereum")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hashes(txs)).Should(Equal([]id.Hash{zecBurn.Hash}))
+
+					txs, err = db.BurnsByNonce(pack.Bytes32{31: 9}, "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).Should(BeEmpty())
+				})
+
+				It("should be able to query txs by recipient", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					transaction := txutil.RandomGoodTx(r)
+					transaction.Output = nil
+					Expect(db.InsertTx(transaction)).Should(Succeed())
+					other := txutil.RandomGoodTx(r)
+					other.Output = nil
+					Expect(db.InsertTx(other)).Should(Succeed())
+
+					to := string(transaction.Input.Get("to").(pack.String))
+					txs, err := db.TxsByRecipient(to, "", 0, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).Should(Equal([]tx.Tx{transaction}))
+
+					txs, err = db.TxsByRecipient(to, transaction.Selector.String(), 0, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).Should(Equal([]tx.Tx{transaction}))
+
+					txs, err = db.TxsByRecipient(to, "unknown", 0, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).Should(BeEmpty())
+
+					txs, err = db.TxsByRecipient(to, "", 1, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).Should(BeEmpty())
+
+					txs, err = db.TxsByRecipient(to, transaction.Selector.String(), 1, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).Should(BeEmpty())
+				})
+
+				It("should page through txs with a cursor", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					inserted := []id.Hash{}
+					for i := 0; i < 5; i++ {
+						transaction := txutil.RandomGoodTx(r)
+						transaction.Output = nil
+						Expect(db.InsertTx(transaction)).Should(Succeed())
+						inserted = append(inserted, transaction.Hash)
+					}
+
+					// Txs are created within the same second, so the pages
+					// also depend on the order of the hashes. Every page
+					// after the first is read with a cursor.
+					page := func(latest bool) []id.Hash {
+						hashes := []id.Hash{}
+						sizes := []int{}
+						cursor := TxCursor{}
+						for {
+							n := 0
+							Expect(db.TxsAfter(cursor, 2, latest, func(transaction tx.Tx, txCursor TxCursor) error {
+								hashes = append(hashes, transaction.Hash)
+								cursor = txCursor
+								n++
+								return nil
+							})).Should(Succeed())
+							sizes = append(sizes, n)
+							if n < 2 {
+								Expect(sizes).Should(Equal([]int{2, 2, 1}))
+								return hashes
+							}
+						}
+					}
+					oldest := page(false)
+					Expect(oldest).Should(ConsistOf(inserted))
+					latest := page(true)
+					Expect(latest).Should(HaveLen(len(oldest)))
+					for i := range latest {
+						Expect(latest[i]).Should(Equal(oldest[len(oldest)-1-i]))
+					}
+
+					stop := fmt.Errorf("stop")
+					err := db.TxsAfter(TxCursor{}, 2, false, func(tx.Tx, TxCursor) error { return stop })
+					Expect(err).Should(Equal(stop))
+				})
+
+				It("should record the client which submitted each tx", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					metadata := []ClientMetadata{
+						{UserAgent: "node", RenJSVersion: "2.4.0", Integrator: "bridge"},
+						{UserAgent: "node", RenJSVersion: "2.4.0", Integrator: "bridge"},
+						{UserAgent: "firefox", RenJSVersion: "1.0.0", Integrator: "wallet"},
+					}
+					hashes := make([]id.Hash, len(metadata))
+					for i := range metadata {
+						hashes[i] = txutil.RandomGoodTx(r).Hash
+						Expect(db.InsertClientMetadata(hashes[i], metadata[i])).Should(Succeed())
+					}
+
+					// Recording the client again does not overwrite it.
+					Expect(db.InsertClientMetadata(hashes[0], ClientMetadata{Integrator: "other"})).Should(Succeed())
+					recorded, err := db.ClientMetadata(hashes[0])
+					Expect(err).NotTo(HaveOccurred())
+					Expect(recorded).Should(Equal(metadata[0]))
+
+					_, err = db.ClientMetadata(id.Hash{})
+					Expect(err).Should(Equal(sql.ErrNoRows))
+
+					summaries, err := db.ClientSummaries(time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(summaries).Should(HaveLen(2))
+					Expect(summaries[0].Integrator).Should(Equal("bridge"))
+					Expect(summaries[0].RenJSVersion).Should(Equal("2.4.0"))
+					Expect(summaries[0].Count).Should(Equal(2))
+					Expect(summaries[1].Integrator).Should(Equal("wallet"))
+					Expect(summaries[1].Count).Should(Equal(1))
+				})
+
+				It("should cache blocks by height", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 2)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					Expect(db.InsertBlocks(map[uint64][]byte{
+						1: []byte(`{"height":1}`),
+						2: []byte(`{"height":2}`),
+						4: []byte(`{"height":4}`),
+					})).Should(Succeed())
+
+					// Cached blocks are not overwritten.
+					Expect(db.InsertBlocks(map[uint64][]byte{1: []byte(`{"height":0}`)})).Should(Succeed())
+
+					blocks, err := db.Blocks(1, 2)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(blocks).Should(Equal([][]byte{[]byte(`{"height":1}`), []byte(`{"height":2}`)}))
+
+					blocks, err = db.Blocks(2, 3)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(blocks).Should(Equal([][]byte{[]byte(`{"height":2}`), []byte(`{"height":4}`)}))
+
+					Expect(db.PruneBlocks(1)).Should(Succeed())
+					blocks, err = db.Blocks(0, 5)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(blocks).Should(Equal([][]byte{[]byte(`{"height":4}`)}))
+				})
+
+				It("should assemble the payloads of submissions until they expire", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					transaction := txutil.RandomGoodTx(r)
+					Expect(db.InsertSubmission(Submission{ID: "submission", Tx: transaction, PayloadSize: 6})).Should(Succeed())
+					Expect(db.InsertSubmissionChunk("submission", 3, []byte("def"))).Should(Succeed())
+					Expect(db.InsertSubmissionChunk("submission", 0, []byte("abc"))).Should(Succeed())
+					Expect(db.InsertSubmissionChunk("submission", 0, []byte("xyz"))).Should(Succeed())
+
+					submission, err := db.Submission("submission", time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(submission.Tx.Hash).Should(Equal(transaction.Hash))
+					Expect(submission.PayloadSize).Should(Equal(uint64(6)))
+					Expect(submission.Received).Should(Equal(uint64(6)))
+					payload, err := db.SubmissionPayload("submission")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(payload).Should(Equal([]byte("abcdef")))
+
+					// Expired submissions cannot be read and are pruned.
+					_, err = db.Submission("submission", 0)
+					Expect(err).Should(Equal(sql.ErrNoRows))
+					Expect(db.PruneSubmissions(0)).Should(Succeed())
+					_, err = db.Submission("submission", time.Hour)
+					Expect(err).Should(Equal(sql.ErrNoRows))
+					payload, err = db.SubmissionPayload("submission")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(payload).Should(BeEmpty())
+				})
+
+				It("should remember processed burn events", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					digest := id.Hash{1}
+					processed, err := db.BurnEventProcessed(digest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(processed).Should(BeFalse())
+
+					event := BurnEvent{Selector: "BTC/fromEthereum", BlockNumber: 100, LogIndex: 2}
+					Expect(db.InsertBurnEvent(digest, event)).Should(Succeed())
+					Expect(db.InsertBurnEvent(digest, event)).Should(Succeed())
+					processed, err = db.BurnEventProcessed(digest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(processed).Should(BeTrue())
+				})
+
+				It("should number hook events for each target", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					for i, target := range []string{"https://a", "https://a", "https://b", "https://a"} {
+						sequence, err := db.InsertHookEvent(target, fmt.Sprint(i), []byte("{}"))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(sequence).Should(Equal(map[int]uint64{0: 1, 1: 2, 2: 1, 3: 3}[i]))
+					}
+
+					events, err := db.HookEvents("https://a", 1, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(events).Should(Equal([]HookEvent{
+						{Sequence: 2, ID: "1", Data: []byte("{}")},
+						{Sequence: 3, ID: "3", Data: []byte("{}")},
+					}))
+					events, err = db.HookEvents("https://a", 0, 1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(events).Should(HaveLen(1))
+
+					// Numbering carries on after every event of the
+					// target has been pruned.
+					pruned, err := db.PruneHookEvents(-time.Minute)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(pruned).Should(Equal(int64(4)))
+					sequence, err := db.InsertHookEvent("https://a", "4", []byte("{}"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(sequence).Should(Equal(uint64(4)))
+
+					// Targets whose events were recorded before their
+					// counter row carry on from their latest event.
+					_, err = sqlDB.Exec(`INSERT INTO hook_events (target, sequence, id, data, created_time) VALUES ('https://c', 7, '5', '{}', 0);`)
+					Expect(err).NotTo(HaveOccurred())
+					sequence, err = db.InsertHookEvent("https://c", "6", []byte("{}"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(sequence).Should(Equal(uint64(8)))
+				})
+
+				It("should number concurrent hook events without gaps or collisions", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					n := 20
+					sequences := make(chan uint64, n)
+					errs := make(chan error, n)
+					for i := 0; i < n; i++ {
+						go func(i int) {
+							sequence, err := db.InsertHookEvent("https://a", fmt.Sprint(i), []byte("{}"))
+							if err != nil {
+								errs <- err
+								return
+							}
+							sequences <- sequence
+						}(i)
+					}
+					seen := map[uint64]bool{}
+					for i := 0; i < n; i++ {
+						select {
+						case err := <-errs:
+							Fail(err.Error())
+						case sequence := <-sequences:
+							Expect(seen[sequence]).To(BeFalse())
+							seen[sequence] = true
+						}
+					}
+					for sequence := uint64(1); sequence <= uint64(n); sequence++ {
+						Expect(seen[sequence]).To(BeTrue())
+					}
+				})
 			})
 
 			Context("when querying gateways", func() {
 				It("should return a page of gateways", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -194,7 +897,7 @@ var _ = Describe("Lightnode db", func() {
 							Expect(db.InsertGateway(gatewayAddress, transaction)).To(Succeed())
 						}
 
-						txsPage, err := db.Gateways(0, 10)
+						txsPage, err := db.Gateways(0, 10, GatewayStatusNil)
 						Expect(err).NotTo(HaveOccurred())
 						Expect(len(txsPage)).Should(Equal(10))
 						return true
@@ -202,13 +905,53 @@ var _ = Describe("Lightnode db", func() {
 
 					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
 				})
+
+				It("should filter gateways by status", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					used := txutil.RandomGoodTx(r)
+					Expect(db.InsertGateway("used", used)).Should(Succeed())
+					Expect(db.InsertGateway("empty", txutil.RandomGoodTx(r))).Should(Succeed())
+					Expect(db.InsertGatewayDeposit(id.Hash{1}, used.Input.Get("ghash").(pack.Bytes32), pack.NewU256FromU64(100))).Should(Succeed())
+
+					gateways, err := db.Gateways(0, 10, GatewayStatusNil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(gateways).Should(HaveLen(2))
+
+					gateways, err = db.Gateways(0, 10, GatewayStatusUsed)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(gateways).Should(HaveLen(1))
+					Expect(gateways[0].Address).Should(Equal("used"))
+					Expect(gateways[0].Status).Should(Equal(GatewayStatusUsed))
+					Expect(gateways[0].CreatedTime).ShouldNot(BeZero())
+					Expect(gateways[0].Tx.Input.Get("ghash")).Should(Equal(used.Input.Get("ghash")))
+
+					gateways, err = db.Gateways(1, 10, GatewayStatusNil)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(gateways).Should(HaveLen(1))
+
+					// The status, limit and offset are bound to their own
+					// placeholders on both backends.
+					gateways, err = db.Gateways(0, 1, GatewayStatusUsed)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(gateways).Should(HaveLen(1))
+					Expect(gateways[0].Address).Should(Equal("used"))
+					gateways, err = db.Gateways(1, 1, GatewayStatusUsed)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(gateways).Should(BeEmpty())
+				})
 			})
 
 			Context("when querying txs", func() {
 				It("should return a page of txs", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func(order bool) bool {
@@ -239,6 +982,11 @@ var _ = Describe("Lightnode db", func() {
 						}
 
 						Expect(txs).To(HaveLen(40))
+
+						count, approximate, err := db.TxCount()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(count).Should(Equal(50))
+						Expect(approximate).Should(BeFalse())
 						return true
 					}
 
@@ -250,7 +998,7 @@ var _ = Describe("Lightnode db", func() {
 				It("should return all txs which are not confirmed", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -286,7 +1034,7 @@ var _ = Describe("Lightnode db", func() {
 				It("should not return txs which added more than 24 hours ago", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -306,13 +1054,63 @@ var _ = Describe("Lightnode db", func() {
 
 					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
 				})
+
+				It("should return submitted burns without a final result, oldest first", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					hashes := make([]id.Hash, 5)
+					for i := range hashes {
+						transaction := txutil.RandomGoodTx(r)
+						transaction.Selector = "BTC/fromEthereum"
+						if i == 4 {
+							transaction.Selector = "BTC/toEthereum"
+						}
+						hashes[i] = transaction.Hash
+						Expect(db.InsertTx(transaction)).To(Succeed())
+						Expect(UpdateTxCreatedTime(sqlDB, "txs", transaction.Hash, time.Now().Unix()-int64(10-i))).Should(Succeed())
+					}
+					Expect(db.UpdateStatus(hashes[0], TxStatusConfirmed)).To(Succeed())
+					Expect(db.UpdateStatus(hashes[1], TxStatusConfirmed)).To(Succeed())
+					Expect(db.UpdateStatus(hashes[2], TxStatusConfirmed)).To(Succeed())
+					Expect(db.UpdateStatus(hashes[4], TxStatusConfirmed)).To(Succeed())
+					Expect(db.InsertFinalQueryTx(hashes[1], []byte("{}"))).To(Succeed())
+
+					txs, cursor, err := db.UnfinishedBurns(time.Now(), TxCursor{}, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).To(HaveLen(2))
+					Expect(txs[0].Hash).To(Equal(hashes[0]))
+					Expect(txs[1].Hash).To(Equal(hashes[2]))
+					Expect(cursor.Hash).To(Equal(hashes[2].String()))
+
+					// Burns are paged by their cursor.
+					txs, cursor, err = db.UnfinishedBurns(time.Now(), TxCursor{}, 1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).To(HaveLen(1))
+					Expect(txs[0].Hash).To(Equal(hashes[0]))
+					txs, cursor, err = db.UnfinishedBurns(time.Now(), cursor, 1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).To(HaveLen(1))
+					Expect(txs[0].Hash).To(Equal(hashes[2]))
+					txs, _, err = db.UnfinishedBurns(time.Now(), cursor, 1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).To(BeEmpty())
+
+					txs, _, err = db.UnfinishedBurns(time.Now().Add(-9*time.Second), TxCursor{}, 10)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(txs).To(HaveLen(1))
+				})
 			})
 
 			Context("when updating tx status", func() {
 				It("should returned the latest status of the tx", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -336,13 +1134,33 @@ var _ = Describe("Lightnode db", func() {
 
 					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
 				})
+
+				It("should count the txs which have not been submitted", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					statuses := []TxStatus{TxStatusConfirming, TxStatusConfirmed, TxStatusSubmitted}
+					for i := 0; i < 30; i++ {
+						transaction := txutil.RandomGoodTx(r)
+						Expect(db.InsertTx(transaction)).To(Succeed())
+						Expect(db.UpdateStatus(transaction.Hash, statuses[i%len(statuses)])).To(Succeed())
+					}
+
+					count, err := db.PendingTxCount()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(count).To(Equal(20))
+				})
 			})
 
 			Context("when pruning the db", func() {
 				It("should only prune data which is expired", func() {
 					sqlDB := init(dbname)
 					defer close(sqlDB)
-					db := New(sqlDB, 100)
+					db := New(sqlDB, 100, 1)
 
 					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
 					test := func() bool {
@@ -370,6 +1188,229 @@ var _ = Describe("Lightnode db", func() {
 
 					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
 				})
+
+				It("should be able to restore pruned data until it is purged", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					test := func() bool {
+						Expect(db.Init()).Should(Succeed())
+						defer cleanUp(sqlDB)
+
+						transaction := txutil.RandomGoodTx(r)
+						transaction.Output = nil
+						Expect(db.InsertTx(transaction)).To(Succeed())
+						Expect(UpdateTxCreatedTime(sqlDB, "txs", transaction.Hash, time.Now().Unix()-5)).Should(Succeed())
+						Expect(db.Prune(time.Second)).Should(Succeed())
+						numArchived, err := NumOfDataEntries(sqlDB, "txs_archive")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numArchived).Should(Equal(1))
+
+						// Ensure the archive is kept within the retention period.
+						Expect(db.PurgeArchive(time.Hour)).Should(Succeed())
+						Expect(db.RestoreTx(transaction.Hash)).Should(Succeed())
+						restored, err := db.Tx(transaction.Hash)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(restored).Should(Equal(transaction))
+						Expect(db.RestoreTx(transaction.Hash)).Should(Equal(sql.ErrNoRows))
+
+						// Ensure the restored tx is not immediately pruned again.
+						Expect(db.Prune(time.Second)).Should(Succeed())
+						numTxs, err := NumOfDataEntries(sqlDB, "txs")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numTxs).Should(Equal(1))
+
+						// Ensure archived data is purged once the retention
+						// period has passed.
+						Expect(UpdateTxCreatedTime(sqlDB, "txs", transaction.Hash, time.Now().Unix()-5)).Should(Succeed())
+						Expect(db.Prune(time.Second)).Should(Succeed())
+						Expect(db.PurgeArchive(-time.Second)).Should(Succeed())
+						numArchived, err = NumOfDataEntries(sqlDB, "txs_archive")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numArchived).Should(BeZero())
+						Expect(db.RestoreTx(transaction.Hash)).Should(Equal(sql.ErrNoRows))
+
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
+				})
+
+				It("should prune each category with its own expiry", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					test := func() bool {
+						Expect(db.Init()).Should(Succeed())
+						defer cleanUp(sqlDB)
+
+						done := txutil.RandomGoodTx(r)
+						unconfirmed := txutil.RandomGoodTx(r)
+						Expect(db.InsertTxs([]tx.Tx{done, unconfirmed})).To(Succeed())
+						Expect(db.UpdateStatus(done.Hash, TxStatusConfirmed)).To(Succeed())
+						Expect(db.InsertGateway("gateway", txutil.RandomGoodTx(r))).To(Succeed())
+						Expect(db.InsertBurnEvent(id.Hash{1}, BurnEvent{Selector: "BTC/fromEthereum", BlockNumber: 100})).To(Succeed())
+						Expect(db.InsertClientMetadata(done.Hash, ClientMetadata{Integrator: "renbridge"})).To(Succeed())
+
+						createdTime := time.Now().Unix() - 5
+						Expect(UpdateTxCreatedTime(sqlDB, "txs", done.Hash, createdTime)).Should(Succeed())
+						Expect(UpdateTxCreatedTime(sqlDB, "txs", unconfirmed.Hash, createdTime)).Should(Succeed())
+						_, err := sqlDB.Exec("UPDATE gateways SET created_time = $1;", createdTime)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = sqlDB.Exec("UPDATE burn_events SET created_time = $1;", createdTime)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = sqlDB.Exec("UPDATE tx_clients SET created_time = $1;", createdTime)
+						Expect(err).NotTo(HaveOccurred())
+
+						// Ensure a dry run reports the expired rows without
+						// pruning them.
+						policy := PrunePolicy{Done: time.Second, Unconfirmed: time.Hour, Gateways: time.Second, BurnEvents: time.Second, Clients: time.Second}
+						report, err := db.PruneWithPolicy(policy, true)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(report).To(Equal(PruneReport{DryRun: true, Done: 1, Unconfirmed: 0, Gateways: 1, BurnEvents: 1, Clients: 1}))
+						numTxs, err := NumOfDataEntries(sqlDB, "txs")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numTxs).Should(Equal(2))
+						numGateways, err := NumOfDataEntries(sqlDB, "gateways")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numGateways).Should(Equal(1))
+
+						// Ensure only the expired categories are pruned.
+						report, err = db.PruneWithPolicy(policy, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(report).To(Equal(PruneReport{Done: 1, Unconfirmed: 0, Gateways: 1, BurnEvents: 1, Clients: 1}))
+						numClients, err := NumOfDataEntries(sqlDB, "tx_clients")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numClients).Should(BeZero())
+						_, err = db.Tx(unconfirmed.Hash)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = db.Tx(done.Hash)
+						Expect(err).To(Equal(sql.ErrNoRows))
+						numGateways, err = NumOfDataEntries(sqlDB, "gateways")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numGateways).Should(BeZero())
+						processed, err := db.BurnEventProcessed(id.Hash{1})
+						Expect(err).NotTo(HaveOccurred())
+						Expect(processed).Should(BeFalse())
+
+						// Ensure categories without an expiry are not pruned.
+						report, err = db.PruneWithPolicy(PrunePolicy{}, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(report).To(Equal(PruneReport{}))
+						numTxs, err = NumOfDataEntries(sqlDB, "txs")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(numTxs).Should(Equal(1))
+
+						return true
+					}
+
+					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
+				})
+
+				It("should keep renewed gateways until their expiry", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					defer cleanUp(sqlDB)
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					Expect(db.InsertGateway("renewed", txutil.RandomGoodTx(r))).To(Succeed())
+					Expect(db.InsertGateway("expired", txutil.RandomGoodTx(r))).To(Succeed())
+					_, err := sqlDB.Exec("UPDATE gateways SET created_time = $1;", time.Now().Unix()-5)
+					Expect(err).NotTo(HaveOccurred())
+
+					expiry, err := db.GatewayExpiry("renewed")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(expiry).To(BeZero())
+
+					// Renewing a gateway never brings its expiry forward.
+					later := time.Now().Add(time.Hour)
+					expiry, err = db.RenewGateway("renewed", later, 24*time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(expiry).To(Equal(later.Unix()))
+					expiry, err = db.RenewGateway("renewed", time.Now().Add(time.Minute), 24*time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(expiry).To(Equal(later.Unix()))
+					_, err = db.RenewGateway("unknown", later, 24*time.Hour)
+					Expect(err).To(Equal(sql.ErrNoRows))
+
+					// Renewals cannot keep a gateway beyond its lifetime.
+					var created int64
+					Expect(sqlDB.QueryRow("SELECT created_time FROM gateways WHERE gateway_address = 'renewed';").Scan(&created)).To(Succeed())
+					expiry, err = db.RenewGateway("renewed", time.Now().Add(48*time.Hour), 2*time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(expiry).To(Equal(created + int64((2 * time.Hour).Seconds())))
+
+					report, err := db.PruneWithPolicy(PrunePolicy{Gateways: time.Second}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(report.Gateways).To(Equal(int64(1)))
+					_, err = db.Gateway("renewed")
+					Expect(err).NotTo(HaveOccurred())
+					_, err = db.Gateway("expired")
+					Expect(err).To(Equal(sql.ErrNoRows))
+
+					// Once the renewal has passed, the gateway is pruned.
+					_, err = sqlDB.Exec("UPDATE gateways SET expiry_time = $1;", time.Now().Unix()-1)
+					Expect(err).NotTo(HaveOccurred())
+					report, err = db.PruneWithPolicy(PrunePolicy{Gateways: time.Second}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(report.Gateways).To(Equal(int64(1)))
+				})
+
+				It("should add columns to tables created before them", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					defer cleanUp(sqlDB)
+
+					_, err := sqlDB.Exec("CREATE TABLE gateways (gateway_address VARCHAR NOT NULL PRIMARY KEY, status SMALLINT, created_time BIGINT, selector VARCHAR(255), payload VARCHAR, phash VARCHAR, to_address VARCHAR, nonce VARCHAR, nhash VARCHAR, gpubkey VARCHAR, ghash VARCHAR, version VARCHAR);")
+					Expect(err).NotTo(HaveOccurred())
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					Expect(db.Init()).Should(Succeed())
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					Expect(db.InsertGateway("gateway", txutil.RandomGoodTx(r))).To(Succeed())
+					_, err = db.RenewGateway("gateway", time.Now().Add(time.Hour), 24*time.Hour)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("should migrate amounts so that they can be aggregated", func() {
+					sqlDB := init(dbname)
+					defer close(sqlDB)
+					defer cleanUp(sqlDB)
+
+					db := New(sqlDB, 100, 1)
+					Expect(db.Init()).Should(Succeed())
+					if dbname == Postgres {
+						// Revert the migration, so that it is applied to
+						// existing txs.
+						_, err := sqlDB.Exec("ALTER TABLE txs ALTER COLUMN amount TYPE VARCHAR(100);")
+						Expect(err).NotTo(HaveOccurred())
+					}
+
+					r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+					transaction := txutil.RandomGoodTx(r)
+					transaction.Output = nil
+					Expect(db.InsertTx(transaction)).Should(Succeed())
+					Expect(db.Init()).Should(Succeed())
+
+					newTransaction, err := db.Tx(transaction.Hash)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(newTransaction).Should(Equal(transaction))
+
+					if dbname == Postgres {
+						var dataType, sum string
+						Expect(sqlDB.QueryRow("SELECT data_type FROM information_schema.columns WHERE table_name = 'txs' AND column_name = 'amount';").Scan(&dataType)).To(Succeed())
+						Expect(dataType).To(Equal("numeric"))
+						Expect(sqlDB.QueryRow("SELECT SUM(amount) FROM txs;").Scan(&sum)).To(Succeed())
+						Expect(sum).To(Equal(transaction.Input.Get("amount").(pack.U256).String()))
+					}
+				})
 			})
 		})
 	}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A dialect is the flavour of SQL spoken by a database. Queries which are the
+// same in all dialects are written once, using placeholders such as `$1`; the
+// dialect is only consulted for the parts which differ. SQLite treats `$1` as
+// a named parameter and binds arguments to them in the order in which they
+// first appear, so they must be numbered in the order they appear in the
+// query, or be built with placeholder.
+type dialect interface {
+	// name is the name of the dialect, used in errors.
+	name() string
+
+	// placeholder returns the placeholder of the nth argument of a query,
+	// starting from 1.
+	placeholder(n int) string
+
+	// maxParams is the maximum number of arguments in a single query.
+	maxParams() int
+
+	// estimateRows returns a query for the approximate number of rows in the
+	// table, which is cheaper than counting them, or an empty string if the
+	// dialect cannot estimate it.
+	estimateRows(table string) string
+
+	// columnExists returns a query for the number of columns with the name
+	// given by the second argument in the table given by the first.
+	columnExists() string
+
+	// tableExists returns a query for the number of tables with the name
+	// given by the first argument.
+	tableExists() string
+
+	// baseline returns the statements which create and update the schema up
+	// to the baseline version, in the order they are applied. Every statement
+	// is applied each time the database is initialised, so they must be safe
+	// to run more than once. Later changes are made by migrations.
+	baseline() []string
+
+	// lockMigrations returns a statement which takes a lock until the end of
+	// the SQL transaction, so that Lightnodes sharing the database do not run
+	// the same migration, or an empty string if the dialect does not need
+	// one.
+	lockMigrations() string
+}
+
+// postgres is the dialect of Postgres, which is used in production.
+type postgres struct{}
+
+func (postgres) name() string {
+	return "postgres"
+}
+
+func (postgres) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// Postgres encodes the number of arguments in 16 bits.
+func (postgres) maxParams() int {
+	return 65535
+}
+
+func (postgres) estimateRows(table string) string {
+	return fmt.Sprintf("SELECT reltuples FROM pg_class WHERE relname = '%s';", table)
+}
+
+func (postgres) columnExists() string {
+	return "SELECT COUNT(*) FROM information_schema.columns WHERE table_name = $1 AND column_name = $2;"
+}
+
+func (postgres) tableExists() string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = $1;"
+}
+
+func (postgres) baseline() []string {
+	return []string{schema, numericAmounts}
+}
+
+// The key of the advisory lock is arbitrary, but must be the same for every
+// Lightnode.
+func (postgres) lockMigrations() string {
+	return "SELECT pg_advisory_xact_lock(3775);"
+}
+
+// numericAmounts converts the amount columns, which are created as VARCHAR in
+// all dialects, to NUMERIC so that amounts can be summed and compared by the
+// database. Amounts are U256s, which have at most 78 digits. Columns are only
+// altered if they have not been converted yet, as altering a column rewrites
+// its table. SQLite has no type which can hold a U256, so amounts remain
+// decimal strings there.
+const numericAmounts = `DO $$
+DECLARE
+	t TEXT;
+BEGIN
+	FOREACH t IN ARRAY ARRAY['txs', 'txs_archive', 'gateway_deposits'] LOOP
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = t AND column_name = 'amount' AND data_type <> 'numeric') THEN
+			EXECUTE format('ALTER TABLE %I ALTER COLUMN amount TYPE NUMERIC(78, 0) USING amount::NUMERIC(78, 0)', t);
+		END IF;
+	END LOOP;
+END $$;`
+
+// sqlite is the dialect of SQLite, which is used in tests and for local
+// deployments.
+type sqlite struct{}
+
+func (sqlite) name() string {
+	return "sqlite"
+}
+
+// SQLite supports `$1`, but `?1` is its own syntax for numbered arguments.
+func (sqlite) placeholder(n int) string {
+	return fmt.Sprintf("?%d", n)
+}
+
+// SQLite limits the number of arguments to 999 before version 3.32, which is
+// still the limit in many distributions.
+func (sqlite) maxParams() int {
+	return 999
+}
+
+func (sqlite) estimateRows(table string) string {
+	return ""
+}
+
+func (sqlite) columnExists() string {
+	return "SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2;"
+}
+
+func (sqlite) tableExists() string {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1;"
+}
+
+func (sqlite) baseline() []string {
+	return []string{schema}
+}
+
+// SQLite databases are not shared, and writes are serialised anyway.
+func (sqlite) lockMigrations() string {
+	return ""
+}
+
+// onConflict returns the clause which handles inserted rows whose key already
+// exists. The existing rows are kept, unless columns to update are given, in
+// which case those columns are overwritten with the inserted values (i.e. an
+// upsert). Postgres and SQLite (3.24 and later) share this syntax.
+func onConflict(key string, update ...string) string {
+	if len(update) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", key)
+	}
+	assignments := make([]string, len(update))
+	for i, column := range update {
+		assignments[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", key, strings.Join(assignments, ", "))
+}
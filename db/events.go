@@ -0,0 +1,33 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/renproject/id"
+)
+
+// BurnEvent identifies a burn event which has been processed by a watcher.
+type BurnEvent struct {
+	Selector    string
+	BlockNumber uint64
+	LogIndex    uint64
+}
+
+// InsertBurnEvent implements the DB interface. Events which are recorded again
+// have their created time updated, so that they are not pruned while the
+// watcher can still see them.
+func (db database) InsertBurnEvent(digest id.Hash, event BurnEvent) error {
+	_, err := db.db.Exec(`INSERT INTO burn_events (digest, selector, block_number, log_index, created_time) VALUES ($1, $2, $3, $4, $5) `+onConflict("digest", "created_time")+`;`,
+		digest.String(), event.Selector, int64(event.BlockNumber), int64(event.LogIndex), db.clock.Unix())
+	return err
+}
+
+// BurnEventProcessed implements the DB interface.
+func (db database) BurnEventProcessed(digest id.Hash) (bool, error) {
+	var selector string
+	err := db.db.QueryRow(`SELECT selector FROM burn_events WHERE digest = $1;`, digest.String()).Scan(&selector)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"time"
+
+	"github.com/renproject/id"
+)
+
+// InsertFinalQueryTx implements the DB interface.
+func (db database) InsertFinalQueryTx(txHash id.Hash, result []byte) error {
+	defer db.observe("InsertFinalQueryTx", time.Now(), txHash)
+
+	_, err := db.db.Exec(`INSERT INTO final_txs (hash, result, created_time) VALUES ($1, $2, $3) ON CONFLICT (hash) DO NOTHING;`,
+		txHash.String(), string(result), db.clock.Unix())
+	return err
+}
+
+// FinalQueryTx implements the DB interface.
+func (db database) FinalQueryTx(txHash id.Hash) ([]byte, error) {
+	defer db.observe("FinalQueryTx", time.Now(), txHash)
+
+	stmt, err := db.stmts.get(`SELECT result FROM final_txs WHERE hash = $1;`)
+	if err != nil {
+		return nil, err
+	}
+	var result string
+	if err := stmt.QueryRow(txHash.String()).Scan(&result); err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
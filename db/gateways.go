@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
+	"github.com/renproject/pack"
+)
+
+// GatewayUsage is the number of deposits made to a gateway and their
+// cumulative amount.
+type GatewayUsage struct {
+	DepositCount int       `json:"depositCount"`
+	DepositTotal pack.U256 `json:"depositTotal"`
+	LastDeposit  int64     `json:"lastDeposit,omitempty"`
+}
+
+// GatewayInfo is a gateway along with its status, the unix timestamp at which
+// it was created and the unix timestamp until which it has been renewed. The
+// expiry is zero if the gateway has not been renewed.
+type GatewayInfo struct {
+	Address     string
+	Tx          tx.Tx
+	Status      GatewayStatus
+	CreatedTime int64
+	Expiry      int64
+}
+
+// rowToGatewayInfo scans the columns of a gateway, followed by its status,
+// created time and expiry.
+func rowToGatewayInfo(row Scannable) (GatewayInfo, error) {
+	var status, createdTime, expiry sql.NullInt64
+	address, gateway, err := scanGateway(row, &status, &createdTime, &expiry)
+	if err != nil {
+		return GatewayInfo{}, err
+	}
+	return GatewayInfo{
+		Address:     address,
+		Tx:          gateway,
+		Status:      GatewayStatus(status.Int64),
+		CreatedTime: createdTime.Int64,
+		Expiry:      expiry.Int64,
+	}, nil
+}
+
+// InsertGatewayDeposit implements the DB interface.
+func (db database) InsertGatewayDeposit(txHash id.Hash, ghash pack.Bytes32, amount pack.U256) error {
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := sqlTx.Exec(`INSERT INTO gateway_deposits (hash, ghash, amount, created_time) VALUES ($1, $2, $3, $4) ON CONFLICT (hash) DO NOTHING;`,
+		txHash.String(), ghash.String(), amount.String(), db.clock.Unix()); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if _, err := sqlTx.Exec(`UPDATE gateways SET status = $1 WHERE ghash = $2 AND status <> $3;`, GatewayStatusUsed, ghash.String(), GatewayStatusInvalid); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// GatewayUsage implements the DB interface. Amounts are stored as decimal
+// strings, as they do not fit in a BIGINT, so they are summed here rather
+// than by the database.
+func (db database) GatewayUsage(ghash pack.Bytes32) (GatewayUsage, error) {
+	usage := GatewayUsage{}
+	rows, err := db.db.Query(`SELECT amount, created_time FROM gateway_deposits WHERE ghash = $1;`, ghash.String())
+	if err != nil {
+		return usage, err
+	}
+	defer rows.Close()
+
+	total := new(big.Int)
+	for rows.Next() {
+		var amountStr string
+		var createdTime int64
+		if err := rows.Scan(&amountStr, &createdTime); err != nil {
+			return usage, err
+		}
+		amount, ok := new(big.Int).SetString(amountStr, 10)
+		if !ok {
+			return usage, fmt.Errorf("invalid deposit amount %q", amountStr)
+		}
+		total.Add(total, amount)
+		usage.DepositCount++
+		if createdTime > usage.LastDeposit {
+			usage.LastDeposit = createdTime
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return usage, err
+	}
+	usage.DepositTotal = pack.NewU256FromInt(total)
+	return usage, nil
+}
+
+// GatewayStatus implements the DB interface.
+func (db database) GatewayStatus(address string) (GatewayStatus, error) {
+	var status GatewayStatus
+	err := db.db.QueryRow(`SELECT status FROM gateways WHERE gateway_address = $1;`, address).Scan(&status)
+	return status, err
+}
+
+// RenewGateway implements the DB interface.
+func (db database) RenewGateway(address string, expiry time.Time, maxLifetime time.Duration) (int64, error) {
+	var created int64
+	if err := db.db.QueryRow(`SELECT created_time FROM gateways WHERE gateway_address = $1;`, address).Scan(&created); err != nil {
+		return 0, err
+	}
+	until := expiry.Unix()
+	if limit := created + int64(maxLifetime/time.Second); until > limit {
+		until = limit
+	}
+	_, err := db.db.Exec(`UPDATE gateways SET expiry_time = $1 WHERE gateway_address = $2 AND (expiry_time IS NULL OR expiry_time < $1);`,
+		until, address)
+	if err != nil {
+		return 0, err
+	}
+	return db.GatewayExpiry(address)
+}
+
+// GatewayExpiry implements the DB interface.
+func (db database) GatewayExpiry(address string) (int64, error) {
+	var expiry sql.NullInt64
+	if err := db.db.QueryRow(`SELECT expiry_time FROM gateways WHERE gateway_address = $1;`, address).Scan(&expiry); err != nil {
+		return 0, err
+	}
+	return expiry.Int64, nil
+}
+
+// RecordShardPubKeys implements the DB interface.
+func (db database) RecordShardPubKeys(pubKeys []pack.Bytes) error {
+	now := db.clock.Unix()
+	for _, pubKey := range pubKeys {
+		script := fmt.Sprintf(`INSERT INTO shard_pubkeys (gpubkey, last_seen) VALUES ($1, $2) %s;`, onConflict("gpubkey", "last_seen"))
+		if _, err := db.db.Exec(script, pubKey.String(), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateGateways implements the DB interface. Gateways store the shard
+// public key they were derived from, so they are matched against the public
+// keys which were last seen before the grace period.
+func (db database) InvalidateGateways(grace time.Duration) (int64, error) {
+	defer db.observe("InvalidateGateways", time.Now())
+
+	result, err := db.db.Exec(`UPDATE gateways SET status = $1
+WHERE status <> $1 AND gpubkey IN (SELECT gpubkey FROM shard_pubkeys WHERE last_seen < $2);`,
+		GatewayStatusInvalid, db.clock.Now().Add(-grace).Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"time"
+)
+
+// HookEvent is an event which was sent to the hook with a target. Events are
+// numbered from one in the order they were sent to the target.
+type HookEvent struct {
+	Sequence uint64
+	ID       string
+	Data     []byte
+}
+
+// InsertHookEvent implements the DB interface. The sequence of each target is
+// kept in a counter row, which is locked by the update until the event has
+// been inserted, so that Lightnodes sharing the database never number two
+// events the same. Targets without a counter row start from their latest
+// event, so that the numbering of events recorded before the counters carries
+// on.
+func (db database) InsertHookEvent(target, id string, data []byte) (uint64, error) {
+	defer db.observe("InsertHookEvent", time.Now(), target)
+
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := sqlTx.Exec(`INSERT INTO hook_event_sequences (target, sequence)
+SELECT $1, COALESCE(MAX(sequence), 0) FROM hook_events WHERE target = $1
+ON CONFLICT (target) DO NOTHING;`, target); err != nil {
+		sqlTx.Rollback()
+		return 0, err
+	}
+	if _, err := sqlTx.Exec(`UPDATE hook_event_sequences SET sequence = sequence + 1 WHERE target = $1;`, target); err != nil {
+		sqlTx.Rollback()
+		return 0, err
+	}
+	var next int64
+	if err := sqlTx.QueryRow(`SELECT sequence FROM hook_event_sequences WHERE target = $1;`, target).Scan(&next); err != nil {
+		sqlTx.Rollback()
+		return 0, err
+	}
+	sequence := uint64(next)
+	if _, err := sqlTx.Exec(`INSERT INTO hook_events (target, sequence, id, data, created_time) VALUES ($1, $2, $3, $4, $5);`,
+		target, int64(sequence), id, string(data), db.clock.Unix()); err != nil {
+		sqlTx.Rollback()
+		return 0, err
+	}
+	return sequence, sqlTx.Commit()
+}
+
+// HookEvents implements the DB interface.
+func (db database) HookEvents(target string, since uint64, limit int) ([]HookEvent, error) {
+	defer db.observe("HookEvents", time.Now(), target)
+
+	rows, err := db.db.Query(`SELECT sequence, id, data FROM hook_events WHERE target = $1 AND sequence > $2 ORDER BY sequence LIMIT $3;`,
+		target, int64(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []HookEvent{}
+	for rows.Next() {
+		var sequence int64
+		var id, data string
+		if err := rows.Scan(&sequence, &id, &data); err != nil {
+			return nil, err
+		}
+		events = append(events, HookEvent{Sequence: uint64(sequence), ID: id, Data: []byte(data)})
+	}
+	return events, rows.Err()
+}
+
+// PruneHookEvents implements the DB interface.
+func (db database) PruneHookEvents(expiry time.Duration) (int64, error) {
+	defer db.observe("PruneHookEvents", time.Now())
+
+	// The sequence of each target is kept in its counter row, so expired
+	// events can be deleted without a gap in the numbering.
+	result, err := db.db.Exec(`DELETE FROM hook_events WHERE created_time < $1;`, db.clock.Now().Add(-expiry).Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// baselineVersion is the version of the schema created by the baseline
+// statements of the dialects. Versions up to it were applied every time the
+// database was initialised, before migrations were recorded.
+const baselineVersion = 5
+
+// A migration is a versioned change to the schema which is not safe to apply
+// more than once, such as altering or indexing an existing table. Migrations
+// are applied at startup in order of version, each in its own SQL
+// transaction, and recorded in the schema_migrations table so that they are
+// only applied once. Down reverts up, and is nil if the migration cannot be
+// reverted.
+type migration struct {
+	version int
+	name    string
+	up      func(sqlTx *sql.Tx, dialect dialect) error
+	down    func(sqlTx *sql.Tx, dialect dialect) error
+}
+
+// migrations are the migrations after the baseline version, in order of
+// version. SchemaVersion must be the version of the last one. Migrations which
+// older Lightnodes cannot run against must also increase MinSchemaVersion.
+var migrations = []migration{
+	{
+		version: 6,
+		name:    "index gateways by created time",
+		up:      execStatements("CREATE INDEX gateways_created_time ON gateways (created_time);"),
+		down:    execStatements("DROP INDEX gateways_created_time;"),
+	},
+	{
+		version: 7,
+		name:    "index txs by txid and selector",
+		up: execStatements(
+			"CREATE INDEX txs_txid ON txs (txid);",
+			"CREATE INDEX txs_selector ON txs (selector, created_time);",
+		),
+		down: execStatements(
+			"DROP INDEX txs_txid;",
+			"DROP INDEX txs_selector;",
+		),
+	},
+	{
+		version: 8,
+		name:    "index txs by status",
+		up:      execStatements("CREATE INDEX txs_status ON txs (status, created_time);"),
+		down:    execStatements("DROP INDEX txs_status;"),
+	},
+	{
+		version: 9,
+		name:    "index txs by nonce",
+		up:      execStatements("CREATE INDEX txs_nonce ON txs (nonce, selector);"),
+		down:    execStatements("DROP INDEX txs_nonce;"),
+	},
+}
+
+// execStatements returns a step of a migration which executes the statements
+// in order. They must be the same in every dialect.
+func execStatements(statements ...string) func(*sql.Tx, dialect) error {
+	return func(sqlTx *sql.Tx, _ dialect) error {
+		for _, statement := range statements {
+			if _, err := sqlTx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+const schemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version            BIGINT NOT NULL PRIMARY KEY,
+		name               VARCHAR NOT NULL,
+		applied_time       BIGINT
+);`
+
+// migrate applies the migrations which have not been applied yet, in order.
+func (db database) migrate() error {
+	if _, err := db.db.Exec(schemaMigrations); err != nil {
+		return fmt.Errorf("creating schema_migrations: %v", err)
+	}
+	for _, m := range migrations {
+		if err := db.runMigration(m, true); err != nil {
+			return fmt.Errorf("applying migration %v (%v): %v", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// RollbackSchema implements the DB interface.
+func (db database) RollbackSchema(version int) error {
+	if version < baselineVersion {
+		return fmt.Errorf("cannot roll back to version %v before the baseline version %v", version, baselineVersion)
+	}
+	if _, err := db.db.Exec(schemaMigrations); err != nil {
+		return fmt.Errorf("creating schema_migrations: %v", err)
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= version {
+			break
+		}
+		if err := db.runMigration(m, false); err != nil {
+			return fmt.Errorf("reverting migration %v (%v): %v", m.version, m.name, err)
+		}
+	}
+	return db.resetSchemaVersion(version)
+}
+
+// runMigration applies or reverts the migration in its own SQL transaction,
+// unless it has already been applied or reverted, which is checked after
+// taking the migration lock so that Lightnodes starting at the same time do
+// not both run it.
+func (db database) runMigration(m migration, up bool) error {
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if lock := db.dialect.lockMigrations(); lock != "" {
+		if _, err := sqlTx.Exec(lock); err != nil {
+			sqlTx.Rollback()
+			return fmt.Errorf("locking: %v", err)
+		}
+	}
+
+	var count int
+	if err := sqlTx.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = $1;", m.version).Scan(&count); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if applied := count > 0; applied == up {
+		return sqlTx.Rollback()
+	}
+
+	if up {
+		if err := m.up(sqlTx, db.dialect); err != nil {
+			sqlTx.Rollback()
+			return err
+		}
+		_, err = sqlTx.Exec("INSERT INTO schema_migrations (version, name, applied_time) VALUES ($1, $2, $3);", m.version, m.name, db.clock.Unix())
+	} else {
+		if m.down == nil {
+			sqlTx.Rollback()
+			return fmt.Errorf("migration cannot be reverted")
+		}
+		if err := m.down(sqlTx, db.dialect); err != nil {
+			sqlTx.Rollback()
+			return err
+		}
+		_, err = sqlTx.Exec("DELETE FROM schema_migrations WHERE version = $1;", m.version)
+	}
+	if err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/renproject/lightnode/metrics"
+	"github.com/renproject/lightnode/slowlog"
+)
+
+// observe records the duration of a query which started at the given time in
+// the metrics, and in the slow log of the database if it took too long. The
+// params identify what was queried; they are only formatted if the slow log
+// is enabled. It is expected to be deferred at the start of the query.
+func (db database) observe(query string, start time.Time, params ...interface{}) {
+	metrics.ObserveDBQuery(query, start)
+	if !db.slowLog.Enabled(slowlog.KindDB) {
+		return
+	}
+	var data []byte
+	if len(params) > 0 {
+		data = []byte(fmt.Sprint(params...))
+	}
+	db.slowLog.Observe(slowlog.KindDB, query, "", data, start, nil)
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// SchemaVersion is the version of the schema created by this Lightnode,
+	// which is the version of its last migration.
+	SchemaVersion = 9
+
+	// MinSchemaVersion is the oldest version of the Lightnode which can use
+	// the schema created by this one. It is only increased by migrations which
+	// older Lightnodes cannot run against, such as renaming a column, so that
+	// Lightnodes which have not been upgraded yet keep running during a
+	// rolling upgrade.
+	MinSchemaVersion = 1
+)
+
+// Names of the schema versions in the lightnode_meta table.
+const (
+	metaSchemaVersion    = "schema_version"
+	metaMinSchemaVersion = "min_schema_version"
+)
+
+// checkSchemaVersion returns an error if the schema has been migrated by a
+// Lightnode which requires a newer version than this one. Databases which
+// have not been initialised yet, or were initialised before versions were
+// recorded, are compatible.
+func (db database) checkSchemaVersion() error {
+	var tables int
+	if err := db.db.QueryRow(db.dialect.tableExists(), "lightnode_meta").Scan(&tables); err != nil {
+		return fmt.Errorf("checking schema version: %v", err)
+	}
+	if tables == 0 {
+		// The meta table does not exist before the first migration.
+		return nil
+	}
+	minVersion, err := db.meta(metaMinSchemaVersion)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %v: %v", metaMinSchemaVersion, err)
+	}
+	if minVersion <= SchemaVersion {
+		return nil
+	}
+	version, err := db.meta(metaSchemaVersion)
+	if err != nil {
+		return fmt.Errorf("reading %v: %v", metaSchemaVersion, err)
+	}
+	return fmt.Errorf("database schema version %v requires a lightnode with schema version %v or later, but this lightnode has version %v: "+
+		"upgrade the lightnode, or restore the database from a backup taken before it was migrated", version, minVersion, SchemaVersion)
+}
+
+// recordSchemaVersion records the versions of the schema after it has been
+// migrated. Versions recorded by newer Lightnodes are not overwritten.
+func (db database) recordSchemaVersion() error {
+	for name, version := range map[string]int{metaSchemaVersion: SchemaVersion, metaMinSchemaVersion: MinSchemaVersion} {
+		current, err := db.meta(name)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("reading %v: %v", name, err)
+		}
+		if err == nil && current >= version {
+			continue
+		}
+		if err := db.setMeta(name, version); err != nil {
+			return fmt.Errorf("recording %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// resetSchemaVersion records the version of the schema after it has been
+// rolled back, overwriting the versions recorded by newer Lightnodes so that
+// the Lightnode with that version can start.
+func (db database) resetSchemaVersion(version int) error {
+	minVersion, err := db.meta(metaMinSchemaVersion)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("reading %v: %v", metaMinSchemaVersion, err)
+	}
+	if err != nil {
+		minVersion = MinSchemaVersion
+	}
+	if minVersion > version {
+		minVersion = version
+	}
+	for name, value := range map[string]int{metaSchemaVersion: version, metaMinSchemaVersion: minVersion} {
+		if err := db.setMeta(name, value); err != nil {
+			return fmt.Errorf("recording %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setMeta stores the number in the meta table with the given name.
+func (db database) setMeta(name string, value int) error {
+	script := fmt.Sprintf("INSERT INTO lightnode_meta (name, value) VALUES ($1, $2) %s;", onConflict("name", "value"))
+	_, err := db.db.Exec(script, name, strconv.Itoa(value))
+	return err
+}
+
+// meta returns the number stored in the meta table with the given name.
+func (db database) meta(name string) (int, error) {
+	var value string
+	if err := db.db.QueryRow("SELECT value FROM lightnode_meta WHERE name = $1;", name).Scan(&value); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// statements caches prepared statements for the queries on the hot path, so
+// that they are only parsed and planned once per connection pool rather than
+// once per query.
+type statements struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStatements(db *sql.DB) *statements {
+	return &statements{
+		db:    db,
+		stmts: map[string]*sql.Stmt{},
+	}
+}
+
+// get returns the prepared statement for the query, preparing it if it has not
+// been used before. Statements are prepared lazily, as the tables they use do
+// not exist until the database has been initialised.
+func (s *statements) get(query string) (*sql.Stmt, error) {
+	s.mu.RLock()
+	stmt, ok := s.stmts[query]
+	s.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[query] = stmt
+	return stmt, nil
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/renproject/darknode/tx"
+)
+
+// A Submission is a tx whose payload is being uploaded in chunks, as it is too
+// large to be submitted in a single request. The payload of the tx is empty
+// until the submission is finalized.
+type Submission struct {
+	ID          string
+	Tx          tx.Tx
+	PayloadSize uint64
+	Received    uint64
+	CreatedTime int64
+}
+
+// InsertSubmission implements the DB interface.
+func (db database) InsertSubmission(submission Submission) error {
+	transaction, err := json.Marshal(submission.Tx)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.Exec(`INSERT INTO submissions (id, tx, payload_size, created_time) VALUES ($1, $2, $3, $4);`,
+		submission.ID, string(transaction), int64(submission.PayloadSize), db.clock.Unix())
+	return err
+}
+
+// Submission implements the DB interface.
+func (db database) Submission(submissionID string, expiry time.Duration) (Submission, error) {
+	var transaction string
+	var payloadSize, received int64
+	submission := Submission{ID: submissionID}
+	err := db.db.QueryRow(`SELECT tx, payload_size, created_time, COALESCE((SELECT SUM(size) FROM submission_chunks WHERE id = $1), 0)
+		FROM submissions WHERE id = $2 AND $3 - created_time < $4;`, submissionID, submissionID, db.clock.Unix(), int64(expiry.Seconds())).
+		Scan(&transaction, &payloadSize, &submission.CreatedTime, &received)
+	if err != nil {
+		return Submission{}, err
+	}
+	if err := json.Unmarshal([]byte(transaction), &submission.Tx); err != nil {
+		return Submission{}, err
+	}
+	submission.PayloadSize, submission.Received = uint64(payloadSize), uint64(received)
+	return submission, nil
+}
+
+// InsertSubmissionChunk implements the DB interface.
+func (db database) InsertSubmissionChunk(submissionID string, offset uint64, data []byte) error {
+	_, err := db.db.Exec(`INSERT INTO submission_chunks (id, chunk_offset, size, data) VALUES ($1, $2, $3, $4) ON CONFLICT (id, chunk_offset) DO NOTHING;`,
+		submissionID, int64(offset), len(data), base64.StdEncoding.EncodeToString(data))
+	return err
+}
+
+// SubmissionPayload implements the DB interface.
+func (db database) SubmissionPayload(submissionID string) ([]byte, error) {
+	rows, err := db.db.Query(`SELECT data FROM submission_chunks WHERE id = $1 ORDER BY chunk_offset ASC;`, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payload := []byte{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		chunk, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+	}
+	return payload, rows.Err()
+}
+
+// DeleteSubmission implements the DB interface.
+func (db database) DeleteSubmission(submissionID string) error {
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := sqlTx.Exec(`DELETE FROM submission_chunks WHERE id = $1;`, submissionID); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if _, err := sqlTx.Exec(`DELETE FROM submissions WHERE id = $1;`, submissionID); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// PruneSubmissions implements the DB interface.
+func (db database) PruneSubmissions(expiry time.Duration) error {
+	now, seconds := db.clock.Unix(), int64(expiry.Seconds())
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := sqlTx.Exec(`DELETE FROM submission_chunks WHERE id IN (SELECT id FROM submissions WHERE $1 - created_time >= $2);`, now, seconds); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	if _, err := sqlTx.Exec(`DELETE FROM submissions WHERE $1 - created_time >= $2;`, now, seconds); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"crypto/sha256"
+
+	"github.com/renproject/id"
+)
+
+// V0Payload is the original params of a legacy v0 submission, along with the
+// hash of the v1 transaction it was converted into. Payloads are addressed by
+// the SHA256 digest of their exact bytes. The payload is encoded as base64 in
+// JSON, rather than embedded, so that its bytes are preserved and its digest
+// can be checked.
+type V0Payload struct {
+	Digest      id.Hash `json:"digest"`
+	TxHash      id.Hash `json:"txHash"`
+	Payload     []byte  `json:"payload"`
+	CreatedTime int64   `json:"createdTime"`
+}
+
+// V0PayloadDigest returns the digest which addresses the payload.
+func V0PayloadDigest(payload []byte) id.Hash {
+	return id.Hash(sha256.Sum256(payload))
+}
+
+// InsertV0Payload implements the DB interface.
+func (db database) InsertV0Payload(txHash id.Hash, payload []byte) (id.Hash, error) {
+	digest := V0PayloadDigest(payload)
+	_, err := db.db.Exec(`INSERT INTO v0_payloads (digest, hash, payload, created_time) VALUES ($1, $2, $3, $4) ON CONFLICT (digest) DO NOTHING;`,
+		digest.String(), txHash.String(), string(payload), db.clock.Unix())
+	return digest, err
+}
+
+// V0Payload implements the DB interface.
+func (db database) V0Payload(digest id.Hash) (V0Payload, error) {
+	row := db.db.QueryRow(`SELECT digest, hash, payload, created_time FROM v0_payloads WHERE digest = $1;`, digest.String())
+	return scanV0Payload(row)
+}
+
+// V0PayloadsByTx implements the DB interface.
+func (db database) V0PayloadsByTx(txHash id.Hash) ([]V0Payload, error) {
+	rows, err := db.db.Query(`SELECT digest, hash, payload, created_time FROM v0_payloads WHERE hash = $1 ORDER BY created_time;`, txHash.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payloads := []V0Payload{}
+	for rows.Next() {
+		payload, err := scanV0Payload(rows)
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, rows.Err()
+}
+
+func scanV0Payload(row Scannable) (V0Payload, error) {
+	var payload V0Payload
+	var digestStr, hashStr, payloadStr string
+	if err := row.Scan(&digestStr, &hashStr, &payloadStr, &payload.CreatedTime); err != nil {
+		return payload, err
+	}
+	digest, err := decodeBytes32(digestStr)
+	if err != nil {
+		return payload, err
+	}
+	txHash, err := decodeBytes32(hashStr)
+	if err != nil {
+		return payload, err
+	}
+	payload.Digest, payload.TxHash = id.Hash(digest), id.Hash(txHash)
+	payload.Payload = []byte(payloadStr)
+	return payload, nil
+}
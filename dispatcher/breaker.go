@@ -0,0 +1,91 @@
+package dispatcher
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is the circuit breaker of a single darknode.
+type breaker struct {
+	failures int
+	openedAt time.Time
+	probedAt time.Time
+}
+
+// Breakers are per-darknode circuit breakers. A breaker opens once its
+// darknode fails a number of requests in a row, after which requests are no
+// longer sent to the darknode. Once the cooldown has passed, the breaker is
+// half-open: a single request is let through to probe the darknode, which
+// closes the breaker if it succeeds and keeps it open for another cooldown if
+// it fails.
+type Breakers struct {
+	mu        *sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*breaker
+}
+
+// NewBreakers returns circuit breakers which open after the given number of
+// consecutive failures, and probe their darknode once the cooldown has passed.
+func NewBreakers(threshold int, cooldown time.Duration) *Breakers {
+	return &Breakers{
+		mu:        new(sync.Mutex),
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  map[string]*breaker{},
+	}
+}
+
+// Allow returns whether a request can be sent to the darknode at the address.
+// If the breaker of the darknode is half-open, only the first caller is
+// allowed until the probe completes, or until another cooldown has passed in
+// case the probe is abandoned.
+func (breakers *Breakers) Allow(addr string) bool {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b, ok := breakers.breakers[addr]
+	if !ok || b.failures < breakers.threshold {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(b.openedAt) < breakers.cooldown || now.Sub(b.probedAt) < breakers.cooldown {
+		return false
+	}
+	b.probedAt = now
+	return true
+}
+
+// Success closes the breaker of the darknode at the address. It returns
+// whether the breaker was open.
+func (breakers *Breakers) Success(addr string) bool {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b, ok := breakers.breakers[addr]
+	if !ok {
+		return false
+	}
+	delete(breakers.breakers, addr)
+	return b.failures >= breakers.threshold
+}
+
+// Failure records a failed request to the darknode at the address. It returns
+// whether the failure opened the breaker.
+func (breakers *Breakers) Failure(addr string) bool {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b, ok := breakers.breakers[addr]
+	if !ok {
+		b = &breaker{}
+		breakers.breakers[addr] = b
+	}
+	b.failures++
+	if b.failures < breakers.threshold {
+		return false
+	}
+	wasOpen := b.failures > breakers.threshold
+	b.openedAt = time.Now()
+	return !wasOpen
+}
@@ -0,0 +1,44 @@
+package dispatcher_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+)
+
+var _ = Describe("Circuit breakers", func() {
+	It("should open after consecutive failures and probe after the cooldown", func() {
+		breakers := NewBreakers(2, 100*time.Millisecond)
+		Expect(breakers.Allow("a")).To(BeTrue())
+		Expect(breakers.Failure("a")).To(BeFalse())
+		Expect(breakers.Failure("a")).To(BeTrue())
+		Expect(breakers.Allow("a")).To(BeFalse())
+		Expect(breakers.Allow("b")).To(BeTrue())
+
+		// Only a single probe is let through once the breaker is half-open.
+		time.Sleep(100 * time.Millisecond)
+		Expect(breakers.Allow("a")).To(BeTrue())
+		Expect(breakers.Allow("a")).To(BeFalse())
+		Expect(breakers.Success("a")).To(BeTrue())
+		Expect(breakers.Allow("a")).To(BeTrue())
+	})
+
+	It("should stay open if the probe fails", func() {
+		breakers := NewBreakers(1, 100*time.Millisecond)
+		Expect(breakers.Failure("a")).To(BeTrue())
+		time.Sleep(100 * time.Millisecond)
+		Expect(breakers.Allow("a")).To(BeTrue())
+		Expect(breakers.Failure("a")).To(BeFalse())
+		Expect(breakers.Allow("a")).To(BeFalse())
+	})
+
+	It("should reset the failures of darknodes which succeed", func() {
+		breakers := NewBreakers(2, time.Minute)
+		Expect(breakers.Failure("a")).To(BeFalse())
+		Expect(breakers.Success("a")).To(BeFalse())
+		Expect(breakers.Failure("a")).To(BeFalse())
+		Expect(breakers.Allow("a")).To(BeTrue())
+	})
+})
@@ -0,0 +1,129 @@
+package dispatcher
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/renproject/aw/wire"
+)
+
+// budget is the request accounting of a single darknode.
+type budget struct {
+	inFlight    int
+	windowStart time.Time
+	inWindow    int
+}
+
+// Budgets are per-darknode request budgets. Each darknode can have at most a
+// number of requests in flight, and be sent at most a number of requests each
+// minute, so that load is spread across the darknodes rather than falling on
+// the first few in the store. Budgets are soft: they are checked when choosing
+// darknodes, so concurrent requests can overshoot them by a few requests.
+type Budgets struct {
+	mu          *sync.Mutex
+	maxInFlight int
+	maxInWindow int
+	window      time.Duration
+	budgets     map[string]*budget
+}
+
+// NewBudgets returns budgets which allow each darknode to have at most
+// maxInFlight requests in flight, and to be sent at most perMinute requests
+// each minute. Zero disables either limit.
+func NewBudgets(maxInFlight, perMinute int) *Budgets {
+	return &Budgets{
+		mu:          new(sync.Mutex),
+		maxInFlight: maxInFlight,
+		maxInWindow: perMinute,
+		window:      time.Minute,
+		budgets:     map[string]*budget{},
+	}
+}
+
+// Allow returns whether a request can be sent to the darknode at the address
+// without exceeding its budget.
+func (budgets *Budgets) Allow(addr string) bool {
+	budgets.mu.Lock()
+	defer budgets.mu.Unlock()
+
+	b, ok := budgets.budgets[addr]
+	if !ok {
+		return true
+	}
+	budgets.roll(b, time.Now())
+	if budgets.maxInFlight > 0 && b.inFlight >= budgets.maxInFlight {
+		return false
+	}
+	return budgets.maxInWindow <= 0 || b.inWindow < budgets.maxInWindow
+}
+
+// Start records a request sent to the darknode at the address. It must be
+// followed by a call to Done once the request completes.
+func (budgets *Budgets) Start(addr string) {
+	budgets.mu.Lock()
+	defer budgets.mu.Unlock()
+
+	b, ok := budgets.budgets[addr]
+	if !ok {
+		b = &budget{}
+		budgets.budgets[addr] = b
+	}
+	budgets.roll(b, time.Now())
+	b.inFlight++
+	b.inWindow++
+}
+
+// Done records that a request to the darknode at the address has completed.
+func (budgets *Budgets) Done(addr string) {
+	budgets.mu.Lock()
+	defer budgets.mu.Unlock()
+
+	b, ok := budgets.budgets[addr]
+	if !ok || b.inFlight == 0 {
+		return
+	}
+	b.inFlight--
+	if b.inFlight == 0 && time.Since(b.windowStart) >= budgets.window {
+		delete(budgets.budgets, addr)
+	}
+}
+
+// InFlight returns the number of requests in flight to the darknode at the
+// address.
+func (budgets *Budgets) InFlight(addr string) int {
+	budgets.mu.Lock()
+	defer budgets.mu.Unlock()
+
+	if b, ok := budgets.budgets[addr]; ok {
+		return b.inFlight
+	}
+	return 0
+}
+
+// SortByLoad sorts the addresses so that the darknodes with the fewest
+// requests in flight come first, keeping the order of darknodes with the same
+// load.
+func (budgets *Budgets) SortByLoad(addrs []wire.Address) {
+	budgets.mu.Lock()
+	defer budgets.mu.Unlock()
+
+	load := func(addr string) int {
+		if b, ok := budgets.budgets[addr]; ok {
+			return b.inFlight
+		}
+		return 0
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return load(addrs[i].Value) < load(addrs[j].Value)
+	})
+}
+
+// roll starts a new window for the budget if the last one has passed. It must
+// be called with the mutex held.
+func (budgets *Budgets) roll(b *budget, now time.Time) {
+	if now.Sub(b.windowStart) >= budgets.window {
+		b.windowStart = now
+		b.inWindow = 0
+	}
+}
@@ -0,0 +1,47 @@
+package dispatcher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+
+	"github.com/renproject/aw/wire"
+)
+
+var _ = Describe("Darknode budgets", func() {
+	It("should limit the requests in flight to each darknode", func() {
+		budgets := NewBudgets(2, 0)
+		budgets.Start("a")
+		Expect(budgets.Allow("a")).To(BeTrue())
+		budgets.Start("a")
+		Expect(budgets.Allow("a")).To(BeFalse())
+		Expect(budgets.Allow("b")).To(BeTrue())
+		Expect(budgets.InFlight("a")).To(Equal(2))
+
+		budgets.Done("a")
+		Expect(budgets.Allow("a")).To(BeTrue())
+		Expect(budgets.InFlight("a")).To(Equal(1))
+	})
+
+	It("should limit the requests sent to each darknode each minute", func() {
+		budgets := NewBudgets(0, 2)
+		for i := 0; i < 2; i++ {
+			Expect(budgets.Allow("a")).To(BeTrue())
+			budgets.Start("a")
+			budgets.Done("a")
+		}
+		Expect(budgets.Allow("a")).To(BeFalse())
+		Expect(budgets.Allow("b")).To(BeTrue())
+	})
+
+	It("should sort darknodes by their load", func() {
+		budgets := NewBudgets(0, 0)
+		budgets.Start("a")
+		budgets.Start("a")
+		budgets.Start("b")
+
+		addrs := []wire.Address{{Value: "a"}, {Value: "b"}, {Value: "c"}, {Value: "d"}}
+		budgets.SortByLoad(addrs)
+		Expect(addrs).To(Equal([]wire.Address{{Value: "c"}, {Value: "d"}, {Value: "b"}, {Value: "a"}}))
+	})
+})
@@ -1,3 +1,6 @@
+// Package dispatcher sends requests to the Darknodes and aggregates their
+// responses. The dispatcher can be used without the rest of the Lightnode by
+// constructing it with NewWithOptions.
 package dispatcher
 
 import (
@@ -5,13 +8,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/jsonrpc"
+	lerrors "github.com/renproject/lightnode/errors"
 	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/metrics"
+	"github.com/renproject/lightnode/pool"
+	"github.com/renproject/lightnode/slowlog"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/phi"
 	"github.com/sirupsen/logrus"
@@ -27,15 +37,43 @@ type Dispatcher struct {
 	logger     logrus.FieldLogger
 	client     http.Client
 	multiStore store.MultiAddrStore
+	divergence *Divergence
+	pool       *pool.Pool
+	strict     bool
+
+	// Requests which none of the darknodes respond to are retried with
+	// backoff, failing over to other darknodes if there are any.
+	retries int
+	backoff http.RetryOptions
+
+	// breakers stop requests from being sent to darknodes which keep failing.
+	// It can be nil.
+	breakers *Breakers
+
+	// budgets stop requests from being sent to darknodes which already have
+	// their share of the load. It can be nil.
+	budgets *Budgets
+
+	// slowLog records the requests which took too long. It can be nil.
+	slowLog *slowlog.Log
 }
 
-// New constructs a new `Dispatcher`.
-func New(logger logrus.FieldLogger, timeout time.Duration, multiStore store.MultiAddrStore, opts phi.Options) phi.Task {
+// New constructs a new `Dispatcher`. The divergence of darknode responses to
+// queryTx requests is recorded in the given Divergence, unless it is nil. The
+// pool bounds the number of requests which are in flight at once; once it is
+// full, the dispatcher stops accepting messages until a request completes. In
+// strict mode, results which do not match the type of the method are replaced
+// with an error. Requests are neither retried, circuit broken nor budgeted,
+// which can be configured with NewWithOptions instead.
+func New(logger logrus.FieldLogger, timeout time.Duration, multiStore store.MultiAddrStore, divergence *Divergence, pool *pool.Pool, strict bool, opts phi.Options) phi.Task {
 	return phi.New(
 		&Dispatcher{
 			logger:     logger,
 			client:     http.NewClient(timeout),
 			multiStore: multiStore,
+			divergence: divergence,
+			pool:       pool,
+			strict:     strict,
 		},
 		opts,
 	)
@@ -62,12 +100,42 @@ func (dispatcher *Dispatcher) Handle(_ phi.Task, message phi.Message) {
 		return
 	}
 
+	// Darknodes whose breakers are open are replaced with other darknodes, so
+	// that requests are not sent to darknodes which are known to be down.
+	n := len(addrs)
+	tried := map[string]bool{}
+	addrs, overBudget := dispatcher.available(msg.Method, id, addrs, n, tried)
+	if n > 0 && len(addrs) == 0 {
+		// Darknodes which are over their budget are busy rather than down,
+		// so clients are asked to try again later.
+		if overBudget {
+			dispatcher.logger.Warnf("[dispatcher] sending %v request to [%v]: every darknode is over its budget", msg.Method, id)
+			msg.RespondWithErr(lerrors.ErrorCodeRetryLater, lerrors.Wrapf(lerrors.ErrRetryLater, "darknodes are busy"))
+			return
+		}
+		dispatcher.logger.Warnf("[dispatcher] sending %v request to [%v]: no darknodes available", msg.Method, id)
+		msg.RespondWithErr(jsonrpc.ErrorCodeInternal, errors.New("no darknodes available"))
+		return
+	}
+
 	// Send the request to the darknodes and pipe the response to the iterator
 	ctx, cancel := context.WithCancel(msg.Context)
-	responses := make(chan jsonrpc.Response, len(addrs))
+	responses := make(chan jsonrpc.Response, n)
 	resIter := dispatcher.newResponseIter(msg.Method)
 
-	go func() {
+	// Keep track of which darknode returned which response, so that
+	// darknodes disagreeing with the majority can be detected.
+	trackDivergence := dispatcher.divergence != nil && msg.Method == jsonrpc.MethodQueryTx
+	received := map[string]jsonrpc.Response{}
+	receivedMu := new(sync.Mutex)
+
+	// The time spent waiting for the pool is recorded in the slow log.
+	var queued time.Time
+
+	// sendTo sends the request to the darknodes, and returns the number of
+	// darknodes which responded.
+	sendTo := func(addrs []wire.Address) int64 {
+		var responded int64
 		phi.ParForAll(addrs, func(i int) {
 			addrParts := strings.Split(addrs[i].Value, ":")
 			if len(addrParts) != 2 {
@@ -91,25 +159,125 @@ func (dispatcher *Dispatcher) Handle(_ phi.Task, message phi.Message) {
 				Method:  msg.Method,
 				Params:  params,
 			}
-			response, err := dispatcher.client.SendRequest(ctx, addrString, req, nil)
+			if dispatcher.budgets != nil {
+				dispatcher.budgets.Start(addrs[i].Value)
+				defer dispatcher.budgets.Done(addrs[i].Value)
+			}
+			start := time.Now()
+			reqCtx, trace := ctx, (*slowlog.Trace)(nil)
+			if dispatcher.slowLog.Enabled(slowlog.KindDarknode) {
+				reqCtx, trace = slowlog.NewTrace(ctx)
+			}
+			response, err := dispatcher.client.SendRequest(reqCtx, addrString, req, nil)
 			if err != nil {
 				// The context will be cancelled as soon as the first response
 				// is received, so this error is not worth logging.
 				if !errors.Is(err, context.Canceled) {
+					metrics.ObserveDispatch(msg.Method, start, true)
+					dispatcher.observeSlow(msg.Method, addrs[i].Value, params, queued, start, trace, err)
 					dispatcher.logger.Errorf("[dispatcher] sending %v request: %v", msg.Method, err)
+					dispatcher.failure(addrs[i].Value)
 				}
 				return
 			}
+			atomic.AddInt64(&responded, 1)
+			dispatcher.success(addrs[i].Value)
+			metrics.ObserveDispatch(msg.Method, start, response.Error != nil)
+			if response.Error != nil {
+				err = errors.New(response.Error.Message)
+			}
+			dispatcher.observeSlow(msg.Method, addrs[i].Value, params, queued, start, trace, err)
+			if dispatcher.strict && response.Error == nil {
+				if err := checkResult(msg.Method, response.Result); err != nil {
+					dispatcher.logger.Errorf("[dispatcher] unexpected %v response from %v: %v", msg.Method, addrs[i].Value, err)
+					jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("unexpected darknode response: %v", err), nil)
+					response = jsonrpc.NewResponse(msg.ID, nil, &jsonErr)
+				}
+			}
+			if trackDivergence {
+				receivedMu.Lock()
+				received[addrs[i].Value] = response
+				receivedMu.Unlock()
+			}
 			responses <- response
 		})
+		return responded
+	}
+	finish := func() {
 		close(responses)
-	}()
+		if trackDivergence {
+			dispatcher.divergence.Record(received)
+		}
+	}
+
+	// Each attempt runs in the pool, and the backoff between attempts is
+	// waited out after the attempt has released its slot, so that requests
+	// which are backing off do not hold up other requests. Attempts run one
+	// after the other, so they share the state of the retries.
+	interval := dispatcher.backoff.Base
+	attempt := 0
+	var send func()
+	retry := func() {
+		select {
+		case <-ctx.Done():
+			finish()
+			return
+		case <-time.After(interval):
+		}
+		interval = time.Duration(float64(interval) * (1 + dispatcher.backoff.Factor))
+		if interval > dispatcher.backoff.Max {
+			interval = dispatcher.backoff.Max
+		}
+		attempt++
+
+		// Retry with other darknodes if there are any left, and otherwise
+		// with the same darknodes.
+		next, _ := dispatcher.available(msg.Method, id, nil, n, tried)
+		if len(next) == 0 {
+			next, _ = dispatcher.available(msg.Method, id, addrs, n, map[string]bool{})
+		}
+		if len(next) == 0 {
+			finish()
+			return
+		}
+		dispatcher.logger.Warnf("[dispatcher] retrying %v request with %v darknodes", msg.Method, len(next))
+		addrs = next
+		queued = time.Now()
+		if err := dispatcher.pool.Go(ctx, send); err != nil {
+			finish()
+		}
+	}
+	send = func() {
+		if sendTo(addrs) > 0 || attempt >= dispatcher.retries {
+			finish()
+			return
+		}
+		go retry()
+	}
+	queued = time.Now()
+	if err := dispatcher.pool.Go(msg.Context, send); err != nil {
+		cancel()
+		dispatcher.logger.Warnf("[dispatcher] dropping %v request: %v", msg.Method, err)
+		msg.RespondWithErr(jsonrpc.ErrorCodeInternal, err)
+		return
+	}
 
 	go func() {
 		msg.Responder <- resIter.Collect(msg.ID, cancel, responses)
 	}()
 }
 
+// observeSlow records a request to a darknode in the slow log if it took too
+// long. The time spent waiting for the pool is recorded as the queue phase,
+// followed by the phases of the round trip if it was traced.
+func (dispatcher *Dispatcher) observeSlow(method, addr string, params []byte, queued, start time.Time, trace *slowlog.Trace, err error) {
+	if trace == nil {
+		return
+	}
+	timings := append([]slowlog.Timing{{Phase: "queue", Duration: start.Sub(queued).String()}}, trace.Timings()...)
+	dispatcher.slowLog.Observe(slowlog.KindDarknode, method, addr, params, start, err, timings...)
+}
+
 // multiAddrs returns the multi-address for the given Darknode ID.
 func (dispatcher *Dispatcher) multiAddr(darknodeID string) ([]wire.Address, error) {
 	multi, err := dispatcher.multiStore.Get(darknodeID)
@@ -134,6 +302,78 @@ func (dispatcher *Dispatcher) multiAddrs(method string) ([]wire.Address, error)
 	}
 }
 
+// available returns up to n of the given addresses whose breakers are closed
+// and which are within their budgets, topped up with other darknodes which
+// have not been tried yet if the request is not for a specific darknode.
+// Darknodes which are not known to be unhealthy are preferred when topping up,
+// and then the least loaded ones. The returned addresses are marked as tried.
+// It also returns whether any darknode was left out for being over its budget.
+func (dispatcher *Dispatcher) available(method, darknodeID string, addrs []wire.Address, n int, tried map[string]bool) ([]wire.Address, bool) {
+	available := make([]wire.Address, 0, n)
+	overBudget := false
+	add := func(addrs []wire.Address) {
+		for _, addr := range addrs {
+			if len(available) == n {
+				return
+			}
+			if tried[addr.Value] {
+				continue
+			}
+			// The budget is checked first, so that a darknode which is only
+			// over its budget does not use up the probe of its half-open
+			// breaker.
+			if dispatcher.budgets != nil && !dispatcher.budgets.Allow(addr.Value) {
+				overBudget = true
+				continue
+			}
+			if dispatcher.breakers != nil && !dispatcher.breakers.Allow(addr.Value) {
+				continue
+			}
+			tried[addr.Value] = true
+			available = append(available, addr)
+		}
+	}
+	add(addrs)
+	if len(available) < n && darknodeID == "" {
+		candidates, err := dispatcher.candidates(method)
+		if err != nil {
+			dispatcher.logger.Errorf("[dispatcher] getting failover multi-addresses: %v", err)
+			return available, overBudget
+		}
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		if dispatcher.budgets != nil {
+			dispatcher.budgets.SortByLoad(candidates)
+		}
+		dispatcher.multiStore.PeerTable().SortByHealth(candidates)
+		add(candidates)
+	}
+	return available, overBudget
+}
+
+// candidates returns the multi-addresses of all of the darknodes which requests
+// of the given method can fail over to.
+func (dispatcher *Dispatcher) candidates(method string) ([]wire.Address, error) {
+	if method == jsonrpc.MethodQueryStat {
+		return dispatcher.multiStore.AddrsAll()
+	}
+	addrs, err := dispatcher.multiStore.BootstrapAll()
+	return append([]wire.Address{}, addrs...), err
+}
+
+func (dispatcher *Dispatcher) success(addr string) {
+	if dispatcher.breakers != nil && dispatcher.breakers.Success(addr) {
+		dispatcher.logger.Infof("[dispatcher] closing circuit breaker of %v", addr)
+	}
+}
+
+func (dispatcher *Dispatcher) failure(addr string) {
+	if dispatcher.breakers != nil && dispatcher.breakers.Failure(addr) {
+		dispatcher.logger.Warnf("[dispatcher] opening circuit breaker of %v", addr)
+	}
+}
+
 // newResponseIter returns the iterator type for the given method.
 func (dispatcher *Dispatcher) newResponseIter(method string) Iterator {
 	switch method {
@@ -2,8 +2,13 @@ package dispatcher_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"net"
+	nethttp "net/http"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -13,20 +18,24 @@ import (
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/jsonrpc/jsonrpcresolver"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
 	"github.com/renproject/kv"
 	"github.com/renproject/lightnode/dispatcher"
+	lerrors "github.com/renproject/lightnode/errors"
 	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/pool"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/phi"
 	"github.com/sirupsen/logrus"
 )
 
-func initDispatcher(ctx context.Context, bootstrapAddrs []wire.Address, timeout time.Duration) phi.Sender {
+func initDispatcher(ctx context.Context, bootstrapAddrs []wire.Address, timeout time.Duration, strict bool) phi.Sender {
 	opts := phi.Options{Cap: 10}
 	logger := logrus.New()
 	table := kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses")
 	multiStore := store.New(table, bootstrapAddrs)
-	dispatcher := dispatcher.New(logger, timeout, multiStore, opts)
+	dispatcher := dispatcher.New(logger, timeout, multiStore, dispatcher.NewDivergence(logger), pool.New("dispatcher", 10), strict, opts)
 
 	go dispatcher.Run(ctx)
 
@@ -46,6 +55,65 @@ func initDarknodes(ctx context.Context, n int) []*MockDarknode {
 	return dns
 }
 
+// initRawDarknode starts a darknode which responds to every request with the
+// given result.
+func initRawDarknode(ctx context.Context, result json.RawMessage) *MockDarknode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	server := &nethttp.Server{Handler: nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		var req jsonrpc.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(nethttp.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	})}
+	go server.Serve(listener)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	// The dispatcher sends requests to the port after the one in the address.
+	port := listener.Addr().(*net.TCPAddr).Port
+	return NewMockDarknode(fmt.Sprintf("127.0.0.1:%v", port-1), store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "multi"), nil))
+}
+
+// initFlakyDarknode starts a darknode which drops the connection of the given
+// number of requests before responding to them.
+func initFlakyDarknode(ctx context.Context, drops int64) *MockDarknode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	var requests int64
+	server := &nethttp.Server{Handler: nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if atomic.AddInt64(&requests, 1) <= drops {
+			conn, _, err := w.(nethttp.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		var req jsonrpc.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(nethttp.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{}})
+	})}
+	go server.Serve(listener)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	return NewMockDarknode(fmt.Sprintf("127.0.0.1:%v", port-1), store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "multi"), nil))
+}
+
 var _ = Describe("Dispatcher", func() {
 	Context("When running", func() {
 		It("Should send valid requests to the darknodes based on their policy", func() {
@@ -57,7 +125,7 @@ var _ = Describe("Dispatcher", func() {
 			for i := range multis {
 				multis[i] = darknodes[i].Me
 			}
-			dispatcher := initDispatcher(ctx, multis, time.Second)
+			dispatcher := initDispatcher(ctx, multis, time.Second, false)
 
 			for method := range jsonrpc.RPCs {
 				id, params := ValidRequest(method)
@@ -70,4 +138,134 @@ var _ = Describe("Dispatcher", func() {
 			}
 		})
 	})
+
+	Context("When darknodes do not respond", func() {
+		start := func(ctx context.Context, darknode *MockDarknode, options dispatcher.Options) phi.Sender {
+			multiStore := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), []wire.Address{darknode.Me})
+			dispatcher := dispatcher.NewWithOptions(multiStore, options)
+			go dispatcher.Run(ctx)
+			return dispatcher
+		}
+		queryBlockState := func(ctx context.Context, dispatcher phi.Sender) jsonrpc.Response {
+			id, params := ValidRequest(jsonrpc.MethodQueryBlockState)
+			req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, url.Values{})
+			Expect(dispatcher.Send(req)).To(BeTrue())
+
+			var response jsonrpc.Response
+			Eventually(req.Responder, 5*time.Second).Should(Receive(&response))
+			return response
+		}
+		backoff := http.RetryOptions{Base: 10 * time.Millisecond, Max: 100 * time.Millisecond, Factor: 1}
+
+		It("Should retry requests with backoff", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			options := dispatcher.DefaultOptions().WithTimeout(time.Second).WithRetries(2, backoff)
+			dispatcher := start(ctx, initFlakyDarknode(ctx, 2), options)
+			Expect(queryBlockState(ctx, dispatcher).Error).Should(BeNil())
+
+			dispatcher = start(ctx, initFlakyDarknode(ctx, 2), options.WithRetries(1, backoff))
+			Expect(queryBlockState(ctx, dispatcher).Error).ShouldNot(BeNil())
+		})
+
+		It("Should not hold a slot of the pool while backing off", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The dispatchers share a pool with a single slot.
+			dispatchPool := pool.New("dispatcher", 1)
+			slow := http.RetryOptions{Base: 2 * time.Second, Max: 2 * time.Second, Factor: 1}
+			options := dispatcher.DefaultOptions().WithTimeout(time.Second).WithPool(dispatchPool)
+			flaky := start(ctx, initFlakyDarknode(ctx, 1), options.WithRetries(1, slow))
+			healthy := start(ctx, initFlakyDarknode(ctx, 0), options)
+
+			id, params := ValidRequest(jsonrpc.MethodQueryBlockState)
+			backingOff := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, url.Values{})
+			Expect(flaky.Send(backingOff)).To(BeTrue())
+			time.Sleep(500 * time.Millisecond)
+
+			// The request to the healthy darknode is sent while the other
+			// request is backing off.
+			sent := time.Now()
+			Expect(queryBlockState(ctx, healthy).Error).Should(BeNil())
+			Expect(time.Since(sent)).Should(BeNumerically("<", time.Second))
+
+			var response jsonrpc.Response
+			Eventually(backingOff.Responder, 5*time.Second).Should(Receive(&response))
+			Expect(response.Error).Should(BeNil())
+		})
+
+		It("Should stop sending requests to darknodes whose breakers are open", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			options := dispatcher.DefaultOptions().WithTimeout(time.Second).WithRetries(2, backoff).WithBreakers(1, time.Minute)
+			dispatcher := start(ctx, initFlakyDarknode(ctx, 1), options)
+			Expect(queryBlockState(ctx, dispatcher).Error).ShouldNot(BeNil())
+
+			// The darknode would now respond, but its breaker is open.
+			response := queryBlockState(ctx, dispatcher)
+			Expect(response.Error).ShouldNot(BeNil())
+			Expect(response.Error.Message).Should(ContainSubstring("no darknodes available"))
+		})
+
+		It("Should ask clients to retry once every darknode is over its budget", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			options := dispatcher.DefaultOptions().WithTimeout(time.Second).WithDarknodeBudgets(0, 1)
+			dispatcher := start(ctx, initFlakyDarknode(ctx, 0), options)
+			Expect(queryBlockState(ctx, dispatcher).Error).Should(BeNil())
+
+			response := queryBlockState(ctx, dispatcher)
+			Expect(response.Error).ShouldNot(BeNil())
+			Expect(response.Error.Code).Should(Equal(lerrors.ErrorCodeRetryLater))
+		})
+	})
+
+	Context("When running in strict mode", func() {
+		queryTx := func(strict bool, result map[string]interface{}) jsonrpc.Response {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			data, err := json.Marshal(result)
+			Expect(err).NotTo(HaveOccurred())
+			darknode := initRawDarknode(ctx, data)
+			dispatcher := initDispatcher(ctx, []wire.Address{darknode.Me}, time.Second, strict)
+
+			id, params := ValidRequest(jsonrpc.MethodQueryTx)
+			req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryTx, params, url.Values{})
+			Expect(dispatcher.Send(req)).To(BeTrue())
+
+			var response jsonrpc.Response
+			Eventually(req.Responder, 5*time.Second).Should(Receive(&response))
+			return response
+		}
+
+		validResult := func() map[string]interface{} {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			data, err := json.Marshal(jsonrpc.ResponseQueryTx{Tx: txutil.RandomGoodTx(r), TxStatus: tx.StatusDone})
+			Expect(err).NotTo(HaveOccurred())
+			result := map[string]interface{}{}
+			Expect(json.Unmarshal(data, &result)).To(Succeed())
+			return result
+		}
+
+		It("Should pass through responses which match the method", func() {
+			Expect(queryTx(true, validResult()).Error).Should(BeNil())
+		})
+
+		It("Should reject responses with unknown or missing fields", func() {
+			result := validResult()
+			result["unknown"] = "value"
+			Expect(queryTx(false, result).Error).Should(BeNil())
+			Expect(queryTx(true, result).Error).ShouldNot(BeNil())
+
+			result = validResult()
+			delete(result, "txStatus")
+			Expect(queryTx(false, result).Error).Should(BeNil())
+			Expect(queryTx(true, result).Error).ShouldNot(BeNil())
+		})
+	})
 })
@@ -0,0 +1,134 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/sirupsen/logrus"
+)
+
+// DarknodeDivergence counts the queryTx responses of a single darknode, and
+// how many of them disagreed with the response returned by the majority of
+// the darknodes that were queried.
+type DarknodeDivergence struct {
+	Responses uint64 `json:"responses"`
+	Status    uint64 `json:"status"`
+	Output    uint64 `json:"output"`
+}
+
+// Divergence keeps track of darknodes returning a different tx status or
+// output than their peers for the same queryTx request. A darknode which keeps
+// diverging is likely to be stuck or serving stale state. It implements
+// `http.Handler` to expose the counters as JSON.
+type Divergence struct {
+	logger logrus.FieldLogger
+
+	mu       *sync.Mutex
+	counters map[string]DarknodeDivergence
+}
+
+// NewDivergence returns an empty Divergence.
+func NewDivergence(logger logrus.FieldLogger) *Divergence {
+	return &Divergence{
+		logger:   logger,
+		mu:       new(sync.Mutex),
+		counters: map[string]DarknodeDivergence{},
+	}
+}
+
+// queryTxSummary is the subset of a queryTx result which darknodes are
+// expected to agree on.
+type queryTxSummary struct {
+	Tx struct {
+		Hash string          `json:"hash"`
+		Out  json.RawMessage `json:"out"`
+	} `json:"tx"`
+	TxStatus string `json:"txStatus"`
+}
+
+// Record compares the queryTx responses, keyed by darknode address, against
+// the majority response and updates the counters of each darknode. Error
+// responses are ignored, and nothing is counted as divergent unless a strict
+// majority of darknodes agree.
+func (divergence *Divergence) Record(responses map[string]jsonrpc.Response) {
+	summaries := make(map[string]queryTxSummary, len(responses))
+	for addr, response := range responses {
+		if response.Error != nil {
+			continue
+		}
+		data, err := json.Marshal(response.Result)
+		if err != nil {
+			continue
+		}
+		var summary queryTxSummary
+		if err := json.Unmarshal(data, &summary); err != nil {
+			continue
+		}
+		summaries[addr] = summary
+	}
+
+	counts := map[string]int{}
+	for _, summary := range summaries {
+		counts[summary.key()]++
+	}
+	majority, found := "", false
+	for key, count := range counts {
+		if 2*count > len(summaries) {
+			majority, found = key, true
+		}
+	}
+	var expected queryTxSummary
+	for _, summary := range summaries {
+		if summary.key() == majority {
+			expected = summary
+			break
+		}
+	}
+
+	divergence.mu.Lock()
+	defer divergence.mu.Unlock()
+
+	for addr, summary := range summaries {
+		counter := divergence.counters[addr]
+		counter.Responses++
+		if found && summary.key() != majority {
+			if summary.TxStatus != expected.TxStatus {
+				counter.Status++
+			} else {
+				counter.Output++
+			}
+			divergence.logger.WithFields(logrus.Fields{
+				"darknode":         addr,
+				"txHash":           summary.Tx.Hash,
+				"txStatus":         summary.TxStatus,
+				"expectedTxHash":   expected.Tx.Hash,
+				"expectedTxStatus": expected.TxStatus,
+			}).Warn("[dispatcher] darknode response diverged from majority")
+		}
+		divergence.counters[addr] = counter
+	}
+}
+
+// Counters returns a copy of the counters, keyed by darknode address.
+func (divergence *Divergence) Counters() map[string]DarknodeDivergence {
+	divergence.mu.Lock()
+	defer divergence.mu.Unlock()
+
+	counters := make(map[string]DarknodeDivergence, len(divergence.counters))
+	for addr, counter := range divergence.counters {
+		counters[addr] = counter
+	}
+	return counters
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (divergence *Divergence) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(divergence.Counters())
+}
+
+func (summary queryTxSummary) key() string {
+	return summary.TxStatus + "|" + summary.Tx.Hash + "|" + string(summary.Tx.Out)
+}
@@ -0,0 +1,73 @@
+package dispatcher_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Divergence", func() {
+	queryTxResponse := func(hash, status string) jsonrpc.Response {
+		return jsonrpc.Response{
+			Version: "2.0",
+			Result: map[string]interface{}{
+				"tx":       map[string]interface{}{"hash": hash},
+				"txStatus": status,
+			},
+		}
+	}
+
+	It("should count darknodes which disagree with the majority", func() {
+		divergence := NewDivergence(logrus.New())
+		divergence.Record(map[string]jsonrpc.Response{
+			"a": queryTxResponse("hash", "done"),
+			"b": queryTxResponse("hash", "done"),
+			"f": queryTxResponse("hash", "done"),
+			"c": queryTxResponse("hash", "executing"),
+			"d": queryTxResponse("other", "done"),
+			"e": jsonrpc.NewResponse(nil, nil, &jsonrpc.Error{Code: jsonrpc.ErrorCodeInternal}),
+		})
+		divergence.Record(map[string]jsonrpc.Response{
+			"a": queryTxResponse("hash", "done"),
+			"b": queryTxResponse("hash", "done"),
+			"c": queryTxResponse("hash", "done"),
+		})
+
+		counters := divergence.Counters()
+		Expect(counters).To(HaveLen(5))
+		Expect(counters["a"]).To(Equal(DarknodeDivergence{Responses: 2}))
+		Expect(counters["c"]).To(Equal(DarknodeDivergence{Responses: 2, Status: 1}))
+		Expect(counters["d"]).To(Equal(DarknodeDivergence{Responses: 1, Output: 1}))
+	})
+
+	It("should not count divergence without a majority", func() {
+		divergence := NewDivergence(logrus.New())
+		divergence.Record(map[string]jsonrpc.Response{
+			"a": queryTxResponse("hash", "done"),
+			"b": queryTxResponse("hash", "executing"),
+		})
+
+		counters := divergence.Counters()
+		Expect(counters["a"]).To(Equal(DarknodeDivergence{Responses: 1}))
+		Expect(counters["b"]).To(Equal(DarknodeDivergence{Responses: 1}))
+	})
+
+	It("should serve the counters as json", func() {
+		divergence := NewDivergence(logrus.New())
+		divergence.Record(map[string]jsonrpc.Response{
+			"a": queryTxResponse("hash", "done"),
+		})
+
+		recorder := httptest.NewRecorder()
+		divergence.ServeHTTP(recorder, httptest.NewRequest("GET", "/divergence", nil))
+		var counters map[string]DarknodeDivergence
+		Expect(json.NewDecoder(recorder.Body).Decode(&counters)).To(Succeed())
+		Expect(counters).To(Equal(divergence.Counters()))
+	})
+})
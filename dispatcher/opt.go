@@ -0,0 +1,229 @@
+package dispatcher
+
+import (
+	nethttp "net/http"
+	"time"
+
+	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/pool"
+	"github.com/renproject/lightnode/slowlog"
+	"github.com/renproject/lightnode/store"
+	"github.com/renproject/phi"
+	"github.com/sirupsen/logrus"
+)
+
+// Enumerate default options.
+var (
+	DefaultTimeout     = 15 * time.Second
+	DefaultConcurrency = 256
+	DefaultCap         = 128
+
+	DefaultRetries          = 2
+	DefaultBackoff          = http.RetryOptions{Base: 100 * time.Millisecond, Max: 2 * time.Second, Factor: 1}
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+
+	DefaultMaxInFlightPerDarknode  = 0
+	DefaultRequestsPerDarknodeRate = 0
+)
+
+// Options to configure the precise behaviour of the dispatcher.
+type Options struct {
+	Logger  logrus.FieldLogger
+	Timeout time.Duration
+	Cap     int
+	Strict  bool
+
+	// Concurrency is the size of the pool of requests in flight, if Pool is
+	// nil.
+	Concurrency int
+	Pool        *pool.Pool
+
+	// Divergence records the divergence of darknode responses to queryTx
+	// requests. It can be nil.
+	Divergence *Divergence
+
+	// Retries is the number of times a request is retried if none of the
+	// darknodes respond, waiting between retries as given by Backoff.
+	Retries int
+	Backoff http.RetryOptions
+
+	// Requests are not sent to a darknode once BreakerThreshold requests to
+	// it have failed in a row, until BreakerCooldown has passed. A threshold
+	// of zero disables circuit breaking.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Requests are not sent to a darknode which has MaxInFlightPerDarknode
+	// requests in flight, or which has been sent RequestsPerDarknodeRate
+	// requests in the last minute, so that the load is spread across the
+	// darknodes. Requests for which every darknode is over its budget fail
+	// with ErrRetryLater. Zero disables either limit, and both are disabled
+	// by default.
+	MaxInFlightPerDarknode  int
+	RequestsPerDarknodeRate int
+
+	// Upstream is the URL of a Lightnode which requests are sent to instead
+	// of the darknodes, if it is not empty.
+	Upstream string
+
+	// Transport sends the requests, such as through the outbound proxies. The
+	// default transport is used if it is nil.
+	Transport nethttp.RoundTripper
+
+	// SlowLog records the requests which took too long. It can be nil.
+	SlowLog *slowlog.Log
+}
+
+// DefaultOptions returns new options with default configurations that should
+// work for the majority of use cases.
+func DefaultOptions() Options {
+	return Options{
+		Logger:      logrus.New(),
+		Timeout:     DefaultTimeout,
+		Cap:         DefaultCap,
+		Concurrency: DefaultConcurrency,
+
+		Retries:          DefaultRetries,
+		Backoff:          DefaultBackoff,
+		BreakerThreshold: DefaultBreakerThreshold,
+		BreakerCooldown:  DefaultBreakerCooldown,
+
+		MaxInFlightPerDarknode:  DefaultMaxInFlightPerDarknode,
+		RequestsPerDarknodeRate: DefaultRequestsPerDarknodeRate,
+	}
+}
+
+// WithLogger returns new options with the given logger.
+func (opts Options) WithLogger(logger logrus.FieldLogger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithTimeout returns new options with the given timeout for requests to the
+// darknodes.
+func (opts Options) WithTimeout(timeout time.Duration) Options {
+	opts.Timeout = timeout
+	return opts
+}
+
+// WithCap returns new options with the given capacity of the message queue of
+// the dispatcher.
+func (opts Options) WithCap(cap int) Options {
+	opts.Cap = cap
+	return opts
+}
+
+// WithStrict returns new options which reject results that do not match the
+// type of the method.
+func (opts Options) WithStrict(strict bool) Options {
+	opts.Strict = strict
+	return opts
+}
+
+// WithConcurrency returns new options with the given number of requests which
+// can be in flight at once.
+func (opts Options) WithConcurrency(concurrency int) Options {
+	opts.Concurrency = concurrency
+	return opts
+}
+
+// WithPool returns new options with the given pool, which can be shared with
+// other components to report their stats together.
+func (opts Options) WithPool(pool *pool.Pool) Options {
+	opts.Pool = pool
+	return opts
+}
+
+// WithDivergence returns new options with the given divergence tracker.
+func (opts Options) WithDivergence(divergence *Divergence) Options {
+	opts.Divergence = divergence
+	return opts
+}
+
+// WithRetries returns new options which retry requests that none of the
+// darknodes respond to, failing over to other darknodes if there are any.
+func (opts Options) WithRetries(retries int, backoff http.RetryOptions) Options {
+	opts.Retries = retries
+	opts.Backoff = backoff
+	return opts
+}
+
+// WithBreakers returns new options which stop sending requests to a darknode
+// once threshold requests to it have failed in a row, until the cooldown has
+// passed.
+func (opts Options) WithBreakers(threshold int, cooldown time.Duration) Options {
+	opts.BreakerThreshold = threshold
+	opts.BreakerCooldown = cooldown
+	return opts
+}
+
+// WithDarknodeBudgets returns new options which send at most maxInFlight
+// requests at once, and at most perMinute requests each minute, to each
+// darknode. Zero disables either limit.
+func (opts Options) WithDarknodeBudgets(maxInFlight, perMinute int) Options {
+	opts.MaxInFlightPerDarknode = maxInFlight
+	opts.RequestsPerDarknodeRate = perMinute
+	return opts
+}
+
+// WithUpstream returns new options which send requests to the JSON-RPC API of
+// the Lightnode at the given URL, rather than to the darknodes. Requests are
+// neither retried, circuit broken nor budgeted, as the upstream does so itself.
+func (opts Options) WithUpstream(url string) Options {
+	opts.Upstream = url
+	return opts
+}
+
+// WithTransport returns new options which send requests with the given
+// transport.
+func (opts Options) WithTransport(transport nethttp.RoundTripper) Options {
+	opts.Transport = transport
+	return opts
+}
+
+// WithSlowLog returns new options which record slow requests in the given
+// log.
+func (opts Options) WithSlowLog(log *slowlog.Log) Options {
+	opts.SlowLog = log
+	return opts
+}
+
+// NewWithOptions constructs a new `Dispatcher` for use outside of the
+// Lightnode. Requests sent to the dispatcher must be
+// `http.RequestWithResponder`s, and are sent to the darknodes in the store. A
+// store containing only bootstrap darknodes can be constructed with
+// `store.NewInMemory`.
+func NewWithOptions(multiStore store.MultiAddrStore, options Options) phi.Task {
+	dispatchPool := options.Pool
+	if dispatchPool == nil {
+		dispatchPool = pool.New("dispatcher", options.Concurrency)
+	}
+	if options.Upstream != "" {
+		return newUpstream(options.Logger, options.Timeout, options.Transport, options.Upstream, dispatchPool, phi.Options{Cap: options.Cap})
+	}
+	var breakers *Breakers
+	if options.BreakerThreshold > 0 {
+		breakers = NewBreakers(options.BreakerThreshold, options.BreakerCooldown)
+	}
+	var budgets *Budgets
+	if options.MaxInFlightPerDarknode > 0 || options.RequestsPerDarknodeRate > 0 {
+		budgets = NewBudgets(options.MaxInFlightPerDarknode, options.RequestsPerDarknodeRate)
+	}
+	return phi.New(
+		&Dispatcher{
+			logger:     options.Logger,
+			client:     http.NewClient(options.Timeout).WithTransport(options.Transport),
+			multiStore: multiStore,
+			divergence: options.Divergence,
+			pool:       dispatchPool,
+			strict:     options.Strict,
+			retries:    options.Retries,
+			backoff:    options.Backoff,
+			breakers:   breakers,
+			budgets:    budgets,
+			slowLog:    options.SlowLog,
+		},
+		phi.Options{Cap: options.Cap},
+	)
+}
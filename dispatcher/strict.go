@@ -0,0 +1,112 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+// resultTypes returns a pointer to the typed result of each method which is
+// checked in strict mode. Results of other methods are passed through.
+var resultTypes = map[string]func() interface{}{
+	jsonrpc.MethodSubmitTx:        func() interface{} { return new(jsonrpc.ResponseSubmitTx) },
+	jsonrpc.MethodQueryTx:         func() interface{} { return new(jsonrpc.ResponseQueryTx) },
+	jsonrpc.MethodQueryPeers:      func() interface{} { return new(jsonrpc.ResponseQueryPeers) },
+	jsonrpc.MethodQueryConfig:     func() interface{} { return new(jsonrpc.ResponseQueryConfig) },
+	jsonrpc.MethodQueryBlockState: func() interface{} { return new(jsonrpc.ResponseQueryBlockState) },
+}
+
+// checkResult decodes the result of a Darknode response into the typed result
+// of the method. It returns an error if the result has fields which are not in
+// the type, or is missing fields which are, so that changes to the responses
+// of the Darknodes are caught before they reach clients.
+func checkResult(method string, result interface{}) error {
+	newResult, ok := resultTypes[method]
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encoding result: %v", err)
+	}
+	typed := newResult()
+	if err := json.Unmarshal(data, typed); err != nil {
+		return fmt.Errorf("decoding result: %v", err)
+	}
+	encoded, err := json.Marshal(typed)
+	if err != nil {
+		return fmt.Errorf("encoding typed result: %v", err)
+	}
+
+	var got, want interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(encoded, &want); err != nil {
+		return err
+	}
+	return compareFields("result", got, want)
+}
+
+// compareFields compares the objects in a decoded result with the objects in
+// the same result after decoding it into its type and encoding it again.
+// Fields which were dropped by the type are unknown, and fields which were
+// added by it are missing. Only the shape of the values is compared, as types
+// are free to normalise the values themselves.
+func compareFields(path string, got, want interface{}) error {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range got {
+			if _, ok := want[key]; !ok && !isZero(value) {
+				return fmt.Errorf("unknown field %v.%v", path, key)
+			}
+		}
+		for key, value := range want {
+			gotValue, ok := got[key]
+			if !ok {
+				return fmt.Errorf("missing field %v.%v", path, key)
+			}
+			if err := compareFields(path+"."+key, gotValue, value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i := 0; i < len(got) && i < len(want); i++ {
+			if err := compareFields(fmt.Sprintf("%v[%v]", path, i), got[i], want[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isZero returns whether a decoded value is empty, in which case it may have
+// been omitted when the typed result was encoded.
+func isZero(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case float64:
+		return value == 0
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,85 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	nethttp "net/http"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/metrics"
+	"github.com/renproject/lightnode/pool"
+	"github.com/renproject/phi"
+	"github.com/sirupsen/logrus"
+)
+
+// upstream is a task which sends requests to another Lightnode, rather than to
+// the Darknodes. It is used by Lightnodes which only serve the compat layer,
+// and rely on the upstream Lightnode for everything else.
+type upstream struct {
+	logger logrus.FieldLogger
+	client http.Client
+	url    string
+	pool   *pool.Pool
+}
+
+// newUpstream constructs a task which sends requests to the JSON-RPC API of the
+// Lightnode at the given URL with the given transport. The pool bounds the
+// number of requests which are in flight at once, as with the dispatcher.
+func newUpstream(logger logrus.FieldLogger, timeout time.Duration, transport nethttp.RoundTripper, url string, pool *pool.Pool, opts phi.Options) phi.Task {
+	return phi.New(
+		&upstream{
+			logger: logger,
+			client: http.NewClient(timeout).WithTransport(transport),
+			url:    url,
+			pool:   pool,
+		},
+		opts,
+	)
+}
+
+// Handle implements the `phi.Handler` interface.
+func (upstream *upstream) Handle(_ phi.Task, message phi.Message) {
+	msg, ok := message.(http.RequestWithResponder)
+	if !ok {
+		upstream.logger.Panicf("[upstream] unexpected message type %T", message)
+	}
+
+	params, err := json.Marshal(msg.Params)
+	if err != nil {
+		upstream.logger.Errorf("[upstream] invalid params=%v: %v", msg.Params, err)
+		msg.RespondWithErr(jsonrpc.ErrorCodeInvalidParams, err)
+		return
+	}
+	req := jsonrpc.Request{
+		Version: "2.0",
+		ID:      msg.ID,
+		Method:  msg.Method,
+		Params:  params,
+	}
+
+	// Requests for a specific Darknode are passed on to the upstream, which
+	// knows the addresses of the Darknodes.
+	url := upstream.url
+	if len(msg.Query) > 0 {
+		url += "?" + msg.Query.Encode()
+	}
+
+	send := func() {
+		start := time.Now()
+		response, err := upstream.client.SendRequest(msg.Context, url, req, nil)
+		if err != nil {
+			metrics.ObserveDispatch(msg.Method, start, true)
+			upstream.logger.Errorf("[upstream] sending %v request: %v", msg.Method, err)
+			msg.RespondWithErr(jsonrpc.ErrorCodeInternal, err)
+			return
+		}
+		metrics.ObserveDispatch(msg.Method, start, response.Error != nil)
+		response.ID = msg.ID
+		msg.Responder <- response
+	}
+	if err := upstream.pool.Go(msg.Context, send); err != nil {
+		upstream.logger.Warnf("[upstream] dropping %v request: %v", msg.Method, err)
+		msg.RespondWithErr(jsonrpc.ErrorCodeInternal, err)
+	}
+}
@@ -0,0 +1,71 @@
+package dispatcher_test
+
+import (
+	"context"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/testutils"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/store"
+)
+
+var _ = Describe("Upstream", func() {
+	It("should send requests to the upstream lightnode instead of the darknodes", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		queries := make(chan url.Values, 1)
+		server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			var req jsonrpc.Request
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(nethttp.StatusBadRequest)
+				return
+			}
+			queries <- r.URL.Query()
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]string{"method": req.Method}})
+		}))
+		defer server.Close()
+
+		// There are no darknodes, so the request can only be answered by the
+		// upstream.
+		upstream := dispatcher.NewWithOptions(store.NewInMemory(nil), dispatcher.DefaultOptions().WithUpstream(server.URL))
+		go upstream.Run(ctx)
+
+		id, params := ValidRequest(jsonrpc.MethodQueryBlockState)
+		req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, url.Values{"id": []string{"darknode"}})
+		Expect(upstream.Send(req)).To(BeTrue())
+
+		var response jsonrpc.Response
+		Eventually(req.Responder, 5*time.Second).Should(Receive(&response))
+		Expect(response.Error).To(BeNil())
+		Expect(response.Result).To(HaveKeyWithValue("method", jsonrpc.MethodQueryBlockState))
+		Eventually(queries).Should(Receive(HaveKeyWithValue("id", []string{"darknode"})))
+	})
+
+	It("should respond with an error if the upstream cannot be reached", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		upstream := dispatcher.NewWithOptions(store.NewInMemory(nil), dispatcher.DefaultOptions().
+			WithTimeout(time.Second).
+			WithUpstream("http://127.0.0.1:1"))
+		go upstream.Run(ctx)
+
+		id, params := ValidRequest(jsonrpc.MethodQueryBlockState)
+		req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, url.Values{})
+		Expect(upstream.Send(req)).To(BeTrue())
+
+		var response jsonrpc.Response
+		Eventually(req.Responder, 5*time.Second).Should(Receive(&response))
+		Expect(response.Error).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,131 @@
+// Package errors defines the kinds of errors shared by the packages of the
+// Lightnode. Errors are wrapped with their kind so that callers can check the
+// kind using `Is` rather than matching error messages, and the kind of an error
+// determines the JSON-RPC error code it is returned to clients with.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+// Kinds of errors. The message of each kind is used as the message of errors
+// which are returned without further detail.
+var (
+	ErrNotFound                  = errors.New("not found")
+	ErrInvalidParams             = errors.New("invalid params")
+	ErrBackpressure              = errors.New("too much back pressure")
+	ErrCompatConversion          = errors.New("failed compatibility conversion")
+	ErrChainRPC                  = errors.New("chain rpc error")
+	ErrInsufficientConfirmations = errors.New("insufficient confirmations")
+	ErrConflict                  = errors.New("conflict")
+	ErrRetryLater                = errors.New("try again later")
+	ErrUnauthorized              = errors.New("unauthorized")
+)
+
+// ErrorCodeRetryLater is the JSON-RPC error code of requests which were not
+// served because the Lightnode is temporarily unable to accept them, and which
+// clients should retry unchanged after a while. It is in the range reserved
+// for implementation-defined server errors.
+const ErrorCodeRetryLater = -32001
+
+// ErrorCodeUnauthorized is the JSON-RPC error code of requests for methods
+// which require an API key, but which were made without a known one.
+const ErrorCodeUnauthorized = -32002
+
+// kindError is an error of a given kind. It has the message of the underlying
+// error, so that wrapping an error does not change what clients see.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e kindError) Unwrap() error {
+	return e.err
+}
+
+func (e kindError) Is(target error) bool {
+	return e.kind == target
+}
+
+// Wrap returns the error as an error of the given kind. It returns nil if the
+// error is nil.
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return kindError{kind: kind, err: err}
+}
+
+// Wrapf returns an error of the given kind with the formatted message.
+func Wrapf(kind error, format string, args ...interface{}) error {
+	return Wrap(kind, fmt.Errorf(format, args...))
+}
+
+// Is reports whether the error, or any error it wraps, is of the given kind.
+func Is(err, kind error) bool {
+	return errors.Is(err, kind)
+}
+
+// FromChain classifies an error returned by the chain bindings, which only
+// describe the cause of an error in its message. Errors for outputs which are
+// not found, such as spent UTXOs, are of kind ErrNotFound, and errors for txs
+// which do not yet have enough confirmations are of kind
+// ErrInsufficientConfirmations. All other errors are of kind ErrChainRPC.
+func FromChain(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "insufficient confirmations"):
+		return Wrap(ErrInsufficientConfirmations, err)
+	case strings.Contains(message, "result is nil"):
+		return Wrap(ErrNotFound, err)
+	default:
+		return Wrap(ErrChainRPC, err)
+	}
+}
+
+// AlreadyDone returns whether the Darknodes rejected a tx because it has
+// already been executed.
+func AlreadyDone(err *jsonrpc.Error) bool {
+	return err != nil && (strings.Contains(err.Message, "status=done") || strings.Contains(err.Message, "status = done"))
+}
+
+// TxNotFound returns whether the Darknodes responded to a queryTx request with
+// an error because they do not know the tx.
+func TxNotFound(err *jsonrpc.Error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Message), "not found")
+}
+
+// Code returns the JSON-RPC error code for the kind of the error. Errors caused
+// by the request have the invalid params code, requests which should be
+// retried later have the retry later code, unauthenticated requests have the
+// unauthorized code, and all other errors have the internal code.
+func Code(err error) int {
+	switch {
+	case Is(err, ErrInvalidParams), Is(err, ErrNotFound), Is(err, ErrConflict):
+		return jsonrpc.ErrorCodeInvalidParams
+	case Is(err, ErrRetryLater):
+		return ErrorCodeRetryLater
+	case Is(err, ErrUnauthorized):
+		return ErrorCodeUnauthorized
+	default:
+		return jsonrpc.ErrorCodeInternal
+	}
+}
+
+// Response returns a JSON-RPC response for the error, with the code for its
+// kind.
+func Response(id interface{}, err error) jsonrpc.Response {
+	jsonErr := jsonrpc.NewError(Code(err), err.Error(), nil)
+	return jsonrpc.NewResponse(id, nil, &jsonErr)
+}
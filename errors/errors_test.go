@@ -0,0 +1,61 @@
+package errors_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/errors"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+var _ = Describe("Errors", func() {
+	It("should keep the message of wrapped errors", func() {
+		err := Wrapf(ErrInvalidParams, "invalid params: %v", "bad nonce")
+		Expect(err.Error()).To(Equal("invalid params: bad nonce"))
+		Expect(Is(err, ErrInvalidParams)).To(BeTrue())
+		Expect(Is(err, ErrNotFound)).To(BeFalse())
+		Expect(Wrap(ErrNotFound, nil)).To(BeNil())
+	})
+
+	It("should find the kind of errors which are wrapped again", func() {
+		err := fmt.Errorf("reading mapping: %w", Wrap(ErrNotFound, fmt.Errorf("redis: nil")))
+		Expect(Is(err, ErrNotFound)).To(BeTrue())
+	})
+
+	It("should classify chain errors", func() {
+		Expect(Is(FromChain(fmt.Errorf("insufficient confirmations: 1/6")), ErrInsufficientConfirmations)).To(BeTrue())
+		Expect(Is(FromChain(fmt.Errorf("gettxout: result is nil")), ErrNotFound)).To(BeTrue())
+		Expect(Is(FromChain(fmt.Errorf("connection refused")), ErrChainRPC)).To(BeTrue())
+		Expect(FromChain(nil)).To(BeNil())
+	})
+
+	It("should detect txs which are already done", func() {
+		Expect(AlreadyDone(&jsonrpc.Error{Message: "tx status=done"})).To(BeTrue())
+		Expect(AlreadyDone(&jsonrpc.Error{Message: "tx status = done"})).To(BeTrue())
+		Expect(AlreadyDone(&jsonrpc.Error{Message: "tx status=executing"})).To(BeFalse())
+		Expect(AlreadyDone(nil)).To(BeFalse())
+	})
+
+	It("should detect txs which are not found", func() {
+		Expect(TxNotFound(&jsonrpc.Error{Message: "tx=abc not found"})).To(BeTrue())
+		Expect(TxNotFound(&jsonrpc.Error{Message: "Not Found"})).To(BeTrue())
+		Expect(TxNotFound(&jsonrpc.Error{Message: "unable to query the network"})).To(BeFalse())
+		Expect(TxNotFound(nil)).To(BeFalse())
+	})
+
+	It("should map kinds to json-rpc codes", func() {
+		Expect(Code(Wrapf(ErrInvalidParams, "invalid"))).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+		Expect(Code(ErrNotFound)).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+		Expect(Code(Wrapf(ErrConflict, "conflict"))).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+		Expect(Code(ErrBackpressure)).To(Equal(jsonrpc.ErrorCodeInternal))
+		Expect(Code(Wrapf(ErrRetryLater, "busy"))).To(Equal(ErrorCodeRetryLater))
+		Expect(Code(Wrapf(ErrUnauthorized, "api key required"))).To(Equal(ErrorCodeUnauthorized))
+		Expect(Code(fmt.Errorf("unknown"))).To(Equal(jsonrpc.ErrorCodeInternal))
+
+		response := Response(1, ErrBackpressure)
+		Expect(response.Error.Code).To(Equal(jsonrpc.ErrorCodeInternal))
+		Expect(response.Error.Message).To(Equal("too much back pressure"))
+	})
+})
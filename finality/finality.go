@@ -0,0 +1,83 @@
+// Package finality checks transactions against the safe/finalized block tags
+// of EVM chains, as an alternative to waiting for a fixed number of
+// confirmations.
+package finality
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/renproject/pack"
+)
+
+// Enumerate the block tags supported by chains with finality.
+const (
+	TagSafe      = "safe"
+	TagFinalized = "finalized"
+)
+
+// Checker checks whether transactions on a host chain have been finalised.
+type Checker interface {
+	// FetchBlockHeight returns the height of the latest finalised block.
+	FetchBlockHeight(ctx context.Context) (uint64, error)
+
+	// TxFinalized returns true if the transaction with the given hash is
+	// included in a finalised block.
+	TxFinalized(ctx context.Context, txid pack.Bytes) (bool, error)
+}
+
+// ValidTag returns true if the tag is a supported finality tag.
+func ValidTag(tag string) bool {
+	return tag == TagSafe || tag == TagFinalized
+}
+
+// EthChecker is a Checker for EVM chains which support block tags.
+type EthChecker struct {
+	client *rpc.Client
+	tag    string
+}
+
+// NewEthChecker returns a new EthChecker using the given block tag.
+func NewEthChecker(client *rpc.Client, tag string) EthChecker {
+	return EthChecker{
+		client: client,
+		tag:    tag,
+	}
+}
+
+// FetchBlockHeight implements the Checker interface.
+func (checker EthChecker) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	var header *struct {
+		Number hexutil.Uint64 `json:"number"`
+	}
+	if err := checker.client.CallContext(ctx, &header, "eth_getBlockByNumber", checker.tag, false); err != nil {
+		return 0, fmt.Errorf("fetching %v block: %v", checker.tag, err)
+	}
+	if header == nil {
+		return 0, fmt.Errorf("fetching %v block: tag not supported", checker.tag)
+	}
+	return uint64(header.Number), nil
+}
+
+// TxFinalized implements the Checker interface.
+func (checker EthChecker) TxFinalized(ctx context.Context, txid pack.Bytes) (bool, error) {
+	var receipt *struct {
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	}
+	if err := checker.client.CallContext(ctx, &receipt, "eth_getTransactionReceipt", common.BytesToHash(txid).Hex()); err != nil {
+		return false, fmt.Errorf("fetching receipt: %v", err)
+	}
+	if receipt == nil {
+		// The transaction has not been mined yet.
+		return false, nil
+	}
+
+	height, err := checker.FetchBlockHeight(ctx)
+	if err != nil {
+		return false, err
+	}
+	return uint64(receipt.BlockNumber) <= height, nil
+}
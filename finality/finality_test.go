@@ -0,0 +1,80 @@
+package finality_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/finality"
+
+	"github.com/renproject/pack"
+)
+
+var _ = Describe("Finality checker", func() {
+	// init starts a mock EVM node which reports the given finalised height,
+	// and the given block number for every transaction receipt (or no
+	// receipt when the block number is zero).
+	init := func(finalizedHeight, receiptHeight uint64) Checker {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				ID     json.RawMessage   `json:"id"`
+				Method string            `json:"method"`
+				Params []json.RawMessage `json:"params"`
+			}
+			Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+
+			var result interface{}
+			switch req.Method {
+			case "eth_getBlockByNumber":
+				Expect(string(req.Params[0])).To(Equal(fmt.Sprintf("%q", TagFinalized)))
+				result = map[string]string{"number": fmt.Sprintf("0x%x", finalizedHeight)}
+			case "eth_getTransactionReceipt":
+				if receiptHeight != 0 {
+					result = map[string]string{"blockNumber": fmt.Sprintf("0x%x", receiptHeight)}
+				}
+			}
+			Expect(json.NewEncoder(w).Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      req.ID,
+				"result":  result,
+			})).To(Succeed())
+		}))
+		client, err := rpc.Dial(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		return NewEthChecker(client, TagFinalized)
+	}
+
+	It("should return the height of the finalised block", func() {
+		checker := init(100, 0)
+		height, err := checker.FetchBlockHeight(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(height).To(Equal(uint64(100)))
+	})
+
+	It("should only consider transactions in finalised blocks as final", func() {
+		txid := pack.Bytes(make([]byte, 32))
+
+		finalized, err := init(100, 100).TxFinalized(context.Background(), txid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(finalized).To(BeTrue())
+
+		finalized, err = init(100, 101).TxFinalized(context.Background(), txid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(finalized).To(BeFalse())
+
+		finalized, err = init(100, 0).TxFinalized(context.Background(), txid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(finalized).To(BeFalse())
+	})
+
+	It("should validate tags", func() {
+		Expect(ValidTag(TagSafe)).To(BeTrue())
+		Expect(ValidTag(TagFinalized)).To(BeTrue())
+		Expect(ValidTag("latest")).To(BeFalse())
+	})
+})
@@ -11,13 +11,17 @@ require (
 	github.com/ethereum/go-ethereum v1.10.7
 	github.com/evalphobia/logrus_sentry v0.8.2
 	github.com/go-redis/redis/v7 v7.2.0
+	github.com/golang/protobuf v1.4.3
 	github.com/google/go-cmp v0.5.6
+	github.com/gorilla/websocket v1.4.2
 	github.com/jbenet/go-base58 v0.0.0-20150317085156-6237cf65f3a6
 	github.com/lib/pq v1.7.0
+	github.com/makiuchi-d/gozxing v0.1.1
 	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/near/borsh-go v0.3.0
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.10.1
+	github.com/prometheus/client_golang v1.6.0
 	github.com/renproject/aw v0.5.3
 	github.com/renproject/darknode v0.5.3-0.20210914051036-04adb12237f0
 	github.com/renproject/id v0.4.2
@@ -30,7 +34,10 @@ require (
 	github.com/xlab/c-for-go v0.0.0-20201223145653-3ba5db515dcb // indirect
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
+	google.golang.org/grpc v1.31.1
+	google.golang.org/protobuf v1.25.0
 )
 
 replace github.com/cosmos/ledger-cosmos-go => github.com/terra-project/ledger-terra-go v0.11.1-terra
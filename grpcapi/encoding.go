@@ -0,0 +1,82 @@
+package grpcapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// jsonTx is a tx as it is encoded in the JSON-RPC API.
+type jsonTx struct {
+	Version  string                 `json:"version"`
+	Hash     string                 `json:"hash"`
+	Selector string                 `json:"selector"`
+	Input    map[string]interface{} `json:"in,omitempty"`
+	Output   map[string]interface{} `json:"out,omitempty"`
+}
+
+// txMessage returns the message of a tx, which can be anything that encodes
+// to a tx in the JSON-RPC API.
+func txMessage(transaction interface{}) (*Tx, error) {
+	var decoded jsonTx
+	if err := reencode(transaction, &decoded); err != nil {
+		return nil, err
+	}
+	hash, err := base64.RawURLEncoding.DecodeString(decoded.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx hash %v: %v", decoded.Hash, err)
+	}
+	input, err := newStruct(decoded.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input of tx %v: %v", decoded.Hash, err)
+	}
+	output, err := newStruct(decoded.Output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output of tx %v: %v", decoded.Hash, err)
+	}
+	return &Tx{
+		Version:  decoded.Version,
+		Hash:     hash,
+		Selector: decoded.Selector,
+		Input:    input,
+		Output:   output,
+	}, nil
+}
+
+// txJSON returns the tx as it is encoded in the params of ren_submitTx.
+func txJSON(msg *Tx) jsonTx {
+	transaction := jsonTx{
+		Version:  msg.GetVersion(),
+		Hash:     base64.RawURLEncoding.EncodeToString(msg.GetHash()),
+		Selector: msg.GetSelector(),
+	}
+	if msg.GetInput() != nil {
+		transaction.Input = msg.GetInput().AsMap()
+	}
+	if msg.GetOutput() != nil {
+		transaction.Output = msg.GetOutput().AsMap()
+	}
+	return transaction
+}
+
+// newStruct returns the struct with the fields, or nil if there are none, so
+// that absent values remain absent.
+func newStruct(fields map[string]interface{}) (*structpb.Struct, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	return structpb.NewStruct(fields)
+}
+
+// reencode decodes the JSON encoding of the value into v. Results of the
+// resolver may be typed or raw, so they are turned into messages through
+// their JSON encoding, which is what the JSON-RPC API returns.
+func reencode(value interface{}, v interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
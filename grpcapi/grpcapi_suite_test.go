@@ -0,0 +1,13 @@
+package grpcapi_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestGrpcapi(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Grpcapi Suite")
+}
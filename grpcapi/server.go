@@ -0,0 +1,363 @@
+// Package grpcapi serves the JSON-RPC API of the Lightnode over gRPC, for
+// integrators who want typed clients and streaming rather than JSON-RPC over
+// HTTP. The service is defined in lightnode.proto, from which lightnode.pb.go
+// is generated with
+//
+//	protoc --go_out=plugins=grpc,paths=source_relative:. lightnode.proto
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	lerrors "github.com/renproject/lightnode/errors"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/resolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Server serves the gRPC service. Requests are turned into JSON-RPC requests,
+// which are validated by the validator and resolved by the resolver used by
+// the JSON-RPC server, so both APIs behave the same.
+type Server struct {
+	logger    logging.Logger
+	validator jsonrpc.Validator
+	resolver  jsonrpc.Resolver
+	pollRate  time.Duration
+	methods   map[string]bool
+	streams   chan struct{}
+	server    *grpc.Server
+}
+
+// New returns a Server which streams the status of txs watched with WatchTx
+// by querying them with the poll rate. At most maxStreams txs are watched at
+// once.
+func New(logger logging.Logger, validator jsonrpc.Validator, r jsonrpc.Resolver, pollRate time.Duration, maxStreams int) *Server {
+	methods := map[string]bool{}
+	for _, method := range resolver.DescribeAPI().Methods {
+		methods[method.Name] = true
+	}
+	server := &Server{
+		logger:    logger,
+		validator: validator,
+		resolver:  r,
+		pollRate:  pollRate,
+		methods:   methods,
+		streams:   make(chan struct{}, maxStreams),
+		server:    grpc.NewServer(),
+	}
+	RegisterLightnodeServer(server.server, server)
+	return server
+}
+
+// Serve serves gRPC requests from the listener until the context is done, at
+// which point in-flight requests are given the chance to finish.
+func (server *Server) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		server.server.GracefulStop()
+	}()
+	return server.server.Serve(ln)
+}
+
+// QueryTx implements LightnodeServer.
+func (server *Server) QueryTx(ctx context.Context, req *QueryTxRequest) (*QueryTxResponse, error) {
+	result, err := server.call(ctx, jsonrpc.MethodQueryTx, map[string]string{
+		"txHash": base64.RawURLEncoding.EncodeToString(req.TxHash),
+	})
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := lhttp.DecodeQueryTxResult(result)
+	if err != nil {
+		return nil, server.encodingError(jsonrpc.MethodQueryTx, err)
+	}
+	transaction, err := txMessage(decoded.Tx)
+	if err != nil {
+		return nil, server.encodingError(jsonrpc.MethodQueryTx, err)
+	}
+	return &QueryTxResponse{Tx: transaction, TxStatus: statusName(decoded.TxStatus)}, nil
+}
+
+// QueryTxs implements LightnodeServer.
+func (server *Server) QueryTxs(ctx context.Context, req *QueryTxsRequest) (*QueryTxsResponse, error) {
+	params := map[string]string{}
+	if req.Offset > 0 {
+		params["offset"] = strconv.FormatUint(req.Offset, 10)
+	}
+	if req.Limit > 0 {
+		params["limit"] = strconv.FormatUint(req.Limit, 10)
+	}
+	result, err := server.call(ctx, jsonrpc.MethodQueryTxs, params)
+	if err != nil {
+		return nil, err
+	}
+	var decoded struct {
+		Total       uint64            `json:"total"`
+		Approximate bool              `json:"approximate"`
+		HasMore     bool              `json:"hasMore"`
+		Txs         []json.RawMessage `json:"txs"`
+	}
+	if err := reencode(result, &decoded); err != nil {
+		return nil, server.encodingError(jsonrpc.MethodQueryTxs, err)
+	}
+	response := &QueryTxsResponse{
+		Total:       decoded.Total,
+		Approximate: decoded.Approximate,
+		HasMore:     decoded.HasMore,
+		Txs:         make([]*Tx, len(decoded.Txs)),
+	}
+	for i := range decoded.Txs {
+		if response.Txs[i], err = txMessage(decoded.Txs[i]); err != nil {
+			return nil, server.encodingError(jsonrpc.MethodQueryTxs, err)
+		}
+	}
+	return response, nil
+}
+
+// SubmitTx implements LightnodeServer.
+func (server *Server) SubmitTx(ctx context.Context, req *SubmitTxRequest) (*SubmitTxResponse, error) {
+	if req.Tx == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing tx")
+	}
+	if _, err := server.call(ctx, jsonrpc.MethodSubmitTx, map[string]interface{}{"tx": txJSON(req.Tx)}); err != nil {
+		return nil, err
+	}
+	return &SubmitTxResponse{}, nil
+}
+
+// QueryBlockState implements LightnodeServer.
+func (server *Server) QueryBlockState(ctx context.Context, req *QueryBlockStateRequest) (*QueryBlockStateResponse, error) {
+	result, err := server.call(ctx, jsonrpc.MethodQueryBlockState, struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	var decoded struct {
+		State map[string]interface{} `json:"state"`
+	}
+	if err := reencode(result, &decoded); err != nil {
+		return nil, server.encodingError(jsonrpc.MethodQueryBlockState, err)
+	}
+	state, err := newStruct(decoded.State)
+	if err != nil {
+		return nil, server.encodingError(jsonrpc.MethodQueryBlockState, err)
+	}
+	return &QueryBlockStateResponse{State: state}, nil
+}
+
+// Call implements LightnodeServer.
+func (server *Server) Call(ctx context.Context, req *CallRequest) (*CallResponse, error) {
+	if !server.methods[req.Method] {
+		return nil, status.Errorf(codes.Unimplemented, "unknown method %v", req.Method)
+	}
+	result, err := server.call(ctx, req.Method, req.Params.AsMap())
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := reencode(result, &decoded); err != nil {
+		return nil, server.encodingError(req.Method, err)
+	}
+	value, err := structpb.NewValue(decoded)
+	if err != nil {
+		return nil, server.encodingError(req.Method, err)
+	}
+	return &CallResponse{Result: value}, nil
+}
+
+// call validates and resolves the JSON-RPC request, and returns its result.
+func (server *Server) call(ctx context.Context, method string, params interface{}) (interface{}, error) {
+	id := rand.Int63()
+	r := httpRequest(ctx)
+	validated, err := server.validate(ctx, id, method, params, r)
+	if err != nil {
+		return nil, err
+	}
+	response := server.resolve(ctx, id, method, validated, r)
+	if response.Error != nil {
+		return nil, statusError(response.Error)
+	}
+	return response.Result, nil
+}
+
+// encodingError logs that the result of the method cannot be turned into its
+// message, and returns the status sent to the client.
+func (server *Server) encodingError(method string, err error) error {
+	server.logger.Errorf("[grpc] cannot encode result of %v: %v", method, err)
+	return status.Error(codes.Internal, "cannot encode result")
+}
+
+// validate returns the params of the request as they are passed to the
+// resolver.
+func (server *Server) validate(ctx context.Context, id interface{}, method string, params interface{}, r *http.Request) (interface{}, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot encode params: %v", err)
+	}
+	validated, response := server.validator.ValidateRequest(ctx, r, jsonrpc.Request{
+		Version: "2.0",
+		ID:      id,
+		Method:  method,
+		Params:  raw,
+	})
+	if response.Error != nil {
+		return nil, statusError(response.Error)
+	}
+	return validated, nil
+}
+
+// resolve calls the resolver method for the validated params, as the JSON-RPC
+// server does.
+func (server *Server) resolve(ctx context.Context, id interface{}, method string, params interface{}, r *http.Request) jsonrpc.Response {
+	switch params := params.(type) {
+	case *jsonrpc.ParamsQueryBlock:
+		return server.resolver.QueryBlock(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryBlocks:
+		return server.resolver.QueryBlocks(ctx, id, params, r)
+	case *jsonrpc.ParamsSubmitTx:
+		return server.resolver.SubmitTx(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryTx:
+		return server.resolver.QueryTx(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryTxs:
+		return server.resolver.QueryTxs(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryPeers:
+		return server.resolver.QueryPeers(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryNumPeers:
+		return server.resolver.QueryNumPeers(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryShards:
+		return server.resolver.QueryShards(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryStat:
+		return server.resolver.QueryStat(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryFees:
+		return server.resolver.QueryFees(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryConfig:
+		return server.resolver.QueryConfig(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryState:
+		return server.resolver.QueryState(ctx, id, params, r)
+	case *jsonrpc.ParamsQueryBlockState:
+		return server.resolver.QueryBlockState(ctx, id, params, r)
+	default:
+		return server.resolver.Fallback(ctx, id, method, params, r)
+	}
+}
+
+// WatchTx implements LightnodeServer. It streams the status of the tx until
+// it is done or reverted, or the client goes away.
+func (server *Server) WatchTx(req *QueryTxRequest, stream Lightnode_WatchTxServer) error {
+	select {
+	case server.streams <- struct{}{}:
+		defer func() { <-server.streams }()
+	default:
+		return status.Error(codes.ResourceExhausted, "too many streams")
+	}
+
+	ctx := stream.Context()
+	r := httpRequest(ctx)
+	validated, err := server.validate(ctx, rand.Int63(), jsonrpc.MethodQueryTx, map[string]string{
+		"txHash": base64.RawURLEncoding.EncodeToString(req.TxHash),
+	}, r)
+	if err != nil {
+		return err
+	}
+	params, ok := validated.(*jsonrpc.ParamsQueryTx)
+	if !ok {
+		return status.Error(codes.InvalidArgument, "invalid tx hash")
+	}
+
+	ticker := time.NewTicker(server.pollRate)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		response := server.resolver.QueryTx(ctx, rand.Int63(), params, r)
+		if response.Error == nil {
+			result, err := lhttp.DecodeQueryTxResult(response.Result)
+			if err != nil {
+				server.logger.Warnf("[grpc] cannot decode queryTx result for tx=%v: %v", params.TxHash, err)
+			} else if txStatus := statusName(result.TxStatus); txStatus != last {
+				last = txStatus
+				transaction, err := txMessage(result.Tx)
+				if err != nil {
+					return server.encodingError(jsonrpc.MethodQueryTx, err)
+				}
+				if err := stream.Send(&TxStatusUpdate{TxHash: req.TxHash, TxStatus: txStatus, Tx: transaction}); err != nil {
+					return err
+				}
+				if result.TxStatus == tx.StatusDone || result.TxStatus == tx.StatusReverted {
+					return nil
+				}
+			}
+		}
+		// Otherwise the tx may not have been submitted yet, so it is queried
+		// again on the next poll.
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusName returns the name of the status, as it is encoded in JSON-RPC
+// responses.
+func statusName(txStatus tx.Status) string {
+	var name string
+	raw, err := json.Marshal(txStatus)
+	if err != nil || json.Unmarshal(raw, &name) != nil {
+		return fmt.Sprint(txStatus)
+	}
+	return name
+}
+
+// httpRequest returns the HTTP request equivalent to the gRPC request, which
+// the validator and resolver use to identify the client. Clients are
+// identified by the address of the peer, as the gRPC port is not served
+// behind proxies, and the API key is the only metadata which becomes a
+// header, so that clients can authenticate as they do with the JSON-RPC API.
+func httpRequest(ctx context.Context) *http.Request {
+	r := &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{},
+		Header: http.Header{},
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range md.Get(resolver.APIKeyHeader) {
+			r.Header.Add(resolver.APIKeyHeader, key)
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+// statusError returns the gRPC status equivalent to the JSON-RPC error.
+func statusError(err *jsonrpc.Error) error {
+	switch err.Code {
+	case jsonrpc.ErrorCodeInvalidParams, jsonrpc.ErrorCodeInvalidJSON:
+		return status.Error(codes.InvalidArgument, err.Message)
+	case jsonrpc.ErrorCodeInvalidRequest, lerrors.ErrorCodeRetryLater:
+		// Requests are always well formed, so they are only invalid if they
+		// are rate limited.
+		return status.Error(codes.ResourceExhausted, err.Message)
+	default:
+		return status.Error(codes.Internal, err.Message)
+	}
+}
@@ -0,0 +1,177 @@
+package grpcapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/grpcapi"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
+	"github.com/renproject/lightnode/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// queryTxValidator only accepts queryTx requests, and records the headers of
+// the last request it validated.
+type queryTxValidator struct {
+	mu     *sync.Mutex
+	header http.Header
+}
+
+func (validator *queryTxValidator) ValidateRequest(ctx context.Context, r *http.Request, req jsonrpc.Request) (interface{}, jsonrpc.Response) {
+	validator.mu.Lock()
+	validator.header = r.Header
+	validator.mu.Unlock()
+
+	if req.Method != jsonrpc.MethodQueryTx {
+		return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{Code: jsonrpc.ErrorCodeInvalidParams, Message: "unsupported"})
+	}
+	params := new(jsonrpc.ParamsQueryTx)
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{Code: jsonrpc.ErrorCodeInvalidParams, Message: err.Error()})
+	}
+	return params, jsonrpc.Response{}
+}
+
+// statusResolver responds to queryTx requests with a tx whose status can be
+// changed.
+type statusResolver struct {
+	jsonrpc.Resolver
+
+	mu     *sync.Mutex
+	tx     tx.Tx
+	status tx.Status
+}
+
+func (resolver *statusResolver) QueryTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTx, req *http.Request) jsonrpc.Response {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryTx{Tx: resolver.tx, TxStatus: resolver.status}, nil)
+}
+
+func (resolver *statusResolver) setStatus(status tx.Status) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.status = status
+}
+
+var _ = Describe("gRPC server", func() {
+	init := func(ctx context.Context, maxStreams int) (*queryTxValidator, *statusResolver, LightnodeClient) {
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		validator := &queryTxValidator{mu: new(sync.Mutex)}
+		resolver := &statusResolver{mu: new(sync.Mutex), tx: txutil.RandomGoodTx(r), status: tx.StatusConfirming}
+		server := New(logging.FromLogrus(logrus.New()), validator, resolver, 20*time.Millisecond, maxStreams)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go server.Serve(ctx, ln)
+
+		conn, err := grpc.DialContext(ctx, ln.Addr().String(), grpc.WithInsecure())
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+		return validator, resolver, NewLightnodeClient(conn)
+	}
+
+	It("should resolve requests like the json-rpc api", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		validator, resolver, client := init(ctx, 1)
+
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", "secret", "x-forwarded-for", "1.2.3.4")
+		response, err := client.QueryTx(ctx, &QueryTxRequest{TxHash: resolver.tx.Hash[:]})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Tx.Hash).To(Equal(resolver.tx.Hash[:]))
+		Expect(response.Tx.Selector).To(Equal(resolver.tx.Selector.String()))
+		Expect(response.Tx.Input).NotTo(BeNil())
+		Expect(response.TxStatus).To(Equal("confirming"))
+
+		// Only the API key is forwarded, so that clients cannot choose the
+		// address they are rate limited by.
+		validator.mu.Lock()
+		defer validator.mu.Unlock()
+		Expect(validator.header.Get("X-Api-Key")).To(Equal("secret"))
+		Expect(validator.header.Get("X-Forwarded-For")).To(BeEmpty())
+	})
+
+	It("should return json-rpc errors as statuses", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, _, client := init(ctx, 1)
+
+		_, err := client.QueryBlockState(ctx, &QueryBlockStateRequest{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		_, err = client.Call(ctx, &CallRequest{Method: "ren_unknown"})
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+
+		_, err = client.SubmitTx(ctx, &SubmitTxRequest{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should stream status changes until the tx is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, resolver, client := init(ctx, 1)
+
+		stream, err := client.WatchTx(ctx, &QueryTxRequest{TxHash: resolver.tx.Hash[:]})
+		Expect(err).NotTo(HaveOccurred())
+
+		update, err := stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(update.TxHash).To(Equal(resolver.tx.Hash[:]))
+		Expect(update.TxStatus).To(Equal("confirming"))
+
+		resolver.setStatus(tx.StatusDone)
+		update, err = stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(update.TxStatus).To(Equal("done"))
+
+		_, err = stream.Recv()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("should limit the number of concurrent streams", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, resolver, client := init(ctx, 1)
+
+		stream, err := client.WatchTx(ctx, &QueryTxRequest{TxHash: resolver.tx.Hash[:]})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+
+		rejected, err := client.WatchTx(ctx, &QueryTxRequest{TxHash: resolver.tx.Hash[:]})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = rejected.Recv()
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+
+		// Streams free their slot once the tx is done.
+		resolver.setStatus(tx.StatusDone)
+		Eventually(func() error {
+			_, err := stream.Recv()
+			return err
+		}).Should(Equal(io.EOF))
+		accepted, err := client.WatchTx(ctx, &QueryTxRequest{TxHash: resolver.tx.Hash[:]})
+		Expect(err).NotTo(HaveOccurred())
+		update, err := accepted.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(update.TxStatus).To(Equal("done"))
+	})
+})
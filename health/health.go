@@ -0,0 +1,229 @@
+// Package health checks the dependencies of the Lightnode, such as Redis, the
+// database, the Darknodes and the RPCs of chains, so that orchestrators can
+// gate traffic on whether the Lightnode is able to serve requests.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Statuses of dependencies and of the Lightnode as a whole.
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusDegraded = "degraded"
+)
+
+// A Probe checks a single dependency. It returns an error if the dependency
+// cannot be used.
+type Probe func(ctx context.Context) error
+
+// Dependency is the result of probing a dependency.
+type Dependency struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the result of probing every dependency. Its status is ok if every
+// dependency is ok, and degraded otherwise.
+type Report struct {
+	Status       string                `json:"status"`
+	Dependencies map[string]Dependency `json:"dependencies"`
+}
+
+// Checker probes a set of named dependencies. Required dependencies are those
+// without which the Lightnode cannot serve requests, and are the only ones
+// which readiness depends on. Optional dependencies, such as the RPCs of
+// chains, are only reported.
+type Checker struct {
+	timeout  time.Duration
+	probes   map[string]Probe
+	optional map[string]bool
+}
+
+// New returns a Checker without any dependencies. Probes which take longer
+// than the timeout fail.
+func New(timeout time.Duration) Checker {
+	return Checker{
+		timeout:  timeout,
+		probes:   map[string]Probe{},
+		optional: map[string]bool{},
+	}
+}
+
+// WithProbe adds a required dependency to the Checker.
+func (checker Checker) WithProbe(name string, probe Probe) Checker {
+	return checker.withProbe(name, probe, false)
+}
+
+// WithOptionalProbe adds an optional dependency to the Checker.
+func (checker Checker) WithOptionalProbe(name string, probe Probe) Checker {
+	return checker.withProbe(name, probe, true)
+}
+
+func (checker Checker) withProbe(name string, probe Probe, optional bool) Checker {
+	probes := make(map[string]Probe, len(checker.probes)+1)
+	for n, p := range checker.probes {
+		probes[n] = p
+	}
+	probes[name] = probe
+	checker.probes = probes
+
+	optionals := make(map[string]bool, len(checker.optional)+1)
+	for n, o := range checker.optional {
+		optionals[n] = o
+	}
+	optionals[name] = optional
+	checker.optional = optionals
+	return checker
+}
+
+// Check probes every dependency concurrently.
+func (checker Checker) Check(ctx context.Context) Report {
+	return checker.check(ctx, true)
+}
+
+// check probes the required dependencies, and the optional ones if asked to,
+// concurrently.
+func (checker Checker) check(ctx context.Context, optional bool) Report {
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+
+	report := Report{
+		Status:       StatusOK,
+		Dependencies: make(map[string]Dependency, len(checker.probes)),
+	}
+	mu := new(sync.Mutex)
+	var wg sync.WaitGroup
+	for name, probe := range checker.probes {
+		if checker.optional[name] && !optional {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, probe Probe) {
+			defer wg.Done()
+			dependency := run(ctx, probe)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[name] = dependency
+			if dependency.Status != StatusOK {
+				report.Status = StatusDegraded
+			}
+		}(name, probe)
+	}
+	wg.Wait()
+	return report
+}
+
+// run the probe, failing it if it does not return before the context is done.
+func run(ctx context.Context, probe Probe) Dependency {
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() { errs <- probe(ctx) }()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out")
+	}
+	dependency := Dependency{
+		Status:    StatusOK,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		dependency.Status = StatusFailed
+		dependency.Error = err.Error()
+	}
+	return dependency
+}
+
+// HealthHandler returns an `http.Handler` for liveness checks. It reports the
+// status of every dependency, but always responds with 200 OK, as failing
+// dependencies are not fixed by restarting the Lightnode.
+func (checker Checker) HealthHandler() http.Handler {
+	return checker.handler(false)
+}
+
+// ReadyHandler returns an `http.Handler` for readiness checks. It reports the
+// status of the required dependencies, and responds with 503 Service
+// Unavailable unless every one of them is ok.
+func (checker Checker) ReadyHandler() http.Handler {
+	return checker.handler(true)
+}
+
+func (checker Checker) handler(ready bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report := checker.check(r.Context(), !ready)
+		w.Header().Set("Content-Type", "application/json")
+		if ready && report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Any returns a Probe which succeeds if any of the probes succeeds. The probes
+// are run concurrently, and the Probe returns as soon as one of them succeeds.
+func Any(probes ...Probe) Probe {
+	return func(ctx context.Context) error {
+		if len(probes) == 0 {
+			return errors.New("nothing to probe")
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errs := make(chan error, len(probes))
+		for _, probe := range probes {
+			go func(probe Probe) { errs <- probe(ctx) }(probe)
+		}
+		failed := 0
+		for range probes {
+			if err := <-errs; err == nil {
+				return nil
+			}
+			failed++
+		}
+		return fmt.Errorf("%v of %v failed", failed, len(probes))
+	}
+}
+
+// HTTPProbe returns a Probe which checks that the server at the URL responds.
+// Any response without a server error succeeds, as RPCs often reject requests
+// which are not authenticated or not for a known method. Errors do not include
+// the URL, as it can contain credentials.
+func HTTPProbe(client *http.Client, rawURL string) Probe {
+	return func(ctx context.Context) error {
+		r, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		if err != nil {
+			return errors.New("invalid url")
+		}
+		response, err := client.Do(r.WithContext(ctx))
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return err
+		}
+		defer response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("responded with %v", response.Status)
+		}
+		return nil
+	}
+}
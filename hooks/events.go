@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/renproject/lightnode/logging"
+)
+
+// EventsHandler serves the events endpoint of the admin API, which replays
+// the events sent to a hook target after a sequence number. Consumers which
+// notice a gap in the sequence numbers, or which were down, request the events
+// since the last sequence number they processed.
+type EventsHandler struct {
+	logger logging.Logger
+	events EventLog
+}
+
+// NewEventsHandler returns an EventsHandler which replays events from the
+// event log.
+func NewEventsHandler(logger logging.Logger, events EventLog) EventsHandler {
+	return EventsHandler{logger: logger, events: events}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	target := query.Get("target")
+	if target == "" {
+		http.Error(w, "missing target", http.StatusBadRequest)
+		return
+	}
+	var since uint64
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := MaxReplayEvents
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if parsed < limit {
+			limit = parsed
+		}
+	}
+
+	records, err := handler.events.HookEvents(target, since, limit)
+	if err != nil {
+		handler.logger.Errorf("[hooks] cannot load events for %v: %v", target, err)
+		http.Error(w, fmt.Sprintf("cannot load events: %v", err), http.StatusInternalServerError)
+		return
+	}
+	events := make([]Event, 0, len(records))
+	for _, record := range records {
+		var event Event
+		if err := json.Unmarshal(record.Data, &event); err != nil {
+			handler.logger.Errorf("[hooks] cannot decode event %v for %v: %v", record.Sequence, target, err)
+			http.Error(w, "cannot decode events", http.StatusInternalServerError)
+			return
+		}
+		event.ID, event.Sequence = record.ID, record.Sequence
+		events = append(events, event)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
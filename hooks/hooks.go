@@ -0,0 +1,386 @@
+// Package hooks runs operator-configured scripts and webhooks when the
+// Lightnode detects a condition which may need remediation, such as losing
+// contact with the Darknodes, or an event which integrators should be told
+// about, such as a change of RenVM epoch. Each hook receives the condition as JSON, so
+// that operators can automate their runbooks without external monitoring.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/logging"
+)
+
+// Conditions which trigger hooks.
+const (
+	// ConditionQuorumLoss is detected when fewer than two thirds of the
+	// bootstrap Darknodes respond to the updater.
+	ConditionQuorumLoss = "quorum_loss"
+	// ConditionChainDown is detected when the RPC of a chain has been failing
+	// for longer than the delay of the condition.
+	ConditionChainDown = "chain_down"
+	// ConditionDBDown is detected when the database cannot be reached.
+	ConditionDBDown = "db_down"
+	// ConditionEpochChange is detected when RenVM moves to a new epoch or
+	// rotates its shards. Gateways generated before the change should be
+	// refreshed, and pending mints may take longer while funds are moved.
+	ConditionEpochChange = "epoch_change"
+)
+
+const (
+	// DefaultTimeout is how long a hook can run before it is stopped.
+	DefaultTimeout = 30 * time.Second
+
+	// EventRetention is how long events are kept in the event log, and so
+	// how far back consumers can replay the events they missed.
+	EventRetention = 30 * 24 * time.Hour
+
+	// EventPruneInterval is how often events older than EventRetention are
+	// deleted from the event log.
+	EventPruneInterval = time.Hour
+
+	// MaxReplayEvents limits the number of events returned by a single
+	// replay request.
+	MaxReplayEvents = 1000
+)
+
+// A Hook runs a local script or calls a webhook when its condition is
+// detected. Targets with an http or https scheme are webhooks, which are sent
+// the event in a POST request. Other targets are paths of scripts, which are
+// run without arguments and read the event from their standard input.
+type Hook struct {
+	Condition string
+	Target    string
+}
+
+// IsWebhook returns whether the hook calls a webhook rather than running a
+// script.
+func (hook Hook) IsWebhook() bool {
+	u, err := url.Parse(hook.Target)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Validate returns an error if the condition of the hook is unknown or it has
+// no target.
+func (hook Hook) Validate() error {
+	switch hook.Condition {
+	case ConditionQuorumLoss, ConditionChainDown, ConditionDBDown, ConditionEpochChange:
+	default:
+		return fmt.Errorf("unknown condition %q", hook.Condition)
+	}
+	if hook.Target == "" {
+		return fmt.Errorf("empty target for %v", hook.Condition)
+	}
+	return nil
+}
+
+// An Event describes a detected condition. The subject identifies what the
+// condition applies to, such as the name of a chain. The ID is the same for
+// every hook the event is sent to, whereas the sequence number is one more than
+// that of the previous event sent to the same target, so consumers can tell
+// when they have missed events. Events are only numbered if the Runner has an
+// event log.
+type Event struct {
+	ID        string `json:"id"`
+	Sequence  uint64 `json:"sequence,omitempty"`
+	Condition string `json:"condition"`
+	Subject   string `json:"subject"`
+	Error     string `json:"error,omitempty"`
+	Since     int64  `json:"since"`
+	Time      int64  `json:"time"`
+}
+
+// An EventLog persists the events sent to each hook target, so that consumers
+// can replay the events they missed.
+type EventLog interface {
+	InsertHookEvent(target, id string, data []byte) (uint64, error)
+	HookEvents(target string, since uint64, limit int) ([]db.HookEvent, error)
+	PruneHookEvents(expiry time.Duration) (int64, error)
+}
+
+// failure is a condition which is currently failing.
+type failure struct {
+	since     time.Time
+	triggered bool
+}
+
+// A Runner keeps track of failing conditions and runs their hooks. Hooks are
+// run once when a condition has been failing for longer than its delay, and
+// again only after the condition has recovered and failed again. A nil Runner
+// ignores all conditions, so components do not need to check whether hooks are
+// configured.
+type Runner struct {
+	logger  logging.Logger
+	hooks   map[string][]Hook
+	delays  map[string]time.Duration
+	timeout time.Duration
+	client  *http.Client
+	events  EventLog
+
+	mu       sync.Mutex
+	failures map[string]*failure
+
+	// eventsMu is held while events are recorded, so that events are
+	// numbered in the order they are sent.
+	eventsMu sync.Mutex
+}
+
+// New returns a Runner for the given hooks.
+func New(logger logging.Logger, hooks []Hook) *Runner {
+	byCondition := map[string][]Hook{}
+	for _, hook := range hooks {
+		byCondition[hook.Condition] = append(byCondition[hook.Condition], hook)
+	}
+	return &Runner{
+		logger:   logger,
+		hooks:    byCondition,
+		delays:   map[string]time.Duration{},
+		timeout:  DefaultTimeout,
+		client:   &http.Client{Timeout: DefaultTimeout},
+		failures: map[string]*failure{},
+	}
+}
+
+// WithDelay sets how long the condition must be failing before its hooks are
+// run. Conditions are triggered as soon as they are detected by default.
+func (runner *Runner) WithDelay(condition string, delay time.Duration) *Runner {
+	runner.delays[condition] = delay
+	return runner
+}
+
+// WithTransport sends the hooks with the given transport, such as through the
+// outbound proxies.
+func (runner *Runner) WithTransport(transport http.RoundTripper) *Runner {
+	runner.client = &http.Client{Timeout: runner.client.Timeout, Transport: transport}
+	return runner
+}
+
+// WithEventLog numbers the events sent to each target and records them in the
+// event log, so that they can be replayed by the events endpoint.
+func (runner *Runner) WithEventLog(events EventLog) *Runner {
+	runner.events = events
+	return runner
+}
+
+// Fail records that the condition is failing for the subject, and runs the
+// hooks of the condition if it has been failing for long enough.
+func (runner *Runner) Fail(condition, subject string, err error) {
+	if runner == nil || len(runner.hooks[condition]) == 0 {
+		return
+	}
+
+	now := time.Now()
+	key := condition + "/" + subject
+	runner.mu.Lock()
+	f, ok := runner.failures[key]
+	if !ok {
+		f = &failure{since: now}
+		runner.failures[key] = f
+	}
+	if f.triggered || now.Sub(f.since) < runner.delays[condition] {
+		runner.mu.Unlock()
+		return
+	}
+	f.triggered = true
+	runner.mu.Unlock()
+
+	event := Event{
+		Condition: condition,
+		Subject:   subject,
+		Since:     f.since.Unix(),
+		Time:      now.Unix(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	go runner.dispatch(event)
+}
+
+// Notify runs the hooks of the condition immediately. It is used for events,
+// such as epoch changes, which are not failures and so never recover.
+func (runner *Runner) Notify(condition, subject string) {
+	if runner == nil || len(runner.hooks[condition]) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	event := Event{
+		Condition: condition,
+		Subject:   subject,
+		Since:     now,
+		Time:      now,
+	}
+	go runner.dispatch(event)
+}
+
+// Recover records that the condition is no longer failing for the subject.
+func (runner *Runner) Recover(condition, subject string) {
+	if runner == nil {
+		return
+	}
+	runner.mu.Lock()
+	delete(runner.failures, condition+"/"+subject)
+	runner.mu.Unlock()
+}
+
+// Poll runs the check with the given interval until the context is done, and
+// records whether the condition is failing for the subject based on its
+// result.
+func (runner *Runner) Poll(ctx context.Context, condition, subject string, interval time.Duration, check func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			runner.Fail(condition, subject, err)
+		} else {
+			runner.Recover(condition, subject)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch records the event for each hook of its condition, and runs the
+// hooks. Events which cannot be recorded, such as while the database is down,
+// are still sent, but without a sequence number.
+func (runner *Runner) dispatch(event Event) {
+	eventID := make([]byte, 16)
+	if _, err := rand.Read(eventID); err != nil {
+		runner.logger.Errorf("[hooks] cannot generate id for %v event: %v", event.Condition, err)
+		return
+	}
+	event.ID = base64.RawURLEncoding.EncodeToString(eventID)
+
+	for _, hook := range runner.hooks[event.Condition] {
+		hookEvent := event
+		if runner.events != nil {
+			sequence, err := runner.record(hook.Target, event)
+			if err != nil {
+				runner.logger.Errorf("[hooks] cannot record %v event for %v: %v", event.Condition, hook.Target, err)
+			}
+			hookEvent.Sequence = sequence
+		}
+		go runner.run(hook, hookEvent)
+	}
+}
+
+// record adds the event to the event log of the target, and returns its
+// sequence number.
+func (runner *Runner) record(target string, event Event) (uint64, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	runner.eventsMu.Lock()
+	defer runner.eventsMu.Unlock()
+	return runner.events.InsertHookEvent(target, event.ID, data)
+}
+
+// PruneEvents deletes the events which are older than EventRetention from the
+// event log with the given interval, until the context is done.
+func (runner *Runner) PruneEvents(ctx context.Context, interval time.Duration) {
+	if runner == nil || runner.events == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if pruned, err := runner.events.PruneHookEvents(EventRetention); err != nil {
+			runner.logger.Warnf("[hooks] cannot prune events: %v", err)
+		} else if pruned > 0 {
+			runner.logger.Infof("[hooks] pruned %v events", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs the hook for the event and logs the result.
+func (runner *Runner) run(hook Hook, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		runner.logger.Errorf("[hooks] cannot marshal %v event: %v", event.Condition, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runner.timeout)
+	defer cancel()
+	if hook.IsWebhook() {
+		err = runner.post(ctx, hook.Target, data)
+	} else {
+		err = runner.exec(ctx, hook.Target, event, data)
+	}
+	if err != nil {
+		runner.logger.Errorf("[hooks] %v hook %v failed for %v: %v", event.Condition, hook.Target, event.Subject, err)
+		return
+	}
+	runner.logger.Infof("[hooks] ran %v hook %v for %v", event.Condition, hook.Target, event.Subject)
+}
+
+// post sends the event to a webhook. Any status other than 2xx is an error.
+func (runner *Runner) post(ctx context.Context, target string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := runner.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// exec runs a script with the event on its standard input. The fields of the
+// event are also set in its environment for scripts which do not parse JSON.
+func (runner *Runner) exec(ctx context.Context, target string, event Event, data []byte) error {
+	cmd := exec.CommandContext(ctx, target)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"LIGHTNODE_HOOK_ID="+event.ID,
+		fmt.Sprintf("LIGHTNODE_HOOK_SEQUENCE=%v", event.Sequence),
+		"LIGHTNODE_HOOK_CONDITION="+event.Condition,
+		"LIGHTNODE_HOOK_SUBJECT="+event.Subject,
+		"LIGHTNODE_HOOK_ERROR="+event.Error,
+		fmt.Sprintf("LIGHTNODE_HOOK_SINCE=%v", event.Since),
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/renproject/lightnode/db"
+	. "github.com/renproject/lightnode/hooks"
+	"github.com/renproject/lightnode/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// memoryEventLog keeps the events of each target in memory, and counts how
+// often it is pruned.
+type memoryEventLog struct {
+	mu     *sync.Mutex
+	events map[string][]db.HookEvent
+	prunes *int64
+}
+
+func newMemoryEventLog() memoryEventLog {
+	return memoryEventLog{mu: new(sync.Mutex), events: map[string][]db.HookEvent{}, prunes: new(int64)}
+}
+
+func (log memoryEventLog) InsertHookEvent(target, id string, data []byte) (uint64, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	sequence := uint64(len(log.events[target]) + 1)
+	log.events[target] = append(log.events[target], db.HookEvent{Sequence: sequence, ID: id, Data: data})
+	return sequence, nil
+}
+
+func (log memoryEventLog) HookEvents(target string, since uint64, limit int) ([]db.HookEvent, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	events := []db.HookEvent{}
+	for _, event := range log.events[target] {
+		if event.Sequence > since && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (log memoryEventLog) PruneHookEvents(expiry time.Duration) (int64, error) {
+	atomic.AddInt64(log.prunes, 1)
+	return 0, nil
+}
+
+var _ = Describe("Hooks", func() {
+	logger := logging.FromLogrus(logrus.New())
+
+	webhook := func() (*httptest.Server, chan Event) {
+		events := make(chan Event, 8)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var event Event
+			Expect(json.NewDecoder(r.Body).Decode(&event)).To(Succeed())
+			events <- event
+		}))
+		return server, events
+	}
+
+	It("should call webhooks once until the condition recovers", func() {
+		server, events := webhook()
+		defer server.Close()
+
+		runner := New(logger, []Hook{{Condition: ConditionDBDown, Target: server.URL}})
+		runner.Fail(ConditionDBDown, "database", fmt.Errorf("connection refused"))
+
+		var event Event
+		Eventually(events).Should(Receive(&event))
+		Expect(event.Condition).To(Equal(ConditionDBDown))
+		Expect(event.Subject).To(Equal("database"))
+		Expect(event.Error).To(Equal("connection refused"))
+
+		runner.Fail(ConditionDBDown, "database", fmt.Errorf("connection refused"))
+		Consistently(events).ShouldNot(Receive())
+
+		runner.Recover(ConditionDBDown, "database")
+		runner.Fail(ConditionDBDown, "database", fmt.Errorf("connection refused"))
+		Eventually(events).Should(Receive())
+	})
+
+	It("should wait for the delay of the condition", func() {
+		server, events := webhook()
+		defer server.Close()
+
+		runner := New(logger, []Hook{{Condition: ConditionChainDown, Target: server.URL}}).
+			WithDelay(ConditionChainDown, 100*time.Millisecond)
+		runner.Fail(ConditionChainDown, "Ethereum", fmt.Errorf("timeout"))
+		Consistently(events, 50*time.Millisecond).ShouldNot(Receive())
+
+		time.Sleep(100 * time.Millisecond)
+		runner.Fail(ConditionChainDown, "Ethereum", fmt.Errorf("timeout"))
+		var event Event
+		Eventually(events).Should(Receive(&event))
+		Expect(event.Subject).To(Equal("Ethereum"))
+		Expect(event.Time - event.Since).To(BeNumerically(">=", 0))
+
+		// Other subjects are tracked separately.
+		runner.Fail(ConditionChainDown, "Solana", fmt.Errorf("timeout"))
+		Consistently(events, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should run scripts with the event on their input", func() {
+		dir, err := ioutil.TempDir("", "hooks")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		output := filepath.Join(dir, "output")
+		script := filepath.Join(dir, "hook.sh")
+		Expect(ioutil.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\necho $LIGHTNODE_HOOK_SUBJECT > %v\ncat >> %v\n", output, output)), 0700)).To(Succeed())
+
+		runner := New(logger, []Hook{{Condition: ConditionQuorumLoss, Target: script}})
+		runner.Fail(ConditionQuorumLoss, "darknodes", nil)
+
+		Eventually(func() string {
+			data, _ := ioutil.ReadFile(output)
+			return string(data)
+		}).Should(And(HavePrefix("darknodes\n"), ContainSubstring(`"condition":"quorum_loss"`)))
+	})
+
+	It("should call webhooks for every notified event", func() {
+		server, events := webhook()
+		defer server.Close()
+
+		runner := New(logger, []Hook{{Condition: ConditionEpochChange, Target: server.URL}})
+		runner.Notify(ConditionEpochChange, "1")
+		runner.Notify(ConditionEpochChange, "2")
+
+		var first, second Event
+		Eventually(events).Should(Receive(&first))
+		Eventually(events).Should(Receive(&second))
+		Expect([]string{first.Subject, second.Subject}).To(ConsistOf("1", "2"))
+		Expect(first.Condition).To(Equal(ConditionEpochChange))
+	})
+
+	It("should number events and replay them from the event log", func() {
+		server, events := webhook()
+		defer server.Close()
+
+		eventLog := newMemoryEventLog()
+		runner := New(logger, []Hook{{Condition: ConditionEpochChange, Target: server.URL}}).
+			WithEventLog(eventLog)
+		runner.Notify(ConditionEpochChange, "1")
+		runner.Notify(ConditionEpochChange, "2")
+
+		var first, second Event
+		Eventually(events).Should(Receive(&first))
+		Eventually(events).Should(Receive(&second))
+		Expect([]uint64{first.Sequence, second.Sequence}).To(ConsistOf(uint64(1), uint64(2)))
+		Expect(first.ID).NotTo(BeEmpty())
+		Expect(first.ID).NotTo(Equal(second.ID))
+
+		handler := NewEventsHandler(logger, eventLog)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hooks/events?since=1&target="+server.URL, nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var replayed []Event
+		Expect(json.NewDecoder(w.Body).Decode(&replayed)).To(Succeed())
+		Expect(replayed).To(HaveLen(1))
+		Expect(replayed[0].Sequence).To(Equal(uint64(2)))
+		Expect(replayed[0]).To(Or(Equal(first), Equal(second)))
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hooks/events?since=x&target="+server.URL, nil))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should prune the event log on a timer rather than for every event", func() {
+		server, events := webhook()
+		defer server.Close()
+
+		eventLog := newMemoryEventLog()
+		runner := New(logger, []Hook{{Condition: ConditionEpochChange, Target: server.URL}}).
+			WithEventLog(eventLog)
+		runner.Notify(ConditionEpochChange, "1")
+		Eventually(events).Should(Receive())
+		Expect(atomic.LoadInt64(eventLog.prunes)).To(BeZero())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go runner.PruneEvents(ctx, 10*time.Millisecond)
+		Eventually(func() int64 { return atomic.LoadInt64(eventLog.prunes) }).Should(BeNumerically(">", 1))
+	})
+
+	It("should ignore conditions without hooks", func() {
+		var runner *Runner
+		runner.Fail(ConditionDBDown, "database", fmt.Errorf("connection refused"))
+		runner.Recover(ConditionDBDown, "database")
+		runner.Notify(ConditionEpochChange, "1")
+
+		runner = New(logger, nil)
+		runner.Fail(ConditionDBDown, "database", fmt.Errorf("connection refused"))
+	})
+
+	It("should validate hooks", func() {
+		Expect(Hook{Condition: ConditionDBDown, Target: "/opt/restart-db.sh"}.Validate()).To(Succeed())
+		Expect(Hook{Condition: "unknown", Target: "/opt/restart-db.sh"}.Validate()).NotTo(Succeed())
+		Expect(Hook{Condition: ConditionDBDown}.Validate()).NotTo(Succeed())
+		Expect(Hook{Target: "https://example.com/hook"}.IsWebhook()).To(BeTrue())
+		Expect(Hook{Target: "/opt/restart-db.sh"}.IsWebhook()).To(BeFalse())
+	})
+})
@@ -0,0 +1,157 @@
+package lightnode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/lightnode/config"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// A HostChain is an EVM compatible chain which RenVM mints assets on. Host
+// chains can be added with WithHostChains, without any other changes to the
+// Lightnode, as long as the chain is known to multichain.
+type HostChain struct {
+	Chain multichain.Chain `json:"chain"`
+	// RPC is the url of a node for the chain. Environment variables in the url
+	// are expanded when the host chains are loaded, so that api keys can be
+	// kept out of the config file.
+	RPC string `json:"rpc"`
+	// Registry is the address of the RenVM gateway registry on the chain.
+	Registry string `json:"registry"`
+	// ChainID is the EIP-155 chain ID reported by the RPC.
+	ChainID uint64 `json:"chainId"`
+	// Confirmations is used if RenVM does not report the confirmations for
+	// the chain.
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	// FinalityTag is the block tag ("safe" or "finalized") used instead of
+	// confirmations, if the chain supports one.
+	FinalityTag string `json:"finalityTag,omitempty"`
+	// ConfidenceInterval, BlockTime and MaxLogRange configure the watchers
+	// of the chain, and default to the global watcher options.
+	ConfidenceInterval uint64 `json:"confidenceInterval,omitempty"`
+	BlockTime          string `json:"blockTime,omitempty"`
+	MaxLogRange        uint64 `json:"maxLogRange,omitempty"`
+}
+
+// LoadHostChains reads the host chains from a JSON file containing a list of
+// host chains, and validates them.
+func LoadHostChains(path string) ([]HostChain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hostChains []HostChain
+	if err := json.Unmarshal(data, &hostChains); err != nil {
+		return nil, fmt.Errorf("decoding %v: %v", path, err)
+	}
+	seen := map[multichain.Chain]bool{}
+	for i := range hostChains {
+		hostChains[i].RPC = os.ExpandEnv(hostChains[i].RPC)
+		if err := hostChains[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[hostChains[i].Chain] {
+			return nil, fmt.Errorf("duplicate host chain %v", hostChains[i].Chain)
+		}
+		seen[hostChains[i].Chain] = true
+	}
+	return hostChains, nil
+}
+
+// Validate checks that the host chain is complete and that it can be used by
+// the watchers, validator and bindings.
+func (hostChain HostChain) Validate() error {
+	if hostChain.Chain == "" {
+		return fmt.Errorf("missing chain")
+	}
+	switch hostChain.Chain {
+	case multichain.Filecoin, multichain.Solana, multichain.Terra:
+		return fmt.Errorf("%v is not an evm chain", hostChain.Chain)
+	}
+	if !hostChain.Chain.IsAccountBased() {
+		return fmt.Errorf("%v is not an account based chain known to multichain", hostChain.Chain)
+	}
+	rpcURL, err := url.Parse(hostChain.RPC)
+	if err != nil {
+		return fmt.Errorf("%v rpc: %v", hostChain.Chain, err)
+	}
+	switch rpcURL.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return fmt.Errorf("%v rpc: unsupported scheme %q", hostChain.Chain, rpcURL.Scheme)
+	}
+	if !common.IsHexAddress(hostChain.Registry) || common.HexToAddress(hostChain.Registry) == (common.Address{}) {
+		return fmt.Errorf("%v registry: invalid address %q", hostChain.Chain, hostChain.Registry)
+	}
+	if hostChain.ChainID == 0 {
+		return fmt.Errorf("%v: missing chain id", hostChain.Chain)
+	}
+	switch hostChain.FinalityTag {
+	case "", "safe", "finalized":
+	default:
+		return fmt.Errorf("%v: unsupported finality tag %q", hostChain.Chain, hostChain.FinalityTag)
+	}
+	if hostChain.BlockTime != "" {
+		if _, err := config.ParseDuration(hostChain.BlockTime); err != nil {
+			return fmt.Errorf("%v block time: %v", hostChain.Chain, err)
+		}
+	}
+	return nil
+}
+
+// ChainOptions returns the options for the bindings of the host chain.
+func (hostChain HostChain) ChainOptions() binding.ChainOptions {
+	return binding.ChainOptions{
+		RPC:           pack.String(hostChain.RPC),
+		Protocol:      pack.String(hostChain.Registry),
+		Confirmations: pack.U64(hostChain.Confirmations),
+	}
+}
+
+// WatcherConfig returns the configuration of the watchers of the host chain.
+// A block time which is missing or invalid is left zero.
+func (hostChain HostChain) WatcherConfig() watcher.ChainConfig {
+	blockTime, _ := config.ParseDuration(hostChain.BlockTime)
+	return watcher.ChainConfig{
+		Registry:           hostChain.Registry,
+		ConfidenceInterval: hostChain.ConfidenceInterval,
+		BlockTime:          blockTime,
+		MaxLogRange:        hostChain.MaxLogRange,
+	}
+}
+
+// A HostChainClient is the subset of an Ethereum client used to check that a
+// host chain is configured correctly.
+type HostChainClient interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// Check that the RPC of the host chain is for the expected chain, and that the
+// gateway registry has been deployed to it.
+func (hostChain HostChain) Check(ctx context.Context, client HostChainClient) error {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("getting chain id: %v", err)
+	}
+	if !chainID.IsUint64() || chainID.Uint64() != hostChain.ChainID {
+		return fmt.Errorf("rpc is for chain id %v, expected %v", chainID, hostChain.ChainID)
+	}
+	code, err := client.CodeAt(ctx, common.HexToAddress(hostChain.Registry), nil)
+	if err != nil {
+		return fmt.Errorf("getting registry code: %v", err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract at registry %v", hostChain.Registry)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package lightnode_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/renproject/multichain"
+)
+
+type mockHostChainClient struct {
+	chainID *big.Int
+	code    map[common.Address][]byte
+}
+
+func (client mockHostChainClient) ChainID(ctx context.Context) (*big.Int, error) {
+	if client.chainID == nil {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return client.chainID, nil
+}
+
+func (client mockHostChainClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return client.code[account], nil
+}
+
+// newHostChainServer returns a JSON-RPC server for a host chain with the given
+// chain ID, and the given code deployed at each address.
+func newHostChainServer(chainID uint64, code map[common.Address][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		switch req.Method {
+		case "eth_chainId":
+			result = hexutil.Uint64(chainID)
+		case "eth_getCode":
+			var account common.Address
+			if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &account) != nil {
+				http.Error(w, "unexpected request", http.StatusBadRequest)
+				return
+			}
+			result = hexutil.Bytes(code[account])
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+// dialHostChain returns a client for the RPC at the url.
+func dialHostChain(url string) *ethclient.Client {
+	client, err := ethclient.Dial(url)
+	Expect(err).NotTo(HaveOccurred())
+	return client
+}
+
+// Every host chain config in testdata/hostchains must pass these tests, so a
+// new chain can be added by adding its config there.
+var _ = Describe("Host chains", func() {
+	configs, err := filepath.Glob("testdata/hostchains/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, config := range configs {
+		config := config
+
+		Context(fmt.Sprintf("when loading %v", filepath.Base(config)), func() {
+			It("should be valid", func() {
+				hostChains, err := LoadHostChains(config)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hostChains).NotTo(BeEmpty())
+			})
+
+			It("should pass the checks against a conforming rpc", func() {
+				hostChains, err := LoadHostChains(config)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, hostChain := range hostChains {
+					server := newHostChainServer(hostChain.ChainID, map[common.Address][]byte{
+						common.HexToAddress(hostChain.Registry): {0x60, 0x80},
+					})
+					client := dialHostChain(server.URL)
+					Expect(hostChain.Check(context.Background(), client)).To(Succeed())
+					client.Close()
+					server.Close()
+				}
+			})
+		})
+	}
+
+	Context("when validating host chains", func() {
+		valid := HostChain{
+			Chain:    multichain.Goerli,
+			RPC:      "https://goerli.example.com",
+			Registry: "0x5076a1F237531fa4dC8ad99bb68024aB6e1Ff701",
+			ChainID:  5,
+		}
+
+		It("should reject incomplete or unsupported chains", func() {
+			Expect(valid.Validate()).To(Succeed())
+
+			for _, modify := range []func(*HostChain){
+				func(hostChain *HostChain) { hostChain.Chain = "" },
+				func(hostChain *HostChain) { hostChain.Chain = multichain.Bitcoin },
+				func(hostChain *HostChain) { hostChain.Chain = multichain.Solana },
+				func(hostChain *HostChain) { hostChain.RPC = "goerli.example.com" },
+				func(hostChain *HostChain) { hostChain.Registry = "0x1234" },
+				func(hostChain *HostChain) { hostChain.Registry = common.Address{}.Hex() },
+				func(hostChain *HostChain) { hostChain.ChainID = 0 },
+				func(hostChain *HostChain) { hostChain.FinalityTag = "latest" },
+				func(hostChain *HostChain) { hostChain.BlockTime = "-12s" },
+			} {
+				hostChain := valid
+				modify(&hostChain)
+				Expect(hostChain.Validate()).NotTo(Succeed())
+			}
+		})
+
+		It("should expand environment variables in the rpc", func() {
+			Expect(os.Setenv("HOST_CHAIN_TEST_KEY", "secret")).To(Succeed())
+			defer os.Unsetenv("HOST_CHAIN_TEST_KEY")
+
+			file, err := os.CreateTemp("", "hostchains")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(file.Name())
+			_, err = file.WriteString(`[{"chain":"Goerli","rpc":"https://goerli.example.com/${HOST_CHAIN_TEST_KEY}","registry":"0x5076a1F237531fa4dC8ad99bb68024aB6e1Ff701","chainId":5}]`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+
+			hostChains, err := LoadHostChains(file.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hostChains[0].RPC).To(Equal("https://goerli.example.com/secret"))
+		})
+
+		It("should fail the checks against an rpc for another chain", func() {
+			registry := common.HexToAddress(valid.Registry)
+
+			// The rpc is for mainnet.
+			server := newHostChainServer(1, map[common.Address][]byte{registry: {0x60, 0x80}})
+			defer server.Close()
+			client := dialHostChain(server.URL)
+			defer client.Close()
+			Expect(valid.Check(context.Background(), client)).To(MatchError(ContainSubstring("chain id 1")))
+		})
+
+		It("should fail the checks against an rpc without the registry", func() {
+			server := newHostChainServer(valid.ChainID, nil)
+			defer server.Close()
+			client := dialHostChain(server.URL)
+			defer client.Close()
+			Expect(valid.Check(context.Background(), client)).To(MatchError(ContainSubstring("no contract")))
+		})
+
+		It("should fail the checks against an unreachable rpc", func() {
+			server := newHostChainServer(valid.ChainID, nil)
+			client := dialHostChain(server.URL)
+			defer client.Close()
+			server.Close()
+			Expect(valid.Check(context.Background(), client)).To(MatchError(ContainSubstring("getting chain id")))
+		})
+	})
+})
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// NewAdminAuthHandler returns a handler which only passes requests to the
+// admin API on to the next handler if they are authenticated, either by a
+// client certificate which was verified by an admin TLS listener, or by the
+// token given as a bearer token in the Authorization header. An empty token
+// only accepts client certificates.
+func NewAdminAuthHandler(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsAdmin(token, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="lightnode-admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// IsAdmin returns whether the request is authenticated as an admin, in the
+// same way as NewAdminAuthHandler.
+func IsAdmin(token string, r *http.Request) bool {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	bearer := strings.TrimPrefix(auth, "Bearer ")
+	return token != "" && bearer != auth && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// LoadCertPool loads the PEM encoded certificates in the file, such as the CA
+// which signs the client certificates of operators.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %v", file)
+	}
+	return pool, nil
+}
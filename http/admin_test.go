@@ -0,0 +1,51 @@
+package http_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+)
+
+var _ = Describe("Admin auth handler", func() {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	It("should only accept requests with the token", func() {
+		handler := NewAdminAuthHandler("secret", ok)
+
+		for token, code := range map[string]int{
+			"":              http.StatusUnauthorized,
+			"Bearer wrong":  http.StatusUnauthorized,
+			"secret":        http.StatusUnauthorized,
+			"Bearer secret": http.StatusOK,
+		} {
+			r := httptest.NewRequest(http.MethodGet, "/limiter", nil)
+			if token != "" {
+				r.Header.Set("Authorization", token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			Expect(w.Code).To(Equal(code), token)
+		}
+	})
+
+	It("should accept requests with verified client certificates", func() {
+		handler := NewAdminAuthHandler("", ok)
+
+		r := httptest.NewRequest(http.MethodGet, "/limiter", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+})
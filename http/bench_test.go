@@ -0,0 +1,42 @@
+package http_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
+)
+
+func BenchmarkDecodeQueryTxResult(b *testing.B) {
+	expected := jsonrpc.ResponseQueryTx{Tx: txutil.RandomGoodTx(rand.New(rand.NewSource(1))), TxStatus: tx.StatusDone}
+	raw, err := json.Marshal(expected)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		b.Fatal(err)
+	}
+
+	results := map[string]interface{}{
+		"typed":   expected,
+		"raw":     json.RawMessage(raw),
+		"generic": generic,
+	}
+	for _, name := range []string{"typed", "raw", "generic"} {
+		result := results[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := DecodeQueryTxResult(result); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
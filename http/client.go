@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/jsonrpc"
 )
 
@@ -25,6 +28,20 @@ var DefaultRetryOptions = RetryOptions{
 	Factor: 0.2,
 }
 
+// DarknodeURL returns the URL of the JSON-RPC server of the Darknode, which
+// listens on the port after the one in its address.
+func DarknodeURL(addr wire.Address) (string, error) {
+	addrParts := strings.Split(addr.Value, ":")
+	if len(addrParts) != 2 {
+		return "", fmt.Errorf("invalid address value=%v", addr.Value)
+	}
+	port, err := strconv.Atoi(addrParts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid port=%v", addrParts[1])
+	}
+	return fmt.Sprintf("http://%s:%v", addrParts[0], port+1), nil
+}
+
 // DefaultClientTimeout is the recommended timeout for the client.
 var DefaultClientTimeout = 5 * time.Second
 
@@ -42,6 +59,18 @@ func NewClient(timeout time.Duration) Client {
 	}
 }
 
+// WithTransport returns a client with the same timeout which sends requests
+// with the given transport, such as one returned by `Proxies.Transport`. A nil
+// transport uses the default transport.
+func (c Client) WithTransport(transport http.RoundTripper) Client {
+	return Client{
+		Client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: transport,
+		},
+	}
+}
+
 // SendRequest sends the `jsonrpc.Request` to the given URL. It only retries
 // sending the request if the retry options are non-nil. Otherwise it returns
 // the response and error immediately.
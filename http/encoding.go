@@ -0,0 +1,121 @@
+package http
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/pack"
+)
+
+// EncodingParam is the query parameter which selects the encoding of the byte
+// fields of txs in JSON-RPC responses, e.g. `/?encoding=hex`.
+const EncodingParam = "encoding"
+
+// Encodings of byte fields in responses. Byte fields are encoded as base64 by
+// default, which is what the Darknodes return. Hex encoded fields do not have
+// a "0x" prefix.
+const (
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+)
+
+// ValidateEncoding returns an error if the encoding is not supported. An empty
+// encoding selects the default.
+func ValidateEncoding(encoding string) error {
+	switch encoding {
+	case "", EncodingBase64, EncodingHex:
+		return nil
+	default:
+		return fmt.Errorf("unsupported encoding %q, expected %v or %v", encoding, EncodingBase64, EncodingHex)
+	}
+}
+
+// EncodeTx returns the tx in a form which marshals its byte fields using the
+// given encoding. Txs marshal their byte fields as base64 by default, so they
+// are only wrapped when another encoding is selected.
+func EncodeTx(transaction tx.Tx, encoding string) interface{} {
+	if encoding != EncodingHex {
+		return transaction
+	}
+	return HexTx(transaction)
+}
+
+// HexTx is a tx which marshals its hash, and the bytes values of its inputs
+// and outputs, as hex rather than base64.
+type HexTx tx.Tx
+
+// MarshalJSON implements the json.Marshaler interface for the HexTx type.
+func (transaction HexTx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Hash     string      `json:"hash"`
+		Version  tx.Version  `json:"version"`
+		Selector tx.Selector `json:"selector"`
+		Input    hexTyped    `json:"in"`
+		Output   hexTyped    `json:"out"`
+	}{
+		Hash:     hex.EncodeToString(transaction.Hash[:]),
+		Version:  transaction.Version,
+		Selector: transaction.Selector,
+		Input:    hexTyped(transaction.Input),
+		Output:   hexTyped(transaction.Output),
+	})
+}
+
+// hexTyped marshals a typed value like pack.Typed, with its bytes values
+// encoded as hex.
+type hexTyped pack.Typed
+
+func (typed hexTyped) MarshalJSON() ([]byte, error) {
+	t, err := json.Marshal(pack.Typed(typed).Type())
+	if err != nil {
+		return nil, err
+	}
+	v, err := marshalHex(pack.Struct(typed))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		T json.RawMessage `json:"t"`
+		V json.RawMessage `json:"v"`
+	}{t, v})
+}
+
+// marshalHex marshals the value like the pack package does, except that bytes
+// values are encoded as hex. The fields of structs are sorted by name, as
+// they are by the pack package, so that equal values encode identically.
+func marshalHex(value pack.Value) ([]byte, error) {
+	switch value := value.(type) {
+	case pack.Bytes:
+		return json.Marshal(hex.EncodeToString(value))
+	case pack.Bytes32:
+		return json.Marshal(hex.EncodeToString(value[:]))
+	case pack.Bytes65:
+		return json.Marshal(hex.EncodeToString(value[:]))
+	case pack.Typed:
+		return hexTyped(value).MarshalJSON()
+	case pack.Struct:
+		fields := make(map[string]json.RawMessage, len(value))
+		for _, field := range value {
+			data, err := marshalHex(field.Value)
+			if err != nil {
+				return nil, err
+			}
+			fields[field.Name] = data
+		}
+		return json.Marshal(fields)
+	case pack.List:
+		elems := make([]json.RawMessage, len(value.Elems))
+		for i, elem := range value.Elems {
+			data, err := marshalHex(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = data
+		}
+		return json.Marshal(elems)
+	default:
+		return json.Marshal(value)
+	}
+}
@@ -0,0 +1,64 @@
+package http_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/renproject/darknode/tx"
+)
+
+var _ = Describe("Response encoding", func() {
+	v1Tx := `{"hash":"hOyESX5qOdO2atRZt1T18YLP7vtctSpRpP-yTEVHaO0","version":"1","selector":"LUNA/toEthereum","in":{"t":{"struct":[{"txid":"bytes"},{"amount":"u256"},{"to":"string"}]},"v":{"amount":"2000000","to":"0xa0df350d2637096571F7A701CBc1C5fdE30dF76A","txid":"aT2vuwEIqE6ACHVx4RxcT__hbQ0r_eHv_r3uxl92yz0"}}}`
+
+	decodeTx := func() tx.Tx {
+		var transaction tx.Tx
+		Expect(json.Unmarshal([]byte(v1Tx), &transaction)).To(Succeed())
+		return transaction
+	}
+
+	It("should not change txs by default", func() {
+		transaction := decodeTx()
+		for _, encoding := range []string{"", EncodingBase64} {
+			Expect(EncodeTx(transaction, encoding)).To(Equal(transaction))
+		}
+	})
+
+	It("should encode equal txs identically", func() {
+		for _, encoding := range []string{EncodingBase64, EncodingHex} {
+			first, err := json.Marshal(EncodeTx(decodeTx(), encoding))
+			Expect(err).NotTo(HaveOccurred())
+			second, err := json.Marshal(EncodeTx(decodeTx(), encoding))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).To(Equal(first))
+		}
+	})
+
+	It("should sort the fields of structs by name", func() {
+		data, err := json.Marshal(EncodeTx(decodeTx(), EncodingHex))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"v":{"amount":"2000000","to":"0xa0df350d2637096571F7A701CBc1C5fdE30dF76A","txid":"693dafbb0108a84e80087571e11c5c4fffe16d0d2bfde1effebdeec65f76cb3d"}`))
+	})
+
+	It("should encode the byte fields of txs as hex", func() {
+		data, err := json.Marshal(EncodeTx(decodeTx(), EncodingHex))
+		Expect(err).NotTo(HaveOccurred())
+
+		var encoded map[string]interface{}
+		Expect(json.Unmarshal(data, &encoded)).To(Succeed())
+		Expect(encoded["hash"]).To(Equal("84ec84497e6a39d3b66ad459b754f5f182cfeefb5cb52a51a4ffb24c454768ed"))
+		Expect(encoded["selector"]).To(Equal("LUNA/toEthereum"))
+		in := encoded["in"].(map[string]interface{})
+		Expect(in["t"]).To(HaveKey("struct"))
+		v := in["v"].(map[string]interface{})
+		Expect(v["txid"]).To(Equal("693dafbb0108a84e80087571e11c5c4fffe16d0d2bfde1effebdeec65f76cb3d"))
+		Expect(v["amount"]).To(Equal("2000000"))
+		Expect(v["to"]).To(Equal("0xa0df350d2637096571F7A701CBc1C5fdE30dF76A"))
+	})
+
+	It("should reject unknown encodings", func() {
+		Expect(ValidateEncoding("base58")).NotTo(Succeed())
+	})
+})
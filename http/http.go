@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"net/url"
 
 	"github.com/renproject/darknode/jsonrpc"
@@ -29,3 +30,42 @@ func NewRequestWithResponder(ctx context.Context, id interface{}, method string,
 	responder := make(chan jsonrpc.Response, 1)
 	return RequestWithResponder{ctx, id, method, params, responder, query}
 }
+
+type internalKey struct{}
+
+// WithInternal marks the context of a request which is made by the Lightnode
+// itself, such as the submission of a burn found by a watcher, rather than by
+// a client.
+func WithInternal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalKey{}, true)
+}
+
+// IsInternal returns whether the context is of a request made by the
+// Lightnode itself.
+func IsInternal(ctx context.Context) bool {
+	internal, _ := ctx.Value(internalKey{}).(bool)
+	return internal
+}
+
+// DecodeQueryTxResult returns the result of a queryTx response as a
+// `jsonrpc.ResponseQueryTx`. Results which are already typed, such as those
+// rewritten by the cacher, are returned as they are, and raw results are
+// decoded directly, so that only results of unknown types are encoded and
+// decoded again.
+func DecodeQueryTxResult(result interface{}) (jsonrpc.ResponseQueryTx, error) {
+	var resp jsonrpc.ResponseQueryTx
+	switch result := result.(type) {
+	case jsonrpc.ResponseQueryTx:
+		return result, nil
+	case json.RawMessage:
+		err := json.Unmarshal(result, &resp)
+		return resp, err
+	default:
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return resp, err
+		}
+		err = json.Unmarshal(raw, &resp)
+		return resp, err
+	}
+}
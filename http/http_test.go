@@ -1 +1,39 @@
 package http_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
+)
+
+var _ = Describe("QueryTx results", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	It("should decode typed, raw and generic results to the same response", func() {
+		expected := jsonrpc.ResponseQueryTx{Tx: txutil.RandomGoodTx(r), TxStatus: tx.StatusDone}
+		raw, err := json.Marshal(expected)
+		Expect(err).NotTo(HaveOccurred())
+		var generic map[string]interface{}
+		Expect(json.Unmarshal(raw, &generic)).To(Succeed())
+
+		for _, result := range []interface{}{expected, json.RawMessage(raw), generic} {
+			resp, err := DecodeQueryTxResult(result)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Tx.Hash).To(Equal(expected.Tx.Hash))
+			Expect(resp.TxStatus).To(Equal(expected.TxStatus))
+		}
+	})
+
+	It("should return an error for results which are not txs", func() {
+		_, err := DecodeQueryTxResult(json.RawMessage(`"not a tx"`))
+		Expect(err).To(HaveOccurred())
+	})
+})
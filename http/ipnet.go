@@ -0,0 +1,67 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseIPNets parses a list of IPs and CIDR ranges. IPs are treated as ranges
+// which only contain that IP.
+func ParseIPNets(entries []string) ([]*net.IPNet, error) {
+	ipNets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			ipNets = append(ipNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr range %q", entry)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+// ContainsIP returns whether any of the ranges contain the IP.
+func ContainsIP(ipNets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client which sent the request. The right-most
+// entry of the x-forwarded-for header is only used if the request comes from
+// one of the trusted proxies, as it can otherwise be set by the client.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if !ContainsIP(trustedProxies, ip) {
+		return ip
+	}
+	forwarded := strings.Split(r.Header.Get("x-forwarded-for"), ",")
+	if forwardedIP := net.ParseIP(strings.TrimSpace(forwarded[len(forwarded)-1])); forwardedIP != nil {
+		return forwardedIP
+	}
+	return ip
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Listener describes an address on which the Lightnode serves requests.
+type Listener struct {
+	// Network is one of "tcp", "tcp4", "tcp6" or "unix". A "tcp" listener on
+	// an unspecified host accepts both IPv4 and IPv6 connections.
+	Network string
+	Address string
+	// TLS terminates TLS on the listener using the configured certificate.
+	TLS bool
+	// Admin listeners serve operational endpoints instead of the JSON-RPC
+	// API.
+	Admin bool
+}
+
+// ParseListener parses a listener of the form "[admin+]scheme://address",
+// where the scheme is a network or "tls" for TLS over TCP. For example,
+// "tcp://0.0.0.0:5000", "tls://:443", "unix:///var/run/lightnode.sock" or
+// "admin+tcp://127.0.0.1:5002".
+func ParseListener(str string) (Listener, error) {
+	listener := Listener{}
+	if strings.HasPrefix(str, "admin+") {
+		listener.Admin = true
+		str = strings.TrimPrefix(str, "admin+")
+	}
+	parts := strings.SplitN(str, "://", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Listener{}, fmt.Errorf("invalid listener %v", str)
+	}
+	switch parts[0] {
+	case "tcp", "tcp4", "tcp6", "unix":
+		listener.Network = parts[0]
+	case "tls":
+		listener.Network = "tcp"
+		listener.TLS = true
+	default:
+		return Listener{}, fmt.Errorf("unknown listener scheme %v", parts[0])
+	}
+	listener.Address = parts[1]
+	return listener, nil
+}
+
+// String returns the listener in the format accepted by ParseListener.
+func (listener Listener) String() string {
+	scheme := listener.Network
+	if listener.TLS {
+		scheme = "tls"
+	}
+	if listener.Admin {
+		scheme = "admin+" + scheme
+	}
+	return fmt.Sprintf("%v://%v", scheme, listener.Address)
+}
+
+// Local returns whether the listener can only be reached from this host: a
+// unix socket, or a TCP listener on a loopback address.
+func (listener Listener) Local() bool {
+	if listener.Network == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(listener.Address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Listen opens the listener. TLS listeners require a certificate reloader.
+// Admin TLS listeners verify the client certificates signed by the client CAs,
+// if they are not nil. Clients without a certificate are still accepted, so
+// that they can authenticate with a token instead.
+func Listen(listener Listener, certs *CertReloader, clientCAs *x509.CertPool) (net.Listener, error) {
+	if listener.Network == "unix" {
+		// Remove the socket left behind by a previous run, as otherwise the
+		// address is reported as in use.
+		if err := os.Remove(listener.Address); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("removing stale socket: %v", err)
+		}
+	}
+	ln, err := net.Listen(listener.Network, listener.Address)
+	if err != nil {
+		return nil, err
+	}
+	if !listener.TLS {
+		return ln, nil
+	}
+	if certs == nil {
+		ln.Close()
+		return nil, fmt.Errorf("no certificate for %v", listener)
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if listener.Admin && clientCAs != nil {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = clientCAs
+	}
+	return tls.NewListener(ln, config), nil
+}
+
+// CertReloader serves a TLS certificate from disk, reloading it whenever the
+// certificate or key file is modified so that renewed certificates are picked
+// up without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      *sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the key pair from the given files.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		mu:       new(sync.RWMutex),
+	}
+	if _, err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate implements the tls.Config callback.
+func (reloader *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+	return reloader.cert, nil
+}
+
+// Reload loads the key pair if either file has been modified since it was
+// last loaded, and returns whether it was reloaded. The current certificate
+// is kept if the new key pair is invalid.
+func (reloader *CertReloader) Reload() (bool, error) {
+	modTime, err := reloader.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	reloader.mu.RLock()
+	unchanged := reloader.cert != nil && modTime.Equal(reloader.modTime)
+	reloader.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading key pair: %v", err)
+	}
+
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	reloader.cert = &cert
+	reloader.modTime = modTime
+	return true, nil
+}
+
+// Run periodically reloads the certificate until the context is done.
+func (reloader *CertReloader) Run(ctx context.Context, logger logrus.FieldLogger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := reloader.Reload()
+		if err != nil {
+			logger.Errorf("[http] cannot reload certificate: %v", err)
+			continue
+		}
+		if reloaded {
+			logger.Infof("[http] reloaded certificate from %v", reloader.certFile)
+		}
+	}
+}
+
+func (reloader *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
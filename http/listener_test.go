@@ -0,0 +1,158 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+)
+
+// writeCert writes a self-signed key pair for the given common name.
+func writeCert(certFile, keyFile, name string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).To(Succeed())
+	Expect(os.Chtimes(certFile, modTime, modTime)).To(Succeed())
+	Expect(os.Chtimes(keyFile, modTime, modTime)).To(Succeed())
+}
+
+var _ = Describe("Listeners", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "listener")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should parse listeners", func() {
+		for str, expected := range map[string]Listener{
+			"tcp://0.0.0.0:5000":           {Network: "tcp", Address: "0.0.0.0:5000"},
+			"tcp6://[::1]:5000":            {Network: "tcp6", Address: "[::1]:5000"},
+			"tls://:443":                   {Network: "tcp", Address: ":443", TLS: true},
+			"unix:///tmp/lightnode.sock":   {Network: "unix", Address: "/tmp/lightnode.sock"},
+			"admin+tcp://127.0.0.1:5002":   {Network: "tcp", Address: "127.0.0.1:5002", Admin: true},
+			"admin+unix:///tmp/admin.sock": {Network: "unix", Address: "/tmp/admin.sock", Admin: true},
+		} {
+			listener, err := ParseListener(str)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listener).To(Equal(expected))
+			Expect(listener.String()).To(Equal(str))
+		}
+
+		for _, str := range []string{"", "0.0.0.0:5000", "udp://:5000", "tcp://"} {
+			_, err := ParseListener(str)
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("should tell which listeners can only be reached locally", func() {
+		for str, expected := range map[string]bool{
+			"admin+tcp://127.0.0.1:5002":   true,
+			"admin+tcp://localhost:5002":   true,
+			"admin+tcp6://[::1]:5002":      true,
+			"admin+unix:///tmp/admin.sock": true,
+			"admin+tcp://0.0.0.0:5002":     false,
+			"admin+tcp://:5002":            false,
+			"admin+tls://10.0.0.1:5002":    false,
+		} {
+			listener, err := ParseListener(str)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listener.Local()).To(Equal(expected), str)
+		}
+	})
+
+	It("should serve over a unix socket which was not cleaned up", func() {
+		socket := filepath.Join(dir, "lightnode.sock")
+		Expect(ioutil.WriteFile(socket, nil, 0600)).To(Succeed())
+
+		ln, err := Listen(Listener{Network: "unix", Address: socket}, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})}
+		go server.Serve(ln)
+		defer server.Close()
+
+		client := http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		}}
+		resp, err := client.Get("http://lightnode/")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("ok"))
+	})
+
+	It("should require a certificate for tls listeners", func() {
+		_, err := Listen(Listener{Network: "tcp", Address: "127.0.0.1:0", TLS: true}, nil, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reload certificates when they change on disk", func() {
+		certFile := filepath.Join(dir, "cert.pem")
+		keyFile := filepath.Join(dir, "key.pem")
+		writeCert(certFile, keyFile, "first", time.Now().Add(-time.Minute))
+
+		certs, err := NewCertReloader(certFile, keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		commonName := func() string {
+			cert, err := certs.GetCertificate(&tls.ClientHelloInfo{})
+			Expect(err).NotTo(HaveOccurred())
+			parsed, err := x509.ParseCertificate(cert.Certificate[0])
+			Expect(err).NotTo(HaveOccurred())
+			return parsed.Subject.CommonName
+		}
+		Expect(commonName()).To(Equal("first"))
+
+		reloaded, err := certs.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+
+		writeCert(certFile, keyFile, "second", time.Now())
+		reloaded, err = certs.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(commonName()).To(Equal("second"))
+
+		// An invalid key pair does not replace the current certificate.
+		Expect(ioutil.WriteFile(keyFile, []byte("invalid"), 0600)).To(Succeed())
+		_, err = certs.Reload()
+		Expect(err).To(HaveOccurred())
+		Expect(commonName()).To(Equal("second"))
+	})
+})
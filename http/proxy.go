@@ -0,0 +1,194 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirectProxy is the proxy override for hosts which are reached without a
+// proxy, even if one is set in the environment.
+const DirectProxy = "direct"
+
+// proxyDialTimeout is how long the proxy handler waits when checking whether a
+// proxy is reachable.
+const proxyDialTimeout = 2 * time.Second
+
+// Proxies selects the proxy for outbound requests. Proxies are read from the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables, and can be
+// overridden for individual hosts. A host override such as "example.com"
+// only matches that host, whereas a domain override such as ".example.com"
+// matches all of its subdomains.
+type Proxies struct {
+	overrides map[string]*url.URL
+}
+
+// NewProxies returns the proxies with the given overrides, which map hosts to
+// proxy URLs or to DirectProxy.
+func NewProxies(overrides map[string]string) (*Proxies, error) {
+	proxies := &Proxies{overrides: map[string]*url.URL{}}
+	for host, proxy := range overrides {
+		if host == "" {
+			return nil, fmt.Errorf("empty host for proxy %v", proxy)
+		}
+		if proxy == DirectProxy {
+			proxies.overrides[strings.ToLower(host)] = nil
+			continue
+		}
+		proxyURL, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy for %v: %v", host, err)
+		}
+		proxies.overrides[strings.ToLower(host)] = proxyURL
+	}
+	return proxies, nil
+}
+
+// ParseProxy parses a proxy URL, which must have a scheme and a host.
+func ParseProxy(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	return proxyURL, nil
+}
+
+// Proxy returns the proxy for the request, or nil if it should not use one. It
+// can be used as the `Proxy` of an `http.Transport`.
+func (proxies *Proxies) Proxy(r *http.Request) (*url.URL, error) {
+	host := strings.ToLower(r.URL.Hostname())
+	if proxyURL, ok := proxies.overrides[host]; ok {
+		return proxyURL, nil
+	}
+	// Check the most specific domain first.
+	for i := strings.Index(host, "."); i >= 0; i = strings.Index(host, ".") {
+		if proxyURL, ok := proxies.overrides[host[i:]]; ok {
+			return proxyURL, nil
+		}
+		host = host[i+1:]
+	}
+	return http.ProxyFromEnvironment(r)
+}
+
+// Transport returns a transport which sends requests through the proxies. It
+// is cloned from the default transport, so that it keeps its timeouts and
+// connection limits without changing the transport of other clients.
+func (proxies *Proxies) Transport() *http.Transport {
+	var transport *http.Transport
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = defaultTransport.Clone()
+	} else {
+		transport = new(http.Transport)
+	}
+	transport.Proxy = proxies.Proxy
+	return transport
+}
+
+// ProxyStatus is whether a proxy is reachable.
+type ProxyStatus struct {
+	Proxy     string   `json:"proxy"`
+	Hosts     []string `json:"hosts"`
+	Reachable bool     `json:"reachable"`
+	Latency   string   `json:"latency,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Status checks whether each of the proxies, including those set in the
+// environment, accepts connections. Credentials are redacted from the result.
+func (proxies *Proxies) Status() []ProxyStatus {
+	hosts := map[string][]string{}
+	byProxy := map[string]*url.URL{}
+	add := func(proxyURL *url.URL, host string) {
+		key := proxyURL.String()
+		hosts[key] = append(hosts[key], host)
+		byProxy[key] = proxyURL
+	}
+	for _, name := range []string{"HTTPS_PROXY", "HTTP_PROXY"} {
+		value := os.Getenv(name)
+		if value == "" {
+			value = os.Getenv(strings.ToLower(name))
+		}
+		if value == "" {
+			continue
+		}
+		proxyURL, err := ParseProxy(value)
+		if err != nil {
+			continue
+		}
+		add(proxyURL, "*")
+	}
+	for host, proxyURL := range proxies.overrides {
+		if proxyURL != nil {
+			add(proxyURL, host)
+		}
+	}
+
+	statuses := make([]ProxyStatus, 0, len(byProxy))
+	for key, proxyURL := range byProxy {
+		sort.Strings(hosts[key])
+		status := ProxyStatus{Proxy: proxyURL.Redacted(), Hosts: hosts[key]}
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", proxyAddr(proxyURL), proxyDialTimeout)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			conn.Close()
+			status.Reachable = true
+			status.Latency = time.Since(start).String()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Proxy < statuses[j].Proxy })
+	return statuses
+}
+
+// ServeHTTP implements the `http.Handler` interface. It reports the status of
+// the proxies, and responds with a service unavailable status if any of them
+// cannot be reached.
+func (proxies *Proxies) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := proxies.Status()
+	w.Header().Set("Content-Type", "application/json")
+	for _, status := range statuses {
+		if !status.Reachable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// proxyAddr returns the address of the proxy, including the default port of
+// its scheme if it does not have one.
+func proxyAddr(proxyURL *url.URL) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+	port := "80"
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
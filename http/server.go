@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ServerOptions configure the HTTP servers which the Lightnode serves requests
+// on. Zero timeouts are disabled.
+type ServerOptions struct {
+	// HTTP2 serves HTTP/2 over cleartext (h2c) alongside HTTP/1.1, so that
+	// clients can send many requests over a single connection.
+	HTTP2 bool
+	// MaxConcurrentStreams is the number of requests a client can have in
+	// flight on each HTTP/2 connection.
+	MaxConcurrentStreams uint32
+	// ReadHeaderTimeout is the time allowed to read the headers of a request.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout and WriteTimeout limit the time to read a request and to
+	// write its response. They also apply to WebSocket connections, which
+	// are closed when they expire, so they are disabled by default.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// IdleTimeout is how long keep-alive connections are kept open between
+	// requests.
+	IdleTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests are given to finish when
+	// the server shuts down, after which their connections are closed.
+	ShutdownTimeout time.Duration
+}
+
+// DefaultServerOptions are the recommended server settings.
+var DefaultServerOptions = ServerOptions{
+	HTTP2:                true,
+	MaxConcurrentStreams: 250,
+	ReadHeaderTimeout:    10 * time.Second,
+	IdleTimeout:          2 * time.Minute,
+	ShutdownTimeout:      15 * time.Second,
+}
+
+// Server is an http.Server which drains in-flight requests when it is
+// stopped.
+type Server struct {
+	*http.Server
+	shutdownTimeout time.Duration
+}
+
+// NewServer returns a Server for the handler with the given options.
+func NewServer(handler http.Handler, options ServerOptions) (Server, error) {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+	}
+	if options.HTTP2 {
+		// Configuring the server lets it shut down the HTTP/2 connections
+		// which are taken over by the h2c handler.
+		h2 := &http2.Server{
+			MaxConcurrentStreams: options.MaxConcurrentStreams,
+			IdleTimeout:          options.IdleTimeout,
+		}
+		if err := http2.ConfigureServer(server, h2); err != nil {
+			return Server{}, err
+		}
+		server.Handler = h2c.NewHandler(handler, h2)
+	}
+	return Server{Server: server, shutdownTimeout: options.ShutdownTimeout}, nil
+}
+
+// Serve serves requests on the listener until the context is done. It then
+// stops accepting connections and waits for in-flight requests to finish,
+// for at most the shutdown timeout, before returning. An error is returned if
+// the server fails, or if connections had to be closed with requests still in
+// flight.
+func (server Server) Serve(ctx context.Context, ln net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Server.Serve(ln)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), server.shutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		server.Close()
+	}
+	<-errs
+	return err
+}
@@ -0,0 +1,79 @@
+package http_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"golang.org/x/net/http2"
+)
+
+var _ = Describe("Server", func() {
+	It("should serve HTTP/2 requests without TLS", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		server, err := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}), DefaultServerOptions)
+		Expect(err).NotTo(HaveOccurred())
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go server.Serve(ctx, ln)
+
+		client := http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		resp, err := client.Get("http://" + ln.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("HTTP/2.0"))
+	})
+
+	It("should let in-flight requests finish when it is stopped", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started := make(chan struct{})
+		server, err := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("done"))
+		}), DefaultServerOptions)
+		Expect(err).NotTo(HaveOccurred())
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- server.Serve(ctx, ln)
+		}()
+
+		responses := make(chan string, 1)
+		go func() {
+			defer GinkgoRecover()
+			resp, err := http.Get("http://" + ln.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			responses <- string(body)
+		}()
+		Eventually(started).Should(BeClosed())
+		cancel()
+
+		Eventually(responses).Should(Receive(Equal("done")))
+		Eventually(stopped).Should(Receive(BeNil()))
+	})
+})
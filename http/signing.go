@@ -0,0 +1,134 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/renproject/id"
+)
+
+// Response headers which attest that a response was served by a Lightnode.
+const (
+	// SignatureHeader is the signature of the response digest, encoded as
+	// unpadded URL-safe base64.
+	SignatureHeader = "X-Lightnode-Signature"
+	// SignatoryHeader is the signatory of the key which signed the response.
+	SignatoryHeader = "X-Lightnode-Signatory"
+	// SignedAtHeader is the unix timestamp, in seconds, at which the response
+	// was signed.
+	SignedAtHeader = "X-Lightnode-Signed-At"
+)
+
+// NewSigningHandler returns a handler which signs every response of the next
+// handler with the key, so that services which cache responses can verify
+// that they were served by a trusted Lightnode. The signature covers the time
+// of signing and the body of the request as well as the body of the response,
+// so that a captured response cannot be replayed for another request, or
+// after it has gone stale. Responses are buffered in order to be signed,
+// including responses which the next handler would otherwise stream.
+func NewSigningHandler(key *id.PrivKey, next http.Handler) http.Handler {
+	signatory := key.Signatory().String()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request is hashed as the next handler reads it, and the rest of
+		// it once the next handler is done.
+		requestHash := sha256.New()
+		request := io.TeeReader(r.Body, requestHash)
+		r.Body = readCloser{request, r.Body}
+		buffered := &bufferedWriter{ResponseWriter: w}
+		next.ServeHTTP(buffered, r)
+		if _, err := io.Copy(ioutil.Discard, request); err != nil {
+			http.Error(w, fmt.Sprintf("cannot read request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+
+		body := buffered.body.Bytes()
+		signedAt := time.Now().Unix()
+		hash := responseDigest(signedAt, requestHash.Sum(nil), body)
+		signature, err := key.Sign(&hash)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot sign response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(SignatureHeader, base64.RawURLEncoding.EncodeToString(signature[:]))
+		w.Header().Set(SignatoryHeader, signatory)
+		w.Header().Set(SignedAtHeader, strconv.FormatInt(signedAt, 10))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
+
+// VerifyResponse returns the signatory which signed the response to the
+// request, and the time at which it was signed, given the body of the request,
+// the body of the response and the headers of the response. The signatory
+// must be compared against the SignatoryHeader, or better, against the
+// signatory of a trusted Lightnode, and responses which were signed too long
+// ago should be rejected.
+func VerifyResponse(request, body []byte, header http.Header) (id.Signatory, time.Time, error) {
+	signedAt, err := strconv.ParseInt(header.Get(SignedAtHeader), 10, 64)
+	if err != nil {
+		return id.Signatory{}, time.Time{}, fmt.Errorf("invalid signing time: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(header.Get(SignatureHeader))
+	if err != nil {
+		return id.Signatory{}, time.Time{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	requestHash := sha256.Sum256(request)
+	hash := responseDigest(signedAt, requestHash[:], body)
+	pubKey, err := crypto.SigToPub(hash[:], sig)
+	if err != nil {
+		return id.Signatory{}, time.Time{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	return id.NewSignatory((*id.PubKey)(pubKey)), time.Unix(signedAt, 0), nil
+}
+
+// responseDigest returns the hash which is signed for a response: the SHA256
+// hash of the signing time as a big-endian uint64, the SHA256 hash of the
+// request body, and the SHA256 hash of the response body.
+func responseDigest(signedAt int64, requestHash, body []byte) id.Hash {
+	bodyHash := sha256.Sum256(body)
+	data := make([]byte, 8, 8+len(requestHash)+len(bodyHash))
+	binary.BigEndian.PutUint64(data, uint64(signedAt))
+	data = append(data, requestHash...)
+	data = append(data, bodyHash[:]...)
+	return id.NewHash(data)
+}
+
+// readCloser reads from the reader, and closes the closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bufferedWriter holds the status and body of a response until they are
+// written by the SigningHandler.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader implements the `http.ResponseWriter` interface. As for other
+// writers, only the first status is kept.
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write implements the `http.ResponseWriter` interface.
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
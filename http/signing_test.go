@@ -0,0 +1,70 @@
+package http_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/renproject/id"
+)
+
+var _ = Describe("Signing handler", func() {
+	It("should sign response bodies", func() {
+		key := id.NewPrivKey()
+		handler := NewSigningHandler(key, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only part of the request is read.
+			r.Body.Read(make([]byte, 4))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"id":1,`))
+			w.Write([]byte(`"jsonrpc":"2.0","result":{}}`))
+		}))
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		request := []byte(`{"jsonrpc":"2.0","id":1,"method":"ren_queryBlockState","params":{}}`)
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(string(request)))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(string(body)).To(Equal(`{"id":1,"jsonrpc":"2.0","result":{}}`))
+		Expect(resp.Header.Get(SignatoryHeader)).To(Equal(key.Signatory().String()))
+
+		signatory, signedAt, err := VerifyResponse(request, body, resp.Header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signatory).To(Equal(key.Signatory()))
+		Expect(signedAt).To(BeTemporally("~", time.Now(), 5*time.Second))
+
+		// Tampered responses, responses replayed for other requests, and
+		// responses with another signing time are signed by someone else.
+		signatory, _, err = VerifyResponse(request, []byte(`{"id":2}`), resp.Header)
+		if err == nil {
+			Expect(signatory).NotTo(Equal(key.Signatory()))
+		}
+		signatory, _, err = VerifyResponse([]byte(`{"jsonrpc":"2.0","id":2}`), body, resp.Header)
+		if err == nil {
+			Expect(signatory).NotTo(Equal(key.Signatory()))
+		}
+		restamped := resp.Header.Clone()
+		restamped.Set(SignedAtHeader, strconv.FormatInt(signedAt.Unix()+60, 10))
+		signatory, _, err = VerifyResponse(request, body, restamped)
+		if err == nil {
+			Expect(signatory).NotTo(Equal(key.Signatory()))
+		}
+
+		invalid := resp.Header.Clone()
+		invalid.Set(SignatureHeader, "not a signature")
+		_, _, err = VerifyResponse(request, body, invalid)
+		Expect(err).To(HaveOccurred())
+	})
+})
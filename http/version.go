@@ -0,0 +1,53 @@
+package http
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/renproject/lightnode/version"
+)
+
+// VersionHeader is the response header which contains the Lightnode version.
+const VersionHeader = "X-Lightnode-Version"
+
+// NewVersionHandler returns a handler which serves the build information at
+// `/version` and passes all other requests to the JSON-RPC handler. Every
+// response includes the VersionHeader. Responses of the JSON-RPC handler are
+// passed through as they are, as it already encodes them canonically.
+// Requests with an unsupported EncodingParam are rejected before they reach
+// the JSON-RPC handler, which encodes the byte fields of its responses as
+// requested.
+//
+// The x-forwarded-for header is only kept for requests from the trusted
+// proxies. It is replaced by the IP of the peer for all other requests, so
+// that clients cannot pick the IP they are rate limited by.
+func NewVersionHandler(next http.Handler, trustedProxies []*net.IPNet) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version.Get())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := ValidateEncoding(r.URL.Query().Get(EncodingParam)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The JSON-RPC server rate limits based on the right-most entry in
+		// the x-forwarded-for header.
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if r.Header.Get("x-forwarded-for") == "" || !ContainsIP(trustedProxies, net.ParseIP(host)) {
+			r.Header.Set("x-forwarded-for", host)
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, version.Version)
+		mux.ServeHTTP(w, r)
+	})
+}
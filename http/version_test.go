@@ -0,0 +1,88 @@
+package http_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/renproject/lightnode/version"
+)
+
+var _ = Describe("Version handler", func() {
+	init := func(trustedProxies ...string) (*httptest.Server, <-chan *http.Request) {
+		requests := make(chan *http.Request, 1)
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+			w.Write([]byte("ok"))
+		})
+		ipNets, err := ParseIPNets(trustedProxies)
+		Expect(err).NotTo(HaveOccurred())
+		return httptest.NewServer(NewVersionHandler(next, ipNets)), requests
+	}
+
+	It("should serve the build information", func() {
+		server, _ := init()
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/version")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get(VersionHeader)).To(Equal(version.Version))
+
+		var info version.Info
+		Expect(json.NewDecoder(resp.Body).Decode(&info)).To(Succeed())
+		Expect(info).To(Equal(version.Get()))
+	})
+
+	It("should pass other requests on with the version header and client ip", func() {
+		server, requests := init("127.0.0.1")
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("x-forwarded-for", "1.1.1.1, 2.2.2.2")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get(VersionHeader)).To(Equal(version.Version))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("ok"))
+
+		var forwarded *http.Request
+		Eventually(requests).Should(Receive(&forwarded))
+		Expect(forwarded.Header.Get("x-forwarded-for")).To(Equal("1.1.1.1, 2.2.2.2"))
+	})
+
+	It("should replace the forwarded ip of requests from untrusted peers", func() {
+		server, requests := init("10.0.0.0/8")
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("x-forwarded-for", "1.1.1.1")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		var forwarded *http.Request
+		Eventually(requests).Should(Receive(&forwarded))
+		Expect(forwarded.Header.Get("x-forwarded-for")).To(Equal("127.0.0.1"))
+	})
+
+	It("should reject requests for unknown encodings", func() {
+		server, _ := init()
+		defer server.Close()
+
+		resp, err := http.Post(server.URL+"?encoding=base58", "application/json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
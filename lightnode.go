@@ -2,22 +2,43 @@ package lightnode
 
 import (
 	"context"
+	"crypto/x509"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/go-redis/redis/v7"
+	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/jsonrpc"
-	"github.com/renproject/kv"
 	"github.com/renproject/lightnode/cacher"
+	"github.com/renproject/lightnode/clock"
 	v0 "github.com/renproject/lightnode/compat/v0"
 	v1 "github.com/renproject/lightnode/compat/v1"
 	"github.com/renproject/lightnode/confirmer"
 	"github.com/renproject/lightnode/db"
 	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/finality"
+	"github.com/renproject/lightnode/grpcapi"
+	"github.com/renproject/lightnode/health"
+	"github.com/renproject/lightnode/hooks"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/metrics"
+	"github.com/renproject/lightnode/pause"
+	"github.com/renproject/lightnode/pool"
 	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/slowlog"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/updater"
+	"github.com/renproject/lightnode/upgrade"
+	"github.com/renproject/lightnode/version"
 	"github.com/renproject/lightnode/watcher"
 	"github.com/renproject/multichain"
 	"github.com/renproject/phi"
@@ -31,13 +52,40 @@ import (
 // Lightnode is the top level container that encapsulates the functionality of
 // the lightnode.
 type Lightnode struct {
-	options   Options
-	logger    logrus.FieldLogger
-	db        db.DB
-	server    *jsonrpc.Server
-	updater   updater.Updater
-	confirmer confirmer.Confirmer
-	watchers  map[multichain.Chain]map[multichain.Asset]watcher.Watcher
+	options      Options
+	logger       logrus.FieldLogger
+	db           db.DB
+	sqlDB        *sql.DB
+	hooks        *hooks.Runner
+	server       *jsonrpc.Server
+	validator    jsonrpc.Validator
+	rpcLogger    *resolver.LoggingResolver
+	grpc         *grpcapi.Server
+	resolver     *resolver.Resolver
+	updater      updater.Updater
+	confirmer    confirmer.Confirmer
+	watchers     *watcher.Registry
+	versionStore v0.Store
+	migration    *v0.MigratingMappings
+	recovery     *updater.Recovery
+	divergence   *dispatcher.Divergence
+	certs        *lhttp.CertReloader
+	adminCAs     *x509.CertPool
+	pauser       *pause.Pauser
+	pools        pool.Handler
+	clients      resolver.ClientsHandler
+	v0payloads   resolver.V0PayloadsHandler
+	blacklist    *store.Blacklist
+	peers        *store.PeerTable
+	replay       watcher.ReplayHandler
+	hookEvents   hooks.EventsHandler
+	proxies      *lhttp.Proxies
+	limiter      *resolver.LightnodeRateLimiter
+	subs         resolver.SubscriptionHandler
+	epochs       resolver.EpochWatcher
+	chainIDs     *ChainIDGuard
+	health       health.Checker
+	slowLog      *slowlog.Log
 
 	// Tasks
 	cacher     phi.Task
@@ -54,31 +102,73 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 	if options.DistPubKey == nil {
 		panic("distributed public key not specified")
 	}
-	if options.Port == "" {
+	if options.Port == "" && len(options.Listeners) == 0 {
 		panic("port not specified")
 	}
-	if len(options.BootstrapAddrs) == 0 {
+	if len(options.BootstrapAddrs) == 0 && !options.CompatOnly() {
 		panic("bootstrap addresses not specified")
 	}
+	if err := options.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid options: %v", err))
+	}
+
+	// Requests to the darknodes, chains and hooks are sent through the
+	// configured proxies. The chain clients created by the bindings use the
+	// default transport, which only uses the proxies set in the environment.
+	proxies, err := lhttp.NewProxies(options.ProxyOverrides)
+	if err != nil {
+		panic(fmt.Sprintf("invalid proxy overrides: %v", err))
+	}
+	transport := proxies.Transport()
+
+	// The resolver, watchers and updater use the logger from the options if
+	// one is given, and otherwise write to the logrus logger.
+	componentLogger := options.Logger
+	if componentLogger == nil {
+		componentLogger = logging.FromLogrus(logger)
+	}
+
+	// Conditions which need remediation are reported to the hooks configured
+	// by the operator.
+	hookRunner := hooks.New(componentLogger, options.Hooks).
+		WithTransport(transport).
+		WithDelay(hooks.ConditionChainDown, options.HookChainDownAfter)
 
-	// Define the options used for all Phi tasks.
-	opts := phi.Options{Cap: options.Cap}
+	// Record slow database queries and Darknode round trips for the slow log
+	// endpoint.
+	slowLog := slowlog.New(slowlog.DefaultSize)
+	slowLog.SetThreshold(slowlog.KindDB, options.SlowDBThreshold)
+	slowLog.SetThreshold(slowlog.KindDarknode, options.SlowDarknodeThreshold)
+	slowLog.SetSampling(options.SlowLogSampling)
 
 	// Initialise the database.
-	db := db.New(sqlDB, options.MaxGatewayCount)
+	db := db.New(sqlDB, options.MaxGatewayCount, options.DBBatchSize).WithSlowLog(slowLog)
 	if err := db.Init(); err != nil {
 		logger.Panicf("failed to initialise db: %v", err)
 	}
 
+	// Events sent to hooks are numbered and recorded, so that consumers can
+	// replay the events they missed.
+	hookRunner.WithEventLog(db)
+
+	// Refuse to run against data in Redis which was written by a newer,
+	// incompatible Lightnode during a rolling upgrade.
+	if err := upgrade.CheckRedis(client); err != nil {
+		logger.Panicf("incompatible redis data: %v", err)
+	}
+
 	// Define the options used for the server.
 	serverOptions := jsonrpc.DefaultOptions().
 		WithMaxBatchSize(options.MaxBatchSize).
 		WithMaxPageSize(options.MaxPageSize).
 		WithTimeout(options.ServerTimeout)
 
-	// Initialise the multi-address store.
-	table := kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses")
-	multiStore := store.New(table, options.BootstrapAddrs)
+	// Initialise the multi-address store. Blacklisted darknodes are not
+	// selected by the dispatcher or the updater. The updater scores the
+	// darknodes it queries, and evicts those which stop responding.
+	blacklist := store.NewBlacklist(logger, client)
+	peers := store.NewPeerTable()
+	multiStore := store.NewInMemory(options.BootstrapAddrs).WithBlacklist(blacklist).WithPeerTable(peers)
 
 	// Initialise the blockchain adapter.
 	loggerConfig := zap.NewProductionConfig()
@@ -91,122 +181,734 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 	if err != nil {
 		panic(fmt.Errorf("cannot init logger: %v", err))
 	}
-	bindingsOpts := binding.DefaultOptions().
-		WithLogger(bindingsLogger).
-		WithNetwork(options.Network)
-	for chain, chainOpts := range options.Chains {
-		bindingsOpts = bindingsOpts.WithChainOptions(chain, chainOpts)
+
+	// Chains which support finality tags wait for finalised blocks rather
+	// than a fixed number of confirmations.
+	finalityCheckers := map[multichain.Chain]finality.Checker{}
+	for chain, tag := range options.FinalityTags {
+		chainOpts, ok := options.Chains[chain]
+		if !ok {
+			logger.Panicf("finality tag for %v, which is not a configured chain", chain)
+		}
+		rpcClient, err := rpc.DialHTTPWithClient(chainOpts.RPC.String(), &http.Client{Transport: transport})
+		if err != nil {
+			logger.Panicf("cannot connect to %v rpc: %v", chain, err)
+		}
+		finalityCheckers[chain] = finality.NewEthChecker(rpcClient, tag)
 	}
-	bindings := binding.New(bindingsOpts)
 
-	// ==== BEGIN GROSS HACK
-	//
-	// TODO: For now we use a custom set of bindings for the transaction
-	// verifier (with confirmations set to zero) as we want the initial
-	// verification to succeed even if the transaction has not received any
-	// confirmations.
-	//
+	// newBindings returns the bindings for the chains, and the bindings used to
+	// verify txs. They are rebuilt when a host chain is added at runtime.
+	newBindings := func(chains map[multichain.Chain]binding.ChainOptions) (*binding.Binding, *binding.Binding) {
+		bindingsOpts := binding.DefaultOptions().
+			WithLogger(bindingsLogger).
+			WithNetwork(options.Network)
+		for chain, chainOpts := range chains {
+			if _, ok := finalityCheckers[chain]; ok {
+				chainOpts.Confirmations = 0
+			}
+			bindingsOpts = bindingsOpts.WithChainOptions(chain, chainOpts)
+		}
 
-	verifierBindingsOpts := binding.DefaultOptions().
-		WithLogger(bindingsLogger).
-		WithNetwork(options.Network)
-	for chain, chainOpts := range options.Chains {
-		chainOpts.Confirmations = 0
-		verifierBindingsOpts = verifierBindingsOpts.WithChainOptions(chain, chainOpts)
+		// ==== BEGIN GROSS HACK
+		//
+		// TODO: For now we use a custom set of bindings for the transaction
+		// verifier (with confirmations set to zero) as we want the initial
+		// verification to succeed even if the transaction has not received
+		// any confirmations.
+		//
+
+		verifierBindingsOpts := binding.DefaultOptions().
+			WithLogger(bindingsLogger).
+			WithNetwork(options.Network)
+		for chain, chainOpts := range chains {
+			chainOpts.Confirmations = 0
+			verifierBindingsOpts = verifierBindingsOpts.WithChainOptions(chain, chainOpts)
+		}
+
+		// ==== END GROSS HACK
+		//
+
+		return binding.New(bindingsOpts), binding.New(verifierBindingsOpts)
 	}
-	verifierBindings := binding.New(verifierBindingsOpts)
+	bindings, verifierBindings := newBindings(options.BindingChains())
 
-	// ==== END GROSS HACK
-	//
+	// Host chains added through configuration are checked against their RPC,
+	// as a misconfigured chain would otherwise only show up as failed txs.
+	for _, hostChain := range options.HostChains {
+		ethClient := bindings.EthereumClient(hostChain.Chain)
+		if ethClient == nil {
+			logger.Errorf("[lightnode] cannot connect to host chain %v rpc", hostChain.Chain)
+			continue
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, options.WarmupTimeout)
+		if err := hostChain.Check(checkCtx, ethClient); err != nil {
+			logger.Errorf("[lightnode] host chain %v is misconfigured: %v", hostChain.Chain, err)
+		}
+		cancel()
+	}
 
-	updater := updater.New(logger, multiStore, options.UpdaterPollRate, options.ClientTimeout)
-	dispatcher := dispatcher.New(logger, options.ClientTimeout, multiStore, opts)
-	ttlCache := kv.NewTTLCache(ctx, kv.NewMemDB(kv.JSONCodec), "cacher", options.TTL)
-	cacher := cacher.New(dispatcher, logger, ttlCache, opts, db)
+	// The RPCs of EVM chains are checked before the watchers are started, so
+	// that a misconfigured RPC never causes burns on the wrong network to be
+	// detected.
+	expectedChainIDs := map[multichain.Chain]uint64{}
+	for chain, chainID := range EVMChainIDs[options.Network] {
+		expectedChainIDs[chain] = chainID
+	}
+	for _, hostChain := range options.HostChains {
+		expectedChainIDs[hostChain.Chain] = hostChain.ChainID
+	}
+	chainIDClients := map[multichain.Chain]ChainIDClient{}
+	for chain := range expectedChainIDs {
+		if options.Chains[chain].RPC == "" {
+			continue
+		}
+		if ethClient := bindings.EthereumClient(chain); ethClient != nil {
+			chainIDClients[chain] = ethClient
+		}
+	}
+	chainIDs := NewChainIDGuard(logger, expectedChainIDs, chainIDClients)
+	checkCtx, cancel := context.WithTimeout(ctx, options.WarmupTimeout)
+	chainIDs.Check(checkCtx)
+	cancel()
+	// RPCs which could not be reached are not used until they are checked,
+	// but an RPC for the wrong chain is a misconfiguration.
+	for chain := range chainIDClients {
+		if err := chainIDs.Err(chain); err != nil && err != ErrChainIDUnchecked {
+			logger.Panicf("[lightnode] %v rpc is for the wrong chain: %v", chain, err)
+		}
+	}
+
+	peerUpdater := updater.New(componentLogger, multiStore, options.UpdaterPollRate, options.ClientTimeout).WithTransport(transport).WithHooks(hookRunner)
+	divergence := dispatcher.NewDivergence(logger)
+	dispatchPool := pool.New("dispatcher", options.DispatchConcurrency)
+	dispatcher := dispatcher.NewWithOptions(multiStore, dispatcher.DefaultOptions().
+		WithLogger(logger).
+		WithTimeout(options.ClientTimeout).
+		WithCap(options.Cap).
+		WithStrict(options.StrictDispatch).
+		WithRetries(options.DispatchRetries, options.DispatchBackoff).
+		WithBreakers(options.BreakerThreshold, options.BreakerCooldown).
+		WithDarknodeBudgets(options.MaxInFlightPerDarknode, options.RequestsPerDarknodeRate).
+		WithPool(dispatchPool).
+		WithDivergence(divergence).
+		WithUpstream(options.UpstreamURL).
+		WithTransport(transport).
+		WithSlowLog(slowLog))
+	cacherOpts := cacher.DefaultOptions().
+		WithLogger(logger).
+		WithTTL(options.TTL).
+		WithRevalidateAfter(options.CacheRevalidateAfter).
+		WithMethodTTLs(options.CacheTTLs).
+		WithCap(options.Cap).
+		WithDB(db)
+	if options.SharedCache {
+		cacherOpts = cacherOpts.WithShared(cacher.NewRedisCache(client, options.TTL))
+	}
+	cacher := cacher.NewWithOptions(ctx, dispatcher, cacherOpts)
+
+	// Burns which are stuck after an outage of the Darknodes are re-queried
+	// through the cacher, so that their results are cached for clients.
+	var recovery *updater.Recovery
+	if options.RecoveryDowntime > 0 {
+		recovery = updater.NewRecovery(componentLogger, cacher, db, updater.RecoveryConf{
+			Downtime:      options.RecoveryDowntime,
+			MinAge:        options.RecoveryMinAge,
+			BatchSize:     options.RecoveryBatchSize,
+			BatchInterval: options.RecoveryBatchInterval,
+		})
+		peerUpdater = peerUpdater.WithRecovery(recovery)
+	}
 
 	versionStore := v0.NewCompatStore(db, client, options.TransactionExpiry)
-	gpubkeyStore := v1.NewCompatStore(client)
+	gpubkeyStore := v1.NewCompatStore(client, options.TransactionExpiry)
+	var migration *v0.MigratingMappings
+	switch options.CompatBackend {
+	case v0.BackendSQL:
+		versionStore = v0.NewSQLCompatStore(db, options.TransactionExpiry)
+		gpubkeyStore = gpubkeyStore.WithMappings(v0.NewSQLMappings(db, options.TransactionExpiry))
+	case v0.BackendMigrating:
+		migration = v0.NewMigratingMappings(logger, v0.NewRedisMappings(client, options.TransactionExpiry), v0.NewSQLMappings(db, options.TransactionExpiry))
+		versionStore = versionStore.WithMappings(migration)
+		gpubkeyStore = gpubkeyStore.WithMappings(migration)
+	}
 	hostChains := map[multichain.Chain]bool{}
 	for _, selector := range options.Whitelist {
 		if selector.IsLock() && selector.IsMint() {
 			hostChains[selector.Destination()] = true
 		}
 	}
-	verifier := resolver.NewVerifier(hostChains, verifierBindings)
-	resolverI := resolver.New(options.Network, logger, cacher, multiStore, db, serverOptions, versionStore, gpubkeyStore, bindings, verifier)
-	limiter := resolver.NewRateLimiter(resolver.RateLimiterConf{
-		GlobalMethodRate: options.LimiterGlobalRates,
-		IpMethodRate:     options.LimiterIPRates,
-		Ttl:              options.LimiterTTL,
-		MaxClients:       options.LimiterMaxClients,
+	// The verifier which reads the chains is rebuilt along with the bindings,
+	// without losing the state of the verifiers around it.
+	newVerifier := func(verifierBindings *binding.Binding) resolver.Verifier {
+		verifier := resolver.NewVerifier(hostChains, verifierBindings)
+		return resolver.NewBurnAgeVerifier(verifier, componentLogger, resolver.NewEthBurnBlockFetcher(verifierBindings), resolver.BurnAgeLimit{
+			MaxAge:      options.MaxBurnAge,
+			MaxBlocks:   options.MaxBurnBlocks,
+			RecoveryURL: options.BurnRecoveryURL,
+		})
+	}
+	chainVerifier := resolver.NewReloadableVerifier(newVerifier(verifierBindings))
+	var verifier resolver.Verifier = chainVerifier
+	verifier = resolver.NewBudgetVerifier(verifier, componentLogger, resolver.VerificationBudget{
+		Timeout:      options.VerificationTimeout,
+		Concurrency:  options.VerificationConcurrency,
+		CacheSize:    options.VerificationCacheSize,
+		CacheTTL:     options.VerificationCacheTTL,
+		RejectionTTL: options.VerificationRejectionTTL,
+	})
+	verifier = resolver.NewPendingLimitVerifier(verifier, componentLogger, db, resolver.PendingLimit{
+		MaxPending: options.MaxPendingTxs,
+		Interval:   options.PendingCountInterval,
 	})
-	server := jsonrpc.NewServer(serverOptions, resolverI, resolver.NewValidator(options.Network, verifierBindings, options.DistPubKey, versionStore, gpubkeyStore, &limiter, logger))
+	verifier = chainIDs.Verifier(verifier)
+
+	// Converting txs for v0 clients requires the Ethereum token address of the
+	// asset, so these are cached and fetched up front instead of on every
+	// query.
+	ethAssets := []multichain.Asset{}
+	seenAssets := map[multichain.Asset]bool{}
+	for _, selector := range options.Whitelist {
+		if !selector.IsCrossChain() || seenAssets[selector.Asset()] {
+			continue
+		}
+		if selector.Source() == multichain.Ethereum || selector.Destination() == multichain.Ethereum {
+			ethAssets = append(ethAssets, selector.Asset())
+			seenAssets[selector.Asset()] = true
+		}
+	}
+	tokenCache := v0.NewTokenCache(chainIDs.Bindings(bindings), options.TokenCacheTTL)
+	tokenCache.Warm(logger, multichain.Ethereum, ethAssets)
+
+	// Submissions are paused for assets which governance has marked as
+	// paused, if a governance contract has been configured.
+	pauseAssets := []multichain.Asset{}
+	seenPauseAssets := map[multichain.Asset]bool{}
+	for _, selector := range options.Whitelist {
+		if selector.IsCrossChain() && !seenPauseAssets[selector.Asset()] {
+			pauseAssets = append(pauseAssets, selector.Asset())
+			seenPauseAssets[selector.Asset()] = true
+		}
+	}
+	var pauseSource pause.Source
+	if options.PauseContract != "" {
+		if !common.IsHexAddress(options.PauseContract) {
+			logger.Panicf("invalid pause contract address %v", options.PauseContract)
+		}
+		ethClient := bindings.EthereumClient(options.PauseChain)
+		if ethClient == nil {
+			logger.Panicf("no client for pause contract on %v", options.PauseChain)
+		}
+		contractSource, err := pause.NewContractSource(ethClient, common.HexToAddress(options.PauseContract))
+		if err != nil {
+			logger.Panicf("cannot create pause source: %v", err)
+		}
+		pauseSource = chainIDs.PauseSource(options.PauseChain, contractSource)
+	}
+	pauser := pause.NewPauser(logger, pauseSource, pauseAssets, options.PausePollRate)
+
+	writeBehind := resolver.WriteBehind{QueueSize: options.WriteQueueSize}
+	if options.WriteQueueSize > 0 && options.WriteJournal != "" {
+		journal, err := resolver.OpenJournal(options.WriteJournal)
+		if err != nil {
+			logger.Panicf("cannot open write journal: %v", err)
+		}
+		writeBehind.Journal = journal
+	}
+
+	chainReader := chainIDs.ChainReader(v0.NewChainReader(verifierBindings))
+	checkerPool := pool.New("txchecker", options.TxCheckerConcurrency)
+	resolverI := resolver.New(options.Network, componentLogger, cacher, multiStore, db, serverOptions, versionStore, gpubkeyStore, tokenCache, chainReader, options.DistPubKey, verifier, pauser, writeBehind, checkerPool, options.BlockCacheSize)
+	limiter := resolver.NewRateLimiter(options.limiterConf())
+	if options.SharedRateLimits {
+		sharedOptions := resolver.DefaultSharedLimiterOptions(componentLogger)
+		sharedOptions.DegradedFactor = options.LimiterDegradedFactor
+		limiter.Share(resolver.NewRedisLimits(client), sharedOptions)
+	}
+	validator := resolver.NewValidator(options.Network, chainReader, options.DistPubKey, versionStore, gpubkeyStore, pauser, limiter, componentLogger).WithDB(db)
+	admission := resolver.NewAdmissionController(options.admissionConf())
+	loggingResolver := resolver.NewLoggingResolver(resolverI, componentLogger)
+	admissionValidator := resolver.NewAdmissionValidator(validator, admission, componentLogger)
+	resolverI.WithValidator(validator).WithAdmission(admission)
+	if options.CompatOnly() {
+		resolverI.WithCompatOnly()
+	}
+	server := jsonrpc.NewServer(serverOptions, loggingResolver, admissionValidator)
+	var grpcServer *grpcapi.Server
+	if options.GRPCPort != "" {
+		grpcServer = grpcapi.New(componentLogger, admissionValidator, loggingResolver, options.SubscriptionPollRate, options.SubscriptionMaxConns)
+	}
 	confirmer := confirmer.New(
 		confirmer.DefaultOptions().
 			WithLogger(logger).
 			WithPollInterval(options.ConfirmerPollRate).
-			WithExpiry(options.TransactionExpiry),
+			WithPendingWindow(options.ConfirmerPendingWindow).
+			WithExpiry(options.TransactionExpiry).
+			WithRetention(options.ArchiveRetention).
+			WithPrunePolicy(options.PrunePolicy).
+			WithPruneDryRun(options.PruneDryRun).
+			WithGatewayGracePeriod(options.GatewayGracePeriod).
+			WithFinalityCheckers(finalityCheckers),
 		dispatcher,
 		db,
 		bindings,
 	)
 
+	// newEVMWatchers returns the watchers for the whitelisted burns from an
+	// EVM chain, configured by the options and using the given bindings.
+	newEVMWatchers := func(opts Options, chain multichain.Chain, verifierBindings, chainBindings *binding.Binding) map[multichain.Asset]watcher.Watcher {
+		chainWatchers := map[multichain.Asset]watcher.Watcher{}
+		for _, selector := range options.Whitelist {
+			if !selector.IsBurn() || !selector.IsRelease() || selector.Source() != chain {
+				continue
+			}
+			asset := selector.Asset()
+			if _, ok := chainWatchers[asset]; ok {
+				continue
+			}
+			config := opts.EVMChainConfig(chain)
+			var blockHeightFetcher watcher.BlockHeightFetcher = watcher.NewEthBlockHeightFetcher(chainBindings.EthereumClient(chain))
+			if checker, ok := finalityCheckers[chain]; ok {
+				// Finalised blocks cannot be reorganised, so there is no
+				// need to stay behind the head.
+				blockHeightFetcher = checker
+				config.ConfidenceInterval = 0
+			}
+			blockHeightFetcher = chainIDs.BlockHeightFetcher(chain, blockHeightFetcher)
+			chainWatchers[asset] = watcher.NewEVMWatcher(componentLogger, options.Network, selector, verifierBindings, chainBindings, blockHeightFetcher, resolverI, client, config, options.TransactionExpiry).WithDB(db).WithHooks(hookRunner)
+			logger.Info("watching", selector)
+		}
+		return chainWatchers
+	}
+
 	watchers := map[multichain.Chain]map[multichain.Asset]watcher.Watcher{}
-	solClient := solanaRPC.NewClient(bindingsOpts.Chains[multichain.Solana].RPC.String())
+	solClient := solanaRPC.NewClient(options.Chains[multichain.Solana].RPC.String())
 	for _, selector := range options.Whitelist {
 		if !selector.IsBurn() || !selector.IsRelease() {
 			continue
 		}
 		chain := selector.Source()
-		asset := selector.Asset()
-		if watchers[chain] == nil {
-			watchers[chain] = map[multichain.Asset]watcher.Watcher{}
+		if _, ok := watchers[chain]; ok {
+			continue
 		}
-		if _, ok := watchers[chain][asset]; ok {
+		if chain != multichain.Solana {
+			watchers[chain] = newEVMWatchers(options, chain, verifierBindings, bindings)
 			continue
 		}
-		var burnLogFetcher watcher.BurnLogFetcher
-		var blockHeightFetcher watcher.BlockHeightFetcher
-		if chain == multichain.Solana {
-			if bindings.ContractGateway(chain, asset) == "" {
+		watchers[chain] = map[multichain.Asset]watcher.Watcher{}
+		for _, selector := range options.Whitelist {
+			asset := selector.Asset()
+			if !selector.IsBurn() || !selector.IsRelease() || selector.Source() != chain || bindings.ContractGateway(chain, asset) == "" {
 				continue
 			}
-			burnLogFetcher = watcher.NewSolFetcher(solClient, string(bindings.ContractGateway(chain, asset)))
-			blockHeightFetcher = watcher.NewSolFetcher(solClient, string(bindings.ContractGateway(chain, asset)))
-		} else {
-			burnLogFetcher = watcher.NewEthBurnLogFetcher(bindings.EthereumGateway(chain, asset))
-			blockHeightFetcher = watcher.NewEthBlockHeightFetcher(bindings.EthereumClient(chain))
+			burnLogFetcher := watcher.NewSolFetcher(solClient, string(bindings.ContractGateway(chain, asset)))
+			blockHeightFetcher := watcher.NewSolFetcher(solClient, string(bindings.ContractGateway(chain, asset)))
+			// Solana burns are numbered by the gateway rather than found in
+			// blocks, so there are no blocks to stay behind.
+			config := watcher.ChainConfig{BlockTime: options.WatcherPollRate, MaxLogRange: options.WatcherMaxBlockAdvance}
+			watchers[chain][asset] = watcher.NewWatcher(componentLogger, options.Network, selector, verifierBindings, burnLogFetcher, blockHeightFetcher, resolverI, client, config, options.TransactionExpiry).WithDB(db).WithHooks(hookRunner)
+			logger.Info("watching", selector)
 		}
-		watchers[chain][selector.Asset()] = watcher.NewWatcher(logger, options.Network, selector, verifierBindings, burnLogFetcher, blockHeightFetcher, resolverI, client, options.WatcherPollRate, options.WatcherMaxBlockAdvance, options.WatcherConfidenceInterval)
-		logger.Info("watching", selector)
 	}
+	registry := watcher.NewRegistry(componentLogger)
+	for chain, chainWatchers := range watchers {
+		if err := registry.Add(chain, chainWatchers); err != nil {
+			logger.Panicf("cannot watch %v: %v", chain, err)
+		}
+	}
+
+	// Host chains can be added while the Lightnode is running. They are
+	// checked against their RPC first, and are then watched like the chains
+	// configured at startup. The bindings are rebuilt with the new chain, so
+	// that its burns can be verified and confirmed.
+	runtimeOptions := options
+	runtimeOptionsMu := new(sync.Mutex)
+	addHostChain := func(ctx context.Context, hostChain HostChain) error {
+		if err := hostChain.Validate(); err != nil {
+			return err
+		}
+		runtimeOptionsMu.Lock()
+		defer runtimeOptionsMu.Unlock()
+
+		if _, ok := runtimeOptions.Chains[hostChain.Chain]; ok {
+			return fmt.Errorf("%v is already configured", hostChain.Chain)
+		}
+		nextOptions := runtimeOptions.WithHostChains(hostChain)
+		nextBindings, nextVerifierBindings := newBindings(nextOptions.BindingChains())
+		ethClient := nextBindings.EthereumClient(hostChain.Chain)
+		if ethClient == nil {
+			return fmt.Errorf("cannot connect to %v rpc", hostChain.Chain)
+		}
+		if err := hostChain.Check(ctx, ethClient); err != nil {
+			return fmt.Errorf("%v is misconfigured: %v", hostChain.Chain, err)
+		}
+		chainWatchers := newEVMWatchers(nextOptions, hostChain.Chain, nextVerifierBindings, nextBindings)
+		if len(chainWatchers) == 0 {
+			return fmt.Errorf("no burns from %v are whitelisted", hostChain.Chain)
+		}
+		if err := registry.Add(hostChain.Chain, chainWatchers); err != nil {
+			return err
+		}
+		chainIDs.Add(hostChain.Chain, hostChain.ChainID, ethClient)
+		chainVerifier.Set(newVerifier(nextVerifierBindings))
+		confirmer.SetBindings(nextBindings)
+		runtimeOptions = nextOptions
+		return nil
+	}
+	resolverI.WithChainUpdater(NewChainUpdater(componentLogger, registry, addHostChain), options.AdminToken)
+
+	// Certificates are only loaded if they are used by a listener, so that
+	// the Lightnode can still be deployed behind a TLS terminating proxy.
+	var certs *lhttp.CertReloader
+	for _, listener := range options.Listeners {
+		if !listener.TLS || certs != nil {
+			continue
+		}
+		var err error
+		certs, err = lhttp.NewCertReloader(options.TLSCertFile, options.TLSKeyFile)
+		if err != nil {
+			logger.Panicf("cannot load tls certificate: %v", err)
+		}
+	}
+	var adminCAs *x509.CertPool
+	if options.AdminClientCAFile != "" {
+		var err error
+		adminCAs, err = lhttp.LoadCertPool(options.AdminClientCAFile)
+		if err != nil {
+			logger.Panicf("cannot load admin client ca: %v", err)
+		}
+	}
+
+	// Orchestrators gate traffic on the dependencies being reachable. Only one
+	// bootstrap Darknode needs to respond, as requests are dispatched to
+	// whichever Darknodes are available. Compat-only Lightnodes depend on
+	// their upstream instead.
+	darknodeClient := lhttp.NewClient(options.HealthTimeout).WithTransport(transport)
+	darknodeProbes := make([]health.Probe, 0, len(options.BootstrapAddrs))
+	for _, addr := range options.BootstrapAddrs {
+		darknodeProbes = append(darknodeProbes, darknodeProbe(darknodeClient, addr))
+	}
+	if options.CompatOnly() {
+		darknodeProbes = []health.Probe{upstreamProbe(darknodeClient, options.UpstreamURL)}
+	}
+	// A single chain RPC which is down only affects its own chain, so chains
+	// are reported but do not gate readiness.
+	checker := health.New(options.HealthTimeout).
+		WithProbe("redis", redisProbe(client)).
+		WithProbe("db", sqlDB.PingContext).
+		WithProbe("darknodes", health.Any(darknodeProbes...))
+	for chain, chainOpts := range options.Chains {
+		if chainOpts.RPC.String() == "" {
+			continue
+		}
+		checker = checker.WithOptionalProbe(fmt.Sprintf("chain/%v", chain), health.HTTPProbe(&http.Client{Transport: transport}, chainOpts.RPC.String()))
+	}
+	for chain := range chainIDClients {
+		checker = checker.WithOptionalProbe(fmt.Sprintf("chainid/%v", chain), chainIDs.Probe(chain))
+	}
+
+	// Epoch changes are pushed to WebSocket subscribers and epoch change
+	// hooks, so that wallets can tell users to refresh their gateways.
+	trustedProxies, _ := lhttp.ParseIPNets(options.TrustedProxies)
+	subs := resolver.NewSubscriptionHandler(componentLogger, resolverI, options.SubscriptionPollRate).
+		WithOrigins(options.SubscriptionOrigins).
+		WithConnLimits(options.SubscriptionMaxConns, options.SubscriptionMaxConnsPerIP, trustedProxies)
+	epochs := resolver.NewEpochWatcher(componentLogger, resolverI, options.EpochPollRate,
+		subs.NotifyEpochChange,
+		func(change resolver.EpochChange) {
+			hookRunner.Notify(hooks.ConditionEpochChange, fmt.Sprint(change.Epoch))
+		},
+	).WithClock(db.Clock())
 
 	return Lightnode{
-		options:    options,
-		logger:     logger,
-		db:         db,
-		updater:    updater,
-		dispatcher: dispatcher,
-		cacher:     cacher,
-		server:     server,
-		confirmer:  confirmer,
-		watchers:   watchers,
+		options:      options,
+		logger:       logger,
+		db:           db,
+		sqlDB:        sqlDB,
+		hooks:        hookRunner,
+		updater:      peerUpdater,
+		dispatcher:   dispatcher,
+		cacher:       cacher,
+		server:       server,
+		validator:    admissionValidator,
+		rpcLogger:    loggingResolver,
+		grpc:         grpcServer,
+		resolver:     resolverI,
+		confirmer:    confirmer,
+		watchers:     registry,
+		versionStore: versionStore,
+		migration:    migration,
+		recovery:     recovery,
+		divergence:   divergence,
+		certs:        certs,
+		adminCAs:     adminCAs,
+		pauser:       pauser,
+		pools:        pool.Handler{checkerPool, dispatchPool},
+		clients:      resolver.NewClientsHandler(componentLogger, db),
+		v0payloads:   resolver.NewV0PayloadsHandler(componentLogger, db),
+		blacklist:    blacklist,
+		peers:        peers,
+		replay:       watcher.NewReplayHandler(componentLogger, db, registry),
+		hookEvents:   hooks.NewEventsHandler(componentLogger, db),
+		proxies:      proxies,
+		limiter:      limiter,
+		subs:         subs,
+		epochs:       epochs,
+		chainIDs:     chainIDs,
+		health:       checker,
+		slowLog:      slowLog,
 	}
 }
 
-// Run starts the `Lightnode`. This function call is blocking.
-func (lightnode Lightnode) Run(ctx context.Context) {
-	go lightnode.updater.Run(ctx)
-	go lightnode.cacher.Run(ctx)
-	go lightnode.dispatcher.Run(ctx)
+// Run starts the `Lightnode`. This function call is blocking. It returns an
+// error if the gRPC port cannot be listened on, before anything is started.
+func (lightnode Lightnode) Run(ctx context.Context) error {
+	var grpcListener net.Listener
+	grpcAddr := fmt.Sprintf(":%s", lightnode.options.GRPCPort)
+	if lightnode.grpc != nil {
+		ln, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return fmt.Errorf("cannot listen for grpc on %v: %v", grpcAddr, err)
+		}
+		grpcListener = ln
+	}
+
+	// Every listener is bound before anything is started, so that a port
+	// which is in use, or a socket which cannot be created, stops the
+	// Lightnode rather than leaving it running without its API.
+	listeners := lightnode.options.Listeners
+	if len(listeners) == 0 {
+		listeners = []lhttp.Listener{{Network: "tcp", Address: fmt.Sprintf(":%s", lightnode.options.Port)}}
+	}
+	lns := make([]net.Listener, 0, len(listeners))
+	for _, listener := range listeners {
+		ln, err := lhttp.Listen(listener, lightnode.certs, lightnode.adminCAs)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			if grpcListener != nil {
+				grpcListener.Close()
+			}
+			return fmt.Errorf("cannot listen on %v: %v", listener, err)
+		}
+		lns = append(lns, ln)
+	}
+
+	// The cacher, the dispatcher and the resolver answer the requests which
+	// the servers are draining, so they are stopped once the servers have
+	// drained rather than when the context is cancelled. The resolver writes
+	// the txs it has accepted before Run returns.
+	serveCtx, cancelServe := context.WithCancel(context.Background())
+	resolverDone := make(chan struct{})
+	defer func() {
+		cancelServe()
+		<-resolverDone
+	}()
+	go lightnode.cacher.Run(serveCtx)
+	go lightnode.dispatcher.Run(serveCtx)
+	go func() {
+		defer close(resolverDone)
+		lightnode.resolver.Run(serveCtx)
+	}()
+
+	// Compat-only Lightnodes do not talk to the Darknodes, and leave
+	// confirming txs and watching burns to their upstream.
+	compatOnly := lightnode.options.CompatOnly()
+	if !compatOnly {
+		go lightnode.updater.Run(ctx)
+		go lightnode.confirmer.Run(ctx)
+	}
 
 	// Note: the following should be disabled when running locally.
-	go lightnode.confirmer.Run(ctx)
-	for _, assetMap := range lightnode.watchers {
-		for _, watcher := range assetMap {
-			go watcher.Run(ctx)
+	go lightnode.pauser.Run(ctx)
+	go lightnode.blacklist.Run(ctx)
+	go lightnode.subs.Run(ctx)
+	go lightnode.epochs.Run(ctx)
+	go lightnode.chainIDs.Run(ctx, lightnode.options.ChainIDCheckInterval)
+	go db.RunConsistencyCheck(ctx, lightnode.db, lightnode.logger, time.Hour)
+	go clock.RunSkewCheck(ctx, lightnode.db.Clock(), lightnode.logger, time.Minute, lightnode.options.MaxClockSkew)
+	go lightnode.hooks.Poll(ctx, hooks.ConditionDBDown, "database", time.Minute, lightnode.sqlDB.PingContext)
+	go lightnode.hooks.PruneEvents(ctx, hooks.EventPruneInterval)
+	go lightnode.versionStore.RunGC(ctx, lightnode.logger, time.Hour, lightnode.options.CompatGCGracePeriod)
+	if !compatOnly {
+		go lightnode.watchers.Run(ctx)
+	}
+
+	var wg sync.WaitGroup
+	if lightnode.grpc != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lightnode.logger.Infof("lightnode %v serving grpc on %v", version.Get(), grpcAddr)
+			if err := lightnode.grpc.Serve(ctx, grpcListener); err != nil {
+				lightnode.logger.Errorf("[lightnode] grpc server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Cache the responses requested by most clients before accepting
+	// connections, so that they do not all reach the darknodes at once.
+	if lightnode.options.WarmupTimeout > 0 {
+		warmupCtx, cancel := context.WithTimeout(ctx, lightnode.options.WarmupTimeout)
+		if err := lightnode.resolver.Warmup(warmupCtx); err != nil {
+			lightnode.logger.Warnf("[lightnode] %v", err)
 		}
+		cancel()
 	}
 
-	lightnode.server.Listen(ctx, fmt.Sprintf(":%s", lightnode.options.Port))
+	// Operational endpoints are served on dedicated admin listeners. Without
+	// them, only readiness checks, and metrics for admins, are served
+	// alongside the API.
+	hasAdmin := false
+	for _, listener := range listeners {
+		hasAdmin = hasAdmin || listener.Admin
+	}
+	metricsHandler := metrics.Handler()
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/divergence", lightnode.divergence)
+	adminMux.Handle("/prune", confirmer.NewPruneHandler(&lightnode.confirmer))
+	adminMux.Handle("/pools", lightnode.pools)
+	adminMux.Handle("/clients", lightnode.clients)
+	adminMux.Handle("/v0payloads", lightnode.v0payloads)
+	adminMux.Handle("/blacklist", lightnode.blacklist)
+	adminMux.Handle("/peers", lightnode.peers)
+	adminMux.Handle("/cache", cacher.NewFlushHandler(lightnode.cacher))
+	adminMux.Handle("/replay", lightnode.replay)
+	adminMux.Handle("/hooks/events", lightnode.hookEvents)
+	adminMux.Handle("/proxies", lightnode.proxies)
+	adminMux.Handle("/limiter", lightnode.limiter)
+	adminMux.Handle("/limiter/counters", http.HandlerFunc(lightnode.limiter.ServeCounters))
+	adminMux.Handle("/metrics", metricsHandler)
+	adminMux.Handle("/debug/slowlog", lightnode.slowLog)
+	adminMux.Handle("/health", lightnode.health.HealthHandler())
+	adminMux.Handle("/ready", lightnode.health.ReadyHandler())
+	if lightnode.migration != nil {
+		adminMux.Handle("/compat/migration", lightnode.migration)
+	}
+	if lightnode.recovery != nil {
+		adminMux.Handle("/recovery", lightnode.recovery)
+	}
+
+	// Readiness checks are left unauthenticated for orchestrators. Health
+	// checks probe every chain, so they are only served to admins. Without
+	// an admin token or client CAs, the admin api is only served on admin
+	// listeners which can only be reached from this host.
+	readyMux := http.NewServeMux()
+	readyMux.Handle("/ready", lightnode.health.ReadyHandler())
+	var adminHandler http.Handler = adminMux
+	authenticated := lightnode.options.AdminToken != "" || lightnode.adminCAs != nil
+	if authenticated {
+		authMux := http.NewServeMux()
+		authMux.Handle("/ready", lightnode.health.ReadyHandler())
+		authMux.Handle("/", lhttp.NewAdminAuthHandler(lightnode.options.AdminToken, adminMux))
+		adminHandler = authMux
+	}
+
+	// Without an admin listener, metrics are served alongside the API, but
+	// only to admins, and not at all if admins cannot be authenticated.
+	apiMux := http.NewServeMux()
+	if !hasAdmin {
+		if authenticated {
+			apiMux.Handle("/metrics", lhttp.NewAdminAuthHandler(lightnode.options.AdminToken, metricsHandler))
+		} else {
+			lightnode.logger.Warn("[lightnode] not serving metrics, set an admin token or an admin listener")
+		}
+		apiMux.Handle("/ready", lightnode.health.ReadyHandler())
+	}
+	apiMux.Handle("/ws", lightnode.subs)
+	apiMux.Handle("/api/schema", resolver.NewAPISchemaHandler())
+	trustedProxies, _ := lhttp.ParseIPNets(lightnode.options.TrustedProxies)
+	var rpcHandler http.Handler = resolver.NewTxStreamHandler(lightnode.resolver, lightnode.rpcLogger, lightnode.validator, lightnode.options.StreamThreshold,
+		lhttp.NewVersionHandler(lightnode.server, trustedProxies))
+	if lightnode.options.SigningKey != nil {
+		lightnode.logger.Infof("[lightnode] signing responses as %v", lightnode.options.SigningKey.Signatory())
+		rpcHandler = lhttp.NewSigningHandler(lightnode.options.SigningKey, rpcHandler)
+	}
+	apiMux.Handle("/", rpcHandler)
+
+	if lightnode.certs != nil {
+		go lightnode.certs.Run(ctx, lightnode.logger, time.Minute)
+	}
+
+	for i, listener := range listeners {
+		ln := lns[i]
+		var handler http.Handler = apiMux
+		if listener.Admin {
+			handler = adminHandler
+			if !authenticated && !listener.Local() {
+				lightnode.logger.Errorf("[lightnode] not serving the admin api on %v, set an admin token or listen on a local address", listener)
+				handler = readyMux
+			}
+		}
+		httpServer, err := lhttp.NewServer(handler, lightnode.options.HTTPServer)
+		if err != nil {
+			lightnode.logger.Errorf("[lightnode] cannot configure http server on %v: %v", listener, err)
+			ln.Close()
+			continue
+		}
+
+		wg.Add(1)
+		go func(listener lhttp.Listener) {
+			defer wg.Done()
+			lightnode.logger.Infof("lightnode %v listening on %v", version.Get(), listener)
+			if err := httpServer.Serve(ctx, ln); err != nil && err != http.ErrServerClosed {
+				lightnode.logger.Errorf("[lightnode] http server on %v stopped: %v", listener, err)
+			}
+		}(listener)
+	}
+	wg.Wait()
+	return nil
+}
+
+// redisProbe returns a probe which pings Redis. The ping is cancelled with
+// the context of the probe.
+func redisProbe(client redis.Cmdable) health.Probe {
+	return func(ctx context.Context) error {
+		switch client := client.(type) {
+		case *redis.Client:
+			return client.WithContext(ctx).Ping().Err()
+		case *redis.ClusterClient:
+			return client.WithContext(ctx).Ping().Err()
+		default:
+			return client.Ping().Err()
+		}
+	}
+}
+
+// darknodeProbe returns a probe which checks that the Darknode at the address
+// responds to JSON-RPC requests.
+func darknodeProbe(client lhttp.Client, addr wire.Address) health.Probe {
+	return func(ctx context.Context) error {
+		url, err := lhttp.DarknodeURL(addr)
+		if err != nil {
+			return err
+		}
+		return queryNumPeers(ctx, client, url)
+	}
+}
+
+// upstreamProbe checks that the upstream Lightnode of a compat-only Lightnode
+// responds, which it only does if it can reach the Darknodes.
+func upstreamProbe(client lhttp.Client, url string) health.Probe {
+	return func(ctx context.Context) error {
+		return queryNumPeers(ctx, client, url)
+	}
+}
+
+func queryNumPeers(ctx context.Context, client lhttp.Client, url string) error {
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      1,
+		Method:  jsonrpc.MethodQueryNumPeers,
+		Params:  json.RawMessage("{}"),
+	}
+	response, err := client.SendRequest(ctx, url, request, nil)
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%v", response.Error.Message)
+	}
+	return nil
 }
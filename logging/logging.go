@@ -0,0 +1,179 @@
+// Package logging defines the logger used by the resolver, watcher and updater,
+// so that they can be embedded in programs which do not use logrus. Loggers
+// from other libraries can be adapted using FromFunc, for example with zap:
+//
+//	logger := logging.FromFunc(func(level logging.Level, msg string, fields logging.Fields) {
+//		switch level {
+//		case logging.DebugLevel:
+//			sugar.Debugw(msg, fields.KeysAndValues()...)
+//		case logging.WarnLevel:
+//			sugar.Warnw(msg, fields.KeysAndValues()...)
+//		case logging.ErrorLevel:
+//			sugar.Errorw(msg, fields.KeysAndValues()...)
+//		default:
+//			sugar.Infow(msg, fields.KeysAndValues()...)
+//		}
+//	})
+package logging
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are structured fields attached to a log entry.
+type Fields map[string]interface{}
+
+// KeysAndValues returns the fields as alternating keys and values, sorted by
+// key, which is the form expected by zap and logr.
+func (fields Fields) KeysAndValues() []interface{} {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]interface{}, 0, 2*len(fields))
+	for _, key := range keys {
+		kvs = append(kvs, key, fields[key])
+	}
+	return kvs
+}
+
+// Logger is the subset of logrus.FieldLogger used by the Lightnode.
+type Logger interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+
+	WithField(key string, value interface{}) Logger
+	WithFields(fields Fields) Logger
+	WithError(err error) Logger
+}
+
+// ErrorKey is the field under which errors passed to WithError are logged. It
+// matches the key used by logrus.
+const ErrorKey = logrus.ErrorKey
+
+type logrusLogger struct {
+	entry logrus.FieldLogger
+}
+
+// FromLogrus returns a Logger which writes to the given logrus logger.
+func FromLogrus(logger logrus.FieldLogger) Logger {
+	return logrusLogger{entry: logger}
+}
+
+func (l logrusLogger) Debug(args ...interface{}) { l.entry.Debug(args...) }
+func (l logrusLogger) Info(args ...interface{})  { l.entry.Info(args...) }
+func (l logrusLogger) Warn(args ...interface{})  { l.entry.Warn(args...) }
+func (l logrusLogger) Error(args ...interface{}) { l.entry.Error(args...) }
+
+func (l logrusLogger) Debugf(format string, args ...interface{}) { l.entry.Debugf(format, args...) }
+func (l logrusLogger) Infof(format string, args ...interface{})  { l.entry.Infof(format, args...) }
+func (l logrusLogger) Warnf(format string, args ...interface{})  { l.entry.Warnf(format, args...) }
+func (l logrusLogger) Errorf(format string, args ...interface{}) { l.entry.Errorf(format, args...) }
+
+func (l logrusLogger) WithField(key string, value interface{}) Logger {
+	return logrusLogger{entry: l.entry.WithField(key, value)}
+}
+
+func (l logrusLogger) WithFields(fields Fields) Logger {
+	return logrusLogger{entry: l.entry.WithFields(logrus.Fields(fields))}
+}
+
+func (l logrusLogger) WithError(err error) Logger {
+	return logrusLogger{entry: l.entry.WithError(err)}
+}
+
+// Level is the severity of a log entry.
+type Level int
+
+// Enumerate log levels.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// String implements the fmt.Stringer interface.
+func (level Level) String() string {
+	switch level {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(level))
+	}
+}
+
+// Func is called with every entry written to a Logger returned by FromFunc.
+// The fields must not be modified.
+type Func func(level Level, msg string, fields Fields)
+
+type funcLogger struct {
+	write  Func
+	fields Fields
+}
+
+// FromFunc returns a Logger which passes every entry to the given function.
+// It is the simplest way to adapt another logging library.
+func FromFunc(write Func) Logger {
+	return funcLogger{write: write, fields: Fields{}}
+}
+
+func (l funcLogger) Debug(args ...interface{}) { l.write(DebugLevel, fmt.Sprint(args...), l.fields) }
+func (l funcLogger) Info(args ...interface{})  { l.write(InfoLevel, fmt.Sprint(args...), l.fields) }
+func (l funcLogger) Warn(args ...interface{})  { l.write(WarnLevel, fmt.Sprint(args...), l.fields) }
+func (l funcLogger) Error(args ...interface{}) { l.write(ErrorLevel, fmt.Sprint(args...), l.fields) }
+
+func (l funcLogger) Debugf(format string, args ...interface{}) {
+	l.write(DebugLevel, fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l funcLogger) Infof(format string, args ...interface{}) {
+	l.write(InfoLevel, fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l funcLogger) Warnf(format string, args ...interface{}) {
+	l.write(WarnLevel, fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l funcLogger) Errorf(format string, args ...interface{}) {
+	l.write(ErrorLevel, fmt.Sprintf(format, args...), l.fields)
+}
+
+func (l funcLogger) WithField(key string, value interface{}) Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// WithFields returns a logger with a copy of the existing fields, so that
+// loggers derived from the same parent do not share fields.
+func (l funcLogger) WithFields(fields Fields) Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return funcLogger{write: l.write, fields: merged}
+}
+
+func (l funcLogger) WithError(err error) Logger {
+	return l.WithField(ErrorKey, err)
+}
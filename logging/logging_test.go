@@ -0,0 +1,69 @@
+package logging_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/logging"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+)
+
+type entry struct {
+	level  Level
+	msg    string
+	fields Fields
+}
+
+var _ = Describe("Logging", func() {
+	Context("when adapting a function", func() {
+		It("should pass the level, message and fields of each entry", func() {
+			entries := []entry{}
+			logger := FromFunc(func(level Level, msg string, fields Fields) {
+				entries = append(entries, entry{level, msg, fields})
+			})
+
+			logger.WithField("method", "ren_queryTx").Infof("handled %v", 1)
+			logger.WithError(fmt.Errorf("boom")).Warn("failed")
+
+			Expect(entries).To(Equal([]entry{
+				{InfoLevel, "handled 1", Fields{"method": "ren_queryTx"}},
+				{WarnLevel, "failed", Fields{ErrorKey: fmt.Errorf("boom")}},
+			}))
+		})
+
+		It("should not share fields between derived loggers", func() {
+			var last Fields
+			logger := FromFunc(func(level Level, msg string, fields Fields) {
+				last = fields
+			})
+
+			parent := logger.WithField("a", 1)
+			parent.WithField("b", 2).Debug("child")
+			Expect(last).To(Equal(Fields{"a": 1, "b": 2}))
+			parent.Debug("parent")
+			Expect(last).To(Equal(Fields{"a": 1}))
+		})
+	})
+
+	Context("when adapting logrus", func() {
+		It("should write entries with their fields", func() {
+			inner, hook := logrustest.NewNullLogger()
+			logger := FromLogrus(inner)
+
+			logger.WithFields(Fields{"requestID": 7}).Error("[resolver] request failed")
+
+			Expect(hook.LastEntry().Level).To(Equal(logrus.ErrorLevel))
+			Expect(hook.LastEntry().Message).To(Equal("[resolver] request failed"))
+			Expect(hook.LastEntry().Data).To(Equal(logrus.Fields{"requestID": 7}))
+		})
+	})
+
+	Context("when listing fields", func() {
+		It("should sort them by key", func() {
+			Expect(Fields{"b": 2, "a": 1}.KeysAndValues()).To(Equal([]interface{}{"a", 1, "b", 2}))
+		})
+	})
+})
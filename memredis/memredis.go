@@ -0,0 +1,210 @@
+// Package memredis runs an in-process Redis server for deployments without
+// Redis, such as local demos which only have SQLite. The contents of the server
+// are saved to the database periodically and when it stops, so that compat
+// mappings and watcher checkpoints survive restarts.
+package memredis
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSaveInterval is the interval at which the contents of the server are
+// saved to the database.
+const DefaultSaveInterval = time.Minute
+
+// Types of the keys which can be saved. The Lightnode only uses strings and
+// sorted sets; keys of other types are not saved.
+const (
+	typeString = "string"
+	typeZSet   = "zset"
+)
+
+// A Server is an in-process Redis server backed by a database table.
+type Server struct {
+	logger logrus.FieldLogger
+	db     *sql.DB
+	server *miniredis.Miniredis
+	client *redis.Client
+}
+
+// Start loads the contents saved in the database into a new server and starts
+// it. The table used for saving is created if it does not exist.
+func Start(logger logrus.FieldLogger, db *sql.DB) (*Server, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS redis_snapshot (
+		redis_key          VARCHAR NOT NULL,
+		member             VARCHAR NOT NULL,
+		key_type           VARCHAR NOT NULL,
+		value              VARCHAR,
+		expires_at         BIGINT,
+		PRIMARY KEY (redis_key, member)
+);`); err != nil {
+		return nil, fmt.Errorf("creating snapshot table: %v", err)
+	}
+
+	server, err := miniredis.Run()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		logger: logger,
+		db:     db,
+		server: server,
+		client: redis.NewClient(&redis.Options{Addr: server.Addr()}),
+	}
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("loading snapshot: %v", err)
+	}
+	return s, nil
+}
+
+// Client returns a client connected to the server.
+func (s *Server) Client() *redis.Client {
+	return s.client
+}
+
+// Run expires keys and saves the contents of the server every interval until
+// the context is done, at which point the contents are saved one last time.
+func (s *Server) Run(ctx context.Context, interval time.Duration) {
+	// The server does not expire keys by itself, so time is advanced every
+	// second.
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	last, lastSave := time.Now(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Save(); err != nil {
+				s.logger.Errorf("[memredis] cannot save snapshot: %v", err)
+			}
+			return
+		case now := <-ticker.C:
+			s.server.FastForward(now.Sub(last))
+			last = now
+			if now.Sub(lastSave) < interval {
+				continue
+			}
+			lastSave = now
+			if err := s.Save(); err != nil {
+				s.logger.Errorf("[memredis] cannot save snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// Save replaces the snapshot in the database with the current contents of the
+// server.
+func (s *Server) Save() error {
+	now := time.Now()
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := sqlTx.Exec("DELETE FROM redis_snapshot;"); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+
+	insert := func(key, member, keyType, value string, expiresAt int64) error {
+		_, err := sqlTx.Exec("INSERT INTO redis_snapshot (redis_key, member, key_type, value, expires_at) VALUES ($1, $2, $3, $4, $5);", key, member, keyType, value, expiresAt)
+		return err
+	}
+	for _, key := range s.server.Keys() {
+		var expiresAt int64
+		if ttl := s.server.TTL(key); ttl > 0 {
+			expiresAt = now.Add(ttl).Unix()
+		}
+
+		switch keyType := s.server.Type(key); keyType {
+		case typeString:
+			value, err := s.server.Get(key)
+			if err != nil {
+				continue
+			}
+			if err := insert(key, "", keyType, value, expiresAt); err != nil {
+				sqlTx.Rollback()
+				return err
+			}
+		case typeZSet:
+			members, err := s.server.ZMembers(key)
+			if err != nil {
+				continue
+			}
+			for _, member := range members {
+				score, err := s.server.ZScore(key, member)
+				if err != nil {
+					continue
+				}
+				if err := insert(key, member, keyType, strconv.FormatFloat(score, 'f', -1, 64), expiresAt); err != nil {
+					sqlTx.Rollback()
+					return err
+				}
+			}
+		default:
+			s.logger.Warnf("[memredis] not saving %v of unsupported type %v", key, keyType)
+		}
+	}
+	return sqlTx.Commit()
+}
+
+// load restores the snapshot in the database. Keys which expired while the
+// server was stopped are skipped.
+func (s *Server) load() error {
+	rows, err := s.db.Query("SELECT redis_key, member, key_type, value, expires_at FROM redis_snapshot;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		var key, member, keyType, value string
+		var expiresAt int64
+		if err := rows.Scan(&key, &member, &keyType, &value, &expiresAt); err != nil {
+			return err
+		}
+		var ttl time.Duration
+		if expiresAt != 0 {
+			ttl = time.Unix(expiresAt, 0).Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+
+		switch keyType {
+		case typeString:
+			if err := s.server.Set(key, value); err != nil {
+				return err
+			}
+		case typeZSet:
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid score for %v: %v", key, err)
+			}
+			if _, err := s.server.ZAdd(key, score, member); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		if ttl > 0 {
+			s.server.SetTTL(key, ttl)
+		}
+	}
+	return rows.Err()
+}
+
+// Close stops the server without saving its contents.
+func (s *Server) Close() {
+	s.client.Close()
+	s.server.Close()
+}
@@ -0,0 +1,13 @@
+package memredis_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMemredis(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Memredis Suite")
+}
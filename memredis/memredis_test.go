@@ -0,0 +1,94 @@
+package memredis_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/memredis"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("In-process redis", func() {
+	var dir string
+	var sqlDB *sql.DB
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "memredis")
+		Expect(err).NotTo(HaveOccurred())
+		sqlDB, err = sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		sqlDB.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should restore the saved contents when restarted", func() {
+		server, err := Start(logrus.New(), sqlDB)
+		Expect(err).NotTo(HaveOccurred())
+		client := server.Client()
+		Expect(client.Set("checkpoint", 42, 0).Err()).To(Succeed())
+		Expect(client.Set("mapping", "v1", time.Hour).Err()).To(Succeed())
+		Expect(client.Set("expired", "v1", time.Second).Err()).To(Succeed())
+		Expect(client.ZAdd("index", &redis.Z{Score: 10, Member: "a"}, &redis.Z{Score: 20, Member: "b"}).Err()).To(Succeed())
+		Expect(server.Save()).To(Succeed())
+		server.Close()
+
+		time.Sleep(1100 * time.Millisecond)
+
+		server, err = Start(logrus.New(), sqlDB)
+		Expect(err).NotTo(HaveOccurred())
+		defer server.Close()
+		client = server.Client()
+
+		checkpoint, err := client.Get("checkpoint").Uint64()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint).To(Equal(uint64(42)))
+		Expect(client.TTL("checkpoint").Val()).To(BeNumerically("<", 0))
+
+		Expect(client.Get("mapping").Val()).To(Equal("v1"))
+		Expect(client.TTL("mapping").Val()).To(BeNumerically("~", time.Hour, time.Minute))
+
+		Expect(client.Get("expired").Err()).To(Equal(redis.Nil))
+
+		members, err := client.ZRangeByScore("index", &redis.ZRangeBy{Min: "-inf", Max: "15"}).Result()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(Equal([]string{"a"}))
+	})
+
+	It("should expire keys and save when stopped", func() {
+		server, err := Start(logrus.New(), sqlDB)
+		Expect(err).NotTo(HaveOccurred())
+		client := server.Client()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			server.Run(ctx, time.Hour)
+		}()
+
+		Expect(client.Set("short", "value", time.Second).Err()).To(Succeed())
+		Expect(client.Set("long", "value", 0).Err()).To(Succeed())
+		Eventually(func() error { return client.Get("short").Err() }, 5*time.Second).Should(Equal(redis.Nil))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+		server.Close()
+
+		server, err = Start(logrus.New(), sqlDB)
+		Expect(err).NotTo(HaveOccurred())
+		defer server.Close()
+		Expect(server.Client().Get("long").Val()).To(Equal("value"))
+	})
+})
@@ -0,0 +1,126 @@
+// Package metrics records Prometheus metrics for the components of the
+// Lightnode, so that operators can alert on degradation. The metrics are
+// served in the Prometheus text format by Handler.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the names of all metrics.
+const Namespace = "lightnode"
+
+// Results of requests, used as label values.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Results of cache lookups, used as label values. Final responses are those
+// served from the database rather than the in-memory cache.
+const (
+	CacheHit   = "hit"
+	CacheFinal = "final"
+	CacheMiss  = "miss"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Number of JSON-RPC requests handled, by method and result.",
+	}, []string{"method", "result"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "rpc_request_duration_seconds",
+		Help:      "Duration of JSON-RPC requests, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	dispatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "dispatch_duration_seconds",
+		Help:      "Duration of requests sent to individual darknodes, by method and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "result"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of requests looked up in the cache, by method and result.",
+	}, []string{"method", "result"})
+
+	watcherLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "watcher_lag_blocks",
+		Help:      "Number of blocks between the chain height and the last block checked by the watcher.",
+	}, []string{"chain", "asset"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of database queries, by query.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		requests,
+		requestDuration,
+		dispatchDuration,
+		cacheRequests,
+		watcherLag,
+		dbQueryDuration,
+	)
+}
+
+// Handler returns a handler which serves the metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a JSON-RPC request which started at the given time.
+func ObserveRequest(method string, start time.Time, failed bool) {
+	requests.WithLabelValues(method, result(failed)).Inc()
+	requestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDispatch records a request to a darknode which started at the given
+// time.
+func ObserveDispatch(method string, start time.Time, failed bool) {
+	dispatchDuration.WithLabelValues(method, result(failed)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCache records the result of looking up a request in the cache.
+func ObserveCache(method, result string) {
+	cacheRequests.WithLabelValues(method, result).Inc()
+}
+
+// SetWatcherLag records the number of blocks the watcher of the chain and
+// asset is behind.
+func SetWatcherLag(chain, asset string, blocks uint64) {
+	watcherLag.WithLabelValues(chain, asset).Set(float64(blocks))
+}
+
+// ObserveDBQuery records a database query which started at the given time. It
+// is expected to be deferred at the start of the query.
+func ObserveDBQuery(query string, start time.Time) {
+	dbQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+func result(failed bool) string {
+	if failed {
+		return ResultError
+	}
+	return ResultOK
+}
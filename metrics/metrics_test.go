@@ -0,0 +1,45 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	scrape := func() string {
+		server := httptest.NewServer(Handler())
+		defer server.Close()
+
+		resp, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	It("should serve the recorded metrics", func() {
+		ObserveRequest("ren_queryTx", time.Now(), false)
+		ObserveRequest("ren_submitTx", time.Now(), true)
+		ObserveDispatch("ren_queryTx", time.Now(), false)
+		ObserveCache("ren_queryTx", CacheHit)
+		SetWatcherLag("Ethereum", "BTC", 12)
+		ObserveDBQuery("Tx", time.Now())
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`lightnode_rpc_requests_total{method="ren_queryTx",result="ok"} 1`))
+		Expect(body).To(ContainSubstring(`lightnode_rpc_requests_total{method="ren_submitTx",result="error"} 1`))
+		Expect(body).To(ContainSubstring(`lightnode_rpc_request_duration_seconds_count{method="ren_queryTx"} 1`))
+		Expect(body).To(ContainSubstring(`lightnode_dispatch_duration_seconds_count{method="ren_queryTx",result="ok"} 1`))
+		Expect(body).To(ContainSubstring(`lightnode_cache_requests_total{method="ren_queryTx",result="hit"} 1`))
+		Expect(body).To(ContainSubstring(`lightnode_watcher_lag_blocks{asset="BTC",chain="Ethereum"} 12`))
+		Expect(body).To(ContainSubstring(`lightnode_db_query_duration_seconds_count{query="Tx"} 1`))
+	})
+})
@@ -1,15 +1,28 @@
 package lightnode
 
 import (
+	"fmt"
+	"net/url"
+	"runtime"
 	"time"
 
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
+	"github.com/renproject/lightnode/clock"
+	v0 "github.com/renproject/lightnode/compat/v0"
 	"github.com/renproject/lightnode/confirmer"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/hooks"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
 	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/updater"
+	"github.com/renproject/lightnode/watcher"
 	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
 	"golang.org/x/time/rate"
 )
 
@@ -19,48 +32,161 @@ var (
 	DefaultCap                       = 128
 	DefaultMaxBatchSize              = 10
 	DefaultMaxPageSize               = 10
+	DefaultStreamThreshold           = resolver.DefaultStreamThreshold
 	DefaultMaxGatewayCount           = 10000
+	DefaultDBBatchSize               = 64
 	DefaultServerTimeout             = 15 * time.Second
 	DefaultClientTimeout             = 15 * time.Second
 	DefaultTTL                       = 3 * time.Second
 	DefaultUpdaterPollRate           = 5 * time.Minute
 	DefaultConfirmerPollRate         = confirmer.DefaultPollInterval
+	DefaultConfirmerPendingWindow    = confirmer.DefaultPendingWindow
 	DefaultWatcherPollRate           = 15 * time.Second
 	DefaultWatcherMaxBlockAdvance    = uint64(1000)
 	DefaultWatcherConfidenceInterval = uint64(6)
 	DefaultTransactionExpiry         = confirmer.DefaultExpiry
+	DefaultCompatGCGracePeriod       = 24 * time.Hour
+	DefaultArchiveRetention          = confirmer.DefaultRetention
+	DefaultGatewayGracePeriod        = confirmer.DefaultGatewayGracePeriod
+	DefaultTokenCacheTTL             = time.Hour
+	DefaultWarmupTimeout             = 30 * time.Second
+	DefaultPausePollRate             = time.Minute
+	DefaultSubscriptionPollRate      = resolver.DefaultSubscriptionPollRate
+	DefaultSubscriptionMaxConns      = resolver.DefaultMaxSubscriptionConns
+	DefaultSubscriptionMaxConnsPerIP = resolver.DefaultMaxSubscriptionConnsPerIP
+	DefaultEpochPollRate             = resolver.DefaultEpochPollRate
+	DefaultChainIDCheckInterval      = 10 * time.Minute
+	DefaultMaxClockSkew              = clock.DefaultMaxSkew
 	DefaultBootstrapAddrs            = []wire.Address{}
 	DefaultLimiterIPRates            = map[string]rate.Limit{"fallback": resolver.LimiterDefaultIPRate}
 	DefaultLimiterGlobalRates        = map[string]rate.Limit{"fallback": resolver.LimiterDefaultGlobalRate}
 	DefaultLimiterTTL                = resolver.LimiterDefaultTTL
 	DefaultLimiterMaxClients         = resolver.LimiterDefaultMaxClients
+	DefaultLimiterDegradedFactor     = resolver.DefaultDegradedRateFactor
+	DefaultTxCheckerConcurrency      = 2 * runtime.NumCPU()
+	DefaultDispatchConcurrency       = 256
+	DefaultDispatchRetries           = dispatcher.DefaultRetries
+	DefaultDispatchBackoff           = dispatcher.DefaultBackoff
+	DefaultBreakerThreshold          = dispatcher.DefaultBreakerThreshold
+	DefaultBreakerCooldown           = dispatcher.DefaultBreakerCooldown
+	DefaultMaxInFlightPerDarknode    = dispatcher.DefaultMaxInFlightPerDarknode
+	DefaultRequestsPerDarknodeRate   = dispatcher.DefaultRequestsPerDarknodeRate
+	DefaultHookChainDownAfter        = 5 * time.Minute
+	DefaultHealthTimeout             = 5 * time.Second
+	DefaultRecoveryMinAge            = updater.DefaultRecoveryMinAge
+	DefaultRecoveryBatchSize         = updater.DefaultRecoveryBatchSize
+	DefaultRecoveryBatchInterval     = updater.DefaultRecoveryBatchInterval
+	DefaultVerificationTimeout       = resolver.DefaultVerificationTimeout
+	DefaultVerificationConcurrency   = runtime.NumCPU()
+	DefaultVerificationCacheSize     = resolver.DefaultVerificationCacheSize
+	DefaultVerificationCacheTTL      = resolver.DefaultVerificationCacheTTL
+	DefaultVerificationRejectionTTL  = resolver.DefaultVerificationRejectionTTL
+	DefaultPendingCountInterval      = resolver.DefaultPendingCountInterval
 )
 
 // Options to configure the precise behaviour of the Lightnode.
 type Options struct {
 	Network                   multichain.Network
 	DistPubKey                *id.PubKey
+	SigningKey                *id.PrivKey
 	Port                      string
+	GRPCPort                  string
+	Listeners                 []lhttp.Listener
+	TLSCertFile               string
+	TLSKeyFile                string
+	AdminToken                string
+	AdminClientCAFile         string
 	Cap                       int
 	MaxBatchSize              int
 	MaxPageSize               int
+	StreamThreshold           int
 	MaxGatewayCount           int
+	DBBatchSize               int
+	WriteQueueSize            int
+	WriteJournal              string
 	ServerTimeout             time.Duration
+	HTTPServer                lhttp.ServerOptions
 	ClientTimeout             time.Duration
 	TTL                       time.Duration
+	CacheRevalidateAfter      time.Duration
+	CacheTTLs                 map[string]time.Duration
+	SharedCache               bool
 	UpdaterPollRate           time.Duration
 	ConfirmerPollRate         time.Duration
+	ConfirmerPendingWindow    time.Duration
 	WatcherPollRate           time.Duration
 	WatcherMaxBlockAdvance    uint64
 	WatcherConfidenceInterval uint64
 	TransactionExpiry         time.Duration
+	CompatGCGracePeriod       time.Duration
+	CompatBackend             string
+	UpstreamURL               string
+	ArchiveRetention          time.Duration
+	GatewayGracePeriod        time.Duration
+	PrunePolicy               db.PrunePolicy
+	PruneDryRun               bool
+	TokenCacheTTL             time.Duration
+	BlockCacheSize            int
+	WarmupTimeout             time.Duration
 	BootstrapAddrs            []wire.Address
 	Chains                    map[multichain.Chain]binding.ChainOptions
+	HostChains                []HostChain
+	FinalityTags              map[multichain.Chain]string
+	EVMChains                 map[multichain.Chain]watcher.ChainConfig
+	MaxBurnAge                time.Duration
+	MaxBurnBlocks             map[multichain.Chain]uint64
+	BurnRecoveryURL           string
+	PauseContract             string
+	PauseChain                multichain.Chain
+	PausePollRate             time.Duration
+	SubscriptionPollRate      time.Duration
+	SubscriptionOrigins       []string
+	SubscriptionMaxConns      int
+	SubscriptionMaxConnsPerIP int
+	EpochPollRate             time.Duration
+	ChainIDCheckInterval      time.Duration
+	MaxClockSkew              time.Duration
 	Whitelist                 []tx.Selector
 	LimiterGlobalRates        map[string]rate.Limit
 	LimiterIPRates            map[string]rate.Limit
 	LimiterTTL                time.Duration
 	LimiterMaxClients         int
+	LimiterAllowlist          []string
+	LimiterDenylist           []string
+	TrustedProxies            []string
+	SharedRateLimits          bool
+	LimiterDegradedFactor     float64
+	AdmissionCapacity         int
+	AdmissionShares           map[string]float64
+	APIKeys                   map[string]string
+	Logger                    logging.Logger
+	TxCheckerConcurrency      int
+	DispatchConcurrency       int
+	StrictDispatch            bool
+	DispatchRetries           int
+	DispatchBackoff           lhttp.RetryOptions
+	BreakerThreshold          int
+	BreakerCooldown           time.Duration
+	MaxInFlightPerDarknode    int
+	RequestsPerDarknodeRate   int
+	ProxyOverrides            map[string]string
+	Hooks                     []hooks.Hook
+	HookChainDownAfter        time.Duration
+	SlowDBThreshold           time.Duration
+	SlowDarknodeThreshold     time.Duration
+	SlowLogSampling           int
+	HealthTimeout             time.Duration
+	RecoveryDowntime          time.Duration
+	RecoveryMinAge            time.Duration
+	RecoveryBatchSize         int
+	RecoveryBatchInterval     time.Duration
+	VerificationTimeout       time.Duration
+	VerificationConcurrency   int
+	VerificationCacheSize     int
+	VerificationCacheTTL      time.Duration
+	VerificationRejectionTTL  time.Duration
+	MaxPendingTxs             int
+	PendingCountInterval      time.Duration
 }
 
 // DefaultOptions returns new options with default configurations that should
@@ -72,20 +198,63 @@ func DefaultOptions() Options {
 		BootstrapAddrs:            DefaultBootstrapAddrs,
 		MaxBatchSize:              DefaultMaxBatchSize,
 		MaxPageSize:               DefaultMaxPageSize,
+		StreamThreshold:           DefaultStreamThreshold,
 		MaxGatewayCount:           DefaultMaxGatewayCount,
+		DBBatchSize:               DefaultDBBatchSize,
 		ServerTimeout:             DefaultServerTimeout,
+		HTTPServer:                lhttp.DefaultServerOptions,
 		ClientTimeout:             DefaultClientTimeout,
 		TTL:                       DefaultTTL,
+		CacheTTLs:                 map[string]time.Duration{},
 		UpdaterPollRate:           DefaultUpdaterPollRate,
 		ConfirmerPollRate:         DefaultConfirmerPollRate,
+		ConfirmerPendingWindow:    DefaultConfirmerPendingWindow,
 		WatcherPollRate:           DefaultWatcherPollRate,
 		WatcherMaxBlockAdvance:    DefaultWatcherMaxBlockAdvance,
 		WatcherConfidenceInterval: DefaultWatcherConfidenceInterval,
 		TransactionExpiry:         DefaultTransactionExpiry,
+		CompatGCGracePeriod:       DefaultCompatGCGracePeriod,
+		CompatBackend:             v0.BackendRedis,
+		ArchiveRetention:          DefaultArchiveRetention,
+		GatewayGracePeriod:        DefaultGatewayGracePeriod,
+		TokenCacheTTL:             DefaultTokenCacheTTL,
+		WarmupTimeout:             DefaultWarmupTimeout,
+		FinalityTags:              map[multichain.Chain]string{},
+		EVMChains:                 map[multichain.Chain]watcher.ChainConfig{},
+		PauseChain:                multichain.Ethereum,
+		PausePollRate:             DefaultPausePollRate,
+		SubscriptionPollRate:      DefaultSubscriptionPollRate,
+		SubscriptionMaxConns:      DefaultSubscriptionMaxConns,
+		SubscriptionMaxConnsPerIP: DefaultSubscriptionMaxConnsPerIP,
+		EpochPollRate:             DefaultEpochPollRate,
+		ChainIDCheckInterval:      DefaultChainIDCheckInterval,
+		MaxClockSkew:              DefaultMaxClockSkew,
 		LimiterTTL:                DefaultLimiterTTL,
 		LimiterGlobalRates:        DefaultLimiterGlobalRates,
 		LimiterIPRates:            DefaultLimiterIPRates,
 		LimiterMaxClients:         DefaultLimiterMaxClients,
+		LimiterDegradedFactor:     DefaultLimiterDegradedFactor,
+		AdmissionShares:           map[string]float64{resolver.AnonymousTier: resolver.DefaultAnonymousShare},
+		APIKeys:                   map[string]string{},
+		TxCheckerConcurrency:      DefaultTxCheckerConcurrency,
+		DispatchConcurrency:       DefaultDispatchConcurrency,
+		DispatchRetries:           DefaultDispatchRetries,
+		DispatchBackoff:           DefaultDispatchBackoff,
+		BreakerThreshold:          DefaultBreakerThreshold,
+		BreakerCooldown:           DefaultBreakerCooldown,
+		MaxInFlightPerDarknode:    DefaultMaxInFlightPerDarknode,
+		RequestsPerDarknodeRate:   DefaultRequestsPerDarknodeRate,
+		HookChainDownAfter:        DefaultHookChainDownAfter,
+		HealthTimeout:             DefaultHealthTimeout,
+		RecoveryMinAge:            DefaultRecoveryMinAge,
+		RecoveryBatchSize:         DefaultRecoveryBatchSize,
+		RecoveryBatchInterval:     DefaultRecoveryBatchInterval,
+		VerificationTimeout:       DefaultVerificationTimeout,
+		VerificationConcurrency:   DefaultVerificationConcurrency,
+		VerificationCacheSize:     DefaultVerificationCacheSize,
+		VerificationCacheTTL:      DefaultVerificationCacheTTL,
+		VerificationRejectionTTL:  DefaultVerificationRejectionTTL,
+		PendingCountInterval:      DefaultPendingCountInterval,
 	}
 }
 
@@ -101,12 +270,56 @@ func (opts Options) WithDistPubKey(distPubKey *id.PubKey) Options {
 	return opts
 }
 
+// WithSigningKey signs every JSON-RPC response with the key, so that services
+// which cache responses can verify that they were served by this Lightnode for
+// their request. The signature is returned in the X-Lightnode-Signature
+// header, and covers the request, the response and the time of signing.
+// Signed responses are never streamed. A nil key disables signing.
+func (opts Options) WithSigningKey(key *id.PrivKey) Options {
+	opts.SigningKey = key
+	return opts
+}
+
 // WithPort updates the port.
 func (opts Options) WithPort(port string) Options {
 	opts.Port = port
 	return opts
 }
 
+// WithGRPCPort serves the API over gRPC on the port, in addition to JSON-RPC.
+// An empty port disables gRPC.
+func (opts Options) WithGRPCPort(port string) Options {
+	opts.GRPCPort = port
+	return opts
+}
+
+// WithListeners updates the addresses the Lightnode serves requests on. If no
+// listeners are given, the Lightnode listens on the port over plain TCP.
+func (opts Options) WithListeners(listeners []lhttp.Listener) Options {
+	opts.Listeners = listeners
+	return opts
+}
+
+// WithTLSCertificate updates the certificate and key used by TLS listeners.
+// The files are reloaded when they change on disk.
+func (opts Options) WithTLSCertificate(certFile, keyFile string) Options {
+	opts.TLSCertFile = certFile
+	opts.TLSKeyFile = keyFile
+	return opts
+}
+
+// WithAdminAuth requires requests to the admin API to be authenticated, either
+// with the token as a bearer token, or with a client certificate signed by the
+// CA in the file, which is only possible on admin TLS listeners. Empty values
+// disable either method. Without either, the admin API is only served on admin
+// listeners which can only be reached from this host, and metrics are not
+// served without an admin listener.
+func (opts Options) WithAdminAuth(token, clientCAFile string) Options {
+	opts.AdminToken = token
+	opts.AdminClientCAFile = clientCAFile
+	return opts
+}
+
 // WithCap updates the capacity.
 func (opts Options) WithCap(cap int) Options {
 	opts.Cap = cap
@@ -127,12 +340,26 @@ func (opts Options) WithMaxPageSize(maxPageSize int) Options {
 	return opts
 }
 
+// WithStreamThreshold updates the limit of ren_queryTxs requests from which
+// their responses are streamed instead of buffered. Zero disables streaming.
+func (opts Options) WithStreamThreshold(threshold int) Options {
+	opts.StreamThreshold = threshold
+	return opts
+}
+
 // WithServerTimeout updates the server timeout.
 func (opts Options) WithServerTimeout(serverTimeout time.Duration) Options {
 	opts.ServerTimeout = serverTimeout
 	return opts
 }
 
+// WithHTTPServer updates the HTTP/2 support, timeouts and shutdown draining of
+// the HTTP servers which clients connect to.
+func (opts Options) WithHTTPServer(serverOptions lhttp.ServerOptions) Options {
+	opts.HTTPServer = serverOptions
+	return opts
+}
+
 // WithClientTimeout updates the client timeout.
 func (opts Options) WithClientTimeout(clientTimeout time.Duration) Options {
 	opts.ClientTimeout = clientTimeout
@@ -145,6 +372,30 @@ func (opts Options) WithTTL(ttl time.Duration) Options {
 	return opts
 }
 
+// WithCacheRevalidateAfter updates the age after which cached responses are
+// refreshed in the background while still being served. It should be less
+// than the TTL. Revalidation is disabled by default, and by a zero age.
+func (opts Options) WithCacheRevalidateAfter(revalidateAfter time.Duration) Options {
+	opts.CacheRevalidateAfter = revalidateAfter
+	return opts
+}
+
+// WithCacheTTLs overrides the TTL of cached responses for the given methods,
+// such as a short TTL for queryBlockState. The TTL of queryTx responses for
+// txs which are done is set with cacher.FinalQueryTx. TTLs longer than the
+// default TTL only apply to the shared cache.
+func (opts Options) WithCacheTTLs(ttls map[string]time.Duration) Options {
+	opts.CacheTTLs = ttls
+	return opts
+}
+
+// WithSharedCache enables caching responses in Redis in addition to memory, so
+// that cached responses are shared between Lightnode replicas.
+func (opts Options) WithSharedCache(sharedCache bool) Options {
+	opts.SharedCache = sharedCache
+	return opts
+}
+
 // WithUpdaterPollRate updates the updater poll rate.
 func (opts Options) WithUpdaterPollRate(updaterPollRate time.Duration) Options {
 	opts.UpdaterPollRate = updaterPollRate
@@ -157,6 +408,13 @@ func (opts Options) WithConfirmerPollRate(confirmerPollRate time.Duration) Optio
 	return opts
 }
 
+// WithConfirmerPendingWindow updates how long after their submission the
+// confirmer checks the confirmations of txs.
+func (opts Options) WithConfirmerPendingWindow(window time.Duration) Options {
+	opts.ConfirmerPendingWindow = window
+	return opts
+}
+
 // WithWatcherPollRate updates the watcher poll rate.
 func (opts Options) WithWatcherPollRate(watcherPollRate time.Duration) Options {
 	opts.WatcherPollRate = watcherPollRate
@@ -181,6 +439,93 @@ func (opts Options) WithTransactionExpiry(transactionExpiry time.Duration) Optio
 	return opts
 }
 
+// WithArchiveRetention updates how long pruned transactions are kept in the
+// archive before they are permanently deleted.
+func (opts Options) WithArchiveRetention(retention time.Duration) Options {
+	opts.ArchiveRetention = retention
+	return opts
+}
+
+// WithGatewayGracePeriod updates how long gateways remain valid after the
+// shard public key they were derived from has been retired. Gateways of
+// retired shards are reported as invalid by queryGateway. A grace period of
+// zero never invalidates gateways.
+func (opts Options) WithGatewayGracePeriod(grace time.Duration) Options {
+	opts.GatewayGracePeriod = grace
+	return opts
+}
+
+// WithPrunePolicy overrides the expiry of individual categories of rows when
+// pruning the database. Tx categories and burn events without their own expiry
+// use the transaction expiry, and gateways are only pruned if they have an expiry.
+func (opts Options) WithPrunePolicy(policy db.PrunePolicy) Options {
+	opts.PrunePolicy = policy
+	return opts
+}
+
+// WithPruneDryRun only logs the rows which would be pruned from the database,
+// rather than pruning them.
+func (opts Options) WithPruneDryRun(dryRun bool) Options {
+	opts.PruneDryRun = dryRun
+	return opts
+}
+
+// WithTokenCacheTTL updates how long token addresses used for compat
+// conversions are cached.
+func (opts Options) WithTokenCacheTTL(ttl time.Duration) Options {
+	opts.TokenCacheTTL = ttl
+	return opts
+}
+
+// WithBlockCacheSize updates the number of recently fetched RenVM blocks which
+// are cached in the database to serve queryBlock and queryBlocks requests.
+// Zero disables the block cache.
+func (opts Options) WithBlockCacheSize(size int) Options {
+	opts.BlockCacheSize = size
+	return opts
+}
+
+// WithWarmupTimeout updates how long the Lightnode waits for its caches to be
+// populated on startup before it starts serving requests. Zero disables the
+// warmup.
+func (opts Options) WithWarmupTimeout(timeout time.Duration) Options {
+	opts.WarmupTimeout = timeout
+	return opts
+}
+
+// WithCompatGCGracePeriod updates how long a compat mapping is kept before it
+// is removed for not having a corresponding transaction in the database.
+func (opts Options) WithCompatGCGracePeriod(gracePeriod time.Duration) Options {
+	opts.CompatGCGracePeriod = gracePeriod
+	return opts
+}
+
+// WithCompatBackend updates where compat mappings are stored: "redis", "sql",
+// or "migrating" to write them to both while reading them from SQL with a
+// fallback to Redis. Mappings can be migrated from Redis to SQL without
+// downtime by running in migrating mode, copying existing mappings with
+// cmd/migrate-compat, waiting until the divergence counters at
+// /compat/migration stop increasing, and then switching to SQL.
+func (opts Options) WithCompatBackend(backend string) Options {
+	opts.CompatBackend = backend
+	return opts
+}
+
+// WithUpstream runs the Lightnode in compat-only mode, where it only serves the
+// v0 and v1 compatibility layer and proxies all requests to the Lightnode at
+// the given URL rather than to the Darknodes. Burns are watched and txs are
+// confirmed by the upstream Lightnode. An empty URL disables the mode.
+func (opts Options) WithUpstream(url string) Options {
+	opts.UpstreamURL = url
+	return opts
+}
+
+// CompatOnly returns whether the Lightnode proxies requests to an upstream
+// Lightnode rather than to the Darknodes.
+func (opts Options) CompatOnly() bool {
+	return opts.UpstreamURL != ""
+}
+
 // WithBootstrapAddrs makes an initial list of nodes known to the node. These
 // nodes will be used to bootstrap into the P2P network.
 func (opts Options) WithBootstrapAddrs(bootstrapAddrs []wire.Address) Options {
@@ -194,6 +539,142 @@ func (opts Options) WithChains(chains map[multichain.Chain]binding.ChainOptions)
 	return opts
 }
 
+// WithFinalityTags is used to specify the block tag ("safe" or "finalized")
+// that should be used instead of confirmations for chains which support them.
+// Every chain must be a configured EVM chain.
+func (opts Options) WithFinalityTags(tags map[multichain.Chain]string) Options {
+	opts.FinalityTags = tags
+	return opts
+}
+
+// WithEVMChains configures the watchers of EVM chains. Fields which are left
+// zero fall back to the global watcher options, and the registry to the
+// protocol of the chain options. A registry which is given is used instead of
+// the protocol by the bindings of the chain.
+func (opts Options) WithEVMChains(configs map[multichain.Chain]watcher.ChainConfig) Options {
+	evmChains := make(map[multichain.Chain]watcher.ChainConfig, len(opts.EVMChains)+len(configs))
+	for chain, config := range opts.EVMChains {
+		evmChains[chain] = config
+	}
+	for chain, config := range configs {
+		evmChains[chain] = config
+	}
+	opts.EVMChains = evmChains
+	return opts
+}
+
+// WithHostChains adds EVM compatible host chains to the supported chains. It
+// must be called after WithChains, WithFinalityTags and WithEVMChains, which
+// replace the chains, tags and watcher configs set here.
+func (opts Options) WithHostChains(hostChains ...HostChain) Options {
+	chains := make(map[multichain.Chain]binding.ChainOptions, len(opts.Chains)+len(hostChains))
+	for chain, chainOpts := range opts.Chains {
+		chains[chain] = chainOpts
+	}
+	finalityTags := make(map[multichain.Chain]string, len(opts.FinalityTags))
+	for chain, tag := range opts.FinalityTags {
+		finalityTags[chain] = tag
+	}
+	evmChains := make(map[multichain.Chain]watcher.ChainConfig, len(opts.EVMChains)+len(hostChains))
+	for chain, config := range opts.EVMChains {
+		evmChains[chain] = config
+	}
+	for _, hostChain := range hostChains {
+		chains[hostChain.Chain] = hostChain.ChainOptions()
+		if hostChain.FinalityTag != "" {
+			finalityTags[hostChain.Chain] = hostChain.FinalityTag
+		}
+		evmChains[hostChain.Chain] = hostChain.WatcherConfig()
+	}
+	opts.Chains = chains
+	opts.FinalityTags = finalityTags
+	opts.EVMChains = evmChains
+	opts.HostChains = append(append([]HostChain{}, opts.HostChains...), hostChains...)
+	return opts
+}
+
+// WithMaxBurnAge rejects client-submitted burns which were included in a block
+// longer ago than the given duration. Zero disables the check.
+func (opts Options) WithMaxBurnAge(maxAge time.Duration) Options {
+	opts.MaxBurnAge = maxAge
+	return opts
+}
+
+// WithMaxBurnBlocks rejects client-submitted burns which are more than the
+// given number of blocks old on their host chain.
+func (opts Options) WithMaxBurnBlocks(maxBlocks map[multichain.Chain]uint64) Options {
+	opts.MaxBurnBlocks = maxBlocks
+	return opts
+}
+
+// WithBurnRecoveryURL sets the link to the manual recovery process which is
+// returned to users when their burn is too old to be submitted.
+func (opts Options) WithBurnRecoveryURL(url string) Options {
+	opts.BurnRecoveryURL = url
+	return opts
+}
+
+// WithPauseContract sets the governance contract which is polled to check
+// whether deposits of an asset have been paused. An empty address
+// disables pausing.
+func (opts Options) WithPauseContract(chain multichain.Chain, address string) Options {
+	opts.PauseChain = chain
+	opts.PauseContract = address
+	return opts
+}
+
+// WithPausePollRate updates how often the governance contract is polled.
+func (opts Options) WithPausePollRate(pollRate time.Duration) Options {
+	opts.PausePollRate = pollRate
+	return opts
+}
+
+// WithSubscriptionPollRate updates how often the status of txs subscribed to
+// over WebSocket is queried.
+func (opts Options) WithSubscriptionPollRate(pollRate time.Duration) Options {
+	opts.SubscriptionPollRate = pollRate
+	return opts
+}
+
+// WithSubscriptionOrigins updates the origins of the browsers which can
+// connect to the WebSocket endpoint, such as "https://app.example.com", or "*"
+// for any origin. Browsers on other origins than the Lightnode itself are
+// rejected by default.
+func (opts Options) WithSubscriptionOrigins(origins []string) Options {
+	opts.SubscriptionOrigins = origins
+	return opts
+}
+
+// WithSubscriptionConnLimits updates the maximum number of WebSocket
+// connections, in total and from each client. Zero disables either limit.
+func (opts Options) WithSubscriptionConnLimits(maxConns, maxConnsPerIP int) Options {
+	opts.SubscriptionMaxConns = maxConns
+	opts.SubscriptionMaxConnsPerIP = maxConnsPerIP
+	return opts
+}
+
+// WithEpochPollRate updates how often the block state is queried for changes
+// of epoch, which are pushed to WebSocket subscribers and epoch change hooks.
+func (opts Options) WithEpochPollRate(pollRate time.Duration) Options {
+	opts.EpochPollRate = pollRate
+	return opts
+}
+
+// WithChainIDCheckInterval updates how often the chain ID of each EVM RPC is
+// checked. RPCs for the wrong chain are checked on startup, and are not used
+// by the watchers until a check finds them fixed.
+func (opts Options) WithChainIDCheckInterval(interval time.Duration) Options {
+	opts.ChainIDCheckInterval = interval
+	return opts
+}
+
+// WithMaxClockSkew updates how far the host clock can drift from the clock
+// used for the times stored in the database before a warning is logged.
+func (opts Options) WithMaxClockSkew(skew time.Duration) Options {
+	opts.MaxClockSkew = skew
+	return opts
+}
+
 // WithWhitelist is used to whitelist certain selectors inside the Darknode.
 func (opts Options) WithWhitelist(whitelist []tx.Selector) Options {
 	opts.Whitelist = whitelist
@@ -224,8 +705,455 @@ func (opts Options) WithLimiterMaxClients(maxClients int) Options {
 	return opts
 }
 
+// WithLimiterIPLists sets the IPs and CIDR ranges which are never rate
+// limited, and those which are always rate limited. The lists can also be
+// changed at runtime through the /limiter admin endpoint.
+func (opts Options) WithLimiterIPLists(allowlist, denylist []string) Options {
+	opts.LimiterAllowlist = allowlist
+	opts.LimiterDenylist = denylist
+	return opts
+}
+
+// WithTrustedProxies sets the IPs and CIDR ranges of the load balancers in
+// front of the Lightnode. The x-forwarded-for header is only used to find the
+// IP of the client when the request comes from one of them, as anyone else
+// can set it to avoid rate limits.
+func (opts Options) WithTrustedProxies(trustedProxies []string) Options {
+	opts.TrustedProxies = trustedProxies
+	return opts
+}
+
+// WithSharedRateLimits enables counting requests in Redis, so that the rate
+// limits apply to all Lightnode replicas together. While Redis is unavailable,
+// each replica falls back to its own limits, with rates scaled down by the
+// degraded factor.
+func (opts Options) WithSharedRateLimits(shared bool, degradedFactor float64) Options {
+	opts.SharedRateLimits = shared
+	opts.LimiterDegradedFactor = degradedFactor
+	return opts
+}
+
+// WithAdmission enables shedding requests once more than the capacity of
+// requests per second are received. Requests of each tier are shed once their
+// share of the capacity is in use, so that anonymous requests are shed before
+// those of integrators with larger shares. Zero capacity disables shedding.
+func (opts Options) WithAdmission(capacity int, shares map[string]float64) Options {
+	opts.AdmissionCapacity = capacity
+	opts.AdmissionShares = shares
+	return opts
+}
+
+// WithAPIKeys sets the API keys with which integrators authenticate, mapped to
+// their tier.
+func (opts Options) WithAPIKeys(keys map[string]string) Options {
+	opts.APIKeys = keys
+	return opts
+}
+
 // WithMaxGatewayCount is used to set the max number of gateways that can be persisted
 func (opts Options) WithMaxGatewayCount(maxGatewayCount int) Options {
 	opts.MaxGatewayCount = maxGatewayCount
 	return opts
 }
+
+// WithDBBatchSize is used to set the maximum number of rows written by a
+// single batched insert into the database. Postgres limits a statement to
+// 65535 parameters, so this should not exceed 4000.
+func (opts Options) WithDBBatchSize(batchSize int) Options {
+	opts.DBBatchSize = batchSize
+	return opts
+}
+
+// WithWriteBehind acknowledges submitted txs once they have been queued for
+// writing to the database, rather than once they have been written. Queued
+// txs are appended to the journal at the given path, if any, so that they are
+// not lost on restart. A zero queue size disables write-behind.
+func (opts Options) WithWriteBehind(queueSize int, journal string) Options {
+	opts.WriteQueueSize = queueSize
+	opts.WriteJournal = journal
+	return opts
+}
+
+// WithLogger is used to set the logger used by the resolver, watchers and
+// updater, so that the Lightnode can be embedded in programs which use a
+// logging library other than logrus. If it is not set, they write to the
+// logrus logger passed to New.
+func (opts Options) WithLogger(logger logging.Logger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithConcurrency sets the maximum number of txs which are checked at once, and
+// the maximum number of requests which are dispatched to the Darknodes at once.
+// Requests beyond these limits wait for a free worker until they time out.
+func (opts Options) WithConcurrency(txChecker, dispatch int) Options {
+	opts.TxCheckerConcurrency = txChecker
+	opts.DispatchConcurrency = dispatch
+	return opts
+}
+
+// WithVerificationBudget limits how long verifying a submitted tx can take,
+// and how many txs are verified at once. Zero disables either limit.
+func (opts Options) WithVerificationBudget(timeout time.Duration, concurrency int) Options {
+	opts.VerificationTimeout = timeout
+	opts.VerificationConcurrency = concurrency
+	return opts
+}
+
+// WithVerificationCache caches the verdicts of up to size submitted txs, so
+// that resubmissions of a tx are not verified again. Acceptances are cached
+// for the ttl, and rejections for the rejection ttl. A zero size disables the
+// cache.
+func (opts Options) WithVerificationCache(size int, ttl, rejectionTTL time.Duration) Options {
+	opts.VerificationCacheSize = size
+	opts.VerificationCacheTTL = ttl
+	opts.VerificationRejectionTTL = rejectionTTL
+	return opts
+}
+
+// WithMaxPendingTxs rejects new submissions with a retry later error while
+// there are at least the given number of txs which have not yet been
+// submitted to the Darknodes. The number is counted at most once per
+// interval. A zero max disables the limit.
+func (opts Options) WithMaxPendingTxs(max int, interval time.Duration) Options {
+	opts.MaxPendingTxs = max
+	opts.PendingCountInterval = interval
+	return opts
+}
+
+// WithStrictDispatch rejects Darknode responses which have unknown or missing
+// fields, rather than passing them on to clients. It is intended for staging
+// environments, where it catches changes to the Darknode API early.
+func (opts Options) WithStrictDispatch(strict bool) Options {
+	opts.StrictDispatch = strict
+	return opts
+}
+
+// WithDispatchRetries retries requests which none of the Darknodes respond to,
+// failing over to other Darknodes if there are any. The wait between retries
+// starts at the base of the backoff and grows by its factor, up to its maximum.
+func (opts Options) WithDispatchRetries(retries int, backoff lhttp.RetryOptions) Options {
+	opts.DispatchRetries = retries
+	opts.DispatchBackoff = backoff
+	return opts
+}
+
+// WithCircuitBreakers stops requests from being sent to a Darknode once
+// threshold requests to it have failed in a row, until the cooldown has
+// passed. A threshold of zero disables circuit breaking.
+func (opts Options) WithCircuitBreakers(threshold int, cooldown time.Duration) Options {
+	opts.BreakerThreshold = threshold
+	opts.BreakerCooldown = cooldown
+	return opts
+}
+
+// WithDarknodeBudgets limits the requests sent to each Darknode to maxInFlight
+// requests at once, and to perMinute requests each minute, so that the load
+// is spread across the Darknodes. Zero disables either limit.
+func (opts Options) WithDarknodeBudgets(maxInFlight, perMinute int) Options {
+	opts.MaxInFlightPerDarknode = maxInFlight
+	opts.RequestsPerDarknodeRate = perMinute
+	return opts
+}
+
+// WithProxyOverrides overrides the proxies set in the environment for the
+// given hosts. Each host (e.g. "rpc.example.com") or domain (e.g.
+// ".example.com") maps to the URL of a proxy, or to "direct" to connect
+// without a proxy.
+func (opts Options) WithProxyOverrides(overrides map[string]string) Options {
+	opts.ProxyOverrides = overrides
+	return opts
+}
+
+// WithHooks sets the scripts and webhooks which are run when the Lightnode
+// detects a condition, such as losing quorum with the Darknodes. The chain down
+// condition is only detected once the RPC of the chain has been failing for
+// chainDownAfter.
+func (opts Options) WithHooks(hooks []hooks.Hook, chainDownAfter time.Duration) Options {
+	opts.Hooks = hooks
+	opts.HookChainDownAfter = chainDownAfter
+	return opts
+}
+
+// WithSlowLog records database queries and Darknode round trips which take
+// longer than the given thresholds, so that they can be inspected at
+// /debug/slowlog. A threshold of zero disables recording for that kind of
+// operation. Only one in every sampling slow operations is recorded.
+func (opts Options) WithSlowLog(dbThreshold, darknodeThreshold time.Duration, sampling int) Options {
+	opts.SlowDBThreshold = dbThreshold
+	opts.SlowDarknodeThreshold = darknodeThreshold
+	opts.SlowLogSampling = sampling
+	return opts
+}
+
+// WithHealthTimeout updates how long the dependencies of the Lightnode are
+// probed for by the /health and /ready endpoints before they are reported as
+// failed.
+func (opts Options) WithHealthTimeout(timeout time.Duration) Options {
+	opts.HealthTimeout = timeout
+	return opts
+}
+
+// WithRecovery re-queries burns which are stuck after an outage of the
+// Darknodes, once their block height advances after stalling for the given
+// downtime. Burns older than minAge are queried batchSize at a time, waiting
+// batchInterval between batches. A downtime of zero disables recovery.
+func (opts Options) WithRecovery(downtime, minAge time.Duration, batchSize int, batchInterval time.Duration) Options {
+	opts.RecoveryDowntime = downtime
+	opts.RecoveryMinAge = minAge
+	opts.RecoveryBatchSize = batchSize
+	opts.RecoveryBatchInterval = batchInterval
+	return opts
+}
+
+// Validate returns an error describing the first option which is out of range,
+// so that invalid configurations are rejected when the Lightnode starts rather
+// than misbehaving later.
+func (opts Options) Validate() error {
+	positiveInts := []struct {
+		name  string
+		value int
+	}{
+		{"cap", opts.Cap},
+		{"max batch size", opts.MaxBatchSize},
+		{"max page size", opts.MaxPageSize},
+		{"db batch size", opts.DBBatchSize},
+		{"txchecker concurrency", opts.TxCheckerConcurrency},
+		{"dispatch concurrency", opts.DispatchConcurrency},
+		{"recovery batch size", opts.RecoveryBatchSize},
+	}
+	for _, option := range positiveInts {
+		if option.value <= 0 {
+			return fmt.Errorf("%v must be positive, got %v", option.name, option.value)
+		}
+	}
+
+	nonNegativeInts := []struct {
+		name  string
+		value int
+	}{
+		{"max gateway count", opts.MaxGatewayCount},
+		{"write queue size", opts.WriteQueueSize},
+		{"block cache size", opts.BlockCacheSize},
+		{"limiter max clients", opts.LimiterMaxClients},
+		{"slow log sampling", opts.SlowLogSampling},
+		{"admission capacity", opts.AdmissionCapacity},
+		{"dispatch retries", opts.DispatchRetries},
+		{"breaker threshold", opts.BreakerThreshold},
+		{"max in flight per darknode", opts.MaxInFlightPerDarknode},
+		{"requests per darknode rate", opts.RequestsPerDarknodeRate},
+		{"verification concurrency", opts.VerificationConcurrency},
+		{"verification cache size", opts.VerificationCacheSize},
+		{"max pending txs", opts.MaxPendingTxs},
+		{"stream threshold", opts.StreamThreshold},
+		{"subscription max conns", opts.SubscriptionMaxConns},
+		{"subscription max conns per ip", opts.SubscriptionMaxConnsPerIP},
+	}
+	for _, option := range nonNegativeInts {
+		if option.value < 0 {
+			return fmt.Errorf("%v must not be negative, got %v", option.name, option.value)
+		}
+	}
+
+	// Intervals at which something is polled or timed out must be positive,
+	// whereas other durations use zero to disable a feature.
+	positiveDurations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server timeout", opts.ServerTimeout},
+		{"client timeout", opts.ClientTimeout},
+		{"updater poll rate", opts.UpdaterPollRate},
+		{"confirmer poll rate", opts.ConfirmerPollRate},
+		{"confirmer pending window", opts.ConfirmerPendingWindow},
+		{"watcher poll rate", opts.WatcherPollRate},
+		{"transaction expiry", opts.TransactionExpiry},
+		{"pause poll rate", opts.PausePollRate},
+		{"subscription poll rate", opts.SubscriptionPollRate},
+		{"epoch poll rate", opts.EpochPollRate},
+		{"chain id check interval", opts.ChainIDCheckInterval},
+		{"max clock skew", opts.MaxClockSkew},
+		{"limiter ttl", opts.LimiterTTL},
+		{"health timeout", opts.HealthTimeout},
+	}
+	for _, option := range positiveDurations {
+		if option.value <= 0 {
+			return fmt.Errorf("%v must be positive, got %v", option.name, option.value)
+		}
+	}
+
+	nonNegativeDurations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"ttl", opts.TTL},
+		{"cache revalidate after", opts.CacheRevalidateAfter},
+		{"compat gc grace period", opts.CompatGCGracePeriod},
+		{"archive retention", opts.ArchiveRetention},
+		{"gateway grace period", opts.GatewayGracePeriod},
+		{"prune done expiry", opts.PrunePolicy.Done},
+		{"prune unconfirmed expiry", opts.PrunePolicy.Unconfirmed},
+		{"prune gateway expiry", opts.PrunePolicy.Gateways},
+		{"prune burn event expiry", opts.PrunePolicy.BurnEvents},
+		{"prune client expiry", opts.PrunePolicy.Clients},
+		{"token cache ttl", opts.TokenCacheTTL},
+		{"warmup timeout", opts.WarmupTimeout},
+		{"max burn age", opts.MaxBurnAge},
+		{"http read header timeout", opts.HTTPServer.ReadHeaderTimeout},
+		{"http read timeout", opts.HTTPServer.ReadTimeout},
+		{"http write timeout", opts.HTTPServer.WriteTimeout},
+		{"http idle timeout", opts.HTTPServer.IdleTimeout},
+		{"http shutdown timeout", opts.HTTPServer.ShutdownTimeout},
+		{"hook chain down after", opts.HookChainDownAfter},
+		{"slow db threshold", opts.SlowDBThreshold},
+		{"slow darknode threshold", opts.SlowDarknodeThreshold},
+		{"dispatch backoff base", opts.DispatchBackoff.Base},
+		{"breaker cooldown", opts.BreakerCooldown},
+		{"recovery downtime", opts.RecoveryDowntime},
+		{"recovery min age", opts.RecoveryMinAge},
+		{"recovery batch interval", opts.RecoveryBatchInterval},
+		{"verification timeout", opts.VerificationTimeout},
+		{"verification cache ttl", opts.VerificationCacheTTL},
+		{"verification rejection ttl", opts.VerificationRejectionTTL},
+		{"pending count interval", opts.PendingCountInterval},
+	}
+	for _, option := range nonNegativeDurations {
+		if option.value < 0 {
+			return fmt.Errorf("%v must not be negative, got %v", option.name, option.value)
+		}
+	}
+	if opts.DispatchBackoff.Max < opts.DispatchBackoff.Base {
+		return fmt.Errorf("dispatch backoff max must be at least %v, got %v", opts.DispatchBackoff.Base, opts.DispatchBackoff.Max)
+	}
+	if opts.DispatchBackoff.Factor < 0 {
+		return fmt.Errorf("dispatch backoff factor must not be negative, got %v", opts.DispatchBackoff.Factor)
+	}
+	if err := opts.limiterConf().Validate(); err != nil {
+		return fmt.Errorf("limiter: %v", err)
+	}
+	if _, err := lhttp.ParseIPNets(opts.TrustedProxies); err != nil {
+		return fmt.Errorf("trusted proxies: %v", err)
+	}
+	for _, origin := range opts.SubscriptionOrigins {
+		if err := resolver.ValidateOrigin(origin); err != nil {
+			return fmt.Errorf("subscription origins: %v", err)
+		}
+	}
+	if opts.LimiterDegradedFactor <= 0 || opts.LimiterDegradedFactor > 1 {
+		return fmt.Errorf("limiter degraded factor must be in (0, 1], got %v", opts.LimiterDegradedFactor)
+	}
+	if err := opts.admissionConf().Validate(); err != nil {
+		return fmt.Errorf("admission: %v", err)
+	}
+	for method, ttl := range opts.CacheTTLs {
+		if ttl <= 0 {
+			return fmt.Errorf("cache ttl of %v must be positive, got %v", method, ttl)
+		}
+	}
+	for chain, config := range opts.EVMChains {
+		if config.BlockTime < 0 {
+			return fmt.Errorf("block time of %v must not be negative, got %v", chain, config.BlockTime)
+		}
+	}
+	for chain := range opts.FinalityTags {
+		if _, ok := opts.Chains[chain]; !ok {
+			return fmt.Errorf("finality tag for %v, which is not a configured chain", chain)
+		}
+		if !opts.isEVMChain(chain) {
+			return fmt.Errorf("finality tag for %v, which is not an evm chain", chain)
+		}
+	}
+
+	switch opts.CompatBackend {
+	case v0.BackendRedis, v0.BackendSQL, v0.BackendMigrating:
+	default:
+		return fmt.Errorf("unknown compat backend %q", opts.CompatBackend)
+	}
+	if opts.CompatOnly() {
+		u, err := url.Parse(opts.UpstreamURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			return fmt.Errorf("invalid upstream url %q", opts.UpstreamURL)
+		}
+	}
+	if opts.GRPCPort != "" && opts.GRPCPort == opts.Port {
+		return fmt.Errorf("grpc port %v is already used by the json-rpc api", opts.GRPCPort)
+	}
+	if _, err := lhttp.NewProxies(opts.ProxyOverrides); err != nil {
+		return fmt.Errorf("proxy overrides: %v", err)
+	}
+	for _, hook := range opts.Hooks {
+		if err := hook.Validate(); err != nil {
+			return fmt.Errorf("hooks: %v", err)
+		}
+	}
+	return nil
+}
+
+// limiterConf returns the configuration of the rate limiter.
+func (opts Options) limiterConf() resolver.RateLimiterConf {
+	return resolver.RateLimiterConf{
+		GlobalMethodRate: opts.LimiterGlobalRates,
+		IpMethodRate:     opts.LimiterIPRates,
+		Ttl:              opts.LimiterTTL,
+		MaxClients:       opts.LimiterMaxClients,
+		Allowlist:        opts.LimiterAllowlist,
+		Denylist:         opts.LimiterDenylist,
+	}
+}
+
+// isEVMChain returns whether the chain is an EVM chain, either one supported by
+// default on any network or one with a watcher configuration.
+func (opts Options) isEVMChain(chain multichain.Chain) bool {
+	if _, ok := opts.EVMChains[chain]; ok {
+		return true
+	}
+	for _, chainIDs := range EVMChainIDs {
+		if _, ok := chainIDs[chain]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EVMChainConfig returns the configuration of the watchers of the EVM chain,
+// with the fields which are not configured for the chain filled in from the
+// global watcher options, and the registry from the chain options.
+func (opts Options) EVMChainConfig(chain multichain.Chain) watcher.ChainConfig {
+	config := opts.EVMChains[chain]
+	if config.Registry == "" {
+		config.Registry = string(opts.Chains[chain].Protocol)
+	}
+	if config.ConfidenceInterval == 0 {
+		config.ConfidenceInterval = opts.WatcherConfidenceInterval
+	}
+	if config.BlockTime == 0 {
+		config.BlockTime = opts.WatcherPollRate
+	}
+	if config.MaxLogRange == 0 {
+		config.MaxLogRange = opts.WatcherMaxBlockAdvance
+	}
+	return config
+}
+
+// BindingChains returns the chain options from which the bindings are built.
+// The protocol of an EVM chain which configures its own registry is replaced
+// by that registry.
+func (opts Options) BindingChains() map[multichain.Chain]binding.ChainOptions {
+	chains := make(map[multichain.Chain]binding.ChainOptions, len(opts.Chains))
+	for chain, chainOpts := range opts.Chains {
+		if config, ok := opts.EVMChains[chain]; ok && config.Registry != "" {
+			chainOpts.Protocol = pack.String(config.Registry)
+		}
+		chains[chain] = chainOpts
+	}
+	return chains
+}
+
+// admissionConf returns the configuration of the admission controller.
+func (opts Options) admissionConf() resolver.AdmissionConf {
+	return resolver.AdmissionConf{
+		Capacity: float64(opts.AdmissionCapacity),
+		Shares:   opts.AdmissionShares,
+		APIKeys:  opts.APIKeys,
+	}
+}
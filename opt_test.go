@@ -1 +1,116 @@
 package lightnode_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode"
+
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/hooks"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+	"golang.org/x/time/rate"
+)
+
+var _ = Describe("Options", func() {
+	It("should accept the default options", func() {
+		Expect(DefaultOptions().Validate()).To(Succeed())
+	})
+
+	It("should reject options which are out of range", func() {
+		for _, options := range []Options{
+			DefaultOptions().WithCap(0),
+			DefaultOptions().WithMaxPageSize(-1),
+			DefaultOptions().WithStreamThreshold(-1),
+			DefaultOptions().WithConcurrency(0, 1),
+			DefaultOptions().WithBlockCacheSize(-1),
+			DefaultOptions().WithServerTimeout(0),
+			DefaultOptions().WithWatcherPollRate(-time.Second),
+			DefaultOptions().WithEpochPollRate(0),
+			DefaultOptions().WithChainIDCheckInterval(0),
+			DefaultOptions().WithMaxClockSkew(0),
+			DefaultOptions().WithConfirmerPendingWindow(0),
+			DefaultOptions().WithPrunePolicy(db.PrunePolicy{Done: -time.Hour}),
+			DefaultOptions().WithCacheTTLs(map[string]time.Duration{"ren_queryBlockState": 0}),
+			DefaultOptions().WithCompatBackend("postgres"),
+			DefaultOptions().WithGRPCPort(DefaultPort),
+			DefaultOptions().WithUpstream("lightnode:5000"),
+			DefaultOptions().WithLimiterIPLists([]string{"10.0.0.0/33"}, nil),
+			DefaultOptions().WithTrustedProxies([]string{"load-balancer"}),
+			DefaultOptions().WithLimiterGlobalRates(map[string]rate.Limit{"ren_submitTx": 10}),
+			DefaultOptions().WithHealthTimeout(0),
+			DefaultOptions().WithHTTPServer(lhttp.ServerOptions{IdleTimeout: -time.Second}),
+			DefaultOptions().WithDispatchRetries(-1, lhttp.DefaultRetryOptions),
+			DefaultOptions().WithDispatchRetries(1, lhttp.RetryOptions{Base: time.Second, Max: time.Millisecond}),
+			DefaultOptions().WithCircuitBreakers(-1, time.Minute),
+			DefaultOptions().WithDarknodeBudgets(-1, 0),
+			DefaultOptions().WithSharedRateLimits(true, 0),
+			DefaultOptions().WithSharedRateLimits(true, 1.5),
+			DefaultOptions().WithDarknodeBudgets(0, -1),
+			DefaultOptions().WithRecovery(time.Minute, time.Minute, 0, time.Second),
+			DefaultOptions().WithVerificationBudget(-time.Second, 1),
+			DefaultOptions().WithVerificationCache(-1, time.Minute, time.Second),
+			DefaultOptions().WithMaxPendingTxs(-1, time.Second),
+			DefaultOptions().WithMaxPendingTxs(100, -time.Second),
+			DefaultOptions().WithProxyOverrides(map[string]string{"example.com": "proxy.example.com:3128"}),
+			DefaultOptions().WithHooks([]hooks.Hook{{Condition: "unknown", Target: "/opt/hook.sh"}}, time.Minute),
+			DefaultOptions().WithEVMChains(map[multichain.Chain]watcher.ChainConfig{multichain.Polygon: {BlockTime: -time.Second}}),
+			DefaultOptions().WithFinalityTags(map[multichain.Chain]string{multichain.Polygon: "finalized"}),
+			DefaultOptions().
+				WithChains(map[multichain.Chain]binding.ChainOptions{multichain.Solana: {RPC: "https://solana.example.com"}}).
+				WithFinalityTags(map[multichain.Chain]string{multichain.Solana: "finalized"}),
+		} {
+			Expect(options.Validate()).NotTo(Succeed())
+		}
+	})
+
+	It("should replace the registry of evm chains which configure one", func() {
+		chains := map[multichain.Chain]binding.ChainOptions{
+			multichain.Ethereum: {RPC: "https://ethereum.example.com", Protocol: "0x1"},
+			multichain.Polygon:  {RPC: "https://polygon.example.com", Protocol: "0x2"},
+		}
+		options := DefaultOptions().WithChains(chains).WithEVMChains(map[multichain.Chain]watcher.ChainConfig{
+			multichain.Ethereum: {ConfidenceInterval: 12},
+			multichain.Polygon:  {Registry: "0x3", BlockTime: 2 * time.Second},
+		})
+		Expect(options.Validate()).To(Succeed())
+		bindingChains := options.BindingChains()
+		Expect(bindingChains[multichain.Ethereum].Protocol).To(Equal(pack.String("0x1")))
+		Expect(bindingChains[multichain.Polygon].Protocol).To(Equal(pack.String("0x3")))
+		Expect(bindingChains[multichain.Polygon].RPC).To(Equal(pack.String("https://polygon.example.com")))
+		Expect(options.EVMChains).To(HaveLen(2))
+
+		// The configured chains are not modified.
+		Expect(options.Chains[multichain.Polygon].Protocol).To(Equal(pack.String("0x2")))
+		Expect(chains[multichain.Polygon].Protocol).To(Equal(pack.String("0x2")))
+	})
+
+	It("should fill in the watcher configs of evm chains from the global options", func() {
+		options := DefaultOptions().
+			WithChains(map[multichain.Chain]binding.ChainOptions{
+				multichain.Ethereum: {RPC: "https://ethereum.example.com", Protocol: "0x1"},
+				multichain.Polygon:  {RPC: "https://polygon.example.com", Protocol: "0x2"},
+			}).
+			WithWatcherConfidenceInterval(6).
+			WithEVMChains(map[multichain.Chain]watcher.ChainConfig{
+				multichain.Polygon: {Registry: "0x3", ConfidenceInterval: 128, MaxLogRange: 500},
+			})
+
+		ethereum := options.EVMChainConfig(multichain.Ethereum)
+		Expect(ethereum.Registry).To(Equal("0x1"))
+		Expect(ethereum.ConfidenceInterval).To(Equal(uint64(6)))
+		Expect(ethereum.BlockTime).To(Equal(options.WatcherPollRate))
+		Expect(ethereum.MaxLogRange).To(Equal(options.WatcherMaxBlockAdvance))
+
+		polygon := options.EVMChainConfig(multichain.Polygon)
+		Expect(polygon.Registry).To(Equal("0x3"))
+		Expect(polygon.ConfidenceInterval).To(Equal(uint64(128)))
+		Expect(polygon.BlockTime).To(Equal(options.WatcherPollRate))
+		Expect(polygon.MaxLogRange).To(Equal(uint64(500)))
+	})
+})
@@ -0,0 +1,170 @@
+// Package pause tracks the assets which have been paused by governance, so
+// that the Lightnode can stop accepting deposits of them without being
+// redeployed.
+package pause
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/renproject/multichain"
+	"github.com/sirupsen/logrus"
+)
+
+// A Source returns whether an asset has been paused, and the reason given by
+// governance for pausing it.
+type Source interface {
+	Paused(ctx context.Context, asset multichain.Asset) (bool, string, error)
+}
+
+// contractABI is the interface of the governance contract. Governance calls
+// the contract to pause an asset and sets the reason shown to users.
+const contractABI = `[{"inputs":[{"internalType":"string","name":"asset","type":"string"}],"name":"paused","outputs":[{"internalType":"bool","name":"","type":"bool"},{"internalType":"string","name":"reason","type":"string"}],"stateMutability":"view","type":"function"}]`
+
+type contractSource struct {
+	contract *bind.BoundContract
+}
+
+// NewContractSource returns a Source which reads the pause state from the
+// governance contract at the given address.
+func NewContractSource(caller bind.ContractCaller, address common.Address) (Source, error) {
+	parsed, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		return nil, fmt.Errorf("parsing governance abi: %v", err)
+	}
+	return contractSource{
+		contract: bind.NewBoundContract(address, parsed, caller, nil, nil),
+	}, nil
+}
+
+func (source contractSource) Paused(ctx context.Context, asset multichain.Asset) (bool, string, error) {
+	var out []interface{}
+	if err := source.contract.Call(&bind.CallOpts{Context: ctx}, &out, "paused", string(asset)); err != nil {
+		return false, "", err
+	}
+	if len(out) != 2 {
+		return false, "", fmt.Errorf("unexpected output %v", out)
+	}
+	paused, ok := out[0].(bool)
+	if !ok {
+		return false, "", fmt.Errorf("unexpected paused value %v", out[0])
+	}
+	reason, ok := out[1].(string)
+	if !ok {
+		return false, "", fmt.Errorf("unexpected reason value %v", out[1])
+	}
+	return paused, reason, nil
+}
+
+// Status is the pause state of an asset.
+type Status struct {
+	Asset  multichain.Asset `json:"asset"`
+	Paused bool             `json:"paused"`
+	Reason string           `json:"reason,omitempty"`
+}
+
+// Pauser periodically reads the pause state of the assets supported by the
+// Lightnode from a Source.
+type Pauser struct {
+	logger   logrus.FieldLogger
+	source   Source
+	interval time.Duration
+
+	mu       *sync.RWMutex
+	statuses map[multichain.Asset]Status
+}
+
+// NewPauser returns a Pauser for the given assets. A nil source never pauses
+// any assets.
+func NewPauser(logger logrus.FieldLogger, source Source, assets []multichain.Asset, interval time.Duration) *Pauser {
+	statuses := make(map[multichain.Asset]Status, len(assets))
+	for _, asset := range assets {
+		statuses[asset] = Status{Asset: asset}
+	}
+	return &Pauser{
+		logger:   logger,
+		source:   source,
+		interval: interval,
+		mu:       new(sync.RWMutex),
+		statuses: statuses,
+	}
+}
+
+// Run updates the pause state every interval until the context is done.
+func (pauser *Pauser) Run(ctx context.Context) {
+	if pauser.source == nil {
+		return
+	}
+
+	ticker := time.NewTicker(pauser.interval)
+	defer ticker.Stop()
+
+	for {
+		pauser.Update(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update reads the pause state of each asset from the source. If the state of
+// an asset cannot be read, its previous state is kept.
+func (pauser *Pauser) Update(ctx context.Context) {
+	if pauser.source == nil {
+		return
+	}
+
+	for _, status := range pauser.Statuses() {
+		paused, reason, err := pauser.source.Paused(ctx, status.Asset)
+		if err != nil {
+			pauser.logger.Warnf("[pauser] cannot get pause state of %v: %v", status.Asset, err)
+			continue
+		}
+		if !paused {
+			reason = ""
+		}
+		if paused != status.Paused || reason != status.Reason {
+			if paused {
+				pauser.logger.Warnf("[pauser] %v paused: %v", status.Asset, reason)
+			} else {
+				pauser.logger.Infof("[pauser] %v unpaused", status.Asset)
+			}
+		}
+
+		pauser.mu.Lock()
+		pauser.statuses[status.Asset] = Status{Asset: status.Asset, Paused: paused, Reason: reason}
+		pauser.mu.Unlock()
+	}
+}
+
+// Paused returns whether the asset is paused, and the reason for pausing it.
+func (pauser *Pauser) Paused(asset multichain.Asset) (bool, string) {
+	pauser.mu.RLock()
+	defer pauser.mu.RUnlock()
+	status := pauser.statuses[asset]
+	return status.Paused, status.Reason
+}
+
+// Statuses returns the pause state of all assets, sorted by asset.
+func (pauser *Pauser) Statuses() []Status {
+	pauser.mu.RLock()
+	defer pauser.mu.RUnlock()
+	statuses := make([]Status, 0, len(pauser.statuses))
+	for _, status := range pauser.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Asset < statuses[j].Asset
+	})
+	return statuses
+}
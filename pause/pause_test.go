@@ -0,0 +1,74 @@
+package pause_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/pause"
+
+	"github.com/renproject/multichain"
+	"github.com/sirupsen/logrus"
+)
+
+type mockSource struct {
+	paused map[multichain.Asset]string
+	err    error
+}
+
+func (source *mockSource) Paused(ctx context.Context, asset multichain.Asset) (bool, string, error) {
+	if source.err != nil {
+		return false, "", source.err
+	}
+	reason, ok := source.paused[asset]
+	return ok, reason, nil
+}
+
+var _ = Describe("Pauser", func() {
+	assets := []multichain.Asset{multichain.ZEC, multichain.BTC}
+
+	It("should track the assets paused by the source", func() {
+		source := &mockSource{paused: map[multichain.Asset]string{multichain.BTC: "incident"}}
+		pauser := NewPauser(logrus.New(), source, assets, time.Minute)
+
+		// Assets are not paused until the source has been read.
+		paused, _ := pauser.Paused(multichain.BTC)
+		Expect(paused).To(BeFalse())
+
+		pauser.Update(context.Background())
+		paused, reason := pauser.Paused(multichain.BTC)
+		Expect(paused).To(BeTrue())
+		Expect(reason).To(Equal("incident"))
+		Expect(pauser.Statuses()).To(Equal([]Status{
+			{Asset: multichain.BTC, Paused: true, Reason: "incident"},
+			{Asset: multichain.ZEC},
+		}))
+
+		source.paused = map[multichain.Asset]string{}
+		pauser.Update(context.Background())
+		paused, reason = pauser.Paused(multichain.BTC)
+		Expect(paused).To(BeFalse())
+		Expect(reason).To(BeEmpty())
+	})
+
+	It("should keep the previous state if the source cannot be read", func() {
+		source := &mockSource{paused: map[multichain.Asset]string{multichain.ZEC: "incident"}}
+		pauser := NewPauser(logrus.New(), source, assets, time.Minute)
+		pauser.Update(context.Background())
+
+		source.err = errors.New("unavailable")
+		pauser.Update(context.Background())
+		paused, reason := pauser.Paused(multichain.ZEC)
+		Expect(paused).To(BeTrue())
+		Expect(reason).To(Equal("incident"))
+	})
+
+	It("should not pause assets without a source", func() {
+		pauser := NewPauser(logrus.New(), nil, assets, time.Minute)
+		pauser.Update(context.Background())
+		paused, _ := pauser.Paused(multichain.BTC)
+		Expect(paused).To(BeFalse())
+	})
+})
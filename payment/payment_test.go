@@ -0,0 +1,132 @@
+package payment_test
+
+import (
+	"image"
+	"image/color"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/payment"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/renproject/multichain"
+)
+
+// decodeQR renders the QR code with a quiet zone and decodes it with the
+// ZXing decoder.
+func decodeQR(qr *QR) (string, error) {
+	const scale, border = 4, 4
+	size := (qr.Size + 2*border) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			row, col := y/scale-border, x/scale-border
+			dark := row >= 0 && col >= 0 && row < qr.Size && col < qr.Size && qr.Modules[row][col]
+			if dark {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+	// The symbol is rendered without any distortion, so the decoder does not
+	// need to locate it in the image.
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_PURE_BARCODE: true}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, hints)
+	if err != nil {
+		return "", err
+	}
+	return result.GetText(), nil
+}
+
+var _ = Describe("Payment", func() {
+	Context("when building payment uris", func() {
+		It("should use the scheme of the origin chain", func() {
+			uri, err := URI(multichain.BTC, "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uri).To(Equal("bitcoin:1BoatSLRHtKNngkdXEeobR76b53LETtpyT"))
+
+			uri, err = URI(multichain.ZEC, "t1syl7g6fypnv2ykixojpfjaxdpoqpmqgpodaojsa", "0.25")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uri).To(Equal("zcash:t1syl7g6fypnv2ykixojpfjaxdpoqpmqgpodaojsa?amount=0.25"))
+		})
+
+		It("should not duplicate a scheme prefix in the address", func() {
+			uri, err := URI(multichain.BCH, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uri).To(Equal("bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"))
+		})
+
+		It("should reject invalid requests", func() {
+			_, err := URI(multichain.FIL, "t1syl7g6fypnv2ykixojpfjaxdpoqpmqgpodaojsa", "")
+			Expect(err).To(HaveOccurred())
+			_, err = URI(multichain.BTC, "", "")
+			Expect(err).To(HaveOccurred())
+			_, err = URI(multichain.BTC, "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "1e5")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when encoding qr codes", func() {
+		It("should use the smallest version which fits", func() {
+			qr, err := EncodeQR("bitcoin:1BoatSLRHtKNngkdXEeobR76b53LETtpyT")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(qr.Version).To(Equal(3))
+			Expect(qr.Size).To(Equal(29))
+			Expect(qr.Modules).To(HaveLen(29))
+
+			qr, err = EncodeQR(strings.Repeat("a", 213))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(qr.Version).To(Equal(10))
+
+			_, err = EncodeQR(strings.Repeat("a", 214))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should draw the finder patterns and dark module", func() {
+			qr, err := EncodeQR("zcash:t1syl7g6fypnv2ykixojpfjaxdpoqpmqgpodaojsa")
+			Expect(err).NotTo(HaveOccurred())
+			for _, corner := range [][2]int{{0, 0}, {0, qr.Size - 7}, {qr.Size - 7, 0}} {
+				for i := 0; i < 7; i++ {
+					Expect(qr.Modules[corner[0]][corner[1]+i]).To(BeTrue())
+					Expect(qr.Modules[corner[0]+i][corner[1]]).To(BeTrue())
+					Expect(qr.Modules[corner[0]+6][corner[1]+i]).To(BeTrue())
+				}
+			}
+			Expect(qr.Modules[qr.Size-8][8]).To(BeTrue())
+		})
+
+		It("should be decoded by a standard decoder", func() {
+			uri, err := URI(multichain.BCH, "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", "0.25")
+			Expect(err).NotTo(HaveOccurred())
+			// Cover every version, and therefore every block structure.
+			texts := []string{uri}
+			for n := 1; n <= 213; n += 7 {
+				texts = append(texts, strings.Repeat(uri, 4)[:n])
+			}
+			versions := map[int]bool{}
+			for _, text := range texts {
+				qr, err := EncodeQR(text)
+				Expect(err).NotTo(HaveOccurred())
+				versions[qr.Version] = true
+				Expect(decodeQR(qr)).To(Equal(text))
+			}
+			Expect(versions).To(HaveLen(10))
+		})
+
+		It("should render as svg", func() {
+			qr, err := EncodeQR("bitcoin:1BoatSLRHtKNngkdXEeobR76b53LETtpyT")
+			Expect(err).NotTo(HaveOccurred())
+			svg := qr.SVG()
+			Expect(svg).To(HavePrefix("<svg"))
+			Expect(svg).To(ContainSubstring(`viewBox="0 0 37 37"`))
+			Expect(svg).To(HaveSuffix("</svg>"))
+		})
+	})
+})
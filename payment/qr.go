@@ -0,0 +1,489 @@
+package payment
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QR is a QR code symbol. Modules are indexed by row and then column, with
+// true representing a dark module.
+type QR struct {
+	Version int
+	Size    int
+	Modules [][]bool
+
+	isFunction [][]bool
+}
+
+// qrVersion describes the error correction block structure of a QR code
+// version at error correction level M, which is the only level used.
+type qrVersion struct {
+	ecPerBlock int
+	blocks     []int // Number of data codewords in each block.
+	alignment  []int // Centres of the alignment patterns.
+}
+
+// qrVersions lists versions 1 to 10, which holds up to 213 bytes and is more
+// than enough for payment URIs.
+var qrVersions = []qrVersion{
+	{10, []int{16}, nil},
+	{16, []int{28}, []int{6, 18}},
+	{26, []int{44}, []int{6, 22}},
+	{18, []int{32, 32}, []int{6, 26}},
+	{24, []int{43, 43}, []int{6, 30}},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+func (v qrVersion) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// EncodeQR encodes the text into the smallest QR code that can hold it, using
+// byte mode and error correction level M.
+func EncodeQR(text string) (*QR, error) {
+	data := []byte(text)
+	for i, v := range qrVersions {
+		version := i + 1
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*v.dataCodewords() {
+			continue
+		}
+
+		bits := qrBits{}
+		bits.append(0x4, 4) // Byte mode
+		bits.append(len(data), countBits)
+		for _, b := range data {
+			bits.append(int(b), 8)
+		}
+		capacity := 8 * v.dataCodewords()
+		terminator := capacity - len(bits)
+		if terminator > 4 {
+			terminator = 4
+		}
+		bits.append(0, terminator)
+		bits.append(0, (8-len(bits)%8)%8)
+		for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+			bits.append(pad, 8)
+		}
+
+		qr := newQR(version)
+		qr.drawFunctionPatterns()
+		qr.drawCodewords(v.interleave(bits.bytes()))
+		qr.applyBestMask()
+		return qr, nil
+	}
+	return nil, fmt.Errorf("text of %v bytes is too long for a qr code", len(data))
+}
+
+// SVG renders the QR code as an SVG image, with each module drawn as a unit
+// square and surrounded by the standard quiet zone of four modules.
+func (qr *QR) SVG() string {
+	const border = 4
+	size := qr.Size + 2*border
+
+	path := new(strings.Builder)
+	for row := range qr.Modules {
+		for col, dark := range qr.Modules[row] {
+			if dark {
+				fmt.Fprintf(path, "M%d,%dh1v1h-1z", col+border, row+border)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#ffffff"/><path d="%s" fill="#000000"/></svg>`, size, size, path.String())
+}
+
+func newQR(version int) *QR {
+	size := 17 + 4*version
+	qr := &QR{
+		Version:    version,
+		Size:       size,
+		Modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+	for i := range qr.Modules {
+		qr.Modules[i] = make([]bool, size)
+		qr.isFunction[i] = make([]bool, size)
+	}
+	return qr
+}
+
+func (qr *QR) setFunction(row, col int, dark bool) {
+	qr.Modules[row][col] = dark
+	qr.isFunction[row][col] = true
+}
+
+func (qr *QR) drawFunctionPatterns() {
+	for i := 0; i < qr.Size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinder(3, 3)
+	qr.drawFinder(3, qr.Size-4)
+	qr.drawFinder(qr.Size-4, 3)
+
+	alignment := qrVersions[qr.Version-1].alignment
+	last := len(alignment) - 1
+	for i := range alignment {
+		for j := range alignment {
+			// Skip the positions which overlap with the finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			qr.drawAlignment(alignment[i], alignment[j])
+		}
+	}
+
+	// Reserve the format information, it is drawn again once the mask is
+	// chosen.
+	qr.drawFormat(0)
+	qr.drawVersion()
+}
+
+func (qr *QR) drawFinder(row, col int) {
+	for dr := -4; dr <= 4; dr++ {
+		for dc := -4; dc <= 4; dc++ {
+			r, c := row+dr, col+dc
+			if r < 0 || r >= qr.Size || c < 0 || c >= qr.Size {
+				continue
+			}
+			dist := maxInt(abs(dr), abs(dc))
+			qr.setFunction(r, c, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (qr *QR) drawAlignment(row, col int) {
+	for dr := -2; dr <= 2; dr++ {
+		for dc := -2; dc <= 2; dc++ {
+			qr.setFunction(row+dr, col+dc, maxInt(abs(dr), abs(dc)) != 1)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information for error
+// correction level M and the given mask.
+func (qr *QR) drawFormat(mask int) {
+	data := mask // Level M is encoded as 00.
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(i, 8, bit(bits, i))
+	}
+	qr.setFunction(7, 8, bit(bits, 6))
+	qr.setFunction(8, 8, bit(bits, 7))
+	qr.setFunction(8, 7, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(8, 14-i, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(8, qr.Size-1-i, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(qr.Size-15+i, 8, bit(bits, i))
+	}
+	qr.setFunction(qr.Size-8, 8, true)
+}
+
+// drawVersion draws both copies of the version information, which is only
+// present from version 7.
+func (qr *QR) drawVersion() {
+	if qr.Version < 7 {
+		return
+	}
+	rem := qr.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := qr.Size-11+i%3, i/3
+		qr.setFunction(b, a, bit(bits, i))
+		qr.setFunction(a, b, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order defined by the
+// standard, skipping over function patterns.
+func (qr *QR) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				col := right - j
+				row := vert
+				if (right+1)&2 == 0 {
+					row = qr.Size - 1 - vert
+				}
+				if !qr.isFunction[row][col] && i < 8*len(codewords) {
+					qr.Modules[row][col] = bit(int(codewords[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyBestMask applies each of the masks in turn and keeps the one with the
+// lowest penalty.
+func (qr *QR) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormat(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // Masks are undone by applying them again.
+	}
+	qr.applyMask(best)
+	qr.drawFormat(best)
+}
+
+func (qr *QR) applyMask(mask int) {
+	for r := 0; r < qr.Size; r++ {
+		for c := 0; c < qr.Size; c++ {
+			if qr.isFunction[r][c] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (r+c)%2 == 0
+			case 1:
+				invert = r%2 == 0
+			case 2:
+				invert = c%3 == 0
+			case 3:
+				invert = (r+c)%3 == 0
+			case 4:
+				invert = (r/2+c/3)%2 == 0
+			case 5:
+				invert = r*c%2+r*c%3 == 0
+			case 6:
+				invert = (r*c%2+r*c%3)%2 == 0
+			case 7:
+				invert = ((r+c)%2+r*c%3)%2 == 0
+			}
+			qr.Modules[r][c] = qr.Modules[r][c] != invert
+		}
+	}
+}
+
+// penalty scores the symbol using the four rules of the standard, a lower
+// score being easier for scanners to read.
+func (qr *QR) penalty() int {
+	penalty := 0
+	at := func(r, c int, transpose bool) bool {
+		if transpose {
+			return qr.Modules[c][r]
+		}
+		return qr.Modules[r][c]
+	}
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	for _, transpose := range []bool{false, true} {
+		for r := 0; r < qr.Size; r++ {
+			// Runs of five or more modules of the same colour.
+			run := 1
+			for c := 1; c < qr.Size; c++ {
+				if at(r, c, transpose) == at(r, c-1, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+
+			// Patterns which look like finders, with four light modules on
+			// either side.
+			for c := 0; c+7 <= qr.Size; c++ {
+				matches := true
+				for k, dark := range finderLike {
+					if at(r, c+k, transpose) != dark {
+						matches = false
+						break
+					}
+				}
+				if !matches {
+					continue
+				}
+				if qr.lightRun(r, c-4, c, transpose) || qr.lightRun(r, c+7, c+11, transpose) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	// Blocks of 2x2 modules of the same colour.
+	dark := 0
+	for r := 0; r < qr.Size; r++ {
+		for c := 0; c < qr.Size; c++ {
+			if qr.Modules[r][c] {
+				dark++
+			}
+			if r+1 < qr.Size && c+1 < qr.Size {
+				m := qr.Modules[r][c]
+				if m == qr.Modules[r+1][c] && m == qr.Modules[r][c+1] && m == qr.Modules[r+1][c+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Deviation from an even balance of dark and light modules.
+	percent := dark * 100 / (qr.Size * qr.Size)
+	penalty += abs(percent-50) / 5 * 10
+	return penalty
+}
+
+// lightRun returns true if the modules from start (inclusive) to end
+// (exclusive) are light, treating modules outside of the symbol as light.
+func (qr *QR) lightRun(r, start, end int, transpose bool) bool {
+	for c := start; c < end; c++ {
+		if c < 0 || c >= qr.Size {
+			continue
+		}
+		if (transpose && qr.Modules[c][r]) || (!transpose && qr.Modules[r][c]) {
+			return false
+		}
+	}
+	return true
+}
+
+// interleave splits the data into blocks, computes the error correction
+// codewords of each block and interleaves the result.
+func (v qrVersion) interleave(data []byte) []byte {
+	divisor := rsDivisor(v.ecPerBlock)
+	blocks := make([][]byte, len(v.blocks))
+	ecBlocks := make([][]byte, len(v.blocks))
+	offset, longest := 0, 0
+	for i, n := range v.blocks {
+		blocks[i] = data[offset : offset+n]
+		ecBlocks[i] = rsRemainder(blocks[i], divisor)
+		offset += n
+		if n > longest {
+			longest = n
+		}
+	}
+
+	result := make([]byte, 0, len(data)+len(v.blocks)*v.ecPerBlock)
+	for i := 0; i < longest; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given
+// degree, excluding the leading coefficient.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the Reed-Solomon error correction codewords of the
+// data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMul(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies two elements of GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrBits is a sequence of bits, most significant first.
+type qrBits []bool
+
+func (bits *qrBits) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bits = append(*bits, bit(value, i))
+	}
+}
+
+func (bits qrBits) bytes() []byte {
+	result := make([]byte, len(bits)/8)
+	for i, b := range bits {
+		if b {
+			result[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return result
+}
+
+func bit(value, i int) bool {
+	return (value>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
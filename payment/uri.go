@@ -0,0 +1,50 @@
+// Package payment builds deposit instructions for gateways, so that wallets
+// and frontends using a Lightnode render them consistently.
+package payment
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/renproject/multichain"
+)
+
+// uriSchemes maps the chains which have a payment URI standard (BIP21 or one
+// of its derivatives) to their scheme.
+var uriSchemes = map[multichain.Chain]string{
+	multichain.Bitcoin:     "bitcoin",
+	multichain.BitcoinCash: "bitcoincash",
+	multichain.DigiByte:    "digibyte",
+	multichain.Dogecoin:    "dogecoin",
+	multichain.Zcash:       "zcash",
+}
+
+var amountPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// URI returns the canonical payment URI for depositing the asset into the
+// gateway address. The amount is optional and, if given, must be a decimal
+// number of whole units of the asset (e.g. "0.1" for 0.1 BTC).
+func URI(asset multichain.Asset, gateway, amount string) (string, error) {
+	chain := asset.OriginChain()
+	scheme, ok := uriSchemes[chain]
+	if !ok {
+		return "", fmt.Errorf("no payment uri scheme for %v", asset)
+	}
+	if gateway == "" {
+		return "", fmt.Errorf("empty gateway address")
+	}
+
+	// Bitcoin Cash addresses may already include the scheme as a prefix.
+	gateway = strings.TrimPrefix(gateway, scheme+":")
+
+	uri := url.URL{Scheme: scheme, Opaque: gateway}
+	if amount != "" {
+		if !amountPattern.MatchString(amount) {
+			return "", fmt.Errorf("invalid amount %v", amount)
+		}
+		uri.RawQuery = url.Values{"amount": []string{amount}}.Encode()
+	}
+	return uri.String(), nil
+}
@@ -0,0 +1,99 @@
+// Package pool bounds the number of goroutines used to handle requests, so
+// that a flood of submissions results in back pressure rather than an
+// unbounded number of goroutines.
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// A Pool runs tasks in their own goroutines, with at most a fixed number of
+// them running at once.
+type Pool struct {
+	name  string
+	slots chan struct{}
+
+	waiting   int64
+	saturated uint64
+	abandoned uint64
+}
+
+// Stats describes the usage of a Pool.
+type Stats struct {
+	Name    string `json:"name"`
+	Size    int    `json:"size"`
+	Active  int    `json:"active"`
+	Waiting int64  `json:"waiting"`
+
+	// Saturated is the number of tasks which had to wait for a free slot.
+	Saturated uint64 `json:"saturated"`
+	// Abandoned is the number of tasks which were dropped because their
+	// context was done before a slot was free.
+	Abandoned uint64 `json:"abandoned"`
+}
+
+// New returns a Pool which runs at most size tasks at once. The name is used
+// to identify the pool in its stats.
+func New(name string, size int) *Pool {
+	if size <= 0 {
+		panic("pool size must be positive")
+	}
+	return &Pool{
+		name:  name,
+		slots: make(chan struct{}, size),
+	}
+}
+
+// Go runs the task in a new goroutine once there is a free slot. It blocks
+// until then, or returns the error of the context if it is done first, in
+// which case the task is not run.
+func (pool *Pool) Go(ctx context.Context, task func()) error {
+	select {
+	case pool.slots <- struct{}{}:
+	default:
+		atomic.AddUint64(&pool.saturated, 1)
+		atomic.AddInt64(&pool.waiting, 1)
+		select {
+		case pool.slots <- struct{}{}:
+			atomic.AddInt64(&pool.waiting, -1)
+		case <-ctx.Done():
+			atomic.AddInt64(&pool.waiting, -1)
+			atomic.AddUint64(&pool.abandoned, 1)
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer func() { <-pool.slots }()
+		task()
+	}()
+	return nil
+}
+
+// Stats returns the current usage of the pool.
+func (pool *Pool) Stats() Stats {
+	return Stats{
+		Name:      pool.name,
+		Size:      cap(pool.slots),
+		Active:    len(pool.slots),
+		Waiting:   atomic.LoadInt64(&pool.waiting),
+		Saturated: atomic.LoadUint64(&pool.saturated),
+		Abandoned: atomic.LoadUint64(&pool.abandoned),
+	}
+}
+
+// Handler serves the stats of the pools as JSON.
+type Handler []*Pool
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats := make([]Stats, len(handler))
+	for i, pool := range handler {
+		stats[i] = pool.Stats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,62 @@
+package pool_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/pool"
+)
+
+var _ = Describe("Pool", func() {
+	It("should not run more tasks than its size at once", func() {
+		pool := New("test", 2)
+		release := make(chan struct{})
+		started := make(chan struct{}, 3)
+		task := func() {
+			started <- struct{}{}
+			<-release
+		}
+
+		Expect(pool.Go(context.Background(), task)).To(Succeed())
+		Expect(pool.Go(context.Background(), task)).To(Succeed())
+		Eventually(started).Should(HaveLen(2))
+
+		// The third task waits for a free slot.
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Expect(pool.Go(context.Background(), task)).To(Succeed())
+		}()
+		Eventually(func() int64 { return pool.Stats().Waiting }).Should(Equal(int64(1)))
+		Consistently(started, 100*time.Millisecond).Should(HaveLen(2))
+
+		close(release)
+		wg.Wait()
+		Eventually(func() int { return pool.Stats().Active }).Should(BeZero())
+
+		stats := pool.Stats()
+		Expect(stats.Name).To(Equal("test"))
+		Expect(stats.Size).To(Equal(2))
+		Expect(stats.Waiting).To(BeZero())
+		Expect(stats.Saturated).To(Equal(uint64(1)))
+		Expect(stats.Abandoned).To(BeZero())
+	})
+
+	It("should not run tasks whose context is done before a slot is free", func() {
+		pool := New("test", 1)
+		release := make(chan struct{})
+		defer close(release)
+		Expect(pool.Go(context.Background(), func() { <-release })).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		ran := false
+		Expect(pool.Go(ctx, func() { ran = true })).To(Equal(context.DeadlineExceeded))
+		Expect(ran).To(BeFalse())
+		Expect(pool.Stats().Abandoned).To(Equal(uint64(1)))
+	})
+})
@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"strings"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bech32"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/chain/bitcoincash"
+)
+
+// NormalizeAddress returns the canonical form of a gateway address on the
+// given chain, so that equivalent representations of an address are stored
+// and looked up as the same gateway. Bitcoin Cash addresses are converted to
+// cashaddr without a prefix, and bech32 addresses are lower cased. Addresses
+// which cannot be parsed are returned unchanged.
+func NormalizeAddress(network multichain.Network, chain multichain.Chain, addr string) string {
+	addr = strings.TrimSpace(addr)
+	if chain == multichain.BitcoinCash {
+		if normalized, ok := normalizeCashAddr(network, addr); ok {
+			return normalized
+		}
+	}
+	if isBech32(addr) {
+		return strings.ToLower(addr)
+	}
+	return addr
+}
+
+// gatewayLookupAddresses returns the addresses under which the gateway with the
+// given address may have been stored, in the order they should be tried. The
+// chain of the gateway is not known when it is queried, so the address is also
+// tried as a Bitcoin Cash address, and as given for gateways which were stored
+// before addresses were normalized.
+func gatewayLookupAddresses(network multichain.Network, addr string) []string {
+	addrs := []string{}
+	seen := map[string]bool{}
+	for _, candidate := range []string{
+		NormalizeAddress(network, "", addr),
+		NormalizeAddress(network, multichain.BitcoinCash, addr),
+		addr,
+	} {
+		if !seen[candidate] {
+			seen[candidate] = true
+			addrs = append(addrs, candidate)
+		}
+	}
+	return addrs
+}
+
+// isBech32 returns whether the address is a bech32 address, ignoring case.
+// Addresses are checked against their checksum, as base58 addresses can
+// otherwise look like bech32 addresses once lower cased.
+func isBech32(addr string) bool {
+	_, _, err := bech32.Decode(strings.ToLower(addr))
+	return err == nil
+}
+
+// normalizeCashAddr converts a cashaddr address, with or without its prefix,
+// or a legacy address, into a cashaddr address without its prefix.
+func normalizeCashAddr(network multichain.Network, addr string) (string, bool) {
+	params := watcher.NetParams(multichain.BitcoinCash, network)
+	if legacyAddr, err := btcutil.DecodeAddress(addr, params); err == nil {
+		var cashAddr btcutil.Address
+		switch legacyAddr := legacyAddr.(type) {
+		case *btcutil.AddressPubKeyHash:
+			cashAddr, err = bitcoincash.NewAddressPubKeyHash(legacyAddr.ScriptAddress(), params)
+		case *btcutil.AddressScriptHash:
+			cashAddr, err = bitcoincash.NewAddressScriptHashFromHash(legacyAddr.ScriptAddress(), params)
+		default:
+			return "", false
+		}
+		if err != nil {
+			return "", false
+		}
+		return cashAddr.EncodeAddress(), true
+	}
+
+	// Cashaddr addresses are either lower or upper case, but are only decoded
+	// in lower case.
+	if strings.ToLower(addr) != addr && strings.ToUpper(addr) != addr {
+		return "", false
+	}
+	cashAddr, err := bitcoincash.DecodeAddress(strings.ToLower(addr), params)
+	if err != nil {
+		return "", false
+	}
+	return cashAddr.EncodeAddress(), true
+}
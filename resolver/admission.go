@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+)
+
+// APIKeyHeader is the header with which integrators authenticate themselves.
+// Requests without a known API key are anonymous.
+const APIKeyHeader = "x-api-key"
+
+// AnonymousTier is the tier of requests which do not have a known API key.
+const AnonymousTier = "anonymous"
+
+// DefaultAnonymousShare is the share of capacity which anonymous requests can
+// use if it is not configured, leaving the rest for integrators.
+const DefaultAnonymousShare = 0.5
+
+// AdmissionConf configures an AdmissionController.
+type AdmissionConf struct {
+	// Capacity is the number of requests per second the Lightnode can serve.
+	// Zero disables load shedding.
+	Capacity float64
+
+	// Shares are the fraction of capacity which requests of each tier can
+	// use. A tier with a share of 0.5 is shed once half of the capacity is in
+	// use, which keeps the other half for tiers with larger shares.
+	Shares map[string]float64
+
+	// APIKeys maps the API keys of integrators to their tier.
+	APIKeys map[string]string
+}
+
+// Validate returns an error if the shares are out of range, or if an API key
+// belongs to a tier without a share.
+func (conf AdmissionConf) Validate() error {
+	if conf.Capacity < 0 {
+		return fmt.Errorf("capacity must not be negative, got %v", conf.Capacity)
+	}
+	for tier, share := range conf.Shares {
+		if share <= 0 || share > 1 {
+			return fmt.Errorf("share of tier %v must be in (0, 1], got %v", tier, share)
+		}
+	}
+	for _, tier := range conf.APIKeys {
+		if _, ok := conf.Shares[tier]; !ok {
+			return fmt.Errorf("unknown tier %v", tier)
+		}
+	}
+	return nil
+}
+
+// AdmissionController sheds requests when the Lightnode is overloaded,
+// starting with the tiers with the smallest share of capacity. Load is tracked
+// with a token bucket which holds a second of capacity: requests take a token,
+// and requests of a tier are shed once taking a token would leave fewer than
+// the tokens reserved for larger shares.
+type AdmissionController struct {
+	mu     sync.Mutex
+	conf   AdmissionConf
+	tokens float64
+	last   time.Time
+}
+
+// NewAdmissionController returns an AdmissionController with a full bucket.
+// Tiers without a share, including the anonymous tier if it is not
+// configured, get the default anonymous share.
+func NewAdmissionController(conf AdmissionConf) *AdmissionController {
+	return &AdmissionController{
+		conf:   conf,
+		tokens: conf.Capacity,
+		last:   time.Now(),
+	}
+}
+
+// Tier returns the tier of the request.
+func (controller *AdmissionController) Tier(r *http.Request) string {
+	if r == nil {
+		return AnonymousTier
+	}
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return AnonymousTier
+	}
+	tier, ok := controller.conf.APIKeys[key]
+	if !ok {
+		return AnonymousTier
+	}
+	return tier
+}
+
+// Admit returns whether a request of the tier should be served.
+func (controller *AdmissionController) Admit(tier string) bool {
+	if controller.conf.Capacity <= 0 {
+		return true
+	}
+
+	controller.mu.Lock()
+	defer controller.mu.Unlock()
+
+	now := time.Now()
+	controller.tokens += now.Sub(controller.last).Seconds() * controller.conf.Capacity
+	if controller.tokens > controller.conf.Capacity {
+		controller.tokens = controller.conf.Capacity
+	}
+	controller.last = now
+
+	share, ok := controller.conf.Shares[tier]
+	if !ok {
+		share = DefaultAnonymousShare
+	}
+	reserved := controller.conf.Capacity * (1 - share)
+	if controller.tokens-1 < reserved {
+		return false
+	}
+	controller.tokens--
+	return true
+}
+
+// AdmissionValidator sheds requests with an AdmissionController before they
+// are validated, so that shed requests cost as little as possible.
+type AdmissionValidator struct {
+	inner      jsonrpc.Validator
+	controller *AdmissionController
+	logger     logging.Logger
+}
+
+// NewAdmissionValidator returns an AdmissionValidator wrapping the given
+// validator.
+func NewAdmissionValidator(inner jsonrpc.Validator, controller *AdmissionController, logger logging.Logger) *AdmissionValidator {
+	return &AdmissionValidator{
+		inner:      inner,
+		controller: controller,
+		logger:     logger,
+	}
+}
+
+// ValidateRequest implements the `jsonrpc.Validator` interface.
+func (validator *AdmissionValidator) ValidateRequest(ctx context.Context, r *http.Request, req jsonrpc.Request) (interface{}, jsonrpc.Response) {
+	tier := validator.controller.Tier(r)
+	if !validator.controller.Admit(tier) {
+		validator.logger.WithField("tier", tier).Debugf("[admission] shedding %v request", req.Method)
+		message := "lightnode is overloaded, try again later"
+		if tier == AnonymousTier {
+			message += " or authenticate with an api key"
+		}
+		return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrRetryLater, "%v", message))
+	}
+	return validator.inner.ValidateRequest(ctx, r, req)
+}
@@ -0,0 +1,94 @@
+package resolver_test
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/jsonrpc"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+	"github.com/sirupsen/logrus"
+)
+
+type countingValidator struct {
+	calls int
+}
+
+func (validator *countingValidator) ValidateRequest(ctx context.Context, r *http.Request, req jsonrpc.Request) (interface{}, jsonrpc.Response) {
+	validator.calls++
+	return nil, jsonrpc.Response{}
+}
+
+var _ = Describe("Admission controller", func() {
+	conf := AdmissionConf{
+		Capacity: 10,
+		Shares:   map[string]float64{AnonymousTier: 0.5, "gold": 1},
+		APIKeys:  map[string]string{"secret": "gold"},
+	}
+
+	requestWithKey := func(key string) *http.Request {
+		r := &http.Request{Header: http.Header{}}
+		if key != "" {
+			r.Header.Set(APIKeyHeader, key)
+		}
+		return r
+	}
+
+	It("should return the tier of the api key", func() {
+		controller := NewAdmissionController(conf)
+		Expect(controller.Tier(requestWithKey("secret"))).To(Equal("gold"))
+		Expect(controller.Tier(requestWithKey("unknown"))).To(Equal(AnonymousTier))
+		Expect(controller.Tier(requestWithKey(""))).To(Equal(AnonymousTier))
+		Expect(controller.Tier(nil)).To(Equal(AnonymousTier))
+	})
+
+	It("should shed anonymous requests before authenticated ones", func() {
+		controller := NewAdmissionController(conf)
+		anonymous := 0
+		for controller.Admit(AnonymousTier) {
+			anonymous++
+		}
+		Expect(anonymous).To(BeNumerically("~", 5, 1))
+
+		// The capacity reserved for larger shares is still available.
+		gold := 0
+		for controller.Admit("gold") {
+			gold++
+		}
+		Expect(gold).To(BeNumerically("~", 5, 1))
+	})
+
+	It("should admit every request if it has no capacity", func() {
+		controller := NewAdmissionController(AdmissionConf{})
+		for i := 0; i < 100; i++ {
+			Expect(controller.Admit(AnonymousTier)).To(BeTrue())
+		}
+	})
+
+	It("should reject api keys of unknown tiers and shares out of range", func() {
+		Expect(conf.Validate()).To(Succeed())
+		Expect(AdmissionConf{APIKeys: map[string]string{"secret": "silver"}}.Validate()).NotTo(Succeed())
+		Expect(AdmissionConf{Shares: map[string]float64{"gold": 1.5}}.Validate()).NotTo(Succeed())
+		Expect(AdmissionConf{Capacity: -1}.Validate()).NotTo(Succeed())
+	})
+
+	It("should not validate shed requests", func() {
+		inner := &countingValidator{}
+		validator := NewAdmissionValidator(inner, NewAdmissionController(conf), logging.FromLogrus(logrus.New()))
+		shed := 0
+		for i := 0; i < 10; i++ {
+			_, resp := validator.ValidateRequest(context.Background(), requestWithKey(""), jsonrpc.Request{ID: i, Method: jsonrpc.MethodQueryBlockState})
+			if resp.Error != nil {
+				Expect(resp.Error.Code).To(Equal(lerrors.ErrorCodeRetryLater))
+				Expect(resp.Error.Message).To(ContainSubstring("api key"))
+				shed++
+			}
+		}
+		Expect(shed).To(BeNumerically(">", 0))
+		Expect(inner.calls).To(Equal(10 - shed))
+	})
+})
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// AmountsParam is the query parameter which adds human-readable amounts to
+// responses when it is set to "formatted". Amounts are always given in the
+// smallest unit of the asset, so formatted amounts are optional extras which
+// spare clients from looking up the decimals of each asset.
+const AmountsParam = "amounts"
+
+// assetDecimals are the number of decimals of each asset, which is the
+// number of digits of the smallest unit of the asset after the decimal point
+// of a whole unit.
+var assetDecimals = map[multichain.Asset]int{
+	multichain.BCH:    8,
+	multichain.BTC:    8,
+	multichain.DGB:    8,
+	multichain.DOGE:   8,
+	multichain.FIL:    18,
+	multichain.LUNA:   6,
+	multichain.ZEC:    8,
+	multichain.ArbETH: 18,
+	multichain.AVAX:   18,
+	multichain.BNB:    18,
+	multichain.ETH:    18,
+	multichain.FTM:    18,
+	multichain.MATIC:  18,
+	multichain.SOL:    9,
+}
+
+// ResponseQueryTxFormatted is a queryTx response with the amount of the tx in
+// whole units of its asset (e.g. "0.1" for 0.1 BTC). The formatted amount is
+// omitted if the tx has no amount, or the decimals of its asset are unknown.
+type ResponseQueryTxFormatted struct {
+	jsonrpc.ResponseQueryTx
+	AmountFormatted string `json:"amountFormatted,omitempty"`
+}
+
+// FormatAmount returns the amount, in the smallest unit of the asset, as a
+// decimal number of whole units without trailing zeros. It returns false if
+// the decimals of the asset are unknown.
+func FormatAmount(asset multichain.Asset, amount pack.U256) (string, bool) {
+	decimals, ok := assetDecimals[asset]
+	if !ok {
+		return "", false
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(amount.Int(), unit, new(big.Int))
+	if frac.Sign() == 0 {
+		return whole.String(), true
+	}
+	fracStr := frac.String()
+	fracStr = strings.Repeat("0", decimals-len(fracStr)) + fracStr
+	return whole.String() + "." + strings.TrimRight(fracStr, "0"), true
+}
+
+// formatAmounts returns whether the request asked for formatted amounts.
+func formatAmounts(req *http.Request) bool {
+	return req != nil && req.URL != nil && req.URL.Query().Get(AmountsParam) == "formatted"
+}
+
+// withFormattedAmount returns the queryTx response with the formatted amount
+// of the tx.
+func withFormattedAmount(resp jsonrpc.ResponseQueryTx) ResponseQueryTxFormatted {
+	formatted := ResponseQueryTxFormatted{ResponseQueryTx: resp}
+	if amount, ok := resp.Tx.Input.Get("amount").(pack.U256); ok {
+		formatted.AmountFormatted, _ = FormatAmount(resp.Tx.Selector.Asset(), amount)
+	}
+	return formatted
+}
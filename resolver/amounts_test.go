@@ -0,0 +1,53 @@
+package resolver_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+var _ = Describe("Amount formatting", func() {
+	It("should format amounts in whole units of the asset", func() {
+		for amount, expected := range map[uint64]string{
+			0:         "0",
+			1:         "0.00000001",
+			10000:     "0.0001",
+			100000000: "1",
+			123456789: "1.23456789",
+			250000000: "2.5",
+		} {
+			formatted, ok := FormatAmount(multichain.BTC, pack.NewU256FromU64(amount))
+			Expect(ok).To(BeTrue())
+			Expect(formatted).To(Equal(expected))
+		}
+
+		formatted, ok := FormatAmount(multichain.LUNA, pack.NewU256FromU64(1500000))
+		Expect(ok).To(BeTrue())
+		Expect(formatted).To(Equal("1.5"))
+
+		_, ok = FormatAmount(multichain.Asset("UNKNOWN"), pack.NewU256FromU64(1))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should add the formatted amount to queryTx responses", func() {
+		resp := ResponseQueryTxFormatted{
+			ResponseQueryTx: jsonrpc.ResponseQueryTx{TxStatus: tx.StatusDone},
+			AmountFormatted: "0.1",
+		}
+		data, err := json.Marshal(resp)
+		Expect(err).NotTo(HaveOccurred())
+
+		var fields map[string]json.RawMessage
+		Expect(json.Unmarshal(data, &fields)).To(Succeed())
+		Expect(fields).To(HaveKey("tx"))
+		Expect(fields).To(HaveKey("txStatus"))
+		Expect(string(fields["amountFormatted"])).To(Equal(`"0.1"`))
+	})
+})
@@ -0,0 +1,144 @@
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/pack"
+)
+
+// MaxCachedBlocksPerQuery is the largest queryBlocks request which is served
+// from the block cache. Larger requests are forwarded to the Darknodes.
+const MaxCachedBlocksPerQuery = 100
+
+// blockCache serves queryBlock and queryBlocks requests for blocks at known
+// heights from recently fetched blocks, so that explorers paginating through
+// the block history do not load the Darknodes. RenVM blocks are final, so
+// cached blocks never need to be refreshed. Requests for the latest blocks
+// cannot be served from the cache, but the blocks they return are cached.
+type blockCache struct {
+	logger logging.Logger
+	db     db.DB
+	size   int
+}
+
+// responseQueryBlock and responseQueryBlocks are the results of queryBlock and
+// queryBlocks, with blocks left encoded as they are cached.
+type responseQueryBlock struct {
+	Block json.RawMessage `json:"block"`
+}
+
+type responseQueryBlocks struct {
+	Blocks []json.RawMessage `json:"blocks"`
+}
+
+// blockHeight is the part of an encoded block needed to cache it.
+type blockHeight struct {
+	Header *struct {
+		Height pack.U64 `json:"height"`
+	} `json:"header"`
+}
+
+// newBlockCache returns a cache of at most size blocks, or nil if size is zero.
+func newBlockCache(logger logging.Logger, db db.DB, size int) *blockCache {
+	if size <= 0 {
+		return nil
+	}
+	return &blockCache{logger: logger, db: db, size: size}
+}
+
+// block returns the cached block at the given height.
+func (cache *blockCache) block(height uint64) (json.RawMessage, bool) {
+	blocks, ok := cache.blocks(height, 1)
+	if !ok {
+		return nil, false
+	}
+	return blocks[0], true
+}
+
+// blocks returns the cached blocks with heights in [height, height+n). It
+// returns false unless all of them are cached.
+func (cache *blockCache) blocks(height, n uint64) ([]json.RawMessage, bool) {
+	if n == 0 || n > MaxCachedBlocksPerQuery {
+		return nil, false
+	}
+	encoded, err := cache.db.Blocks(height, n)
+	if err != nil {
+		cache.logger.Errorf("[resolver] cannot read cached blocks: %v", err)
+		return nil, false
+	}
+	if uint64(len(encoded)) != n {
+		return nil, false
+	}
+	blocks := make([]json.RawMessage, len(encoded))
+	for i := range encoded {
+		blocks[i] = encoded[i]
+	}
+	return blocks, true
+}
+
+// insert caches the blocks in a successful queryBlock or queryBlocks response.
+func (cache *blockCache) insert(method string, response jsonrpc.Response) {
+	if response.Error != nil || response.Result == nil {
+		return
+	}
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		cache.logger.Warnf("[resolver] cannot encode %v result: %v", method, err)
+		return
+	}
+
+	var blocks []json.RawMessage
+	switch method {
+	case jsonrpc.MethodQueryBlock:
+		var result responseQueryBlock
+		if err := json.Unmarshal(data, &result); err != nil {
+			cache.logger.Warnf("[resolver] cannot decode %v result: %v", method, err)
+			return
+		}
+		blocks = []json.RawMessage{result.Block}
+	case jsonrpc.MethodQueryBlocks:
+		var result responseQueryBlocks
+		if err := json.Unmarshal(data, &result); err != nil {
+			cache.logger.Warnf("[resolver] cannot decode %v result: %v", method, err)
+			return
+		}
+		blocks = result.Blocks
+	default:
+		return
+	}
+
+	byHeight := make(map[uint64][]byte, len(blocks))
+	for _, block := range blocks {
+		height, err := decodeBlockHeight(block)
+		if err != nil {
+			cache.logger.Warnf("[resolver] cannot cache block: %v", err)
+			return
+		}
+		byHeight[height] = block
+	}
+	if len(byHeight) == 0 {
+		return
+	}
+	if err := cache.db.InsertBlocks(byHeight); err != nil {
+		cache.logger.Errorf("[resolver] cannot cache blocks: %v", err)
+		return
+	}
+	if err := cache.db.PruneBlocks(cache.size); err != nil {
+		cache.logger.Errorf("[resolver] cannot prune cached blocks: %v", err)
+	}
+}
+
+func decodeBlockHeight(block json.RawMessage) (uint64, error) {
+	var decoded blockHeight
+	if err := json.Unmarshal(block, &decoded); err != nil {
+		return 0, fmt.Errorf("decoding block: %v", err)
+	}
+	if decoded.Header == nil {
+		return 0, fmt.Errorf("missing block header")
+	}
+	return uint64(decoded.Header.Height), nil
+}
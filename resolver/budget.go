@@ -0,0 +1,199 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+)
+
+// Enumerate default options of the verification budget.
+const (
+	DefaultVerificationTimeout      = 10 * time.Second
+	DefaultVerificationCacheSize    = 10000
+	DefaultVerificationCacheTTL     = 10 * time.Minute
+	DefaultVerificationRejectionTTL = 30 * time.Second
+)
+
+// VerificationBudget limits the work done to verify submitted txs, which
+// involves lookups on the chains.
+type VerificationBudget struct {
+	// Timeout is how long a single verification can take. Zero does not
+	// limit it beyond the deadline of the request.
+	Timeout time.Duration
+
+	// Concurrency is how many verifications can run at once. Submissions
+	// beyond it wait for a verification to finish, until their request times
+	// out. Zero does not limit it.
+	Concurrency int
+
+	// CacheSize is how many verdicts are cached by tx hash. Zero disables the
+	// cache. Acceptances are cached for CacheTTL, and rejections for
+	// RejectionTTL, as they are more likely to change, for example once the
+	// chain RPCs see a tx which has just been broadcast. Verdicts caused by
+	// timeouts or chain RPC errors are never cached.
+	CacheSize    int
+	CacheTTL     time.Duration
+	RejectionTTL time.Duration
+}
+
+// verdict is the cached result of verifying a tx.
+type verdict struct {
+	hash    id.Hash
+	err     error
+	expires time.Time
+}
+
+// verification is a verification in progress, which identical submissions
+// wait for instead of verifying the tx again.
+type verification struct {
+	done chan struct{}
+	err  error
+}
+
+type budgetVerifier struct {
+	Verifier
+
+	logger logging.Logger
+	budget VerificationBudget
+	slots  chan struct{}
+
+	mu       *sync.Mutex
+	inflight map[id.Hash]*verification
+	verdicts map[id.Hash]*list.Element
+	lru      *list.List
+}
+
+// NewBudgetVerifier wraps the verifier so that verifications are bounded by
+// the budget, and identical submissions share the verdict of the tx instead
+// of being verified again.
+func NewBudgetVerifier(verifier Verifier, logger logging.Logger, budget VerificationBudget) Verifier {
+	v := budgetVerifier{
+		Verifier: verifier,
+		logger:   logger,
+		budget:   budget,
+		mu:       new(sync.Mutex),
+		inflight: map[id.Hash]*verification{},
+		verdicts: map[id.Hash]*list.Element{},
+		lru:      list.New(),
+	}
+	if budget.Concurrency > 0 {
+		v.slots = make(chan struct{}, budget.Concurrency)
+	}
+	return v
+}
+
+func (v budgetVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	// The hash is only trusted as a key if it matches the contents of the
+	// tx, otherwise a tx could reuse the verdict of another.
+	hash, err := tx.NewTxHash(transaction.Version, transaction.Selector, transaction.Input)
+	if err != nil || hash != transaction.Hash {
+		return v.verify(ctx, transaction)
+	}
+
+	v.mu.Lock()
+	if err, ok := v.cached(hash); ok {
+		v.mu.Unlock()
+		return err
+	}
+	if call, ok := v.inflight[hash]; ok {
+		v.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return lerrors.Wrap(lerrors.ErrBackpressure, ctx.Err())
+		case <-call.done:
+		}
+		// The other submission may have given up before the tx could be
+		// verified, in which case it is verified again.
+		if cacheable(call.err) {
+			return call.err
+		}
+		return v.verify(ctx, transaction)
+	}
+	call := &verification{done: make(chan struct{})}
+	v.inflight[hash] = call
+	v.mu.Unlock()
+
+	call.err = v.verify(ctx, transaction)
+
+	v.mu.Lock()
+	delete(v.inflight, hash)
+	if cacheable(call.err) && ctx.Err() == nil {
+		v.cache(hash, call.err)
+	}
+	v.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// verify the tx once a slot is free, within the time budget.
+func (v budgetVerifier) verify(ctx context.Context, transaction tx.Tx) error {
+	if v.slots != nil {
+		select {
+		case <-ctx.Done():
+			v.logger.Warnf("[verifier] no capacity to verify tx=%v: %v", transaction.Hash.String(), ctx.Err())
+			return lerrors.Wrap(lerrors.ErrBackpressure, ctx.Err())
+		case v.slots <- struct{}{}:
+		}
+		defer func() { <-v.slots }()
+	}
+	if v.budget.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.budget.Timeout)
+		defer cancel()
+	}
+	return v.Verifier.VerifyTx(ctx, transaction)
+}
+
+// cacheable returns whether the verdict is a property of the tx, rather than
+// of the conditions it was verified under.
+func cacheable(err error) bool {
+	return err == nil || !(errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) ||
+		lerrors.Is(err, lerrors.ErrBackpressure) ||
+		lerrors.Is(err, lerrors.ErrChainRPC))
+}
+
+// cached returns the verdict for the tx with the hash, if it has not expired.
+// It must be called with the lock held.
+func (v budgetVerifier) cached(hash id.Hash) (error, bool) {
+	elem, ok := v.verdicts[hash]
+	if !ok {
+		return nil, false
+	}
+	cached := elem.Value.(*verdict)
+	if time.Now().After(cached.expires) {
+		v.lru.Remove(elem)
+		delete(v.verdicts, hash)
+		return nil, false
+	}
+	v.lru.MoveToFront(elem)
+	return cached.err, true
+}
+
+// cache the verdict for the tx with the hash, evicting the least recently
+// used verdict if the cache is full. It must be called with the lock held.
+func (v budgetVerifier) cache(hash id.Hash, err error) {
+	ttl := v.budget.CacheTTL
+	if err != nil {
+		ttl = v.budget.RejectionTTL
+	}
+	if v.budget.CacheSize <= 0 || ttl <= 0 {
+		return
+	}
+	if elem, ok := v.verdicts[hash]; ok {
+		v.lru.Remove(elem)
+	}
+	v.verdicts[hash] = v.lru.PushFront(&verdict{hash: hash, err: err, expires: time.Now().Add(ttl)})
+	for v.lru.Len() > v.budget.CacheSize {
+		oldest := v.lru.Back()
+		v.lru.Remove(oldest)
+		delete(v.verdicts, oldest.Value.(*verdict).hash)
+	}
+}
@@ -0,0 +1,168 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/tx"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// countingVerifier counts the txs it verifies, optionally waiting until it is
+// released or the verification is cancelled.
+type countingVerifier struct {
+	count   *int64
+	err     error
+	release chan struct{}
+}
+
+func (v countingVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	atomic.AddInt64(v.count, 1)
+	if v.release != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-v.release:
+		}
+	}
+	return v.err
+}
+
+var _ = Describe("Budget verifier", func() {
+	mintTx := func(amount uint64) tx.Tx {
+		input, err := pack.Encode(engine.LockMintBurnReleaseInput{
+			Txid:   pack.Bytes{1, 2, 3},
+			Amount: pack.NewU256FromU64(amount),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		transaction, err := tx.NewTx("BTC/toEthereum", pack.Typed(input.(pack.Struct)))
+		Expect(err).NotTo(HaveOccurred())
+		return transaction
+	}
+
+	budget := VerificationBudget{
+		Timeout:      time.Second,
+		Concurrency:  1,
+		CacheSize:    10,
+		CacheTTL:     time.Minute,
+		RejectionTTL: 100 * time.Millisecond,
+	}
+	logger := logging.FromLogrus(logrus.New())
+
+	It("should verify resubmitted txs once", func() {
+		count := int64(0)
+		verifier := NewBudgetVerifier(countingVerifier{count: &count}, logger, budget)
+		for i := 0; i < 3; i++ {
+			Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(Succeed())
+		}
+		Expect(verifier.VerifyTx(context.Background(), mintTx(2))).To(Succeed())
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(2)))
+	})
+
+	It("should cache rejections until the rejection ttl", func() {
+		count := int64(0)
+		verifier := NewBudgetVerifier(countingVerifier{count: &count, err: errors.New("invalid")}, logger, budget)
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(MatchError("invalid"))
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(MatchError("invalid"))
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(1)))
+
+		time.Sleep(2 * budget.RejectionTTL)
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(MatchError("invalid"))
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(2)))
+	})
+
+	It("should not cache chain rpc errors", func() {
+		count := int64(0)
+		err := lerrors.Wrapf(lerrors.ErrChainRPC, "connection refused")
+		verifier := NewBudgetVerifier(countingVerifier{count: &count, err: err}, logger, budget)
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).NotTo(Succeed())
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).NotTo(Succeed())
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(2)))
+	})
+
+	It("should not share verdicts between txs with the same hash but different contents", func() {
+		count := int64(0)
+		verifier := NewBudgetVerifier(countingVerifier{count: &count}, logger, budget)
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(Succeed())
+
+		forged := mintTx(2)
+		forged.Hash = mintTx(1).Hash
+		Expect(verifier.VerifyTx(context.Background(), forged)).To(Succeed())
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(2)))
+	})
+
+	It("should evict the least recently used verdicts", func() {
+		count := int64(0)
+		small := budget
+		small.CacheSize = 2
+		verifier := NewBudgetVerifier(countingVerifier{count: &count}, logger, small)
+		for _, amount := range []uint64{1, 2, 1, 3, 1, 2} {
+			Expect(verifier.VerifyTx(context.Background(), mintTx(amount))).To(Succeed())
+		}
+		// The tx with amount 2 is evicted by the tx with amount 3.
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(4)))
+	})
+
+	It("should time out verifications which exceed the budget", func() {
+		count := int64(0)
+		short := budget
+		short.Timeout = 10 * time.Millisecond
+		verifier := NewBudgetVerifier(countingVerifier{count: &count, release: make(chan struct{})}, logger, short)
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(MatchError(context.DeadlineExceeded))
+
+		// Timeouts are not verdicts, so the tx is verified again.
+		Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(MatchError(context.DeadlineExceeded))
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(2)))
+	})
+
+	It("should limit the number of concurrent verifications", func() {
+		count := int64(0)
+		release := make(chan struct{})
+		verifier := NewBudgetVerifier(countingVerifier{count: &count, release: release}, logger, budget)
+
+		done := make(chan error, 1)
+		go func() { done <- verifier.VerifyTx(context.Background(), mintTx(1)) }()
+		Eventually(func() int64 { return atomic.LoadInt64(&count) }).Should(Equal(int64(1)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := verifier.VerifyTx(ctx, mintTx(2))
+		Expect(lerrors.Is(err, lerrors.ErrBackpressure)).To(BeTrue())
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(1)))
+
+		close(release)
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should share verifications of identical concurrent submissions", func() {
+		count := int64(0)
+		release := make(chan struct{})
+		verifier := NewBudgetVerifier(countingVerifier{count: &count, release: release}, logger, budget)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(verifier.VerifyTx(context.Background(), mintTx(1))).To(Succeed())
+			}()
+		}
+		Eventually(func() int64 { return atomic.LoadInt64(&count) }).Should(Equal(int64(1)))
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(1)))
+	})
+})
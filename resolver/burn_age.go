@@ -0,0 +1,150 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/darknode/tx"
+	lerrors "github.com/renproject/lightnode/errors"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// BurnAgeLimit restricts how old a burn can be when it is submitted by a
+// client. Darknodes may no longer have the state required to process old
+// burns, so these are rejected instead of being accepted and never completing.
+type BurnAgeLimit struct {
+	// MaxAge is the maximum time since the burn was included in a block. Zero
+	// disables the check.
+	MaxAge time.Duration
+	// MaxBlocks is the maximum number of blocks since the burn was included,
+	// per host chain. Chains without an entry are not checked.
+	MaxBlocks map[multichain.Chain]uint64
+	// RecoveryURL is included in the error returned for burns which are too
+	// old, so that users know how to recover their funds.
+	RecoveryURL string
+}
+
+// Enabled returns true if the limit checks the age of burns on any chain.
+func (limit BurnAgeLimit) Enabled() bool {
+	return limit.MaxAge > 0 || len(limit.MaxBlocks) > 0
+}
+
+// BurnBlock describes the block in which a burn was included.
+type BurnBlock struct {
+	Height       uint64
+	Time         time.Time
+	LatestHeight uint64
+}
+
+// A BurnBlockFetcher returns the block in which a host chain transaction was
+// included.
+type BurnBlockFetcher interface {
+	FetchBurnBlock(ctx context.Context, chain multichain.Chain, txid pack.Bytes) (BurnBlock, error)
+}
+
+type ethBurnBlockFetcher struct {
+	bindings binding.Bindings
+}
+
+// NewEthBurnBlockFetcher returns a BurnBlockFetcher for EVM host chains which
+// uses the Ethereum clients of the given bindings.
+func NewEthBurnBlockFetcher(bindings binding.Bindings) BurnBlockFetcher {
+	return ethBurnBlockFetcher{bindings: bindings}
+}
+
+func (fetcher ethBurnBlockFetcher) FetchBurnBlock(ctx context.Context, chain multichain.Chain, txid pack.Bytes) (BurnBlock, error) {
+	client := fetcher.bindings.EthereumClient(chain)
+	if client == nil {
+		return BurnBlock{}, fmt.Errorf("no client for %v", chain)
+	}
+	receipt, err := client.TransactionReceipt(ctx, common.BytesToHash(txid))
+	if err != nil {
+		return BurnBlock{}, lerrors.Wrapf(lerrors.ErrChainRPC, "getting receipt: %v", err)
+	}
+	header, err := client.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return BurnBlock{}, lerrors.Wrapf(lerrors.ErrChainRPC, "getting block #%v: %v", receipt.BlockNumber, err)
+	}
+	latest, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return BurnBlock{}, lerrors.Wrapf(lerrors.ErrChainRPC, "getting latest block: %v", err)
+	}
+	return BurnBlock{
+		Height:       header.Number.Uint64(),
+		Time:         time.Unix(int64(header.Time), 0),
+		LatestHeight: latest.Number.Uint64(),
+	}, nil
+}
+
+type burnAgeVerifier struct {
+	Verifier
+
+	logger  logging.Logger
+	fetcher BurnBlockFetcher
+	limit   BurnAgeLimit
+}
+
+// NewBurnAgeVerifier wraps the verifier so that burns older than the limit are
+// rejected before being verified. Burns submitted by the Lightnode itself, by
+// the watchers or when replaying burns, are not checked, as old burns are
+// exactly those which a replay is meant to recover.
+func NewBurnAgeVerifier(verifier Verifier, logger logging.Logger, fetcher BurnBlockFetcher, limit BurnAgeLimit) Verifier {
+	if !limit.Enabled() {
+		return verifier
+	}
+	return burnAgeVerifier{
+		Verifier: verifier,
+		logger:   logger,
+		fetcher:  fetcher,
+		limit:    limit,
+	}
+}
+
+func (v burnAgeVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	if transaction.Selector.IsBurn() && !lhttp.IsInternal(ctx) {
+		if err := v.checkAge(ctx, transaction); err != nil {
+			return err
+		}
+	}
+	return v.Verifier.VerifyTx(ctx, transaction)
+}
+
+func (v burnAgeVerifier) checkAge(ctx context.Context, transaction tx.Tx) error {
+	chain := transaction.Selector.Source()
+	maxBlocks, checkBlocks := v.limit.MaxBlocks[chain]
+	if !chain.IsAccountBased() || (!checkBlocks && v.limit.MaxAge == 0) {
+		return nil
+	}
+	txid, ok := transaction.Input.Get("txid").(pack.Bytes)
+	if !ok || len(txid) == 0 {
+		return nil
+	}
+
+	// If the block cannot be found, the burn is left to the verifier, which
+	// will reject it with a more specific error if it does not exist.
+	block, err := v.fetcher.FetchBurnBlock(ctx, chain, txid)
+	if err != nil {
+		v.logger.Warnf("[verifier] cannot get block for burn tx=%v (%v): %v", transaction.Hash.String(), transaction.Selector.String(), err)
+		return nil
+	}
+
+	var reason string
+	if blocks := block.LatestHeight - block.Height; checkBlocks && block.LatestHeight > block.Height && blocks > maxBlocks {
+		reason = fmt.Sprintf("%v blocks old, exceeding the maximum of %v", blocks, maxBlocks)
+	} else if age := time.Since(block.Time); v.limit.MaxAge > 0 && age > v.limit.MaxAge {
+		reason = fmt.Sprintf("%v old, exceeding the maximum of %v", age.Truncate(time.Second), v.limit.MaxAge)
+	}
+	if reason == "" {
+		return nil
+	}
+	if v.limit.RecoveryURL == "" {
+		return fmt.Errorf("burn is %v; it can no longer be processed automatically and must be recovered manually", reason)
+	}
+	return fmt.Errorf("burn is %v; it can no longer be processed automatically and must be recovered manually, see %v", reason, v.limit.RecoveryURL)
+}
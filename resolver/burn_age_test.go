@@ -0,0 +1,86 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/tx"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+type mockBurnBlockFetcher struct {
+	block BurnBlock
+	err   error
+}
+
+func (fetcher mockBurnBlockFetcher) FetchBurnBlock(ctx context.Context, chain multichain.Chain, txid pack.Bytes) (BurnBlock, error) {
+	return fetcher.block, fetcher.err
+}
+
+var _ = Describe("Burn age verifier", func() {
+	burnTx := func(selector tx.Selector) tx.Tx {
+		input, err := pack.Encode(engine.LockMintBurnReleaseInput{
+			Txid:   pack.Bytes{1, 2, 3},
+			Amount: pack.NewU256FromU64(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		transaction, err := tx.NewTx(selector, pack.Typed(input.(pack.Struct)))
+		Expect(err).NotTo(HaveOccurred())
+		return transaction
+	}
+
+	limit := BurnAgeLimit{
+		MaxAge:      30 * 24 * time.Hour,
+		MaxBlocks:   map[multichain.Chain]uint64{multichain.Ethereum: 1000},
+		RecoveryURL: "https://example.com/recovery",
+	}
+
+	It("should accept recent burns", func() {
+		fetcher := mockBurnBlockFetcher{block: BurnBlock{Height: 100, Time: time.Now().Add(-time.Hour), LatestHeight: 200}}
+		verifier := NewBurnAgeVerifier(mockVerifier{}, logging.FromLogrus(logrus.New()), fetcher, limit)
+		Expect(verifier.VerifyTx(context.Background(), burnTx("BTC/fromEthereum"))).To(Succeed())
+	})
+
+	It("should reject burns which are too many blocks old", func() {
+		fetcher := mockBurnBlockFetcher{block: BurnBlock{Height: 100, Time: time.Now(), LatestHeight: 1101}}
+		verifier := NewBurnAgeVerifier(mockVerifier{}, logging.FromLogrus(logrus.New()), fetcher, limit)
+		err := verifier.VerifyTx(context.Background(), burnTx("BTC/fromEthereum"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("1001 blocks old"))
+		Expect(err.Error()).To(ContainSubstring(limit.RecoveryURL))
+	})
+
+	It("should reject burns which are too long ago", func() {
+		fetcher := mockBurnBlockFetcher{block: BurnBlock{Height: 100, Time: time.Now().Add(-60 * 24 * time.Hour), LatestHeight: 200}}
+		verifier := NewBurnAgeVerifier(mockVerifier{}, logging.FromLogrus(logrus.New()), fetcher, limit)
+		err := verifier.VerifyTx(context.Background(), burnTx("BTC/fromEthereum"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("recovered manually"))
+	})
+
+	It("should not check burns submitted by the lightnode itself", func() {
+		fetcher := mockBurnBlockFetcher{block: BurnBlock{Height: 100, Time: time.Now().Add(-60 * 24 * time.Hour), LatestHeight: 5000}}
+		verifier := NewBurnAgeVerifier(mockVerifier{}, logging.FromLogrus(logrus.New()), fetcher, limit)
+		Expect(verifier.VerifyTx(lhttp.WithInternal(context.Background()), burnTx("BTC/fromEthereum"))).To(Succeed())
+	})
+
+	It("should leave other txs and unknown blocks to the verifier", func() {
+		fetcher := mockBurnBlockFetcher{err: errors.New("not found")}
+		verifier := NewBurnAgeVerifier(mockVerifier{}, logging.FromLogrus(logrus.New()), fetcher, limit)
+		Expect(verifier.VerifyTx(context.Background(), burnTx("BTC/fromEthereum"))).To(Succeed())
+
+		fetcher = mockBurnBlockFetcher{block: BurnBlock{Height: 100, Time: time.Now(), LatestHeight: 5000}}
+		verifier = NewBurnAgeVerifier(mockVerifier{}, logging.FromLogrus(logrus.New()), fetcher, limit)
+		Expect(verifier.VerifyTx(context.Background(), burnTx("BTC/toEthereum"))).To(Succeed())
+	})
+})
@@ -0,0 +1,56 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/pack"
+)
+
+// MethodQueryBurnsByRef looks up burns by their ref, so that legacy explorer
+// links and support workflows which only have the ref of a burn can find its
+// RenVM tx.
+const MethodQueryBurnsByRef = "ren_queryBurnsByRef"
+
+// ParamsQueryBurnsByRef selects the burns with either the given ref, which is
+// the u64 by which v0 txs and gateway contracts identify a burn, or the nonce
+// of the v1 tx, which is the ref as a big-endian bytes32. Each gateway
+// numbers its burns separately, so the selector narrows the burns down to
+// those of a single asset and host chain.
+type ParamsQueryBurnsByRef struct {
+	Ref      *pack.U64     `json:"ref"`
+	Nonce    *pack.Bytes32 `json:"nonce"`
+	Selector tx.Selector   `json:"selector"`
+}
+
+func (resolver *Resolver) QueryBurnsByRef(ctx context.Context, id interface{}, params *ParamsQueryBurnsByRef, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodQueryBurnsByRef, req)
+
+	var nonce pack.Bytes32
+	switch {
+	case params.Ref != nil && params.Nonce != nil:
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "only one of ref and nonce can be given"))
+	case params.Ref != nil:
+		copy(nonce[:], pack.NewU256FromU64(*params.Ref).Bytes())
+	case params.Nonce != nil:
+		nonce = *params.Nonce
+	default:
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "ref or nonce is required"))
+	}
+	if params.Selector != "" && !params.Selector.IsBurn() {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "selector %v is not a burn", params.Selector))
+	}
+	logger = logger.WithField("nonce", nonce.String())
+
+	txs, err := resolver.db.BurnsByNonce(nonce, params.Selector.String())
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot fetch burns by ref from db")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch burns: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	return jsonrpc.NewResponse(id, ResponseQueryTxs{Txs: txs, Total: len(txs)}, nil)
+}
@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	lerrors "github.com/renproject/lightnode/errors"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/multichain"
+)
+
+// MethodUpdateChains adds EVM host chains, or pauses and resumes the watchers
+// of chains, without restarting the Lightnode. It is an admin method, so it
+// requires the admin token as a bearer token or an admin client certificate.
+const MethodUpdateChains = "ren_updateChains"
+
+// ParamsUpdateChains adds the host chains first, then pauses chains, and then
+// resumes them. Host chains are defined by the Lightnode, so they are passed
+// on to the ChainUpdater as they are.
+type ParamsUpdateChains struct {
+	Add    []json.RawMessage  `json:"add"`
+	Pause  []multichain.Chain `json:"pause"`
+	Resume []multichain.Chain `json:"resume"`
+}
+
+// ResponseUpdateChains is the status of every watched chain after the update.
+type ResponseUpdateChains struct {
+	Chains []watcher.ChainStatus `json:"chains"`
+}
+
+// A ChainUpdater applies updates to the watched chains. Changes made before an
+// error are kept.
+type ChainUpdater interface {
+	UpdateChains(ctx context.Context, params ParamsUpdateChains) ([]watcher.ChainStatus, error)
+}
+
+// WithChainUpdater sets the updater which serves ren_updateChains, and the
+// admin token with which requests for it are authenticated. Without it, the
+// method cannot be called.
+func (resolver *Resolver) WithChainUpdater(updater ChainUpdater, adminToken string) *Resolver {
+	resolver.chainUpdater = updater
+	resolver.adminToken = adminToken
+	return resolver
+}
+
+func (resolver *Resolver) UpdateChains(ctx context.Context, id interface{}, params *ParamsUpdateChains, req *http.Request) jsonrpc.Response {
+	if resolver.chainUpdater == nil || req == nil || !lhttp.IsAdmin(resolver.adminToken, req) {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrUnauthorized, "updating chains requires admin authentication"))
+	}
+	statuses, err := resolver.chainUpdater.UpdateChains(ctx, *params)
+	if err != nil {
+		resolver.requestLogger(id, MethodUpdateChains, req).WithError(err).Error("[resolver] cannot update chains")
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "%v", err))
+	}
+	return jsonrpc.NewResponse(id, ResponseUpdateChains{Chains: statuses}, nil)
+}
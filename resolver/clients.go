@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/logging"
+)
+
+// Headers which clients can set to identify themselves when submitting txs.
+const (
+	RenJSVersionHeader = "x-renjs-version"
+	IntegratorHeader   = "x-integrator"
+)
+
+// maxClientFieldLength limits the length of each recorded header, as they are
+// set by clients.
+const maxClientFieldLength = 128
+
+// DefaultClientSummaryPeriod is the period covered by the client summary if
+// the request does not specify one.
+const DefaultClientSummaryPeriod = 7 * 24 * time.Hour
+
+// clientMetadata returns the metadata identifying the client which made the
+// request.
+func clientMetadata(req *http.Request) db.ClientMetadata {
+	if req == nil {
+		return db.ClientMetadata{}
+	}
+	return db.ClientMetadata{
+		UserAgent:    truncate(req.UserAgent(), maxClientFieldLength),
+		RenJSVersion: truncate(req.Header.Get(RenJSVersionHeader), maxClientFieldLength),
+		Integrator:   truncate(req.Header.Get(IntegratorHeader), maxClientFieldLength),
+	}
+}
+
+func truncate(str string, n int) string {
+	if len(str) > n {
+		return str[:n]
+	}
+	return str
+}
+
+// ClientsHandler serves the clients endpoint of the admin API. With a hash
+// parameter, it returns the client which submitted the tx. Otherwise, it
+// returns the number of txs submitted by each integrator and RenJS version
+// over the period given by the since parameter (e.g. "72h").
+type ClientsHandler struct {
+	logger logging.Logger
+	db     db.DB
+}
+
+// NewClientsHandler returns a ClientsHandler which reads from the given
+// database.
+func NewClientsHandler(logger logging.Logger, db db.DB) ClientsHandler {
+	return ClientsHandler{logger: logger, db: db}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler ClientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{}
+	if hashStr := r.URL.Query().Get("hash"); hashStr != "" {
+		hashBytes, err := base64.RawURLEncoding.DecodeString(hashStr)
+		if err != nil || len(hashBytes) != len(id.Hash{}) {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+		var hash id.Hash
+		copy(hash[:], hashBytes)
+		metadata, err := handler.db.ClientMetadata(hash)
+		if err == sql.ErrNoRows {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			handler.logger.Errorf("[resolver] cannot get client of tx %v: %v", hashStr, err)
+			http.Error(w, "cannot get client", http.StatusInternalServerError)
+			return
+		}
+		result = metadata
+	} else {
+		since := DefaultClientSummaryPeriod
+		if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+			var err error
+			since, err = time.ParseDuration(sinceStr)
+			if err != nil || since <= 0 {
+				http.Error(w, "invalid period", http.StatusBadRequest)
+				return
+			}
+		}
+		summaries, err := handler.db.ClientSummaries(since)
+		if err != nil {
+			handler.logger.Errorf("[resolver] cannot get client summaries: %v", err)
+			http.Error(w, "cannot get clients", http.StatusInternalServerError)
+			return
+		}
+		result = summaries
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/renproject/darknode/jsonrpc"
+	lerrors "github.com/renproject/lightnode/errors"
+)
+
+// APISchemaVersion is the version of the format of the API description. It is
+// bumped whenever the format changes in a way that breaks generators.
+const APISchemaVersion = 1
+
+// APIDescription is a machine-readable description of the JSON-RPC API, from
+// which client libraries can be generated.
+type APIDescription struct {
+	Version int                 `json:"version"`
+	Methods []MethodDescription `json:"methods"`
+	Errors  []ErrorDescription  `json:"errors"`
+}
+
+// MethodDescription describes a JSON-RPC method and the JSON Schema of its
+// params. Custom methods of the Lightnode are also documented.
+type MethodDescription struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Params      map[string]interface{} `json:"params"`
+}
+
+// ErrorDescription describes an error code which can be returned by the API.
+type ErrorDescription struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+// errorDescriptions are the error codes returned by the Lightnode.
+var errorDescriptions = []ErrorDescription{
+	{jsonrpc.ErrorCodeInvalidJSON, "the request is not valid JSON"},
+	{jsonrpc.ErrorCodeInvalidRequest, "the request is not a valid JSON-RPC request, or its client is over its rate limit"},
+	{jsonrpc.ErrorCodeInvalidParams, "the params do not match the schema of the method, or refer to something which does not exist or conflicts with existing state"},
+	{errorCodeMethodNotFound, "the method does not exist"},
+	{jsonrpc.ErrorCodeInternal, "the request could not be served, because of the lightnode, the darknodes or a chain"},
+	{lerrors.ErrorCodeUnauthorized, "the method requires an api key or admin authentication, and the request did not have it"},
+	{lerrors.ErrorCodeRetryLater, "the lightnode cannot serve the request right now, because it is overloaded, the darknodes are busy or there are too many pending txs; retry it unchanged later"},
+}
+
+// DescribeAPI returns the description of the API, with methods sorted by name.
+// Params schemas are derived from the schemas used to validate params, so the
+// description cannot drift from what is accepted.
+func DescribeAPI() APIDescription {
+	methods := make([]MethodDescription, 0, len(paramSchemas)+len(customMethods))
+	for method, s := range paramSchemas {
+		methods = append(methods, MethodDescription{Name: method, Params: s.describe()})
+	}
+	for method, m := range customMethods {
+		methods = append(methods, MethodDescription{Name: method, Description: m.description, Params: m.schema.describe()})
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+	return APIDescription{
+		Version: APISchemaVersion,
+		Methods: methods,
+		Errors:  errorDescriptions,
+	}
+}
+
+// NewAPISchemaHandler returns an `http.Handler` which serves the description
+// of the API as JSON.
+func NewAPISchemaHandler() http.Handler {
+	description, err := json.Marshal(DescribeAPI())
+	if err != nil {
+		panic(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(description)
+	})
+}
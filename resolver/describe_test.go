@@ -0,0 +1,62 @@
+package resolver_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/jsonrpc"
+	lerrors "github.com/renproject/lightnode/errors"
+)
+
+var _ = Describe("API description", func() {
+	It("should describe every method with its params", func() {
+		description := DescribeAPI()
+		Expect(description.Version).To(Equal(APISchemaVersion))
+		Expect(description.Errors).NotTo(BeEmpty())
+		codes := []int{}
+		for _, e := range description.Errors {
+			codes = append(codes, e.Code)
+		}
+		Expect(codes).To(ContainElements(jsonrpc.ErrorCodeInternal, lerrors.ErrorCodeUnauthorized, lerrors.ErrorCodeRetryLater))
+
+		methods := map[string]map[string]interface{}{}
+		for _, method := range description.Methods {
+			methods[method.Name] = method.Params
+		}
+		for _, method := range []string{jsonrpc.MethodSubmitTx, jsonrpc.MethodQueryTx, MethodSubmitGateway, MethodQueryGateways, MethodPreviewTxHash} {
+			Expect(methods).To(HaveKey(method))
+		}
+		Expect(methods[MethodQueryGateway]["required"]).To(Equal([]string{"gateway"}))
+
+		// Custom methods are documented.
+		for _, method := range description.Methods {
+			if method.Name == MethodQueryTxsByTxid {
+				Expect(method.Description).NotTo(BeEmpty())
+			}
+		}
+
+		// Submitted txs can have either the v1 or the v0 shape.
+		tx := methods[jsonrpc.MethodSubmitTx]["properties"].(map[string]interface{})["tx"].(map[string]interface{})
+		Expect(tx["oneOf"]).To(HaveLen(2))
+	})
+
+	It("should serve the description as JSON", func() {
+		handler := NewAPISchemaHandler()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/schema", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var description APIDescription
+		Expect(json.Unmarshal(w.Body.Bytes(), &description)).To(Succeed())
+		Expect(description.Methods).To(HaveLen(len(DescribeAPI().Methods)))
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/schema", nil))
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
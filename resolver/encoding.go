@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	lhttp "github.com/renproject/lightnode/http"
+)
+
+// hexEncoding returns whether the request asked for the byte fields of txs to
+// be encoded as hex. The encoding is validated before requests reach the
+// resolver.
+func hexEncoding(req *http.Request) bool {
+	return req != nil && req.URL != nil && req.URL.Query().Get(lhttp.EncodingParam) == lhttp.EncodingHex
+}
+
+// withEncoding returns the response with the txs in its result marshalled
+// using the encoding requested by the client. Txs marshal as base64 by
+// default, so results are only replaced when hex is requested. Results
+// without txs, and results of the Darknodes which could not be decoded, are
+// returned as they are.
+func withEncoding(response jsonrpc.Response, req *http.Request) jsonrpc.Response {
+	if !hexEncoding(req) || response.Result == nil {
+		return response
+	}
+
+	switch result := response.Result.(type) {
+	case jsonrpc.ResponseQueryTx:
+		response.Result = struct {
+			jsonrpc.ResponseQueryTx
+			Tx lhttp.HexTx `json:"tx"`
+		}{result, lhttp.HexTx(result.Tx)}
+	case ResponseQueryTxFormatted:
+		response.Result = struct {
+			ResponseQueryTxFormatted
+			Tx lhttp.HexTx `json:"tx"`
+		}{result, lhttp.HexTx(result.ResponseQueryTx.Tx)}
+	case ResponseQueryGateway:
+		response.Result = struct {
+			ResponseQueryGateway
+			Tx lhttp.HexTx `json:"tx"`
+		}{result, lhttp.HexTx(result.Tx)}
+	case ResponseQueryGateways:
+		type hexGateway struct {
+			QueriedGateway
+			Tx lhttp.HexTx `json:"tx"`
+		}
+		gateways := make([]hexGateway, len(result.Gateways))
+		for i, gateway := range result.Gateways {
+			gateways[i] = hexGateway{gateway, lhttp.HexTx(gateway.Tx)}
+		}
+		response.Result = struct {
+			ResponseQueryGateways
+			Gateways []hexGateway `json:"gateways"`
+		}{result, gateways}
+	case jsonrpc.ResponseQueryTxs:
+		response.Result = struct {
+			Txs []lhttp.HexTx `json:"txs"`
+		}{hexTxs(result.Txs)}
+	case ResponseQueryTxs:
+		response.Result = struct {
+			ResponseQueryTxs
+			Txs []lhttp.HexTx `json:"txs"`
+		}{result, hexTxs(result.Txs)}
+	case ResponseQueryTxsPaged:
+		response.Result = struct {
+			ResponseQueryTxsPaged
+			Txs []lhttp.HexTx `json:"txs"`
+		}{result, hexTxs(result.Txs)}
+	case ResponseQueryTxsByRecipient:
+		response.Result = struct {
+			ResponseQueryTxsByRecipient
+			Txs []lhttp.HexTx `json:"txs"`
+		}{result, hexTxs(result.Txs)}
+	case v0.ResponseQueryTx:
+		response.Result = struct {
+			v0.ResponseQueryTx
+			Tx v0.HexTx `json:"tx"`
+		}{result, v0.HexTx(result.Tx)}
+	}
+	return response
+}
+
+func hexTxs(txs []tx.Tx) []lhttp.HexTx {
+	encoded := make([]lhttp.HexTx, len(txs))
+	for i, transaction := range txs {
+		encoded[i] = lhttp.HexTx(transaction)
+	}
+	return encoded
+}
@@ -0,0 +1,158 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/pack"
+)
+
+// DefaultEpochPollRate is how often the block state is queried for epoch
+// changes. Epochs change rarely, and the block state is cached, so it does
+// not need to be queried often.
+const DefaultEpochPollRate = time.Minute
+
+// EpochChange describes a change of RenVM epoch or of its shards. Gateways
+// generated before the change may use a shard which is being retired, and
+// mints may take longer while RenVM moves funds to the new shards.
+type EpochChange struct {
+	Epoch         uint64       `json:"epoch"`
+	EpochHash     pack.Bytes32 `json:"epochHash"`
+	PreviousEpoch uint64       `json:"previousEpoch"`
+	// ShardsChanged is whether the primary shards changed, in which case
+	// gateways should be refreshed.
+	ShardsChanged bool         `json:"shardsChanged"`
+	Shards        []pack.Bytes `json:"shards"`
+}
+
+// EpochWatcher queries the block state of the Darknodes and notifies its
+// listeners when the epoch or the primary shards change.
+type EpochWatcher struct {
+	logger    logging.Logger
+	resolver  jsonrpc.Resolver
+	pollRate  time.Duration
+	listeners []func(EpochChange)
+	clock     *clock.Monotonic
+}
+
+// epoch is the part of the system state which is watched.
+type epoch struct {
+	number    uint64
+	hash      pack.Bytes32
+	shards    []pack.Bytes
+	timestamp uint64
+}
+
+// NewEpochWatcher returns an EpochWatcher which queries the block state from
+// the given resolver with the poll rate.
+func NewEpochWatcher(logger logging.Logger, resolver jsonrpc.Resolver, pollRate time.Duration, listeners ...func(EpochChange)) EpochWatcher {
+	return EpochWatcher{
+		logger:    logger,
+		resolver:  resolver,
+		pollRate:  pollRate,
+		listeners: listeners,
+	}
+}
+
+// WithClock corrects the clock with the timestamp of the epoch, which has
+// always passed, so that a host clock which is behind RenVM does not make txs
+// look older than they are.
+func (watcher EpochWatcher) WithClock(clock *clock.Monotonic) EpochWatcher {
+	watcher.clock = clock
+	return watcher
+}
+
+// Run watches the epoch until the context is done. The first epoch it sees is
+// not a change, so listeners are only notified of changes which happen while
+// the Lightnode is running.
+func (watcher EpochWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(watcher.pollRate)
+	defer ticker.Stop()
+
+	var last *epoch
+	for {
+		current, err := watcher.epoch(ctx)
+		if err != nil {
+			watcher.logger.Warnf("[epochs] cannot query epoch: %v", err)
+		} else {
+			if last != nil {
+				if change, ok := diffEpochs(*last, current); ok {
+					watcher.logger.Infof("[epochs] epoch changed from %v to %v (shards changed=%v)", change.PreviousEpoch, change.Epoch, change.ShardsChanged)
+					for _, listener := range watcher.listeners {
+						listener(change)
+					}
+				}
+			}
+			last = &current
+
+			if watcher.clock != nil && current.timestamp > 0 {
+				if correction := watcher.clock.Observe(time.Unix(int64(current.timestamp), 0)); correction > 0 {
+					watcher.logger.Warnf("[epochs] clock is %v behind the epoch timestamp, moving it forward", correction.Round(time.Second))
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// epoch returns the current epoch from the system state.
+func (watcher EpochWatcher) epoch(ctx context.Context) (epoch, error) {
+	response := watcher.resolver.QueryBlockState(ctx, nil, &jsonrpc.ParamsQueryBlockState{}, nil)
+	if response.Error != nil {
+		return epoch{}, fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+	}
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return epoch{}, err
+	}
+	var resp jsonrpc.ResponseQueryBlockState
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return epoch{}, err
+	}
+	var system engine.SystemState
+	if err := pack.Decode(&system, resp.State.Get("System")); err != nil {
+		return epoch{}, fmt.Errorf("decoding system state: %v", err)
+	}
+
+	shards := make([]pack.Bytes, 0, len(system.Shards.Primary))
+	for _, shard := range system.Shards.Primary {
+		shards = append(shards, shard.PubKey)
+	}
+	return epoch{
+		number:    uint64(system.Epoch.Number),
+		hash:      system.Epoch.Hash,
+		shards:    shards,
+		timestamp: uint64(system.Epoch.Timestamp),
+	}, nil
+}
+
+// diffEpochs returns the change from the previous to the current epoch, if
+// there is one.
+func diffEpochs(previous, current epoch) (EpochChange, bool) {
+	shardsChanged := len(previous.shards) != len(current.shards)
+	for i := 0; !shardsChanged && i < len(current.shards); i++ {
+		shardsChanged = !bytes.Equal(previous.shards[i], current.shards[i])
+	}
+	if !shardsChanged && previous.number == current.number && previous.hash == current.hash {
+		return EpochChange{}, false
+	}
+	return EpochChange{
+		Epoch:         current.number,
+		EpochHash:     current.hash,
+		PreviousEpoch: previous.number,
+		ShardsChanged: shardsChanged,
+		Shards:        current.shards,
+	}, true
+}
@@ -0,0 +1,93 @@
+package resolver_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/testutils"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// systemStateResolver responds to queryBlockState requests with a system state
+// which can be changed.
+type systemStateResolver struct {
+	jsonrpc.Resolver
+
+	mu     *sync.Mutex
+	system engine.SystemState
+}
+
+func (resolver *systemStateResolver) QueryBlockState(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlockState, req *http.Request) jsonrpc.Response {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	system, err := pack.Encode(resolver.system)
+	Expect(err).NotTo(HaveOccurred())
+	state := pack.Typed{pack.NewStructField("System", system)}
+	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryBlockState{State: state}, nil)
+}
+
+func (resolver *systemStateResolver) update(f func(system *engine.SystemState)) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	f(&resolver.system)
+}
+
+var _ = Describe("Epoch watcher", func() {
+	init := func(ctx context.Context) (*systemStateResolver, chan EpochChange) {
+		resolver := &systemStateResolver{mu: new(sync.Mutex), system: testutils.MockSystemState()}
+		changes := make(chan EpochChange, 8)
+		watcher := NewEpochWatcher(logging.FromLogrus(logrus.New()), resolver, 20*time.Millisecond, func(change EpochChange) {
+			changes <- change
+		})
+		go watcher.Run(ctx)
+		return resolver, changes
+	}
+
+	It("should notify listeners when the epoch changes", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resolver, changes := init(ctx)
+
+		// The first epoch is not a change.
+		Consistently(changes, 100*time.Millisecond).ShouldNot(Receive())
+
+		resolver.update(func(system *engine.SystemState) {
+			system.Epoch.Number = 1
+			system.Epoch.Hash = pack.Bytes32{1}
+		})
+		var change EpochChange
+		Eventually(changes).Should(Receive(&change))
+		Expect(change.Epoch).To(Equal(uint64(1)))
+		Expect(change.PreviousEpoch).To(Equal(uint64(0)))
+		Expect(change.EpochHash).To(Equal(pack.Bytes32{1}))
+		Expect(change.ShardsChanged).To(BeFalse())
+
+		Consistently(changes, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should notify listeners when the shards rotate", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resolver, changes := init(ctx)
+		Consistently(changes, 100*time.Millisecond).ShouldNot(Receive())
+
+		pubKey := pack.Bytes{2, 3}
+		resolver.update(func(system *engine.SystemState) {
+			system.Shards.Primary = []engine.SystemStateShardsShard{{Shard: pack.Bytes32{2}, PubKey: pubKey}}
+		})
+		var change EpochChange
+		Eventually(changes).Should(Receive(&change))
+		Expect(change.ShardsChanged).To(BeTrue())
+		Expect(change.Shards).To(Equal([]pack.Bytes{pubKey}))
+	})
+})
@@ -0,0 +1,168 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	lerrors "github.com/renproject/lightnode/errors"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// MethodEstimateFee estimates the fees of a tx from the block state, so that
+// dapps do not need to reimplement the fee calculation.
+const MethodEstimateFee = "ren_estimateFee"
+
+// feeDenominator is the denominator of the mint and burn fees in the block
+// state, which are given in basis points.
+const feeDenominator = 10000
+
+// ParamsEstimateFee is the selector and amount of a tx. The amount is in the
+// smallest unit of the asset.
+type ParamsEstimateFee struct {
+	Selector tx.Selector `json:"selector"`
+	Amount   pack.U256   `json:"amount"`
+}
+
+// ResponseEstimateFee is the breakdown of the fees of a tx, in the smallest
+// unit of the asset. The mint and burn fees are a share of the amount, and
+// the lock and release fees pay for the tx on the origin chain of the asset.
+// Fees which do not apply to the selector are zero. Received is what is left
+// of the amount on the destination chain, or zero if the fees exceed it.
+type ResponseEstimateFee struct {
+	MintFee       pack.U256 `json:"mintFee"`
+	BurnFee       pack.U256 `json:"burnFee"`
+	LockFee       pack.U256 `json:"lockFee"`
+	ReleaseFee    pack.U256 `json:"releaseFee"`
+	MinimumAmount pack.U256 `json:"minimumAmount"`
+	Received      pack.U256 `json:"received"`
+}
+
+func (resolver *Resolver) EstimateFee(ctx context.Context, id interface{}, params *ParamsEstimateFee, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodEstimateFee, req).WithField("selector", params.Selector)
+
+	if !params.Selector.IsLock() && !params.Selector.IsBurn() {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "unsupported selector %v", params.Selector))
+	}
+	asset := params.Selector.Asset()
+
+	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, jsonrpc.ParamsQueryBlockState{}, nil)
+	if ok := resolver.cacher.Send(reqWithResponder); !ok {
+		logger.Error("[resolver] failed to send request to cacher, too much back pressure")
+		return lerrors.Response(id, lerrors.ErrBackpressure)
+	}
+	var response jsonrpc.Response
+	select {
+	case <-ctx.Done():
+		logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for response")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	case response = <-reqWithResponder.Responder:
+	}
+	if response.Error != nil {
+		return jsonrpc.NewResponse(id, nil, response.Error)
+	}
+
+	state, err := decodeAssetState(response, asset)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot decode block state")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to decode block state", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if state == nil {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "unknown asset %v", asset))
+	}
+	return jsonrpc.NewResponse(id, estimateFee(*state, params.Selector, params.Amount), nil)
+}
+
+// decodeAssetState decodes the block state of the asset from a queryBlockState
+// response. The state is nil if the asset is not in the block state.
+func decodeAssetState(response jsonrpc.Response, asset multichain.Asset) (*engine.XState, error) {
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, err
+	}
+	var resp jsonrpc.ResponseQueryBlockState
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+	value := resp.State.Get(string(asset))
+	if value == nil {
+		return nil, nil
+	}
+	var state engine.XState
+	if err := pack.Decode(&state, value); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// estimateFee calculates the fees of a tx as RenVM does. Lock and mint txs
+// pay the lock fee and the mint fee of the destination chain. Burn and
+// release txs pay the burn fee of the source chain and the release fee. Burn
+// and mint txs pay the burn fee of the source chain and the mint fee of the
+// destination chain.
+func estimateFee(state engine.XState, selector tx.Selector, amount pack.U256) ResponseEstimateFee {
+	zero := pack.NewU256FromU8(0)
+	chainFee := new(big.Int).Mul(state.GasCap.Int(), state.GasLimit.Int())
+	response := ResponseEstimateFee{
+		MintFee:       zero,
+		BurnFee:       zero,
+		LockFee:       zero,
+		ReleaseFee:    zero,
+		MinimumAmount: state.MinimumAmount,
+		Received:      zero,
+	}
+
+	fees := new(big.Int)
+	if selector.IsLock() {
+		response.LockFee = pack.NewU256FromInt(chainFee)
+		fees.Add(fees, chainFee)
+	}
+	if selector.IsBurn() {
+		burnFee := shareOf(amount, hostChainFee(state, selector.Source(), false))
+		response.BurnFee = pack.NewU256FromInt(burnFee)
+		fees.Add(fees, burnFee)
+	}
+	if selector.IsMint() {
+		mintFee := shareOf(amount, hostChainFee(state, selector.Destination(), true))
+		response.MintFee = pack.NewU256FromInt(mintFee)
+		fees.Add(fees, mintFee)
+	}
+	if selector.IsRelease() {
+		response.ReleaseFee = pack.NewU256FromInt(chainFee)
+		fees.Add(fees, chainFee)
+	}
+
+	if received := new(big.Int).Sub(amount.Int(), fees); received.Sign() > 0 {
+		response.Received = pack.NewU256FromInt(received)
+	}
+	return response
+}
+
+// hostChainFee returns the mint or burn fee of the host chain in basis points,
+// or zero if the block state does not have a fee for the chain.
+func hostChainFee(state engine.XState, chain multichain.Chain, mint bool) uint64 {
+	for _, hostChain := range state.Fees.HostChains {
+		if hostChain.Chain != chain {
+			continue
+		}
+		if mint {
+			return uint64(hostChain.MintFee)
+		}
+		return uint64(hostChain.BurnFee)
+	}
+	return 0
+}
+
+// shareOf returns the share of the amount given in basis points.
+func shareOf(amount pack.U256, bps uint64) *big.Int {
+	share := new(big.Int).Mul(amount.Int(), new(big.Int).SetUint64(bps))
+	return share.Div(share, big.NewInt(feeDenominator))
+}
@@ -0,0 +1,179 @@
+package resolver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/pack"
+)
+
+const (
+	// MethodRenewGateway extends the life of a gateway, so that integrators
+	// can keep a gateway which is still receiving deposits from being pruned.
+	// It requires an API key.
+	MethodRenewGateway = "ren_renewGateway"
+
+	// MethodQueryGateways lists gateways, so that explorers can show the
+	// gateways which are open.
+	MethodQueryGateways = "ren_queryGateways"
+)
+
+// DefaultGatewaysPageSize is the number of gateways returned by queryGateways
+// if no limit is given.
+const DefaultGatewaysPageSize = 8
+
+// Limits of gateway renewals. Each renewal only extends the gateway up to the
+// maximum renewal from now, and no renewal extends it beyond the maximum
+// lifetime after it was created.
+const (
+	DefaultGatewayRenewal = 30 * 24 * time.Hour
+	MaxGatewayRenewal     = 180 * 24 * time.Hour
+	MaxGatewayLifetime    = 365 * 24 * time.Hour
+)
+
+// ParamsRenewGateway renews the gateway for the given number of seconds, or
+// for DefaultGatewayRenewal if no duration is given.
+type ParamsRenewGateway struct {
+	Gateway  string   `json:"gateway"`
+	Duration pack.U64 `json:"duration"`
+}
+
+// ResponseRenewGateway is the status of a renewed gateway and the unix
+// timestamp until which it is kept.
+type ResponseRenewGateway struct {
+	Gateway string `json:"gateway"`
+	Status  string `json:"status"`
+	Expiry  int64  `json:"expiry"`
+}
+
+// ParamsQueryGateways selects a page of gateways, most recent first. The status
+// is one of "empty", "used" or "invalid", or empty to list all gateways.
+type ParamsQueryGateways struct {
+	Offset pack.U64 `json:"offset"`
+	Limit  pack.U64 `json:"limit"`
+	Status string   `json:"status"`
+}
+
+// QueriedGateway is a gateway listed by queryGateways. The expiry is only set
+// once the gateway has been renewed.
+type QueriedGateway struct {
+	Gateway     string `json:"gateway"`
+	Tx          tx.Tx  `json:"tx"`
+	Status      string `json:"status"`
+	CreatedTime int64  `json:"createdTime"`
+	Expiry      int64  `json:"expiry,omitempty"`
+}
+
+// ResponseQueryGateways is a page of gateways, and whether there is another.
+type ResponseQueryGateways struct {
+	Gateways []QueriedGateway `json:"gateways"`
+	HasMore  bool             `json:"hasMore"`
+}
+
+// gatewayStatuses are the statuses by which gateways can be filtered.
+var gatewayStatuses = map[string]db.GatewayStatus{
+	"":                               db.GatewayStatusNil,
+	db.GatewayStatusEmpty.String():   db.GatewayStatusEmpty,
+	db.GatewayStatusUsed.String():    db.GatewayStatusUsed,
+	db.GatewayStatusInvalid.String(): db.GatewayStatusInvalid,
+}
+
+func (resolver *Resolver) QueryGateways(ctx context.Context, id interface{}, params *ParamsQueryGateways, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodQueryGateways, req)
+
+	status, ok := gatewayStatuses[params.Status]
+	if !ok {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "unknown gateway status %q", params.Status))
+	}
+	limit := uint64(params.Limit)
+	if limit == 0 {
+		limit = DefaultGatewaysPageSize
+	}
+	if maxPageSize := uint64(resolver.serverOptions.MaxPageSize); maxPageSize > 0 && limit > maxPageSize {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "limit must be at most %v", maxPageSize))
+	}
+
+	// An extra gateway is fetched to tell whether there is another page.
+	gateways, err := resolver.db.Gateways(int(params.Offset), int(limit)+1, status)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot fetch gateways from db")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch gateways: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	response := ResponseQueryGateways{
+		Gateways: make([]QueriedGateway, 0, len(gateways)),
+		HasMore:  len(gateways) > int(limit),
+	}
+	if response.HasMore {
+		gateways = gateways[:limit]
+	}
+	for _, gateway := range gateways {
+		response.Gateways = append(response.Gateways, QueriedGateway{
+			Gateway:     gateway.Address,
+			Tx:          gateway.Tx,
+			Status:      gateway.Status.String(),
+			CreatedTime: gateway.CreatedTime,
+			Expiry:      gateway.Expiry,
+		})
+	}
+	return jsonrpc.NewResponse(id, response, nil)
+}
+
+func (resolver *Resolver) RenewGateway(ctx context.Context, id interface{}, params *ParamsRenewGateway, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodRenewGateway, req).WithField("gateway", params.Gateway)
+
+	// Renewals keep gateways in the database, so anonymous clients cannot
+	// renew them.
+	if resolver.admission == nil || resolver.admission.Tier(req) == AnonymousTier {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrUnauthorized, "renewing a gateway requires an api key"))
+	}
+
+	duration := DefaultGatewayRenewal
+	if seconds := uint64(params.Duration); seconds != 0 {
+		if seconds > uint64(MaxGatewayRenewal/time.Second) {
+			return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "cannot renew gateway for more than %v seconds", uint64(MaxGatewayRenewal/time.Second)))
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	address, _, err := resolver.gateway(params.Gateway)
+	if err == sql.ErrNoRows {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrNotFound, "gateway %v not found", params.Gateway))
+	}
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot get gateway")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to renew gateway", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	status, err := resolver.db.GatewayStatus(address)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot get gateway status")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to renew gateway", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if status == db.GatewayStatusInvalid {
+		return lerrors.Response(id, invalidGatewayError(params.Gateway))
+	}
+
+	expiry, err := resolver.db.RenewGateway(address, resolver.db.Clock().Now().Add(duration), MaxGatewayLifetime)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot renew gateway")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to renew gateway", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	logger.WithField("expiry", expiry).Info("[resolver] renewed gateway")
+	return jsonrpc.NewResponse(id, ResponseRenewGateway{Gateway: address, Status: status.String(), Expiry: expiry}, nil)
+}
+
+// invalidGatewayError is returned for gateways of retired shards, which must
+// not be shown to users.
+func invalidGatewayError(gateway string) error {
+	return lerrors.Wrapf(lerrors.ErrNotFound, "gateway %v is invalid: the shard it was derived from has been retired, so deposits to it cannot be processed; generate a new gateway", gateway)
+}
@@ -0,0 +1,167 @@
+package resolver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/renproject/darknode/tx"
+)
+
+// A Journal is an append-only file of txs which have been accepted but not yet
+// written to the database. Entries are synced to disk before a submission is
+// acknowledged, so that they can be replayed if the Lightnode stops before
+// they are written.
+type Journal struct {
+	mu      *sync.Mutex
+	file    *os.File
+	pending int
+	kept    []tx.Tx
+	torn    int64
+}
+
+// OpenJournal opens the journal at the given path, creating it if it does not
+// exist. Entries left by a previous run are returned by Entries. An incomplete
+// final entry, left by a write which was interrupted, was never acknowledged,
+// so it is removed before anything else is appended and its length is
+// reported by Torn.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	end, err := entriesEnd(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if end < info.Size() {
+		if err := file.Truncate(end); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("removing incomplete entry: %v", err)
+		}
+	}
+	return &Journal{
+		mu:   new(sync.Mutex),
+		file: file,
+		torn: info.Size() - end,
+	}, nil
+}
+
+// entriesEnd returns the offset of the end of the last complete entry in the
+// file.
+func entriesEnd(file *os.File) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	end := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		end += int64(len(line))
+	}
+}
+
+// Torn returns the number of bytes of the incomplete final entry which was
+// removed when the journal was opened, or zero if every entry was complete.
+func (journal *Journal) Torn() int64 {
+	return journal.torn
+}
+
+// Entries returns the txs in the journal.
+func (journal *Journal) Entries() ([]tx.Tx, error) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	if _, err := journal.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(journal.file)
+	txs := []tx.Tx{}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return txs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var transaction tx.Tx
+		if err := json.Unmarshal(line, &transaction); err != nil {
+			return nil, fmt.Errorf("decoding entry %v: %v", len(txs), err)
+		}
+		txs = append(txs, transaction)
+	}
+}
+
+// Append writes the tx to the journal and syncs it to disk.
+func (journal *Journal) Append(transaction tx.Tx) error {
+	entry, err := json.Marshal(transaction)
+	if err != nil {
+		return err
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if _, err := journal.file.Write(append(entry, '\n')); err != nil {
+		return err
+	}
+	if err := journal.file.Sync(); err != nil {
+		return err
+	}
+	journal.pending++
+	return nil
+}
+
+// Done marks n appended entries as no longer pending, either because they
+// have been written to the database or because writing them has been given
+// up on. The txs which could not be written are given as kept, and stay in
+// the journal so that they are replayed by the next run. Once no entries are
+// pending, the journal is truncated to the kept txs.
+func (journal *Journal) Done(n int, kept ...tx.Tx) error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	journal.pending -= n
+	journal.kept = append(journal.kept, kept...)
+	if journal.pending > 0 {
+		return nil
+	}
+	journal.pending = 0
+	if err := journal.file.Truncate(0); err != nil {
+		return err
+	}
+	if len(journal.kept) == 0 {
+		return nil
+	}
+	entries := []byte{}
+	for _, transaction := range journal.kept {
+		entry, err := json.Marshal(transaction)
+		if err != nil {
+			return err
+		}
+		entries = append(append(entries, entry...), '\n')
+	}
+	if _, err := journal.file.Write(entries); err != nil {
+		return err
+	}
+	return journal.file.Sync()
+}
+
+// Close closes the journal file.
+func (journal *Journal) Close() error {
+	return journal.file.Close()
+}
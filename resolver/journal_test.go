@@ -0,0 +1,101 @@
+package resolver_test
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/tx/txutil"
+)
+
+var _ = Describe("Journal", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "journal")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should keep entries until they have all been written", func() {
+		path := filepath.Join(dir, "journal")
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		first, second := txutil.RandomGoodTx(r), txutil.RandomGoodTx(r)
+
+		journal, err := OpenJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Append(first)).To(Succeed())
+		Expect(journal.Append(second)).To(Succeed())
+		Expect(journal.Done(1)).To(Succeed())
+		Expect(journal.Close()).To(Succeed())
+
+		// Simulate a restart, where a write was interrupted after the entries
+		// were synced.
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = file.Write([]byte(`{"hash":`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		journal, err = OpenJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer journal.Close()
+		Expect(journal.Torn()).To(Equal(int64(len(`{"hash":`))))
+		entries, err := journal.Entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Hash).To(Equal(first.Hash))
+		Expect(entries[1].Hash).To(Equal(second.Hash))
+
+		// Entries appended after the incomplete entry can be read.
+		third := txutil.RandomGoodTx(r)
+		Expect(journal.Append(third)).To(Succeed())
+		entries, err = journal.Entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[2].Hash).To(Equal(third.Hash))
+
+		Expect(journal.Done(1)).To(Succeed())
+		entries, err = journal.Entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("should keep the txs which could not be written", func() {
+		path := filepath.Join(dir, "journal")
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		first, second, third := txutil.RandomGoodTx(r), txutil.RandomGoodTx(r), txutil.RandomGoodTx(r)
+
+		journal, err := OpenJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Append(first)).To(Succeed())
+		Expect(journal.Append(second)).To(Succeed())
+		Expect(journal.Done(2, second)).To(Succeed())
+		entries, err := journal.Entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Hash).To(Equal(second.Hash))
+
+		// The kept tx stays in the journal when it is next truncated.
+		Expect(journal.Append(third)).To(Succeed())
+		Expect(journal.Done(1)).To(Succeed())
+		Expect(journal.Close()).To(Succeed())
+
+		journal, err = OpenJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer journal.Close()
+		entries, err = journal.Entries()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Hash).To(Equal(second.Hash))
+	})
+})
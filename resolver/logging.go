@@ -0,0 +1,163 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/metrics"
+)
+
+// requestLogger returns a logger annotated with the fields that identify a
+// request, so that every log line for the request can be correlated.
+func (resolver *Resolver) requestLogger(id interface{}, method string, req *http.Request) logging.Logger {
+	return requestFields(resolver.logger, id, method, req)
+}
+
+func requestFields(logger logging.Logger, id interface{}, method string, req *http.Request) logging.Logger {
+	fields := logging.Fields{
+		"method":    method,
+		"requestID": id,
+	}
+	if ip := clientIP(req); ip != "" {
+		fields["clientIP"] = ip
+	}
+	return logger.WithFields(fields)
+}
+
+// clientIP returns the IP address of the client that made the request. The
+// right-most entry of the x-forwarded-for header is used if it exists, as it is
+// the one appended by our load balancer.
+func clientIP(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	forwarded := strings.Split(req.Header.Get("x-forwarded-for"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if ip := strings.TrimSpace(forwarded[i]); ip != "" {
+			return ip
+		}
+	}
+	return req.RemoteAddr
+}
+
+// LoggingResolver wraps a jsonrpc.Resolver and logs the outcome and duration of
+// every request it handles.
+type LoggingResolver struct {
+	inner  jsonrpc.Resolver
+	logger logging.Logger
+}
+
+// NewLoggingResolver returns a new LoggingResolver wrapping the given resolver.
+func NewLoggingResolver(inner jsonrpc.Resolver, logger logging.Logger) *LoggingResolver {
+	return &LoggingResolver{
+		inner:  inner,
+		logger: logger,
+	}
+}
+
+func (lr *LoggingResolver) QueryBlock(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlock, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryBlock, req, &response)()
+	return lr.inner.QueryBlock(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryBlocks(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlocks, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryBlocks, req, &response)()
+	return lr.inner.QueryBlocks(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) SubmitTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsSubmitTx, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodSubmitTx, req, &response)()
+	return lr.inner.SubmitTx(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTx, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryTx, req, &response)()
+	return lr.inner.QueryTx(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryTxs(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTxs, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryTxs, req, &response)()
+	return lr.inner.QueryTxs(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryPeers(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryPeers, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryPeers, req, &response)()
+	return lr.inner.QueryPeers(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryNumPeers(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryNumPeers, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryNumPeers, req, &response)()
+	return lr.inner.QueryNumPeers(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryShards(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryShards, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryShards, req, &response)()
+	return lr.inner.QueryShards(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryStat(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryStat, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryStat, req, &response)()
+	return lr.inner.QueryStat(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryFees(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryFees, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryFees, req, &response)()
+	return lr.inner.QueryFees(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryConfig(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryConfig, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryConfig, req, &response)()
+	return lr.inner.QueryConfig(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryState(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryState, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryState, req, &response)()
+	return lr.inner.QueryState(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) QueryBlockState(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlockState, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, jsonrpc.MethodQueryBlockState, req, &response)()
+	return lr.inner.QueryBlockState(ctx, id, params, req)
+}
+
+func (lr *LoggingResolver) Fallback(ctx context.Context, id interface{}, method string, params interface{}, req *http.Request) (response jsonrpc.Response) {
+	defer lr.track(time.Now(), id, fallbackMethod(method), req, &response)()
+	return lr.inner.Fallback(ctx, id, method, params, req)
+}
+
+// unknownMethod is the method that requests for methods which are not
+// registered are tracked as.
+const unknownMethod = "unknown"
+
+// fallbackMethod returns the method that a request resolved by Fallback is
+// tracked as. Clients can send any method name, so methods outside
+// customMethods are grouped together to bound the number of metrics labels.
+func fallbackMethod(method string) string {
+	if _, ok := customMethods[method]; ok {
+		return method
+	}
+	return unknownMethod
+}
+
+// track returns a function which logs the outcome and duration of the request,
+// and records them in the metrics, when called. It is expected to be deferred
+// so that the response has been populated by the time it runs.
+func (lr *LoggingResolver) track(start time.Time, id interface{}, method string, req *http.Request, response *jsonrpc.Response) func() {
+	return func() {
+		metrics.ObserveRequest(method, start, response.Error != nil)
+		logger := requestFields(lr.logger, id, method, req).
+			WithField("durationMs", time.Since(start).Milliseconds())
+		if response.Error != nil {
+			logger.WithFields(logging.Fields{
+				"errorCode":    response.Error.Code,
+				"errorMessage": response.Error.Message,
+			}).Warn("[resolver] request failed")
+			return
+		}
+		logger.Info("[resolver] request handled")
+	}
+}
@@ -0,0 +1,269 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/version"
+)
+
+// errorCodeMethodNotFound is the JSON-RPC error code for methods which do not
+// exist.
+const errorCodeMethodNotFound = -32601
+
+// A customMethod is a method which is served by the Lightnode rather than the
+// Darknodes. Custom methods are described in one place, so that they are
+// validated, rate limited and documented like the methods of the Darknodes.
+type customMethod struct {
+	// description documents the method in the API description.
+	description string
+
+	// schema checks the params before they are unmarshalled.
+	schema schema
+
+	// params returns a pointer to the params of the method, into which the
+	// request params are unmarshalled. It is nil for methods without params.
+	params func() interface{}
+
+	// limitAs is the method whose rate limits apply to this method, unless
+	// limits are configured for this method itself, so that methods which
+	// submit txs cannot be used to get around the limits of ren_submitTx.
+	limitAs string
+
+	// submitsTx is whether the method submits the tx in its params, which is
+	// rejected if its asset has been paused.
+	submitsTx bool
+
+	resolve func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response
+}
+
+// customMethods are the methods served by the Lightnode.
+var customMethods = map[string]customMethod{
+	MethodSubmitGateway: {
+		description: "Submits a mint tx along with its gateway, so that the gateway can be queried before the deposit is detected.",
+		schema: object(
+			required("gateway", stringSchema{}),
+			required("tx", v1TxSchema),
+		),
+		params:    func() interface{} { return new(ParamsSubmitGateway) },
+		limitAs:   jsonrpc.MethodSubmitTx,
+		submitsTx: true,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.SubmitGateway(ctx, id, params.(*ParamsSubmitGateway), req)
+		},
+	},
+	MethodQueryGateway: {
+		description: "Returns the tx of a gateway submitted with ren_submitGateway.",
+		schema: object(
+			required("gateway", stringSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsQueryGateway) },
+		limitAs: jsonrpc.MethodQueryTx,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryGateway(ctx, id, params.(*ParamsQueryGateway), req)
+		},
+	},
+	MethodRenewGateway: {
+		description: "Extends the life of a gateway by the given number of seconds, so that it is not pruned while it still receives deposits. Requires an api key, and gateways cannot be kept for more than a year after they were created.",
+		schema: object(
+			required("gateway", stringSchema{}),
+			optional("duration", uintSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsRenewGateway) },
+		limitAs: jsonrpc.MethodSubmitTx,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.RenewGateway(ctx, id, params.(*ParamsRenewGateway), req)
+		},
+	},
+	MethodQueryGateways: {
+		description: "Returns a page of gateways, most recent first, optionally filtered by status.",
+		schema: object(
+			optional("offset", uintSchema{}),
+			optional("limit", uintSchema{}),
+			optional("status", stringSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsQueryGateways) },
+		limitAs: jsonrpc.MethodQueryTxs,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryGateways(ctx, id, params.(*ParamsQueryGateways), req)
+		},
+	},
+	MethodQueryTxsByTxid: {
+		description: "Returns the txs of the deposit with the given txid, optionally filtered by selector and status.",
+		schema: object(
+			required("txid", bytesSchema{encoding: base64URL}),
+			optional("selector", stringSchema{}),
+			optional("status", stringSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsQueryTxByTxid) },
+		limitAs: jsonrpc.MethodQueryTxs,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryTxByTxid(ctx, id, params.(*ParamsQueryTxByTxid), req)
+		},
+	},
+	MethodQueryTxsByRecipient: {
+		description: "Returns a page of the txs to the given address, most recent first, optionally filtered by selector.",
+		schema: object(
+			required("to", stringSchema{}),
+			optional("selector", stringSchema{}),
+			optional("offset", uintSchema{}),
+			optional("limit", uintSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsQueryTxsByRecipient) },
+		limitAs: jsonrpc.MethodQueryTxs,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryTxsByRecipient(ctx, id, params.(*ParamsQueryTxsByRecipient), req)
+		},
+	},
+	MethodQueryTxsPaged: {
+		description: "Returns the page of txs after the cursor, and the cursor of the next page. Cursors stay fast however far they are into the txs.",
+		schema: object(
+			optional("cursor", stringSchema{}),
+			optional("limit", uintSchema{}),
+			optional("latest", boolSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsQueryTxsPaged) },
+		limitAs: jsonrpc.MethodQueryTxs,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryTxsPaged(ctx, id, params.(*ParamsQueryTxsPaged), req)
+		},
+	},
+	MethodQueryLightnodePeers: {
+		description: "Returns the darknodes known to the Lightnode, healthiest first, with their score and round trip time.",
+		schema:      object(),
+		limitAs:     jsonrpc.MethodQueryPeers,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryLightnodePeers(ctx, id, req)
+		},
+	},
+	MethodQueryLightnodeVersion: {
+		description: "Returns the version of the Lightnode.",
+		schema:      object(),
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return jsonrpc.NewResponse(id, version.Get(), nil)
+		},
+	},
+	MethodQueryGatewayURI: {
+		description: "Returns a payment URI for depositing to a gateway, optionally as a QR code.",
+		schema: object(
+			required("gateway", stringSchema{}),
+			required("asset", stringSchema{}),
+			optional("amount", stringSchema{}),
+			optional("qr", boolSchema{}),
+		),
+		params: func() interface{} { return new(ParamsQueryGatewayURI) },
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryGatewayURI(ctx, id, params.(*ParamsQueryGatewayURI), req)
+		},
+	},
+	MethodEstimateFee: {
+		description: "Returns the fees of a tx with the given selector and amount, and the amount received after fees, from the current block state.",
+		schema: object(
+			required("selector", stringSchema{}),
+			required("amount", stringSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsEstimateFee) },
+		limitAs: jsonrpc.MethodQueryBlockState,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.EstimateFee(ctx, id, params.(*ParamsEstimateFee), req)
+		},
+	},
+	MethodQueryAssets: {
+		description: "Returns the assets supported by the Lightnode and whether they are paused.",
+		schema:      object(),
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return jsonrpc.NewResponse(id, ResponseQueryAssets{Assets: resolver.pauser.Statuses()}, nil)
+		},
+	},
+	MethodQueryTxByDestTxid: {
+		description: "Returns the txs completed by the host chain tx with the given txid.",
+		schema: object(
+			required("txid", bytesSchema{encoding: base64URL}),
+		),
+		params:  func() interface{} { return new(ParamsQueryTxByDestTxid) },
+		limitAs: jsonrpc.MethodQueryTxs,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryTxByDestTxid(ctx, id, params.(*ParamsQueryTxByDestTxid), req)
+		},
+	},
+	MethodQueryBurnsByRef: {
+		description: "Returns the burns with the given ref, or v1 nonce, optionally filtered by selector.",
+		schema: object(
+			optional("ref", uintSchema{}),
+			optional("nonce", bytesSchema{length: 32, encoding: base64URL}),
+			optional("selector", stringSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsQueryBurnsByRef) },
+		limitAs: jsonrpc.MethodQueryTxs,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.QueryBurnsByRef(ctx, id, params.(*ParamsQueryBurnsByRef), req)
+		},
+	},
+	MethodPreviewTxHash: {
+		description: "Returns the hash of a v0 tx and of the v1 tx which would be submitted on its behalf.",
+		schema: object(
+			required("tx", v0TxSchema),
+		),
+		params:  func() interface{} { return new(v0.ParamsSubmitTx) },
+		limitAs: jsonrpc.MethodSubmitTx,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.PreviewTxHash(ctx, id, params.(*v0.ParamsSubmitTx), req)
+		},
+	},
+	MethodBeginSubmit: {
+		description: "Starts a chunked submission of a tx whose payload is too large for a single request.",
+		schema: object(
+			required("tx", v1TxSchema),
+			required("payloadSize", uintSchema{}),
+		),
+		params:    func() interface{} { return new(ParamsBeginSubmit) },
+		limitAs:   jsonrpc.MethodSubmitTx,
+		submitsTx: true,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.BeginSubmit(ctx, id, params.(*ParamsBeginSubmit), req)
+		},
+	},
+	MethodAppendPayload: {
+		description: "Appends a chunk of the payload to a chunked submission.",
+		schema: object(
+			required("submissionId", stringSchema{}),
+			required("offset", uintSchema{}),
+			required("data", bytesSchema{encoding: base64URL}),
+		),
+		params:  func() interface{} { return new(ParamsAppendPayload) },
+		limitAs: jsonrpc.MethodSubmitTx,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.AppendPayload(ctx, id, params.(*ParamsAppendPayload), req)
+		},
+	},
+	MethodFinalizeSubmit: {
+		description: "Checks the assembled payload of a chunked submission against the tx, and submits the tx.",
+		schema: object(
+			required("submissionId", stringSchema{}),
+		),
+		params:  func() interface{} { return new(ParamsFinalizeSubmit) },
+		limitAs: jsonrpc.MethodSubmitTx,
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.FinalizeSubmit(ctx, id, params.(*ParamsFinalizeSubmit), req)
+		},
+	},
+	MethodUpdateChains: {
+		description: "Adds EVM host chains, or pauses and resumes the watchers of chains, and returns the status of every watched chain. Requires admin authentication.",
+		schema: object(
+			optional("add", arraySchema{items: object(
+				required("chain", stringSchema{}),
+				required("rpc", stringSchema{}),
+				required("registry", stringSchema{}),
+				required("chainId", uintSchema{}),
+			)}),
+			optional("pause", arraySchema{items: stringSchema{}}),
+			optional("resume", arraySchema{items: stringSchema{}}),
+		),
+		params: func() interface{} { return new(ParamsUpdateChains) },
+		resolve: func(resolver *Resolver, ctx context.Context, id interface{}, params interface{}, req *http.Request) jsonrpc.Response {
+			return resolver.UpdateChains(ctx, id, params.(*ParamsUpdateChains), req)
+		},
+	},
+}
@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/pack"
+)
+
+// MethodQueryTxsPaged pages through txs with a cursor, so that explorers can
+// walk the whole history of txs without the cost of large offsets.
+const MethodQueryTxsPaged = "ren_queryTxsPaged"
+
+// ParamsQueryTxsPaged selects the page of txs after the cursor, which is the
+// nextCursor of the previous page. An empty cursor starts from the first tx,
+// or the latest if latest is set. The same latest must be used for every page.
+type ParamsQueryTxsPaged struct {
+	Cursor string   `json:"cursor"`
+	Limit  pack.U64 `json:"limit"`
+	Latest bool     `json:"latest"`
+}
+
+// ResponseQueryTxsPaged is a page of txs, and the cursor of the next page. The
+// cursor is empty on the last page.
+type ResponseQueryTxsPaged struct {
+	Txs        []tx.Tx `json:"txs"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+func (resolver *Resolver) QueryTxsPaged(ctx context.Context, id interface{}, params *ParamsQueryTxsPaged, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodQueryTxsPaged, req)
+
+	cursor, err := decodeTxCursor(params.Cursor)
+	if err != nil {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid cursor"))
+	}
+	limit := uint64(params.Limit)
+	if limit == 0 {
+		limit = DefaultTxsPageSize
+	}
+	if maxPageSize := uint64(resolver.serverOptions.MaxPageSize); maxPageSize > 0 && limit > maxPageSize {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "limit must be at most %v", maxPageSize))
+	}
+
+	// An extra tx is fetched to tell whether there is another page.
+	response := ResponseQueryTxsPaged{Txs: []tx.Tx{}}
+	var last db.TxCursor
+	err = resolver.db.TxsAfter(cursor, int(limit)+1, params.Latest, func(transaction tx.Tx, txCursor db.TxCursor) error {
+		if uint64(len(response.Txs)) == limit {
+			response.NextCursor = encodeTxCursor(last)
+			return nil
+		}
+		response.Txs = append(response.Txs, transaction)
+		last = txCursor
+		return ctx.Err()
+	})
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot fetch txs from db")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch txs: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	return jsonrpc.NewResponse(id, response, nil)
+}
+
+// encodeTxCursor returns the opaque token of the cursor given to clients.
+func encodeTxCursor(cursor db.TxCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%s", cursor.CreatedTime, cursor.Hash)))
+}
+
+// decodeTxCursor decodes a token returned by encodeTxCursor. The empty token
+// is the zero cursor.
+func decodeTxCursor(token string) (db.TxCursor, error) {
+	if token == "" {
+		return db.TxCursor{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return db.TxCursor{}, err
+	}
+	parts := strings.SplitN(string(data), ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return db.TxCursor{}, fmt.Errorf("malformed cursor")
+	}
+	createdTime, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return db.TxCursor{}, err
+	}
+	return db.TxCursor{CreatedTime: createdTime, Hash: parts[1]}, nil
+}
@@ -0,0 +1,27 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/store"
+)
+
+// MethodQueryLightnodePeers returns the darknodes known to the Lightnode and
+// their health, for debugging which darknodes requests are sent to.
+const MethodQueryLightnodePeers = "ren_queryLightnodePeers"
+
+// ResponseQueryLightnodePeers lists the darknodes known to the Lightnode,
+// healthiest first.
+type ResponseQueryLightnodePeers struct {
+	Peers []store.PeerInfo `json:"peers"`
+}
+
+func (resolver *Resolver) QueryLightnodePeers(ctx context.Context, id interface{}, req *http.Request) jsonrpc.Response {
+	peers := resolver.multiStore.PeerTable()
+	if peers == nil {
+		return jsonrpc.NewResponse(id, ResponseQueryLightnodePeers{Peers: []store.PeerInfo{}}, nil)
+	}
+	return jsonrpc.NewResponse(id, ResponseQueryLightnodePeers{Peers: peers.Peers()}, nil)
+}
@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+)
+
+// DefaultPendingCountInterval is how long the number of pending txs is cached
+// for if it is not configured.
+const DefaultPendingCountInterval = 5 * time.Second
+
+// PendingLimit bounds the number of txs which have been accepted but not yet
+// submitted to the Darknodes. Spam, or RenVM stalling, can otherwise grow the
+// pending txs until the updater and the queries on the txs table slow down
+// for everyone.
+type PendingLimit struct {
+	// MaxPending is the number of pending txs at which new submissions are
+	// rejected with a retry later error. Zero disables the limit.
+	MaxPending int
+
+	// Interval is how long the number of pending txs is cached for, so that
+	// the txs table is not counted on every submission. Submissions accepted
+	// in the meantime are added to the cached count.
+	Interval time.Duration
+
+	// Clock tells the time at which the count expires. It defaults to the
+	// wall clock.
+	Clock clock.Clock
+}
+
+type pendingLimitVerifier struct {
+	Verifier
+
+	logger logging.Logger
+	db     db.DB
+	limit  PendingLimit
+
+	mu        *sync.Mutex
+	count     int
+	countedAt time.Time
+}
+
+// NewPendingLimitVerifier wraps the verifier so that new txs are rejected
+// without being verified while there are too many pending txs. Resubmissions
+// of stored txs are not verified, so they are still accepted.
+func NewPendingLimitVerifier(verifier Verifier, logger logging.Logger, database db.DB, limit PendingLimit) Verifier {
+	if limit.MaxPending <= 0 {
+		return verifier
+	}
+	if limit.Interval <= 0 {
+		limit.Interval = DefaultPendingCountInterval
+	}
+	if limit.Clock == nil {
+		limit.Clock = clock.New()
+	}
+	return &pendingLimitVerifier{
+		Verifier: verifier,
+		logger:   logger,
+		db:       database,
+		limit:    limit,
+		mu:       new(sync.Mutex),
+	}
+}
+
+func (v *pendingLimitVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	if err := v.admit(); err != nil {
+		return err
+	}
+	return v.Verifier.VerifyTx(ctx, transaction)
+}
+
+// admit counts the tx as pending, unless the limit has been reached. Txs
+// which are then rejected by the inner verifier are still counted until the
+// count is refreshed, which errs on the side of rejecting submissions.
+func (v *pendingLimitVerifier) admit() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.limit.Clock.Now()
+	if v.countedAt.IsZero() || now.Sub(v.countedAt) >= v.limit.Interval {
+		count, err := v.db.PendingTxCount()
+		if err != nil {
+			// Submissions are not rejected because the count is
+			// unavailable, as the database is needed to store them anyway.
+			v.logger.Warnf("[pending] cannot count pending txs: %v", err)
+		} else {
+			v.count = count
+			v.countedAt = now
+		}
+	}
+
+	if v.count >= v.limit.MaxPending {
+		v.logger.Debugf("[pending] rejecting tx with %v pending txs", v.count)
+		return lerrors.Wrapf(lerrors.ErrRetryLater, "too many pending txs, try again later")
+	}
+	v.count++
+	return nil
+}
@@ -0,0 +1,80 @@
+package resolver_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/tx/txutil"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Pending limit verifier", func() {
+	logger := logging.FromLogrus(logrus.New())
+
+	var dir string
+	var sqlDB *sql.DB
+	var database db.DB
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "pending")
+		Expect(err).NotTo(HaveOccurred())
+		sqlDB, err = sql.Open("sqlite3", filepath.Join(dir, "pending.db"))
+		Expect(err).NotTo(HaveOccurred())
+		database = db.New(sqlDB, 10, 1)
+		Expect(database.Init()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		sqlDB.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should reject new txs once the limit is reached until txs are submitted", func() {
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		pending := txutil.RandomGoodTx(r)
+		Expect(database.InsertTx(pending)).To(Succeed())
+
+		count := int64(0)
+		mock := clock.NewMock(time.Now())
+		verifier := NewPendingLimitVerifier(countingVerifier{count: &count}, logger, database, PendingLimit{
+			MaxPending: 2,
+			Interval:   time.Minute,
+			Clock:      mock,
+		})
+
+		// Accepted txs are counted before they are written.
+		Expect(verifier.VerifyTx(context.Background(), txutil.RandomGoodTx(r))).To(Succeed())
+		err := verifier.VerifyTx(context.Background(), txutil.RandomGoodTx(r))
+		Expect(lerrors.Is(err, lerrors.ErrRetryLater)).To(BeTrue())
+		Expect(lerrors.Code(err)).To(Equal(lerrors.ErrorCodeRetryLater))
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(1)))
+
+		// The count is only refreshed once the interval has passed.
+		Expect(database.UpdateStatus(pending.Hash, db.TxStatusSubmitted)).To(Succeed())
+		Expect(verifier.VerifyTx(context.Background(), txutil.RandomGoodTx(r))).NotTo(Succeed())
+		mock.Add(time.Minute)
+		Expect(verifier.VerifyTx(context.Background(), txutil.RandomGoodTx(r))).To(Succeed())
+		Expect(atomic.LoadInt64(&count)).To(Equal(int64(2)))
+	})
+
+	It("should not wrap the verifier without a limit", func() {
+		count := int64(0)
+		inner := countingVerifier{count: &count}
+		Expect(NewPendingLimitVerifier(inner, logger, database, PendingLimit{})).To(Equal(inner))
+	})
+})
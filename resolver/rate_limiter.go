@@ -1,10 +1,16 @@
 package resolver
 
 import (
+	"encoding/json"
+	"fmt"
 	"net"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/clock"
+	lhttp "github.com/renproject/lightnode/http"
 	"golang.org/x/time/rate"
 )
 
@@ -13,6 +19,37 @@ type RateLimiterConf struct {
 	IpMethodRate     map[string]rate.Limit
 	Ttl              time.Duration
 	MaxClients       int
+
+	// Allowlist and Denylist are IPs or CIDR ranges. Allowlisted IPs are not
+	// rate limited, and denylisted IPs are always rate limited. The denylist
+	// takes precedence.
+	Allowlist []string
+	Denylist  []string
+}
+
+// Validate returns an error if the rates do not have a fallback, or if the IP
+// lists contain entries which are neither IPs nor CIDR ranges.
+func (conf RateLimiterConf) Validate() error {
+	if _, ok := conf.GlobalMethodRate["fallback"]; !ok {
+		return fmt.Errorf("global rates must have a fallback")
+	}
+	if _, ok := conf.IpMethodRate["fallback"]; !ok {
+		return fmt.Errorf("ip rates must have a fallback")
+	}
+	for _, rates := range []map[string]rate.Limit{conf.GlobalMethodRate, conf.IpMethodRate} {
+		for method, r := range rates {
+			if r < 0 {
+				return fmt.Errorf("rate of %v must not be negative, got %v", method, r)
+			}
+		}
+	}
+	if _, err := lhttp.ParseIPNets(conf.Allowlist); err != nil {
+		return fmt.Errorf("allowlist: %v", err)
+	}
+	if _, err := lhttp.ParseIPNets(conf.Denylist); err != nil {
+		return fmt.Errorf("denylist: %v", err)
+	}
+	return nil
 }
 
 const (
@@ -54,31 +91,253 @@ type LightnodeRateLimiter struct {
 	ipLastSeen map[string]time.Time
 	maxClients int
 	ttl        time.Duration
+
+	allowlist []*net.IPNet
+	denylist  []*net.IPNet
+
+	// clock refills the limits and expires the IPs which have not been seen
+	// for the ttl.
+	clock clock.Clock
+
+	// shared limits are checked instead of the local limits, unless they
+	// are nil or have failed recently. The local limits are then scaled down
+	// by the degraded factor.
+	shared        SharedLimits
+	sharedOptions SharedLimiterOptions
+	scale         float64
+	degraded      bool
+	retryAt       time.Time
+
+	// Counts of the requests which were allowed and limited, by method and
+	// by IP. The counts of an IP are reset when it is pruned, and new IPs are
+	// not counted while there are as many as the max clients.
+	methodCounts map[string]*RateLimiterCount
+	ipCounts     map[string]*RateLimiterCount
 }
 
-func NewRateLimiter(conf RateLimiterConf) LightnodeRateLimiter {
+// RateLimiterCount is the number of requests which a limiter has allowed and
+// limited.
+type RateLimiterCount struct {
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+
+	lastSeen time.Time
+}
+
+// RateLimiterCounters are the counts of a limiter, as they are reported by the
+// counters endpoint of the admin API.
+type RateLimiterCounters struct {
+	Shared   bool                        `json:"shared"`
+	Degraded bool                        `json:"degraded"`
+	Clients  int                         `json:"clients"`
+	Methods  map[string]RateLimiterCount `json:"methods"`
+	IPs      map[string]RateLimiterCount `json:"ips"`
+}
+
+func NewRateLimiter(conf RateLimiterConf) *LightnodeRateLimiter {
+	limiter := &LightnodeRateLimiter{
+		scale:        1,
+		methodCounts: map[string]*RateLimiterCount{},
+		ipCounts:     map[string]*RateLimiterCount{},
+		clock:        clock.New(),
+	}
+	limiter.apply(conf)
+	return limiter
+}
+
+// SetClock replaces the clock of the limiter, such as with a mock clock which
+// tests advance instead of waiting for limits to refill.
+func (limiter *LightnodeRateLimiter) SetClock(clock clock.Clock) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.clock = clock
+}
+
+// Share makes the limiter check the shared limits, so that its rates apply to
+// all of the Lightnode replicas together. If the shared limits fail, such as
+// when Redis is down, the limiter falls back to its local limits with rates
+// scaled down by the degraded factor, so that requests are still limited
+// without depending on Redis.
+func (limiter *LightnodeRateLimiter) Share(shared SharedLimits, options SharedLimiterOptions) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.shared = shared
+	limiter.sharedOptions = options
+	limiter.scale = options.DegradedFactor
+	limiter.apply(limiter.conf)
+}
+
+// Degraded returns whether the limiter is using its local limits because the
+// shared limits have failed.
+func (limiter *LightnodeRateLimiter) Degraded() bool {
+	limiter.mu.RLock()
+	defer limiter.mu.RUnlock()
+	return limiter.degraded
+}
+
+// apply replaces the configuration of the limiter. The limits of every IP are
+// reset, as their rates may have changed. Invalid list entries are ignored, as
+// the configuration is validated before it is applied.
+func (limiter *LightnodeRateLimiter) apply(conf RateLimiterConf) {
 	if conf.IpMethodRate == nil {
 		conf.IpMethodRate = make(map[string]rate.Limit)
 	}
 
 	globalLimits := make(map[string]*rate.Limiter)
 	for method, r := range conf.GlobalMethodRate {
+		r = limiter.scaled(r)
 		globalLimits[method] = rate.NewLimiter(r, int(r))
 	}
+	allowlist, _ := lhttp.ParseIPNets(conf.Allowlist)
+	denylist, _ := lhttp.ParseIPNets(conf.Denylist)
 
-	return LightnodeRateLimiter{
-		conf:        conf,
-		globalLimit: globalLimits,
-		ipLimiters:  make(map[string]map[string]*rate.Limiter),
-		ipLastSeen:  make(map[string]time.Time),
-		maxClients:  conf.MaxClients,
-		ttl:         conf.Ttl,
+	limiter.conf = conf
+	limiter.globalLimit = globalLimits
+	limiter.ipLimiters = make(map[string]map[string]*rate.Limiter)
+	limiter.ipLastSeen = make(map[string]time.Time)
+	limiter.maxClients = conf.MaxClients
+	limiter.ttl = conf.Ttl
+	limiter.allowlist = allowlist
+	limiter.denylist = denylist
+}
+
+// Conf returns the current configuration of the limiter.
+func (limiter *LightnodeRateLimiter) Conf() RateLimiterConf {
+	limiter.mu.RLock()
+	defer limiter.mu.RUnlock()
+	return limiter.conf
+}
+
+// Reload replaces the configuration of the limiter while it is running, so
+// that operators can react to abuse without restarting the Lightnode.
+func (limiter *LightnodeRateLimiter) Reload(conf RateLimiterConf) error {
+	if err := conf.Validate(); err != nil {
+		return err
 	}
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.apply(conf)
+	return nil
 }
 
 // Checks if the ip has an available limit, and increment if so
 // Returns true if below limit, false otherwise
 func (limiter *LightnodeRateLimiter) Allow(method string, ip net.IP) bool {
+	allowed := limiter.allow(method, ip)
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	// Methods are limited before they are validated, so unknown methods are
+	// counted together.
+	if _, ok := jsonrpc.RPCs[method]; !ok {
+		if _, ok := customMethods[method]; !ok {
+			method = "unknown"
+		}
+	}
+	limiter.count(limiter.methodCounts, method, allowed, false)
+	limiter.count(limiter.ipCounts, ip.String(), allowed, len(limiter.ipCounts) >= limiter.maxClients)
+	return allowed
+}
+
+// count adds the outcome of a request to the counts of the key. Keys which are
+// not counted yet are skipped if full. It must be called with the mutex held.
+func (limiter *LightnodeRateLimiter) count(counts map[string]*RateLimiterCount, key string, allowed, full bool) {
+	count, ok := counts[key]
+	if !ok {
+		if full {
+			return
+		}
+		count = &RateLimiterCount{}
+		counts[key] = count
+	}
+	count.lastSeen = limiter.clock.Now()
+	if allowed {
+		count.Allowed++
+	} else {
+		count.Limited++
+	}
+}
+
+// Counters returns the counts of the requests which the limiter has allowed
+// and limited.
+func (limiter *LightnodeRateLimiter) Counters() RateLimiterCounters {
+	limiter.mu.RLock()
+	defer limiter.mu.RUnlock()
+
+	counters := RateLimiterCounters{
+		Shared:   limiter.shared != nil,
+		Degraded: limiter.degraded,
+		Clients:  len(limiter.ipLastSeen),
+		Methods:  make(map[string]RateLimiterCount, len(limiter.methodCounts)),
+		IPs:      make(map[string]RateLimiterCount, len(limiter.ipCounts)),
+	}
+	for method, count := range limiter.methodCounts {
+		counters.Methods[method] = *count
+	}
+	for ip, count := range limiter.ipCounts {
+		counters.IPs[ip] = *count
+	}
+	return counters
+}
+
+// ServeCounters serves the counters endpoint of the admin API. GET reports
+// the Counters of the limiter.
+func (limiter *LightnodeRateLimiter) ServeCounters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limiter.Counters())
+}
+
+// allow checks the request against the allowlist and denylist, and then
+// against the shared or local limits.
+func (limiter *LightnodeRateLimiter) allow(method string, ip net.IP) bool {
+	limiter.mu.Lock()
+
+	if lhttp.ContainsIP(limiter.denylist, ip) {
+		limiter.mu.Unlock()
+		return false
+	}
+	if lhttp.ContainsIP(limiter.allowlist, ip) {
+		limiter.mu.Unlock()
+		return true
+	}
+	if limiter.shared == nil || limiter.clock.Now().Before(limiter.retryAt) {
+		limiter.mu.Unlock()
+		return limiter.allowLocal(method, ip)
+	}
+
+	// Redis is not waited on with the mutex held.
+	shared := limiter.shared
+	globalMethod := limitClass(limiter.conf.GlobalMethodRate, method)
+	ipMethod := limitClass(limiter.conf.IpMethodRate, method)
+	globalRate, ipRate := limiter.conf.GlobalMethodRate[globalMethod], limiter.conf.IpMethodRate[ipMethod]
+	limiter.mu.Unlock()
+
+	allowed, err := allowShared(shared, globalMethod, globalRate, ipMethod, ipRate, ip.String())
+	limiter.mu.Lock()
+	if err != nil {
+		limiter.retryAt = limiter.clock.Now().Add(limiter.sharedOptions.RetryAfter)
+		if !limiter.degraded && limiter.sharedOptions.Logger != nil {
+			limiter.sharedOptions.Logger.Warnf("[limiter] shared rate limits are unavailable, using local limits: %v", err)
+		}
+		limiter.degraded = true
+		limiter.mu.Unlock()
+		return limiter.allowLocal(method, ip)
+	}
+	if limiter.degraded && limiter.sharedOptions.Logger != nil {
+		limiter.sharedOptions.Logger.Info("[limiter] shared rate limits are available again")
+	}
+	limiter.degraded = false
+	limiter.mu.Unlock()
+	return allowed
+}
+
+// allowLocal checks the request against the limits of this Lightnode.
+func (limiter *LightnodeRateLimiter) allowLocal(method string, ip net.IP) bool {
 	limiter.mu.Lock()
 
 	// We prune when we are tracking too many ips
@@ -89,24 +348,16 @@ func (limiter *LightnodeRateLimiter) Allow(method string, ip net.IP) bool {
 	}
 	defer limiter.mu.Unlock()
 
-	globalMethod := method
-	// if we have a per-method limit set
-	_, ok := limiter.conf.GlobalMethodRate[method]
-	if !ok {
-		globalMethod = "fallback"
-	}
-	if !limiter.globalLimit[globalMethod].Allow() {
+	now := limiter.clock.Now()
+	globalMethod := limitClass(limiter.conf.GlobalMethodRate, method)
+	if !limiter.globalLimit[globalMethod].AllowN(now, 1) {
 		return false
 	}
 
-	// if we have a per-method limit set
-	methodLimit, ok := limiter.conf.IpMethodRate[method]
-	if !ok {
-		method = "fallback"
-		methodLimit = limiter.conf.IpMethodRate[method]
-	}
+	method = limitClass(limiter.conf.IpMethodRate, method)
+	methodLimit := limiter.scaled(limiter.conf.IpMethodRate[method])
 	limit, ok := limiter.ipLimiters[method][ip.String()]
-	limiter.ipLastSeen[ip.String()] = time.Now()
+	limiter.ipLastSeen[ip.String()] = now
 
 	if !ok {
 		if limiter.ipLimiters[method] == nil {
@@ -114,10 +365,33 @@ func (limiter *LightnodeRateLimiter) Allow(method string, ip net.IP) bool {
 		}
 		il := rate.NewLimiter(methodLimit, int(methodLimit))
 		limiter.ipLimiters[method][ip.String()] = il
-		return il.Allow()
+		return il.AllowN(now, 1)
 	}
 
-	return limit.Allow()
+	return limit.AllowN(now, 1)
+}
+
+// scaled returns the rate of a local limit. Infinite rates are not scaled.
+func (limiter *LightnodeRateLimiter) scaled(r rate.Limit) rate.Limit {
+	if r == rate.Inf {
+		return r
+	}
+	return r * rate.Limit(limiter.scale)
+}
+
+// limitClass returns the method whose rate applies to the given method. This is
+// the method itself if it has a rate, otherwise the method it is limited as if
+// it is a custom method, otherwise the fallback.
+func limitClass(rates map[string]rate.Limit, method string) string {
+	if _, ok := rates[method]; ok {
+		return method
+	}
+	if m, ok := customMethods[method]; ok && m.limitAs != "" {
+		if _, ok := rates[m.limitAs]; ok {
+			return m.limitAs
+		}
+	}
+	return "fallback"
 }
 
 // Prune IP-addresses that have not been seen for a while.
@@ -125,13 +399,94 @@ func (limiter *LightnodeRateLimiter) Prune() int {
 	limiter.mu.Lock()
 	defer limiter.mu.Unlock()
 
+	now := limiter.clock.Now()
 	pruned := 0
 	for ip, ipLastSeen := range limiter.ipLastSeen {
-		if time.Now().Sub(ipLastSeen) > limiter.ttl {
+		if now.Sub(ipLastSeen) > limiter.ttl {
 			delete(limiter.ipLimiters, ip)
 			delete(limiter.ipLastSeen, ip)
 			pruned += 1
 		}
 	}
+	for ip, count := range limiter.ipCounts {
+		if now.Sub(count.lastSeen) > limiter.ttl {
+			delete(limiter.ipCounts, ip)
+		}
+	}
 	return pruned
 }
+
+// RateLimiterUpdate changes the rates and IP lists of a running limiter. Rates
+// which are nil are left as they are, and lists which are nil are left as they
+// are, so an empty list must be given to clear one.
+type RateLimiterUpdate struct {
+	GlobalMethodRate map[string]rate.Limit `json:"globalMethodRate"`
+	IPMethodRate     map[string]rate.Limit `json:"ipMethodRate"`
+	Allowlist        *[]string             `json:"allowlist"`
+	Denylist         *[]string             `json:"denylist"`
+}
+
+// rateLimiterStatus is the configuration of the limiter as it is reported by
+// the handler.
+type rateLimiterStatus struct {
+	GlobalMethodRate map[string]rate.Limit `json:"globalMethodRate"`
+	IPMethodRate     map[string]rate.Limit `json:"ipMethodRate"`
+	Allowlist        []string              `json:"allowlist"`
+	Denylist         []string              `json:"denylist"`
+	TTL              string                `json:"ttl"`
+	MaxClients       int                   `json:"maxClients"`
+	Shared           bool                  `json:"shared"`
+	Degraded         bool                  `json:"degraded"`
+}
+
+// ServeHTTP implements the `http.Handler` interface. GET reports the current
+// configuration of the limiter, and PUT applies a RateLimiterUpdate given as
+// JSON and reports the resulting configuration.
+func (limiter *LightnodeRateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var update RateLimiterUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, fmt.Sprintf("invalid update: %v", err), http.StatusBadRequest)
+			return
+		}
+		conf := limiter.Conf()
+		if update.GlobalMethodRate != nil {
+			conf.GlobalMethodRate = update.GlobalMethodRate
+		}
+		if update.IPMethodRate != nil {
+			conf.IpMethodRate = update.IPMethodRate
+		}
+		if update.Allowlist != nil {
+			conf.Allowlist = *update.Allowlist
+		}
+		if update.Denylist != nil {
+			conf.Denylist = *update.Denylist
+		}
+		if err := limiter.Reload(conf); err != nil {
+			http.Error(w, fmt.Sprintf("invalid update: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conf := limiter.Conf()
+	limiter.mu.RLock()
+	shared, degraded := limiter.shared != nil, limiter.degraded
+	limiter.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rateLimiterStatus{
+		GlobalMethodRate: conf.GlobalMethodRate,
+		IPMethodRate:     conf.IpMethodRate,
+		Allowlist:        conf.Allowlist,
+		Denylist:         conf.Denylist,
+		TTL:              conf.Ttl.String(),
+		MaxClients:       conf.MaxClients,
+		Shared:           shared,
+		Degraded:         degraded,
+	})
+}
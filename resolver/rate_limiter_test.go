@@ -2,6 +2,9 @@ package resolver_test
 
 import (
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"time"
 
@@ -9,6 +12,10 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/renproject/lightnode/resolver"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/clock"
 	"golang.org/x/time/rate"
 )
 
@@ -195,6 +202,31 @@ var _ = Describe("Rate Limiter", func() {
 		Expect(globalKnown).To(Equal(15))
 	})
 
+	It("Should limit custom methods with the rates of the methods they are limited as", func() {
+		conf := RateLimiterConf{
+			Ttl:              time.Second,
+			GlobalMethodRate: map[string]rate.Limit{"fallback": 1000},
+			IpMethodRate: map[string]rate.Limit{
+				jsonrpc.MethodSubmitTx: 1,
+				"fallback":             1000,
+			},
+			MaxClients: 4,
+		}
+		limiter := NewRateLimiter(conf)
+		ip := net.IPv4(0, 0, 0, 0)
+
+		// Custom methods which submit txs share the class of ren_submitTx, but
+		// are tracked separately from it.
+		Expect(limiter.Allow(jsonrpc.MethodSubmitTx, ip)).To(BeTrue())
+		Expect(limiter.Allow(MethodSubmitGateway, ip)).To(BeTrue())
+		Expect(limiter.Allow(MethodSubmitGateway, ip)).To(BeFalse())
+
+		// Custom methods without a class use the fallback.
+		for i := 0; i < 10; i++ {
+			Expect(limiter.Allow(MethodQueryAssets, ip)).To(BeTrue())
+		}
+	})
+
 	It("Should allow multiple ips with rates of specific methods", func() {
 		ipMethodRate := make(map[string]rate.Limit)
 		ipMethodRate["known"] = 10
@@ -249,18 +281,174 @@ var _ = Describe("Rate Limiter", func() {
 			net.IPv4(0, 0, 0, 3),
 		}
 		limiter := NewRateLimiter(conf)
+		mockClock := clock.NewMock(time.Now())
+		limiter.SetClock(mockClock)
 
+		wg := sync.WaitGroup{}
 		for _, ip := range ips {
 			iip := ip
+			wg.Add(1)
 			go func() {
+				defer wg.Done()
 				for i := 0; i < 30; i++ {
 					limiter.Allow("unknown", iip)
 				}
 			}()
 		}
-		time.Sleep(3 * time.Second)
+		wg.Wait()
+		Expect(limiter.Prune()).To(Equal(0))
+
+		mockClock.Add(2 * time.Second)
 		pruned := limiter.Prune()
 		Expect(pruned).To(Equal(4))
 		Expect(limiter.Prune()).To(Equal(0))
 	})
+
+	It("Should never limit allowlisted ips and always limit denylisted ips", func() {
+		conf := NewRateLimitConf(
+			rate.Limit(100),
+			rate.Limit(1),
+			time.Second,
+			10,
+		)
+		conf.Allowlist = []string{"10.0.0.0/8"}
+		conf.Denylist = []string{"10.0.0.1", "192.168.0.0/16"}
+		limiter := NewRateLimiter(conf)
+
+		for i := 0; i < 10; i++ {
+			Expect(limiter.Allow("unknown", net.IPv4(10, 0, 0, 2))).To(BeTrue())
+		}
+		Expect(limiter.Allow("unknown", net.IPv4(10, 0, 0, 1))).To(BeFalse())
+		Expect(limiter.Allow("unknown", net.IPv4(192, 168, 1, 1))).To(BeFalse())
+	})
+
+	It("Should apply reloaded configurations", func() {
+		conf := NewRateLimitConf(
+			rate.Limit(100),
+			rate.Limit(1),
+			time.Second,
+			10,
+		)
+		limiter := NewRateLimiter(conf)
+		ip := net.IPv4(1, 2, 3, 4)
+		Expect(limiter.Allow("ren_submitTx", ip)).To(BeTrue())
+		Expect(limiter.Allow("ren_submitTx", ip)).To(BeFalse())
+
+		conf.IpMethodRate = map[string]rate.Limit{"fallback": 1, "ren_submitTx": 5}
+		Expect(limiter.Reload(conf)).To(Succeed())
+		for i := 0; i < 5; i++ {
+			Expect(limiter.Allow("ren_submitTx", ip)).To(BeTrue())
+		}
+
+		conf.Denylist = []string{"1.2.3.0/24"}
+		Expect(limiter.Reload(conf)).To(Succeed())
+		Expect(limiter.Allow("ren_queryTx", ip)).To(BeFalse())
+
+		conf.Denylist = []string{"not an ip"}
+		Expect(limiter.Reload(conf)).NotTo(Succeed())
+		conf.Denylist = nil
+		conf.GlobalMethodRate = map[string]rate.Limit{"ren_submitTx": 1}
+		Expect(limiter.Reload(conf)).NotTo(Succeed())
+	})
+
+	It("Should share limits between replicas through redis", func() {
+		mr, err := miniredis.Run()
+		Expect(err).NotTo(HaveOccurred())
+		defer mr.Close()
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+
+		// A slow rate gives a long window, so that it does not roll over
+		// during the test.
+		conf := NewRateLimitConf(rate.Limit(100), rate.Limit(0.001), time.Minute, 10)
+		options := SharedLimiterOptions{DegradedFactor: 1, RetryAfter: time.Minute}
+		first, second := NewRateLimiter(conf), NewRateLimiter(conf)
+		first.Share(NewRedisLimits(client), options)
+		second.Share(NewRedisLimits(client), options)
+
+		Expect(first.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))).To(BeTrue())
+		Expect(second.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))).To(BeFalse())
+		Expect(second.Allow("ren_queryTx", net.IPv4(2, 2, 2, 2))).To(BeTrue())
+		Expect(first.Degraded()).To(BeFalse())
+	})
+
+	It("Should fall back to conservative local limits while redis is flapping", func() {
+		mr, err := miniredis.Run()
+		Expect(err).NotTo(HaveOccurred())
+		defer mr.Close()
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+
+		limiter := NewRateLimiter(NewRateLimitConf(rate.Limit(4), rate.Limit(100), time.Minute, 10))
+		limiter.Share(NewRedisLimits(client), SharedLimiterOptions{DegradedFactor: 0.5, RetryAfter: 50 * time.Millisecond})
+		mockClock := clock.NewMock(time.Now())
+		limiter.SetClock(mockClock)
+		Expect(limiter.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))).To(BeTrue())
+		Expect(limiter.Degraded()).To(BeFalse())
+
+		for i := 0; i < 3; i++ {
+			// While redis is down, the local limits allow half of the
+			// global burst.
+			mr.Close()
+			Expect(limiter.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))).To(BeTrue())
+			Expect(limiter.Degraded()).To(BeTrue())
+			Expect(limiter.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))).To(BeTrue())
+			Expect(limiter.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))).To(BeFalse())
+
+			// Once redis is back, the shared limits are used again after
+			// the retry interval.
+			Expect(mr.Restart()).To(Succeed())
+			limiter.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))
+			Expect(limiter.Degraded()).To(BeTrue())
+			Eventually(func() bool {
+				mockClock.Add(50 * time.Millisecond)
+				limiter.Allow("ren_queryTx", net.IPv4(1, 1, 1, 1))
+				return limiter.Degraded()
+			}, 5*time.Second).Should(BeFalse())
+
+			// Let the local limits refill before redis goes down again.
+			mockClock.Add(time.Second)
+		}
+	})
+
+	It("Should count allowed and limited requests", func() {
+		limiter := NewRateLimiter(NewRateLimitConf(rate.Limit(100), rate.Limit(1), time.Minute, 10))
+		limiter.Allow(jsonrpc.MethodQueryTx, net.IPv4(1, 1, 1, 1))
+		limiter.Allow(jsonrpc.MethodQueryTx, net.IPv4(1, 1, 1, 1))
+		limiter.Allow("ren_queryUnknown", net.IPv4(2, 2, 2, 2))
+
+		w := httptest.NewRecorder()
+		limiter.ServeCounters(w, httptest.NewRequest(http.MethodGet, "/limiter/counters", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`{
+			"shared": false,
+			"degraded": false,
+			"clients": 2,
+			"methods": {
+				"ren_queryTx": {"allowed": 1, "limited": 1},
+				"unknown": {"allowed": 1, "limited": 0}
+			},
+			"ips": {
+				"1.1.1.1": {"allowed": 1, "limited": 1},
+				"2.2.2.2": {"allowed": 1, "limited": 0}
+			}
+		}`))
+	})
+
+	It("Should update the configuration over http", func() {
+		limiter := NewRateLimiter(NewRateLimitConf(rate.Limit(100), rate.Limit(1), time.Second, 10))
+
+		body := strings.NewReader(`{"ipMethodRate": {"fallback": 1, "ren_submitTx": 0.5}, "denylist": ["10.0.0.0/8"]}`)
+		w := httptest.NewRecorder()
+		limiter.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/limiter", body))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(limiter.Conf().IpMethodRate).To(HaveKeyWithValue("ren_submitTx", rate.Limit(0.5)))
+		Expect(limiter.Conf().Denylist).To(ConsistOf("10.0.0.0/8"))
+		Expect(limiter.Conf().GlobalMethodRate).To(HaveKeyWithValue("fallback", rate.Limit(100)))
+		Expect(limiter.Allow("ren_queryTx", net.IPv4(10, 1, 1, 1))).To(BeFalse())
+
+		w = httptest.NewRecorder()
+		limiter.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/limiter", strings.NewReader(`{"allowlist": ["nope"]}`)))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
 })
@@ -0,0 +1,66 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/pack"
+)
+
+// MethodQueryTxsByRecipient lists the txs to an address, so that explorers can
+// show every tx destined for a recipient.
+const MethodQueryTxsByRecipient = "ren_queryTxsByRecipient"
+
+// DefaultTxsPageSize is the number of txs returned by queryTxsByRecipient if no
+// limit is given.
+const DefaultTxsPageSize = 8
+
+// ParamsQueryTxsByRecipient selects a page of the txs to an address, most
+// recent first, optionally only those with the given selector.
+type ParamsQueryTxsByRecipient struct {
+	To       string      `json:"to"`
+	Selector tx.Selector `json:"selector"`
+	Offset   pack.U64    `json:"offset"`
+	Limit    pack.U64    `json:"limit"`
+}
+
+// ResponseQueryTxsByRecipient is a page of txs, and whether there is another.
+type ResponseQueryTxsByRecipient struct {
+	Txs     []tx.Tx `json:"txs"`
+	HasMore bool    `json:"hasMore"`
+}
+
+func (resolver *Resolver) QueryTxsByRecipient(ctx context.Context, id interface{}, params *ParamsQueryTxsByRecipient, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodQueryTxsByRecipient, req).WithField("to", params.To)
+
+	if params.To == "" {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "recipient is required"))
+	}
+	limit := uint64(params.Limit)
+	if limit == 0 {
+		limit = DefaultTxsPageSize
+	}
+	if maxPageSize := uint64(resolver.serverOptions.MaxPageSize); maxPageSize > 0 && limit > maxPageSize {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "limit must be at most %v", maxPageSize))
+	}
+
+	// An extra tx is fetched to tell whether there is another page.
+	txs, err := resolver.db.TxsByRecipient(params.To, params.Selector.String(), int(params.Offset), int(limit)+1)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot fetch txs by recipient from db")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch txs: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	response := ResponseQueryTxsByRecipient{
+		Txs:     txs,
+		HasMore: len(txs) > int(limit),
+	}
+	if response.HasMore {
+		response.Txs = txs[:limit]
+	}
+	return jsonrpc.NewResponse(id, response, nil)
+}
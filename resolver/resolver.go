@@ -21,7 +21,12 @@ import (
 	v0 "github.com/renproject/lightnode/compat/v0"
 	v1 "github.com/renproject/lightnode/compat/v1"
 	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
 	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/pause"
+	"github.com/renproject/lightnode/payment"
+	"github.com/renproject/lightnode/pool"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/watcher"
 	"github.com/renproject/multichain"
@@ -30,12 +35,12 @@ import (
 	"github.com/renproject/pack"
 	"github.com/renproject/phi"
 	"github.com/renproject/surge"
-	"github.com/sirupsen/logrus"
 )
 
 type Resolver struct {
 	network           multichain.Network
-	logger            logrus.FieldLogger
+	logger            logging.Logger
+	txChecker         txchecker
 	txCheckerRequests chan lhttp.RequestWithResponder
 	multiStore        store.MultiAddrStore
 	cacher            phi.Task
@@ -44,17 +49,25 @@ type Resolver struct {
 	versionStore      v0.CompatStore
 	gpubkeyStore      v1.GpubkeyCompatStore
 	bindings          binding.Bindings
+	chains            v0.ChainReader
+	pubkey            *id.PubKey
+	pauser            *pause.Pauser
+	wireVersions      WireVersions
+	blocks            *blockCache
+	validator         jsonrpc.Validator
+	admission         *AdmissionController
+	compatOnly        bool
+	chainUpdater      ChainUpdater
+	adminToken        string
 }
 
-func New(network multichain.Network, logger logrus.FieldLogger, cacher phi.Task, multiStore store.MultiAddrStore, db db.DB,
-	serverOptions jsonrpc.Options, versionStore v0.CompatStore, gpubkeyStore v1.GpubkeyCompatStore, bindings binding.Bindings, verifier Verifier) *Resolver {
+func New(network multichain.Network, logger logging.Logger, cacher phi.Task, multiStore store.MultiAddrStore, db db.DB,
+	serverOptions jsonrpc.Options, versionStore v0.CompatStore, gpubkeyStore v1.GpubkeyCompatStore, bindings binding.Bindings, chains v0.ChainReader, pubkey *id.PubKey, verifier Verifier, pauser *pause.Pauser, writeBehind WriteBehind, checkerPool *pool.Pool, blockCacheSize int) *Resolver {
 	requests := make(chan lhttp.RequestWithResponder, 128)
-	txChecker := newTxChecker(logger, requests, verifier, db)
-	go txChecker.Run()
-
 	return &Resolver{
 		network:           network,
 		logger:            logger,
+		txChecker:         newTxChecker(logger, requests, verifier, db, writeBehind, checkerPool),
 		txCheckerRequests: requests,
 		multiStore:        multiStore,
 		cacher:            cacher,
@@ -63,18 +76,87 @@ func New(network multichain.Network, logger logrus.FieldLogger, cacher phi.Task,
 		versionStore:      versionStore,
 		gpubkeyStore:      gpubkeyStore,
 		bindings:          bindings,
+		chains:            chains,
+		pubkey:            pubkey,
+		pauser:            pauser,
+		wireVersions:      NewWireVersions(),
+		blocks:            newBlockCache(logger, db, blockCacheSize),
 	}
 }
 
+// Run checks and persists submitted txs until the context is done. Txs which
+// have been accepted are written to the database before it returns.
+func (resolver *Resolver) Run(ctx context.Context) {
+	resolver.txChecker.Run(ctx)
+}
+
+// WithValidator sets the validator through which the txs of chunked
+// submissions are passed before they are submitted.
+func (resolver *Resolver) WithValidator(validator jsonrpc.Validator) *Resolver {
+	resolver.validator = validator
+	return resolver
+}
+
+// WithAdmission sets the admission controller which authenticates the API keys
+// of requests for methods which require one. Without it, those methods cannot
+// be called.
+func (resolver *Resolver) WithAdmission(admission *AdmissionController) *Resolver {
+	resolver.admission = admission
+	return resolver
+}
+
+// WithCompatOnly makes the resolver send submissions straight to the cacher,
+// which forwards them to the upstream Lightnode, rather than to the
+// txchecker. Compat-only Lightnodes do not run the confirmer which dispatches
+// the txs accepted by the txchecker, and the upstream verifies and persists
+// txs itself.
+func (resolver *Resolver) WithCompatOnly() *Resolver {
+	resolver.compatOnly = true
+	return resolver
+}
+
 func (resolver *Resolver) QueryBlock(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlock, req *http.Request) jsonrpc.Response {
-	return resolver.handleMessage(ctx, id, jsonrpc.MethodQueryBlock, *params, req, false)
+	if resolver.blocks == nil || !forAnyDarknode(req) {
+		return resolver.handleMessage(ctx, id, jsonrpc.MethodQueryBlock, *params, req, false)
+	}
+	if params.BlockHeight != nil {
+		if block, ok := resolver.blocks.block(uint64(*params.BlockHeight)); ok {
+			return jsonrpc.NewResponse(id, responseQueryBlock{Block: block}, nil)
+		}
+	}
+	response := resolver.handleMessage(ctx, id, jsonrpc.MethodQueryBlock, *params, req, false)
+	resolver.blocks.insert(jsonrpc.MethodQueryBlock, response)
+	return response
 }
 
+// QueryBlocks is served from the block cache if it holds every requested
+// block, which are the n blocks starting at the given height.
 func (resolver *Resolver) QueryBlocks(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryBlocks, req *http.Request) jsonrpc.Response {
-	return resolver.handleMessage(ctx, id, jsonrpc.MethodQueryBlocks, *params, req, false)
+	if resolver.blocks == nil || !forAnyDarknode(req) {
+		return resolver.handleMessage(ctx, id, jsonrpc.MethodQueryBlocks, *params, req, false)
+	}
+	if params.BlockHeight != nil && params.N != nil {
+		if blocks, ok := resolver.blocks.blocks(uint64(*params.BlockHeight), uint64(*params.N)); ok {
+			return jsonrpc.NewResponse(id, responseQueryBlocks{Blocks: blocks}, nil)
+		}
+	}
+	response := resolver.handleMessage(ctx, id, jsonrpc.MethodQueryBlocks, *params, req, false)
+	resolver.blocks.insert(jsonrpc.MethodQueryBlocks, response)
+	return response
+}
+
+// forAnyDarknode returns whether the request can be served by any Darknode,
+// rather than a specific one.
+func forAnyDarknode(req *http.Request) bool {
+	return req == nil || req.URL == nil || req.URL.Query().Get("id") == ""
 }
 
 func (resolver *Resolver) SubmitTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsSubmitTx, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, jsonrpc.MethodSubmitTx, req).WithFields(logging.Fields{
+		"txHash":   params.Tx.Hash.String(),
+		"selector": params.Tx.Selector.String(),
+	})
+
 	// Check if the tx is a v1 tx or v0 tx.
 	txVersion := params.Tx.Version
 
@@ -84,6 +166,13 @@ func (resolver *Resolver) SubmitTx(ctx context.Context, id interface{}, params *
 		params.Tx.Version = tx.Version1
 	}
 	response := resolver.handleMessage(ctx, id, jsonrpc.MethodSubmitTx, *params, req, true)
+	if response.Error == nil {
+		if metadata := clientMetadata(req); !metadata.IsEmpty() {
+			if err := resolver.db.InsertClientMetadata(params.Tx.Hash, metadata); err != nil {
+				logger.WithError(err).Warn("[resolver] cannot record client metadata")
+			}
+		}
+	}
 
 	if txVersion != tx.Version0 {
 		return response
@@ -94,27 +183,50 @@ func (resolver *Resolver) SubmitTx(ctx context.Context, id interface{}, params *
 
 	v0tx, err := v0.TxFromV1Tx(params.Tx, false, resolver.bindings)
 	if err != nil {
-		resolver.logger.Errorf("[responder] cannot convert v1 tx to v0, %v", err)
+		logger.WithError(err).Error("[resolver] cannot convert v1 tx to v0")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to convert v1 tx to v0", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
+	var result interface{} = v0tx
+	if hexEncoding(req) {
+		result = v0.HexTx(v0tx)
+	}
 	return jsonrpc.Response{
 		Version: response.Version,
 		ID:      response.ID,
 		Result: struct {
 			Tx interface{} `json:"tx"`
-		}{v0tx},
+		}{result},
 	}
 }
 
 const (
-	MethodQueryTxsByTxid = "ren_queryTxsByTxid"
-	MethodSubmitGateway  = "ren_submitGateway"
-	MethodQueryGateway   = "ren_queryGateway"
+	MethodQueryTxsByTxid        = "ren_queryTxsByTxid"
+	MethodSubmitGateway         = "ren_submitGateway"
+	MethodQueryGateway          = "ren_queryGateway"
+	MethodQueryLightnodeVersion = "ren_queryLightnodeVersion"
+	MethodQueryGatewayURI       = "ren_queryGatewayURI"
+	MethodQueryAssets           = "ren_queryAssets"
+	MethodQueryTxByDestTxid     = "ren_queryTxByDestTxid"
+	MethodPreviewTxHash         = "ren_previewTxHash"
 )
 
 type ParamsQueryTxByTxid struct {
+	Txid     pack.Bytes
+	Selector string
+	Status   string
+}
+
+// txStatuses are the statuses by which the txs of a txid can be filtered.
+var txStatuses = map[string]db.TxStatus{
+	"":                             db.TxStatusNil,
+	db.TxStatusConfirming.String(): db.TxStatusConfirming,
+	db.TxStatusConfirmed.String():  db.TxStatusConfirmed,
+	db.TxStatusSubmitted.String():  db.TxStatusSubmitted,
+}
+
+type ParamsQueryTxByDestTxid struct {
 	Txid pack.Bytes
 }
 
@@ -127,40 +239,67 @@ type ParamsSubmitGateway struct {
 	Gateway string
 }
 
+type ParamsQueryGatewayURI struct {
+	Gateway string           `json:"gateway"`
+	Asset   multichain.Asset `json:"asset"`
+	Amount  string           `json:"amount,omitempty"`
+	QR      bool             `json:"qr,omitempty"`
+}
+
+// ResponseQueryGateway extends the queryTx response with the usage of the
+// gateway, so that integrators can monitor how many deposits each of their
+// gateways has received. The expiry is only set once the gateway has been
+// renewed.
+type ResponseQueryGateway struct {
+	Tx     tx.Tx           `json:"tx"`
+	Usage  db.GatewayUsage `json:"usage"`
+	Status string          `json:"status"`
+	Expiry int64           `json:"expiry,omitempty"`
+}
+
+type ResponseQueryGatewayURI struct {
+	URI string `json:"uri"`
+	QR  string `json:"qr,omitempty"`
+}
+
+// ResponseQueryAssets lists the assets supported by the Lightnode, and whether
+// deposits of them have been paused by governance.
+type ResponseQueryAssets struct {
+	Assets []pause.Status `json:"assets"`
+}
+
+// ResponseQueryTxs extends the darknode response with pagination totals, so
+// that explorers can render page counts without counting txs themselves. The
+// total is approximate for large tables, but hasMore is always exact. The txs
+// come last, so that large pages can be streamed after the totals.
+type ResponseQueryTxs struct {
+	Total       int     `json:"total"`
+	Approximate bool    `json:"approximate"`
+	HasMore     bool    `json:"hasMore"`
+	Txs         []tx.Tx `json:"txs"`
+}
+
+// Fallback resolves the custom methods of the Lightnode, which are registered
+// in customMethods.
 func (resolver *Resolver) Fallback(ctx context.Context, id interface{}, method string, params interface{}, req *http.Request) jsonrpc.Response {
-	switch method {
-	case MethodSubmitGateway:
-		var parsedParams ParamsSubmitGateway
-		err := json.Unmarshal(params.(json.RawMessage), &parsedParams)
-		if err != nil {
-			return jsonrpc.NewResponse(id, nil, &jsonrpc.Error{
-				Code:    jsonrpc.ErrorCodeInvalidParams,
-				Message: fmt.Sprintf("invalid params: %v", err),
-			})
-		}
-		return resolver.SubmitGateway(ctx, id, &parsedParams, req)
-	case MethodQueryGateway:
-		var parsedParams ParamsQueryGateway
-		err := json.Unmarshal(params.(json.RawMessage), &parsedParams)
-		if err != nil {
-			return jsonrpc.NewResponse(id, nil, &jsonrpc.Error{
-				Code:    jsonrpc.ErrorCodeInvalidParams,
-				Message: fmt.Sprintf("invalid params: %v", err),
-			})
-		}
-		return resolver.QueryGateway(ctx, id, &parsedParams, req)
-	case MethodQueryTxsByTxid:
-		var parsedParams ParamsQueryTxByTxid
-		err := json.Unmarshal(params.(json.RawMessage), &parsedParams)
-		if err != nil {
+	m, ok := customMethods[method]
+	if !ok {
+		return jsonrpc.NewResponse(id, nil, &jsonrpc.Error{
+			Code:    errorCodeMethodNotFound,
+			Message: fmt.Sprintf("unknown method %v", method),
+		})
+	}
+	var parsedParams interface{}
+	if m.params != nil {
+		parsedParams = m.params()
+		if err := json.Unmarshal(params.(json.RawMessage), parsedParams); err != nil {
 			return jsonrpc.NewResponse(id, nil, &jsonrpc.Error{
 				Code:    jsonrpc.ErrorCodeInvalidParams,
 				Message: fmt.Sprintf("invalid params: %v", err),
 			})
 		}
-		return resolver.QueryTxByTxid(ctx, id, &parsedParams, req)
 	}
-	return jsonrpc.NewResponse(id, nil, nil)
+	return withEncoding(m.resolve(resolver, ctx, id, parsedParams, req), req)
 }
 
 func (resolver *Resolver) validateGateway(gateway string, tx tx.Tx, input PartialLockMintBurnReleaseInput) error {
@@ -196,7 +335,8 @@ func (resolver *Resolver) validateGateway(gateway string, tx tx.Tx, input Partia
 			scriptAddressStr = scriptAddress.EncodeAddress()
 		}
 
-		if scriptAddressStr != gateway {
+		chain := tx.Selector.Asset().OriginChain()
+		if NormalizeAddress(resolver.network, chain, scriptAddressStr) != NormalizeAddress(resolver.network, chain, gateway) {
 			return fmt.Errorf("gateway address mismatch: %v != %v", scriptAddressStr, gateway)
 		}
 	}
@@ -251,50 +391,64 @@ type PartialLockMintBurnReleaseInput struct {
 // Custom rpc for storing gateway information
 // NOTE: should be heavily rate-limited
 func (resolver *Resolver) SubmitGateway(ctx context.Context, id interface{}, params *ParamsSubmitGateway, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodSubmitGateway, req).WithFields(logging.Fields{
+		"gateway":  params.Gateway,
+		"selector": params.Tx.Selector.String(),
+	})
+
 	input := PartialLockMintBurnReleaseInput{}
 	err := pack.Decode(&input, params.Tx.Input)
 	if err != nil {
-		resolver.logger.Errorf("[responder] failed decode gateway information: %v :%v", params.Gateway, err)
+		logger.WithError(err).Error("[resolver] failed to decode gateway information")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidRequest, "Incorrect gateway tx", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
 	err = resolver.validateGateway(params.Gateway, params.Tx, input)
 	if err != nil {
-		resolver.logger.Errorf("[responder] failed to validate gateway information: %v :%v", params.Gateway, err)
+		logger.WithError(err).Error("[resolver] failed to validate gateway information")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidRequest, "Incorrect gateway tx", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
-	_, err = resolver.db.Gateway(params.Gateway)
+	// Store the gateway under its canonical address, so that it can be queried
+	// using any equivalent address.
+	gatewayAddr := NormalizeAddress(resolver.network, params.Tx.Selector.Asset().OriginChain(), params.Gateway)
+	_, existing, err := resolver.gateway(gatewayAddr)
 	if err != nil && err != sql.ErrNoRows {
-		resolver.logger.Errorf("[responder] cannot check gateway existence: %v, %v", params.Gateway, err)
+		logger.WithError(err).Error("[resolver] cannot check gateway existence")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to insert gateway", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
-	// If we have an existing gateway, return a successful response
+	// If we have an existing gateway, return a successful response, unless it
+	// was registered with different details.
 	if err == nil {
-		return jsonrpc.NewResponse(id, jsonrpc.ResponseSubmitTx{}, nil)
+		return resolver.existingGatewayResponse(id, logger, gatewayAddr, existing, params.Tx, input)
 	}
 
 	count, err := resolver.db.GatewayCount()
 	if err != nil {
-		resolver.logger.Errorf("[responder] cannot get gateway count: %v", err)
+		logger.WithError(err).Error("[resolver] cannot get gateway count")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to insert gateway", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
 	// Check if we exceed max gateways before insterting
 	if count > resolver.db.MaxGatewayCount() {
-		resolver.logger.Errorf("[responder] max number of gateways reached: %v", err)
+		logger.WithField("count", count).Error("[resolver] max number of gateways reached")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to insert gateway", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
-	err = resolver.db.InsertGateway(params.Gateway, params.Tx)
+	err = resolver.db.InsertGateway(gatewayAddr, params.Tx)
 	if err != nil {
-		resolver.logger.Errorf("[responder] cannot insert gateway: %v :%v", params.Gateway, err)
+		// The gateway may have been registered concurrently, in which case
+		// the insert violates the primary key.
+		if _, existing, existingErr := resolver.gateway(gatewayAddr); existingErr == nil {
+			return resolver.existingGatewayResponse(id, logger, gatewayAddr, existing, params.Tx, input)
+		}
+		logger.WithError(err).Error("[resolver] cannot insert gateway")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to insert gateway", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
@@ -302,35 +456,201 @@ func (resolver *Resolver) SubmitGateway(ctx context.Context, id interface{}, par
 	return jsonrpc.NewResponse(id, jsonrpc.ResponseSubmitTx{}, nil)
 }
 
+// GatewayConflict is the data of the error returned when submitting a gateway
+// whose address is already registered with different details. Two
+// registrations of the same address can only differ because of a derivation
+// bug or an attack.
+type GatewayConflict struct {
+	Gateway string `json:"gateway"`
+	Tx      tx.Tx  `json:"tx"`
+}
+
+// existingGatewayResponse returns the response for submitting a gateway which
+// is already registered. Submitting the same gateway again succeeds, but
+// submitting different details for the address returns a conflict error which
+// includes the existing registration.
+func (resolver *Resolver) existingGatewayResponse(id interface{}, logger logging.Logger, gatewayAddr string, existing, submitted tx.Tx, input PartialLockMintBurnReleaseInput) jsonrpc.Response {
+	existingInput := PartialLockMintBurnReleaseInput{}
+	if err := pack.Decode(&existingInput, existing.Input); err == nil && sameGateway(existing.Selector, existingInput, submitted.Selector, input) {
+		return jsonrpc.NewResponse(id, jsonrpc.ResponseSubmitTx{}, nil)
+	}
+
+	logger.WithField("existing", existing.Selector.String()).Warn("[resolver] gateway already registered with different details")
+	data, err := json.Marshal(GatewayConflict{Gateway: gatewayAddr, Tx: existing})
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot marshal gateway conflict")
+	}
+	conflict := lerrors.Wrapf(lerrors.ErrConflict, "gateway %v is already registered for %v", gatewayAddr, existing.Selector)
+	jsonErr := jsonrpc.NewError(lerrors.Code(conflict), conflict.Error(), json.RawMessage(data))
+	return jsonrpc.NewResponse(id, nil, &jsonErr)
+}
+
+// sameGateway returns whether two gateway registrations have the same
+// details. The ghash commits to the payload hash, the selector, the recipient
+// and the nonce.
+func sameGateway(selector tx.Selector, input PartialLockMintBurnReleaseInput, otherSelector tx.Selector, otherInput PartialLockMintBurnReleaseInput) bool {
+	return selector == otherSelector &&
+		input.Ghash == otherInput.Ghash &&
+		input.Phash == otherInput.Phash &&
+		input.To == otherInput.To &&
+		input.Nonce == otherInput.Nonce &&
+		input.Gpubkey.String() == otherInput.Gpubkey.String() &&
+		input.Payload.String() == otherInput.Payload.String()
+}
+
 // Custom rpc for fetching gateways by address
 func (resolver *Resolver) QueryGateway(ctx context.Context, id interface{}, params *ParamsQueryGateway, req *http.Request) jsonrpc.Response {
-	gateway, err := resolver.db.Gateway(params.Gateway)
+	logger := resolver.requestLogger(id, MethodQueryGateway, req).WithField("gateway", params.Gateway)
+
+	address, gateway, err := resolver.gateway(params.Gateway)
 	if err != nil {
-		resolver.logger.Errorf("[responder] cannot get gateway for gatewayAddress: %v :%v", params.Gateway, err)
+		logger.WithError(err).Error("[resolver] cannot get gateway")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to query txid", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
-	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryTx{Tx: gateway}, nil)
+	// Gateways of retired shards are not returned, so that users are not
+	// told to deposit to addresses which RenVM can no longer sign for.
+	status, err := resolver.db.GatewayStatus(address)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot get gateway status")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to query gateway status", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if status == db.GatewayStatusInvalid {
+		return lerrors.Response(id, invalidGatewayError(params.Gateway))
+	}
+	expiry, err := resolver.db.GatewayExpiry(address)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot get gateway expiry")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to query gateway status", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	response := ResponseQueryGateway{Tx: gateway, Status: status.String(), Expiry: expiry}
+	if ghash, ok := gateway.Input.Get("ghash").(pack.Bytes32); ok {
+		response.Usage, err = resolver.db.GatewayUsage(ghash)
+		if err != nil {
+			logger.WithError(err).Error("[resolver] cannot get gateway usage")
+			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to query gateway usage", nil)
+			return jsonrpc.NewResponse(id, nil, &jsonErr)
+		}
+	}
+	return jsonrpc.NewResponse(id, response, nil)
+}
+
+// gateway returns the gateway stored under any of the normalized forms of the
+// address, along with the form it is stored under. It returns `sql.ErrNoRows`
+// if the gateway cannot be found.
+func (resolver *Resolver) gateway(addr string) (string, tx.Tx, error) {
+	for _, candidate := range gatewayLookupAddresses(resolver.network, addr) {
+		gateway, err := resolver.db.Gateway(candidate)
+		if err != sql.ErrNoRows {
+			return candidate, gateway, err
+		}
+	}
+	return "", tx.Tx{}, sql.ErrNoRows
+}
+
+// Custom rpc for building the payment uri, and optionally the qr code, used to
+// deposit into a gateway
+func (resolver *Resolver) QueryGatewayURI(ctx context.Context, id interface{}, params *ParamsQueryGatewayURI, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodQueryGatewayURI, req).WithFields(logging.Fields{
+		"gateway": params.Gateway,
+		"asset":   params.Asset,
+	})
+
+	uri, err := payment.URI(params.Asset, params.Gateway, params.Amount)
+	if err != nil {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("invalid params: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	response := ResponseQueryGatewayURI{URI: uri}
+	if params.QR {
+		qr, err := payment.EncodeQR(uri)
+		if err != nil {
+			logger.WithError(err).Error("[resolver] cannot encode qr code")
+			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to encode qr code", nil)
+			return jsonrpc.NewResponse(id, nil, &jsonErr)
+		}
+		response.QR = qr.SVG()
+	}
+	return jsonrpc.NewResponse(id, response, nil)
 }
 
 // Custom rpc for fetching transactions by txid
 func (resolver *Resolver) QueryTxByTxid(ctx context.Context, id interface{}, params *ParamsQueryTxByTxid, req *http.Request) jsonrpc.Response {
-	txs, err := resolver.db.TxsByTxid(params.Txid)
+	logger := resolver.requestLogger(id, MethodQueryTxsByTxid, req).WithField("txid", params.Txid)
+
+	status, ok := txStatuses[params.Status]
+	if !ok {
+		return lerrors.Response(id, lerrors.Wrapf(lerrors.ErrInvalidParams, "unknown tx status %q", params.Status))
+	}
+	txs, err := resolver.db.TxsByTxid(params.Txid, params.Selector, status)
 	if err != nil {
-		resolver.logger.Errorf("[responder] cannot get txs for txid: %v :%v", params.Txid, err)
+		logger.WithError(err).Error("[resolver] cannot get txs for txid")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to query txid", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
 
+	// Every tx of the txid is returned, so the response is not paginated.
 	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryTxs{Txs: txs}, nil)
 }
 
+// Custom rpc for fetching transactions by the txid of the host chain
+// transaction which completed them, so that explorers can navigate from a
+// mint or release back to the RenVM tx and its deposit
+func (resolver *Resolver) QueryTxByDestTxid(ctx context.Context, id interface{}, params *ParamsQueryTxByDestTxid, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodQueryTxByDestTxid, req).WithField("destTxid", params.Txid)
+
+	txs, err := resolver.db.TxsByDestTxid(params.Txid)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot get txs for destination txid")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to query destination txid", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	return jsonrpc.NewResponse(id, ResponseQueryTxs{Txs: txs, Total: len(txs)}, nil)
+}
+
+// ResponsePreviewTxHash contains the hash of a v0 tx and the hash of the v1 tx
+// which is submitted on its behalf.
+type ResponsePreviewTxHash struct {
+	V0Hash v0.B32       `json:"v0Hash"`
+	V1Hash pack.Bytes32 `json:"v1Hash"`
+}
+
+// PreviewTxHash converts the v0 tx in the same way as a v0 submission, so that
+// integrators know the v1 hash of the tx before submitting it. Nothing is
+// persisted or sent to the darknodes.
+func (resolver *Resolver) PreviewTxHash(ctx context.Context, id interface{}, params *v0.ParamsSubmitTx, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodPreviewTxHash, req)
+
+	if err := v0.ValidateV0Tx(params.Tx); err != nil {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("invalid params: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	v0Hash, v1Tx, err := v0.ConvertV0Tx(ctx, params.Tx, resolver.chains, resolver.pubkey, resolver.network)
+	if err != nil {
+		logger.WithError(err).Warn("[resolver] cannot convert v0 tx")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("invalid params: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	return jsonrpc.NewResponse(id, ResponsePreviewTxHash{V0Hash: v0Hash, V1Hash: v1Tx.Hash}, nil)
+}
+
 // QueryTx either returns a locally cached result for confirming txs,
 // or forwards and caches the request to the darknodes
 // It will also detect if a tx is a v1 or v0 tx, and cast the response
-// accordingly
+// accordingly. The byte fields of the tx are encoded as the client requested.
 func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTx, req *http.Request) jsonrpc.Response {
+	return withEncoding(resolver.queryTx(ctx, id, params, req), req)
+}
+
+func (resolver *Resolver) queryTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTx, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, jsonrpc.MethodQueryTx, req).WithField("txHash", params.TxHash.String())
+
 	v0tx := false
 
 	v0txhash := [32]byte{}
@@ -339,14 +659,14 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 	// check if tx is v0 or v1 due to its presence in the mapping store
 	// We have to encode as non-url safe because that's the format v0 uses
 	txhash, err := resolver.versionStore.GetV1HashFromHash(v0txhash)
-	if err != v0.ErrNotFound {
+	if !lerrors.Is(err, lerrors.ErrNotFound) {
 		if err != nil {
-			resolver.logger.Errorf("[responder] cannot get v0-v1 tx mapping from store: %v", err)
+			logger.WithError(err).Error("[resolver] cannot get v0-v1 tx mapping from store")
 			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to read tx mapping from store", nil)
 			return jsonrpc.NewResponse(id, nil, &jsonErr)
 		}
 
-		resolver.logger.Debugf("[responder] found v0 tx mapping - v1: %s", txhash)
+		logger.WithField("v1TxHash", txhash.String()).Debug("[resolver] found v0 tx mapping")
 		params.TxHash = [32]byte(txhash)
 		v0tx = true
 	}
@@ -363,7 +683,7 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 		// Send the request to the Darknodes if we do not have it in our
 		// database.
 		if err != sql.ErrNoRows {
-			resolver.logger.Errorf("[responder] cannot get tx status from db: %v", err)
+			logger.WithError(err).Error("[resolver] cannot get tx status from db")
 			// some error handling
 			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to read tx from db", nil)
 			return jsonrpc.NewResponse(id, nil, &jsonErr)
@@ -391,14 +711,14 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 					nil,
 				)
 			} else {
-				return jsonrpc.NewResponse(
-					id,
-					jsonrpc.ResponseQueryTx{
-						Tx:       transaction,
-						TxStatus: tx.StatusConfirming,
-					},
-					nil,
-				)
+				resp := jsonrpc.ResponseQueryTx{
+					Tx:       transaction,
+					TxStatus: tx.StatusConfirming,
+				}
+				if formatAmounts(req) {
+					return jsonrpc.NewResponse(id, withFormattedAmount(resp), nil)
+				}
+				return jsonrpc.NewResponse(id, resp, nil)
 			}
 		}
 	}
@@ -410,14 +730,13 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 
 	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryTx, params, query)
 	if ok := resolver.cacher.Send(reqWithResponder); !ok {
-		resolver.logger.Error("failed to send request to cacher, too much back pressure")
-		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "too much back pressure", nil)
-		return jsonrpc.NewResponse(id, nil, &jsonErr)
+		logger.Error("[resolver] failed to send request to cacher, too much back pressure")
+		return lerrors.Response(id, lerrors.ErrBackpressure)
 	}
 
 	select {
 	case <-ctx.Done():
-		resolver.logger.Error("timeout when waiting for response: %v", ctx.Err())
+		logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for response")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 
@@ -426,26 +745,32 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 			return jsonrpc.NewResponse(id, nil, res.Error)
 		}
 
-		raw, err := json.Marshal(res.Result)
-		if err != nil {
-			resolver.logger.Errorf("[resolver] error marshaling queryTx result: %v", err)
+		if res.Result == nil {
+			logger.Warn("[resolver] empty response for hash")
 			return res
 		}
 
-		if raw == nil {
-			resolver.logger.Warnf("[resolver] empty response for hash %s", params.TxHash)
+		resp, err := lhttp.DecodeQueryTxResult(res.Result)
+		if err != nil {
+			logger.WithError(err).Warn("[resolver] cannot unmarshal queryTx result")
+			if v0tx {
+				// We cannot cast a response we do not understand, so let the
+				// caller know the Lightnode is out of date.
+				jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "unrecognised darknode response: upgrade lightnode", nil)
+				return jsonrpc.NewResponse(id, nil, &jsonErr)
+			}
 			return res
 		}
 
-		var resp jsonrpc.ResponseQueryTx
-		if err := json.Unmarshal(raw, &resp); err != nil {
-			resolver.logger.Warnf("[resolver] cannot unmarshal queryState result from %v", err)
+		if resp.Tx.Hash != params.TxHash {
+			logger.WithField("darknodeTxHash", resp.Tx.Hash.String()).Warn("[resolver] darknode query response does not match lightnode hash request")
 			return res
 		}
 
-		if resp.Tx.Hash != params.TxHash {
-			resolver.logger.Warnf("[resolver] darknode query response (%s) does not match lightnode hash request (%s)", resp.Tx.Hash, params.TxHash)
-			return res
+		if err := CheckTxCompat(resp.Tx); err != nil {
+			logger.WithError(err).Error("[resolver] incompatible darknode response")
+			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, err.Error(), nil)
+			return jsonrpc.NewResponse(id, nil, &jsonErr)
 		}
 
 		if !resp.Tx.Selector.IsIntrinsic() && resp.Tx.Output.String() == pack.NewTyped().String() {
@@ -456,12 +781,14 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 		if v0tx {
 			v0tx, err := v0.TxFromV1Tx(resp.Tx, true, resolver.bindings)
 			if err != nil {
-				resolver.logger.Errorf("[resolver] error casting tx from v1 to v0: %v", err)
+				logger.WithError(err).Error("[resolver] error casting tx from v1 to v0")
 				jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to cast v1 to v0 tx", nil)
 				return jsonrpc.NewResponse(id, nil, &jsonErr)
 			}
 
 			return jsonrpc.NewResponse(id, v0.ResponseQueryTx{Tx: v0tx, TxStatus: resp.TxStatus.String()}, nil)
+		} else if formatAmounts(req) {
+			return jsonrpc.NewResponse(id, withFormattedAmount(resp), nil)
 		} else {
 			return jsonrpc.NewResponse(id, resp, nil)
 		}
@@ -477,47 +804,44 @@ func (resolver *Resolver) QueryNumPeers(ctx context.Context, id interface{}, par
 }
 
 func (resolver *Resolver) QueryShards(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryShards, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, jsonrpc.MethodQueryShards, req)
+
 	// This is required for compatibility with renjs v1
 
 	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, nil)
 	if ok := resolver.cacher.Send(reqWithResponder); !ok {
-		resolver.logger.Error("failed to send request to cacher, too much back pressure")
-		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "too much back pressure", nil)
-		return jsonrpc.NewResponse(id, nil, &jsonErr)
+		logger.Error("[resolver] failed to send request to cacher, too much back pressure")
+		return lerrors.Response(id, lerrors.ErrBackpressure)
 	}
 
 	select {
 	case <-ctx.Done():
-		resolver.logger.Error("timeout when waiting for response: %v", ctx.Err())
+		logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for response")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	case response := <-reqWithResponder.Responder:
 		raw, err := json.Marshal(response.Result)
 		if err != nil {
-			resolver.logger.Errorf("[resolver] error marshaling queryBlockState result: %v", err)
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed compatibility conversion", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.WithError(err).Error("[resolver] error marshaling queryBlockState result")
+			return lerrors.Response(id, lerrors.ErrCompatConversion)
 		}
 		var resp jsonrpc.ResponseQueryBlockState
 		if err := json.Unmarshal(raw, &resp); err != nil {
-			resolver.logger.Errorf("[resolver] cannot unmarshal queryBlockState result from %v", err)
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed compatibility conversion", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.WithError(err).Error("[resolver] cannot unmarshal queryBlockState result")
+			return lerrors.Response(id, lerrors.ErrCompatConversion)
 		}
 		var system engine.SystemState
 
 		if err := pack.Decode(&system, resp.State.Get("System")); err != nil {
-			resolver.logger.Errorf("[resolver] cannot decode system state result from %v", err)
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed compatibility conversion", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.WithError(err).Error("[resolver] cannot decode system state result")
+			return lerrors.Response(id, lerrors.ErrCompatConversion)
 		}
 
 		shards, err := v0.ShardsResponseFromSystemState(system)
 
 		if err != nil {
-			resolver.logger.Error("failed to cast to QueryShards: %v", err)
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed compatibility conversion", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.WithError(err).Error("[resolver] failed to cast to QueryShards")
+			return lerrors.Response(id, lerrors.ErrCompatConversion)
 		}
 
 		return jsonrpc.NewResponse(id, shards, nil)
@@ -529,31 +853,32 @@ func (resolver *Resolver) QueryStat(ctx context.Context, id interface{}, params
 }
 
 func (resolver *Resolver) QueryFees(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryFees, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, jsonrpc.MethodQueryFees, req)
+
 	// This is required for compatibility with renjs v1
 
 	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, nil)
 	if ok := resolver.cacher.Send(reqWithResponder); !ok {
-		resolver.logger.Error("failed to send request to cacher, too much back pressure")
-		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "too much back pressure", nil)
-		return jsonrpc.NewResponse(id, nil, &jsonErr)
+		logger.Error("[resolver] failed to send request to cacher, too much back pressure")
+		return lerrors.Response(id, lerrors.ErrBackpressure)
 	}
 
 	select {
 	case <-ctx.Done():
-		resolver.logger.Error("timeout when waiting for response: %v", ctx.Err())
+		logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for response")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	case response := <-reqWithResponder.Responder:
 		raw, err := json.Marshal(response.Result)
 		if err != nil {
-			resolver.logger.Errorf("[resolver] error marshaling queryBlockState result: %v", err)
+			logger.WithError(err).Error("[resolver] error marshaling queryBlockState result")
 			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to marshal darknode queryBlockState for legacy assets", nil)
 			return jsonrpc.NewResponse(id, nil, &jsonErr)
 		}
 
 		var resp jsonrpc.ResponseQueryBlockState
 		if err := json.Unmarshal(raw, &resp); err != nil {
-			resolver.logger.Errorf("[resolver] cannot unmarshal queryBlockState result for v2 Assets: %v", err)
+			logger.WithError(err).Error("[resolver] cannot unmarshal queryBlockState result")
 			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed unmarshal darknode queryBlockState", nil)
 			return jsonrpc.NewResponse(id, nil, &jsonErr)
 		}
@@ -571,7 +896,7 @@ func (resolver *Resolver) QueryFees(ctx context.Context, id interface{}, params
 			}
 			var state engine.XState
 			if err := pack.Decode(&state, val); err != nil {
-				resolver.logger.Errorf("[resolver] cannot decode pack value for %v: %v", v, err)
+				logger.WithError(err).WithField("asset", v).Error("[resolver] cannot decode pack value")
 				jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to decode block state", nil)
 				return jsonrpc.NewResponse(id, nil, &jsonErr)
 			}
@@ -582,9 +907,8 @@ func (resolver *Resolver) QueryFees(ctx context.Context, id interface{}, params
 		fees, err := v0.QueryFeesResponseFromState(legacyAssetState)
 
 		if err != nil {
-			resolver.logger.Error("failed to cast to QueryFees: %v", err)
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed compatibility conversion", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.WithError(err).Error("[resolver] failed compatibility conversion")
+			return lerrors.Response(id, lerrors.ErrCompatConversion)
 		}
 
 		return jsonrpc.NewResponse(id, fees, nil)
@@ -592,35 +916,61 @@ func (resolver *Resolver) QueryFees(ctx context.Context, id interface{}, params
 }
 
 func (resolver *Resolver) QueryConfig(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryConfig, req *http.Request) jsonrpc.Response {
-	return resolver.handleMessage(ctx, id, jsonrpc.MethodQueryConfig, *params, req, false)
+	logger := resolver.requestLogger(id, jsonrpc.MethodQueryConfig, req)
+
+	response := resolver.handleMessage(ctx, id, jsonrpc.MethodQueryConfig, *params, req, false)
+	if response.Error != nil || response.Result == nil {
+		return response
+	}
+
+	// Append the wire versions supported by the Lightnode to the config
+	// returned by the Darknodes.
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] error marshaling queryConfig result")
+		return response
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &result); err != nil || result == nil {
+		logger.WithError(err).Warn("[resolver] cannot unmarshal queryConfig result")
+		return response
+	}
+	versions, err := json.Marshal(resolver.wireVersions)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] error marshaling wire versions")
+		return response
+	}
+	result["lightnode"] = versions
+	return jsonrpc.NewResponse(id, result, nil)
 }
 
 func (resolver *Resolver) QueryState(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryState, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, jsonrpc.MethodQueryState, req)
+
 	// This is required for compatibility with renjs v1
 
 	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlockState, params, nil)
 	if ok := resolver.cacher.Send(reqWithResponder); !ok {
-		resolver.logger.Error("failed to send request to cacher, too much back pressure")
-		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "too much back pressure", nil)
-		return jsonrpc.NewResponse(id, nil, &jsonErr)
+		logger.Error("[resolver] failed to send request to cacher, too much back pressure")
+		return lerrors.Response(id, lerrors.ErrBackpressure)
 	}
 
 	select {
 	case <-ctx.Done():
-		resolver.logger.Error("timeout when waiting for response: %v", ctx.Err())
+		logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for response")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	case response := <-reqWithResponder.Responder:
 		raw, err := json.Marshal(response.Result)
 		if err != nil {
-			resolver.logger.Errorf("[resolver] error marshaling queryBlockState result: %v", err)
+			logger.WithError(err).Error("[resolver] error marshaling queryBlockState result")
 			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed marshal darknode queryBlockState", nil)
 			return jsonrpc.NewResponse(id, nil, &jsonErr)
 		}
 
 		var resp jsonrpc.ResponseQueryBlockState
 		if err := json.Unmarshal(raw, &resp); err != nil {
-			resolver.logger.Errorf("[resolver] cannot unmarshal queryBlockState result for v2 Assets: %v", err)
+			logger.WithError(err).Error("[resolver] cannot unmarshal queryBlockState result")
 			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed unmarshal darknode queryBlockState", nil)
 			return jsonrpc.NewResponse(id, nil, &jsonErr)
 		}
@@ -642,7 +992,7 @@ func (resolver *Resolver) QueryState(ctx context.Context, id interface{}, params
 			}
 			var state engine.XState
 			if err := pack.Decode(&state, val); err != nil {
-				resolver.logger.Errorf("[resolver] cannot decode pack value for %v: %v", v, err)
+				logger.WithError(err).WithField("asset", v).Error("[resolver] cannot decode pack value")
 				jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to decode block state", nil)
 				return jsonrpc.NewResponse(id, nil, &jsonErr)
 			}
@@ -653,9 +1003,8 @@ func (resolver *Resolver) QueryState(ctx context.Context, id interface{}, params
 		shards, err := v1.QueryStateResponseFromState(resolver.bindings, v2AssetState)
 
 		if err != nil {
-			resolver.logger.Error("failed to cast to QueryFees: %v", err)
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed compatibility conversion", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.WithError(err).Error("[resolver] failed compatibility conversion")
+			return lerrors.Response(id, lerrors.ErrCompatConversion)
 		}
 
 		return jsonrpc.NewResponse(id, shards, nil)
@@ -667,6 +1016,8 @@ func (resolver *Resolver) QueryBlockState(ctx context.Context, id interface{}, p
 }
 
 func (resolver *Resolver) QueryTxs(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTxs, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, jsonrpc.MethodQueryTxs, req)
+
 	var offset int
 	if params.Offset == nil {
 		// If the offset is nil, set it to 0.
@@ -687,17 +1038,44 @@ func (resolver *Resolver) QueryTxs(ctx context.Context, id interface{}, params *
 	if params.Latest != nil {
 		latest = bool(*params.Latest)
 	}
-	// Fetch the matching transactions from the database.
-	txs, err := resolver.db.Txs(offset, limit, latest)
+	// Fetch the matching transactions from the database. An extra transaction
+	// is fetched to tell whether there is another page.
+	txs, err := resolver.db.Txs(offset, limit+1, latest)
 	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot fetch txs from db")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch txs: %v", err), nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	}
+	hasMore := len(txs) > limit
+	if hasMore {
+		txs = txs[:limit]
+	}
 
-	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryTxs{Txs: txs}, nil)
+	total, approximate, err := resolver.db.TxCount()
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot count txs in db")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to count txs: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	// The page bounds the total, which also makes it exact on the last page.
+	seen := offset + len(txs)
+	if !hasMore && len(txs) > 0 {
+		total, approximate = seen, false
+	} else if hasMore && total <= seen {
+		total = seen + 1
+	}
+
+	return withEncoding(jsonrpc.NewResponse(id, ResponseQueryTxs{
+		Txs:         txs,
+		Total:       total,
+		Approximate: approximate,
+		HasMore:     hasMore,
+	}, nil), req)
 }
 
 func (resolver *Resolver) handleMessage(ctx context.Context, id interface{}, method string, params interface{}, r *http.Request, isCompat bool) jsonrpc.Response {
+	logger := resolver.requestLogger(id, method, r)
+
 	query := url.Values{}
 	if r != nil {
 		query = r.URL.Query()
@@ -711,19 +1089,24 @@ func (resolver *Resolver) handleMessage(ctx context.Context, id interface{}, met
 	}
 
 	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, method, params, query)
-	if method == jsonrpc.MethodSubmitTx && params.(jsonrpc.ParamsSubmitTx).Tx.Selector.IsCrossChain() {
-		resolver.txCheckerRequests <- reqWithResponder
+	if method == jsonrpc.MethodSubmitTx && params.(jsonrpc.ParamsSubmitTx).Tx.Selector.IsCrossChain() && !resolver.compatOnly {
+		select {
+		case <-ctx.Done():
+			logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for txchecker")
+			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
+			return jsonrpc.NewResponse(id, nil, &jsonErr)
+		case resolver.txCheckerRequests <- reqWithResponder:
+		}
 	} else {
 		if ok := resolver.cacher.Send(reqWithResponder); !ok {
-			resolver.logger.Error("failed to send request to cacher, too much back pressure")
-			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "too much back pressure", nil)
-			return jsonrpc.NewResponse(id, nil, &jsonErr)
+			logger.Error("[resolver] failed to send request to cacher, too much back pressure")
+			return lerrors.Response(id, lerrors.ErrBackpressure)
 		}
 	}
 
 	select {
 	case <-ctx.Done():
-		resolver.logger.Error("timeout when waiting for response: %v", ctx.Err())
+		logger.WithError(ctx.Err()).Error("[resolver] timeout when waiting for response")
 		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "request timed out", nil)
 		return jsonrpc.NewResponse(id, nil, &jsonErr)
 	case res := <-reqWithResponder.Responder:
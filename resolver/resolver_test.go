@@ -4,12 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -22,7 +26,6 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/go-redis/redis/v7"
 	"github.com/renproject/aw/wire"
-	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
@@ -32,17 +35,59 @@ import (
 	v0 "github.com/renproject/lightnode/compat/v0"
 	v1 "github.com/renproject/lightnode/compat/v1"
 	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/pause"
+	"github.com/renproject/lightnode/pool"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/testutils"
+	"github.com/renproject/lightnode/version"
 	"github.com/renproject/lightnode/watcher"
 	"github.com/renproject/multichain"
 	"github.com/renproject/multichain/chain/bitcoincash"
 	"github.com/renproject/multichain/chain/zcash"
 	"github.com/renproject/pack"
+	"github.com/renproject/phi"
 	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 	"golang.org/x/time/rate"
 )
 
+type mockPauseSource map[multichain.Asset]string
+
+func (source mockPauseSource) Paused(ctx context.Context, asset multichain.Asset) (bool, string, error) {
+	reason, ok := source[asset]
+	return ok, reason, nil
+}
+
+// recordingCacher responds like the mock cacher, and records the methods of
+// the requests it receives.
+type recordingCacher struct {
+	testutils.MockCacher
+	methods chan string
+}
+
+func (cacher *recordingCacher) Handle(task phi.Task, message phi.Message) {
+	cacher.methods <- message.(lhttp.RequestWithResponder).Method
+	cacher.MockCacher.Handle(task, message)
+}
+
+// recordingChainUpdater records the updates it is given, and reports the
+// chains they pause as paused.
+type recordingChainUpdater struct {
+	updates []ParamsUpdateChains
+}
+
+func (updater *recordingChainUpdater) UpdateChains(ctx context.Context, params ParamsUpdateChains) ([]watcher.ChainStatus, error) {
+	updater.updates = append(updater.updates, params)
+	statuses := []watcher.ChainStatus{}
+	for _, chain := range params.Pause {
+		statuses = append(statuses, watcher.ChainStatus{Chain: chain, Paused: true})
+	}
+	return statuses, nil
+}
+
 type mockVerifier struct{}
 
 func (v mockVerifier) VerifyTx(ctx context.Context, tx tx.Tx) error {
@@ -50,7 +95,7 @@ func (v mockVerifier) VerifyTx(ctx context.Context, tx tx.Tx) error {
 }
 
 var _ = Describe("Resolver", func() {
-	init := func(ctx context.Context) (*Resolver, jsonrpc.Validator, *redis.Client) {
+	initWithCacher := func(ctx context.Context, blockCacheSize int, cacher phi.Task) (*Resolver, jsonrpc.Validator, *redis.Client) {
 		logger := logrus.New()
 
 		table := kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses")
@@ -68,7 +113,7 @@ var _ = Describe("Resolver", func() {
 		sqlDB, err := sql.Open("sqlite3", "./resolver_test.db")
 		Expect(err).NotTo(HaveOccurred())
 
-		database := db.New(sqlDB, 10)
+		database := db.New(sqlDB, 10, 1)
 		Expect(database.Init()).Should(Succeed())
 
 		mr, err := miniredis.Run()
@@ -79,35 +124,14 @@ var _ = Describe("Resolver", func() {
 		client := redis.NewClient(&redis.Options{
 			Addr: mr.Addr(),
 		})
-		// Hack to ensure that the mock tx can be cast
-		// prevents needing to use the bindings to find the utxo
-		params := testutils.MockParamSubmitTxV0BTC()
-		utxo := params.Tx.In.Get("utxo").Value.(v0.ExtBtcCompatUTXO)
-		vout := utxo.VOut.Int.String()
-		btcTxHash := utxo.TxHash
-		key := fmt.Sprintf("amount_%s_%s", btcTxHash, vout)
-		client.Set(key, 200000, 0)
-
-		bindingsOpts := binding.DefaultOptions().
-			WithNetwork("localnet").
-			WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-				RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
-				Confirmations: pack.U64(0),
-			}).
-			WithChainOptions(multichain.Ethereum, binding.ChainOptions{
-				RPC:              pack.String("https://multichain-staging.renproject.io/testnet/kovan"),
-				Confirmations:    pack.U64(0),
-				Protocol:         pack.String("0x5045E727D9D9AcDe1F6DCae52B078EC30dC95455"),
-				MaxConfirmations: pack.MaxU64,
-			})
+		// Chain state is read from fixtures rather than the testnet nodes.
+		chains := testutils.NewMockChainReader()
+		bindings := chains.Bindings()
 
-		bindings := binding.New(bindingsOpts)
-
-		cacher := testutils.NewMockCacher()
 		go cacher.Run(ctx)
 
 		versionStore := v0.NewCompatStore(database, client, time.Hour)
-		gpubkeyStore := v1.NewCompatStore(client)
+		gpubkeyStore := v1.NewCompatStore(client, time.Hour)
 
 		pubkeyB, err := base64.URLEncoding.DecodeString("AiF7_2ykZmts2wzZKJ5D-J1scRM2Pm2jJ84W_K4PQaGl")
 		Expect(err).ShouldNot(HaveOccurred())
@@ -118,14 +142,25 @@ var _ = Describe("Resolver", func() {
 		rateLimitConf := DefaultRateLimitConf()
 		rateLimitConf.IpMethodRate["fallback"] = rate.Limit(1)
 		limiter := NewRateLimiter(rateLimitConf)
-		validator := NewValidator(multichain.NetworkTestnet, bindings, (*id.PubKey)(pubkey), versionStore, gpubkeyStore, &limiter, logger)
+		pauser := pause.NewPauser(logger, mockPauseSource{multichain.DOGE: "upgrading gateway"}, []multichain.Asset{multichain.BTC, multichain.DOGE}, time.Minute)
+		pauser.Update(ctx)
+		validator := NewValidator(multichain.NetworkTestnet, chains, (*id.PubKey)(pubkey), versionStore, gpubkeyStore, pauser, limiter, logging.FromLogrus(logger)).WithDB(database)
 
 		mockVerifier := mockVerifier{}
-		resolver := New(multichain.NetworkTestnet, logger, cacher, multiaddrStore, database, jsonrpc.Options{}, versionStore, gpubkeyStore, bindings, mockVerifier)
+		resolver := New(multichain.NetworkTestnet, logging.FromLogrus(logger), cacher, multiaddrStore, database, jsonrpc.Options{}, versionStore, gpubkeyStore, bindings, chains, (*id.PubKey)(pubkey), mockVerifier, pauser, WriteBehind{}, pool.New("txchecker", 4), blockCacheSize).WithValidator(validator)
+		go resolver.Run(ctx)
 
 		return resolver, validator, client
 	}
 
+	initWithBlockCache := func(ctx context.Context, blockCacheSize int) (*Resolver, jsonrpc.Validator, *redis.Client) {
+		return initWithCacher(ctx, blockCacheSize, testutils.NewMockCacher())
+	}
+
+	init := func(ctx context.Context) (*Resolver, jsonrpc.Validator, *redis.Client) {
+		return initWithBlockCache(ctx, 0)
+	}
+
 	cleanup := func() {
 		Expect(os.Remove("./resolver_test.db")).Should(BeNil())
 	}
@@ -159,6 +194,7 @@ var _ = Describe("Resolver", func() {
 			resolver.QueryConfig(innerCtx, nil, &jsonrpc.ParamsQueryConfig{}, nil),
 			resolver.QueryState(innerCtx, nil, &jsonrpc.ParamsQueryState{}, nil),
 			resolver.QueryBlockState(innerCtx, nil, &jsonrpc.ParamsQueryBlockState{}, nil),
+			resolver.QueryTxByDestTxid(innerCtx, nil, &ParamsQueryTxByDestTxid{Txid: pack.Bytes{1}}, nil),
 		}
 
 		// Validate responses.
@@ -168,6 +204,102 @@ var _ = Describe("Resolver", func() {
 		}
 	})
 
+	It("should serve blocks at known heights from the block cache", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := initWithBlockCache(ctx, 10)
+		defer cleanup()
+
+		sqlDB, err := sql.Open("sqlite3", "./resolver_test.db")
+		Expect(err).NotTo(HaveOccurred())
+		defer sqlDB.Close()
+		database := db.New(sqlDB, 10, 1)
+		Expect(database.InsertBlocks(map[uint64][]byte{
+			1: []byte(`{"header":{"height":"1"}}`),
+			2: []byte(`{"header":{"height":"2"}}`),
+		})).Should(Succeed())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		height, n := pack.NewU64(1), pack.NewU64(2)
+		response := resolver.QueryBlocks(innerCtx, nil, &jsonrpc.ParamsQueryBlocks{BlockHeight: &height, N: &n}, nil)
+		Expect(response.Error).To(BeNil())
+		result, err := json.Marshal(response.Result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(MatchJSON(`{"blocks":[{"header":{"height":"1"}},{"header":{"height":"2"}}]}`))
+
+		response = resolver.QueryBlock(innerCtx, nil, &jsonrpc.ParamsQueryBlock{BlockHeight: &n}, nil)
+		Expect(response.Error).To(BeNil())
+		result, err = json.Marshal(response.Result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(MatchJSON(`{"block":{"header":{"height":"2"}}}`))
+
+		// Blocks which are not cached are requested from the Darknodes.
+		n = pack.NewU64(3)
+		response = resolver.QueryBlocks(innerCtx, nil, &jsonrpc.ParamsQueryBlocks{BlockHeight: &height, N: &n}, nil)
+		Expect(response.Result).To(BeNil())
+	})
+
+	It("should warm up the responses requested by most clients", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+		Expect(resolver.Warmup(innerCtx)).To(Succeed())
+	})
+
+	It("should log the outcome and duration of each request", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		logger, hook := logrustest.NewNullLogger()
+		loggingResolver := NewLoggingResolver(resolver, logging.FromLogrus(logger))
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		req := &http.Request{
+			Header:     http.Header{"X-Forwarded-For": []string{"1.1.1.1, 2.2.2.2"}},
+			RemoteAddr: "3.3.3.3:1234",
+		}
+		response := loggingResolver.QueryBlock(innerCtx, 1, &jsonrpc.ParamsQueryBlock{}, req)
+		Expect(response.Error).To(BeNil())
+
+		entry := hook.LastEntry()
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.Level).To(Equal(logrus.InfoLevel))
+		Expect(entry.Data).To(HaveKeyWithValue("method", jsonrpc.MethodQueryBlock))
+		Expect(entry.Data).To(HaveKeyWithValue("requestID", 1))
+		Expect(entry.Data).To(HaveKeyWithValue("clientIP", "2.2.2.2"))
+		Expect(entry.Data).To(HaveKey("durationMs"))
+
+		params, err := json.Marshal(ParamsQueryGateway{Gateway: "unknown"})
+		Expect(err).NotTo(HaveOccurred())
+		response = loggingResolver.Fallback(innerCtx, 2, MethodQueryGateway, json.RawMessage(params), req)
+		Expect(response.Error).NotTo(BeNil())
+
+		entry = hook.LastEntry()
+		Expect(entry.Level).To(Equal(logrus.WarnLevel))
+		Expect(entry.Data).To(HaveKeyWithValue("method", MethodQueryGateway))
+		Expect(entry.Data).To(HaveKeyWithValue("errorCode", response.Error.Code))
+
+		// Methods which are not registered are tracked together.
+		response = loggingResolver.Fallback(innerCtx, 3, "ren_notAMethod", nil, req)
+		Expect(response.Error).NotTo(BeNil())
+
+		entry = hook.LastEntry()
+		Expect(entry.Data).To(HaveKeyWithValue("method", "unknown"))
+	})
+
 	It("should handle queryTx to a v0 tx", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -286,6 +418,60 @@ var _ = Describe("Resolver", func() {
 		resp = resolver.Fallback(ctx, nil, MethodQueryTxsByTxid, raw, nil)
 
 		Expect(resp).ShouldNot(Equal(jsonrpc.Response{}))
+		Expect(resp.Error).To(BeNil())
+		Expect(resp.Result).To(BeAssignableToTypeOf(jsonrpc.ResponseQueryTxs{}))
+	})
+
+	It("should handle queryLightnodeVersion", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		resp := resolver.Fallback(ctx, 1, MethodQueryLightnodeVersion, json.RawMessage("{}"), nil)
+		Expect(resp.Error).To(BeNil())
+		Expect(resp.Result).To(Equal(version.Get()))
+	})
+
+	It("should estimate fees from the block state", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		// The mock block state has a gas cap of 2 and a gas limit of 3, and no
+		// host chain fees.
+		resp := resolver.Fallback(innerCtx, 1, MethodEstimateFee, json.RawMessage(`{"selector":"BTC/toEthereum","amount":"10000"}`), nil)
+		Expect(resp.Error).To(BeNil())
+		result, err := json.Marshal(resp.Result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(MatchJSON(`{"mintFee":"0","burnFee":"0","lockFee":"6","releaseFee":"0","minimumAmount":"0","received":"9994"}`))
+
+		resp = resolver.Fallback(innerCtx, 1, MethodEstimateFee, json.RawMessage(`{"selector":"BTC/fromEthereum","amount":"4"}`), nil)
+		Expect(resp.Error).To(BeNil())
+		result, err = json.Marshal(resp.Result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(MatchJSON(`{"mintFee":"0","burnFee":"0","lockFee":"0","releaseFee":"6","minimumAmount":"0","received":"0"}`))
+
+		resp = resolver.Fallback(innerCtx, 1, MethodEstimateFee, json.RawMessage(`{"selector":"DOT/toEthereum","amount":"10000"}`), nil)
+		Expect(resp.Error).NotTo(BeNil())
+	})
+
+	It("should reject unknown custom methods", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		resp := resolver.Fallback(ctx, 1, "ren_queryUnknown", json.RawMessage("{}"), nil)
+		Expect(resp.Error).NotTo(BeNil())
+		Expect(resp.Error.Code).To(Equal(-32601))
 	})
 
 	It("should handle a request without a specified ID", func() {
@@ -385,6 +571,38 @@ var _ = Describe("Resolver", func() {
 		Expect(resp.Error).Should(BeZero())
 	})
 
+	It("should preview the v1 hash of v0 txs", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, validator, _ := init(ctx)
+		defer cleanup()
+
+		params := testutils.MockBurnParamSubmitTxV0BTC()
+		paramsJSON, err := json.Marshal(params)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		resp := resolver.Fallback(innerCtx, nil, MethodPreviewTxHash, json.RawMessage(paramsJSON), nil)
+		Expect(resp.Error).Should(BeZero())
+		preview := resp.Result.(ResponsePreviewTxHash)
+
+		// Ensure the preview matches the tx which is submitted.
+		req, resp := validator.ValidateRequest(innerCtx, &http.Request{}, jsonrpc.Request{
+			Version: "2.0",
+			ID:      nil,
+			Method:  jsonrpc.MethodSubmitTx,
+			Params:  paramsJSON,
+		})
+		Expect(resp).Should(Equal(jsonrpc.Response{}))
+		Expect((req).(*jsonrpc.ParamsSubmitTx).Tx.Hash).Should(Equal(preview.V1Hash))
+		v0Hash, err := v0.V0TxHashFromTx(params.Tx)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(preview.V0Hash).Should(Equal(v0Hash))
+	})
+
 	It("should submit v0 burn txs", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -412,6 +630,17 @@ var _ = Describe("Resolver", func() {
 
 		resp = resolver.SubmitTx(ctx, nil, (req).(*jsonrpc.ParamsSubmitTx), nil)
 		Expect(resp.Error).Should(BeZero())
+
+		// The original v0 params should be retrievable by the v1 hash.
+		sqlDB, err := sql.Open("sqlite3", "./resolver_test.db")
+		Expect(err).NotTo(HaveOccurred())
+		defer sqlDB.Close()
+		database := db.New(sqlDB, 10, 1)
+		payloads, err := database.V0PayloadsByTx((req).(*jsonrpc.ParamsSubmitTx).Tx.Hash)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payloads).Should(HaveLen(1))
+		Expect(payloads[0].Payload).Should(Equal(paramsJSON))
+		Expect(payloads[0].Digest).Should(Equal(db.V0PayloadDigest(paramsJSON)))
 	})
 
 	It("should submit txs", func() {
@@ -435,6 +664,198 @@ var _ = Describe("Resolver", func() {
 		Expect(resp.Error).Should(BeZero())
 	})
 
+	It("should send submissions straight to the cacher when compat-only", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cacher := &recordingCacher{methods: make(chan string, 128)}
+		resolver, _, _ := initWithCacher(ctx, 0, phi.New(cacher, phi.Options{Cap: 128}))
+		resolver.WithCompatOnly()
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		params := jsonrpc.ParamsSubmitTx{
+			Tx: txutil.RandomGoodTx(r),
+		}
+		Expect(params.Tx.Selector.IsCrossChain()).To(BeTrue())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+		resp := resolver.SubmitTx(innerCtx, nil, &params, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		// The cacher forwards submissions to the dispatcher, which sends them
+		// to the upstream Lightnode.
+		Eventually(cacher.methods).Should(Receive(Equal(jsonrpc.MethodSubmitTx)))
+	})
+
+	It("should accept concurrent and repeated submissions of the same tx", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		transaction := txutil.RandomGoodTx(r)
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				params := jsonrpc.ParamsSubmitTx{Tx: transaction}
+				resp := resolver.SubmitTx(innerCtx, nil, &params, nil)
+				Expect(resp.Error).Should(BeZero())
+			}()
+		}
+		wg.Wait()
+
+		params := jsonrpc.ParamsSubmitTx{Tx: transaction}
+		resp := resolver.SubmitTx(innerCtx, nil, &params, nil)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result).Should(Equal(jsonrpc.ResponseSubmitTx{}))
+
+		// The persistence of the tx is only included if it is asked for.
+		req := httptest.NewRequest(http.MethodPost, "/?"+PersistenceParam+"=true", nil)
+		resp = resolver.SubmitTx(innerCtx, nil, &params, req)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result).Should(Equal(ResponseSubmitTx{Persistence: PersistenceDurable, Status: "confirming"}))
+
+		// Txs claiming the hash of a stored tx are not resubmissions.
+		forged := txutil.RandomGoodTx(r)
+		forged.Hash = transaction.Hash
+		forgedParams := jsonrpc.ParamsSubmitTx{Tx: forged}
+		resp = resolver.SubmitTx(innerCtx, nil, &forgedParams, req)
+		Expect(resp.Result).ShouldNot(Equal(ResponseSubmitTx{Persistence: PersistenceDurable, Status: "confirming"}))
+	})
+
+	It("should only fail the submissions of txs which cannot be written", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		// The verifier accepts every tx, but a txid of the wrong type cannot
+		// be written to the database.
+		bad := txutil.RandomGoodTx(r)
+		bad.Input = pack.NewTyped("txid", pack.NewU32(1))
+
+		// The txs are submitted concurrently so that they can end up in the
+		// same batch.
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			good := txutil.RandomGoodTx(r)
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				params := jsonrpc.ParamsSubmitTx{Tx: good}
+				resp := resolver.SubmitTx(innerCtx, nil, &params, nil)
+				Expect(resp.Error).Should(BeZero())
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				params := jsonrpc.ParamsSubmitTx{Tx: bad}
+				resp := resolver.SubmitTx(innerCtx, nil, &params, nil)
+				Expect(resp.Error).ShouldNot(BeZero())
+			}()
+		}
+		wg.Wait()
+	})
+
+	It("should submit txs with payloads uploaded in chunks", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		payload := make([]byte, 1000)
+		r.Read(payload)
+
+		// Build the tx with its full payload, and then remove the payload so
+		// that it can be uploaded separately.
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BTC/toEthereum")
+		input := engine.LockMintBurnReleaseInput{}
+		Expect(pack.Decode(&input, mocktx.Input)).To(Succeed())
+		input.Gpubkey = pack.Bytes{}
+		input.Payload = payload
+		input.Phash = engine.Phash(payload)
+		encoded, err := pack.Encode(input)
+		Expect(err).NotTo(HaveOccurred())
+		fullTx, err := tx.NewTx(mocktx.Selector, pack.Typed(encoded.(pack.Struct)))
+		Expect(err).NotTo(HaveOccurred())
+
+		input.Payload = pack.Bytes{}
+		encoded, err = pack.Encode(input)
+		Expect(err).NotTo(HaveOccurred())
+		partialTx := fullTx
+		partialTx.Input = pack.Typed(encoded.(pack.Struct))
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		// Finalized txs are passed through the validator, which needs the
+		// address of the client to rate limit it.
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+
+		resp := resolver.BeginSubmit(innerCtx, nil, &ParamsBeginSubmit{Tx: partialTx, PayloadSize: pack.U64(len(payload))}, nil)
+		Expect(resp.Error).Should(BeZero())
+		submissionID := resp.Result.(ResponseBeginSubmit).SubmissionID
+
+		// The submission cannot be finalized until the whole payload has
+		// been received, and chunks must be appended in order.
+		resp = resolver.FinalizeSubmit(innerCtx, nil, &ParamsFinalizeSubmit{SubmissionID: submissionID}, req)
+		Expect(resp.Error).ShouldNot(BeZero())
+		resp = resolver.AppendPayload(innerCtx, nil, &ParamsAppendPayload{SubmissionID: submissionID, Offset: 600, Data: payload[600:]}, nil)
+		Expect(resp.Error).ShouldNot(BeZero())
+
+		for _, offset := range []int{0, 400, 400, 800} {
+			end := offset + 400
+			if end > len(payload) {
+				end = len(payload)
+			}
+			resp = resolver.AppendPayload(innerCtx, nil, &ParamsAppendPayload{SubmissionID: submissionID, Offset: pack.U64(offset), Data: payload[offset:end]}, nil)
+			Expect(resp.Error).Should(BeZero())
+			Expect(resp.Result.(ResponseAppendPayload).Received).Should(Equal(pack.U64(end)))
+		}
+
+		resp = resolver.FinalizeSubmit(innerCtx, nil, &ParamsFinalizeSubmit{SubmissionID: submissionID}, req)
+		Expect(resp.Error).Should(BeZero())
+
+		// Finalized submissions are removed.
+		resp = resolver.FinalizeSubmit(innerCtx, nil, &ParamsFinalizeSubmit{SubmissionID: submissionID}, req)
+		Expect(resp.Error).ShouldNot(BeZero())
+
+		// Payloads which do not match the phash of the tx are rejected.
+		resp = resolver.BeginSubmit(innerCtx, nil, &ParamsBeginSubmit{Tx: partialTx, PayloadSize: pack.U64(len(payload))}, nil)
+		Expect(resp.Error).Should(BeZero())
+		submissionID = resp.Result.(ResponseBeginSubmit).SubmissionID
+		corrupted := append([]byte{}, payload...)
+		corrupted[0]++
+		resp = resolver.AppendPayload(innerCtx, nil, &ParamsAppendPayload{SubmissionID: submissionID, Data: corrupted}, nil)
+		Expect(resp.Error).Should(BeZero())
+		resp = resolver.FinalizeSubmit(innerCtx, nil, &ParamsFinalizeSubmit{SubmissionID: submissionID}, req)
+		Expect(resp.Error).ShouldNot(BeZero())
+		Expect(resp.Error.Message).Should(ContainSubstring("phash"))
+	})
+
 	It("should submit gateway txs for btc", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -525,6 +946,445 @@ var _ = Describe("Resolver", func() {
 		Expect(resp.Error).Should(BeZero())
 	})
 
+	It("should reject gateways which are already registered with different details", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BTC/toEthereum")
+
+		input := engine.LockMintBurnReleaseInput{}
+		Expect(pack.Decode(&input, mocktx.Input)).To(Succeed())
+		script, err := engine.UTXOGatewayScript(mocktx.Selector.Asset().OriginChain(), mocktx.Selector.Asset(), input.Gpubkey, input.Ghash)
+		Expect(err).NotTo(HaveOccurred())
+		scriptAddress, err := btcutil.NewAddressScriptHash(script, watcher.NetParams(mocktx.Selector.Asset().OriginChain(), multichain.NetworkTestnet))
+		Expect(err).NotTo(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		params := ParamsSubmitGateway{Gateway: scriptAddress.EncodeAddress(), Tx: mocktx}
+		resp := resolver.SubmitGateway(innerCtx, nil, &params, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		// Submitting the same gateway again should succeed.
+		resp = resolver.SubmitGateway(innerCtx, nil, &params, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		// The address only depends on the gpubkey and the ghash, so a
+		// different payload results in the same address.
+		input.Payload = pack.Bytes("different payload")
+		input.Phash = engine.Phash(input.Payload)
+		encoded, err := pack.Encode(input)
+		Expect(err).NotTo(HaveOccurred())
+		conflicting := mocktx
+		conflicting.Input = pack.Typed(encoded.(pack.Struct))
+
+		resp = resolver.SubmitGateway(innerCtx, nil, &ParamsSubmitGateway{Gateway: scriptAddress.EncodeAddress(), Tx: conflicting}, nil)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).Should(Equal(jsonrpc.ErrorCodeInvalidParams))
+		Expect(resp.Error.Message).Should(ContainSubstring("already registered"))
+	})
+
+	It("should query bch gateways using equivalent addresses", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BCH/toEthereum")
+
+		input := engine.LockMintBurnReleaseInput{}
+		err := pack.Decode(&input, mocktx.Input)
+		Expect(err).NotTo(HaveOccurred())
+
+		script, err := engine.UTXOGatewayScript(mocktx.Selector.Asset().OriginChain(), mocktx.Selector.Asset(), input.Gpubkey, input.Ghash)
+		Expect(err).NotTo(HaveOccurred())
+
+		params := watcher.NetParams(mocktx.Selector.Asset().OriginChain(), multichain.NetworkTestnet)
+		cashAddr, err := bitcoincash.NewAddressScriptHash(script, params)
+		Expect(err).NotTo(HaveOccurred())
+		legacyAddr, err := btcutil.NewAddressScriptHash(script, params)
+		Expect(err).NotTo(HaveOccurred())
+		prefixedAddr := strings.ToUpper("bchtest:" + strings.TrimPrefix(cashAddr.EncodeAddress(), "bchtest:"))
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		// Submit the gateway using its legacy address, and query it using
+		// each of its encodings.
+		resp := resolver.SubmitGateway(innerCtx, nil, &ParamsSubmitGateway{Gateway: legacyAddr.EncodeAddress(), Tx: mocktx}, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		for _, addr := range []string{cashAddr.EncodeAddress(), prefixedAddr, legacyAddr.EncodeAddress()} {
+			resp := resolver.QueryGateway(innerCtx, nil, &ParamsQueryGateway{Gateway: addr}, nil)
+			Expect(resp.Error).Should(BeZero())
+			Expect(resp.Result.(ResponseQueryGateway).Tx.Selector).To(Equal(mocktx.Selector))
+			Expect(resp.Result.(ResponseQueryGateway).Usage.DepositCount).To(BeZero())
+		}
+
+		Expect(NormalizeAddress(multichain.NetworkTestnet, multichain.Bitcoin, "TB1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KXPJZSX")).To(Equal("tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"))
+		Expect(NormalizeAddress(multichain.NetworkTestnet, multichain.Bitcoin, legacyAddr.EncodeAddress())).To(Equal(legacyAddr.EncodeAddress()))
+	})
+
+	It("should renew gateways", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BCH/toEthereum")
+
+		input := engine.LockMintBurnReleaseInput{}
+		Expect(pack.Decode(&input, mocktx.Input)).To(Succeed())
+		script, err := engine.UTXOGatewayScript(mocktx.Selector.Asset().OriginChain(), mocktx.Selector.Asset(), input.Gpubkey, input.Ghash)
+		Expect(err).NotTo(HaveOccurred())
+		addr, err := btcutil.NewAddressScriptHash(script, watcher.NetParams(mocktx.Selector.Asset().OriginChain(), multichain.NetworkTestnet))
+		Expect(err).NotTo(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+		resp := resolver.SubmitGateway(innerCtx, nil, &ParamsSubmitGateway{Gateway: addr.EncodeAddress(), Tx: mocktx}, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		resp = resolver.QueryGateway(innerCtx, nil, &ParamsQueryGateway{Gateway: addr.EncodeAddress()}, nil)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result.(ResponseQueryGateway).Status).To(Equal("empty"))
+		Expect(resp.Result.(ResponseQueryGateway).Expiry).To(BeZero())
+
+		// Renewals require an api key.
+		renewParams := json.RawMessage(fmt.Sprintf(`{"gateway":%q,"duration":"3600"}`, addr.EncodeAddress()))
+		resp = resolver.Fallback(innerCtx, nil, MethodRenewGateway, renewParams, nil)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(lerrors.ErrorCodeUnauthorized))
+
+		resolver.WithAdmission(NewAdmissionController(AdmissionConf{
+			Shares:  map[string]float64{"integrator": 1},
+			APIKeys: map[string]string{"secret": "integrator"},
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(APIKeyHeader, "wrong")
+		resp = resolver.Fallback(innerCtx, nil, MethodRenewGateway, renewParams, req)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(lerrors.ErrorCodeUnauthorized))
+
+		req.Header.Set(APIKeyHeader, "secret")
+		resp = resolver.Fallback(innerCtx, nil, MethodRenewGateway, renewParams, req)
+		Expect(resp.Error).Should(BeZero())
+		renewed := resp.Result.(ResponseRenewGateway)
+		Expect(renewed.Status).To(Equal("empty"))
+		Expect(renewed.Expiry).To(BeNumerically("~", time.Now().Add(time.Hour).Unix(), 5))
+
+		resp = resolver.QueryGateway(innerCtx, nil, &ParamsQueryGateway{Gateway: addr.EncodeAddress()}, nil)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result.(ResponseQueryGateway).Expiry).To(Equal(renewed.Expiry))
+
+		// Renewals are limited, and unknown gateways cannot be renewed.
+		resp = resolver.RenewGateway(innerCtx, nil, &ParamsRenewGateway{Gateway: addr.EncodeAddress(), Duration: pack.U64(uint64(MaxGatewayRenewal/time.Second) + 1)}, req)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+		resp = resolver.RenewGateway(innerCtx, nil, &ParamsRenewGateway{Gateway: "unknown"}, req)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+	})
+
+	It("should only update chains for admins", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		params := json.RawMessage(`{"pause":["Ethereum"]}`)
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp := resolver.Fallback(ctx, nil, MethodUpdateChains, params, req)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(lerrors.ErrorCodeUnauthorized))
+
+		updater := &recordingChainUpdater{}
+		resolver.WithChainUpdater(updater, "secret")
+		resp = resolver.Fallback(ctx, nil, MethodUpdateChains, params, nil)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(lerrors.ErrorCodeUnauthorized))
+		req.Header.Set("Authorization", "Bearer wrong")
+		resp = resolver.Fallback(ctx, nil, MethodUpdateChains, params, req)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(lerrors.ErrorCodeUnauthorized))
+		Expect(updater.updates).To(BeEmpty())
+
+		req.Header.Set("Authorization", "Bearer secret")
+		resp = resolver.Fallback(ctx, nil, MethodUpdateChains, params, req)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result.(ResponseUpdateChains).Chains).To(Equal([]watcher.ChainStatus{
+			{Chain: multichain.Ethereum, Paused: true},
+		}))
+		Expect(updater.updates).To(Equal([]ParamsUpdateChains{{Pause: []multichain.Chain{multichain.Ethereum}}}))
+	})
+
+	It("should list gateways", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BCH/toEthereum")
+
+		input := engine.LockMintBurnReleaseInput{}
+		Expect(pack.Decode(&input, mocktx.Input)).To(Succeed())
+		script, err := engine.UTXOGatewayScript(mocktx.Selector.Asset().OriginChain(), mocktx.Selector.Asset(), input.Gpubkey, input.Ghash)
+		Expect(err).NotTo(HaveOccurred())
+		addr, err := btcutil.NewAddressScriptHash(script, watcher.NetParams(mocktx.Selector.Asset().OriginChain(), multichain.NetworkTestnet))
+		Expect(err).NotTo(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+		resp := resolver.SubmitGateway(innerCtx, nil, &ParamsSubmitGateway{Gateway: addr.EncodeAddress(), Tx: mocktx}, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		resp = resolver.Fallback(innerCtx, nil, MethodQueryGateways, json.RawMessage(`{"status":"empty","limit":"5"}`), nil)
+		Expect(resp.Error).Should(BeZero())
+		page := resp.Result.(ResponseQueryGateways)
+		Expect(page.HasMore).To(BeFalse())
+		Expect(page.Gateways).To(HaveLen(1))
+		Expect(page.Gateways[0].Gateway).To(Equal(addr.EncodeAddress()))
+		Expect(page.Gateways[0].Status).To(Equal("empty"))
+
+		resp = resolver.QueryGateways(innerCtx, nil, &ParamsQueryGateways{Status: "used"}, nil)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result.(ResponseQueryGateways).Gateways).To(BeEmpty())
+
+		resp = resolver.QueryGateways(innerCtx, nil, &ParamsQueryGateways{Status: "open"}, nil)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+	})
+
+	It("should list txs by recipient", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		resp := resolver.Fallback(ctx, nil, MethodQueryTxsByRecipient, json.RawMessage(`{"to":"unknown","selector":"BTC/toEthereum","limit":"5"}`), nil)
+		Expect(resp.Error).Should(BeZero())
+		page := resp.Result.(ResponseQueryTxsByRecipient)
+		Expect(page.HasMore).To(BeFalse())
+		Expect(page.Txs).To(BeEmpty())
+	})
+
+	It("should query burns by ref", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		resp := resolver.Fallback(ctx, nil, MethodQueryBurnsByRef, json.RawMessage(`{"ref":"12","selector":"BTC/fromEthereum"}`), nil)
+		Expect(resp.Error).Should(BeZero())
+		Expect(resp.Result.(ResponseQueryTxs).Txs).To(BeEmpty())
+
+		for _, params := range []string{`{}`, `{"ref":"12","nonce":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAw"}`, `{"ref":"12","selector":"BTC/toEthereum"}`} {
+			resp = resolver.Fallback(ctx, nil, MethodQueryBurnsByRef, json.RawMessage(params), nil)
+			Expect(resp.Error).ShouldNot(BeNil())
+			Expect(resp.Error.Code).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+		}
+	})
+
+	It("should page through txs with a cursor", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		resp := resolver.Fallback(ctx, nil, MethodQueryTxsPaged, json.RawMessage(`{"limit":"5","latest":true}`), nil)
+		Expect(resp.Error).Should(BeZero())
+		page := resp.Result.(ResponseQueryTxsPaged)
+		Expect(page.NextCursor).To(BeEmpty())
+
+		resp = resolver.Fallback(ctx, nil, MethodQueryTxsPaged, json.RawMessage(`{"cursor":"not a cursor"}`), nil)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Code).To(Equal(jsonrpc.ErrorCodeInvalidParams))
+	})
+
+	It("should stream ren_queryTxs responses with large limits", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, validator, _ := init(ctx)
+		defer cleanup()
+
+		sqlDB, err := sql.Open("sqlite3", "./resolver_test.db")
+		Expect(err).NotTo(HaveOccurred())
+		defer sqlDB.Close()
+		database := db.New(sqlDB, 10, 1)
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		for i := 0; i < 3; i++ {
+			Expect(database.InsertTx(txutil.RandomGoodTx(r))).To(Succeed())
+		}
+
+		passed := 0
+		logger, hook := logrustest.NewNullLogger()
+		handler := NewTxStreamHandler(resolver, NewLoggingResolver(resolver, logging.FromLogrus(logger)), validator, 2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			passed++
+		}))
+		serve := func(body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			return w
+		}
+
+		// Small pages are served by the JSON-RPC server.
+		serve(`{"jsonrpc":"2.0","id":1,"method":"ren_queryTxs","params":{"limit":"1"}}`)
+		serve(`{"jsonrpc":"2.0","id":1,"method":"ren_queryBlockState","params":{}}`)
+		Expect(passed).To(Equal(2))
+
+		w := serve(`{"jsonrpc":"2.0","id":1,"method":"ren_queryTxs","params":{"limit":"2","latest":true}}`)
+		Expect(passed).To(Equal(2))
+		Expect(w.Header().Get(lhttp.VersionHeader)).To(Equal(version.Version))
+		streamed := struct {
+			ID     int              `json:"id"`
+			Result ResponseQueryTxs `json:"result"`
+		}{}
+		Expect(json.Unmarshal(w.Body.Bytes(), &streamed)).To(Succeed())
+		Expect(streamed.ID).To(Equal(1))
+		Expect(streamed.Result.HasMore).To(BeTrue())
+		Expect(streamed.Result.Total).To(Equal(3))
+
+		expected := []tx.Tx{}
+		Expect(database.TxsAfter(db.TxCursor{}, 2, true, func(transaction tx.Tx, _ db.TxCursor) error {
+			expected = append(expected, transaction)
+			return nil
+		})).To(Succeed())
+		Expect(streamed.Result.Txs).To(HaveLen(len(expected)))
+		for i := range expected {
+			Expect(streamed.Result.Txs[i].Hash).To(Equal(expected[i].Hash))
+		}
+
+		// The streamed response is encoded as the JSON-RPC server would
+		// encode it.
+		data, err := json.Marshal(jsonrpc.NewResponse(1, ResponseQueryTxs{
+			Total:       3,
+			Approximate: streamed.Result.Approximate,
+			HasMore:     true,
+			Txs:         expected,
+		}, nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Body.String()).To(Equal(string(data)))
+
+		// Streamed requests are logged like those of the JSON-RPC server.
+		entry := hook.LastEntry()
+		Expect(entry).NotTo(BeNil())
+		Expect(entry.Level).To(Equal(logrus.InfoLevel))
+		Expect(entry.Data).To(HaveKeyWithValue("method", jsonrpc.MethodQueryTxs))
+
+		// Txs before the offset are skipped.
+		w = serve(`{"jsonrpc":"2.0","id":1,"method":"ren_queryTxs","params":{"offset":"1","limit":"2","latest":true}}`)
+		Expect(json.Unmarshal(w.Body.Bytes(), &streamed)).To(Succeed())
+		Expect(streamed.Result.HasMore).To(BeFalse())
+		Expect(streamed.Result.Total).To(Equal(3))
+		all := []tx.Tx{}
+		Expect(database.TxsAfter(db.TxCursor{}, 3, true, func(transaction tx.Tx, _ db.TxCursor) error {
+			all = append(all, transaction)
+			return nil
+		})).To(Succeed())
+		Expect(streamed.Result.Txs).To(HaveLen(2))
+		for i := range streamed.Result.Txs {
+			Expect(streamed.Result.Txs[i].Hash).To(Equal(all[i+1].Hash))
+		}
+	})
+
+	It("should encode the byte fields of txs as requested", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		sqlDB, err := sql.Open("sqlite3", "./resolver_test.db")
+		Expect(err).NotTo(HaveOccurred())
+		defer sqlDB.Close()
+		database := db.New(sqlDB, 10, 1)
+		transaction := txutil.RandomGoodTx(rand.New(rand.NewSource(GinkgoRandomSeed())))
+		Expect(database.InsertTx(transaction)).To(Succeed())
+
+		hashes := func(target string) []string {
+			req := httptest.NewRequest(http.MethodPost, target, nil)
+			resp := resolver.QueryTxs(ctx, nil, &jsonrpc.ParamsQueryTxs{}, req)
+			Expect(resp.Error).To(BeNil())
+			data, err := json.Marshal(resp.Result)
+			Expect(err).NotTo(HaveOccurred())
+			result := struct {
+				Txs []struct {
+					Hash string `json:"hash"`
+				} `json:"txs"`
+				Total int `json:"total"`
+			}{}
+			Expect(json.Unmarshal(data, &result)).To(Succeed())
+			Expect(result.Total).To(Equal(1))
+			hashes := make([]string, len(result.Txs))
+			for i, tx := range result.Txs {
+				hashes[i] = tx.Hash
+			}
+			return hashes
+		}
+
+		Expect(hashes("/")).To(Equal([]string{transaction.Hash.String()}))
+		Expect(hashes("/?encoding=hex")).To(Equal([]string{hex.EncodeToString(transaction.Hash[:])}))
+	})
+
+	It("should not return gateways of retired shards", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, _, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BCH/toEthereum")
+
+		input := engine.LockMintBurnReleaseInput{}
+		Expect(pack.Decode(&input, mocktx.Input)).To(Succeed())
+		script, err := engine.UTXOGatewayScript(mocktx.Selector.Asset().OriginChain(), mocktx.Selector.Asset(), input.Gpubkey, input.Ghash)
+		Expect(err).NotTo(HaveOccurred())
+		addr, err := btcutil.NewAddressScriptHash(script, watcher.NetParams(mocktx.Selector.Asset().OriginChain(), multichain.NetworkTestnet))
+		Expect(err).NotTo(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+		resp := resolver.SubmitGateway(innerCtx, nil, &ParamsSubmitGateway{Gateway: addr.EncodeAddress(), Tx: mocktx}, nil)
+		Expect(resp.Error).Should(BeZero())
+
+		// Retire the shard of the gateway.
+		sqlDB, err := sql.Open("sqlite3", "./resolver_test.db")
+		Expect(err).NotTo(HaveOccurred())
+		defer sqlDB.Close()
+		database := db.New(sqlDB, 10, 1)
+		Expect(database.RecordShardPubKeys([]pack.Bytes{input.Gpubkey})).To(Succeed())
+		Expect(database.InvalidateGateways(-time.Hour)).To(Equal(int64(1)))
+
+		resp = resolver.QueryGateway(innerCtx, nil, &ParamsQueryGateway{Gateway: addr.EncodeAddress()}, nil)
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Message).To(ContainSubstring("shard it was derived from has been retired"))
+	})
+
 	It("should submit gateway txs for zec", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -680,6 +1540,89 @@ var _ = Describe("Resolver", func() {
 		Expect(resp).ShouldNot(Equal(jsonrpc.Response{}))
 	})
 
+	It("should reject deposits of paused assets", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver, validator, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("DOGE/toEthereum")
+		paramsJSON, err := json.Marshal(jsonrpc.ParamsSubmitTx{Tx: mocktx})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		_, resp := validator.ValidateRequest(innerCtx, &http.Request{}, jsonrpc.Request{
+			Version: "2.0",
+			ID:      nil,
+			Method:  jsonrpc.MethodSubmitTx,
+			Params:  paramsJSON,
+		})
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Message).Should(Equal("DOGE is paused: upgrading gateway"))
+
+		// Burns of a paused asset are still accepted, so that users can get
+		// their funds back.
+		burn, err := tx.NewTx(tx.Selector("DOGE/fromEthereum"), mocktx.Input)
+		Expect(err).ShouldNot(HaveOccurred())
+		paramsJSON, err = json.Marshal(jsonrpc.ParamsSubmitTx{Tx: burn})
+		Expect(err).ShouldNot(HaveOccurred())
+		_, resp = validator.ValidateRequest(innerCtx, &http.Request{RemoteAddr: "127.0.0.2"}, jsonrpc.Request{
+			Version: "2.0",
+			ID:      nil,
+			Method:  jsonrpc.MethodSubmitTx,
+			Params:  paramsJSON,
+		})
+		Expect(resp).Should(Equal(jsonrpc.Response{}))
+
+		resp = resolver.Fallback(innerCtx, nil, MethodQueryAssets, json.RawMessage("{}"), nil)
+		Expect(resp.Error).Should(BeNil())
+		Expect(resp.Result).Should(Equal(ResponseQueryAssets{
+			Assets: []pause.Status{
+				{Asset: multichain.BTC},
+				{Asset: multichain.DOGE, Paused: true, Reason: "upgrading gateway"},
+			},
+		}))
+	})
+
+	It("should reject submissions with oversized payloads", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, validator, _ := init(ctx)
+		defer cleanup()
+
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+
+		mocktx := txutil.RandomGoodTx(r)
+		mocktx.Selector = tx.Selector("BTC/toEthereum")
+		input := engine.LockMintBurnReleaseInput{}
+		Expect(pack.Decode(&input, mocktx.Input)).To(Succeed())
+		input.Payload = make(pack.Bytes, MaxSubmissionPayloadSize+1)
+		encoded, err := pack.Encode(input)
+		Expect(err).NotTo(HaveOccurred())
+		mocktx.Input = pack.Typed(encoded.(pack.Struct))
+		paramsJSON, err := json.Marshal(jsonrpc.ParamsSubmitTx{Tx: mocktx})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		innerCtx, innerCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer innerCancel()
+
+		_, resp := validator.ValidateRequest(innerCtx, &http.Request{}, jsonrpc.Request{
+			Version: "2.0",
+			ID:      nil,
+			Method:  jsonrpc.MethodSubmitTx,
+			Params:  paramsJSON,
+		})
+		Expect(resp.Error).ShouldNot(BeNil())
+		Expect(resp.Error.Message).Should(ContainSubstring("payload must be at most"))
+	})
+
 	It("should rate limit", func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -0,0 +1,443 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+// A schema checks the shape of a JSON value before it is unmarshalled, so that
+// invalid params can be reported with the path of the offending field rather
+// than a generic unmarshalling error.
+type schema interface {
+	validate(path string, value json.RawMessage) error
+
+	// describe returns the schema as a JSON Schema, so that it can be
+	// published to clients.
+	describe() map[string]interface{}
+}
+
+// paramSchemas maps each method of the Darknodes to the schema of its params.
+// Methods without params accept an empty or missing params object. The
+// schemas of custom methods are registered with the methods themselves.
+var paramSchemas = map[string]schema{
+	jsonrpc.MethodSubmitTx: object(
+		required("tx", txSchema{}),
+	),
+	jsonrpc.MethodQueryTx: object(
+		required("txHash", bytesSchema{length: 32, encoding: base64Any}),
+	),
+	jsonrpc.MethodQueryTxs: object(
+		optional("offset", uintSchema{}),
+		optional("limit", uintSchema{}),
+	),
+	jsonrpc.MethodQueryBlock:      object(),
+	jsonrpc.MethodQueryBlocks:     object(),
+	jsonrpc.MethodQueryPeers:      object(),
+	jsonrpc.MethodQueryNumPeers:   object(),
+	jsonrpc.MethodQueryShards:     object(),
+	jsonrpc.MethodQueryStat:       object(),
+	jsonrpc.MethodQueryFees:       object(),
+	jsonrpc.MethodQueryConfig:     object(),
+	jsonrpc.MethodQueryState:      object(),
+	jsonrpc.MethodQueryBlockState: object(),
+}
+
+// ValidateParams checks the params of a request against the schema of its
+// method. It returns an error describing the first invalid field, or nil if
+// the params are valid or the method is unknown.
+func ValidateParams(method string, params json.RawMessage) error {
+	s, ok := paramSchema(method)
+	if !ok {
+		return nil
+	}
+	if isNull(params) {
+		params = json.RawMessage("{}")
+	}
+	return s.validate("params", params)
+}
+
+// paramSchema returns the schema of the params of a Darknode or custom method.
+func paramSchema(method string) (schema, bool) {
+	if s, ok := paramSchemas[method]; ok {
+		return s, true
+	}
+	if m, ok := customMethods[method]; ok {
+		return m.schema, true
+	}
+	return nil, false
+}
+
+// Enumerate the byte encodings accepted in params. Darknode types use
+// base64url, whereas v0 types use standard base64.
+const (
+	base64Std = "base64"
+	base64URL = "base64url"
+	base64Any = "base64 or base64url"
+)
+
+var byteEncodings = map[string][]*base64.Encoding{
+	base64Std: {base64.StdEncoding},
+	base64URL: {base64.RawURLEncoding, base64.URLEncoding},
+	base64Any: {base64.RawURLEncoding, base64.URLEncoding, base64.StdEncoding},
+}
+
+// v1TxSchema describes a tx as defined by the darknode.
+var v1TxSchema = object(
+	optional("hash", bytesSchema{length: 32, encoding: base64URL}),
+	optional("version", stringSchema{}),
+	required("selector", stringSchema{}),
+	required("in", typedSchema{}),
+)
+
+// v0TxSchema describes a tx as submitted by legacy clients.
+var v0TxSchema = object(
+	optional("hash", bytesSchema{encoding: base64Std}),
+	required("to", stringSchema{}),
+	required("in", arraySchema{items: v0ArgSchema{}}),
+)
+
+// txSchema accepts both v0 and v1 txs, telling them apart by the shape of
+// their inputs.
+type txSchema struct{}
+
+func (txSchema) validate(path string, value json.RawMessage) error {
+	var tx map[string]json.RawMessage
+	if err := json.Unmarshal(value, &tx); err != nil {
+		return fmt.Errorf("%v must be an object", path)
+	}
+	if in, ok := lookup(tx, "in"); ok && bytes.HasPrefix(bytes.TrimSpace(in), []byte("[")) {
+		return v0TxSchema.validate(path, value)
+	}
+	return v1TxSchema.validate(path, value)
+}
+
+func (txSchema) describe() map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{v1TxSchema.describe(), v0TxSchema.describe()},
+	}
+}
+
+type field struct {
+	name     string
+	required bool
+	schema   schema
+}
+
+func required(name string, s schema) field {
+	return field{name: name, required: true, schema: s}
+}
+
+func optional(name string, s schema) field {
+	return field{name: name, schema: s}
+}
+
+type objectSchema []field
+
+func object(fields ...field) objectSchema {
+	return objectSchema(fields)
+}
+
+func (fields objectSchema) validate(path string, value json.RawMessage) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(value, &obj); err != nil || obj == nil {
+		return fmt.Errorf("%v must be an object", path)
+	}
+	for _, f := range fields {
+		fieldPath := path + "." + f.name
+		fieldValue, ok := lookup(obj, f.name)
+		if !ok || isNull(fieldValue) {
+			if f.required {
+				return fmt.Errorf("%v is required", fieldPath)
+			}
+			continue
+		}
+		if err := f.schema.validate(fieldPath, fieldValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fields objectSchema) describe() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, f := range fields {
+		properties[f.name] = f.schema.describe()
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+type arraySchema struct {
+	items schema
+}
+
+func (s arraySchema) validate(path string, value json.RawMessage) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(value, &items); err != nil {
+		return fmt.Errorf("%v must be an array", path)
+	}
+	for i, item := range items {
+		if err := s.items.validate(fmt.Sprintf("%v[%d]", path, i), item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s arraySchema) describe() map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": s.items.describe()}
+}
+
+type stringSchema struct{}
+
+func (stringSchema) validate(path string, value json.RawMessage) error {
+	var str string
+	if err := json.Unmarshal(value, &str); err != nil {
+		return fmt.Errorf("%v must be a string", path)
+	}
+	return nil
+}
+
+func (stringSchema) describe() map[string]interface{} {
+	return map[string]interface{}{"type": "string"}
+}
+
+// uintSchema accepts unsigned integers encoded either as JSON numbers or as
+// decimal strings.
+type uintSchema struct{}
+
+func (uintSchema) validate(path string, value json.RawMessage) error {
+	str := strings.Trim(string(bytes.TrimSpace(value)), "\"")
+	for _, c := range str {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("%v must be an unsigned integer", path)
+		}
+	}
+	if str == "" {
+		return fmt.Errorf("%v must be an unsigned integer", path)
+	}
+	return nil
+}
+
+func (uintSchema) describe() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    []string{"integer", "string"},
+		"minimum": 0,
+		"pattern": "^[0-9]+$",
+	}
+}
+
+type boolSchema struct{}
+
+func (boolSchema) validate(path string, value json.RawMessage) error {
+	var b bool
+	if err := json.Unmarshal(value, &b); err != nil {
+		return fmt.Errorf("%v must be a boolean", path)
+	}
+	return nil
+}
+
+func (boolSchema) describe() map[string]interface{} {
+	return map[string]interface{}{"type": "boolean"}
+}
+
+// bytesSchema accepts strings which decode using the given encoding. A
+// non-zero length requires the decoded bytes to be exactly that long.
+type bytesSchema struct {
+	length   int
+	encoding string
+}
+
+func (s bytesSchema) validate(path string, value json.RawMessage) error {
+	var str string
+	if err := json.Unmarshal(value, &str); err != nil {
+		return fmt.Errorf("%v must be a %v string", path, s.encoding)
+	}
+	for _, encoding := range byteEncodings[s.encoding] {
+		decoded, err := encoding.DecodeString(str)
+		if err != nil {
+			continue
+		}
+		if s.length != 0 && len(decoded) != s.length {
+			return fmt.Errorf("%v must be %v bytes, got %v", path, s.length, len(decoded))
+		}
+		return nil
+	}
+	return fmt.Errorf("%v must be %v", path, s.encoding)
+}
+
+func (s bytesSchema) describe() map[string]interface{} {
+	description := map[string]interface{}{
+		"type":            "string",
+		"contentEncoding": s.encoding,
+	}
+	if s.length != 0 {
+		description["description"] = fmt.Sprintf("%v bytes", s.length)
+	}
+	return description
+}
+
+// typedSchema checks a pack.Typed value, validating each field of the value
+// against the type declared for it.
+type typedSchema struct{}
+
+func (typedSchema) validate(path string, value json.RawMessage) error {
+	var typed struct {
+		T json.RawMessage `json:"t"`
+		V json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal(value, &typed); err != nil {
+		return fmt.Errorf("%v must be an object", path)
+	}
+	if isNull(typed.T) {
+		return fmt.Errorf("%v.t is required", path)
+	}
+	if isNull(typed.V) {
+		return fmt.Errorf("%v.v is required", path)
+	}
+
+	// Only struct types are checked field by field, anything else is left to
+	// the darknode to validate.
+	var t struct {
+		Struct []map[string]json.RawMessage `json:"struct"`
+	}
+	if err := json.Unmarshal(typed.T, &t); err != nil || len(t.Struct) == 0 {
+		return nil
+	}
+	var v map[string]json.RawMessage
+	if err := json.Unmarshal(typed.V, &v); err != nil {
+		return fmt.Errorf("%v.v must be an object", path)
+	}
+	for _, fieldType := range t.Struct {
+		for name, rawType := range fieldType {
+			fieldPath := path + ".v." + name
+			fieldValue, ok := v[name]
+			if !ok {
+				return fmt.Errorf("%v is required", fieldPath)
+			}
+			var typeName string
+			if err := json.Unmarshal(rawType, &typeName); err != nil {
+				continue
+			}
+			if s := packTypeSchema(typeName); s != nil {
+				if err := s.validate(fieldPath, fieldValue); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (typedSchema) describe() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "object",
+		"description": "a pack value, with its type in t and its value in v",
+		"properties": map[string]interface{}{
+			"t": map[string]interface{}{},
+			"v": map[string]interface{}{},
+		},
+		"required": []string{"t", "v"},
+	}
+}
+
+// packTypeSchema returns the schema for values of the named pack type, or nil
+// if the type is not checked.
+func packTypeSchema(typeName string) schema {
+	switch typeName {
+	case "bool":
+		return boolSchema{}
+	case "string":
+		return stringSchema{}
+	case "u8", "u16", "u32", "u64", "u128", "u256":
+		return uintSchema{}
+	case "bytes":
+		return bytesSchema{encoding: base64URL}
+	case "bytes32":
+		return bytesSchema{length: 32, encoding: base64URL}
+	case "bytes65":
+		return bytesSchema{length: 65, encoding: base64URL}
+	}
+	return nil
+}
+
+// v0ArgSchema checks a single argument of a v0 tx.
+type v0ArgSchema struct{}
+
+func (v0ArgSchema) validate(path string, value json.RawMessage) error {
+	if err := object(
+		required("name", stringSchema{}),
+		required("type", stringSchema{}),
+	).validate(path, value); err != nil {
+		return err
+	}
+
+	var arg struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(value, &arg); err != nil {
+		return fmt.Errorf("%v must be an object", path)
+	}
+	if isNull(arg.Value) {
+		return fmt.Errorf("%v.value is required", path)
+	}
+
+	// Fixed length v0 types are zero padded when decoded, so only their
+	// encoding is checked.
+	var s schema
+	switch arg.Type {
+	case "b", "b20", "b32":
+		s = bytesSchema{encoding: base64Std}
+	case "str":
+		s = stringSchema{}
+	case "u8", "u16", "u32", "u64", "u128", "u256":
+		s = uintSchema{}
+	default:
+		return nil
+	}
+	return s.validate(path+".value", arg.Value)
+}
+
+func (v0ArgSchema) describe() map[string]interface{} {
+	description := object(
+		required("name", stringSchema{}),
+		required("type", stringSchema{}),
+	).describe()
+	description["properties"].(map[string]interface{})["value"] = map[string]interface{}{
+		"description": "a base64 string for types b, b20 and b32, a decimal string or integer for unsigned integer types, and a string for type str",
+	}
+	description["required"] = []string{"name", "type", "value"}
+	return description
+}
+
+// lookup finds the field with the given name, ignoring case in the same way
+// that encoding/json does when unmarshalling.
+func lookup(obj map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if value, ok := obj[name]; ok {
+		return value, true
+	}
+	for key, value := range obj {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func isNull(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
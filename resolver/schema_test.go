@@ -0,0 +1,68 @@
+package resolver_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/testutils"
+)
+
+var _ = Describe("Params validation", func() {
+	mustMarshal := func(v interface{}) json.RawMessage {
+		raw, err := json.Marshal(v)
+		Expect(err).NotTo(HaveOccurred())
+		return raw
+	}
+
+	It("should accept valid params", func() {
+		Expect(ValidateParams(jsonrpc.MethodSubmitTx, mustMarshal(testutils.MockParamSubmitTxV0BTC()))).To(Succeed())
+		Expect(ValidateParams(jsonrpc.MethodSubmitTx, mustMarshal(testutils.MockBurnParamSubmitTxV0BTC()))).To(Succeed())
+		Expect(ValidateParams(MethodSubmitGateway, mustMarshal(testutils.MockParamsSubmitGatewayFil()))).To(Succeed())
+		Expect(ValidateParams(jsonrpc.MethodQueryConfig, nil)).To(Succeed())
+		Expect(ValidateParams("unknown", json.RawMessage(`"anything"`))).To(Succeed())
+	})
+
+	It("should report the path of the invalid field", func() {
+		cases := map[string]struct {
+			method string
+			params string
+		}{
+			"params.tx is required": {
+				jsonrpc.MethodSubmitTx, `{}`,
+			},
+			"params.tx.selector must be a string": {
+				jsonrpc.MethodSubmitTx, `{"tx":{"selector":1,"in":{"t":{},"v":{}}}}`,
+			},
+			"params.tx.in[1].value must be base64": {
+				jsonrpc.MethodSubmitTx, `{"tx":{"to":"BTC0Btc2Eth","in":[{"name":"ref","type":"u64","value":"1"},{"name":"n","type":"b32","value":"not base64!"}]}}`,
+			},
+			"params.tx.in.v.nhash must be 32 bytes, got 3": {
+				MethodSubmitGateway, `{"gateway":"addr","tx":{"selector":"BTC/toEthereum","in":{"t":{"struct":[{"nhash":"bytes32"}]},"v":{"nhash":"AAAA"}}}}`,
+			},
+			"params.tx.in.v.amount must be an unsigned integer": {
+				jsonrpc.MethodSubmitTx, `{"tx":{"selector":"BTC/toEthereum","in":{"t":{"struct":[{"amount":"u256"}]},"v":{"amount":"-1"}}}}`,
+			},
+			"params.txHash must be base64 or base64url": {
+				jsonrpc.MethodQueryTx, `{"txHash":"???"}`,
+			},
+			"params.txid must be base64url": {
+				MethodQueryTxsByTxid, `{"txid":"a+b/"}`,
+			},
+			"params.status must be a string": {
+				MethodQueryTxsByTxid, `{"txid":"AAAA","status":1}`,
+			},
+			"params must be an object": {
+				MethodQueryGateway, `[]`,
+			},
+		}
+		for message, c := range cases {
+			err := ValidateParams(c.method, json.RawMessage(c.params))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(message))
+		}
+	})
+})
@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/lightnode/logging"
+	"golang.org/x/time/rate"
+)
+
+// Enumerate default options of the shared rate limits.
+const (
+	DefaultDegradedRateFactor = 0.25
+	DefaultSharedRetryAfter   = 10 * time.Second
+)
+
+// SharedLimits count requests across Lightnode replicas, so that the rate
+// limits apply to all replicas together rather than to each replica.
+type SharedLimits interface {
+	// Incr increments the number of requests counted for the key in the
+	// current window of the given length, and returns the new count.
+	Incr(key string, window time.Duration) (int64, error)
+}
+
+// RedisLimits are SharedLimits backed by Redis. Requests are counted in fixed
+// windows, whose keys expire once the window has passed.
+type RedisLimits struct {
+	client redis.Cmdable
+}
+
+// NewRedisLimits returns new RedisLimits.
+func NewRedisLimits(client redis.Cmdable) RedisLimits {
+	return RedisLimits{client: client}
+}
+
+// Incr implements the SharedLimits interface.
+func (limits RedisLimits) Incr(key string, window time.Duration) (int64, error) {
+	key = fmt.Sprintf("limiter_%v_%v", key, time.Now().UnixNano()/int64(window))
+	pipe := limits.client.Pipeline()
+	incr := pipe.Incr(key)
+	pipe.Expire(key, window)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// SharedLimiterOptions configure how a LightnodeRateLimiter uses shared limits.
+type SharedLimiterOptions struct {
+	// DegradedFactor scales the rates of the local limits, which are used
+	// while the shared limits are unavailable. Each replica only sees its
+	// share of the traffic, so the local limits should be lower than the
+	// shared ones.
+	DegradedFactor float64
+	// RetryAfter is how long the local limits are used for after the shared
+	// limits fail, before the shared limits are tried again. This stops every
+	// request from waiting on Redis while it is down.
+	RetryAfter time.Duration
+	Logger     logging.Logger
+}
+
+// DefaultSharedLimiterOptions returns the recommended options with the given
+// logger.
+func DefaultSharedLimiterOptions(logger logging.Logger) SharedLimiterOptions {
+	return SharedLimiterOptions{
+		DegradedFactor: DefaultDegradedRateFactor,
+		RetryAfter:     DefaultSharedRetryAfter,
+		Logger:         logger,
+	}
+}
+
+// sharedWindow returns the window in which at most limit requests are allowed
+// at the given rate. Rates of at least one request per second are counted in
+// windows of a second, as the local limits allow bursts of a second of
+// requests. Slower rates allow a single request per window.
+func sharedWindow(r rate.Limit) (time.Duration, int64) {
+	if r >= 1 {
+		return time.Second, int64(r)
+	}
+	return time.Duration(float64(time.Second) / float64(r)), 1
+}
+
+// allowShared checks the global and then the IP limit of the request against
+// the shared limits. As with the local limits, the request counts towards the
+// global limit even if the IP limit rejects it.
+func allowShared(shared SharedLimits, globalMethod string, globalRate rate.Limit, ipMethod string, ipRate rate.Limit, ip string) (bool, error) {
+	limits := []struct {
+		key  string
+		rate rate.Limit
+	}{
+		{"global_" + globalMethod, globalRate},
+		{"ip_" + ipMethod + "_" + ip, ipRate},
+	}
+	for _, limit := range limits {
+		if limit.rate == rate.Inf || float64(limit.rate) >= math.MaxInt64 {
+			continue
+		}
+		if limit.rate <= 0 {
+			return false, nil
+		}
+		window, max := sharedWindow(limit.rate)
+		count, err := shared.Incr(limit.key, window)
+		if err != nil {
+			return false, err
+		}
+		if count > max {
+			return false, nil
+		}
+	}
+	return true, nil
+}
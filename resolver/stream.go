@@ -0,0 +1,210 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/db"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/version"
+)
+
+// DefaultStreamThreshold is the limit of ren_queryTxs requests from which
+// their responses are streamed.
+const DefaultStreamThreshold = 100
+
+// maxStreamRequestSize is the size of the request bodies which are checked
+// for ren_queryTxs requests. Larger requests are never ren_queryTxs requests,
+// and are passed on without being read.
+const maxStreamRequestSize = 4 * 1024
+
+// streamFlushInterval is the number of txs written between flushes of a
+// streamed response.
+const streamFlushInterval = 64
+
+// TxStreamHandler streams the responses of ren_queryTxs requests with large
+// limits, writing each tx as it is read from the database rather than
+// buffering the whole page, so that explorers fetching thousands of txs do
+// not hold them all in memory. Requests are validated, and so rate limited,
+// as they are by the JSON-RPC server. Responses are encoded as they are by
+// the JSON-RPC server, and are logged and recorded in the metrics by the
+// LoggingResolver. All other requests are passed to the next handler.
+type TxStreamHandler struct {
+	resolver        *Resolver
+	loggingResolver *LoggingResolver
+	validator       jsonrpc.Validator
+	threshold       int
+	next            http.Handler
+}
+
+// NewTxStreamHandler returns a TxStreamHandler which streams ren_queryTxs
+// responses for limits of at least the threshold. A threshold of zero streams
+// nothing.
+func NewTxStreamHandler(resolver *Resolver, loggingResolver *LoggingResolver, validator jsonrpc.Validator, threshold int, next http.Handler) TxStreamHandler {
+	return TxStreamHandler{
+		resolver:        resolver,
+		loggingResolver: loggingResolver,
+		validator:       validator,
+		threshold:       threshold,
+		next:            next,
+	}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler TxStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler.threshold <= 0 || r.Method != http.MethodPost {
+		handler.next.ServeHTTP(w, r)
+		return
+	}
+
+	// Only read the start of the body, and put it back for the next handler.
+	peek, err := ioutil.ReadAll(io.LimitReader(r.Body, maxStreamRequestSize+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(peek), r.Body), r.Body}
+	if err != nil || len(peek) > maxStreamRequestSize {
+		handler.next.ServeHTTP(w, r)
+		return
+	}
+	req := jsonrpc.Request{}
+	if err := json.Unmarshal(peek, &req); err != nil || req.Method != jsonrpc.MethodQueryTxs {
+		handler.next.ServeHTTP(w, r)
+		return
+	}
+	rawParams := jsonrpc.ParamsQueryTxs{}
+	if err := json.Unmarshal(req.Params, &rawParams); err != nil || rawParams.Limit == nil || int(*rawParams.Limit) < handler.threshold {
+		handler.next.ServeHTTP(w, r)
+		return
+	}
+
+	encoding := r.URL.Query().Get(lhttp.EncodingParam)
+	if err := lhttp.ValidateEncoding(encoding); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(lhttp.VersionHeader, version.Version)
+	start := time.Now()
+	validated, response := handler.validator.ValidateRequest(r.Context(), r, req)
+	if response.Error != nil {
+		handler.writeResponse(w, response)
+		handler.loggingResolver.track(start, req.ID, jsonrpc.MethodQueryTxs, r, &response)()
+		return
+	}
+	params, ok := validated.(*jsonrpc.ParamsQueryTxs)
+	if !ok {
+		handler.next.ServeHTTP(w, r)
+		return
+	}
+	response = handler.stream(w, r, req.ID, params, encoding)
+	handler.loggingResolver.track(start, req.ID, jsonrpc.MethodQueryTxs, r, &response)()
+}
+
+// stream writes the response to the ren_queryTxs request, and returns it
+// without its result. Its fields are written in the order of
+// ResponseQueryTxs, which puts the txs last, so the size of the page is
+// counted before the txs are read.
+func (handler TxStreamHandler) stream(w http.ResponseWriter, r *http.Request, id interface{}, params *jsonrpc.ParamsQueryTxs, encoding string) jsonrpc.Response {
+	logger := handler.resolver.requestLogger(id, jsonrpc.MethodQueryTxs, r)
+
+	offset, limit, latest := 0, int(*params.Limit), false
+	if params.Offset != nil {
+		offset = int(*params.Offset)
+	}
+	if params.Latest != nil {
+		latest = bool(*params.Latest)
+	}
+	size, err := handler.resolver.db.TxPageSize(offset, limit+1)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot count txs in page")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch txs: %v", err), nil)
+		response := jsonrpc.NewResponse(id, nil, &jsonErr)
+		handler.writeResponse(w, response)
+		return response
+	}
+	total, approximate, err := handler.resolver.db.TxCount()
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot count txs in db")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to count txs: %v", err), nil)
+		response := jsonrpc.NewResponse(id, nil, &jsonErr)
+		handler.writeResponse(w, response)
+		return response
+	}
+	// As in QueryTxs, the page bounds the total.
+	hasMore := size > limit
+	if hasMore {
+		size = limit
+	}
+	seen := offset + size
+	if !hasMore && size > 0 {
+		total, approximate = seen, false
+	} else if hasMore && total <= seen {
+		total = seen + 1
+	}
+
+	rawID, err := json.Marshal(id)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidRequest, "invalid id", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":{"total":%v,"approximate":%v,"hasMore":%v,"txs":[`, rawID, total, approximate, hasMore)
+
+	// Txs are read by cursor from the first tx, and those before the offset
+	// are skipped as they are read.
+	flusher, _ := w.(http.Flusher)
+	skipped, written := 0, 0
+	err = handler.resolver.db.TxsAfter(db.TxCursor{}, offset+size, latest, func(transaction tx.Tx, _ db.TxCursor) error {
+		if skipped < offset {
+			skipped++
+			return r.Context().Err()
+		}
+		data, err := json.Marshal(lhttp.EncodeTx(transaction, encoding))
+		if err != nil {
+			return err
+		}
+		if written > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%streamFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return r.Context().Err()
+	})
+	if err != nil {
+		// The status has already been written, so the response is left
+		// incomplete, which clients fail to decode.
+		logger.WithError(err).Error("[resolver] cannot stream txs")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, fmt.Sprintf("failed to fetch txs: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	w.Write([]byte("]}}"))
+	return jsonrpc.NewResponse(id, nil, nil)
+}
+
+// writeResponse writes a response which is not streamed, encoded as by the
+// JSON-RPC server.
+func (handler TxStreamHandler) writeResponse(w http.ResponseWriter, response jsonrpc.Response) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// readCloser reads from the reader, and closes the closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,287 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/pack"
+)
+
+// Methods for submitting mints whose payloads are too large to fit in a single
+// request. A submission is started with the tx without its payload, the
+// payload is appended in chunks, and the submission is then finalized, at
+// which point the assembled payload is checked against the phash of the tx
+// before the tx is submitted.
+const (
+	MethodBeginSubmit    = "ren_beginSubmit"
+	MethodAppendPayload  = "ren_appendPayload"
+	MethodFinalizeSubmit = "ren_finalizeSubmit"
+)
+
+// Limits of chunked submissions. Submissions which are not finalized before
+// they expire are discarded along with their chunks. The payload size limit is
+// also enforced by the validator on every submitted tx.
+const (
+	MaxSubmissionPayloadSize = 1 << 20
+	MaxSubmissionChunkSize   = 256 * 1024
+	SubmissionExpiry         = time.Hour
+)
+
+// ParamsBeginSubmit starts a chunked submission. The payload of the tx must be
+// empty, while its phash and hash must be those of the tx with the full
+// payload.
+type ParamsBeginSubmit struct {
+	Tx          tx.Tx    `json:"tx"`
+	PayloadSize pack.U64 `json:"payloadSize"`
+}
+
+type ResponseBeginSubmit struct {
+	SubmissionID string   `json:"submissionId"`
+	MaxChunkSize pack.U64 `json:"maxChunkSize"`
+	ExpiresAt    int64    `json:"expiresAt"`
+}
+
+// ParamsAppendPayload appends a chunk of the payload at the given offset,
+// which must be the number of bytes received so far. Chunks before that offset
+// are ignored, so that a chunk can be resent if its response was lost. A
+// submission can be resumed by appending an empty chunk to learn how many
+// bytes have been received.
+type ParamsAppendPayload struct {
+	SubmissionID string     `json:"submissionId"`
+	Offset       pack.U64   `json:"offset"`
+	Data         pack.Bytes `json:"data"`
+}
+
+type ResponseAppendPayload struct {
+	Received pack.U64 `json:"received"`
+}
+
+// ParamsFinalizeSubmit submits the tx of a chunked submission once its whole
+// payload has been received.
+type ParamsFinalizeSubmit struct {
+	SubmissionID string `json:"submissionId"`
+}
+
+func (resolver *Resolver) BeginSubmit(ctx context.Context, id interface{}, params *ParamsBeginSubmit, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodBeginSubmit, req).WithFields(logging.Fields{
+		"txHash":      params.Tx.Hash.String(),
+		"selector":    params.Tx.Selector.String(),
+		"payloadSize": params.PayloadSize,
+	})
+
+	if !params.Tx.Selector.IsCrossChain() || params.Tx.Selector.IsBurn() {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, "only mints can be submitted in chunks", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if params.PayloadSize == 0 || params.PayloadSize > MaxSubmissionPayloadSize {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("payload size must be between 1 and %v bytes", MaxSubmissionPayloadSize), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	var input engine.LockMintBurnReleaseInput
+	if err := pack.Decode(&input, params.Tx.Input); err != nil {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("invalid tx input: %v", err), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if len(input.Payload) != 0 {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, "payload must be appended rather than included in the tx", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if err := resolver.db.PruneSubmissions(SubmissionExpiry); err != nil {
+		logger.WithError(err).Warn("[resolver] cannot prune expired submissions")
+	}
+
+	submissionID, err := newSubmissionID()
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot generate submission id")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to begin submission", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if err := resolver.db.InsertSubmission(db.Submission{
+		ID:          submissionID,
+		Tx:          params.Tx,
+		PayloadSize: uint64(params.PayloadSize),
+	}); err != nil {
+		logger.WithError(err).Error("[resolver] cannot insert submission")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to begin submission", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	return jsonrpc.NewResponse(id, ResponseBeginSubmit{
+		SubmissionID: submissionID,
+		MaxChunkSize: MaxSubmissionChunkSize,
+		ExpiresAt:    time.Now().Add(SubmissionExpiry).Unix(),
+	}, nil)
+}
+
+func (resolver *Resolver) AppendPayload(ctx context.Context, id interface{}, params *ParamsAppendPayload, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodAppendPayload, req).WithField("submissionId", params.SubmissionID)
+
+	if len(params.Data) > MaxSubmissionChunkSize {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("chunks must be at most %v bytes", MaxSubmissionChunkSize), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	submission, response, ok := resolver.submission(id, params.SubmissionID, logger)
+	if !ok {
+		return response
+	}
+
+	offset := uint64(params.Offset)
+	switch {
+	case offset > submission.Received:
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("expected offset %v, got %v", submission.Received, offset), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	case offset < submission.Received || len(params.Data) == 0:
+		// The chunk has already been received.
+		return jsonrpc.NewResponse(id, ResponseAppendPayload{Received: pack.U64(submission.Received)}, nil)
+	case submission.Received+uint64(len(params.Data)) > submission.PayloadSize:
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("payload exceeds declared size of %v bytes", submission.PayloadSize), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	if err := resolver.db.InsertSubmissionChunk(submission.ID, offset, params.Data); err != nil {
+		logger.WithError(err).Error("[resolver] cannot insert submission chunk")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to append payload", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	// Read the number of bytes received again, as a concurrent request may
+	// have appended a different chunk at the same offset.
+	submission, response, ok = resolver.submission(id, params.SubmissionID, logger)
+	if !ok {
+		return response
+	}
+	return jsonrpc.NewResponse(id, ResponseAppendPayload{Received: pack.U64(submission.Received)}, nil)
+}
+
+func (resolver *Resolver) FinalizeSubmit(ctx context.Context, id interface{}, params *ParamsFinalizeSubmit, req *http.Request) jsonrpc.Response {
+	logger := resolver.requestLogger(id, MethodFinalizeSubmit, req).WithField("submissionId", params.SubmissionID)
+
+	submission, response, ok := resolver.submission(id, params.SubmissionID, logger)
+	if !ok {
+		return response
+	}
+	if submission.Received != submission.PayloadSize {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("received %v of %v payload bytes", submission.Received, submission.PayloadSize), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	payload, err := resolver.db.SubmissionPayload(submission.ID)
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot read submission payload")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to finalize submission", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	transaction, err := withPayload(submission.Tx, payload)
+	if err != nil {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, err.Error(), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	// The assembled tx goes through the validator as if it had been submitted
+	// in a single request, so that it is rate limited, checked against the
+	// payload size limit and paused assets, and has its gpubkey removed.
+	submitParams, response, ok := resolver.validateSubmitTx(ctx, id, transaction, req, logger)
+	if !ok {
+		return response
+	}
+	response = resolver.SubmitTx(ctx, id, submitParams, req)
+	if response.Error == nil {
+		if err := resolver.db.DeleteSubmission(submission.ID); err != nil {
+			logger.WithError(err).Warn("[resolver] cannot delete finalized submission")
+		}
+	}
+	return response
+}
+
+// submission returns the submission with the given id, or an error response
+// if it does not exist or has expired.
+func (resolver *Resolver) submission(id interface{}, submissionID string, logger logging.Logger) (db.Submission, jsonrpc.Response, bool) {
+	submission, err := resolver.db.Submission(submissionID, SubmissionExpiry)
+	if err == sql.ErrNoRows {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("unknown or expired submission %v", submissionID), nil)
+		return db.Submission{}, jsonrpc.NewResponse(id, nil, &jsonErr), false
+	}
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot get submission")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to get submission", nil)
+		return db.Submission{}, jsonrpc.NewResponse(id, nil, &jsonErr), false
+	}
+	return submission, jsonrpc.Response{}, true
+}
+
+// validateSubmitTx runs the tx through the validator as a submitTx request,
+// and returns the validated params, or an error response if it is rejected.
+func (resolver *Resolver) validateSubmitTx(ctx context.Context, id interface{}, transaction tx.Tx, req *http.Request, logger logging.Logger) (*jsonrpc.ParamsSubmitTx, jsonrpc.Response, bool) {
+	if resolver.validator == nil {
+		logger.Error("[resolver] no validator for chunked submissions")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to finalize submission", nil)
+		return nil, jsonrpc.NewResponse(id, nil, &jsonErr), false
+	}
+	raw, err := json.Marshal(jsonrpc.ParamsSubmitTx{Tx: transaction})
+	if err != nil {
+		logger.WithError(err).Error("[resolver] cannot encode submission")
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to finalize submission", nil)
+		return nil, jsonrpc.NewResponse(id, nil, &jsonErr), false
+	}
+	validated, response := resolver.validator.ValidateRequest(ctx, req, jsonrpc.Request{
+		Version: "2.0",
+		ID:      id,
+		Method:  jsonrpc.MethodSubmitTx,
+		Params:  raw,
+	})
+	if response.Error != nil {
+		return nil, response, false
+	}
+	params, ok := validated.(*jsonrpc.ParamsSubmitTx)
+	if !ok {
+		logger.Errorf("[resolver] unexpected submission params %T", validated)
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "failed to finalize submission", nil)
+		return nil, jsonrpc.NewResponse(id, nil, &jsonErr), false
+	}
+	return params, jsonrpc.Response{}, true
+}
+
+// withPayload returns the tx with the given payload, after checking that the
+// payload matches the phash of the tx, and that the hash of the resulting tx
+// matches the hash given when the submission began.
+func withPayload(transaction tx.Tx, payload []byte) (tx.Tx, error) {
+	var input engine.LockMintBurnReleaseInput
+	if err := pack.Decode(&input, transaction.Input); err != nil {
+		return tx.Tx{}, fmt.Errorf("invalid tx input: %v", err)
+	}
+	if engine.Phash(payload) != input.Phash {
+		return tx.Tx{}, fmt.Errorf("payload does not match phash %v", input.Phash)
+	}
+	input.Payload = payload
+	encoded, err := pack.Encode(input)
+	if err != nil {
+		return tx.Tx{}, fmt.Errorf("encoding tx input: %v", err)
+	}
+	newTx, err := tx.NewTx(transaction.Selector, pack.Typed(encoded.(pack.Struct)))
+	if err != nil {
+		return tx.Tx{}, fmt.Errorf("building tx: %v", err)
+	}
+	if newTx.Hash != transaction.Hash {
+		return tx.Tx{}, fmt.Errorf("tx hash %v does not match expected hash %v", newTx.Hash, transaction.Hash)
+	}
+	return newTx, nil
+}
+
+func newSubmissionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
@@ -0,0 +1,465 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/phi"
+)
+
+// Methods which clients can send over a subscription connection.
+const (
+	SubscribeMethod         = "subscribe"
+	UnsubscribeMethod       = "unsubscribe"
+	SubscribeEpochsMethod   = "subscribeEpochs"
+	UnsubscribeEpochsMethod = "unsubscribeEpochs"
+)
+
+const (
+	// DefaultSubscriptionPollRate is how often the status of subscribed txs
+	// is queried.
+	DefaultSubscriptionPollRate = 5 * time.Second
+
+	// MaxSubscriptionsPerConn limits the number of txs a single connection
+	// can subscribe to.
+	MaxSubscriptionsPerConn = 20
+
+	// DefaultMaxSubscriptionConns and DefaultMaxSubscriptionConnsPerIP limit
+	// the number of open connections, in total and from each client.
+	DefaultMaxSubscriptionConns      = 10000
+	DefaultMaxSubscriptionConnsPerIP = 10
+
+	// subscriptionBufferSize is the number of updates buffered for each
+	// connection. Connections which fall further behind are closed.
+	subscriptionBufferSize = 16
+
+	// maxSubscriptionRequestSize limits the size of messages read from
+	// clients, which only need to send short requests.
+	maxSubscriptionRequestSize = 1024
+
+	subscriptionWriteTimeout = 10 * time.Second
+	subscriptionPingInterval = 30 * time.Second
+)
+
+// SubscriptionRequest is a message sent by a client to subscribe to, or
+// unsubscribe from, the status of a tx or changes of epoch. The tx hash is
+// ignored for epoch subscriptions.
+type SubscriptionRequest struct {
+	Method string  `json:"method"`
+	TxHash id.Hash `json:"txHash"`
+}
+
+// TxStatusUpdate is a message sent to subscribed clients when the status of a
+// tx changes. It is also used to report errors for a subscription request.
+type TxStatusUpdate struct {
+	TxHash   id.Hash   `json:"txHash"`
+	TxStatus tx.Status `json:"txStatus,omitempty"`
+	Tx       *tx.Tx    `json:"tx,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// EpochUpdate is a message sent to clients subscribed to epoch changes.
+type EpochUpdate struct {
+	Epoch EpochChange `json:"epoch"`
+}
+
+// SubscriptionHandler serves a WebSocket endpoint which pushes the status of
+// txs to subscribed clients, so that they do not need to poll queryTx. The
+// status of each subscribed tx is queried once per poll, regardless of how many
+// clients are subscribed to it, and subscriptions end once the tx is done or
+// reverted. Clients can also subscribe to changes of epoch, which are pushed
+// by NotifyEpochChange.
+//
+// Browsers are only accepted from the allowed origins, and the number of
+// connections is limited in total and for each client.
+type SubscriptionHandler struct {
+	logger         logging.Logger
+	resolver       jsonrpc.Resolver
+	pollRate       time.Duration
+	upgrader       websocket.Upgrader
+	conns          *connLimiter
+	trustedProxies []*net.IPNet
+
+	mu      *sync.Mutex
+	watches map[id.Hash]*txWatch
+	epochs  map[*subscriber]bool
+}
+
+// connLimiter counts the open connections, in total and for each IP.
+type connLimiter struct {
+	mu       sync.Mutex
+	max      int
+	maxPerIP int
+	total    int
+	perIP    map[string]int
+}
+
+// txWatch is a tx with at least one subscriber, along with its last known
+// status.
+type txWatch struct {
+	subscribers map[*subscriber]bool
+	last        *TxStatusUpdate
+}
+
+// subscriber is a connection of a client.
+type subscriber struct {
+	conn      *websocket.Conn
+	send      chan interface{}
+	done      chan struct{}
+	closeOnce *sync.Once
+
+	// subscriptions is the number of txs the subscriber is watching. It is
+	// guarded by the mutex of the handler.
+	subscriptions int
+}
+
+// NewSubscriptionHandler returns a SubscriptionHandler which queries the status
+// of txs from the given resolver. Browsers are only accepted from the origin of
+// the Lightnode itself until other origins are allowed with WithOrigins.
+func NewSubscriptionHandler(logger logging.Logger, resolver jsonrpc.Resolver, pollRate time.Duration) SubscriptionHandler {
+	return SubscriptionHandler{
+		logger:   logger,
+		resolver: resolver,
+		pollRate: pollRate,
+		conns: &connLimiter{
+			max:      DefaultMaxSubscriptionConns,
+			maxPerIP: DefaultMaxSubscriptionConnsPerIP,
+			perIP:    map[string]int{},
+		},
+		mu:      new(sync.Mutex),
+		watches: map[id.Hash]*txWatch{},
+		epochs:  map[*subscriber]bool{},
+	}
+}
+
+// WithOrigins accepts connections from browsers on the given origins, such as
+// "https://app.example.com", or on any origin if they include "*". Clients
+// which are not browsers do not send an origin and are always accepted.
+func (handler SubscriptionHandler) WithOrigins(origins []string) SubscriptionHandler {
+	allowed := map[string]bool{}
+	for _, origin := range origins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	handler.upgrader.CheckOrigin = func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowed["*"] || allowed[strings.ToLower(origin)] {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return handler
+}
+
+// WithConnLimits limits the number of open connections in total, and from each
+// client. Zero disables either limit. Clients are identified by the right-most
+// entry of the x-forwarded-for header if the request comes from one of the
+// trusted proxies, and by their remote address otherwise.
+func (handler SubscriptionHandler) WithConnLimits(maxConns, maxConnsPerIP int, trustedProxies []*net.IPNet) SubscriptionHandler {
+	handler.conns = &connLimiter{
+		max:      maxConns,
+		maxPerIP: maxConnsPerIP,
+		perIP:    map[string]int{},
+	}
+	handler.trustedProxies = trustedProxies
+	return handler
+}
+
+// ValidateOrigin checks that the origin can be allowed by WithOrigins.
+func ValidateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	return nil
+}
+
+// Run queries the status of subscribed txs with the poll rate until the
+// context is done.
+func (handler SubscriptionHandler) Run(ctx context.Context) {
+	ticker := time.NewTicker(handler.pollRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		handler.mu.Lock()
+		hashes := make([]id.Hash, 0, len(handler.watches))
+		for hash := range handler.watches {
+			hashes = append(hashes, hash)
+		}
+		handler.mu.Unlock()
+
+		phi.ParForAll(hashes, func(i int) {
+			handler.check(ctx, hashes[i])
+		})
+	}
+}
+
+// ServeHTTP implements the `http.Handler` interface. It upgrades the request
+// to a WebSocket connection and handles subscription requests until the
+// connection is closed.
+func (handler SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := lhttp.ClientIP(r, handler.trustedProxies).String()
+	if !handler.conns.acquire(ip) {
+		http.Error(w, "too many connections", http.StatusTooManyRequests)
+		return
+	}
+	defer handler.conns.release(ip)
+
+	conn, err := handler.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded with an error.
+		return
+	}
+	sub := &subscriber{
+		conn:      conn,
+		send:      make(chan interface{}, subscriptionBufferSize),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+	go sub.writeLoop()
+
+	subscribed := map[id.Hash]bool{}
+	defer func() {
+		for hash := range subscribed {
+			handler.unsubscribe(hash, sub)
+		}
+		handler.setEpochSubscription(sub, false)
+		sub.close()
+	}()
+
+	conn.SetReadLimit(maxSubscriptionRequestSize)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req SubscriptionRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			sub.push(TxStatusUpdate{Error: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+
+		switch req.Method {
+		case SubscribeMethod:
+			if err := handler.subscribe(r.Context(), req.TxHash, sub); err != nil {
+				sub.push(TxStatusUpdate{TxHash: req.TxHash, Error: err.Error()})
+				continue
+			}
+			subscribed[req.TxHash] = true
+		case UnsubscribeMethod:
+			delete(subscribed, req.TxHash)
+			handler.unsubscribe(req.TxHash, sub)
+		case SubscribeEpochsMethod:
+			handler.setEpochSubscription(sub, true)
+		case UnsubscribeEpochsMethod:
+			handler.setEpochSubscription(sub, false)
+		default:
+			sub.push(TxStatusUpdate{TxHash: req.TxHash, Error: fmt.Sprintf("unknown method %q", req.Method)})
+		}
+	}
+}
+
+// subscribe adds the subscriber to the tx. The subscriber is sent the last
+// known status of the tx, or the status is queried if it is not yet known.
+func (handler SubscriptionHandler) subscribe(ctx context.Context, hash id.Hash, sub *subscriber) error {
+	handler.mu.Lock()
+	watch, ok := handler.watches[hash]
+	if ok && watch.subscribers[sub] {
+		handler.mu.Unlock()
+		return nil
+	}
+	if sub.subscriptions >= MaxSubscriptionsPerConn {
+		handler.mu.Unlock()
+		return fmt.Errorf("cannot subscribe to more than %v txs", MaxSubscriptionsPerConn)
+	}
+	if !ok {
+		watch = &txWatch{subscribers: map[*subscriber]bool{}}
+		handler.watches[hash] = watch
+	}
+	watch.subscribers[sub] = true
+	sub.subscriptions++
+	last := watch.last
+	handler.mu.Unlock()
+
+	if last != nil {
+		sub.push(*last)
+		return nil
+	}
+	go handler.check(ctx, hash)
+	return nil
+}
+
+// unsubscribe removes the subscriber from the tx, and stops watching the tx if
+// it has no subscribers left.
+func (handler SubscriptionHandler) unsubscribe(hash id.Hash, sub *subscriber) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	watch, ok := handler.watches[hash]
+	if !ok || !watch.subscribers[sub] {
+		return
+	}
+	delete(watch.subscribers, sub)
+	sub.subscriptions--
+	if len(watch.subscribers) == 0 {
+		delete(handler.watches, hash)
+	}
+}
+
+// setEpochSubscription subscribes or unsubscribes the subscriber from epoch
+// changes.
+func (handler SubscriptionHandler) setEpochSubscription(sub *subscriber, subscribed bool) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if subscribed {
+		handler.epochs[sub] = true
+	} else {
+		delete(handler.epochs, sub)
+	}
+}
+
+// NotifyEpochChange pushes the change to every client subscribed to epoch
+// changes, so that wallets can warn their users.
+func (handler SubscriptionHandler) NotifyEpochChange(change EpochChange) {
+	handler.mu.Lock()
+	subscribers := make([]*subscriber, 0, len(handler.epochs))
+	for sub := range handler.epochs {
+		subscribers = append(subscribers, sub)
+	}
+	handler.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.push(EpochUpdate{Epoch: change})
+	}
+}
+
+// check queries the status of the tx and notifies its subscribers if it has
+// changed. Txs which are done or reverted are no longer watched.
+func (handler SubscriptionHandler) check(ctx context.Context, hash id.Hash) {
+	response := handler.resolver.QueryTx(ctx, nil, &jsonrpc.ParamsQueryTx{TxHash: hash}, nil)
+	if response.Error != nil {
+		// The tx may not have been submitted yet, so it is queried again on
+		// the next poll.
+		handler.logger.Debugf("[subscriptions] cannot query tx=%v: %v", hash, response.Error.Message)
+		return
+	}
+	result, err := lhttp.DecodeQueryTxResult(response.Result)
+	if err != nil {
+		handler.logger.Warnf("[subscriptions] cannot decode queryTx result for tx=%v: %v", hash, err)
+		return
+	}
+	update := TxStatusUpdate{TxHash: hash, TxStatus: result.TxStatus, Tx: &result.Tx}
+
+	handler.mu.Lock()
+	watch, ok := handler.watches[hash]
+	if !ok || (watch.last != nil && watch.last.TxStatus == update.TxStatus) {
+		handler.mu.Unlock()
+		return
+	}
+	watch.last = &update
+	final := update.TxStatus == tx.StatusDone || update.TxStatus == tx.StatusReverted
+	subscribers := make([]*subscriber, 0, len(watch.subscribers))
+	for sub := range watch.subscribers {
+		subscribers = append(subscribers, sub)
+		if final {
+			sub.subscriptions--
+		}
+	}
+	if final {
+		delete(handler.watches, hash)
+	}
+	handler.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.push(update)
+	}
+}
+
+// acquire counts a new connection from the IP, unless it would exceed either
+// limit.
+func (limiter *connLimiter) acquire(ip string) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if (limiter.max > 0 && limiter.total >= limiter.max) || (limiter.maxPerIP > 0 && limiter.perIP[ip] >= limiter.maxPerIP) {
+		return false
+	}
+	limiter.total++
+	limiter.perIP[ip]++
+	return true
+}
+
+// release stops counting a connection from the IP once it is closed.
+func (limiter *connLimiter) release(ip string) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.total--
+	if limiter.perIP[ip]--; limiter.perIP[ip] <= 0 {
+		delete(limiter.perIP, ip)
+	}
+}
+
+// push queues the update, a TxStatusUpdate or an EpochUpdate, to be sent to
+// the client. Clients which do not read their updates fast enough are
+// disconnected.
+func (sub *subscriber) push(update interface{}) {
+	select {
+	case <-sub.done:
+	case sub.send <- update:
+	default:
+		sub.close()
+	}
+}
+
+// writeLoop sends queued updates, and pings the client to keep the connection
+// alive, until the subscriber is closed.
+func (sub *subscriber) writeLoop() {
+	ticker := time.NewTicker(subscriptionPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sub.done:
+			return
+		case update := <-sub.send:
+			sub.conn.SetWriteDeadline(time.Now().Add(subscriptionWriteTimeout))
+			if err := sub.conn.WriteJSON(update); err != nil {
+				sub.close()
+				return
+			}
+		case <-ticker.C:
+			if err := sub.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(subscriptionWriteTimeout)); err != nil {
+				sub.close()
+				return
+			}
+		}
+	}
+}
+
+func (sub *subscriber) close() {
+	sub.closeOnce.Do(func() {
+		close(sub.done)
+		sub.conn.Close()
+	})
+}
@@ -0,0 +1,234 @@
+package resolver_test
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/gorilla/websocket"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
+	"github.com/renproject/lightnode/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// statusResolver responds to queryTx requests with a tx whose status can be
+// changed, and counts the requests it receives.
+type statusResolver struct {
+	jsonrpc.Resolver
+
+	mu      *sync.Mutex
+	tx      tx.Tx
+	status  tx.Status
+	queries int
+}
+
+func (resolver *statusResolver) QueryTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryTx, req *http.Request) jsonrpc.Response {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.queries++
+	return jsonrpc.NewResponse(id, jsonrpc.ResponseQueryTx{Tx: resolver.tx, TxStatus: resolver.status}, nil)
+}
+
+func (resolver *statusResolver) setStatus(status tx.Status) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.status = status
+}
+
+var _ = Describe("Subscriptions", func() {
+	init := func(ctx context.Context) (*statusResolver, func() *websocket.Conn) {
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		resolver := &statusResolver{mu: new(sync.Mutex), tx: txutil.RandomGoodTx(r), status: tx.StatusConfirming}
+		handler := NewSubscriptionHandler(logging.FromLogrus(logrus.New()), resolver, 50*time.Millisecond)
+		go handler.Run(ctx)
+
+		server := httptest.NewServer(handler)
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		dial := func() *websocket.Conn {
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			Expect(err).NotTo(HaveOccurred())
+			return conn
+		}
+		return resolver, dial
+	}
+
+	readUpdate := func(conn *websocket.Conn) TxStatusUpdate {
+		var update TxStatusUpdate
+		Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+		Expect(conn.ReadJSON(&update)).To(Succeed())
+		return update
+	}
+
+	It("should push status changes until the tx is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resolver, dial := init(ctx)
+
+		conn := dial()
+		defer conn.Close()
+		Expect(conn.WriteJSON(SubscriptionRequest{Method: SubscribeMethod, TxHash: resolver.tx.Hash})).To(Succeed())
+
+		update := readUpdate(conn)
+		Expect(update.Error).To(BeEmpty())
+		Expect(update.TxHash).To(Equal(resolver.tx.Hash))
+		Expect(update.TxStatus).To(Equal(tx.StatusConfirming))
+
+		resolver.setStatus(tx.StatusExecuting)
+		Expect(readUpdate(conn).TxStatus).To(Equal(tx.StatusExecuting))
+
+		resolver.setStatus(tx.StatusDone)
+		Expect(readUpdate(conn).TxStatus).To(Equal(tx.StatusDone))
+
+		// The tx is no longer queried once it is done.
+		time.Sleep(100 * time.Millisecond)
+		resolver.mu.Lock()
+		queries := resolver.queries
+		resolver.mu.Unlock()
+		Consistently(func() int {
+			resolver.mu.Lock()
+			defer resolver.mu.Unlock()
+			return resolver.queries
+		}, 200*time.Millisecond).Should(Equal(queries))
+	})
+
+	It("should send the last known status to new subscribers", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resolver, dial := init(ctx)
+
+		first := dial()
+		defer first.Close()
+		Expect(first.WriteJSON(SubscriptionRequest{Method: SubscribeMethod, TxHash: resolver.tx.Hash})).To(Succeed())
+		Expect(readUpdate(first).TxStatus).To(Equal(tx.StatusConfirming))
+
+		second := dial()
+		defer second.Close()
+		Expect(second.WriteJSON(SubscriptionRequest{Method: SubscribeMethod, TxHash: resolver.tx.Hash})).To(Succeed())
+		Expect(readUpdate(second).TxStatus).To(Equal(tx.StatusConfirming))
+	})
+
+	It("should push epoch changes to subscribed clients", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		resolver := &statusResolver{mu: new(sync.Mutex), tx: txutil.RandomGoodTx(r), status: tx.StatusConfirming}
+		handler := NewSubscriptionHandler(logging.FromLogrus(logrus.New()), resolver, 50*time.Millisecond)
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.WriteJSON(SubscriptionRequest{Method: SubscribeEpochsMethod})).To(Succeed())
+
+		// The subscription is handled asynchronously, so changes are
+		// notified until one is received.
+		var update EpochUpdate
+		received := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(received)
+			Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+			Expect(conn.ReadJSON(&update)).To(Succeed())
+		}()
+		Eventually(func() bool {
+			handler.NotifyEpochChange(EpochChange{Epoch: 2, PreviousEpoch: 1, ShardsChanged: true})
+			select {
+			case <-received:
+				return true
+			default:
+				return false
+			}
+		}).Should(BeTrue())
+		Expect(update.Epoch.Epoch).To(Equal(uint64(2)))
+		Expect(update.Epoch.ShardsChanged).To(BeTrue())
+	})
+
+	It("should reject unknown methods", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resolver, dial := init(ctx)
+
+		conn := dial()
+		defer conn.Close()
+		Expect(conn.WriteJSON(SubscriptionRequest{Method: "poll", TxHash: resolver.tx.Hash})).To(Succeed())
+		Expect(readUpdate(conn).Error).To(ContainSubstring("unknown method"))
+
+		Expect(conn.WriteMessage(websocket.TextMessage, []byte("{"))).To(Succeed())
+		Expect(readUpdate(conn).Error).To(ContainSubstring("invalid request"))
+	})
+
+	It("should only accept browsers from the allowed origins", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver := &statusResolver{mu: new(sync.Mutex), status: tx.StatusConfirming}
+		handler := NewSubscriptionHandler(logging.FromLogrus(logrus.New()), resolver, time.Minute).
+			WithOrigins([]string{"https://app.example.com"})
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+		dial := func(origin string) error {
+			header := http.Header{}
+			if origin != "" {
+				header.Set("Origin", origin)
+			}
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}
+		Expect(dial("")).To(Succeed())
+		Expect(dial("https://app.example.com")).To(Succeed())
+		Expect(dial(server.URL)).To(Succeed())
+		Expect(dial("https://evil.example.com")).NotTo(Succeed())
+	})
+
+	It("should limit the number of connections from each client", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resolver := &statusResolver{mu: new(sync.Mutex), status: tx.StatusConfirming}
+		handler := NewSubscriptionHandler(logging.FromLogrus(logrus.New()), resolver, time.Minute).
+			WithConnLimits(10, 2, nil)
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+		conns := make([]*websocket.Conn, 2)
+		for i := range conns {
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			conns[i] = conn
+		}
+		_, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+
+		// Closed connections no longer count towards the limit.
+		conns[0].Close()
+		Eventually(func() error {
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}).Should(Succeed())
+		conns[1].Close()
+	})
+})
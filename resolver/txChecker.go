@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"runtime"
 	"sort"
 	"sync"
 	"time"
@@ -14,22 +13,80 @@ import (
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
 	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
 	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/pool"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
-	"github.com/renproject/phi"
-	"github.com/sirupsen/logrus"
 )
 
 // A txchecker reads SubmitTx requests from a channel and validates the details
 // of the transaction. It will store the transaction if it is valid.
 type txchecker struct {
-	logger   logrus.FieldLogger
-	requests <-chan http.RequestWithResponder
-	verifier Verifier
-	db       db.DB
-	mu       *sync.Mutex
+	logger      logging.Logger
+	requests    <-chan http.RequestWithResponder
+	verifier    Verifier
+	db          db.DB
+	writeBehind WriteBehind
+	writes      chan txWrite
+	pool        *pool.Pool
+}
+
+// txWrite is a request to persist a transaction, along with a channel on which
+// the result of the write is returned. Writes which have already been
+// acknowledged have no channel.
+type txWrite struct {
+	tx        tx.Tx
+	done      chan error
+	journaled bool
+	attempts  int
+}
+
+const (
+	// writeAttempts is the number of times the txchecker tries to write a tx
+	// to the database before giving up on it.
+	writeAttempts = 5
+	// writeRetryDelay is the delay before a failed write is first retried.
+	// It doubles with every attempt.
+	writeRetryDelay = 250 * time.Millisecond
+)
+
+// WriteBehind configures the txchecker to acknowledge submissions before they
+// are written to the database, instead of waiting for the write. Submissions
+// are queued in memory, and also appended to the journal if there is one so
+// that they are not lost if the Lightnode stops. Once the queue is full,
+// submissions wait for their write as usual. A zero QueueSize disables it.
+type WriteBehind struct {
+	QueueSize int
+	Journal   *Journal
+}
+
+// Enumerate the persistence states of an accepted transaction.
+const (
+	// PersistenceDurable means the tx has been written to the database or
+	// the journal.
+	PersistenceDurable = "durable"
+	// PersistencePending means the tx is queued in memory to be written to
+	// the database.
+	PersistencePending = "pending"
+)
+
+// PersistenceParam is the query parameter with which clients ask for submitTx
+// responses to include the persistence of the tx. Otherwise, responses have
+// the same shape as those of the Darknodes.
+const PersistenceParam = "persistence"
+
+// ResponseSubmitTx extends the darknode response with whether the tx has been
+// persisted, so that clients know whether they need to resubmit it if the
+// Lightnode restarts. Resubmissions of a tx which has already been persisted
+// also include its stored status. It is only returned to clients which set
+// PersistenceParam.
+type ResponseSubmitTx struct {
+	Persistence string `json:"persistence"`
+	Status      string `json:"status,omitempty"`
 }
 
 type Verifier interface {
@@ -113,54 +170,349 @@ func (v verifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
 	}, v.contract, transaction)
 }
 
-// newTxChecker returns a new txchecker.
-func newTxChecker(logger logrus.FieldLogger, requests <-chan http.RequestWithResponder, verifier Verifier, db db.DB) txchecker {
-	return txchecker{
-		logger:   logger,
-		requests: requests,
+// ReloadableVerifier verifies txs with a verifier which can be replaced while
+// the Lightnode is running, such as when the bindings are rebuilt for a host
+// chain which has been added at runtime.
+type ReloadableVerifier struct {
+	mu       *sync.RWMutex
+	verifier Verifier
+}
+
+// NewReloadableVerifier returns a ReloadableVerifier which starts out using
+// the given verifier.
+func NewReloadableVerifier(verifier Verifier) *ReloadableVerifier {
+	return &ReloadableVerifier{
+		mu:       new(sync.RWMutex),
 		verifier: verifier,
-		db:       db,
-		mu:       new(sync.Mutex),
 	}
 }
 
-// Run starts the txchecker until the requests channel is closed.
-func (tc *txchecker) Run() {
-	workers := 2 * runtime.NumCPU()
-	phi.ForAll(workers, func(_ int) {
-		for req := range tc.requests {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Set replaces the verifier. Txs which are already being verified finish with
+// the old verifier.
+func (v *ReloadableVerifier) Set(verifier Verifier) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.verifier = verifier
+}
+
+// VerifyTx implements the Verifier interface.
+func (v *ReloadableVerifier) VerifyTx(ctx context.Context, transaction tx.Tx) error {
+	v.mu.RLock()
+	verifier := v.verifier
+	v.mu.RUnlock()
+
+	return verifier.VerifyTx(ctx, transaction)
+}
+
+// newTxChecker returns a new txchecker. Txs left in the journal by a previous
+// run are written to the database before it returns.
+func newTxChecker(logger logging.Logger, requests <-chan http.RequestWithResponder, verifier Verifier, db db.DB, writeBehind WriteBehind, pool *pool.Pool) txchecker {
+	queueSize := db.BatchSize()
+	if writeBehind.QueueSize > 0 {
+		queueSize = writeBehind.QueueSize
+	}
+	tc := txchecker{
+		logger:      logger,
+		requests:    requests,
+		verifier:    verifier,
+		db:          db,
+		writeBehind: writeBehind,
+		writes:      make(chan txWrite, queueSize),
+		pool:        pool,
+	}
+	if writeBehind.Journal != nil {
+		tc.replayJournal()
+	}
+	return tc
+}
+
+// replayJournal writes the txs in the journal to the database. Txs which cannot
+// be written are kept in the journal to be replayed by the next run.
+func (tc *txchecker) replayJournal() {
+	if torn := tc.writeBehind.Journal.Torn(); torn > 0 {
+		tc.logger.Warnf("[txchecker] removed incomplete entry of %v bytes from journal", torn)
+	}
+	txs, err := tc.writeBehind.Journal.Entries()
+	if err != nil {
+		tc.logger.Errorf("[txchecker] cannot read journal: %v", err)
+		return
+	}
+	kept := []tx.Tx{}
+	if len(txs) > 0 {
+		errs := tc.insert(txs)
+		for _, transaction := range txs {
+			if errs[transaction.Hash] != nil {
+				kept = append(kept, transaction)
+			}
+		}
+		if len(kept) > 0 {
+			tc.logger.Errorf("[txchecker] cannot replay %v txs from journal, keeping them for the next run", len(kept))
+		}
+		tc.logger.Infof("[txchecker] replayed %v txs from journal", len(txs)-len(kept))
+	}
+	if err := tc.writeBehind.Journal.Done(0, kept...); err != nil {
+		tc.logger.Errorf("[txchecker] cannot truncate journal: %v", err)
+	}
+}
 
-			params := req.Params.(jsonrpc.ParamsSubmitTx)
+// Run starts the txchecker until the context is done or the requests channel
+// is closed. Requests are checked concurrently, up to the size of the pool.
+// Before it returns, the checks in progress are finished and their txs are
+// written to the database.
+func (tc *txchecker) Run(ctx context.Context) {
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		tc.runWriter()
+	}()
 
-			err := tc.verifier.VerifyTx(ctx, params.Tx)
+	var checks sync.WaitGroup
+Loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break Loop
+		case req, ok := <-tc.requests:
+			if !ok {
+				break Loop
+			}
+			checks.Add(1)
+			if err := tc.pool.Go(req.Context, func() {
+				defer checks.Done()
+				tc.check(req)
+			}); err != nil {
+				// The request has timed out, so nobody is waiting for the
+				// response.
+				checks.Done()
+				tc.logger.Warnf("[txchecker] dropping request %v: %v", req.ID, err)
+			}
+		}
+	}
+
+	// Nothing is queued once the checks have finished, so the writer can
+	// drain the queue and stop.
+	checks.Wait()
+	close(tc.writes)
+	<-writerDone
+}
+
+// check verifies and persists the tx in the request, and responds with the
+// result.
+func (tc *txchecker) check(req http.RequestWithResponder) {
+	// Verification calls the host chains, so it is bound to the request
+	// and stops if the client goes away or the Lightnode shuts down.
+	ctx, cancel := context.WithTimeout(req.Context, 10*time.Second)
+
+	params := req.Params.(jsonrpc.ParamsSubmitTx)
+
+	// Resubmissions of a stored tx succeed without being verified or
+	// persisted again. The hash is recomputed from the contents of the tx,
+	// so that a tx cannot pass as another by claiming its hash.
+	if hash, err := tx.NewTxHash(params.Tx.Version, params.Tx.Selector, params.Tx.Input); err == nil && hash == params.Tx.Hash {
+		status, err := tc.db.TxStatus(hash)
+		if err == nil {
 			cancel()
-			if err != nil {
-				req.RespondWithErr(jsonrpc.ErrorCodeInvalidParams, err)
-				continue
+			tc.respond(req, ResponseSubmitTx{Persistence: PersistenceDurable, Status: status.String()})
+			return
+		}
+		if err != sql.ErrNoRows {
+			tc.logger.Warnf("[txchecker] cannot get status of tx=%v: %v", hash.String(), err)
+		}
+	}
+
+	err := tc.verifier.VerifyTx(ctx, params.Tx)
+	cancel()
+	if err != nil {
+		// Txs which could not be verified in time, or were turned away
+		// because there are too many pending txs, have not been rejected,
+		// so clients can retry them.
+		code := jsonrpc.ErrorCodeInvalidParams
+		switch {
+		case lerrors.Is(err, lerrors.ErrBackpressure):
+			code = jsonrpc.ErrorCodeInternal
+		case lerrors.Is(err, lerrors.ErrRetryLater):
+			code = lerrors.ErrorCodeRetryLater
+		}
+		req.RespondWithErr(code, err)
+		return
+	}
+
+	// Persist the transaction, unless it is a duplicate.
+	persistence, err := tc.persist(params.Tx)
+	if err != nil {
+		tc.logger.Errorf("[txchecker] cannot check tx duplication: %v", err)
+		req.RespondWithErr(jsonrpc.ErrorCodeInternal, err)
+		return
+	}
+
+	// Write the response to the responder channel.
+	tc.respond(req, ResponseSubmitTx{Persistence: persistence})
+}
+
+// respond writes the result of a submission to the responder channel. The
+// persistence of the tx is only included if the client asked for it.
+func (tc *txchecker) respond(req http.RequestWithResponder, result ResponseSubmitTx) {
+	if req.Query.Get(PersistenceParam) != "true" {
+		req.Responder <- jsonrpc.NewResponse(req.ID, jsonrpc.ResponseSubmitTx{}, nil)
+		return
+	}
+	req.Responder <- jsonrpc.NewResponse(req.ID, result, nil)
+}
+
+// persist persists the transaction if it does not already exist in the
+// database, and returns its persistence state. Writes from all workers are funnelled through a single writer so
+// that bursts of submissions (for example, while the watcher is catching up)
+// are inserted in batches rather than one row at a time.
+//
+// With write-behind enabled, the transaction is queued and acknowledged
+// without waiting for the write, unless the queue is full.
+func (tc *txchecker) persist(transaction tx.Tx) (string, error) {
+	journaled := false
+	if tc.writeBehind.QueueSize > 0 {
+		if tc.writeBehind.Journal != nil {
+			if err := tc.writeBehind.Journal.Append(transaction); err != nil {
+				return "", fmt.Errorf("journaling tx: %v", err)
+			}
+			journaled = true
+		}
+
+		select {
+		case tc.writes <- txWrite{tx: transaction, journaled: journaled}:
+			if journaled {
+				return PersistenceDurable, nil
 			}
+			return PersistencePending, nil
+		default:
+			// Apply back pressure by waiting for the write.
+		}
+	}
+
+	done := make(chan error, 1)
+	tc.writes <- txWrite{tx: transaction, done: done, journaled: journaled}
+	return PersistenceDurable, <-done
+}
+
+// runWriter collects pending writes into batches of up to the configured batch
+// size and inserts them into the database. It never waits for a batch to fill
+// up, so a lone write is inserted immediately. Failed writes are retried with
+// backoff, together with the writes which are pending when they are due. It
+// returns once the writes channel has been closed and drained, and the
+// retries have either succeeded or run out.
+func (tc *txchecker) runWriter() {
+	batchSize := tc.db.BatchSize()
+	writes := tc.writes
+	retries := []txWrite{}
+	retryTimer := time.NewTimer(time.Hour)
+	retryTimer.Stop()
+	defer retryTimer.Stop()
 
-			// Check if the transaction is a duplicate.
-			if err := tc.checkDuplicate(params.Tx); err != nil {
-				tc.logger.Errorf("[txchecker] cannot check tx duplication: %v", err)
-				req.RespondWithErr(jsonrpc.ErrorCodeInternal, err)
+	for writes != nil || len(retries) > 0 {
+		batch := []txWrite{}
+		select {
+		case write, ok := <-writes:
+			if !ok {
+				writes = nil
 				continue
 			}
+			batch = append(batch, write)
+		case <-retryTimer.C:
+			batch, retries = retries, []txWrite{}
+		}
+	Collect:
+		for writes != nil && len(batch) < batchSize {
+			select {
+			case write, ok := <-writes:
+				if !ok {
+					writes = nil
+					break Collect
+				}
+				batch = append(batch, write)
+			default:
+				break Collect
+			}
+		}
 
-			// Write the response to the responder channel.
-			response := jsonrpc.ResponseSubmitTx{}
-			req.Responder <- jsonrpc.NewResponse(req.ID, response, nil)
+		failed := tc.write(batch)
+		if len(failed) > 0 && len(retries) == 0 {
+			retryTimer.Reset(writeRetryDelay << (failed[0].attempts - 1))
 		}
-	})
+		retries = append(retries, failed...)
+	}
+}
+
+// write inserts the batch into the database, and returns the writes which
+// failed and should be retried. The other writes are answered, and released
+// from the journal. Journaled txs which could not be written within
+// writeAttempts are kept in the journal, so that they are replayed by the
+// next run.
+func (tc *txchecker) write(batch []txWrite) []txWrite {
+	// Concurrent submissions of the same tx can end up in the same batch, so
+	// it is only inserted once.
+	txs := make([]tx.Tx, 0, len(batch))
+	seen := make(map[id.Hash]bool, len(batch))
+	for i := range batch {
+		if !seen[batch[i].tx.Hash] {
+			seen[batch[i].tx.Hash] = true
+			txs = append(txs, batch[i].tx)
+		}
+	}
+	errs := tc.insert(txs)
+
+	retries := []txWrite{}
+	released := 0
+	kept := []tx.Tx{}
+	for _, write := range batch {
+		err := errs[write.tx.Hash]
+		if err != nil {
+			write.attempts++
+			if write.attempts < writeAttempts {
+				retries = append(retries, write)
+				continue
+			}
+			tc.logger.Errorf("[txchecker] giving up on writing tx=%v after %v attempts: %v", write.tx.Hash, write.attempts, err)
+			if write.journaled {
+				kept = append(kept, write.tx)
+			}
+		}
+		if write.journaled {
+			released++
+		}
+		if write.done != nil {
+			write.done <- err
+		}
+	}
+	if released > 0 {
+		if err := tc.writeBehind.Journal.Done(released, kept...); err != nil {
+			tc.logger.Errorf("[txchecker] cannot truncate journal: %v", err)
+		}
+	}
+	return retries
 }
 
-func (tc *txchecker) checkDuplicate(transaction tx.Tx) error {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
+// insert writes the txs to the database, and returns the errors of the txs
+// which could not be written. If the batch fails, the txs are inserted one at
+// a time, so that a tx which cannot be written does not fail the others.
+// Txs which were already written by part of the batch are skipped, so they
+// succeed.
+func (tc *txchecker) insert(txs []tx.Tx) map[id.Hash]error {
+	errs := map[id.Hash]error{}
+	err := tc.db.InsertTxs(txs)
+	if err == nil {
+		return errs
+	}
+	if len(txs) == 1 {
+		tc.logger.Errorf("[txchecker] cannot insert tx=%v: %v", txs[0].Hash, err)
+		errs[txs[0].Hash] = err
+		return errs
+	}
 
-	_, err := tc.db.Tx(transaction.Hash)
-	if err == sql.ErrNoRows {
-		return tc.db.InsertTx(transaction)
+	tc.logger.Warnf("[txchecker] cannot insert batch of %v txs, inserting them one at a time: %v", len(txs), err)
+	for _, transaction := range txs {
+		if err := tc.db.InsertTxs([]tx.Tx{transaction}); err != nil {
+			tc.logger.Errorf("[txchecker] cannot insert tx=%v: %v", transaction.Hash, err)
+			errs[transaction.Hash] = err
+		}
 	}
-	return err
+	return errs
 }
@@ -1 +1,25 @@
 package resolver_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/tx"
+)
+
+var _ = Describe("Reloadable verifier", func() {
+	It("should verify txs with the latest verifier", func() {
+		var oldCount, newCount int64
+		verifier := NewReloadableVerifier(countingVerifier{count: &oldCount, err: errors.New("unknown chain")})
+		Expect(verifier.VerifyTx(context.Background(), tx.Tx{})).NotTo(Succeed())
+
+		verifier.Set(countingVerifier{count: &newCount})
+		Expect(verifier.VerifyTx(context.Background(), tx.Tx{})).To(Succeed())
+		Expect(oldCount).To(Equal(int64(1)))
+		Expect(newCount).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/logging"
+)
+
+// V0PayloadsHandler serves the v0 payloads endpoint of the admin API, which
+// returns the original params of legacy v0 submissions. With a digest
+// parameter, it returns the payload with that digest. With a hash parameter,
+// it returns the payloads which were converted into the v1 tx with that hash.
+type V0PayloadsHandler struct {
+	logger logging.Logger
+	db     db.DB
+}
+
+// NewV0PayloadsHandler returns a V0PayloadsHandler which reads from the given
+// database.
+func NewV0PayloadsHandler(logger logging.Logger, db db.DB) V0PayloadsHandler {
+	return V0PayloadsHandler{logger: logger, db: db}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler V0PayloadsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{}
+	query := r.URL.Query()
+	switch {
+	case query.Get("digest") != "":
+		digest, ok := decodeHashParam(query.Get("digest"))
+		if !ok {
+			http.Error(w, "invalid digest", http.StatusBadRequest)
+			return
+		}
+		payload, err := handler.db.V0Payload(digest)
+		if err == sql.ErrNoRows {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			handler.logger.Errorf("[resolver] cannot get v0 payload %v: %v", digest, err)
+			http.Error(w, "cannot get payload", http.StatusInternalServerError)
+			return
+		}
+		result = payload
+	case query.Get("hash") != "":
+		hash, ok := decodeHashParam(query.Get("hash"))
+		if !ok {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+		payloads, err := handler.db.V0PayloadsByTx(hash)
+		if err != nil {
+			handler.logger.Errorf("[resolver] cannot get v0 payloads of tx %v: %v", hash, err)
+			http.Error(w, "cannot get payloads", http.StatusInternalServerError)
+			return
+		}
+		result = payloads
+	default:
+		http.Error(w, "missing digest or hash", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// decodeHashParam decodes a hash given as an unpadded base64url query
+// parameter.
+func decodeHashParam(str string) (id.Hash, bool) {
+	var hash id.Hash
+	hashBytes, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil || len(hashBytes) != len(hash) {
+		return hash, false
+	}
+	copy(hash[:], hashBytes)
+	return hash, true
+}
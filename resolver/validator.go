@@ -8,41 +8,53 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
 	v1 "github.com/renproject/lightnode/compat/v1"
+	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/pause"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
-	"github.com/sirupsen/logrus"
 )
 
 // The lightnode Validator checks requests and also casts in case of compat changes
 type LightnodeValidator struct {
 	network      multichain.Network
-	bindings     binding.Bindings
+	chains       v0.ChainReader
 	pubkey       *id.PubKey
 	versionStore v0.CompatStore
 	gpubkeyStore v1.GpubkeyCompatStore
+	pauser       *pause.Pauser
 	limiter      *LightnodeRateLimiter
-	logger       logrus.FieldLogger
+	logger       logging.Logger
+	db           db.DB
 }
 
-func NewValidator(network multichain.Network, bindings binding.Bindings, pubkey *id.PubKey, versionStore v0.CompatStore, gpubkeyStore v1.GpubkeyCompatStore, limiter *LightnodeRateLimiter, logger logrus.FieldLogger) *LightnodeValidator {
+func NewValidator(network multichain.Network, chains v0.ChainReader, pubkey *id.PubKey, versionStore v0.CompatStore, gpubkeyStore v1.GpubkeyCompatStore, pauser *pause.Pauser, limiter *LightnodeRateLimiter, logger logging.Logger) *LightnodeValidator {
 	return &LightnodeValidator{
 		network:      network,
-		bindings:     bindings,
+		chains:       chains,
 		pubkey:       pubkey,
 		versionStore: versionStore,
 		gpubkeyStore: gpubkeyStore,
+		pauser:       pauser,
 		limiter:      limiter,
 		logger:       logger,
 	}
 }
 
+// WithDB records the original params of legacy v0 submissions in the
+// database, alongside the hash of the v1 tx they are converted into.
+func (validator *LightnodeValidator) WithDB(database db.DB) *LightnodeValidator {
+	validator.db = database
+	return validator
+}
+
 // The validator usually checks if the params are in the correct shape for a given method
 // We override the checker for certain methods here to cast invalid v0 params into v1 versions
 func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *http.Request, req jsonrpc.Request) (interface{}, jsonrpc.Response) {
@@ -91,6 +103,18 @@ func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *htt
 			Message: fmt.Sprintf("rate limit exceeded for %v", ipString),
 		})
 	}
+
+	// Check the shape of the params up front, so that integrators are told
+	// which field is invalid rather than receiving an unmarshalling error.
+	if err := ValidateParams(req.Method, req.Params); err != nil {
+		return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
+	}
+
+	// The original params of a v0 submission are only persisted once the
+	// submission has passed validation.
+	var v0Hash id.Hash
+	var v0Payload json.RawMessage
+
 	switch req.Method {
 
 	case jsonrpc.MethodQueryTx:
@@ -114,10 +138,7 @@ func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *htt
 
 			raw, err := json.Marshal(castParams)
 			if err != nil {
-				return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
-					Code:    jsonrpc.ErrorCodeInvalidParams,
-					Message: fmt.Sprintf("invalid params: %v", err),
-				})
+				return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
 			}
 			req.Params = raw
 		}
@@ -142,10 +163,7 @@ func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *htt
 
 				var input engine.LockMintBurnReleaseInput
 				if err := pack.Decode(&input, v1params.Tx.Input); err != nil {
-					return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
-						Code:    jsonrpc.ErrorCodeInvalidParams,
-						Message: fmt.Sprintf("invalid params: %v", err),
-					})
+					return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
 				}
 				if len(input.Gpubkey) == 0 {
 					break
@@ -153,18 +171,12 @@ func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *htt
 				v1params.Tx, err = validator.gpubkeyStore.RemoveGpubkey(v1params.Tx)
 				if err != nil {
 					validator.logger.Warn("[validator] building tx: %v", err)
-					return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
-						Code:    jsonrpc.ErrorCodeInvalidParams,
-						Message: fmt.Sprintf("invalid params: %v", err),
-					})
+					return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
 				}
 
 				raw, err := json.Marshal(v1params)
 				if err != nil {
-					return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
-						Code:    jsonrpc.ErrorCodeInvalidParams,
-						Message: fmt.Sprintf("invalid params: %v", err),
-					})
+					return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
 				}
 				req.Params = raw
 				break
@@ -173,26 +185,67 @@ func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *htt
 
 		var params v0.ParamsSubmitTx
 		if err := json.Unmarshal(req.Params, &params); err == nil {
-			castParams, err := v0.V1TxParamsFromTx(ctx, params, validator.bindings.(*binding.Binding), validator.pubkey, validator.versionStore, validator.network)
+			castParams, err := v0.V1TxParamsFromTx(ctx, params, validator.chains, validator.pubkey, validator.versionStore, validator.network)
 			if err != nil {
 				validator.logger.Errorf("[validator] upgrading tx params: %v", err)
-				return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
-					Code:    jsonrpc.ErrorCodeInvalidParams,
-					Message: fmt.Sprintf("invalid params: %v", err),
-				})
+				return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
 			}
 			raw, err := json.Marshal(castParams)
 			if err != nil {
+				return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "invalid params: %v", err))
+			}
+			v0Hash, v0Payload = castParams.Tx.Hash, req.Params
+			req.Params = raw
+		}
+	}
+
+	// Deposits of assets which have been paused by governance are rejected
+	// once v0 params have been cast, so that both versions are checked.
+	// Burns and releases are still accepted, so that users can withdraw
+	// their funds while an asset is paused.
+	if req.Method == jsonrpc.MethodSubmitTx || customMethods[req.Method].submitsTx {
+		var params struct {
+			Tx tx.Tx `json:"tx"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err == nil && params.Tx.Selector.IsCrossChain() {
+			var input engine.LockMintBurnReleaseInput
+			if err := pack.Decode(&input, params.Tx.Input); err == nil && len(input.Payload) > MaxSubmissionPayloadSize {
+				return nil, lerrors.Response(req.ID, lerrors.Wrapf(lerrors.ErrInvalidParams, "payload must be at most %v bytes", MaxSubmissionPayloadSize))
+			}
+			asset := params.Tx.Selector.Asset()
+			if paused, reason := validator.pauser.Paused(asset); paused && params.Tx.Selector.IsLock() && params.Tx.Selector.IsMint() {
+				message := fmt.Sprintf("%v is paused", asset)
+				if reason != "" {
+					message = fmt.Sprintf("%v: %v", message, reason)
+				}
 				return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
 					Code:    jsonrpc.ErrorCodeInvalidParams,
-					Message: fmt.Sprintf("invalid params: %v", err),
+					Message: message,
 				})
 			}
-			req.Params = raw
 		}
 	}
 
 	// By this point, all params should be valid v1 params
 	val := jsonrpc.NewValidator()
-	return val.ValidateRequest(ctx, r, req)
+	params, response := val.ValidateRequest(ctx, r, req)
+	if response.Error == nil && v0Payload != nil {
+		validator.persistV0Payload(v0Hash, v0Payload)
+	}
+	return params, response
+}
+
+// persistV0Payload records the params of a v0 submission exactly as they were
+// received, so that disputes about what a legacy client submitted can be
+// resolved. Failing to record them does not reject the submission.
+func (validator *LightnodeValidator) persistV0Payload(hash id.Hash, payload json.RawMessage) {
+	if validator.db == nil {
+		return
+	}
+	digest, err := validator.db.InsertV0Payload(hash, payload)
+	if err != nil {
+		validator.logger.Errorf("[validator] cannot persist v0 payload of tx=%v: %v", hash, err)
+		return
+	}
+	validator.logger.Debugf("[validator] persisted v0 payload digest=%v for tx=%v", digest, hash)
 }
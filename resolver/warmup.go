@@ -0,0 +1,48 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/phi"
+)
+
+// warmupRequests are the queries which are made by most clients when they
+// connect, and so are cached before the Lightnode starts serving requests.
+var warmupRequests = map[string]interface{}{
+	jsonrpc.MethodQueryBlockState: jsonrpc.ParamsQueryBlockState{},
+	jsonrpc.MethodQueryConfig:     jsonrpc.ParamsQueryConfig{},
+	jsonrpc.MethodQueryPeers:      jsonrpc.ParamsQueryPeers{},
+}
+
+// Warmup queries the darknodes for the responses most commonly requested by
+// clients, so that they are cached before the first client requests arrive
+// after a restart. It returns an error listing the methods which could not be
+// cached.
+func (resolver *Resolver) Warmup(ctx context.Context) error {
+	methods := make([]string, 0, len(warmupRequests))
+	for method := range warmupRequests {
+		methods = append(methods, method)
+	}
+
+	errs := make([]error, len(methods))
+	phi.ParForAll(methods, func(i int) {
+		method := methods[i]
+		response := resolver.handleMessage(ctx, fmt.Sprintf("warmup-%v", method), method, warmupRequests[method], nil, false)
+		if response.Error != nil {
+			errs[i] = fmt.Errorf("%v: %v", method, response.Error.Message)
+		}
+	})
+
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cannot warm up %v", failed)
+	}
+	return nil
+}
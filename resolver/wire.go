@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/pack"
+)
+
+// Module paths of the dependencies that define the wire format shared with the
+// Darknodes.
+const (
+	PackModule     = "github.com/renproject/pack"
+	DarknodeModule = "github.com/renproject/darknode"
+)
+
+// SupportedTxVersions are the transaction versions that the Lightnode knows how
+// to decode and convert.
+var SupportedTxVersions = []tx.Version{tx.Version0, tx.Version1}
+
+// WireVersions describes the wire formats the Lightnode was built against. It
+// is exposed through ren_queryConfig so that clients and operators can detect
+// when the Lightnode lags behind the Darknodes.
+type WireVersions struct {
+	TxVersions []tx.Version `json:"txVersions"`
+	Pack       string       `json:"pack"`
+	Darknode   string       `json:"darknode"`
+}
+
+// NewWireVersions returns the wire versions pinned by the build. Module
+// versions are reported as "unknown" if the binary was built without module
+// support.
+func NewWireVersions() WireVersions {
+	versions := WireVersions{
+		TxVersions: SupportedTxVersions,
+		Pack:       "unknown",
+		Darknode:   "unknown",
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return versions
+	}
+	for _, dep := range info.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Version
+		}
+		switch dep.Path {
+		case PackModule:
+			versions.Pack = version
+		case DarknodeModule:
+			versions.Darknode = version
+		}
+	}
+	return versions
+}
+
+// CheckTxCompat returns an error if the transaction returned by the Darknodes
+// uses a version or field encoding that the Lightnode does not understand. This
+// allows us to fail with a clear error rather than converting garbled data.
+func CheckTxCompat(transaction tx.Tx) error {
+	supported := false
+	for _, version := range SupportedTxVersions {
+		if transaction.Version == version {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported tx version %v from darknode: upgrade lightnode", transaction.Version)
+	}
+
+	if !transaction.Selector.IsCrossChain() {
+		return nil
+	}
+	var input engine.LockMintBurnReleaseInput
+	if err := pack.Decode(&input, transaction.Input); err != nil {
+		return fmt.Errorf("incompatible input encoding for %v from darknode: upgrade lightnode: %v", transaction.Selector, err)
+	}
+	if len(transaction.Output) == 0 {
+		return nil
+	}
+	var output engine.LockMintBurnReleaseOutput
+	if err := pack.Decode(&output, transaction.Output); err != nil {
+		return fmt.Errorf("incompatible output encoding for %v from darknode: upgrade lightnode: %v", transaction.Selector, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package resolver_test
+
+import (
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/resolver"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
+	"github.com/renproject/pack"
+)
+
+var _ = Describe("Wire compatibility", func() {
+	Context("when reporting wire versions", func() {
+		It("should include every supported tx version", func() {
+			versions := NewWireVersions()
+			Expect(versions.TxVersions).To(ConsistOf(tx.Version0, tx.Version1))
+			Expect(versions.Pack).NotTo(BeEmpty())
+			Expect(versions.Darknode).NotTo(BeEmpty())
+		})
+	})
+
+	Context("when checking darknode txs", func() {
+		It("should accept txs it knows how to decode", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			transaction := txutil.RandomGoodTx(r)
+			transaction.Selector = tx.Selector("BTC/fromEthereum")
+			transaction.Version = tx.Version1
+			transaction.Output = pack.Typed{}
+			Expect(CheckTxCompat(transaction)).To(Succeed())
+		})
+
+		It("should reject unknown tx versions", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			transaction := txutil.RandomGoodTx(r)
+			transaction.Version = tx.Version("99")
+			err := CheckTxCompat(transaction)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("upgrade lightnode"))
+		})
+
+		It("should reject inputs with an unknown encoding", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			transaction := txutil.RandomGoodTx(r)
+			transaction.Selector = tx.Selector("BTC/toEthereum")
+			transaction.Version = tx.Version1
+			transaction.Input = pack.NewTyped("txid", pack.NewU64(1))
+			err := CheckTxCompat(transaction)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("upgrade lightnode"))
+		})
+	})
+})
@@ -0,0 +1,194 @@
+// Package slowlog keeps a sample of the database queries and Darknode round
+// trips which took longer than expected, so that operators can find out what
+// is slow without enabling debug logging. Recent entries are served as JSON by
+// the Log.
+package slowlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of operations which are recorded.
+const (
+	KindDB       = "db"
+	KindDarknode = "darknode"
+)
+
+// DefaultSize is the number of entries kept by a log created with a size of
+// zero.
+const DefaultSize = 256
+
+// A Timing is the duration of one phase of an operation, such as waiting for a
+// connection or the first byte of a response.
+type Timing struct {
+	Phase    string `json:"phase"`
+	Duration string `json:"duration"`
+}
+
+// An Entry is a slow operation. The parameters of the operation are only
+// recorded as a digest, so that the log does not hold user data.
+type Entry struct {
+	Kind         string   `json:"kind"`
+	Method       string   `json:"method"`
+	Target       string   `json:"target,omitempty"`
+	ParamsDigest string   `json:"paramsDigest,omitempty"`
+	Start        int64    `json:"start"`
+	Duration     string   `json:"duration"`
+	Timings      []Timing `json:"timings,omitempty"`
+	Error        string   `json:"error,omitempty"`
+
+	duration time.Duration
+}
+
+// Log keeps the most recent slow operations in a ring buffer. Operations are
+// slow if they take longer than the threshold of their kind, and kinds without
+// a threshold are never recorded. Only one in every sampleEvery slow
+// operations is recorded, so that a burst of slow operations does not push out
+// everything else. A nil Log records nothing, so components can be given a
+// nil Log when slow operations are not being recorded.
+type Log struct {
+	mu          sync.Mutex
+	thresholds  map[string]time.Duration
+	sampleEvery int
+	seen        map[string]int
+	entries     []Entry
+	next        int
+	full        bool
+}
+
+// New returns a Log which keeps the given number of entries.
+func New(size int) *Log {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Log{
+		thresholds:  map[string]time.Duration{},
+		sampleEvery: 1,
+		seen:        map[string]int{},
+		entries:     make([]Entry, size),
+	}
+}
+
+// SetThreshold sets how long operations of the kind can take before they are
+// recorded. A threshold of zero stops recording the kind.
+func (log *Log) SetThreshold(kind string, threshold time.Duration) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if threshold <= 0 {
+		delete(log.thresholds, kind)
+		return
+	}
+	log.thresholds[kind] = threshold
+}
+
+// SetSampling records one in every n slow operations of each kind.
+func (log *Log) SetSampling(n int) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if n < 1 {
+		n = 1
+	}
+	log.sampleEvery = n
+}
+
+// Enabled returns whether operations of the kind are being recorded, so that
+// callers can skip preparing entries which would be discarded.
+func (log *Log) Enabled(kind string) bool {
+	if log == nil {
+		return false
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	_, ok := log.thresholds[kind]
+	return ok
+}
+
+// Observe records the operation which started at the given time if it was
+// slow and is sampled. The timings break down where the time was spent.
+func (log *Log) Observe(kind, method, target string, params []byte, start time.Time, err error, timings ...Timing) {
+	if log == nil {
+		return
+	}
+	duration := time.Since(start)
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	threshold, ok := log.thresholds[kind]
+	if !ok || duration < threshold {
+		return
+	}
+	log.seen[kind]++
+	if (log.seen[kind]-1)%log.sampleEvery != 0 {
+		return
+	}
+
+	entry := Entry{
+		Kind:     kind,
+		Method:   method,
+		Target:   target,
+		Start:    start.Unix(),
+		Duration: duration.String(),
+		Timings:  timings,
+		duration: duration,
+	}
+	if params != nil {
+		digest := sha256.Sum256(params)
+		entry.ParamsDigest = hex.EncodeToString(digest[:])
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	log.entries[log.next] = entry
+	log.next = (log.next + 1) % len(log.entries)
+	log.full = log.full || log.next == 0
+}
+
+// Entries returns the recorded entries, most recent first.
+func (log *Log) Entries() []Entry {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	n := log.next
+	if log.full {
+		n = len(log.entries)
+	}
+	entries := make([]Entry, 0, n)
+	for i := 1; i <= n; i++ {
+		entries = append(entries, log.entries[(log.next-i+len(log.entries))%len(log.entries)])
+	}
+	return entries
+}
+
+// ServeHTTP implements the `http.Handler` interface. Entries can be filtered
+// by kind with the kind query parameter, and sorted by duration rather than
+// recency with `?sort=duration`.
+func (log *Log) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	entries := []Entry{}
+	for _, entry := range log.Entries() {
+		if kind == "" || entry.Kind == kind {
+			entries = append(entries, entry)
+		}
+	}
+	if r.URL.Query().Get("sort") == "duration" {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].duration > entries[j].duration })
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,119 @@
+package slowlog_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/slowlog"
+)
+
+var _ = Describe("Slow log", func() {
+	ago := func(d time.Duration) time.Time {
+		return time.Now().Add(-d)
+	}
+
+	It("should only record operations slower than the threshold of their kind", func() {
+		log := New(10)
+		log.SetThreshold(KindDB, time.Second)
+
+		log.Observe(KindDB, "Tx", "", []byte("hash"), ago(time.Millisecond), nil)
+		log.Observe(KindDarknode, "ren_queryTx", "127.0.0.1:18515", nil, ago(time.Minute), nil)
+		Expect(log.Entries()).To(BeEmpty())
+
+		log.Observe(KindDB, "Tx", "", []byte("hash"), ago(2*time.Second), errors.New("timeout"))
+		entries := log.Entries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Kind).To(Equal(KindDB))
+		Expect(entries[0].Method).To(Equal("Tx"))
+		Expect(entries[0].ParamsDigest).To(HaveLen(64))
+		Expect(entries[0].Error).To(Equal("timeout"))
+	})
+
+	It("should sample slow operations", func() {
+		log := New(10)
+		log.SetThreshold(KindDB, time.Millisecond)
+		log.SetSampling(3)
+
+		for i := 0; i < 7; i++ {
+			log.Observe(KindDB, "Tx", "", nil, ago(time.Second), nil)
+		}
+		Expect(log.Entries()).To(HaveLen(3))
+	})
+
+	It("should keep the most recent entries", func() {
+		log := New(3)
+		log.SetThreshold(KindDB, time.Millisecond)
+
+		for _, method := range []string{"A", "B", "C", "D", "E"} {
+			log.Observe(KindDB, method, "", nil, ago(time.Second), nil)
+		}
+		entries := log.Entries()
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[0].Method).To(Equal("E"))
+		Expect(entries[1].Method).To(Equal("D"))
+		Expect(entries[2].Method).To(Equal("C"))
+	})
+
+	It("should serve the entries filtered by kind", func() {
+		log := New(10)
+		log.SetThreshold(KindDB, time.Millisecond)
+		log.SetThreshold(KindDarknode, time.Millisecond)
+		log.Observe(KindDB, "Tx", "", nil, ago(time.Second), nil)
+		log.Observe(KindDarknode, "ren_queryTx", "127.0.0.1:18515", nil, ago(time.Second), nil, Timing{Phase: "wait", Duration: "1s"})
+
+		server := httptest.NewServer(log)
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "?kind=" + KindDarknode)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var entries []Entry
+		Expect(json.NewDecoder(resp.Body).Decode(&entries)).To(Succeed())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Target).To(Equal("127.0.0.1:18515"))
+		Expect(entries[0].Timings).To(Equal([]Timing{{Phase: "wait", Duration: "1s"}}))
+	})
+
+	It("should break down the phases of traced requests", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		}))
+		defer server.Close()
+
+		ctx, trace := NewTrace(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		phases := []string{}
+		for _, timing := range trace.Timings() {
+			phases = append(phases, timing.Phase)
+		}
+		Expect(phases).To(Equal([]string{"connect", "write", "wait", "read"}))
+	})
+
+	It("should keep the entries of each log separate", func() {
+		first, second := New(10), New(10)
+		first.SetThreshold(KindDB, time.Millisecond)
+
+		first.Observe(KindDB, "Tx", "", nil, ago(time.Second), nil)
+		second.Observe(KindDB, "Tx", "", nil, ago(time.Second), nil)
+		Expect(first.Entries()).To(HaveLen(1))
+		Expect(second.Entries()).To(BeEmpty())
+
+		// A nil log records nothing.
+		var log *Log
+		Expect(log.Enabled(KindDB)).To(BeFalse())
+		log.Observe(KindDB, "Tx", "", nil, ago(time.Second), nil)
+	})
+})
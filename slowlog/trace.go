@@ -0,0 +1,69 @@
+package slowlog
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// A Trace records when each phase of an HTTP request ended, so that the time
+// of a slow round trip can be broken down into getting a connection, writing
+// the request, waiting for the response and reading it.
+type Trace struct {
+	mu           sync.Mutex
+	start        time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// NewTrace returns a context which records the phases of HTTP requests made
+// with it into the returned trace.
+func NewTrace(ctx context.Context) (context.Context, *Trace) {
+	trace := &Trace{start: time.Now()}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			trace.mark(&trace.gotConn)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			trace.mark(&trace.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			trace.mark(&trace.firstByte)
+		},
+	}), trace
+}
+
+func (trace *Trace) mark(t *time.Time) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	*t = time.Now()
+}
+
+// Timings returns the duration of each phase which was reached. The last
+// phase ends now.
+func (trace *Trace) Timings() []Timing {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+
+	phases := []struct {
+		name string
+		end  time.Time
+	}{
+		{"connect", trace.gotConn},
+		{"write", trace.wroteRequest},
+		{"wait", trace.firstByte},
+		{"read", time.Now()},
+	}
+	timings := make([]Timing, 0, len(phases))
+	last := trace.start
+	for _, phase := range phases {
+		if phase.end.IsZero() {
+			continue
+		}
+		timings = append(timings, Timing{Phase: phase.name, Duration: phase.end.Sub(last).String()})
+		last = phase.end
+	}
+	return timings
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/aw/wire"
+	"github.com/sirupsen/logrus"
+)
+
+// blacklistKey is the Redis hash holding the blacklisted darknodes, so that
+// they are shared by all replicas and survive restarts.
+const blacklistKey = "darknode_blacklist"
+
+// blacklistRefresh is how often the blacklist is read from Redis in the
+// background. Changes made through this Blacklist are seen immediately,
+// whereas changes made by other replicas can take this long to be seen.
+const blacklistRefresh = 5 * time.Second
+
+// A BlacklistEntry is a darknode which is excluded from selection until it
+// expires.
+type BlacklistEntry struct {
+	ID        string `json:"id"`
+	Reason    string `json:"reason,omitempty"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// Blacklist temporarily excludes darknodes from the darknodes selected to
+// serve requests, for example a darknode which is known to be misbehaving
+// during an incident. It implements `http.Handler` to manage the blacklist.
+type Blacklist struct {
+	logger logrus.FieldLogger
+	client redis.Cmdable
+
+	mu      *sync.RWMutex
+	entries map[string]BlacklistEntry
+}
+
+// NewBlacklist returns a Blacklist stored in Redis.
+func NewBlacklist(logger logrus.FieldLogger, client redis.Cmdable) *Blacklist {
+	return &Blacklist{
+		logger:  logger,
+		client:  client,
+		mu:      new(sync.RWMutex),
+		entries: map[string]BlacklistEntry{},
+	}
+}
+
+// Add blacklists the darknode with the given ID for the given duration,
+// replacing any existing entry for it.
+func (blacklist *Blacklist) Add(darknodeID string, ttl time.Duration, reason string) (BlacklistEntry, error) {
+	if err := validateDarknodeID(darknodeID); err != nil {
+		return BlacklistEntry{}, err
+	}
+	if ttl <= 0 {
+		return BlacklistEntry{}, fmt.Errorf("ttl must be positive")
+	}
+	entry := BlacklistEntry{
+		ID:        darknodeID,
+		Reason:    reason,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return BlacklistEntry{}, err
+	}
+	if err := blacklist.client.HSet(blacklistKey, darknodeID, string(data)).Err(); err != nil {
+		return BlacklistEntry{}, err
+	}
+
+	blacklist.mu.Lock()
+	blacklist.entries[darknodeID] = entry
+	blacklist.mu.Unlock()
+	return entry, nil
+}
+
+// Remove removes the darknode with the given ID from the blacklist.
+func (blacklist *Blacklist) Remove(darknodeID string) error {
+	if err := blacklist.client.HDel(blacklistKey, darknodeID).Err(); err != nil {
+		return err
+	}
+
+	blacklist.mu.Lock()
+	delete(blacklist.entries, darknodeID)
+	blacklist.mu.Unlock()
+	return nil
+}
+
+// Entries returns the darknodes which are blacklisted, sorted by ID. It reads
+// the blacklist from Redis first, as it is only used to manage the blacklist.
+func (blacklist *Blacklist) Entries() []BlacklistEntry {
+	blacklist.Update()
+
+	blacklist.mu.RLock()
+	defer blacklist.mu.RUnlock()
+	now := time.Now().Unix()
+	entries := make([]BlacklistEntry, 0, len(blacklist.entries))
+	for _, entry := range blacklist.entries {
+		if entry.ExpiresAt > now {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Contains returns whether the darknode with the given ID is blacklisted. It
+// only reads the entries held in memory, so that selecting darknodes does not
+// wait on Redis.
+func (blacklist *Blacklist) Contains(darknodeID string) bool {
+	blacklist.mu.RLock()
+	defer blacklist.mu.RUnlock()
+	entry, ok := blacklist.entries[darknodeID]
+	return ok && entry.ExpiresAt > time.Now().Unix()
+}
+
+// Filter returns the addresses of the darknodes which are not blacklisted. If
+// all of them are blacklisted, the addresses are returned unchanged, as
+// requests would otherwise have nowhere to go.
+func (blacklist *Blacklist) Filter(addrs []wire.Address) []wire.Address {
+	filtered := make([]wire.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		signatory, err := addr.Signatory()
+		if err == nil && blacklist.Contains(signatory.String()) {
+			continue
+		}
+		filtered = append(filtered, addr)
+	}
+	if len(filtered) == 0 && len(addrs) > 0 {
+		blacklist.logger.Warnf("[blacklist] all %v candidate darknodes are blacklisted, ignoring the blacklist", len(addrs))
+		return addrs
+	}
+	return filtered
+}
+
+// Run reads the blacklist from Redis every blacklistRefresh until the context
+// is done.
+func (blacklist *Blacklist) Run(ctx context.Context) {
+	ticker := time.NewTicker(blacklistRefresh)
+	defer ticker.Stop()
+
+	for {
+		blacklist.Update()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update reads the blacklist from Redis, and removes the entries which have
+// expired. If it cannot be read, the entries held in memory are kept.
+func (blacklist *Blacklist) Update() {
+	values, err := blacklist.client.HGetAll(blacklistKey).Result()
+	if err != nil {
+		blacklist.logger.Warnf("[blacklist] cannot read blacklist: %v", err)
+		return
+	}
+	now := time.Now().Unix()
+	entries := make(map[string]BlacklistEntry, len(values))
+	expired := []string{}
+	for darknodeID, value := range values {
+		var entry BlacklistEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil || entry.ExpiresAt <= now {
+			expired = append(expired, darknodeID)
+			continue
+		}
+		entries[darknodeID] = entry
+	}
+	if len(expired) > 0 {
+		if err := blacklist.client.HDel(blacklistKey, expired...).Err(); err != nil {
+			blacklist.logger.Warnf("[blacklist] cannot remove expired entries: %v", err)
+		}
+	}
+
+	blacklist.mu.Lock()
+	blacklist.entries = entries
+	blacklist.mu.Unlock()
+}
+
+// ServeHTTP implements the `http.Handler` interface. GET lists the blacklisted
+// darknodes, POST blacklists the darknode given by the id, ttl (e.g. "30m")
+// and reason parameters, and DELETE removes the darknode given by the id
+// parameter.
+func (blacklist *Blacklist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		ttl, err := time.ParseDuration(query.Get("ttl"))
+		if err != nil {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+		entry, err := blacklist.Add(query.Get("id"), ttl, query.Get("reason"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot blacklist darknode: %v", err), http.StatusBadRequest)
+			return
+		}
+		blacklist.logger.Infof("[blacklist] blacklisted %v until %v: %v", entry.ID, time.Unix(entry.ExpiresAt, 0).UTC(), entry.Reason)
+	case http.MethodDelete:
+		if err := blacklist.Remove(query.Get("id")); err != nil {
+			blacklist.logger.Errorf("[blacklist] cannot remove %v: %v", query.Get("id"), err)
+			http.Error(w, "cannot remove darknode", http.StatusInternalServerError)
+			return
+		}
+		blacklist.logger.Infof("[blacklist] removed %v", query.Get("id"))
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blacklist.Entries())
+}
+
+// validateDarknodeID checks that the ID is the signatory of a darknode, as
+// used to key the store.
+func validateDarknodeID(darknodeID string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(darknodeID)
+	if err != nil || len(decoded) != 32 {
+		return fmt.Errorf("invalid darknode id %q", darknodeID)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package store_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/store"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
+	"github.com/renproject/kv"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Blacklist", func() {
+	init := func() (*Blacklist, *miniredis.Miniredis, []wire.Address) {
+		mr, err := miniredis.Run()
+		Expect(err).NotTo(HaveOccurred())
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+		addrs := make([]wire.Address, 3)
+		for i := range addrs {
+			addrs[i] = wire.NewUnsignedAddress(wire.TCP, "127.0.0.1:18515", uint64(i))
+			Expect(addrs[i].Sign(id.NewPrivKey())).To(Succeed())
+		}
+		return NewBlacklist(logrus.New(), client), mr, addrs
+	}
+
+	signatory := func(addr wire.Address) string {
+		signatory, err := addr.Signatory()
+		Expect(err).NotTo(HaveOccurred())
+		return signatory.String()
+	}
+
+	It("should exclude blacklisted darknodes until they expire", func() {
+		blacklist, mr, addrs := init()
+		defer mr.Close()
+		multiStore := New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), addrs).WithBlacklist(blacklist)
+
+		_, err := blacklist.Add(signatory(addrs[0]), time.Second, "incident")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blacklist.Contains(signatory(addrs[0]))).To(BeTrue())
+
+		for i := 0; i < 10; i++ {
+			selected, err := multiStore.RandomBootstrapAddrs(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selected).To(ConsistOf(addrs[1], addrs[2]))
+		}
+		all, err := multiStore.AddrsAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(2))
+
+		// Blacklisted darknodes can still be requested explicitly.
+		addr, err := multiStore.Get(signatory(addrs[0]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr).To(Equal(addrs[0]))
+
+		time.Sleep(time.Second)
+		Expect(blacklist.Contains(signatory(addrs[0]))).To(BeFalse())
+		selected, err := multiStore.BootstrapAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(HaveLen(3))
+	})
+
+	It("should ignore the blacklist if every darknode is blacklisted", func() {
+		blacklist, mr, addrs := init()
+		defer mr.Close()
+
+		for _, addr := range addrs {
+			_, err := blacklist.Add(signatory(addr), time.Minute, "")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(blacklist.Filter(addrs)).To(Equal(addrs))
+	})
+
+	It("should share the blacklist between instances", func() {
+		blacklist, mr, addrs := init()
+		defer mr.Close()
+
+		_, err := blacklist.Add(signatory(addrs[0]), time.Minute, "incident")
+		Expect(err).NotTo(HaveOccurred())
+
+		other := NewBlacklist(logrus.New(), redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		entries := other.Entries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].ID).To(Equal(signatory(addrs[0])))
+		Expect(entries[0].Reason).To(Equal("incident"))
+	})
+
+	It("should check darknodes against the entries held in memory", func() {
+		blacklist, mr, addrs := init()
+		defer mr.Close()
+
+		other := NewBlacklist(logrus.New(), redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		_, err := other.Add(signatory(addrs[0]), time.Minute, "incident")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Entries added by other instances are seen once the blacklist has
+		// been updated, after which Redis is no longer needed.
+		Expect(blacklist.Contains(signatory(addrs[0]))).To(BeFalse())
+		blacklist.Update()
+		mr.Close()
+		Expect(blacklist.Contains(signatory(addrs[0]))).To(BeTrue())
+		Expect(blacklist.Filter(addrs)).To(ConsistOf(addrs[1], addrs[2]))
+	})
+
+	It("should manage the blacklist over http", func() {
+		blacklist, mr, addrs := init()
+		defer mr.Close()
+		darknodeID := signatory(addrs[0])
+
+		w := httptest.NewRecorder()
+		blacklist.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/blacklist?id="+darknodeID+"&ttl=30m&reason=stuck", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(blacklist.Contains(darknodeID)).To(BeTrue())
+
+		w = httptest.NewRecorder()
+		blacklist.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/blacklist?id=unknown&ttl=30m", nil))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+		w = httptest.NewRecorder()
+		blacklist.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/blacklist?id="+darknodeID+"&ttl=-1m", nil))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+
+		w = httptest.NewRecorder()
+		blacklist.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/blacklist?id="+darknodeID, nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON("[]"))
+		Expect(blacklist.Contains(darknodeID)).To(BeFalse())
+	})
+})
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/renproject/aw/wire"
+)
+
+// peerScoreWeight is the weight of the latest observation of a darknode in its
+// score and round trip time, which are moving averages so that a single slow
+// or failed request does not mark a darknode as unhealthy.
+const peerScoreWeight = 0.3
+
+// HealthyPeerScore is the score above which a darknode is healthy.
+const HealthyPeerScore = 0.5
+
+// PeerInfo is the health of a darknode, as observed by the Lightnode. The score
+// is the moving average of whether the darknode responded, between zero and
+// one. Failures is the number of requests the darknode has failed in a row.
+type PeerInfo struct {
+	ID        string  `json:"id"`
+	Address   string  `json:"address"`
+	Bootstrap bool    `json:"bootstrap"`
+	Score     float64 `json:"score"`
+	RTT       int64   `json:"rttMs"`
+	Failures  int     `json:"failures"`
+	LastSeen  int64   `json:"lastSeen,omitempty"`
+
+	// rtt is the moving average of the round trip time, which is reported in
+	// milliseconds.
+	rtt time.Duration
+}
+
+// PeerTable keeps track of the health of the darknodes queried by the
+// Lightnode, so that unreachable darknodes can be evicted from the store, and
+// so that operators can see which darknodes the Lightnode is talking to.
+type PeerTable struct {
+	mu    *sync.Mutex
+	peers map[string]*PeerInfo
+}
+
+// NewPeerTable returns an empty PeerTable.
+func NewPeerTable() *PeerTable {
+	return &PeerTable{
+		mu:    new(sync.Mutex),
+		peers: map[string]*PeerInfo{},
+	}
+}
+
+// Success records that the darknode responded after the given round trip time.
+func (table *PeerTable) Success(addr wire.Address, rtt time.Duration, bootstrap bool) {
+	table.observe(addr, bootstrap, func(peer *PeerInfo, first bool) {
+		if first {
+			peer.Score, peer.rtt = 1, rtt
+		} else {
+			peer.Score = (1-peerScoreWeight)*peer.Score + peerScoreWeight
+			peer.rtt = time.Duration((1-peerScoreWeight)*float64(peer.rtt) + peerScoreWeight*float64(rtt))
+		}
+		peer.RTT = peer.rtt.Milliseconds()
+		peer.Failures = 0
+		peer.LastSeen = time.Now().Unix()
+	})
+}
+
+// Failure records that the darknode did not respond, and returns the number of
+// requests it has failed in a row.
+func (table *PeerTable) Failure(addr wire.Address, bootstrap bool) int {
+	failures := 0
+	table.observe(addr, bootstrap, func(peer *PeerInfo, first bool) {
+		peer.Score = (1 - peerScoreWeight) * peer.Score
+		peer.Failures++
+		failures = peer.Failures
+	})
+	return failures
+}
+
+// Remove stops tracking the darknode.
+func (table *PeerTable) Remove(addr wire.Address) {
+	signatory, err := addr.Signatory()
+	if err != nil {
+		return
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	delete(table.peers, signatory.String())
+}
+
+// Healthy returns whether the darknode is healthy. Darknodes which have not
+// been queried yet are not healthy.
+func (table *PeerTable) Healthy(addr wire.Address) bool {
+	signatory, err := addr.Signatory()
+	if err != nil {
+		return false
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	peer, ok := table.peers[signatory.String()]
+	return ok && peer.Score >= HealthyPeerScore
+}
+
+// SortByHealth moves the darknodes which are known to be unhealthy to the end
+// of the addresses, keeping the order of the others, so that requests are only
+// sent to unhealthy darknodes when there are not enough other darknodes.
+// Darknodes which have not been queried yet are not moved, so that new
+// darknodes are still used. A nil table leaves the addresses as they are.
+func (table *PeerTable) SortByHealth(addrs []wire.Address) {
+	if table == nil {
+		return
+	}
+
+	table.mu.Lock()
+	unhealthy := map[string]bool{}
+	for _, addr := range addrs {
+		signatory, err := addr.Signatory()
+		if err != nil {
+			continue
+		}
+		if peer, ok := table.peers[signatory.String()]; ok && peer.Score < HealthyPeerScore {
+			unhealthy[addr.Value] = true
+		}
+	}
+	table.mu.Unlock()
+
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return !unhealthy[addrs[i].Value] && unhealthy[addrs[j].Value]
+	})
+}
+
+// Peers returns the darknodes in the table, healthiest first.
+func (table *PeerTable) Peers() []PeerInfo {
+	table.mu.Lock()
+	peers := make([]PeerInfo, 0, len(table.peers))
+	for _, peer := range table.peers {
+		peers = append(peers, *peer)
+	}
+	table.mu.Unlock()
+
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Score != peers[j].Score {
+			return peers[i].Score > peers[j].Score
+		}
+		if peers[i].rtt != peers[j].rtt {
+			return peers[i].rtt < peers[j].rtt
+		}
+		return peers[i].ID < peers[j].ID
+	})
+	return peers
+}
+
+// ServeHTTP implements the `http.Handler` interface. GET lists the darknodes
+// in the table, healthiest first.
+func (table *PeerTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(table.Peers())
+}
+
+// observe updates the darknode, adding it to the table if it is not already
+// tracked. Addresses without a valid signatory are ignored.
+func (table *PeerTable) observe(addr wire.Address, bootstrap bool, update func(peer *PeerInfo, first bool)) {
+	signatory, err := addr.Signatory()
+	if err != nil {
+		return
+	}
+	id := signatory.String()
+
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	peer, ok := table.peers[id]
+	if !ok {
+		peer = &PeerInfo{ID: id}
+		table.peers[id] = peer
+	}
+	peer.Address = addr.String()
+	peer.Bootstrap = bootstrap
+	update(peer, !ok)
+}
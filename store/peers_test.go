@@ -0,0 +1,80 @@
+package store_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/store"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
+)
+
+var _ = Describe("Peer table", func() {
+	newAddress := func(value string) wire.Address {
+		addr := wire.NewUnsignedAddress(wire.TCP, value, uint64(time.Now().Unix()))
+		Expect(addr.Sign(id.NewPrivKey())).To(Succeed())
+		return addr
+	}
+
+	It("should score darknodes by whether they respond", func() {
+		table := NewPeerTable()
+		fast, slow := newAddress("127.0.0.1:18514"), newAddress("127.0.0.2:18514")
+		Expect(table.Healthy(fast)).To(BeFalse())
+
+		table.Success(fast, 10*time.Millisecond, true)
+		table.Success(slow, 200*time.Millisecond, false)
+		Expect(table.Healthy(fast)).To(BeTrue())
+		peers := table.Peers()
+		Expect(peers).To(HaveLen(2))
+		Expect(peers[0].Address).To(Equal(fast.String()))
+		Expect(peers[0].Bootstrap).To(BeTrue())
+		Expect(peers[0].RTT).To(Equal(int64(10)))
+
+		// A single failure lowers the score, but the darknode is only
+		// unhealthy once it keeps failing.
+		Expect(table.Failure(fast, true)).To(Equal(1))
+		Expect(table.Healthy(fast)).To(BeTrue())
+		Expect(table.Peers()[0].Address).To(Equal(slow.String()))
+		Expect(table.Failure(fast, true)).To(Equal(2))
+		Expect(table.Healthy(fast)).To(BeFalse())
+
+		table.Success(fast, 10*time.Millisecond, true)
+		Expect(table.Peers()[1].Failures).To(Equal(0))
+
+		table.Remove(slow)
+		Expect(table.Peers()).To(HaveLen(1))
+	})
+
+	It("should prefer darknodes which are not known to be unhealthy", func() {
+		table := NewPeerTable()
+		healthy, unhealthy, unknown := newAddress("127.0.0.1:18514"), newAddress("127.0.0.2:18514"), newAddress("127.0.0.3:18514")
+		table.Success(healthy, 10*time.Millisecond, true)
+		table.Failure(unhealthy, true)
+
+		addrs := []wire.Address{unhealthy, unknown, healthy}
+		table.SortByHealth(addrs)
+		Expect(addrs).To(Equal([]wire.Address{unknown, healthy, unhealthy}))
+
+		// The store only returns unhealthy darknodes if there are not
+		// enough others.
+		multiStore := NewInMemory([]wire.Address{unhealthy, healthy}).WithPeerTable(table)
+		for i := 0; i < 10; i++ {
+			addrs, err := multiStore.RandomBootstrapAddrs(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(Equal([]wire.Address{healthy}))
+			addrs, err = multiStore.RandomAddrs(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(HaveLen(1))
+			Expect(addrs[0].String()).To(Equal(healthy.String()))
+		}
+		addrs, err := multiStore.RandomBootstrapAddrs(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addrs).To(Equal([]wire.Address{healthy, unhealthy}))
+
+		var noTable *PeerTable
+		noTable.SortByHealth(addrs)
+		Expect(addrs).To(Equal([]wire.Address{healthy, unhealthy}))
+	})
+})
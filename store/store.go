@@ -5,13 +5,18 @@ import (
 	"math/rand"
 
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/kv"
 	"github.com/renproject/kv/db"
 )
 
-// MultiAddrStore is a store of `wire.Address`es.
+// MultiAddrStore is a store of `wire.Address`es. Darknodes which are
+// blacklisted are excluded from the addresses it returns, but can still be
+// retrieved individually.
 type MultiAddrStore struct {
 	store          db.Table
 	bootstrapAddrs []wire.Address
+	blacklist      *Blacklist
+	peers          *PeerTable
 }
 
 // New constructs a new `MultiAddrStore`.
@@ -29,6 +34,32 @@ func New(store db.Table, bootstrapAddrs []wire.Address) MultiAddrStore {
 	return multiStore
 }
 
+// NewInMemory constructs a new `MultiAddrStore` which keeps the addresses in
+// memory, starting with the given bootstrap addresses.
+func NewInMemory(bootstrapAddrs []wire.Address) MultiAddrStore {
+	return New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), bootstrapAddrs)
+}
+
+// WithBlacklist returns the store with darknodes in the given blacklist
+// excluded from the addresses it returns.
+func (multiStore MultiAddrStore) WithBlacklist(blacklist *Blacklist) MultiAddrStore {
+	multiStore.blacklist = blacklist
+	return multiStore
+}
+
+// WithPeerTable returns the store with the given table tracking the health of
+// its darknodes.
+func (multiStore MultiAddrStore) WithPeerTable(peers *PeerTable) MultiAddrStore {
+	multiStore.peers = peers
+	return multiStore
+}
+
+// PeerTable returns the table tracking the health of the darknodes in the
+// store, or nil if their health is not tracked.
+func (multiStore *MultiAddrStore) PeerTable() *PeerTable {
+	return multiStore.peers
+}
+
 // Get retrieves a multi-address from the store.
 func (multiStore *MultiAddrStore) Get(id string) (wire.Address, error) {
 	var addrString string
@@ -78,32 +109,45 @@ func (multiStore *MultiAddrStore) AddrsAll() ([]wire.Address, error) {
 		}
 		addrs = append(addrs, address)
 	}
-	return addrs, nil
+	return multiStore.filter(addrs), nil
 }
 
 // BootstrapAll returns the multi-addresses of all of the Bootstrap nodes.
 func (multiStore *MultiAddrStore) BootstrapAll() ([]wire.Address, error) {
-	return multiStore.bootstrapAddrs, nil
+	return multiStore.filter(multiStore.bootstrapAddrs), nil
 }
 
 // RandomBootstrapAddrs returns a random number of Bootstrap multi-addresses in
-// the store.
+// the store. Bootstrap nodes which are known to be unhealthy are only returned
+// if there are not enough others.
 func (multiStore *MultiAddrStore) RandomBootstrapAddrs(n int) ([]wire.Address, error) {
-	if n > len(multiStore.bootstrapAddrs) {
-		n = len(multiStore.bootstrapAddrs)
+	bootstrapAddrs := multiStore.filter(multiStore.bootstrapAddrs)
+	if n > len(bootstrapAddrs) {
+		n = len(bootstrapAddrs)
 	}
-	indexes := rand.Perm(n)
+	indexes := rand.Perm(len(bootstrapAddrs))
 
-	addrs := make([]wire.Address, 0, n)
+	addrs := make([]wire.Address, 0, len(bootstrapAddrs))
 
 	for _, index := range indexes {
-		addrs = append(addrs, multiStore.bootstrapAddrs[index])
+		addrs = append(addrs, bootstrapAddrs[index])
 	}
+	multiStore.peers.SortByHealth(addrs)
 
-	return addrs, nil
+	return addrs[:n], nil
+}
+
+// filter removes blacklisted darknodes from the addresses.
+func (multiStore *MultiAddrStore) filter(addrs []wire.Address) []wire.Address {
+	if multiStore.blacklist == nil {
+		return addrs
+	}
+	return multiStore.blacklist.Filter(addrs)
 }
 
 // RandomAddrs returns a random number of multi-addresses in the store.
+// Darknodes which are known to be unhealthy are only returned if there are not
+// enough others.
 func (multiStore *MultiAddrStore) RandomAddrs(n int) ([]wire.Address, error) {
 	addrs, err := multiStore.AddrsAll()
 	if err != nil {
@@ -112,6 +156,7 @@ func (multiStore *MultiAddrStore) RandomAddrs(n int) ([]wire.Address, error) {
 	rand.Shuffle(len(addrs), func(i, j int) {
 		addrs[i], addrs[j] = addrs[j], addrs[i]
 	})
+	multiStore.peers.SortByHealth(addrs)
 
 	if len(addrs) < n {
 		return addrs, nil
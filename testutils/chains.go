@@ -0,0 +1,143 @@
+package testutils
+
+import (
+	"context"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/renproject/darknode/binding"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/api/address"
+	"github.com/renproject/pack"
+)
+
+// chainFixtures contains the chain state referenced by the mock v0 txs.
+//
+//go:embed fixtures/chains.json
+var chainFixtures []byte
+
+type chainFixtureFile struct {
+	UTXOs []struct {
+		Chain  multichain.Chain `json:"chain"`
+		Txid   string           `json:"txid"`
+		Index  uint32           `json:"index"`
+		Amount string           `json:"amount"`
+	} `json:"utxos"`
+	Burns []struct {
+		Asset   multichain.Asset `json:"asset"`
+		Ref     string           `json:"ref"`
+		Txid    string           `json:"txid"`
+		Amount  string           `json:"amount"`
+		To      string           `json:"to"`
+		Payload string           `json:"payload"`
+	} `json:"burns"`
+}
+
+// MockChainReader is a v0.ChainReader which serves chain state from fixtures,
+// so that tests do not depend on live nodes.
+type MockChainReader struct {
+	utxos map[string]pack.U256
+	burns map[string]v0.Burn
+}
+
+// NewMockChainReader returns a MockChainReader with the chain state from the
+// fixtures.
+func NewMockChainReader() *MockChainReader {
+	var fixtures chainFixtureFile
+	if err := json.Unmarshal(chainFixtures, &fixtures); err != nil {
+		panic(fmt.Sprintf("invalid chain fixtures: %v", err))
+	}
+
+	reader := &MockChainReader{
+		utxos: map[string]pack.U256{},
+		burns: map[string]v0.Burn{},
+	}
+	for _, utxo := range fixtures.UTXOs {
+		txid := mustDecodeHex(utxo.Txid)
+		reader.utxos[utxoKey(utxo.Chain, txid, utxo.Index)] = pack.NewU256FromInt(mustParseInt(utxo.Amount))
+	}
+	for _, burn := range fixtures.Burns {
+		reader.burns[burnKey(burn.Asset, mustParseInt(burn.Ref))] = v0.Burn{
+			Txid:    mustDecodeHex(burn.Txid),
+			Amount:  mustParseInt(burn.Amount),
+			To:      []byte(burn.To),
+			Payload: mustDecodeHex(burn.Payload),
+		}
+	}
+	return reader
+}
+
+// UTXOAmount implements the v0.ChainReader interface.
+func (reader *MockChainReader) UTXOAmount(ctx context.Context, chain multichain.Chain, outpoint multichain.UTXOutpoint) (pack.U256, error) {
+	amount, ok := reader.utxos[utxoKey(chain, outpoint.Hash, uint32(outpoint.Index))]
+	if !ok {
+		return pack.U256{}, fmt.Errorf("no fixture for %v output %x:%v", chain, []byte(outpoint.Hash), outpoint.Index)
+	}
+	return amount, nil
+}
+
+// EthereumBurn implements the v0.ChainReader interface.
+func (reader *MockChainReader) EthereumBurn(ctx context.Context, asset multichain.Asset, ref *big.Int) (v0.Burn, error) {
+	burn, ok := reader.burns[burnKey(asset, ref)]
+	if !ok {
+		return v0.Burn{}, fmt.Errorf("no fixture for %v burn with ref=%v", asset, ref)
+	}
+	return burn, nil
+}
+
+// Bindings returns bindings which are consistent with the fixtures, so that
+// txs converted using the reader can be verified.
+func (reader *MockChainReader) Bindings() *binding.Callbacks {
+	return &binding.Callbacks{
+		HandleAccountBurnInfo: func(ctx context.Context, chain multichain.Chain, asset multichain.Asset, nonce pack.Bytes32) (pack.U256, pack.String, pack.Bytes, error) {
+			burn, err := reader.EthereumBurn(ctx, asset, new(big.Int).SetBytes(nonce[:]))
+			if err != nil {
+				return pack.U256{}, "", nil, err
+			}
+			return pack.NewU256FromInt(burn.Amount), pack.String(burn.To), burn.Payload, nil
+		},
+		HandleTokenAddressFromAsset: func(chain multichain.Chain, asset multichain.Asset) (address.RawAddress, error) {
+			token, ok := v0TokenAddresses[asset]
+			if !ok {
+				return nil, fmt.Errorf("no token for %v", asset)
+			}
+			return address.RawAddress(mustDecodeHex(token)), nil
+		},
+	}
+}
+
+// v0TokenAddresses are the addresses of the v0 tokens of the legacy assets on
+// Ethereum.
+var v0TokenAddresses = map[multichain.Asset]string{
+	multichain.BTC: "581347fc652f9FCdbCA8372A4f65404C4154e93b",
+	multichain.ZEC: "6f35D542f3E0886281fb6152010fb52aC6B931F6",
+	multichain.BCH: "148234809A551c131951bD01640494eecB905b08",
+}
+
+func utxoKey(chain multichain.Chain, txid []byte, index uint32) string {
+	return fmt.Sprintf("%v_%x_%v", chain, txid, index)
+}
+
+func burnKey(asset multichain.Asset, ref *big.Int) string {
+	return fmt.Sprintf("%v_%v", asset, ref)
+}
+
+func mustDecodeHex(str string) []byte {
+	data, err := hex.DecodeString(str)
+	if err != nil {
+		panic(fmt.Sprintf("invalid hex %v: %v", str, err))
+	}
+	return data
+}
+
+func mustParseInt(str string) *big.Int {
+	value, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		panic(fmt.Sprintf("invalid integer %v", str))
+	}
+	return value
+}
@@ -0,0 +1,164 @@
+package testutils
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+
+	"github.com/btcsuite/btcutil"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/chain/bitcoincash"
+	"github.com/renproject/multichain/chain/zcash"
+	"github.com/renproject/pack"
+)
+
+// Seeds used to generate v0 params with deterministic hashes.
+const (
+	V0MockSeed    = int64(1)
+	V0MockSeedAlt = int64(2)
+)
+
+const (
+	v0MockMintABI      = "W3siY29uc3RhbnQiOmZhbHNlLCJpbnB1dHMiOlt7InR5cGUiOiJzdHJpbmciLCJuYW1lIjoiX3N5bWJvbCJ9LHsidHlwZSI6ImFkZHJlc3MiLCJuYW1lIjoiX2FkZHJlc3MifSx7Im5hbWUiOiJfYW1vdW50IiwidHlwZSI6InVpbnQyNTYifSx7Im5hbWUiOiJfbkhhc2giLCJ0eXBlIjoiYnl0ZXMzMiJ9LHsibmFtZSI6Il9zaWciLCJ0eXBlIjoiYnl0ZXMifV0sIm91dHB1dHMiOltdLCJwYXlhYmxlIjp0cnVlLCJzdGF0ZU11dGFiaWxpdHkiOiJwYXlhYmxlIiwidHlwZSI6ImZ1bmN0aW9uIiwibmFtZSI6Im1pbnQifV0="
+	v0MockMintFn       = "bWludA=="
+	v0MockRecipient    = "6fA045D176CE69Fdf9837242E8A72e81c2750E64"
+	v0MockPayloadOwner = "ea8b2ff0d7f546afaeae1771306736357defa434"
+)
+
+// LegacyAssets are the assets which were supported by v0 of the RenVM API.
+var LegacyAssets = []multichain.Asset{multichain.BTC, multichain.ZEC, multichain.BCH}
+
+// MockParamSubmitTxV0Mint returns the params for a v0 mint of the given legacy
+// asset to Ethereum. The nonce, UTXO and amount are derived from the seed, so
+// the same seed always produces the same transaction (and therefore the same
+// hashes). The UTXO is added to the reader, so that the mint can be converted.
+func MockParamSubmitTxV0Mint(reader *MockChainReader, asset multichain.Asset, seed int64) v0.ParamsSubmitTx {
+	token, ok := v0TokenAddresses[asset]
+	if !ok {
+		panic(fmt.Sprintf("unsupported legacy asset %v", asset))
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	nonce := [32]byte{}
+	r.Read(nonce[:])
+	txid := [32]byte{}
+	r.Read(txid[:])
+	vout := uint32(r.Intn(4))
+	amount := v0MockAmount(r)
+
+	// The v0 API takes the hash of the UTXO in the byte order in which it is
+	// displayed, which is the reverse of the txid.
+	utxoHash := [32]byte{}
+	for i := range txid {
+		utxoHash[i] = txid[len(txid)-1-i]
+	}
+	reader.utxos[utxoKey(asset.OriginChain(), txid[:], vout)] = pack.NewU256FromInt(amount)
+
+	jsonStr := fmt.Sprintf(`{"tx":{"to":"%v","in":[{"name":"p","type":"ext_ethCompatPayload","value":{"abi":"%v","value":"%v","fn":"%v"}},{"name":"token","type":"ext_ethCompatAddress","value":"%v"},{"name":"to","type":"ext_ethCompatAddress","value":"%v"},{"name":"n","type":"b32","value":"%v"},{"name":"utxo","type":"ext_btcCompatUTXO","value":{"txHash":"%v","vOut":"%v"}}]},"tags":[]}`,
+		v0Contract(asset, true),
+		v0MockMintABI,
+		base64.StdEncoding.EncodeToString(v0MintPayloadValue(asset)),
+		v0MockMintFn,
+		token,
+		v0MockRecipient,
+		base64.StdEncoding.EncodeToString(nonce[:]),
+		base64.StdEncoding.EncodeToString(utxoHash[:]),
+		vout,
+	)
+	return unmarshalV0Params(jsonStr)
+}
+
+// MockParamSubmitTxV0Burn returns the params for a v0 burn of the given legacy
+// asset from Ethereum. The burn reference, amount and recipient are derived
+// from the seed, and the burn is added to the reader, so that it can be
+// converted and verified. The recipient is a pay-to-pubkey-hash address on the
+// testnet of the origin chain of the asset.
+func MockParamSubmitTxV0Burn(reader *MockChainReader, asset multichain.Asset, seed int64) v0.ParamsSubmitTx {
+	if _, ok := v0TokenAddresses[asset]; !ok {
+		panic(fmt.Sprintf("unsupported legacy asset %v", asset))
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	ref := big.NewInt(r.Int63n(1000000) + 1)
+	txid := make([]byte, 32)
+	r.Read(txid)
+	pubKeyHash := make([]byte, 20)
+	r.Read(pubKeyHash)
+	reader.burns[burnKey(asset, ref)] = v0.Burn{
+		Txid:    txid,
+		Amount:  v0MockAmount(r),
+		To:      []byte(v0MockBurnRecipient(asset, pubKeyHash)),
+		Payload: []byte{},
+	}
+
+	jsonStr := fmt.Sprintf(`{"tx":{"to":"%v","in":[{"name":"ref","type":"u64","value":"%v"}]},"tags":[]}`, v0Contract(asset, false), ref)
+	return unmarshalV0Params(jsonStr)
+}
+
+// v0MockAmount returns an amount between 0.0001 and 1 of the asset, in its
+// smallest unit.
+func v0MockAmount(r *rand.Rand) *big.Int {
+	return big.NewInt(10000 + r.Int63n(100000000-10000))
+}
+
+// v0MockBurnRecipient returns the testnet pay-to-pubkey-hash address of the
+// origin chain of the asset for the given pubkey hash.
+func v0MockBurnRecipient(asset multichain.Asset, pubKeyHash []byte) string {
+	chain := asset.OriginChain()
+	var addr interface{ EncodeAddress() string }
+	var err error
+	switch chain {
+	case multichain.Bitcoin:
+		addr, err = btcutil.NewAddressPubKeyHash(pubKeyHash, v0.NetParams(chain, multichain.NetworkTestnet))
+	case multichain.BitcoinCash:
+		addr, err = bitcoincash.NewAddressPubKeyHash(pubKeyHash, v0.NetParams(chain, multichain.NetworkTestnet))
+	case multichain.Zcash:
+		addr, err = zcash.NewAddressPubKeyHash(pubKeyHash, v0.ZcashNetParams(multichain.NetworkTestnet))
+	default:
+		panic(fmt.Sprintf("unsupported legacy chain %v", chain))
+	}
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode %v address: %v", chain, err))
+	}
+	return addr.EncodeAddress()
+}
+
+// v0Contract returns the name of the v0 contract for minting or burning the
+// asset, e.g. "ZEC0Zec2Eth" or "ZEC0Eth2Zec".
+func v0Contract(asset multichain.Asset, mint bool) string {
+	name := string(asset)
+	title := name[:1] + strings.ToLower(name[1:])
+	if mint {
+		return fmt.Sprintf("%v0%v2Eth", name, title)
+	}
+	return fmt.Sprintf("%v0Eth2%v", name, title)
+}
+
+// v0MintPayloadValue ABI encodes the (symbol, address) arguments used by the
+// mock mint payloads.
+func v0MintPayloadValue(asset multichain.Asset) []byte {
+	owner, err := hex.DecodeString(v0MockPayloadOwner)
+	if err != nil {
+		panic(fmt.Sprintf("failed to decode payload owner: %v", err))
+	}
+
+	value := make([]byte, 128)
+	value[31] = 0x40
+	copy(value[64-len(owner):64], owner)
+	value[95] = byte(len(asset))
+	copy(value[96:], []byte(asset))
+	return value
+}
+
+func unmarshalV0Params(jsonStr string) v0.ParamsSubmitTx {
+	var params v0.ParamsSubmitTx
+	if err := json.Unmarshal([]byte(jsonStr), &params); err != nil {
+		panic(fmt.Sprintf("failed to unmarshal params %v: %v", jsonStr, err))
+	}
+	return params
+}
@@ -0,0 +1,263 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/db"
+	lerrors "github.com/renproject/lightnode/errors"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/phi"
+)
+
+// Enumerate default options of the recovery of stuck burns.
+const (
+	DefaultRecoveryDowntime      = 15 * time.Minute
+	DefaultRecoveryMinAge        = 10 * time.Minute
+	DefaultRecoveryBatchSize     = 50
+	DefaultRecoveryBatchInterval = 5 * time.Second
+)
+
+// recoveryTimeout is how long the recovery waits for the response to a single
+// request before counting the burn as failed.
+const recoveryTimeout = time.Minute
+
+// RecoveryConf configures the recovery of stuck burns.
+type RecoveryConf struct {
+	// Downtime is how long the block height of the Darknodes must stall for
+	// before a recovery is started once it advances again.
+	Downtime time.Duration
+
+	// MinAge is how old burns must be to be recovered. Younger burns are
+	// still being polled by their clients.
+	MinAge time.Duration
+
+	// Burns are recovered BatchSize at a time, waiting BatchInterval between
+	// batches so that the Darknodes are not flooded as they recover.
+	BatchSize     int
+	BatchInterval time.Duration
+}
+
+// RecoveryProgress reports the progress of the latest recovery.
+type RecoveryProgress struct {
+	Running  bool      `json:"running"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	// Total is the number of burns found to recover so far, of which Queried
+	// have been queried. Of these, Done have been released, Executing are still
+	// being executed, Resubmitted were unknown to the Darknodes and have been
+	// submitted again, and Failed could not be queried or resubmitted.
+	Total       int `json:"total"`
+	Queried     int `json:"queried"`
+	Done        int `json:"done"`
+	Executing   int `json:"executing"`
+	Resubmitted int `json:"resubmitted"`
+	Failed      int `json:"failed"`
+}
+
+// Recovery re-queries burns which were submitted before an outage of the
+// Darknodes but have not been released, once the Darknodes are back. The
+// oldest burns are queried first, in batches, so that their releases are
+// cached and persisted without waiting for clients to poll for them. Burns
+// which the Darknodes no longer know about are submitted again. It implements
+// `http.Handler` to report the progress of the latest recovery as JSON.
+type Recovery struct {
+	logger   logging.Logger
+	sender   phi.Sender
+	database db.DB
+	conf     RecoveryConf
+
+	clock       clock.Clock
+	mu          *sync.Mutex
+	lastHeight  uint64
+	lastAdvance time.Time
+	progress    RecoveryProgress
+}
+
+// NewRecovery returns a Recovery which sends requests to the Darknodes
+// through the given sender, such as the cacher, so that the responses are
+// cached like those to clients.
+func NewRecovery(logger logging.Logger, sender phi.Sender, database db.DB, conf RecoveryConf) *Recovery {
+	return &Recovery{
+		logger:   logger,
+		sender:   sender,
+		database: database,
+		conf:     conf,
+		clock:    clock.New(),
+		mu:       new(sync.Mutex),
+	}
+}
+
+// WithClock measures the downtime of the Darknodes and spaces out batches with
+// the given clock, such as a mock clock which tests advance instead of
+// waiting.
+func (recovery *Recovery) WithClock(clock clock.Clock) *Recovery {
+	recovery.clock = clock
+	return recovery
+}
+
+// ObserveHeight records the block height of the Darknodes. It returns whether
+// the height has advanced after stalling for at least the downtime, in which
+// case burns should be recovered.
+func (recovery *Recovery) ObserveHeight(height uint64) bool {
+	recovery.mu.Lock()
+	defer recovery.mu.Unlock()
+
+	if height <= recovery.lastHeight {
+		return false
+	}
+	now := recovery.clock.Now()
+	recovered := recovery.lastHeight != 0 && now.Sub(recovery.lastAdvance) >= recovery.conf.Downtime
+	recovery.lastHeight = height
+	recovery.lastAdvance = now
+	return recovered
+}
+
+// Start recovers stuck burns in the background, unless a recovery is already
+// running. It returns whether a recovery was started.
+func (recovery *Recovery) Start(ctx context.Context) bool {
+	recovery.mu.Lock()
+	defer recovery.mu.Unlock()
+
+	if recovery.progress.Running {
+		return false
+	}
+	recovery.progress = RecoveryProgress{Running: true, Started: recovery.clock.Now()}
+	go recovery.run(ctx)
+	return true
+}
+
+// Progress returns the progress of the latest recovery.
+func (recovery *Recovery) Progress() RecoveryProgress {
+	recovery.mu.Lock()
+	defer recovery.mu.Unlock()
+	return recovery.progress
+}
+
+func (recovery *Recovery) update(f func(*RecoveryProgress)) {
+	recovery.mu.Lock()
+	defer recovery.mu.Unlock()
+	f(&recovery.progress)
+}
+
+func (recovery *Recovery) run(ctx context.Context) {
+	defer recovery.update(func(progress *RecoveryProgress) {
+		progress.Running = false
+		progress.Finished = recovery.clock.Now()
+	})
+
+	// Burns are read a batch at a time, so that a large backlog is never held
+	// in memory. Recovered burns are only finished once their final result
+	// is persisted, so batches are paged by cursor rather than by offset.
+	before := recovery.database.Clock().Now().Add(-recovery.conf.MinAge)
+	cursor := db.TxCursor{}
+	for first := true; ; first = false {
+		if !first {
+			select {
+			case <-ctx.Done():
+				return
+			case <-recovery.clock.After(recovery.conf.BatchInterval):
+			}
+		}
+		batch, next, err := recovery.database.UnfinishedBurns(before, cursor, recovery.conf.BatchSize)
+		if err != nil {
+			recovery.logger.Errorf("[recovery] cannot get unfinished burns: %v", err)
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+		cursor = next
+		recovery.update(func(progress *RecoveryProgress) { progress.Total += len(batch) })
+		phi.ParForAll(batch, func(i int) {
+			recovery.recover(ctx, batch[i])
+		})
+
+		progress := recovery.Progress()
+		recovery.logger.Infof("[recovery] queried %v/%v burns: %v done, %v executing, %v resubmitted, %v failed",
+			progress.Queried, progress.Total, progress.Done, progress.Executing, progress.Resubmitted, progress.Failed)
+	}
+}
+
+// recover queries the burn, and submits it again if the Darknodes do not know
+// about it.
+func (recovery *Recovery) recover(ctx context.Context, transaction tx.Tx) {
+	response, err := recovery.send(ctx, jsonrpc.MethodQueryTx, jsonrpc.ParamsQueryTx{TxHash: transaction.Hash})
+	if err == nil && lerrors.TxNotFound(response.Error) {
+		response, err = recovery.send(ctx, jsonrpc.MethodSubmitTx, jsonrpc.ParamsSubmitTx{Tx: transaction})
+		if err == nil && response.Error != nil && !lerrors.AlreadyDone(response.Error) {
+			err = fmt.Errorf("resubmitting: %v", response.Error.Message)
+		}
+		if err == nil {
+			recovery.logger.Infof("[recovery] resubmitted tx=%v", transaction.Hash)
+			recovery.update(func(progress *RecoveryProgress) {
+				progress.Queried++
+				progress.Resubmitted++
+			})
+			return
+		}
+	}
+	if err == nil && response.Error != nil {
+		err = fmt.Errorf("querying: %v", response.Error.Message)
+	}
+	if err != nil {
+		recovery.logger.Warnf("[recovery] cannot recover tx=%v: %v", transaction.Hash, err)
+		recovery.update(func(progress *RecoveryProgress) {
+			progress.Queried++
+			progress.Failed++
+		})
+		return
+	}
+
+	done := false
+	if resp, err := lhttp.DecodeQueryTxResult(response.Result); err == nil {
+		done = resp.TxStatus == tx.StatusDone
+	}
+	recovery.update(func(progress *RecoveryProgress) {
+		progress.Queried++
+		if done {
+			progress.Done++
+		} else {
+			progress.Executing++
+		}
+	})
+}
+
+// send sends the request and waits for its response.
+func (recovery *Recovery) send(ctx context.Context, method string, params interface{}) (jsonrpc.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, recoveryTimeout)
+	defer cancel()
+
+	req := lhttp.NewRequestWithResponder(ctx, rand.Int63(), method, params, url.Values{})
+	if ok := recovery.sender.Send(req); !ok {
+		return jsonrpc.Response{}, fmt.Errorf("too much back pressure")
+	}
+	select {
+	case <-ctx.Done():
+		return jsonrpc.Response{}, ctx.Err()
+	case response := <-req.Responder:
+		return response, nil
+	}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (recovery *Recovery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recovery.Progress())
+}
@@ -0,0 +1,111 @@
+package updater_test
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/testutils"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/darknode/tx/txutil"
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/updater"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Recovery", func() {
+	conf := updater.RecoveryConf{
+		Downtime:      100 * time.Millisecond,
+		MinAge:        time.Minute,
+		BatchSize:     2,
+		BatchInterval: 10 * time.Millisecond,
+	}
+
+	It("should only recover once the height advances after stalling", func() {
+		mockClock := clock.NewMock(time.Now())
+		recovery := updater.NewRecovery(logging.FromLogrus(logrus.New()), NewMockSender(), nil, conf).WithClock(mockClock)
+		Expect(recovery.ObserveHeight(10)).To(BeFalse())
+		Expect(recovery.ObserveHeight(11)).To(BeFalse())
+
+		mockClock.Add(conf.Downtime)
+		Expect(recovery.ObserveHeight(11)).To(BeFalse())
+		Expect(recovery.ObserveHeight(20)).To(BeTrue())
+		Expect(recovery.ObserveHeight(21)).To(BeFalse())
+	})
+
+	It("should query stuck burns and resubmit those the darknodes do not know", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sqlDB, err := sql.Open("sqlite3", "./recovery.db")
+		Expect(err).NotTo(HaveOccurred())
+		sqlDB.SetMaxOpenConns(1)
+		defer os.Remove("./recovery.db")
+		defer sqlDB.Close()
+		database := db.New(sqlDB, 0, 1)
+		Expect(database.Init()).To(Succeed())
+
+		// Insert three submitted burns, one of which the darknodes do not
+		// know, and a submitted mint.
+		r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		selectors := []tx.Selector{"BTC/fromEthereum", "BTC/fromEthereum", "BTC/fromEthereum", "BTC/toEthereum"}
+		hashes := make([]id.Hash, len(selectors))
+		for i, selector := range selectors {
+			transaction := txutil.RandomGoodTx(r)
+			transaction.Selector = selector
+			hashes[i] = transaction.Hash
+			Expect(database.InsertTx(transaction)).To(Succeed())
+			Expect(database.UpdateStatus(transaction.Hash, db.TxStatusConfirmed)).To(Succeed())
+			Expect(UpdateTxCreatedTime(sqlDB, "txs", transaction.Hash, time.Now().Add(-time.Hour).Unix())).To(Succeed())
+		}
+		unknown := hashes[0]
+
+		sender := NewMockSender()
+		submitted := make(chan id.Hash, len(hashes))
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case message := <-sender.Messages:
+					msg := message.(http.RequestWithResponder)
+					switch params := msg.Params.(type) {
+					case jsonrpc.ParamsQueryTx:
+						if params.TxHash == unknown {
+							jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, "tx not found", nil)
+							msg.Responder <- jsonrpc.NewResponse(msg.ID, nil, &jsonErr)
+							continue
+						}
+						msg.Responder <- jsonrpc.NewResponse(msg.ID, jsonrpc.ResponseQueryTx{TxStatus: tx.StatusDone}, nil)
+					case jsonrpc.ParamsSubmitTx:
+						submitted <- params.Tx.Hash
+						msg.Responder <- jsonrpc.NewResponse(msg.ID, jsonrpc.ResponseSubmitTx{}, nil)
+					}
+				}
+			}
+		}()
+
+		recovery := updater.NewRecovery(logging.FromLogrus(logrus.New()), sender, database, conf)
+		Expect(recovery.Start(ctx)).To(BeTrue())
+		Eventually(func() bool { return recovery.Progress().Running }, 5*time.Second).Should(BeFalse())
+
+		progress := recovery.Progress()
+		Expect(progress.Total).To(Equal(3))
+		Expect(progress.Queried).To(Equal(3))
+		Expect(progress.Done).To(Equal(2))
+		Expect(progress.Resubmitted).To(Equal(1))
+		Expect(progress.Failed).To(Equal(0))
+		Expect(submitted).To(Receive(Equal(unknown)))
+	})
+})
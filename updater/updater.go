@@ -5,16 +5,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"strconv"
-	"strings"
+	nethttp "net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/hooks"
 	"github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
 	"github.com/renproject/lightnode/store"
+	"github.com/renproject/pack"
 	"github.com/renproject/phi"
-	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PeerSampleSize is the number of darknodes, other than the bootstrap
+	// darknodes, which are queried for their peers in each update if the
+	// health of darknodes is tracked.
+	PeerSampleSize = 8
+
+	// MaxPeerFailures is the number of updates in a row a darknode can fail
+	// to respond to before it is evicted from the store. Bootstrap darknodes
+	// are never evicted.
+	MaxPeerFailures = 3
 )
 
 // An Updater is a task responsible for querying the darknodes periodically to
@@ -23,29 +38,61 @@ import (
 // darknodes to a store. This store is shared by the `Dispatcher`, which needs
 // to know about the darknodes in the network.
 type Updater struct {
-	logger     logrus.FieldLogger
+	logger     logging.Logger
 	multiStore store.MultiAddrStore
 	client     http.Client
 	pollRate   time.Duration
+	hooks      *hooks.Runner
+	recovery   *Recovery
+	clock      clock.Clock
 }
 
 // New constructs a new `Updater`. If the given store of multi addresses is
 // empty, then the constructed `Updater` will be useless since it will not know
 // any darknodes to query. Therefore the given store must contain some number
 // of bootstrap addresses.
-func New(logger logrus.FieldLogger, multiStore store.MultiAddrStore, pollRate, timeout time.Duration) Updater {
+func New(logger logging.Logger, multiStore store.MultiAddrStore, pollRate, timeout time.Duration) Updater {
 	return Updater{
 		logger:     logger,
 		multiStore: multiStore,
 		pollRate:   pollRate,
 		client:     http.NewClient(timeout),
+		clock:      clock.New(),
 	}
 }
 
+// WithTransport sends the requests to the darknodes with the given transport,
+// such as through the outbound proxies.
+func (updater Updater) WithTransport(transport nethttp.RoundTripper) Updater {
+	updater.client = updater.client.WithTransport(transport)
+	return updater
+}
+
+// WithHooks reports a loss of quorum to the given hooks when fewer than two
+// thirds of the bootstrap darknodes respond.
+func (updater Updater) WithHooks(runner *hooks.Runner) Updater {
+	updater.hooks = runner
+	return updater
+}
+
+// WithRecovery tracks the block height of the darknodes, and starts the
+// recovery of stuck burns when it advances after the darknodes were down.
+func (updater Updater) WithRecovery(recovery *Recovery) Updater {
+	updater.recovery = recovery
+	return updater
+}
+
+// WithClock schedules the updates with the given clock, such as a mock clock
+// which tests advance instead of waiting for the poll rate.
+func (updater Updater) WithClock(clock clock.Clock) Updater {
+	updater.clock = clock
+	return updater
+}
+
 // Run starts the `Updater` making requests to the darknodes and updating its
 // store. This function is blocking.
 func (updater *Updater) Run(ctx context.Context) {
-	ticker := time.NewTicker(updater.pollRate)
+	ticker := updater.clock.NewTicker(updater.pollRate)
 	defer ticker.Stop()
 
 	updater.updateMultiAddress(ctx)
@@ -53,7 +100,7 @@ func (updater *Updater) Run(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			updater.updateMultiAddress(ctx)
 		}
 	}
@@ -74,9 +121,19 @@ func (updater *Updater) updateMultiAddress(ctx context.Context) {
 		return
 	}
 
-	// Collect all peers connected to Bootstrap nodes.
-	phi.ParForAll(addrs, func(i int) {
-		multi := addrs[i]
+	// Collect all peers connected to Bootstrap nodes. If the health of the
+	// darknodes is tracked, a sample of the other darknodes is also queried,
+	// which measures their round trip time and finds the darknodes which have
+	// left the network.
+	peers := updater.multiStore.PeerTable()
+	targets := addrs
+	if peers != nil {
+		targets = append(append([]wire.Address{}, addrs...), updater.samplePeers(addrs)...)
+	}
+	var responded int64
+	phi.ParForAll(targets, func(i int) {
+		multi := targets[i]
+		bootstrap := i < len(addrs)
 
 		// Send request to the node to retrieve its peers.
 		request := jsonrpc.Request{
@@ -86,22 +143,26 @@ func (updater *Updater) updateMultiAddress(ctx context.Context) {
 			Params:  params,
 		}
 
-		addrParts := strings.Split(addrs[i].Value, ":")
-		if len(addrParts) != 2 {
-			updater.logger.Errorf("[updater] invalid address value=%v", addrs[i].Value)
-			return
-		}
-		port, err := strconv.Atoi(addrParts[1])
+		addrString, err := http.DarknodeURL(multi)
 		if err != nil {
-			updater.logger.Errorf("[updater] invalid port=%v", addrParts[1])
+			updater.logger.Errorf("[updater] %v", err)
 			return
 		}
-		addrString := fmt.Sprintf("http://%s:%v", addrParts[0], port+1)
+		start := time.Now()
 		response, err := updater.client.SendRequest(queryCtx, addrString, request, nil)
 		if err != nil {
 			updater.logger.Warnf("[updater] cannot connect to node %v: %v", multi.String(), err)
+			if peers != nil && peers.Failure(multi, bootstrap) >= MaxPeerFailures && !bootstrap {
+				updater.evict(multi)
+			}
 			return
 		}
+		if peers != nil {
+			peers.Success(multi, time.Since(start), bootstrap)
+		}
+		if bootstrap {
+			atomic.AddInt64(&responded, 1)
+		}
 
 		// Parse the response
 		raw, err := json.Marshal(response.Result)
@@ -127,6 +188,16 @@ func (updater *Updater) updateMultiAddress(ctx context.Context) {
 		}
 	})
 
+	if len(addrs) > 0 && 3*int(responded) < 2*len(addrs) {
+		updater.hooks.Fail(hooks.ConditionQuorumLoss, "darknodes", fmt.Errorf("%v of %v bootstrap darknodes responded", responded, len(addrs)))
+	} else {
+		updater.hooks.Recover(hooks.ConditionQuorumLoss, "darknodes")
+	}
+
+	if updater.recovery != nil {
+		updater.observeHeight(ctx, addrs)
+	}
+
 	// Print how many nodes we have connected to.
 	size, err := updater.multiStore.Size()
 	if err != nil {
@@ -135,3 +206,84 @@ func (updater *Updater) updateMultiAddress(ctx context.Context) {
 	}
 	updater.logger.Infof("connected to %v nodes", size)
 }
+
+// samplePeers returns a random sample of the darknodes in the store which are
+// not bootstrap darknodes.
+func (updater *Updater) samplePeers(bootstrapAddrs []wire.Address) []wire.Address {
+	bootstrap := map[string]bool{}
+	for _, addr := range bootstrapAddrs {
+		bootstrap[addr.String()] = true
+	}
+	addrs, err := updater.multiStore.AddrsAll()
+	if err != nil {
+		updater.logger.Errorf("[updater] cannot get addresses: %v", err)
+		return nil
+	}
+	sample := make([]wire.Address, 0, PeerSampleSize)
+	for _, i := range rand.Perm(len(addrs)) {
+		if len(sample) == PeerSampleSize {
+			break
+		}
+		if !bootstrap[addrs[i].String()] {
+			sample = append(sample, addrs[i])
+		}
+	}
+	return sample
+}
+
+// evict removes a darknode which has stopped responding from the store. It is
+// added back if a darknode reports it as a peer again.
+func (updater *Updater) evict(addr wire.Address) {
+	if err := updater.multiStore.Delete(addr); err != nil {
+		updater.logger.Errorf("[updater] cannot evict node %v: %v", addr.String(), err)
+		return
+	}
+	updater.multiStore.PeerTable().Remove(addr)
+	updater.logger.Infof("[updater] evicted node %v after %v failed queries", addr.String(), MaxPeerFailures)
+}
+
+// observeHeight queries the block height of the darknodes, and starts a
+// recovery if it has advanced after stalling.
+func (updater *Updater) observeHeight(ctx context.Context, addrs []wire.Address) {
+	params, err := json.Marshal(jsonrpc.ParamsQueryBlock{})
+	if err != nil {
+		updater.logger.Errorf("[updater] cannot marshal query block params: %v", err)
+		return
+	}
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  jsonrpc.MethodQueryBlock,
+		Params:  params,
+	}
+
+	// Only one darknode needs to respond, so they are tried in turn.
+	for _, i := range rand.Perm(len(addrs)) {
+		addrString, err := http.DarknodeURL(addrs[i])
+		if err != nil {
+			continue
+		}
+		response, err := updater.client.SendRequest(ctx, addrString, request, nil)
+		if err != nil || response.Error != nil {
+			continue
+		}
+		raw, err := json.Marshal(response.Result)
+		if err != nil {
+			continue
+		}
+		var result struct {
+			Block struct {
+				Height pack.U64 `json:"height"`
+			} `json:"block"`
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			updater.logger.Warnf("[updater] cannot unmarshal queryBlock result: %v", err)
+			continue
+		}
+		height := uint64(result.Block.Height)
+		if updater.recovery.ObserveHeight(height) && updater.recovery.Start(ctx) {
+			updater.logger.Infof("[updater] darknodes resumed at height %v, recovering stuck burns", height)
+		}
+		return
+	}
+}
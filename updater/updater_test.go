@@ -13,19 +13,22 @@ import (
 	. "github.com/renproject/lightnode/testutils"
 
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
 	"github.com/renproject/kv"
+	"github.com/renproject/lightnode/clock"
+	"github.com/renproject/lightnode/logging"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/updater"
 	"github.com/sirupsen/logrus"
 )
 
-func initUpdater(ctx context.Context, bootstrapAddrs []wire.Address, pollRate, timeout time.Duration) store.MultiAddrStore {
+func initUpdater(ctx context.Context, bootstrapAddrs []wire.Address, pollRate, timeout time.Duration, clock clock.Clock) store.MultiAddrStore {
 	logger := logrus.New()
 	multiStore := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), bootstrapAddrs)
 	for _, addr := range bootstrapAddrs {
 		multiStore.Insert(addr)
 	}
-	updater := updater.New(logger, multiStore, pollRate, timeout)
+	updater := updater.New(logging.FromLogrus(logger), multiStore, pollRate, timeout).WithClock(clock)
 
 	go updater.Run(ctx)
 
@@ -75,12 +78,44 @@ var _ = Describe("Updater", func() {
 			for i := range multis {
 				multis[i] = darknodes[i].Me
 			}
-			updater := initUpdater(ctx, multis[:4], 100*time.Millisecond, time.Second)
+			// Every update waits for the previous one to finish, so that the
+			// darknodes which were found are queried in the next.
+			mockClock := clock.NewMock(time.Now())
+			updater := initUpdater(ctx, multis[:4], 100*time.Millisecond, time.Second, mockClock)
+			mockClock.BlockUntil(1)
 			Eventually(func() int {
+				mockClock.Add(100 * time.Millisecond)
 				size, err := updater.Size()
 				Expect(err).ShouldNot(HaveOccurred())
 				return size
 			}, 5*time.Second).Should(Equal(13))
 		})
+
+		It("Should evict darknodes which stop responding", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			unreachable := wire.NewUnsignedAddress(wire.TCP, "127.0.0.1:1", uint64(time.Now().Unix()))
+			Expect(unreachable.Sign(id.NewPrivKey())).To(Succeed())
+			peers := store.NewPeerTable()
+			multiStore := store.NewInMemory(nil).WithPeerTable(peers)
+			Expect(multiStore.Insert(unreachable)).To(Succeed())
+
+			mockClock := clock.NewMock(time.Now())
+			peerUpdater := updater.New(logging.FromLogrus(logrus.New()), multiStore, 50*time.Millisecond, 100*time.Millisecond).WithClock(mockClock)
+			go peerUpdater.Run(ctx)
+
+			// The first update is made straight away, and the last one has
+			// finished once the tick after it has been received.
+			mockClock.BlockUntil(1)
+			for i := 0; i < updater.MaxPeerFailures; i++ {
+				mockClock.Add(50 * time.Millisecond)
+			}
+
+			size, err := multiStore.Size()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(size).To(Equal(0))
+			Expect(peers.Peers()).To(BeEmpty())
+		})
 	})
 })
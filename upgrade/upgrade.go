@@ -0,0 +1,120 @@
+// Package upgrade checks that the data and peers of the Lightnode are
+// compatible with this binary before it starts. During a rolling upgrade, the
+// fleet briefly runs several versions of the Lightnode against the same Redis
+// and Darknodes, and a Lightnode which does not understand the data written by
+// a newer one must refuse to start rather than silently corrupt it. The
+// database schema is checked by the db package when it is initialised.
+package upgrade
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/go-redis/redis/v7"
+)
+
+const (
+	// RedisFormatVersion is the version of the format of the data written to
+	// Redis by this Lightnode, such as compat mappings and watcher
+	// checkpoints. It is increased whenever the format changes.
+	RedisFormatVersion = 1
+
+	// MinRedisFormatVersion is the oldest version of the Lightnode which can
+	// read the data written by this one. It is only increased by changes which
+	// older Lightnodes cannot read.
+	MinRedisFormatVersion = 1
+)
+
+// Keys of the format markers in Redis.
+const (
+	RedisFormatKey    = "lightnode:format:version"
+	RedisMinFormatKey = "lightnode:format:min"
+)
+
+// CheckRedis returns an error if the data in Redis was written in a format
+// which this Lightnode cannot read. Otherwise, it records the format of this
+// Lightnode, without overwriting the markers of newer ones.
+func CheckRedis(client redis.Cmdable) error {
+	minVersion, err := redisVersion(client, RedisMinFormatKey)
+	if err != nil {
+		return err
+	}
+	if minVersion > RedisFormatVersion {
+		version, _ := redisVersion(client, RedisFormatKey)
+		return fmt.Errorf("redis data format version %v requires a lightnode with format version %v or later, but this lightnode has version %v: "+
+			"upgrade the lightnode, or flush the lightnode keys from redis if the data can be rebuilt", version, minVersion, RedisFormatVersion)
+	}
+
+	for key, version := range map[string]int{RedisFormatKey: RedisFormatVersion, RedisMinFormatKey: MinRedisFormatVersion} {
+		current, err := redisVersion(client, key)
+		if err != nil {
+			return err
+		}
+		if current >= version {
+			continue
+		}
+		if err := client.Set(key, version, 0).Err(); err != nil {
+			return fmt.Errorf("recording %v: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// redisVersion returns the version stored at the key, or zero if there is
+// none.
+func redisVersion(client redis.Cmdable, key string) (int, error) {
+	value, err := client.Get(key).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading %v: %v", key, err)
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v %q", key, value)
+	}
+	return version, nil
+}
+
+var versionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// CheckDarknodeVersion returns an error if the Darknodes run a newer minor
+// version than the Darknode module this Lightnode was built against, as the
+// wire format may have changed. Versions which cannot be parsed, such as the
+// "unknown" version of binaries built without module support, are assumed to
+// be compatible.
+func CheckDarknodeVersion(darknodeVersion, builtAgainst string) error {
+	major, minor, ok := parseVersion(darknodeVersion)
+	if !ok {
+		return nil
+	}
+	builtMajor, builtMinor, ok := parseVersion(builtAgainst)
+	if !ok {
+		return nil
+	}
+	if major > builtMajor || (major == builtMajor && minor > builtMinor) {
+		return fmt.Errorf("darknodes run version %v, but this lightnode was built against darknode %v: "+
+			"upgrade the lightnode to a release built against darknode v%v.%v", darknodeVersion, builtAgainst, major, minor)
+	}
+	return nil
+}
+
+// parseVersion returns the major and minor version of a semantic version,
+// with or without a leading "v".
+func parseVersion(version string) (int, int, bool) {
+	match := versionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
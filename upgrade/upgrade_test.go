@@ -0,0 +1,63 @@
+package upgrade_test
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/upgrade"
+)
+
+var _ = Describe("Upgrade checks", func() {
+	Context("when checking redis", func() {
+		newClient := func() (*miniredis.Miniredis, *redis.Client) {
+			mr, err := miniredis.Run()
+			Expect(err).NotTo(HaveOccurred())
+			return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		}
+
+		It("should record the format of this lightnode", func() {
+			mr, client := newClient()
+			defer mr.Close()
+
+			Expect(CheckRedis(client)).To(Succeed())
+			Expect(client.Get(RedisFormatKey).Int()).To(Equal(RedisFormatVersion))
+			Expect(client.Get(RedisMinFormatKey).Int()).To(Equal(MinRedisFormatVersion))
+		})
+
+		It("should not overwrite the format of a newer compatible lightnode", func() {
+			mr, client := newClient()
+			defer mr.Close()
+
+			Expect(client.Set(RedisFormatKey, RedisFormatVersion+1, 0).Err()).To(Succeed())
+			Expect(CheckRedis(client)).To(Succeed())
+			Expect(client.Get(RedisFormatKey).Int()).To(Equal(RedisFormatVersion + 1))
+		})
+
+		It("should refuse data written by an incompatible lightnode", func() {
+			mr, client := newClient()
+			defer mr.Close()
+
+			Expect(client.Set(RedisMinFormatKey, RedisFormatVersion+1, 0).Err()).To(Succeed())
+			Expect(CheckRedis(client)).NotTo(Succeed())
+		})
+	})
+
+	Context("when checking the darknode version", func() {
+		It("should accept darknodes running the same or an older minor version", func() {
+			Expect(CheckDarknodeVersion("0.5.3-ab12cd", "v0.5.3-0.20210914051036-04adb12237f0")).To(Succeed())
+			Expect(CheckDarknodeVersion("v0.4.9", "v0.5.3")).To(Succeed())
+		})
+
+		It("should refuse darknodes running a newer minor version", func() {
+			Expect(CheckDarknodeVersion("0.6.0", "v0.5.3")).NotTo(Succeed())
+			Expect(CheckDarknodeVersion("1.0.0", "v0.5.3")).NotTo(Succeed())
+		})
+
+		It("should accept versions which cannot be parsed", func() {
+			Expect(CheckDarknodeVersion("", "v0.5.3")).To(Succeed())
+			Expect(CheckDarknodeVersion("0.6.0", "unknown")).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,39 @@
+// Package version contains build information for the Lightnode. The values are
+// injected at build time using ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/renproject/lightnode/version.Version=v0.4.8 \
+//		-X github.com/renproject/lightnode/version.GitCommit=$(git rev-parse HEAD) \
+//		-X github.com/renproject/lightnode/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//		./cmd/lightnode
+package version
+
+import "fmt"
+
+// Build information. These are variables rather than constants so that they
+// can be overridden by the linker.
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the build of the running Lightnode.
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+}
+
+// Get returns the build information of the running Lightnode.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+	}
+}
+
+// String returns a human readable summary of the build information.
+func (info Info) String() string {
+	return fmt.Sprintf("%v (commit %v, built %v)", info.Version, info.GitCommit, info.BuildDate)
+}
@@ -0,0 +1,59 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/multichain"
+)
+
+// ChainConfig configures the watchers of a chain. EVM chains only differ in
+// their configuration, so a new one can be watched without changes to the
+// watcher.
+type ChainConfig struct {
+	// Registry is the address of the gateway registry on an EVM chain, from
+	// which the bindings look up the gateway of each asset. It is empty for
+	// chains whose bindings are configured otherwise.
+	Registry string
+
+	// ConfidenceInterval is the number of blocks the watchers stay behind the
+	// head of the chain, so that burns are only submitted once their block
+	// is unlikely to be reorganised.
+	ConfidenceInterval uint64
+
+	// BlockTime is the time between blocks of the chain. The watchers poll
+	// for burns once per block time.
+	BlockTime time.Duration
+
+	// MaxLogRange is the number of blocks of logs fetched at once. RPCs
+	// limit the range of blocks which can be filtered in a single request.
+	MaxLogRange uint64
+}
+
+// NewEVMWatcher returns a Watcher for the burns of the selector from an EVM
+// chain, configured entirely by the config of the chain. Burn logs are fetched
+// from the gateway of the asset, which the chain bindings look up in the
+// registry of the config, and the block height from the client of the chain,
+// unless a block height fetcher is given, such as one for finalised blocks.
+func NewEVMWatcher(logger logging.Logger, network multichain.Network, selector tx.Selector, bindings binding.Bindings, chainBindings *binding.Binding, blockHeightFetcher BlockHeightFetcher, resolver jsonrpc.Resolver, cache redis.Cmdable, config ChainConfig, mappingExpiry time.Duration) Watcher {
+	chain := selector.Source()
+	if blockHeightFetcher == nil {
+		blockHeightFetcher = NewEthBlockHeightFetcher(chainBindings.EthereumClient(chain))
+	}
+	return Watcher{
+		logger:             logger,
+		network:            network,
+		selector:           selector,
+		bindings:           bindings,
+		burnLogFetcher:     NewEthBurnLogFetcher(chainBindings.EthereumGateway(chain, selector.Asset())),
+		blockHeightFetcher: blockHeightFetcher,
+		resolver:           resolver,
+		cache:              cache,
+		config:             config,
+		mappingExpiry:      mappingExpiry,
+	}
+}
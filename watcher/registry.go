@@ -0,0 +1,219 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/multichain"
+)
+
+// ChainStatus is the status of the watchers of a chain.
+type ChainStatus struct {
+	Chain  multichain.Chain   `json:"chain"`
+	Assets []multichain.Asset `json:"assets"`
+	Paused bool               `json:"paused"`
+}
+
+// registeredChain is a chain whose watchers are run by a Registry. The cancel
+// function and wait group are only set while the watchers are running, and the
+// stopping channel while they have been cancelled but have not returned yet.
+type registeredChain struct {
+	watchers map[multichain.Asset]Watcher
+	paused   bool
+	cancel   context.CancelFunc
+	wg       *sync.WaitGroup
+	stopping chan struct{}
+}
+
+// Registry runs the watchers of each chain. Chains can be added, paused and
+// resumed while the Lightnode is running, so that a new chain can be watched,
+// or a misbehaving chain stopped, without a restart.
+type Registry struct {
+	logger logging.Logger
+
+	mu     *sync.Mutex
+	ctx    context.Context
+	chains map[multichain.Chain]*registeredChain
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry(logger logging.Logger) *Registry {
+	return &Registry{
+		logger: logger,
+		mu:     new(sync.Mutex),
+		chains: map[multichain.Chain]*registeredChain{},
+	}
+}
+
+// Add the watchers of a chain. They are started straight away if the registry
+// is running.
+func (registry *Registry) Add(chain multichain.Chain, watchers map[multichain.Asset]Watcher) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, ok := registry.chains[chain]; ok {
+		return fmt.Errorf("%v is already watched", chain)
+	}
+	registered := &registeredChain{watchers: watchers}
+	registry.chains[chain] = registered
+	if registry.ctx != nil {
+		registry.start(chain, registered)
+	}
+	return nil
+}
+
+// Pause stops the watchers of a chain, and waits for them to return. The
+// registry is not locked while waiting, so that other chains can be managed
+// in the meantime.
+func (registry *Registry) Pause(chain multichain.Chain) error {
+	registry.mu.Lock()
+	registered, ok := registry.chains[chain]
+	if !ok {
+		registry.mu.Unlock()
+		return fmt.Errorf("%v is not watched", chain)
+	}
+	registered.paused = true
+	running := registered.cancel != nil
+	stopping := registry.stop(registered)
+	registry.mu.Unlock()
+
+	if stopping != nil {
+		<-stopping
+	}
+	if running {
+		registry.logger.Infof("[watcher] paused %v", chain)
+	}
+	return nil
+}
+
+// Resume restarts the watchers of a paused chain. If the chain is still being
+// paused, it waits for the old watchers to return first, so that there is
+// never more than one set of watchers for a chain.
+func (registry *Registry) Resume(chain multichain.Chain) error {
+	for {
+		registry.mu.Lock()
+		registered, ok := registry.chains[chain]
+		if !ok {
+			registry.mu.Unlock()
+			return fmt.Errorf("%v is not watched", chain)
+		}
+		if !registered.paused {
+			registry.mu.Unlock()
+			return nil
+		}
+		if stopping := registered.stopping; stopping != nil {
+			registry.mu.Unlock()
+			<-stopping
+			continue
+		}
+
+		registered.paused = false
+		if registry.ctx != nil {
+			registry.start(chain, registered)
+			registry.logger.Infof("[watcher] resumed %v", chain)
+		}
+		registry.mu.Unlock()
+		return nil
+	}
+}
+
+// Watcher returns the watcher of the chain and asset.
+func (registry *Registry) Watcher(chain multichain.Chain, asset multichain.Asset) (Watcher, bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registered, ok := registry.chains[chain]
+	if !ok {
+		return Watcher{}, false
+	}
+	watcher, ok := registered.watchers[asset]
+	return watcher, ok
+}
+
+// Statuses returns the status of every chain, sorted by chain.
+func (registry *Registry) Statuses() []ChainStatus {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	statuses := make([]ChainStatus, 0, len(registry.chains))
+	for chain, registered := range registry.chains {
+		assets := make([]multichain.Asset, 0, len(registered.watchers))
+		for asset := range registered.watchers {
+			assets = append(assets, asset)
+		}
+		sort.Slice(assets, func(i, j int) bool { return assets[i] < assets[j] })
+		statuses = append(statuses, ChainStatus{Chain: chain, Assets: assets, Paused: registered.paused})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Chain < statuses[j].Chain })
+	return statuses
+}
+
+// Run the watchers of every chain which is not paused until the context is
+// done, and then wait for all of them to return. Chains which are added or
+// resumed after Run has returned are not started.
+func (registry *Registry) Run(ctx context.Context) {
+	registry.mu.Lock()
+	registry.ctx = ctx
+	for chain, registered := range registry.chains {
+		if !registered.paused {
+			registry.start(chain, registered)
+		}
+	}
+	registry.mu.Unlock()
+
+	<-ctx.Done()
+
+	registry.mu.Lock()
+	registry.ctx = nil
+	stopping := make([]chan struct{}, 0, len(registry.chains))
+	for _, registered := range registry.chains {
+		if stopped := registry.stop(registered); stopped != nil {
+			stopping = append(stopping, stopped)
+		}
+	}
+	registry.mu.Unlock()
+
+	for _, stopped := range stopping {
+		<-stopped
+	}
+}
+
+// start the watchers of the chain. The registry must be locked.
+func (registry *Registry) start(chain multichain.Chain, registered *registeredChain) {
+	ctx, cancel := context.WithCancel(registry.ctx)
+	wg := new(sync.WaitGroup)
+	for _, watcher := range registered.watchers {
+		wg.Add(1)
+		go func(watcher Watcher) {
+			defer wg.Done()
+			watcher.Run(ctx)
+		}(watcher)
+	}
+	registered.cancel, registered.wg = cancel, wg
+}
+
+// stop cancels the watchers of the chain, and returns a channel which is
+// closed once they have returned, or nil if they are not running and not
+// being stopped. The registry must be locked.
+func (registry *Registry) stop(registered *registeredChain) chan struct{} {
+	if registered.cancel == nil {
+		return registered.stopping
+	}
+	cancel, wg := registered.cancel, registered.wg
+	stopping := make(chan struct{})
+	registered.cancel, registered.wg, registered.stopping = nil, nil, stopping
+	cancel()
+	go func() {
+		wg.Wait()
+		registry.mu.Lock()
+		if registered.stopping == stopping {
+			registered.stopping = nil
+		}
+		registry.mu.Unlock()
+		close(stopping)
+	}()
+	return stopping
+}
@@ -0,0 +1,213 @@
+package watcher_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/watcher"
+
+	"github.com/renproject/darknode/jsonrpc/jsonrpcresolver"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/multichain"
+	"github.com/sirupsen/logrus"
+)
+
+// countingBlockHeightFetcher counts the polls of a watcher, and fails them so
+// that the watcher does nothing else.
+type countingBlockHeightFetcher struct {
+	polls *int64
+}
+
+func (fetcher countingBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	atomic.AddInt64(fetcher.polls, 1)
+	return 0, errors.New("not available")
+}
+
+// slowBlockHeightFetcher blocks each poll until its context is done, and then
+// takes a while to return, so that the watchers of a chain are slow to stop.
+// It records the most polls which were ever in flight at once.
+type slowBlockHeightFetcher struct {
+	inFlight    *int64
+	maxInFlight *int64
+}
+
+func (fetcher slowBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	inFlight := atomic.AddInt64(fetcher.inFlight, 1)
+	defer atomic.AddInt64(fetcher.inFlight, -1)
+	for {
+		max := atomic.LoadInt64(fetcher.maxInFlight)
+		if inFlight <= max || atomic.CompareAndSwapInt64(fetcher.maxInFlight, max, inFlight) {
+			break
+		}
+	}
+	<-ctx.Done()
+	time.Sleep(5 * time.Millisecond)
+	return 0, ctx.Err()
+}
+
+// blockedBlockHeightFetcher blocks each poll until it is released, even once
+// its context is done, so that the watchers of a chain cannot stop.
+type blockedBlockHeightFetcher struct {
+	polling chan<- struct{}
+	release <-chan struct{}
+}
+
+func (fetcher blockedBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	select {
+	case fetcher.polling <- struct{}{}:
+	default:
+	}
+	<-fetcher.release
+	return 0, errors.New("not available")
+}
+
+var _ = Describe("Watcher registry", func() {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	newWatcher := func(selector tx.Selector, polls *int64) Watcher {
+		return NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, selector, nil, nil, countingBlockHeightFetcher{polls}, jsonrpcresolver.OkResponder(), nil, ChainConfig{BlockTime: 10 * time.Millisecond, MaxLogRange: 5, ConfidenceInterval: 6}, time.Hour)
+	}
+
+	It("should stop polling chains while they are paused", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var ethPolls, bscPolls int64
+		registry := NewRegistry(logging.FromLogrus(logger))
+		Expect(registry.Add(multichain.Ethereum, map[multichain.Asset]Watcher{
+			multichain.BTC: newWatcher("BTC/fromEthereum", &ethPolls),
+		})).To(Succeed())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			registry.Run(ctx)
+		}()
+		Eventually(func() int64 { return atomic.LoadInt64(&ethPolls) }).Should(BeNumerically(">", 0))
+
+		// Chains added while running are started straight away.
+		Expect(registry.Add(multichain.BinanceSmartChain, map[multichain.Asset]Watcher{
+			multichain.BTC: newWatcher("BTC/fromBinanceSmartChain", &bscPolls),
+		})).To(Succeed())
+		Expect(registry.Add(multichain.BinanceSmartChain, nil)).NotTo(Succeed())
+		Eventually(func() int64 { return atomic.LoadInt64(&bscPolls) }).Should(BeNumerically(">", 0))
+
+		Expect(registry.Pause(multichain.Ethereum)).To(Succeed())
+		paused := atomic.LoadInt64(&ethPolls)
+		Consistently(func() int64 { return atomic.LoadInt64(&ethPolls) }, 50*time.Millisecond).Should(Equal(paused))
+		Expect(registry.Statuses()).To(Equal([]ChainStatus{
+			{Chain: multichain.BinanceSmartChain, Assets: []multichain.Asset{multichain.BTC}, Paused: false},
+			{Chain: multichain.Ethereum, Assets: []multichain.Asset{multichain.BTC}, Paused: true},
+		}))
+
+		Expect(registry.Resume(multichain.Ethereum)).To(Succeed())
+		Eventually(func() int64 { return atomic.LoadInt64(&ethPolls) }).Should(BeNumerically(">", paused))
+		Expect(registry.Pause(multichain.Solana)).NotTo(Succeed())
+
+		_, ok := registry.Watcher(multichain.Ethereum, multichain.BTC)
+		Expect(ok).To(BeTrue())
+		_, ok = registry.Watcher(multichain.Ethereum, multichain.ZEC)
+		Expect(ok).To(BeFalse())
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("should not resume a chain until its old watchers have returned", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var inFlight, maxInFlight int64
+		registry := NewRegistry(logging.FromLogrus(logger))
+		Expect(registry.Add(multichain.Ethereum, map[multichain.Asset]Watcher{
+			multichain.BTC: NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, "BTC/fromEthereum", nil, nil, slowBlockHeightFetcher{&inFlight, &maxInFlight}, jsonrpcresolver.OkResponder(), nil, ChainConfig{BlockTime: time.Millisecond, MaxLogRange: 5, ConfidenceInterval: 6}, time.Hour),
+		})).To(Succeed())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			registry.Run(ctx)
+		}()
+		Eventually(func() int64 { return atomic.LoadInt64(&inFlight) }).Should(Equal(int64(1)))
+
+		// Resuming while a pause is still waiting for the watchers to return
+		// must not start a second set of watchers.
+		for i := 0; i < 10; i++ {
+			paused := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(paused)
+				Expect(registry.Pause(multichain.Ethereum)).To(Succeed())
+			}()
+			time.Sleep(time.Millisecond)
+			Expect(registry.Resume(multichain.Ethereum)).To(Succeed())
+			Eventually(paused).Should(BeClosed())
+		}
+		Expect(atomic.LoadInt64(&maxInFlight)).To(Equal(int64(1)))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("should manage other chains while a chain is being paused", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		polling := make(chan struct{}, 1)
+		release := make(chan struct{})
+		var bscPolls int64
+		registry := NewRegistry(logging.FromLogrus(logger))
+		Expect(registry.Add(multichain.Ethereum, map[multichain.Asset]Watcher{
+			multichain.BTC: NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, "BTC/fromEthereum", nil, nil, blockedBlockHeightFetcher{polling, release}, jsonrpcresolver.OkResponder(), nil, ChainConfig{BlockTime: time.Millisecond, MaxLogRange: 5, ConfidenceInterval: 6}, time.Hour),
+		})).To(Succeed())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			registry.Run(ctx)
+		}()
+		Eventually(polling).Should(Receive())
+
+		paused := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(paused)
+			Expect(registry.Pause(multichain.Ethereum)).To(Succeed())
+		}()
+		Consistently(paused, 20*time.Millisecond).ShouldNot(BeClosed())
+
+		// The pause is waiting for the watcher of Ethereum to return.
+		Expect(registry.Statuses()).To(HaveLen(1))
+		Expect(registry.Add(multichain.BinanceSmartChain, map[multichain.Asset]Watcher{
+			multichain.BTC: newWatcher("BTC/fromBinanceSmartChain", &bscPolls),
+		})).To(Succeed())
+		Eventually(func() int64 { return atomic.LoadInt64(&bscPolls) }).Should(BeNumerically(">", 0))
+
+		close(release)
+		Eventually(paused).Should(BeClosed())
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("should not start chains once it has returned", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var polls int64
+		registry := NewRegistry(logging.FromLogrus(logger))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			registry.Run(ctx)
+		}()
+		cancel()
+		Eventually(done).Should(BeClosed())
+
+		Expect(registry.Add(multichain.Ethereum, map[multichain.Asset]Watcher{
+			multichain.BTC: newWatcher("BTC/fromEthereum", &polls),
+		})).To(Succeed())
+		Consistently(func() int64 { return atomic.LoadInt64(&polls) }, 50*time.Millisecond).Should(BeZero())
+	})
+})
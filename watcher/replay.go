@@ -0,0 +1,186 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// MaxReplayBlocks limits the number of blocks which can be replayed by a
+// single request.
+const MaxReplayBlocks = 1000000
+
+// Statuses of the burns found when replaying a block range.
+const (
+	ReplayStatusFound     = "found"
+	ReplayStatusKnown     = "known"
+	ReplayStatusSubmitted = "submitted"
+	ReplayStatusFailed    = "failed"
+)
+
+// ReplayedBurn is a burn found when replaying a block range, along with what
+// was done with it.
+type ReplayedBurn struct {
+	Hash        id.Hash      `json:"hash"`
+	Nonce       pack.Bytes32 `json:"nonce"`
+	BlockNumber pack.U64     `json:"blockNumber"`
+	Status      string       `json:"status"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// Replay scans the given block range (inclusive) for burns and submits the
+// ones which are not known, so that burns missed by the watcher can be
+// processed. Known burns are skipped, and no burns are submitted if dryRun is
+// set. Unlike the watcher loop, replaying does not move the last checked
+// block.
+func (watcher Watcher) Replay(ctx context.Context, from, to uint64, dryRun bool, known func(id.Hash) (bool, error)) ([]ReplayedBurn, error) {
+	burns := []ReplayedBurn{}
+	for start := from; start <= to; {
+		end := to
+		if watcher.config.MaxLogRange > 0 && end-start >= watcher.config.MaxLogRange {
+			end = start + watcher.config.MaxLogRange - 1
+		}
+
+		c, err := watcher.burnLogFetcher.FetchBurnLogs(ctx, start, end)
+		if err != nil {
+			return burns, fmt.Errorf("fetching burns from=%v to=%v: %v", start, end, err)
+		}
+		for res := range c {
+			if res.Error != nil {
+				return burns, fmt.Errorf("iterating burns from=%v to=%v: %v", start, end, res.Error)
+			}
+			burns = append(burns, watcher.replayBurn(ctx, res.Result, dryRun, known))
+		}
+		if ctx.Err() != nil {
+			return burns, ctx.Err()
+		}
+
+		if end == to {
+			break
+		}
+		start = end + 1
+	}
+	return burns, nil
+}
+
+func (watcher Watcher) replayBurn(ctx context.Context, burn BurnInfo, dryRun bool, known func(id.Hash) (bool, error)) ReplayedBurn {
+	replayed := ReplayedBurn{Nonce: burn.Nonce, BlockNumber: burn.BlockNumber}
+
+	transaction, err := watcher.burnToTx(burn.Txid, burn.Amount, burn.ToBytes, burn.Nonce)
+	if err != nil {
+		replayed.Status, replayed.Error = ReplayStatusFailed, err.Error()
+		return replayed
+	}
+	replayed.Hash = transaction.Hash
+
+	isKnown, err := known(transaction.Hash)
+	if err != nil {
+		replayed.Status, replayed.Error = ReplayStatusFailed, err.Error()
+		return replayed
+	}
+	if isKnown {
+		replayed.Status = ReplayStatusKnown
+		return replayed
+	}
+	if dryRun {
+		replayed.Status = ReplayStatusFound
+		return replayed
+	}
+
+	watcher.persistMappings(transaction, burn.Nonce)
+	params := jsonrpc.ParamsSubmitTx{Tx: transaction}
+	response := watcher.resolver.SubmitTx(lhttp.WithInternal(ctx), 0, &params, nil)
+	if response.Error != nil {
+		replayed.Status, replayed.Error = ReplayStatusFailed, response.Error.Message
+		return replayed
+	}
+	watcher.markProcessed(watcher.burnDigest(burn), burn)
+	watcher.logger.Infof("[watcher] replayed burn for %v with nonce=%v", watcher.selector.String(), burn.Nonce)
+	replayed.Status = ReplayStatusSubmitted
+	return replayed
+}
+
+// ReplayHandler serves the replay endpoint of the admin API, which replays
+// the burns of a chain and asset between the from and to blocks. GET requests
+// only report the burns which would be submitted, and POST requests submit
+// them. Burns of txs which are already in the database are skipped.
+type ReplayHandler struct {
+	logger   logging.Logger
+	db       db.DB
+	watchers *Registry
+}
+
+// NewReplayHandler returns a ReplayHandler for the watchers in the registry.
+func NewReplayHandler(logger logging.Logger, db db.DB, watchers *Registry) ReplayHandler {
+	return ReplayHandler{logger: logger, db: db, watchers: watchers}
+}
+
+// ServeHTTP implements the `http.Handler` interface.
+func (handler ReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var dryRun bool
+	switch r.Method {
+	case http.MethodGet:
+		dryRun = true
+	case http.MethodPost:
+		dryRun = false
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	chain := multichain.Chain(query.Get("chain"))
+	asset := multichain.Asset(query.Get("asset"))
+	watcher, ok := handler.watchers.Watcher(chain, asset)
+	if !ok {
+		http.Error(w, "no watcher for chain and asset", http.StatusNotFound)
+		return
+	}
+	from, err := strconv.ParseUint(query.Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid from block", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.ParseUint(query.Get("to"), 10, 64)
+	if err != nil || to < from {
+		http.Error(w, "invalid to block", http.StatusBadRequest)
+		return
+	}
+	if to-from >= MaxReplayBlocks {
+		http.Error(w, fmt.Sprintf("cannot replay more than %v blocks", MaxReplayBlocks), http.StatusBadRequest)
+		return
+	}
+
+	burns, err := watcher.Replay(r.Context(), from, to, dryRun, handler.known)
+	if err != nil {
+		handler.logger.Errorf("[watcher] cannot replay %v %v burns from=%v to=%v: %v", chain, asset, from, to, err)
+		http.Error(w, fmt.Sprintf("cannot replay burns: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !dryRun {
+		handler.logger.Infof("[watcher] replayed %v %v burns from=%v to=%v", chain, asset, from, to)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(burns)
+}
+
+// known returns whether the tx is already in the database.
+func (handler ReplayHandler) known(hash id.Hash) (bool, error) {
+	_, err := handler.db.TxStatus(hash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
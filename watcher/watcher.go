@@ -2,6 +2,7 @@ package watcher
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"time"
@@ -20,7 +21,13 @@ import (
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/hooks"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/renproject/lightnode/logging"
+	"github.com/renproject/lightnode/metrics"
 	"github.com/renproject/multichain"
 	"github.com/renproject/multichain/chain/bitcoin"
 	"github.com/renproject/multichain/chain/bitcoincash"
@@ -31,7 +38,6 @@ import (
 	"github.com/renproject/multichain/chain/terra"
 	"github.com/renproject/multichain/chain/zcash"
 	"github.com/renproject/pack"
-	"github.com/sirupsen/logrus"
 )
 
 type BurnInfo struct {
@@ -40,6 +46,7 @@ type BurnInfo struct {
 	ToBytes     []byte
 	Nonce       pack.Bytes32
 	BlockNumber pack.U64
+	LogIndex    pack.U64
 }
 
 type BurnLogResult struct {
@@ -79,46 +86,39 @@ func (fetcher EthBurnLogFetcher) FetchBurnLogs(ctx context.Context, from uint64,
 	resultChan := make(chan BurnLogResult)
 
 	go func() {
-		func() {
-			defer close(resultChan)
-			for iter.Next() {
-				nonce := iter.Event.N.Uint64()
-				var nonceBytes pack.Bytes32
-				copy(nonceBytes[:], pack.NewU256FromU64(pack.NewU64(nonce)).Bytes())
-				result := BurnInfo{
-					Txid:        iter.Event.Raw.TxHash.Bytes(),
-					Amount:      pack.NewU256FromInt(iter.Event.Amount),
-					ToBytes:     iter.Event.To,
-					Nonce:       nonceBytes,
-					BlockNumber: pack.NewU64(iter.Event.Raw.BlockNumber),
-				}
+		defer close(resultChan)
+		for iter.Next() {
+			nonce := iter.Event.N.Uint64()
+			var nonceBytes pack.Bytes32
+			copy(nonceBytes[:], pack.NewU256FromU64(pack.NewU64(nonce)).Bytes())
+			result := BurnInfo{
+				Txid:        iter.Event.Raw.TxHash.Bytes(),
+				Amount:      pack.NewU256FromInt(iter.Event.Amount),
+				ToBytes:     iter.Event.To,
+				Nonce:       nonceBytes,
+				BlockNumber: pack.NewU64(iter.Event.Raw.BlockNumber),
+				LogIndex:    pack.NewU64(uint64(iter.Event.Raw.Index)),
+			}
 
-				// Send the burn transaction to the resolver.
-				select {
-				case <-ctx.Done():
-					resultChan <- BurnLogResult{Error: ctx.Err()}
-					return
-				default:
-					resultChan <- BurnLogResult{Result: result}
-				}
+			// Send the burn transaction to the resolver.
+			if !sendBurnLogResult(ctx, resultChan, BurnLogResult{Result: result}) {
+				iter.Close()
+				return
 			}
-		}()
+		}
 
 		// Always close the iter to clear the event subscription
-		err = iter.Close()
-		if err != nil {
-			resultChan <- BurnLogResult{Error: err}
+		if err := iter.Close(); err != nil {
+			sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: err})
 			return
 		}
 
 		// Iter should stop if an error occurs,
 		// so no need to check on each iteration
-		err := iter.Error()
-		if err != nil {
-			resultChan <- BurnLogResult{Error: err}
+		if err := iter.Error(); err != nil {
+			sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: err})
 			return
 		}
-
 	}()
 
 	return resultChan, nil
@@ -163,20 +163,20 @@ func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uin
 
 			burnLogPubk, err := solanaSDK.PublicKeyFromBase58(string(burnLogDerivedAddress))
 			if err != nil {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("getting burn log account: %v", err)}
+				sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: fmt.Errorf("getting burn log account: %v", err)})
 				return
 			}
 
 			// Fetch account data at gateway's state
 			accountInfo, err := fetcher.client.GetAccountInfo(ctx, burnLogPubk)
 			if err != nil {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("getting burn log data for burn: %v err: %v", i, err)}
+				sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: fmt.Errorf("getting burn log data for burn: %v err: %v", i, err)})
 				return
 			}
 			data := accountInfo.Value.Data
 			amount, recipient, err := solanastate.DecodeBurnLog(data)
 			if err != nil {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("failed to decode burn log :  %v", err)}
+				sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: fmt.Errorf("failed to decode burn log :  %v", err)})
 				return
 			}
 
@@ -184,7 +184,7 @@ func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uin
 			if err != nil {
 				legacySignatures, err2 := fetcher.client.GetConfirmedSignaturesForAddress2(ctx, burnLogPubk, &solanaRPC.GetConfirmedSignaturesForAddress2Opts{})
 				if err2 != nil {
-					resultChan <- BurnLogResult{Error: fmt.Errorf("getting burn log txes: (current: %v) (legacy: %v)", err, err2)}
+					sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: fmt.Errorf("getting burn log txes: (current: %v) (legacy: %v)", err, err2)})
 					return
 				}
 				signatures = solanaRPC.GetSignaturesForAddressResult(legacySignatures)
@@ -194,7 +194,7 @@ func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uin
 			// manual intervention will be required to skip a burns where the signatures are no longer
 			// returned by the nodes
 			if len(signatures) == 0 {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("Burn signature not confirmed")}
+				sendBurnLogResult(ctx, resultChan, BurnLogResult{Error: fmt.Errorf("Burn signature not confirmed")})
 				return
 			}
 
@@ -207,12 +207,8 @@ func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uin
 			}
 
 			// Send the burn transaction to the resolver.
-			select {
-			case <-ctx.Done():
-				resultChan <- BurnLogResult{Error: ctx.Err()}
+			if !sendBurnLogResult(ctx, resultChan, BurnLogResult{Result: result}) {
 				return
-			default:
-				resultChan <- BurnLogResult{Result: result}
 			}
 		}
 	}()
@@ -220,6 +216,18 @@ func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uin
 	return resultChan, nil
 }
 
+// sendBurnLogResult sends the result unless the context is done first, so that
+// fetchers stop once the watcher is no longer reading their results. It
+// returns false if the result was not sent.
+func sendBurnLogResult(ctx context.Context, results chan<- BurnLogResult, result BurnLogResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case results <- result:
+		return true
+	}
+}
+
 type BlockHeightFetcher interface {
 	FetchBlockHeight(ctx context.Context) (uint64, error)
 }
@@ -263,20 +271,23 @@ func (fetcher SolFetcher) FetchBlockHeight(ctx context.Context) (uint64, error)
 // then forwarded to the cacher.
 type Watcher struct {
 	network            multichain.Network
-	logger             logrus.FieldLogger
+	logger             logging.Logger
 	selector           tx.Selector
 	bindings           binding.Bindings
 	burnLogFetcher     BurnLogFetcher
 	blockHeightFetcher BlockHeightFetcher
 	resolver           jsonrpc.Resolver
 	cache              redis.Cmdable
-	pollInterval       time.Duration
-	maxBlockAdvance    uint64
-	confidenceInterval uint64
+	config             ChainConfig
+	mappingExpiry      time.Duration
+	db                 db.DB
+	hooks              *hooks.Runner
 }
 
-// NewWatcher returns a new Watcher.
-func NewWatcher(logger logrus.FieldLogger, network multichain.Network, selector tx.Selector, bindings binding.Bindings, burnLogFetcher BurnLogFetcher, blockHeightFetcher BlockHeightFetcher, resolver jsonrpc.Resolver, cache redis.Cmdable, pollInterval time.Duration, maxBlockAdvance uint64, confidenceInterval uint64) Watcher {
+// NewWatcher returns a new Watcher, which polls and fetches burns as given by
+// the config. The registry of the config is not used, as the burns are
+// fetched by the given fetcher.
+func NewWatcher(logger logging.Logger, network multichain.Network, selector tx.Selector, bindings binding.Bindings, burnLogFetcher BurnLogFetcher, blockHeightFetcher BlockHeightFetcher, resolver jsonrpc.Resolver, cache redis.Cmdable, config ChainConfig, mappingExpiry time.Duration) Watcher {
 	return Watcher{
 		logger:             logger,
 		network:            network,
@@ -286,15 +297,29 @@ func NewWatcher(logger logrus.FieldLogger, network multichain.Network, selector
 		blockHeightFetcher: blockHeightFetcher,
 		resolver:           resolver,
 		cache:              cache,
-		pollInterval:       pollInterval,
-		maxBlockAdvance:    maxBlockAdvance,
-		confidenceInterval: confidenceInterval,
+		config:             config,
+		mappingExpiry:      mappingExpiry,
 	}
 }
 
+// WithDB records the burn events processed by the watcher in the database, so
+// that events which are scanned again, such as after the last checked block is
+// rewound, are not submitted twice.
+func (watcher Watcher) WithDB(database db.DB) Watcher {
+	watcher.db = database
+	return watcher
+}
+
+// WithHooks reports the chain as down to the given hooks while the block height
+// cannot be fetched.
+func (watcher Watcher) WithHooks(runner *hooks.Runner) Watcher {
+	watcher.hooks = runner
+	return watcher
+}
+
 // Run starts the watcher until the context is canceled.
 func (watcher Watcher) Run(ctx context.Context) {
-	ticker := time.NewTicker(watcher.pollInterval)
+	ticker := time.NewTicker(watcher.config.BlockTime)
 	defer ticker.Stop()
 
 	for {
@@ -311,21 +336,28 @@ func (watcher Watcher) Run(ctx context.Context) {
 // and the last checked block number. It constructs a `jsonrpc.Request` from
 // these events and forwards them to the resolver.
 func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
-	ctx, cancel := context.WithTimeout(parent, watcher.pollInterval)
+	ctx, cancel := context.WithTimeout(parent, watcher.config.BlockTime)
 	defer cancel()
 
 	// Get current block number and last checked block number.
 	currentHeight, err := watcher.blockHeightFetcher.FetchBlockHeight(ctx)
 	if err != nil {
 		watcher.logger.Warnf("[watcher] error loading block header: %v", err)
+		watcher.hooks.Fail(hooks.ConditionChainDown, string(watcher.selector.Source()), err)
 		return
 	}
+	watcher.hooks.Recover(hooks.ConditionChainDown, string(watcher.selector.Source()))
 
 	lastHeight, err := watcher.lastCheckedBlockNumber(currentHeight)
 	if err != nil {
 		watcher.logger.Errorf("[watcher] error loading last checked block number: %v", err)
 		return
 	}
+	var lag uint64
+	if currentHeight > lastHeight {
+		lag = currentHeight - lastHeight
+	}
+	metrics.SetWatcherLag(string(watcher.selector.Source()), string(watcher.selector.Asset()), lag)
 
 	if currentHeight <= lastHeight {
 		watcher.logger.Debug("[watcher] tried to process old blocks")
@@ -342,15 +374,13 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 	}
 
 	// Only advance by a set number of blocks at a time to prevent over-subscription
-	step := lastHeight + watcher.maxBlockAdvance
+	step := lastHeight + watcher.config.MaxLogRange
 	if step < currentHeight {
 		currentHeight = step
 	}
 
-	// for Eth, avoid checking blocks that might have shuffled
-	if watcher.selector.Source() != multichain.Solana {
-		currentHeight -= watcher.confidenceInterval
-	}
+	// Avoid checking blocks that might be reorganised.
+	currentHeight -= watcher.config.ConfidenceInterval
 
 	// Fetch logs
 	c, err := watcher.burnLogFetcher.FetchBurnLogs(ctx, lastHeight, currentHeight)
@@ -370,6 +400,12 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 		amount := burn.Amount
 		to := burn.ToBytes
 
+		digest := watcher.burnDigest(burn)
+		if watcher.processed(digest) {
+			watcher.logger.Debugf("[watcher] skipping processed burn for %v with nonce=%v", watcher.selector.String(), nonce)
+			continue
+		}
+
 		watcher.logger.Infof("[watcher] detected burn for %v  with nonce=%v", watcher.selector.String(), nonce)
 
 		// Send the burn transaction to the resolver.
@@ -379,13 +415,21 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 			continue
 		}
 
-		response := watcher.resolver.SubmitTx(ctx, 0, &params, nil)
+		response := watcher.resolver.SubmitTx(lhttp.WithInternal(ctx), 0, &params, nil)
 		if response.Error != nil {
 			watcher.logger.Errorf("[watcher] invalid burn transaction %v: %v", params, response.Error.Message)
 			// return so that we retry, if the burnToParams are valid, the darknode should accept the tx
 			// we assume that the only failure case would be RPC/darknode backpressure, so we backoff here
 			return
 		}
+		watcher.markProcessed(digest, burn)
+	}
+
+	// The fetchers stop without an error once the context is done, in which
+	// case some logs may not have been read.
+	if ctx.Err() != nil {
+		watcher.logger.Warnf("[watcher] stopped fetching LogBurn events from=%v to=%v: %v", lastHeight, currentHeight, ctx.Err())
+		return
 	}
 
 	if err := watcher.cache.Set(watcher.key(), currentHeight, 0).Err(); err != nil {
@@ -394,6 +438,43 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 	}
 }
 
+// burnDigest returns the digest identifying the burn event by its selector,
+// block and log index.
+func (watcher Watcher) burnDigest(burn BurnInfo) id.Hash {
+	return id.Hash(sha256.Sum256([]byte(fmt.Sprintf("%v/%v/%v", watcher.selector, burn.BlockNumber, burn.LogIndex))))
+}
+
+// processed returns whether the burn event with the given digest has already
+// been submitted. Events are assumed not to have been processed if the
+// database cannot be read, in which case the burn is submitted again; its tx
+// is not inserted twice, as existing txs are skipped when they are persisted.
+func (watcher Watcher) processed(digest id.Hash) bool {
+	if watcher.db == nil {
+		return false
+	}
+	processed, err := watcher.db.BurnEventProcessed(digest)
+	if err != nil {
+		watcher.logger.Warnf("[watcher] cannot check whether burn event was processed: %v", err)
+		return false
+	}
+	return processed
+}
+
+// markProcessed records that the burn event has been submitted.
+func (watcher Watcher) markProcessed(digest id.Hash, burn BurnInfo) {
+	if watcher.db == nil {
+		return
+	}
+	event := db.BurnEvent{
+		Selector:    watcher.selector.String(),
+		BlockNumber: uint64(burn.BlockNumber),
+		LogIndex:    uint64(burn.LogIndex),
+	}
+	if err := watcher.db.InsertBurnEvent(digest, event); err != nil {
+		watcher.logger.Warnf("[watcher] cannot record processed burn event: %v", err)
+	}
+}
+
 // key returns the key that is used to store the last checked block.
 func (watcher Watcher) key() string {
 	return fmt.Sprintf("%v_lastCheckedBlock", watcher.selector.String())
@@ -417,12 +498,44 @@ func (watcher Watcher) lastCheckedBlockNumber(currentBlockN uint64) (uint64, err
 
 // burnToParams constructs params for a SubmitTx request with given ref.
 func (watcher Watcher) burnToParams(txid pack.Bytes, amount pack.U256, toBytes []byte, nonce pack.Bytes32) (jsonrpc.ParamsSubmitTx, error) {
+	transaction, err := watcher.burnToTx(txid, amount, toBytes, nonce)
+	if err != nil {
+		return jsonrpc.ParamsSubmitTx{}, err
+	}
+	watcher.persistMappings(transaction, nonce)
+	return jsonrpc.ParamsSubmitTx{Tx: transaction}, nil
+}
+
+// persistMappings persists the v0 mappings of the release tx for the burn
+// with given nonce.
+func (watcher Watcher) persistMappings(transaction tx.Tx, nonce pack.Bytes32) {
+	// Map the v0 burn txhash to v1 txhash so that it is still
+	// queryable
+	// We don't get the required data during tx submission rpc to track it there,
+	// so we persist here in order to not re-filter all burn events
+	v0Hash := v0.BurnTxHash(watcher.selector, pack.NewU256(nonce))
+
+	// Map the selector + burn ref to the v0 hash so that we can return something
+	// to ren-js v1
+	refKey := fmt.Sprintf("%s_%v", watcher.selector, pack.NewU256(nonce).String())
+	mappings := []v0.Mapping{
+		{Key: v0Hash.String(), Value: transaction.Hash.String(), V1Hash: transaction.Hash},
+		{Key: refKey, Value: v0Hash.String(), V1Hash: transaction.Hash},
+	}
+	if err := v0.SetMappings(watcher.cache, mappings, watcher.mappingExpiry); err != nil {
+		watcher.logger.Errorf("[watcher] cannot persist v0 mappings: %v", err)
+	}
+}
+
+// burnToTx constructs the release tx for the burn with given ref, without
+// persisting any mappings.
+func (watcher Watcher) burnToTx(txid pack.Bytes, amount pack.U256, toBytes []byte, nonce pack.Bytes32) (tx.Tx, error) {
 	var to multichain.Address
 	var toDecoded []byte
 	var err error
 	to, toDecoded, err = watcher.handleAssetAddr(toBytes)
 	if err != nil {
-		return jsonrpc.ParamsSubmitTx{}, err
+		return tx.Tx{}, err
 	}
 
 	watcher.logger.Infof("[watcher] burn parameters (to=%v, amount=%v, nonce=%v)", string(to), amount, nonce)
@@ -445,31 +558,18 @@ func (watcher Watcher) burnToParams(txid pack.Bytes, amount pack.U256, toBytes [
 		Ghash:   ghash,
 	})
 	if err != nil {
-		return jsonrpc.ParamsSubmitTx{}, err
+		return tx.Tx{}, err
 	}
 	hash, err := tx.NewTxHash(tx.Version1, watcher.selector, pack.Typed(input.(pack.Struct)))
 	if err != nil {
-		return jsonrpc.ParamsSubmitTx{}, err
+		return tx.Tx{}, err
 	}
-	transaction := tx.Tx{
+	return tx.Tx{
 		Hash:     hash,
 		Version:  tx.Version1,
 		Selector: watcher.selector,
 		Input:    pack.Typed(input.(pack.Struct)),
-	}
-
-	// Map the v0 burn txhash to v1 txhash so that it is still
-	// queryable
-	// We don't get the required data during tx submission rpc to track it there,
-	// so we persist here in order to not re-filter all burn events
-	v0Hash := v0.BurnTxHash(watcher.selector, pack.NewU256(nonce))
-	watcher.cache.Set(v0Hash.String(), transaction.Hash.String(), 0)
-
-	// Map the selector + burn ref to the v0 hash so that we can return something
-	// to ren-js v1
-	watcher.cache.Set(fmt.Sprintf("%s_%v", watcher.selector, pack.NewU256(nonce).String()), v0Hash.String(), 0)
-
-	return jsonrpc.ParamsSubmitTx{Tx: transaction}, nil
+	}, nil
 }
 
 func (watcher Watcher) handleAssetAddr(toBytes []byte) (multichain.Address, []byte, error) {
@@ -2,10 +2,22 @@ package watcher_test
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	_ "github.com/mattn/go-sqlite3"
 	. "github.com/onsi/ginkgo"
@@ -15,9 +27,14 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v7"
 	"github.com/renproject/darknode/binding"
+	"github.com/renproject/darknode/binding/gatewaybinding"
+	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/jsonrpc/jsonrpcresolver"
 	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/logging"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
 	"github.com/sirupsen/logrus"
@@ -25,6 +42,42 @@ import (
 	solanaRPC "github.com/dfuse-io/solana-go/rpc"
 )
 
+// staticBurnLogFetcher returns the burns in the requested block range.
+type staticBurnLogFetcher struct {
+	burns    []BurnInfo
+	requests chan [2]uint64
+}
+
+func (fetcher staticBurnLogFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	fetcher.requests <- [2]uint64{from, to}
+	results := make(chan BurnLogResult, len(fetcher.burns))
+	for _, burn := range fetcher.burns {
+		if burn.BlockNumber.Uint64() >= from && burn.BlockNumber.Uint64() <= to {
+			results <- BurnLogResult{Result: burn}
+		}
+	}
+	close(results)
+	return results, nil
+}
+
+// staticBlockHeightFetcher always returns the same block height.
+type staticBlockHeightFetcher uint64
+
+func (fetcher staticBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	return uint64(fetcher), nil
+}
+
+// countingResolver counts the txs submitted to it.
+type countingResolver struct {
+	jsonrpc.Resolver
+	submitted *int64
+}
+
+func (resolver countingResolver) SubmitTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsSubmitTx, req *http.Request) jsonrpc.Response {
+	atomic.AddInt64(resolver.submitted, 1)
+	return resolver.Resolver.SubmitTx(ctx, id, params, req)
+}
+
 type MockBurnLogFetcher struct {
 	BurnIn chan BurnLogResult
 	state  *MockState
@@ -98,10 +151,66 @@ func (fetcher MockBurnLogFetcher) FetchBurnLogs(ctx context.Context, from uint64
 	return x, nil
 }
 
-// Flag to check whether ethereum client is progressing
-// We need to wait a few seconds for new blocks,
-// so it is something we only want to do once
-var live = false
+// localBitcoinRPC is the RPC of the Bitcoin bindings used to decode
+// addresses. Decoding addresses does not call the RPC, so nothing needs to be
+// listening on it.
+const localBitcoinRPC = "http://127.0.0.1:18443"
+
+// initialBlockHeight is the block height of the chain when the watchers are
+// started.
+const initialBlockHeight = 10000000
+
+// progressingBlockHeightFetcher returns a block height which increases by one
+// every second, like a live chain.
+type progressingBlockHeightFetcher struct {
+	start time.Time
+}
+
+func (fetcher progressingBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	return initialBlockHeight + uint64(time.Since(fetcher.start)/time.Second), nil
+}
+
+// newEthLogServer returns an Ethereum JSON-RPC server which serves the given
+// logs in response to eth_getLogs.
+func newEthLogServer(logs ...types.Log) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params []struct {
+				FromBlock hexutil.Uint64 `json:"fromBlock"`
+				ToBlock   hexutil.Uint64 `json:"toBlock"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "eth_getLogs" || len(req.Params) != 1 {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		result := []types.Log{}
+		for _, log := range logs {
+			if log.BlockNumber >= uint64(req.Params[0].FromBlock) && log.BlockNumber <= uint64(req.Params[0].ToBlock) {
+				result = append(result, log)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+// burnLog returns the LogBurn event of a gateway for a burn.
+func burnLog(gateway common.Address, txHash common.Hash, blockNumber uint64, to []byte, amount *big.Int, nonce *big.Int) types.Log {
+	gatewayABI, err := abi.JSON(strings.NewReader(gatewaybinding.MintGatewayLogicV1ABI))
+	Expect(err).NotTo(HaveOccurred())
+	event := gatewayABI.Events["LogBurn"]
+	data, err := event.Inputs.NonIndexed().Pack(to, amount)
+	Expect(err).NotTo(HaveOccurred())
+	return types.Log{
+		Address:     gateway,
+		Topics:      []common.Hash{event.ID, common.BigToHash(nonce), crypto.Keccak256Hash(to)},
+		Data:        data,
+		BlockNumber: blockNumber,
+		TxHash:      txHash,
+	}
+}
 
 var _ = Describe("Watcher", func() {
 	init := func(ctx context.Context, interval time.Duration, reliableResponder bool) (Watcher, *redis.Client, chan BurnLogResult, *miniredis.Miniredis) {
@@ -128,37 +237,15 @@ var _ = Describe("Watcher", func() {
 		bindingsOpts := binding.DefaultOptions().
 			WithNetwork("localnet").
 			WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-				RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
-				Confirmations: pack.U64(0),
-			}).
-			WithChainOptions(multichain.Ethereum, binding.ChainOptions{
-				RPC:           pack.String("https://multichain-staging.renproject.io/testnet/kovan"),
+				RPC:           pack.String(localBitcoinRPC),
 				Confirmations: pack.U64(0),
-				Protocol:      pack.String("0x5045E727D9D9AcDe1F6DCae52B078EC30dC95455"),
 			})
 
 		bindings := binding.New(bindingsOpts)
-		if err != nil {
-			logger.Panicf("bad bindings: %v", err)
-		}
-
-		ethClient := bindings.EthereumClient(multichain.Ethereum)
 		fetcher := NewMockBurnLogFetcher(burnIn)
-		heightFetcher := NewEthBlockHeightFetcher(ethClient)
+		heightFetcher := progressingBlockHeightFetcher{start: time.Now()}
 
-		// Check if the ethereum client is progressing
-		if live == false {
-			h1, err := heightFetcher.FetchBlockHeight(ctx)
-			time.Sleep(10 * time.Second)
-			h2, err := heightFetcher.FetchBlockHeight(ctx)
-
-			if h1 == h2 || err != nil {
-				logger.Panicf("eth client has stalled: %v", err)
-			}
-			live = true
-		}
-
-		watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, bindings, fetcher, heightFetcher, mockResolver, client, interval, 1000, 6)
+		watcher := NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, selector, bindings, fetcher, heightFetcher, mockResolver, client, ChainConfig{BlockTime: interval, MaxLogRange: 1000, ConfidenceInterval: 6}, time.Hour)
 
 		return watcher, client, burnIn, mr
 	}
@@ -259,17 +346,12 @@ var _ = Describe("Watcher", func() {
 		})
 
 		It("should process logs in block batches", func() {
-			ethC, err := ethclient.Dial("https://multichain-staging.renproject.io/testnet/kovan")
-			Expect(err).NotTo(HaveOccurred())
-
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 			watcher, redisClient, burnIn, _ := init(ctx, time.Second, true)
 			defer redisClient.Close()
 
-			currentBlock, err := ethC.HeaderByNumber(ctx, nil)
-			Expect(err).NotTo(HaveOccurred())
-			blockNumber := currentBlock.Number.Uint64()
+			blockNumber := uint64(initialBlockHeight)
 
 			// Set the last checked block some time in the past
 			redisClient.Set("BTC/fromEthereum_lastCheckedBlock", blockNumber-5000, 0)
@@ -588,21 +670,15 @@ var _ = Describe("Watcher", func() {
 		It("should be able to call filter logs on ethereum", func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 			defer cancel()
-			bindingsOpts := binding.DefaultOptions().
-				WithNetwork("localnet").
-				WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-					RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
-					Confirmations: pack.U64(0),
-				}).
-				WithChainOptions(multichain.Ethereum, binding.ChainOptions{
-					RPC:           pack.String("https://multichain-staging.renproject.io/testnet/kovan"),
-					Confirmations: pack.U64(0),
-					Protocol:      pack.String("0x59e23c087cA9bd9ce162875811CD6e99134D6d0F"),
-				})
+			gateway := common.HexToAddress("0x59e23c087cA9bd9ce162875811CD6e99134D6d0F")
+			txHash := common.BytesToHash([]byte{42, 187, 84, 27, 111, 181, 207, 26, 30, 239, 244, 76, 7, 157, 157, 29, 159, 155, 62, 12, 65, 112, 124, 110, 85, 132, 116, 128, 171, 68, 197, 65})
+			server := newEthLogServer(burnLog(gateway, txHash, 23704993, []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"), big.NewInt(896853), big.NewInt(2535)))
+			defer server.Close()
 
-			bindings := binding.New(bindingsOpts)
-
-			btcGateway := bindings.EthereumGateway(multichain.Ethereum, multichain.BTC)
+			ethClient, err := ethclient.Dial(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			btcGateway, err := gatewaybinding.NewMintGatewayLogicV1(gateway, ethClient)
+			Expect(err).NotTo(HaveOccurred())
 			burnLogFetcher := NewEthBurnLogFetcher(btcGateway)
 
 			results, err := burnLogFetcher.FetchBurnLogs(ctx, 0, 0)
@@ -665,7 +741,7 @@ var _ = Describe("Watcher", func() {
 			defer cancel()
 			bindingsOpts := binding.DefaultOptions().WithNetwork("localnet").
 				WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-					RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
+					RPC:           pack.String(localBitcoinRPC),
 					Confirmations: pack.U64(0),
 				}).
 				// Tests against solana localnet
@@ -710,7 +786,7 @@ var _ = Describe("Watcher", func() {
 			// We set the last checked block manually, because it will always start after the last checked burn
 			client.Set("BTC/fromSolana_lastCheckedBlock", 1, 0)
 
-			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, bindings, burnLogFetcher, burnLogFetcher, mockResolver, client, time.Second, 1000, 6)
+			watcher := NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, selector, bindings, burnLogFetcher, burnLogFetcher, mockResolver, client, ChainConfig{BlockTime: time.Second, MaxLogRange: 1000, ConfidenceInterval: 6}, time.Hour)
 
 			go watcher.Run(ctx)
 
@@ -726,7 +802,7 @@ var _ = Describe("Watcher", func() {
 			bindingsOpts := binding.DefaultOptions().
 				WithNetwork("localnet").
 				WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
-					RPC:           pack.String("https://multichain-staging.renproject.io/testnet/bitcoind"),
+					RPC:           pack.String(localBitcoinRPC),
 					Confirmations: pack.U64(0),
 				}).
 				// Tests against solana localnet
@@ -780,3 +856,173 @@ var _ = Describe("Watcher", func() {
 	})
 
 })
+
+var _ = Describe("Replaying burns", func() {
+	init := func() (Watcher, staticBurnLogFetcher, *redis.Client) {
+		mr, err := miniredis.Run()
+		Expect(err).NotTo(HaveOccurred())
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+		logger := logrus.New()
+		logger.SetLevel(logrus.ErrorLevel)
+
+		bindings := binding.New(binding.DefaultOptions().
+			WithNetwork("localnet").
+			WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
+				RPC:           pack.String(localBitcoinRPC),
+				Confirmations: pack.U64(0),
+			}))
+
+		fetcher := staticBurnLogFetcher{requests: make(chan [2]uint64, 10)}
+		for i, block := range []uint64{3, 7, 12} {
+			fetcher.burns = append(fetcher.burns, BurnInfo{
+				ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+				Amount:      pack.NewU256FromU64(10000),
+				Nonce:       pack.NewU256FromU64(pack.U64(i)).Bytes32(),
+				BlockNumber: pack.NewU64(block),
+			})
+		}
+
+		watcher := NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, tx.Selector("BTC/fromEthereum"), bindings, fetcher, nil, jsonrpcresolver.OkResponder(), client, ChainConfig{BlockTime: time.Second, MaxLogRange: 5, ConfidenceInterval: 6}, time.Hour)
+		return watcher, fetcher, client
+	}
+
+	unknown := func(id.Hash) (bool, error) { return false, nil }
+
+	It("should scan the range in steps without submitting burns in a dry run", func() {
+		watcher, fetcher, client := init()
+		defer client.Close()
+
+		burns, err := watcher.Replay(context.Background(), 1, 10, true, unknown)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(burns).To(HaveLen(2))
+		for _, burn := range burns {
+			Expect(burn.Status).To(Equal(ReplayStatusFound))
+		}
+		Expect(<-fetcher.requests).To(Equal([2]uint64{1, 5}))
+		Expect(<-fetcher.requests).To(Equal([2]uint64{6, 10}))
+		Expect(client.Keys("*").Val()).To(BeEmpty())
+	})
+
+	It("should skip known burns and submit the others", func() {
+		watcher, _, client := init()
+		defer client.Close()
+
+		dryRun, err := watcher.Replay(context.Background(), 1, 12, true, unknown)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dryRun).To(HaveLen(3))
+
+		known := func(hash id.Hash) (bool, error) { return hash == dryRun[0].Hash, nil }
+		burns, err := watcher.Replay(context.Background(), 1, 12, false, known)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(burns).To(HaveLen(3))
+		Expect(burns[0].Status).To(Equal(ReplayStatusKnown))
+		Expect(burns[1].Status).To(Equal(ReplayStatusSubmitted))
+		Expect(burns[2].Status).To(Equal(ReplayStatusSubmitted))
+
+		v0Hash := v0.BurnTxHash(tx.Selector("BTC/fromEthereum"), pack.NewU256FromU8(1))
+		Expect(client.Get("BTC/fromEthereum_1").Val()).To(Equal(v0Hash.String()))
+	})
+})
+
+var _ = Describe("Processed burn events", func() {
+	It("should not submit burns again after the last checked block is rewound", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		mr, err := miniredis.Run()
+		Expect(err).NotTo(HaveOccurred())
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer client.Close()
+
+		sqlDB, err := sql.Open("sqlite3", ":memory:")
+		Expect(err).NotTo(HaveOccurred())
+		defer sqlDB.Close()
+		sqlDB.SetMaxOpenConns(1)
+		database := db.New(sqlDB, 0, 1)
+		Expect(database.Init()).To(Succeed())
+
+		logger := logrus.New()
+		logger.SetLevel(logrus.ErrorLevel)
+		bindings := binding.New(binding.DefaultOptions().
+			WithNetwork("localnet").
+			WithChainOptions(multichain.Bitcoin, binding.ChainOptions{
+				RPC:           pack.String(localBitcoinRPC),
+				Confirmations: pack.U64(0),
+			}))
+
+		fetcher := staticBurnLogFetcher{requests: make(chan [2]uint64, 100)}
+		for i, block := range []uint64{3, 7, 12} {
+			fetcher.burns = append(fetcher.burns, BurnInfo{
+				ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+				Amount:      pack.NewU256FromU64(10000),
+				Nonce:       pack.NewU256FromU64(pack.U64(i)).Bytes32(),
+				BlockNumber: pack.NewU64(block),
+			})
+		}
+		go func() {
+			for range fetcher.requests {
+			}
+		}()
+
+		var submitted int64
+		resolver := countingResolver{Resolver: jsonrpcresolver.OkResponder(), submitted: &submitted}
+		Expect(client.Set("BTC/fromEthereum_lastCheckedBlock", 1, 0).Err()).To(Succeed())
+		watcher := NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, tx.Selector("BTC/fromEthereum"), bindings, fetcher, staticBlockHeightFetcher(20), resolver, client, ChainConfig{BlockTime: 100 * time.Millisecond, MaxLogRange: 1000, ConfidenceInterval: 6}, time.Hour).WithDB(database)
+		go watcher.Run(ctx)
+
+		Eventually(func() uint64 {
+			last, _ := client.Get("BTC/fromEthereum_lastCheckedBlock").Uint64()
+			return last
+		}, 5*time.Second).Should(Equal(uint64(14)))
+		Expect(atomic.LoadInt64(&submitted)).To(Equal(int64(3)))
+
+		// Rewinding the last checked block scans the burns again, but they
+		// are not submitted again.
+		Expect(client.Set("BTC/fromEthereum_lastCheckedBlock", 1, 0).Err()).To(Succeed())
+		Eventually(func() uint64 {
+			last, _ := client.Get("BTC/fromEthereum_lastCheckedBlock").Uint64()
+			return last
+		}, 5*time.Second).Should(Equal(uint64(14)))
+		Consistently(func() int64 {
+			return atomic.LoadInt64(&submitted)
+		}, time.Second).Should(Equal(int64(3)))
+	})
+})
+
+var _ = Describe("Chain config", func() {
+	It("should stay behind the head and limit the range of each fetch as configured", func() {
+		logger := logrus.New()
+		logger.SetLevel(logrus.ErrorLevel)
+
+		for _, test := range []struct {
+			config ChainConfig
+			to     uint64
+		}{
+			{ChainConfig{BlockTime: time.Second, MaxLogRange: 1000, ConfidenceInterval: 6}, 14},
+			{ChainConfig{BlockTime: time.Second, MaxLogRange: 1000, ConfidenceInterval: 0}, 20},
+			{ChainConfig{BlockTime: time.Second, MaxLogRange: 5, ConfidenceInterval: 0}, 6},
+			{ChainConfig{BlockTime: time.Second, MaxLogRange: 5, ConfidenceInterval: 2}, 4},
+		} {
+			func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				mr, err := miniredis.Run()
+				Expect(err).NotTo(HaveOccurred())
+				defer mr.Close()
+				client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+				defer client.Close()
+
+				fetcher := staticBurnLogFetcher{requests: make(chan [2]uint64, 100)}
+				Expect(client.Set("BTC/fromEthereum_lastCheckedBlock", 1, 0).Err()).To(Succeed())
+				watcher := NewWatcher(logging.FromLogrus(logger), multichain.NetworkDevnet, tx.Selector("BTC/fromEthereum"), nil, fetcher, staticBlockHeightFetcher(20), jsonrpcresolver.OkResponder(), client, test.config, time.Hour)
+				go watcher.Run(ctx)
+
+				var request [2]uint64
+				Eventually(fetcher.requests, 5*time.Second).Should(Receive(&request))
+				Expect(request).To(Equal([2]uint64{1, test.to}))
+			}()
+		}
+	})
+})